@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+func newAgentsCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agents",
+		Short: "Discover the agents a server provides, or scaffold a new one",
+	}
+	cmd.AddCommand(newAgentsListCmd(opts), newAgentsDescribeCmd(opts), newAgentsScaffoldCmd(opts))
+	return cmd
+}
+
+func newAgentsListCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List registered agents",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			agents, err := c.ListAgents(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return opts.render(cmd.OutOrStdout(), agents, func(w io.Writer) error {
+				tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "NAME\tDESCRIPTION")
+				for _, a := range agents {
+					fmt.Fprintf(tw, "%s\t%s\n", a.Name, a.Description)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+}
+
+func newAgentsDescribeCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "describe <agent>",
+		Short: "Show an agent's parameters and example prompts",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			info, err := c.DescribeAgent(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return opts.render(cmd.OutOrStdout(), info, func(w io.Writer) error {
+				return describeAgent(w, info)
+			})
+		},
+	}
+}
+
+func describeAgent(w io.Writer, info *mpcclient.AgentInfo) error {
+	fmt.Fprintf(w, "Name:         %s\n", info.Name)
+	if info.Description != "" {
+		fmt.Fprintf(w, "Description:  %s\n", info.Description)
+	}
+	if info.Version != "" {
+		fmt.Fprintf(w, "Version:      %s\n", info.Version)
+	}
+	if info.ProtocolVersion > 0 {
+		fmt.Fprintf(w, "Protocol:     %d\n", info.ProtocolVersion)
+	}
+	if len(info.Capabilities) > 0 {
+		fmt.Fprintf(w, "Capabilities: %s\n", strings.Join(info.Capabilities, ", "))
+	}
+	if len(info.RequiredContext) > 0 {
+		fmt.Fprintf(w, "Context:      %s\n", strings.Join(info.RequiredContext, ", "))
+	}
+	if len(info.Formats) > 0 {
+		formats := make([]string, len(info.Formats))
+		for i, f := range info.Formats {
+			formats[i] = string(f)
+		}
+		fmt.Fprintf(w, "Formats:      %s\n", strings.Join(formats, ", "))
+	}
+	if len(info.Models) > 0 {
+		fmt.Fprintf(w, "Models:       %s\n", strings.Join(info.Models, ", "))
+	}
+	if len(info.Parameters) > 0 {
+		fmt.Fprintln(w, "Parameters:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, p := range info.Parameters {
+			req := ""
+			if p.Required {
+				req = "required"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", p.Name, p.Type, req, p.Description)
+		}
+		tw.Flush()
+	}
+	if ex := info.Examples(); len(ex) > 0 {
+		fmt.Fprintln(w, "Examples:")
+		for _, e := range ex {
+			fmt.Fprintf(w, "  %s\n", e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+func newAskCmd(opts *globalOptions) *cobra.Command {
+	var (
+		stream      bool
+		format      string
+		model       string
+		temperature float64
+		maxTokens   int
+		minVersion  string
+		requires    []string
+	)
+	cmd := &cobra.Command{
+		Use:   "ask <agent> <prompt>",
+		Short: "Send a prompt to an agent",
+		Long:  "Send a prompt to an agent and print its response. Pass - as the prompt to read it from stdin.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			agent := args[0]
+			prompt := strings.Join(args[1:], " ")
+			if prompt == "-" {
+				b, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return fmt.Errorf("read prompt: %w", err)
+				}
+				prompt = string(b)
+			}
+
+			c, closeHistory, err := opts.recordingClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeHistory()
+			var callOpts []mpcclient.CallOption
+			if format != "" {
+				callOpts = append(callOpts, mpcclient.WithFormat(mpcclient.Format(format)))
+			}
+			if model != "" {
+				callOpts = append(callOpts, mpcclient.WithModel(model))
+			}
+			if cmd.Flags().Changed("temperature") {
+				callOpts = append(callOpts, mpcclient.WithTemperature(temperature))
+			}
+			if maxTokens > 0 {
+				callOpts = append(callOpts, mpcclient.WithMaxTokens(maxTokens))
+			}
+			if minVersion != "" {
+				callOpts = append(callOpts, mpcclient.WithMinAgentVersion(minVersion))
+			}
+			if len(requires) > 0 {
+				callOpts = append(callOpts, mpcclient.WithRequiredCapabilities(requires...))
+			}
+			out := cmd.OutOrStdout()
+			if stream && opts.output == "text" {
+				_, err := c.StreamAgentTo(cmd.Context(), agent, prompt, out, callOpts...)
+				if ok, perr := opts.printDryRun(out, err); ok {
+					return perr
+				}
+				fmt.Fprintln(out)
+				return err
+			}
+
+			resp, err := c.CallAgent(cmd.Context(), agent, prompt, callOpts...)
+			if ok, perr := opts.printDryRun(out, err); ok {
+				return perr
+			}
+			if err != nil {
+				return err
+			}
+			return opts.render(out, resp, func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, resp.Text())
+				return err
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&stream, "stream", false, "print the response as it is generated (text output only)")
+	cmd.Flags().StringVar(&format, "format", "", "response format to ask the agent for: text, json or markdown")
+	cmd.Flags().StringVar(&model, "model", "", "model the agent is to generate with")
+	cmd.Flags().Float64Var(&temperature, "temperature", 0, "sampling temperature, from 0 to 2")
+	cmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "most tokens the agent may generate")
+	cmd.Flags().StringVar(&minVersion, "min-agent-version", "", "fail unless the agent is this version, such as 1.2.0, or later")
+	cmd.Flags().StringSliceVar(&requires, "require", nil, "fail unless the agent has these capabilities, such as tools or attachments")
+	return cmd
+}
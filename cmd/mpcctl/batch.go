@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Batch file formats.
+const (
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+)
+
+type batchOptions struct {
+	agent        string
+	input        string
+	output       string
+	inputFormat  string
+	outputFormat string
+	concurrency  int
+	retries      int
+}
+
+func newBatchCmd(opts *globalOptions) *cobra.Command {
+	bo := batchOptions{}
+	cmd := &cobra.Command{
+		Use:   "batch --agent <agent> --input <file>",
+		Short: "Run a file of prompts and write their results",
+		Long: "Send every row of a JSONL or CSV file to an agent, with bounded concurrency and retries, and write one result " +
+			"per row, in input order, with its status, latency, attempts and any error.\n\n" +
+			"JSONL rows are objects with a prompt and, optionally, an id, an agent overriding --agent, and parameters, context " +
+			"and metadata objects. CSV files have a header row naming a prompt column and optionally id and agent columns; " +
+			"every other column is passed as a parameter of that name. Formats follow the file extensions unless set with " +
+			"--input-format and --output-format; - reads stdin or writes stdout, as JSONL by default. Here --output names the " +
+			"results file, not the output format. The command fails if any row did, after writing every result. Progress is shown on stderr unless --no-progress is set.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if bo.concurrency <= 0 || bo.retries < 0 {
+				return errors.New("--concurrency must be positive and --retries not negative")
+			}
+			inFormat, err := fileFormat(bo.input, bo.inputFormat, "--input-format")
+			if err != nil {
+				return err
+			}
+			outFormat, err := fileFormat(bo.output, bo.outputFormat, "--output-format")
+			if err != nil {
+				return err
+			}
+			rows, err := readBatch(cmd.InOrStdin(), bo.input, inFormat)
+			if err != nil {
+				return err
+			}
+			reqs := make([]mpcclient.BatchRequest, len(rows))
+			for i, row := range rows {
+				if row.Agent == "" {
+					row.Agent = bo.agent
+				}
+				if row.Agent == "" {
+					return fmt.Errorf("row %d names no agent and --agent is not set", i+1)
+				}
+				reqs[i] = mpcclient.BatchRequest{Agent: row.Agent, Request: mpcclient.AgentRequest{
+					Prompt: row.Prompt, Parameters: row.Parameters, Context: row.Context, Metadata: row.Metadata,
+				}}
+			}
+
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			retry := mpcclient.DefaultRetryPolicy()
+			retry.MaxAttempts = bo.retries + 1
+			p := opts.startProgress(cmd, "batch", len(reqs), 0)
+			results, _ := c.CallAgentBatch(cmd.Context(), reqs, mpcclient.BatchOptions{
+				Concurrency: bo.concurrency,
+				Retry:       retry,
+				OnProgress:  func(bp mpcclient.BatchProgress) { p.record(bp.Last.Err != nil) },
+			})
+			p.stop()
+
+			records := make([]batchRecord, len(results))
+			failed := 0
+			for i, res := range results {
+				records[i] = newBatchRecord(i+1, rows[i], res)
+				if res.Err != nil {
+					failed++
+				}
+			}
+			if err := writeBatch(cmd.OutOrStdout(), bo.output, outFormat, records); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d rows failed", failed, len(records))
+			}
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&bo.agent, "agent", "", "agent to call for rows that name none")
+	f.StringVar(&bo.input, "input", "-", "JSONL or CSV `file` of prompts; - reads stdin")
+	f.StringVar(&bo.output, "output", "-", "JSONL or CSV `file` to write the results to; - writes stdout")
+	f.StringVar(&bo.inputFormat, "input-format", "", "input format, jsonl or csv; defaults to the file extension")
+	f.StringVar(&bo.outputFormat, "output-format", "", "output format, jsonl or csv; defaults to the file extension")
+	f.IntVar(&bo.concurrency, "concurrency", mpcclient.DefaultBatchConcurrency, "maximum calls in flight")
+	f.IntVar(&bo.retries, "retries", 2, "times a failing row is retried, on top of the client's retries of single requests")
+	return cmd
+}
+
+// fileFormat returns the format of the batch file at path: explicit if
+// set, else that of its extension, else JSONL.
+func fileFormat(path, explicit, flag string) (string, error) {
+	format := explicit
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format != formatCSV {
+			format = formatJSONL
+		}
+	}
+	if format != formatJSONL && format != formatCSV {
+		return "", fmt.Errorf("%s must be jsonl or csv, not %q", flag, format)
+	}
+	return format, nil
+}
+
+// batchRow is one input row.
+type batchRow struct {
+	ID         string            `json:"id,omitempty"`
+	Agent      string            `json:"agent,omitempty"`
+	Prompt     string            `json:"prompt"`
+	Parameters map[string]any    `json:"parameters,omitempty"`
+	Context    map[string]any    `json:"context,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// readBatch reads the rows of the batch file at path, or of stdin for -.
+func readBatch(stdin io.Reader, path, format string) ([]batchRow, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("read batch: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var (
+		rows []batchRow
+		err  error
+	)
+	if format == formatCSV {
+		rows, err = readCSVBatch(r)
+	} else {
+		rows, err = readJSONLBatch(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read batch %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("read batch %s: no rows", path)
+	}
+	return rows, nil
+}
+
+func readJSONLBatch(r io.Reader) ([]batchRow, error) {
+	var rows []batchRow
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var row batchRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if strings.TrimSpace(row.Prompt) == "" {
+			return nil, fmt.Errorf("line %d: prompt is required", line)
+		}
+		rows = append(rows, row)
+	}
+	return rows, sc.Err()
+}
+
+func readCSVBatch(r io.Reader) ([]batchRow, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if !slices.Contains(header, "prompt") {
+		return nil, errors.New("header has no prompt column")
+	}
+	var rows []batchRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var row batchRow
+		for i, v := range rec {
+			switch name := header[i]; name {
+			case "prompt":
+				row.Prompt = v
+			case "id":
+				row.ID = v
+			case "agent":
+				row.Agent = v
+			default:
+				if v == "" {
+					continue
+				}
+				if row.Parameters == nil {
+					row.Parameters = make(map[string]any)
+				}
+				row.Parameters[name] = v
+			}
+		}
+		if strings.TrimSpace(row.Prompt) == "" {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: prompt is required", line)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// batchRecord is the result of one row.
+type batchRecord struct {
+	// Row is the row's position in the input, from 1.
+	Row       int             `json:"row"`
+	ID        string          `json:"id,omitempty"`
+	Agent     string          `json:"agent"`
+	Prompt    string          `json:"prompt"`
+	Status    string          `json:"status"`
+	Result    string          `json:"result,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	LatencyMS float64         `json:"latency_ms"`
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error,omitempty"`
+	ErrorKind string          `json:"error_kind,omitempty"`
+}
+
+// Row statuses.
+const (
+	statusOK      = "ok"
+	statusError   = "error"
+	statusSkipped = "skipped"
+)
+
+func newBatchRecord(n int, row batchRow, res mpcclient.BatchResult) batchRecord {
+	rec := batchRecord{Row: n, ID: row.ID, Agent: res.Agent, Prompt: row.Prompt, LatencyMS: ms(res.Latency), Attempts: res.Attempts}
+	switch {
+	case errors.Is(res.Err, mpcclient.ErrBatchSkipped):
+		rec.Status = statusSkipped
+	case res.Err != nil:
+		rec.Status, rec.Error, rec.ErrorKind = statusError, res.Err.Error(), errorKind(res.Err)
+	default:
+		rec.Status, rec.Result, rec.Data, rec.RequestID = statusOK, res.Response.Result, res.Response.Data, res.Response.RequestID
+	}
+	return rec
+}
+
+// csvColumns are the columns of CSV results; data is left out.
+var csvColumns = []string{"row", "id", "agent", "status", "result", "request_id", "latency_ms", "attempts", "error", "error_kind"}
+
+// writeBatch writes records to the file at path, or to stdout for -.
+func writeBatch(stdout io.Writer, path, format string, records []batchRecord) (err error) {
+	w := stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("write results: %w", err)
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("write results: %w", cerr)
+			}
+		}()
+		w = f
+	}
+	if format == formatCSV {
+		cw := csv.NewWriter(w)
+		cw.Write(csvColumns)
+		for _, r := range records {
+			cw.Write([]string{
+				strconv.Itoa(r.Row), r.ID, r.Agent, r.Status, r.Result, r.RequestID,
+				strconv.FormatFloat(r.LatencyMS, 'f', 1, 64), strconv.Itoa(r.Attempts), r.Error, r.ErrorKind,
+			})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("write results: %w", err)
+		}
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("write results: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mdterm"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+const chatHelp = `Commands:
+  /switch <agent>  talk to another agent, keeping the conversation
+  /history         show the conversation so far
+  /save [file]     export the transcript as Markdown
+  /export <file>   export the conversation with the current agent, as
+                   OpenAI chat JSONL (.jsonl) or Markdown (.md)
+  /clear           start the conversation over
+  /help            show this help
+  /exit            leave (as does end of input)
+End a line with \ to continue the message on the next line.
+`
+
+func newChatCmd(opts *globalOptions) *cobra.Command {
+	var (
+		stream bool
+		system string
+		render string
+		width  int
+		from   string
+	)
+	cmd := &cobra.Command{
+		Use:   "chat <agent>",
+		Short: "Talk to an agent interactively",
+		Long: "Open an interactive conversation with an agent. Every message is sent with the conversation so far, " +
+			"so the agent can refer back to earlier turns. Lines starting with / are commands; /help lists them.\n\n" +
+			"Replies are Markdown. On a terminal they are rendered with colour, or as plain text if $NO_COLOR is set, " +
+			"and wrapped to its width; --render chooses the rendering elsewhere.\n\n" +
+			"--import continues a conversation exported with /export or by another tool, from an OpenAI chat JSONL " +
+			"(.jsonl) or Markdown (.md) file.\n\n" + chatHelp,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mdOpts, err := renderOptions(cmd.OutOrStdout(), render, width)
+			if err != nil {
+				return err
+			}
+			c, closeHistory, err := opts.recordingClient(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeHistory()
+			defer c.Close()
+
+			var sessOpts []mpcclient.SessionOption
+			if system != "" {
+				sessOpts = append(sessOpts, mpcclient.WithSystemPrompt(system))
+			}
+			session := c.NewSession(args[0], sessOpts...)
+			if from != "" {
+				if session, err = importSession(c, from, args[0], sessOpts); err != nil {
+					return err
+				}
+			}
+			ch := &chat{
+				client:  c,
+				session: session,
+				stream:  stream,
+				render:  mdOpts,
+				out:     cmd.OutOrStdout(),
+				errOut:  cmd.ErrOrStderr(),
+			}
+			for _, m := range session.History() {
+				ch.record(m.Role, m.Content)
+			}
+			return ch.run(cmd.Context(), cmd.InOrStdin())
+		},
+	}
+	cmd.Flags().BoolVar(&stream, "stream", false, "print replies as they are generated")
+	cmd.Flags().StringVar(&system, "system", "", "system prompt starting the conversation")
+	cmd.Flags().StringVar(&from, "import", "", "continue the conversation in this .jsonl or .md file")
+	cmd.Flags().StringVar(&render, "render", "auto", "how replies are rendered: auto, color, plain or none, which prints them as they are")
+	cmd.Flags().IntVar(&width, "width", 0, "wrap rendered replies at this many columns; 0 uses the terminal width, or 80")
+	return cmd
+}
+
+// renderOptions returns the options of the Markdown renderer replies
+// written to out go through for the --render mode, or nil to print them
+// as they are. auto renders on terminals only, without colour if
+// $NO_COLOR is set or $TERM is dumb.
+func renderOptions(out io.Writer, mode string, width int) ([]mdterm.Option, error) {
+	switch mode {
+	case "auto":
+		if !isTerminal(out) {
+			return nil, nil
+		}
+		mode = "color"
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			mode = "plain"
+		}
+	case "color", "plain":
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("--render must be auto, color, plain or none, not %q", mode)
+	}
+	if width <= 0 {
+		width = terminalWidth(out)
+	}
+	mdOpts := []mdterm.Option{mdterm.WithWidth(width)}
+	if mode == "plain" {
+		mdOpts = append(mdOpts, mdterm.WithPlain())
+	}
+	return mdOpts, nil
+}
+
+// chat is the state of one interactive session.
+type chat struct {
+	client  *mpcclient.Client
+	session *mpcclient.Session
+	stream  bool
+	// render holds the options replies are rendered as Markdown with; nil
+	// prints them as they are.
+	render []mdterm.Option
+	out    io.Writer
+	errOut io.Writer
+	// transcript is everything said since the start or the last /clear,
+	// across agent switches, for /save.
+	transcript []transcriptEntry
+}
+
+type transcriptEntry struct {
+	agent string
+	role  mpcclient.Role
+	text  string
+}
+
+// run reads and handles input until end of input or /exit.
+func (c *chat) run(ctx context.Context, in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	fmt.Fprintf(c.out, "Talking to %s. Type /help for commands.\n", c.session.Agent())
+	for {
+		msg, ok := c.readMessage(sc)
+		if !ok {
+			fmt.Fprintln(c.out)
+			return sc.Err()
+		}
+		switch {
+		case msg == "":
+		case strings.HasPrefix(msg, "/"):
+			if quit := c.command(msg); quit {
+				return nil
+			}
+		default:
+			if err := c.send(ctx, msg); err != nil {
+				var dr *mpcclient.DryRunError
+				switch {
+				case ctx.Err() != nil:
+					return err
+				case errors.As(err, &dr):
+					dr.WriteTo(c.out)
+					continue
+				}
+				fmt.Fprintf(c.errOut, "error: %v\n", err)
+			}
+		}
+	}
+}
+
+// readMessage prompts for and reads one message, joining lines that end
+// with a backslash.
+func (c *chat) readMessage(sc *bufio.Scanner) (string, bool) {
+	fmt.Fprintf(c.out, "%s> ", c.session.Agent())
+	var lines []string
+	for sc.Scan() {
+		line, more := strings.CutSuffix(sc.Text(), `\`)
+		lines = append(lines, line)
+		if !more {
+			return strings.TrimSpace(strings.Join(lines, "\n")), true
+		}
+		fmt.Fprint(c.out, "... ")
+	}
+	return "", false
+}
+
+// command runs a slash command and reports whether the session ends.
+func (c *chat) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Fprint(c.out, chatHelp)
+	case "/switch":
+		if arg == "" {
+			fmt.Fprintln(c.errOut, "usage: /switch <agent>")
+			break
+		}
+		c.session = c.client.NewSession(arg, mpcclient.WithHistory(c.session.History()))
+		fmt.Fprintf(c.out, "Now talking to %s.\n", arg)
+	case "/history":
+		for _, m := range c.session.History() {
+			fmt.Fprintf(c.out, "[%s] %s\n", m.Role, m.Content)
+		}
+	case "/clear":
+		c.session.Reset()
+		c.transcript = nil
+		for _, m := range c.session.History() {
+			c.record(m.Role, m.Content)
+		}
+		fmt.Fprintln(c.out, "Conversation cleared.")
+	case "/save":
+		path := arg
+		if path == "" {
+			path = fmt.Sprintf("chat-%s.md", time.Now().Format("20060102-150405"))
+		}
+		if err := os.WriteFile(path, []byte(c.markdown()), 0o644); err != nil {
+			fmt.Fprintf(c.errOut, "error: save transcript: %v\n", err)
+			break
+		}
+		fmt.Fprintf(c.out, "Transcript saved to %s.\n", path)
+	case "/export":
+		if arg == "" {
+			fmt.Fprintln(c.errOut, "usage: /export <file>")
+			break
+		}
+		if err := exportSession(c.session, arg); err != nil {
+			fmt.Fprintf(c.errOut, "error: export conversation: %v\n", err)
+			break
+		}
+		fmt.Fprintf(c.out, "Conversation exported to %s.\n", arg)
+	default:
+		fmt.Fprintf(c.errOut, "unknown command %s; /help lists commands\n", name)
+	}
+	return false
+}
+
+// send sends msg to the current agent and prints the reply.
+func (c *chat) send(ctx context.Context, msg string) error {
+	out, end := c.replyWriter()
+	var reply string
+	var err error
+	if c.stream {
+		var b strings.Builder
+		err = c.session.Stream(ctx, msg, func(ch mpcclient.Chunk) error {
+			b.WriteString(ch.Text)
+			_, err := io.WriteString(out, ch.Text)
+			return err
+		})
+		reply = b.String()
+	} else {
+		var resp *mpcclient.AgentResponse
+		if resp, err = c.session.Send(ctx, msg); err == nil {
+			reply = resp.Text()
+			io.WriteString(out, reply)
+		}
+	}
+	end(reply)
+	if err != nil {
+		return err
+	}
+	c.record(mpcclient.RoleUser, msg)
+	c.record(mpcclient.RoleAssistant, reply)
+	return nil
+}
+
+// replyWriter returns the writer a reply is printed through, rendered if
+// c.render is set, and the function that ends the reply once it is all
+// written.
+func (c *chat) replyWriter() (io.Writer, func(reply string)) {
+	if c.render == nil {
+		return c.out, func(reply string) {
+			if reply != "" {
+				fmt.Fprintln(c.out)
+			}
+		}
+	}
+	md := mdterm.NewWriter(c.out, c.render...)
+	return md, func(string) { md.Close() }
+}
+
+// sessionFormat returns the format of the conversation file path, by its
+// extension.
+func sessionFormat(path string) (mpcclient.Format, error) {
+	switch filepath.Ext(path) {
+	case ".jsonl":
+		return mpcclient.FormatOpenAIJSONL, nil
+	case ".md", ".markdown":
+		return mpcclient.FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("%s: conversation files are .jsonl, in the OpenAI chat format, or .md", path)
+}
+
+// importSession starts a session with agent continuing the conversation in
+// the file path.
+func importSession(c *mpcclient.Client, path, agent string, opts []mpcclient.SessionOption) (*mpcclient.Session, error) {
+	format, err := sessionFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.ImportSession(f, format, agent, opts...)
+}
+
+func exportSession(s *mpcclient.Session, path string) error {
+	format, err := sessionFormat(path)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := s.Export(&b, format); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0o644)
+}
+
+func (c *chat) record(role mpcclient.Role, text string) {
+	c.transcript = append(c.transcript, transcriptEntry{agent: c.session.Agent(), role: role, text: text})
+}
+
+// markdown renders the transcript as a Markdown document.
+func (c *chat) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Chat transcript\n\nServer: %s  \nSaved: %s\n", c.client.BaseURL(), time.Now().Format(time.RFC1123))
+	for _, e := range c.transcript {
+		heading := "You"
+		switch e.role {
+		case mpcclient.RoleSystem:
+			heading = "System"
+		case mpcclient.RoleAssistant:
+			heading = e.agent
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", heading, strings.TrimSpace(e.text))
+	}
+	return b.String()
+}
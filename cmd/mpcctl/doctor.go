@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/config"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Outcomes of a diagnostic check.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// Limits doctor holds the environment to.
+const (
+	// maxClockSkew is the largest difference from the server's clock
+	// doctor accepts; servers verifying signed requests refuse those more
+	// than five minutes off.
+	maxClockSkew = time.Minute
+	// certExpiryWarning is how close to its expiry the server's
+	// certificate is reported.
+	certExpiryWarning = 14 * 24 * time.Hour
+	// maxCheckTimeout bounds each network check.
+	maxCheckTimeout = 10 * time.Second
+)
+
+// check is the outcome of one diagnostic, with a hint at fixing it when
+// it did not pass.
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+func newDoctorCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor [agent...]",
+		Short: "Diagnose the setup and the connection to the server",
+		Long: "Check the client settings, the proxy, DNS, TCP and TLS reachability of the server, its health, " +
+			"the clock, the API key and the availability of agents, suggesting a fix for each problem found. " +
+			"Name agents to require them to be available as well.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d := &doctor{opts: opts, timeout: maxCheckTimeout}
+			if opts.timeout > 0 {
+				d.timeout = min(opts.timeout, maxCheckTimeout)
+			}
+			d.run(cmd.Context(), args)
+			err := opts.render(cmd.OutOrStdout(), d.checks, d.print)
+			if err != nil {
+				return err
+			}
+			if n := d.failures(); n > 0 {
+				return fmt.Errorf("%d of %d checks failed", n, len(d.checks))
+			}
+			return nil
+		},
+	}
+}
+
+// doctor runs the checks in order, skipping those that depend on one that
+// failed.
+type doctor struct {
+	opts    *globalOptions
+	timeout time.Duration
+	checks  []check
+	// blocked says why the remaining checks are skipped, once one fails.
+	blocked string
+
+	client *mpcclient.Client
+	server *url.URL
+	proxy  *url.URL
+	// res is the last response the client received, for its TLS state
+	// and Date header.
+	res *http.Response
+}
+
+func (d *doctor) add(name, status, detail, hint string) {
+	d.checks = append(d.checks, check{Name: name, Status: status, Detail: detail, Hint: hint})
+	if status == checkFail && d.blocked == "" {
+		d.blocked = "skipped: " + name + " failed"
+	}
+}
+
+func (d *doctor) failures() int {
+	n := 0
+	for _, c := range d.checks {
+		if c.Status == checkFail {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *doctor) run(ctx context.Context, agents []string) {
+	checks := []struct {
+		name string
+		fn   func(context.Context) (status, detail, hint string)
+	}{
+		{"config", d.checkConfig},
+		{"proxy", d.checkProxy},
+		{"dns", d.checkDNS},
+		{"tcp", d.checkTCP},
+		{"health", d.checkHealth},
+		{"tls", d.checkTLS},
+		{"clock", d.checkClock},
+		{"auth", d.checkAuth},
+		{"agents", func(ctx context.Context) (string, string, string) { return d.checkAgents(ctx, agents) }},
+	}
+	for _, c := range checks {
+		if d.blocked != "" {
+			d.add(c.name, checkSkip, d.blocked, "")
+			continue
+		}
+		cctx, cancel := context.WithTimeout(ctx, d.timeout)
+		status, detail, hint := c.fn(cctx)
+		cancel()
+		d.add(c.name, status, detail, hint)
+	}
+}
+
+func (d *doctor) checkConfig(context.Context) (string, string, string) {
+	u, err := url.Parse(d.opts.server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return checkFail, fmt.Sprintf("server %q is not an http or https URL", d.opts.server),
+			"set --server or $MPC_SERVER to the server's base URL, such as " + mpcclient.DefaultBaseURL
+	}
+	d.server = u
+	capture := func(next mpcclient.Handler) mpcclient.Handler {
+		return mpcclient.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.Do(req)
+			if err == nil {
+				d.res = res
+			}
+			return res, err
+		})
+	}
+	d.client, err = d.opts.client(mpcclient.WithRetryPolicy(mpcclient.RetryPolicy{MaxAttempts: 1}), mpcclient.WithInterceptor(capture))
+	if err != nil {
+		return checkFail, err.Error(),
+			"check that --ca-file, --client-cert and --client-key name readable PEM files, and that --proxy is an http, https or socks5 URL"
+	}
+	detail := "server " + u.Redacted()
+	if d.opts.tenant != "" {
+		detail += ", tenant " + d.opts.tenant
+	}
+	if d.opts.apiKey != "" {
+		detail += ", API key set"
+	} else {
+		detail += ", no API key"
+	}
+
+	// Programs built on the config package read $MPC_CONFIG; mpcctl does
+	// not, but a broken file is a common cause of their failures.
+	if path := os.Getenv(config.EnvConfigFile); path != "" {
+		cfg, err := config.Load(nil)
+		if err != nil {
+			return checkFail, err.Error(), "fix the file named by $" + config.EnvConfigFile + ", or unset it"
+		}
+		detail += ", $" + config.EnvConfigFile + " valid"
+		if cfg.Server != d.opts.server {
+			return checkWarn, detail + fmt.Sprintf(", but it names server %s", cfg.Server),
+				"programs reading $" + config.EnvConfigFile + " call a different server than mpcctl; set the same URL in both"
+		}
+	}
+	return checkOK, detail, ""
+}
+
+func (d *doctor) checkProxy(context.Context) (string, string, string) {
+	if d.opts.proxy != "" {
+		d.proxy, _ = url.Parse(d.opts.proxy)
+		if isLoopback(d.server.Hostname()) {
+			return checkWarn, "via " + d.proxy.Redacted() + ", from --proxy, to a local server",
+				"proxies cannot usually reach a server on your own machine; drop --proxy and $MPC_PROXY for it"
+		}
+		return checkOK, "via " + d.proxy.Redacted() + ", from --proxy", ""
+	}
+	p, err := http.ProxyFromEnvironment(&http.Request{URL: d.server})
+	if err != nil {
+		return checkFail, "invalid proxy in the environment: " + err.Error(), "fix $HTTPS_PROXY or $HTTP_PROXY, or unset it"
+	}
+	if p == nil {
+		return checkOK, "direct connection", ""
+	}
+	d.proxy = p
+	return checkOK, "via " + p.Redacted() + ", from $HTTPS_PROXY or $HTTP_PROXY", ""
+}
+
+// target returns the host and port connections are made to: the proxy's,
+// when there is one, or the server's.
+func (d *doctor) target() (host, port string) {
+	u := d.server
+	if d.proxy != nil {
+		u = d.proxy
+	}
+	port = u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "socks5":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return u.Hostname(), port
+}
+
+func (d *doctor) checkDNS(ctx context.Context) (string, string, string) {
+	host, _ := d.target()
+	if net.ParseIP(host) != nil {
+		return checkOK, host + " is an IP address", ""
+	}
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return checkFail, err.Error(),
+			"check the host name for typos; on a VPN or corporate network, check that its DNS servers are in use"
+	}
+	return checkOK, fmt.Sprintf("%s resolves to %s in %s", host, strings.Join(addrs, ", "), since(start)), ""
+}
+
+func (d *doctor) checkTCP(ctx context.Context) (string, string, string) {
+	host, port := d.target()
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return checkFail, err.Error(), "nothing listens on port " + port + " of " + host +
+				": start the server, such as with go run ./cmd/mpcserver, or check the port in --server"
+		case d.proxy == nil:
+			return checkFail, err.Error(), "a firewall may be dropping the connection; behind a corporate proxy, set --proxy or $HTTPS_PROXY"
+		default:
+			return checkFail, err.Error(), "check that the proxy is running and the proxy URL is right"
+		}
+	}
+	defer conn.Close()
+	return checkOK, fmt.Sprintf("connected to %s in %s", conn.RemoteAddr(), since(start)), ""
+}
+
+func (d *doctor) checkHealth(ctx context.Context) (string, string, string) {
+	h, err := d.client.Health(ctx)
+	var certErr *tls.CertificateVerificationError
+	var headerErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &certErr):
+		return checkFail, "the server's certificate is not trusted: " + certErr.Err.Error(),
+			"if the server uses a corporate or self-signed CA, pass its certificate with --ca-file or $MPC_CA_FILE; " +
+				"--insecure-skip-verify is for test servers only"
+	case errors.As(err, &headerErr):
+		return checkFail, "the server does not speak TLS", "use an http:// URL in --server"
+	case isStatus(err, http.StatusNotFound):
+		return checkFail, err.Error(), "no MPC server answers at this URL; check the host, port and any path in --server"
+	case err != nil:
+		return checkFail, err.Error(), "check the server's logs, or try again with --log-level debug"
+	case !h.Healthy():
+		return checkWarn, "server reports status " + h.Status, "check the server's logs"
+	}
+	detail := "server reports status " + h.Status
+	if h.Version != "" {
+		detail += ", version " + h.Version
+	}
+	return checkOK, detail, ""
+}
+
+func (d *doctor) checkTLS(context.Context) (string, string, string) {
+	if d.server.Scheme == "http" {
+		if isLoopback(d.server.Hostname()) {
+			return checkSkip, "plain HTTP to a local server", ""
+		}
+		return checkWarn, "plain HTTP: prompts and API keys cross the network unencrypted",
+			"use an https:// URL if the server offers one"
+	}
+	if d.res == nil || d.res.TLS == nil || len(d.res.TLS.PeerCertificates) == 0 {
+		return checkSkip, "no TLS connection state", ""
+	}
+	st := d.res.TLS
+	cert := st.PeerCertificates[0]
+	detail := fmt.Sprintf("%s, certificate for %s issued by %s, valid until %s",
+		tls.VersionName(st.Version), certName(cert), cert.Issuer.CommonName, cert.NotAfter.Format(time.DateOnly))
+	if d.opts.tls.InsecureSkipVerify {
+		return checkWarn, detail + ", not verified", "drop --insecure-skip-verify and pass the server's CA with --ca-file"
+	}
+	if left := time.Until(cert.NotAfter); left < certExpiryWarning {
+		return checkWarn, detail, fmt.Sprintf("the certificate expires in %s; ask the server's operators to renew it", left.Round(time.Hour))
+	}
+	return checkOK, detail, ""
+}
+
+func (d *doctor) checkClock(context.Context) (string, string, string) {
+	if d.res == nil {
+		return checkSkip, "no response to compare with", ""
+	}
+	serverTime, err := http.ParseTime(d.res.Header.Get("Date"))
+	if err != nil {
+		return checkSkip, "the server sends no Date header", ""
+	}
+	skew := time.Since(serverTime).Round(time.Second)
+	direction := "ahead of"
+	if skew < 0 {
+		skew, direction = -skew, "behind"
+	}
+	// Date has a resolution of a second, and the request took a while.
+	if skew <= 2*time.Second {
+		return checkOK, "in step with the server", ""
+	}
+	detail := fmt.Sprintf("local clock is %s %s the server's", skew, direction)
+	if skew > maxClockSkew {
+		return checkWarn, detail, "turn on automatic time synchronization, such as with timedatectl set-ntp true; " +
+			"signed requests and tokens fail when clocks are minutes apart"
+	}
+	return checkOK, detail, ""
+}
+
+func (d *doctor) checkAuth(ctx context.Context) (string, string, string) {
+	it := d.client.Agents(mpcclient.WithPageSize(1))
+	it.Next(ctx)
+	err := it.Err()
+	switch {
+	case errors.Is(err, mpcclient.ErrUnauthorized) && d.opts.apiKey == "":
+		return checkFail, "the server requires an API key", "set --api-key or $MPC_API_KEY to the key you were given"
+	case errors.Is(err, mpcclient.ErrUnauthorized):
+		return checkFail, "the server refused the API key: " + err.Error(),
+			"check the key for typos or stray spaces, or ask for a new one; with --tenant, check that the key belongs to that tenant"
+	case isStatus(err, http.StatusNotFound) && d.opts.tenant != "":
+		return checkFail, err.Error(), "the server has no tenant " + d.opts.tenant + "; check --tenant and $MPC_TENANT"
+	case err != nil:
+		return checkFail, err.Error(), "check the server's logs"
+	case d.opts.apiKey == "":
+		return checkOK, "the server accepts calls without an API key", ""
+	}
+	return checkOK, "API key accepted", ""
+}
+
+func (d *doctor) checkAgents(ctx context.Context, required []string) (string, string, string) {
+	st, err := d.client.Ready(ctx)
+	if err != nil {
+		return checkFail, err.Error(), "check the server's logs"
+	}
+	var available, unavailable []string
+	for name, a := range st.Agents {
+		if a.Status == "available" {
+			available = append(available, name)
+		} else {
+			unavailable = append(unavailable, fmt.Sprintf("%s (%s)", name, a.Error))
+		}
+	}
+	slices.Sort(unavailable)
+	for _, name := range required {
+		a, ok := st.Agents[name]
+		switch {
+		case !ok:
+			return checkFail, "agent " + name + " is not registered", `run "mpcctl agents list" for the agents' names`
+		case a.Status != "available":
+			return checkFail, fmt.Sprintf("agent %s is unavailable: %s", name, a.Error), "check the agent's backend and credentials on the server"
+		}
+	}
+	detail := fmt.Sprintf("%d of %d agents available", len(available), len(st.Agents))
+	switch {
+	case len(st.Agents) == 0 && st.Ready():
+		return checkOK, "the server does not report its agents", ""
+	case len(st.Agents) == 0:
+		return checkWarn, "no agents registered", "register agents on the server, such as with its -agents-config"
+	case len(unavailable) > 0:
+		return checkWarn, detail + "; unavailable: " + strings.Join(unavailable, ", "), "check those agents' backends and credentials on the server"
+	}
+	return checkOK, detail, ""
+}
+
+// print writes the checks as a table, with hints under those that did
+// not pass.
+func (d *doctor) print(w io.Writer) error {
+	for _, c := range d.checks {
+		status := c.Status
+		if status == checkWarn || status == checkFail {
+			status = strings.ToUpper(status)
+		}
+		fmt.Fprintf(w, "%-4s  %-6s  %s\n", status, c.Name, c.Detail)
+		if c.Hint != "" {
+			fmt.Fprintf(w, "%14s%s\n", "hint: ", c.Hint)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d checks, %d failed\n", len(d.checks), d.failures())
+	return err
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *mpcclient.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// certName names the host a certificate is for.
+func certName(cert *x509.Certificate) string {
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+func since(start time.Time) time.Duration {
+	return time.Since(start).Round(time.Millisecond)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newHealthCmd(opts *globalOptions) *cobra.Command {
+	var wait time.Duration
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Check that the server is up",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			if wait > 0 {
+				if err := c.WaitUntilReady(cmd.Context(), wait); err != nil {
+					return err
+				}
+			}
+			h, err := c.Health(cmd.Context())
+			if err != nil {
+				return err
+			}
+			err = opts.render(cmd.OutOrStdout(), h, func(w io.Writer) error {
+				fmt.Fprintf(w, "%s: %s", c.BaseURL(), h.Status)
+				if h.Version != "" {
+					fmt.Fprintf(w, " (version %s)", h.Version)
+				}
+				_, err := fmt.Fprintln(w)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if !h.Healthy() {
+				return fmt.Errorf("server reports status %q", h.Status)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&wait, "wait", 0, "first wait up to this long for the server to report ready")
+	return cmd
+}
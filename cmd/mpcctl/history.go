@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/history"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// recordingClient is client for commands whose calls are recorded in the
+// history file, if one is configured. The returned function closes the file.
+func (o *globalOptions) recordingClient(cmd *cobra.Command) (*mpcclient.Client, func(), error) {
+	if o.historyPath == "" {
+		c, err := o.client()
+		return c, func() {}, err
+	}
+	store, err := history.Open(o.historyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := o.client(mpcclient.WithCallHook(store.Hook(func(err error) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: %v\n", err)
+	})))
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return c, func() { store.Close() }, nil
+}
+
+// openHistory opens the history file for the history commands.
+func (o *globalOptions) openHistory() (*history.Store, error) {
+	if o.historyPath == "" {
+		return nil, errors.New("no history file: set --history or $MPC_HISTORY")
+	}
+	if _, err := os.Stat(o.historyPath); err != nil {
+		return nil, fmt.Errorf("history file: %w", err)
+	}
+	return history.Open(o.historyPath)
+}
+
+func newHistoryCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Review the prompts recorded in the history file",
+		Long: "Review the prompts and responses of ask and chat, recorded when --history or $MPC_HISTORY names " +
+			"a SQLite file.",
+	}
+	cmd.AddCommand(newHistoryListCmd(opts), newHistorySearchCmd(opts), newHistoryShowCmd(opts), newHistoryExportCmd(opts))
+	return cmd
+}
+
+// historyFilter holds the flags narrowing the entries a history command
+// reads.
+type historyFilter struct {
+	agent string
+	since time.Duration
+	limit int
+}
+
+func (f *historyFilter) register(cmd *cobra.Command, limit int) {
+	cmd.Flags().StringVar(&f.agent, "agent", "", "only entries for this agent")
+	cmd.Flags().DurationVar(&f.since, "since", 0, "only entries from this long ago onwards, such as 2h")
+	cmd.Flags().IntVar(&f.limit, "limit", limit, "at most this many entries, the most recent; 0 for all")
+}
+
+func (f *historyFilter) query(text string) history.Query {
+	q := history.Query{Agent: f.agent, Text: text, Limit: f.limit}
+	if f.since > 0 {
+		q.Since = time.Now().Add(-f.since)
+	}
+	return q
+}
+
+// listHistory runs q and renders the entries as a table.
+func listHistory(cmd *cobra.Command, opts *globalOptions, q history.Query) error {
+	store, err := opts.openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	entries, err := store.List(cmd.Context(), q)
+	if err != nil {
+		return err
+	}
+	return opts.render(cmd.OutOrStdout(), entries, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tAGENT\tLATENCY\tTOKENS\tPROMPT")
+		for _, e := range entries {
+			prompt := summary(e.Prompt, 60)
+			if e.Error != "" {
+				prompt = "[failed] " + prompt
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\n", e.ID, e.Time.Format(time.DateTime), e.Agent,
+				e.Latency.Round(time.Millisecond), e.Usage.TotalTokens, prompt)
+		}
+		return tw.Flush()
+	})
+}
+
+// summary returns s on one line, cut to at most n characters.
+func summary(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func newHistoryListCmd(opts *globalOptions) *cobra.Command {
+	var f historyFilter
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recorded prompts, the most recent first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listHistory(cmd, opts, f.query(""))
+		},
+	}
+	f.register(cmd, 20)
+	return cmd
+}
+
+func newHistorySearchCmd(opts *globalOptions) *cobra.Command {
+	var f historyFilter
+	cmd := &cobra.Command{
+		Use:   "search <text>",
+		Short: "List recorded prompts whose prompt or response contains text",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listHistory(cmd, opts, f.query(strings.Join(args, " ")))
+		},
+	}
+	f.register(cmd, 20)
+	return cmd
+}
+
+func newHistoryShowCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a recorded prompt and its full response",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid entry ID %q", args[0])
+			}
+			store, err := opts.openHistory()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			e, err := store.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			return opts.render(cmd.OutOrStdout(), e, func(w io.Writer) error {
+				fmt.Fprintf(w, "Agent:    %s\n", e.Agent)
+				fmt.Fprintf(w, "Time:     %s\n", e.Time.Format(time.RFC1123))
+				fmt.Fprintf(w, "Latency:  %s\n", e.Latency.Round(time.Millisecond))
+				if e.Usage.TotalTokens > 0 {
+					fmt.Fprintf(w, "Tokens:   %d prompt, %d completion\n", e.Usage.PromptTokens, e.Usage.CompletionTokens)
+				}
+				if e.RequestID != "" {
+					fmt.Fprintf(w, "Request:  %s\n", e.RequestID)
+				}
+				fmt.Fprintf(w, "\n%s\n\n", e.Prompt)
+				if e.Error != "" {
+					_, err := fmt.Fprintf(w, "error: %s\n", e.Error)
+					return err
+				}
+				_, err := fmt.Fprintln(w, e.Response)
+				return err
+			})
+		},
+	}
+}
+
+func newHistoryExportCmd(opts *globalOptions) *cobra.Command {
+	var (
+		f      historyFilter
+		format string
+		file   string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export recorded prompts as JSON Lines, CSV or Markdown",
+		Long:  "Export recorded prompts and responses, oldest first, to share or analyse them.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !slices.Contains([]string{history.FormatJSONL, history.FormatCSV, history.FormatMarkdown}, format) {
+				return fmt.Errorf("--format must be jsonl, csv or markdown, not %q", format)
+			}
+			store, err := opts.openHistory()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			entries, err := store.List(cmd.Context(), f.query(""))
+			if err != nil {
+				return err
+			}
+			slices.Reverse(entries)
+
+			if file == "" {
+				return history.Export(cmd.OutOrStdout(), format, entries)
+			}
+			fh, err := os.Create(file)
+			if err != nil {
+				return err
+			}
+			if err := history.Export(fh, format, entries); err != nil {
+				fh.Close()
+				return err
+			}
+			return fh.Close()
+		},
+	}
+	f.register(cmd, 0)
+	cmd.Flags().StringVar(&format, "format", history.FormatJSONL, "export format: jsonl, csv or markdown")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "write to this file instead of standard output")
+	return cmd
+}
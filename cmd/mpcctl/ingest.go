@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/vectorstore"
+)
+
+type ingestOptions struct {
+	store       string
+	agent       string
+	dir         string
+	chunkSize   int
+	overlap     int
+	batchSize   int
+	concurrency int
+	rateLimit   float64
+}
+
+// ingestReport summarizes an ingest run.
+type ingestReport struct {
+	Store  string `json:"store"`
+	Files  int    `json:"files"`
+	Chunks int    `json:"chunks"`
+}
+
+func newIngestCmd(opts *globalOptions) *cobra.Command {
+	ig := ingestOptions{}
+	cmd := &cobra.Command{
+		Use:   "ingest --store <file> --agent <agent> <pattern>...",
+		Short: "Chunk and embed documents into a vector store file",
+		Long: "Read the text, Markdown and PDF-extracted text files matching the glob patterns, such as 'runbooks/*.md', split " +
+			"them into overlapping chunks, embed the chunks with an embedding agent and save them to a vector store file. " +
+			"Chunks of files ingested before are replaced. Patterns are relative to --dir, whose paths become the sources of " +
+			"the chunks. Nothing is saved unless every chunk was embedded. Progress is shown on stderr unless --no-progress is set.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if ig.store == "" || ig.agent == "" {
+				return errors.New("--store and --agent are required")
+			}
+			if ig.batchSize < 0 || ig.concurrency < 0 || ig.rateLimit < 0 {
+				return errors.New("--batch-size, --concurrency and --rate-limit must not be negative")
+			}
+			sources, err := vectorstore.Load(os.DirFS(ig.dir), args...)
+			if err != nil {
+				return err
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			store, err := vectorstore.Open(ig.store, vectorstore.AgentEmbedder(c, ig.agent))
+			if err != nil {
+				return err
+			}
+
+			p := opts.startProgress(cmd, "ingest", 0, 0)
+			in := &vectorstore.Ingester{
+				Store:       store,
+				Splitter:    vectorstore.Splitter{Size: ig.chunkSize, Overlap: ig.overlap},
+				BatchSize:   ig.batchSize,
+				Concurrency: ig.concurrency,
+				RateLimit:   ig.rateLimit,
+				OnProgress: func(ip vectorstore.IngestProgress) {
+					p.setTotal(ip.Total)
+					p.add(ip.Batch, ip.Err != nil)
+				},
+			}
+			n, err := in.Ingest(cmd.Context(), sources...)
+			p.stop()
+			if err != nil {
+				return err
+			}
+			if err := store.Save(); err != nil {
+				return err
+			}
+			rep := ingestReport{Store: ig.store, Files: len(sources), Chunks: n}
+			return opts.render(cmd.OutOrStdout(), rep, func(w io.Writer) error {
+				_, err := fmt.Fprintf(w, "Ingested %d chunks from %d files into %s\n", rep.Chunks, rep.Files, rep.Store)
+				return err
+			})
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&ig.store, "store", "", "vector store `file` to add the chunks to, created if missing")
+	f.StringVar(&ig.agent, "agent", "", "embedding agent to embed the chunks with")
+	f.StringVar(&ig.dir, "dir", ".", "directory the patterns are relative to")
+	f.IntVar(&ig.chunkSize, "chunk-size", vectorstore.DefaultChunkSize, "maximum chunk length in characters")
+	f.IntVar(&ig.overlap, "overlap", vectorstore.DefaultChunkOverlap, "characters each chunk repeats from the one before")
+	f.IntVar(&ig.batchSize, "batch-size", vectorstore.DefaultIngestBatchSize, "chunks embedded per call")
+	f.IntVar(&ig.concurrency, "concurrency", vectorstore.DefaultIngestConcurrency, "maximum embedding calls in flight")
+	f.Float64Var(&ig.rateLimit, "rate-limit", 0, "maximum embedding calls per second; 0 means unlimited")
+	return cmd
+}
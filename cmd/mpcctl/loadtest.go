@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// histogramBounds are the upper bounds, in milliseconds, of the latency
+// histogram buckets; a final bucket catches everything slower.
+var histogramBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type loadtestOptions struct {
+	agent       string
+	rps         float64
+	duration    time.Duration
+	concurrency int
+	prompt      string
+	promptFile  string
+}
+
+func newLoadtestCmd(opts *globalOptions) *cobra.Command {
+	lo := loadtestOptions{}
+	cmd := &cobra.Command{
+		Use:   "loadtest --agent <agent>",
+		Short: "Drive load at an agent and report latencies",
+		Long: "Send calls to an agent at a fixed rate for a while and report latency percentiles, a latency histogram and error rates.\n\n" +
+			"Calls start on schedule whether or not earlier ones have finished, up to --concurrency in flight; ticks that find " +
+			"every slot busy are counted as skipped. Prompts from --prompt-file, one per line, are used in turn. Interrupting " +
+			"the run reports what was collected so far. Progress is shown on stderr unless --no-progress is set.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lo.agent == "" {
+				return errors.New("--agent is required")
+			}
+			if lo.rps <= 0 || lo.duration <= 0 || lo.concurrency <= 0 {
+				return errors.New("--rps, --duration and --concurrency must be positive")
+			}
+			prompts := []string{lo.prompt}
+			if lo.promptFile != "" {
+				var err error
+				if prompts, err = readPrompts(lo.promptFile); err != nil {
+					return err
+				}
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+
+			p := opts.startProgress(cmd, "loadtest", 0, lo.duration)
+			rep := runLoad(cmd.Context(), c, lo, prompts, p)
+			p.stop()
+			return opts.render(cmd.OutOrStdout(), rep, rep.writeText)
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&lo.agent, "agent", "", "agent to call")
+	f.Float64Var(&lo.rps, "rps", 10, "calls started per second")
+	f.DurationVar(&lo.duration, "duration", 30*time.Second, "how long to generate load")
+	f.IntVar(&lo.concurrency, "concurrency", 100, "maximum calls in flight")
+	f.StringVar(&lo.prompt, "prompt", "ping", "prompt sent with every call when no --prompt-file is given")
+	f.StringVar(&lo.promptFile, "prompt-file", "", "file of prompts, one per line; blank lines and lines starting with # are skipped")
+	return cmd
+}
+
+// readPrompts returns the prompts listed in path.
+func readPrompts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prompts: %w", err)
+	}
+	defer f.Close()
+	var prompts []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			prompts = append(prompts, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read prompts: %w", err)
+	}
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("read prompts: %s has no prompts", path)
+	}
+	return prompts, nil
+}
+
+// callResult is the outcome of one load test call.
+type callResult struct {
+	latency time.Duration
+	// kind classifies a failure; it is empty for successful calls.
+	kind string
+}
+
+// runLoad starts calls at lo.rps until lo.duration passes or ctx is done,
+// waits for those in flight and summarizes them, recording each call to p.
+// Calls in flight when the duration passes are allowed to finish;
+// cancelling ctx aborts them.
+func runLoad(ctx context.Context, c *mpcclient.Client, lo loadtestOptions, prompts []string, p *progress) *loadReport {
+	runCtx, cancel := context.WithTimeout(ctx, lo.duration)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		results []callResult
+		wg      sync.WaitGroup
+		skipped int
+	)
+	slots := make(chan struct{}, lo.concurrency)
+	interval := time.Duration(float64(time.Second) / lo.rps)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for i := 0; ; i++ {
+		select {
+		case slots <- struct{}{}:
+			prompt := prompts[i%len(prompts)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				callStart := time.Now()
+				_, err := c.CallAgent(ctx, lo.agent, prompt)
+				r := callResult{latency: time.Since(callStart), kind: errorKind(err)}
+				p.record(err != nil)
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}()
+		default:
+			skipped++
+		}
+		select {
+		case <-runCtx.Done():
+			elapsed := time.Since(start)
+			wg.Wait()
+			return summarize(lo, results, skipped, elapsed)
+		case <-ticker.C:
+		}
+	}
+}
+
+// errorKind classifies err for the report's error breakdown.
+func errorKind(err error) string {
+	var apiErr *mpcclient.APIError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &apiErr):
+		return "http_" + strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, mpcclient.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, mpcclient.ErrCircuitOpen):
+		return "circuit_open"
+	default:
+		return "transport"
+	}
+}
+
+// loadReport is the outcome of a load test, as printed with --output json.
+type loadReport struct {
+	Agent       string         `json:"agent"`
+	DurationMS  float64        `json:"duration_ms"`
+	TargetRPS   float64        `json:"target_rps"`
+	AchievedRPS float64        `json:"achieved_rps"`
+	Requests    int            `json:"requests"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	Skipped     int            `json:"skipped"`
+	ErrorRate   float64        `json:"error_rate"`
+	Errors      map[string]int `json:"errors,omitempty"`
+	Latency     latencyStats   `json:"latency_ms"`
+	Histogram   []bucket       `json:"histogram"`
+}
+
+// latencyStats summarizes call latencies in milliseconds.
+type latencyStats struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// bucket counts the calls slower than the previous bucket's bound and no
+// slower than LessOrEqualMS. The last bucket has no bound.
+type bucket struct {
+	LessOrEqualMS float64 `json:"le_ms,omitempty"`
+	Count         int     `json:"count"`
+}
+
+func summarize(lo loadtestOptions, results []callResult, skipped int, elapsed time.Duration) *loadReport {
+	rep := &loadReport{
+		Agent:      lo.agent,
+		DurationMS: ms(elapsed),
+		TargetRPS:  lo.rps,
+		Requests:   len(results),
+		Skipped:    skipped,
+		Histogram:  make([]bucket, len(histogramBounds)+1),
+	}
+	for i, b := range histogramBounds {
+		rep.Histogram[i].LessOrEqualMS = b
+	}
+	if elapsed > 0 {
+		rep.AchievedRPS = float64(len(results)) / elapsed.Seconds()
+	}
+
+	latencies := make([]float64, 0, len(results))
+	var sum float64
+	for _, r := range results {
+		l := ms(r.latency)
+		latencies = append(latencies, l)
+		sum += l
+		i, _ := slices.BinarySearch(histogramBounds, l)
+		rep.Histogram[i].Count++
+		if r.kind == "" {
+			rep.Succeeded++
+			continue
+		}
+		rep.Failed++
+		if rep.Errors == nil {
+			rep.Errors = make(map[string]int)
+		}
+		rep.Errors[r.kind]++
+	}
+	if len(latencies) == 0 {
+		return rep
+	}
+	slices.Sort(latencies)
+	rep.ErrorRate = float64(rep.Failed) / float64(len(results))
+	rep.Latency = latencyStats{
+		Min:  latencies[0],
+		Mean: sum / float64(len(latencies)),
+		P50:  percentile(latencies, 50),
+		P90:  percentile(latencies, 90),
+		P95:  percentile(latencies, 95),
+		P99:  percentile(latencies, 99),
+		Max:  latencies[len(latencies)-1],
+	}
+	return rep
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank
+// method.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r *loadReport) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "Agent:      %s\n", r.Agent)
+	fmt.Fprintf(w, "Duration:   %s\n", time.Duration(r.DurationMS*float64(time.Millisecond)).Round(time.Millisecond))
+	fmt.Fprintf(w, "Rate:       %.1f/s achieved, %.1f/s target\n", r.AchievedRPS, r.TargetRPS)
+	fmt.Fprintf(w, "Requests:   %d (%d succeeded, %d failed, %d skipped)\n", r.Requests, r.Succeeded, r.Failed, r.Skipped)
+	fmt.Fprintf(w, "Error rate: %.2f%%\n", 100*r.ErrorRate)
+	if len(r.Errors) > 0 {
+		kinds := make([]string, 0, len(r.Errors))
+		for k := range r.Errors {
+			kinds = append(kinds, k)
+		}
+		slices.Sort(kinds)
+		for _, k := range kinds {
+			fmt.Fprintf(w, "  %-12s %d\n", k, r.Errors[k])
+		}
+	}
+	if r.Requests == 0 {
+		return nil
+	}
+	l := r.Latency
+	fmt.Fprintf(w, "Latency:    min %.1fms  mean %.1fms  p50 %.1fms  p90 %.1fms  p95 %.1fms  p99 %.1fms  max %.1fms\n",
+		l.Min, l.Mean, l.P50, l.P90, l.P95, l.P99, l.Max)
+
+	fmt.Fprintln(w, "Histogram:")
+	const width = 40
+	peak := 0
+	for _, b := range r.Histogram {
+		peak = max(peak, b.Count)
+	}
+	for i, b := range r.Histogram {
+		label := fmt.Sprintf("<= %gms", b.LessOrEqualMS)
+		if i == len(r.Histogram)-1 {
+			label = fmt.Sprintf(" > %gms", r.Histogram[i-1].LessOrEqualMS)
+		}
+		bar := 0
+		if peak > 0 {
+			bar = (b.Count*width + peak - 1) / peak
+		}
+		fmt.Fprintf(w, "  %10s %6d %s\n", label, b.Count, strings.Repeat("#", bar))
+	}
+	return nil
+}
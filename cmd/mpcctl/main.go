@@ -0,0 +1,39 @@
+// Command mpcctl talks to an MPC server from the terminal.
+//
+//	mpcctl ask azureVmMetricsAgent "Check CPU for VM 'webserver01'"
+//	mpcctl chat --stream azureVmMetricsAgent
+//	mpcctl agents list
+//	mpcctl agents describe azureVmMetricsAgent
+//	mpcctl agents scaffold weatherAgent --description "Forecasts the weather for a city."
+//	mpcctl health --wait 30s
+//	mpcctl loadtest --agent azureVmMetricsAgent --rps 50 --duration 2m --prompt-file prompts.txt
+//	mpcctl batch --agent azureVmMetricsAgent --input prompts.jsonl --output results.jsonl --concurrency 8
+//	mpcctl history search --since 24h cpu
+//	mpcctl history export --format markdown -f session.md
+//	mpcctl promptest prompts/vm-metrics.yaml
+//	mpcctl run vm-triage.yaml webserver01 --var env=prod --report run.json
+//
+// The server address, output format, timeout, API key, history file and
+// log level can be set with flags or with the MPC_SERVER, MPC_OUTPUT,
+// MPC_TIMEOUT, MPC_API_KEY, MPC_HISTORY and MPC_LOG_LEVEL environment
+// variables; flags take precedence. Behind a corporate proxy or CA, set
+// --proxy and --ca-file, or MPC_PROXY and MPC_CA_FILE; --client-cert and
+// --client-key present a certificate to servers requiring mutual TLS. With a history file set, ask and chat
+// record every prompt and response to it. --metadata, or MPC_METADATA,
+// labels every call with key=value pairs such as team=blue for the
+// server's audit records.
+//
+// agents scaffold works offline: it generates a Go package for a new
+// agent, with a test, an example prompt and the snippet linking it into
+// mpcserver.
+package main
+
+import (
+	"os"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
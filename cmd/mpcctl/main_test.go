@@ -0,0 +1,778 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver/agents/demo"
+	"github.com/olafkfreund/ai_team_workshop/prompttmpl"
+	"github.com/olafkfreund/ai_team_workshop/vectorstore"
+)
+
+// run executes mpcctl against a demo server and returns its output.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	return runInput(t, "", args...)
+}
+
+// runInput is run with input as mpcctl's standard input.
+func runInput(t *testing.T, input string, args ...string) (string, error) {
+	t.Helper()
+	s := mpcserver.New()
+	if err := demo.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	return runServer(t, s, input, args...)
+}
+
+// runServer is runInput against s instead of a demo server.
+func runServer(t *testing.T, s *mpcserver.Server, input string, args ...string) (string, error) {
+	t.Helper()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	var out bytes.Buffer
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetIn(strings.NewReader(input))
+	cmd.SetArgs(append([]string{"--server", ts.URL}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestAsk(t *testing.T) {
+	out, err := run(t, "ask", "azureVmMetricsAgent", "Check", "CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "VM Metrics Analysis") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestAskJSON(t *testing.T) {
+	out, err := run(t, "--output", "json", "ask", "onboardingAgent", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct{ Agent, Status string }
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if resp.Agent != "onboardingAgent" || resp.Status != "success" {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestAskCompressed(t *testing.T) {
+	prompt := "Check CPU for these logs:\n" + strings.Repeat("08:00 INFO vm=webserver01 cpu=97%\n", 100)
+	out, err := run(t, "--compression", "zstd", "ask", "azureVmMetricsAgent", prompt)
+	if err != nil || !strings.Contains(out, "VM Metrics Analysis") {
+		t.Errorf("compressed ask: %v\n%s", err, out)
+	}
+	if _, err := run(t, "--compression", "br", "ask", "azureVmMetricsAgent", "hi"); err == nil {
+		t.Error("--compression br accepted")
+	}
+}
+
+func TestAskDryRun(t *testing.T) {
+	out, err := run(t, "--dry-run", "--api-key", "s3cret", "ask", "--model", "small", "azureVmMetricsAgent", "Check CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"POST http://", "/agent/azureVmMetricsAgent\n", "X-Api-Key: [REDACTED]", `"prompt": "Check CPU"`, `"model": "small"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "s3cret") || strings.Contains(out, "VM Metrics Analysis") {
+		t.Errorf("dry run sent the request or leaked the key:\n%s", out)
+	}
+
+	out, err = run(t, "--dry-run", "--output", "json", "ask", "--stream", "onboardingAgent", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		Method, URL string
+		Body        struct{ Prompt string }
+	}
+	if err := json.Unmarshal([]byte(out), &req); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if req.Method != "POST" || req.Body.Prompt != "hi" {
+		t.Errorf("req = %+v", req)
+	}
+}
+
+func TestAskRequirements(t *testing.T) {
+	if out, err := run(t, "ask", "--min-agent-version", "1.0", "--require", "streaming", "onboardingAgent", "hi"); err != nil || !strings.Contains(out, "onboarding checklist") {
+		t.Errorf("met requirements: %v\n%s", err, out)
+	}
+	_, err := run(t, "ask", "--min-agent-version", "2.0.0", "onboardingAgent", "hi")
+	if err == nil || !strings.Contains(err.Error(), "requires 2.0.0 or later") {
+		t.Errorf("newer version required: err = %v", err)
+	}
+	_, err = run(t, "ask", "--require", "tools,attachments", "onboardingAgent", "hi")
+	if err == nil || !strings.Contains(err.Error(), "lacks tools, attachments") {
+		t.Errorf("missing capabilities: err = %v", err)
+	}
+}
+
+func TestAgentsListAndDescribe(t *testing.T) {
+	out, err := run(t, "agents", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"azureVmMetricsAgent", "onboardingAgent", "terraformDocsAgent"} {
+		if !strings.Contains(out, name) {
+			t.Errorf("list output missing %s:\n%s", name, out)
+		}
+	}
+
+	out, err = run(t, "agents", "describe", "terraformDocsAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "project_path") || !strings.Contains(out, "Examples:") || !strings.Contains(out, "Version:      1.0.0") {
+		t.Errorf("describe output = %q", out)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	out, err := run(t, "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "healthy") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestRejectsUnknownOutput(t *testing.T) {
+	if out, err := run(t, "health", "--wait", "5s"); err != nil || !strings.Contains(out, "healthy") {
+		t.Errorf("health --wait = %q, %v", out, err)
+	}
+	if _, err := run(t, "--output", "yaml", "health"); err == nil {
+		t.Fatal("expected error for --output yaml")
+	}
+}
+
+func TestChat(t *testing.T) {
+	transcript := filepath.Join(t.TempDir(), "chat.md")
+	out, err := runInput(t, "Check CPU\n/switch onboardingAgent\nhello \\\nthere\n/history\n/bogus\n/save "+transcript+"\n",
+		"chat", "--system", "be brief", "azureVmMetricsAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"VM Metrics Analysis", "Now talking to onboardingAgent.", "onboardingAgent> ... ",
+		"[user] hello \nthere", "unknown command /bogus", "Transcript saved"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	md, err := os.ReadFile(transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"## System\n\nbe brief", "## You\n\nCheck CPU", "## azureVmMetricsAgent\n", "## onboardingAgent\n"} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("transcript lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestChatExportImport(t *testing.T) {
+	dir := t.TempDir()
+	jsonl, md := filepath.Join(dir, "chat.jsonl"), filepath.Join(dir, "chat.md")
+	out, err := runInput(t, "Hi\n/export "+jsonl+"\n/export "+md+"\n/export chat.txt\n", "chat", "--system", "be brief", "onboardingAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Conversation exported to "+md) || !strings.Contains(out, "conversation files are .jsonl") {
+		t.Errorf("output:\n%s", out)
+	}
+	b, _ := os.ReadFile(jsonl)
+	if !strings.HasPrefix(string(b), `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"Hi"},`) {
+		t.Errorf("JSONL export = %s", b)
+	}
+
+	for _, file := range []string{jsonl, md} {
+		out, err := runInput(t, "/history\n", "chat", "--import", file, "onboardingAgent")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "[system] be brief\n[user] Hi\n[assistant] 🎯 Welcome!") {
+			t.Errorf("%s: history after import:\n%s", file, out)
+		}
+	}
+}
+
+func TestChatRender(t *testing.T) {
+	out, err := runInput(t, "Document it\n", "chat", "--render", "color", "--width", "30", "terraformDocsAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "\x1b[1;4mInfrastructure") || strings.Contains(out, "# Infrastructure") {
+		t.Errorf("heading not rendered:\n%q", out)
+	}
+
+	out, err = runInput(t, "Hi\n", "chat", "--stream", "--render", "plain", "onboardingAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "\n1. Setup Azure CLI\n") || strings.Contains(out, "\x1b[") {
+		t.Errorf("plain rendering:\n%q", out)
+	}
+
+	// Captured output is left as the agent wrote it.
+	out, _ = runInput(t, "Document it\n", "chat", "terraformDocsAgent")
+	if !strings.Contains(out, "# Infrastructure Overview") {
+		t.Errorf("auto rendered captured output:\n%q", out)
+	}
+	if _, err := run(t, "chat", "--render", "fancy", "onboardingAgent"); err == nil || !strings.Contains(err.Error(), "--render must be") {
+		t.Errorf("bad --render: %v", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	out, err := run(t, "stats", "ask", "azureVmMetricsAgent", "Check", "CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "VM Metrics Analysis") || !regexp.MustCompile(`(?m)^azureVmMetricsAgent +1 +0 +\S+`).MatchString(out) {
+		t.Errorf("output:\n%s", out)
+	}
+
+	out, err = run(t, "--output", "json", "stats", "ask", "noSuchAgent", "hi")
+	if err == nil {
+		t.Error("the failure of the command was lost")
+	}
+	dec := json.NewDecoder(strings.NewReader(out[strings.Index(out, "{"):]))
+	var st struct {
+		Agents map[string]struct {
+			Calls      int
+			ErrorKinds map[string]int `json:"error_kinds"`
+		}
+	}
+	if err := dec.Decode(&st); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if a := st.Agents["noSuchAgent"]; a.Calls != 1 || a.ErrorKinds["agent_not_found"] != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	if _, err := run(t, "stats", "nonsense"); err == nil || !strings.Contains(err.Error(), "stats runs an mpcctl command") {
+		t.Errorf("unknown command: %v", err)
+	}
+	if got := formatBytes(1536); got != "1.5 KiB" {
+		t.Errorf("formatBytes = %s", got)
+	}
+}
+
+func TestLoadtest(t *testing.T) {
+	prompts := filepath.Join(t.TempDir(), "prompts.txt")
+	os.WriteFile(prompts, []byte("# capacity run\nCheck CPU\n\nCheck disk\n"), 0o644)
+
+	out, err := run(t, "--output", "json", "loadtest", "--agent", "azureVmMetricsAgent",
+		"--rps", "100", "--duration", "200ms", "--prompt-file", prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep loadReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if rep.Requests < 5 || rep.Failed != 0 || rep.Succeeded != rep.Requests || rep.Latency.Max < rep.Latency.P50 {
+		t.Errorf("report = %+v", rep)
+	}
+
+	out, err = run(t, "loadtest", "--agent", "missing", "--rps", "50", "--duration", "100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Error rate: 100.00%") || !strings.Contains(out, "http_404") || !strings.Contains(out, "Histogram:") {
+		t.Errorf("text report = %s", out)
+	}
+
+	if _, err := run(t, "loadtest"); err == nil {
+		t.Error("expected error without --agent")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	results := filepath.Join(dir, "results.jsonl")
+	input := `{"id":"a","prompt":"Check CPU"}
+{"id":"b","agent":"missing","prompt":"Check disk"}
+{"id":"c","prompt":"Check memory","metadata":{"user":"ana"}}
+`
+	_, err := runInput(t, input, "batch", "--agent", "azureVmMetricsAgent", "--output", results, "--concurrency", "2", "--retries", "0")
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 rows failed") {
+		t.Fatalf("err = %v, want 1 of 3 rows failed", err)
+	}
+	data, err := os.ReadFile(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []batchRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var rec batchRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("result is not JSON: %v\n%s", err, line)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("results = %s", data)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		if rec := records[i]; rec.Row != i+1 || rec.ID != id || rec.Attempts != 1 {
+			t.Errorf("result %d = %+v", i, rec)
+		}
+	}
+	if rec := records[0]; rec.Status != statusOK || rec.Result == "" || rec.Agent != "azureVmMetricsAgent" {
+		t.Errorf("ok row = %+v", rec)
+	}
+	if rec := records[1]; rec.Status != statusError || rec.ErrorKind != "http_404" || rec.Agent != "missing" {
+		t.Errorf("failed row = %+v", rec)
+	}
+
+	csvInput := filepath.Join(dir, "prompts.csv")
+	os.WriteFile(csvInput, []byte("id,prompt,audience\nq1,What should I read first?,developers\n"), 0o644)
+	out, err := run(t, "batch", "--agent", "onboardingAgent", "--input", csvInput, "--output-format", "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil || len(rows) != 2 || !slices.Equal(rows[0], csvColumns) || !slices.Equal(rows[1][:4], []string{"1", "q1", "onboardingAgent", "ok"}) {
+		t.Errorf("CSV results = %s (%v)", out, err)
+	}
+
+	if _, err := runInput(t, `{"prompt":"hi"}`, "batch"); err == nil {
+		t.Error("expected error without --agent")
+	}
+	if _, err := runInput(t, "id,question\nq1,hi\n", "batch", "--agent", "onboardingAgent", "--input-format", "csv"); err == nil {
+		t.Error("expected error for CSV without a prompt column")
+	}
+}
+
+// lengthEmbedder is an embedding agent embedding each input as
+// {len(input), 1}.
+type lengthEmbedder struct{}
+
+func (lengthEmbedder) Handle(context.Context, mpcserver.Request) (mpcserver.Response, error) {
+	return mpcserver.Response{}, errors.New("lengthEmbedder only embeds")
+}
+
+func (lengthEmbedder) Embed(_ context.Context, inputs []string) ([][]float32, error) {
+	vectors := make([][]float32, len(inputs))
+	for i, in := range inputs {
+		vectors[i] = []float32{float32(len(in)), 1}
+	}
+	return vectors, nil
+}
+
+func TestIngest(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	os.Mkdir(docs, 0o755)
+	os.WriteFile(filepath.Join(docs, "disk.md"), []byte("# Disks\n\nExpand the data disk before it reaches 90% full.\n"), 0o644)
+	os.WriteFile(filepath.Join(docs, "cpu.txt"), []byte("Scale out the web tier when CPU stays above 80% for ten minutes."), 0o644)
+	storePath := filepath.Join(dir, "store.json")
+	s := mpcserver.New()
+	if err := s.Register("embedder", lengthEmbedder{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runServer(t, s, "", "--output", "json", "ingest", "--store", storePath, "--agent", "embedder",
+		"--dir", docs, "--chunk-size", "30", "--overlap", "5", "--batch-size", "1", "*.md", "*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep ingestReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	store, err := vectorstore.Open(storePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Files != 2 || rep.Chunks < 3 || store.Len() != rep.Chunks {
+		t.Errorf("report = %+v, store holds %d chunks", rep, store.Len())
+	}
+	if d, ok := store.Get("cpu.txt#0"); !ok || d.Metadata["source"] != "cpu.txt" {
+		t.Errorf("first cpu.txt chunk = %+v", d)
+	}
+
+	missing := filepath.Join(dir, "missing.json")
+	if _, err := runServer(t, s, "", "ingest", "--store", missing, "--agent", "nope", "--dir", docs, "*.md"); err == nil {
+		t.Error("expected error for an unknown agent")
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("failed ingest saved the store: %v", err)
+	}
+	if _, err := runServer(t, s, "", "ingest", "--store", missing, "*.md"); err == nil {
+		t.Error("expected error without --agent")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var out bytes.Buffer
+	p := &progress{w: &out, label: "batch", total: 4, interval: 10 * time.Millisecond}
+	p.run()
+	p.record(false)
+	p.record(true)
+	time.Sleep(50 * time.Millisecond)
+	p.stop()
+	if !strings.Contains(out.String(), "batch: 2/4, ") || !strings.Contains(out.String(), ", 1 error, ETA ") {
+		t.Errorf("log lines = %q", out.String())
+	}
+
+	out.Reset()
+	p = &progress{w: &out, label: "loadtest", duration: time.Minute, tty: true, interval: time.Hour}
+	p.run()
+	p.record(false)
+	p.stop()
+	if got := out.String(); !strings.HasPrefix(got, "\r\x1b[Kloadtest [░") || !strings.Contains(got, "] 1 calls ") || !strings.HasSuffix(got, "\n") {
+		t.Errorf("final bar = %q", got)
+	}
+
+	p = &progress{w: &out, label: "ingest", interval: time.Hour}
+	p.run()
+	if got := p.line(); !strings.HasPrefix(got, "ingest: 0, ") || !strings.HasSuffix(got, "ETA ?") {
+		t.Errorf("line before the total is known = %q", got)
+	}
+	p.setTotal(10)
+	p.add(4, false)
+	if got := p.line(); !strings.HasPrefix(got, "ingest: 4/10, ") {
+		t.Errorf("line once the total is known = %q", got)
+	}
+	p.stop()
+
+	var nop *progress
+	nop.record(true)
+	nop.add(2, true)
+	nop.setTotal(2)
+	nop.stop()
+	if p := (&globalOptions{noProgress: true}).startProgress(newRootCmd(), "batch", 1, 0); p != nil {
+		t.Error("progress started with --no-progress")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var results []callResult
+	for i := 1; i <= 100; i++ {
+		r := callResult{latency: time.Duration(i) * time.Millisecond}
+		if i > 95 {
+			r.kind = "timeout"
+		}
+		results = append(results, r)
+	}
+	rep := summarize(loadtestOptions{agent: "vm", rps: 100}, results, 3, time.Second)
+	if rep.Latency.P50 != 50 || rep.Latency.P99 != 99 || rep.Latency.Min != 1 || rep.Latency.Max != 100 {
+		t.Errorf("latency = %+v", rep.Latency)
+	}
+	if rep.Failed != 5 || rep.Errors["timeout"] != 5 || rep.ErrorRate != 0.05 || rep.Skipped != 3 || rep.AchievedRPS != 100 {
+		t.Errorf("report = %+v", rep)
+	}
+	// Buckets are inclusive of their bound: 1-5ms, 6-10ms, 11-25ms, ...
+	if rep.Histogram[0].Count != 5 || rep.Histogram[1].Count != 5 || rep.Histogram[2].Count != 15 || rep.Histogram[4].Count != 50 {
+		t.Errorf("histogram = %+v", rep.Histogram)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	if _, err := run(t, "history", "list", "--history", db); err == nil {
+		t.Error("history list succeeded without a history file")
+	}
+	for _, args := range [][]string{
+		{"ask", "azureVmMetricsAgent", "Check", "CPU"},
+		{"ask", "onboardingAgent", "hello"},
+		{"ask", "missing", "hello"},
+	} {
+		run(t, append([]string{"--history", db}, args...)...)
+	}
+
+	out, err := run(t, "--history", db, "history", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 4 || !strings.Contains(lines[1], "[failed] hello") {
+		t.Errorf("list output:\n%s", out)
+	}
+
+	out, err = run(t, "--history", db, "history", "search", "--agent", "azureVmMetricsAgent", "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Check CPU") || strings.Contains(out, "onboardingAgent") {
+		t.Errorf("search output:\n%s", out)
+	}
+
+	out, err = run(t, "--history", db, "history", "show", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Agent:    azureVmMetricsAgent") || !strings.Contains(out, "VM Metrics Analysis") {
+		t.Errorf("show output:\n%s", out)
+	}
+
+	export := filepath.Join(t.TempDir(), "history.md")
+	if _, err := run(t, "--history", db, "history", "export", "--format", "markdown", "-f", export); err != nil {
+		t.Fatal(err)
+	}
+	md, err := os.ReadFile(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, j := strings.Index(string(md), "## azureVmMetricsAgent"), strings.Index(string(md), "## onboardingAgent"); i < 0 || j < i {
+		t.Errorf("export is not oldest first:\n%s", md)
+	}
+	if _, err := run(t, "--history", db, "history", "export", "--format", "xml"); err == nil {
+		t.Error("export accepted an unknown format")
+	}
+}
+
+func TestPromptest(t *testing.T) {
+	suite := filepath.Join(t.TempDir(), "onboarding.yaml")
+	os.WriteFile(suite, []byte("name: onboarding\nagent: onboardingAgent\ncases:\n  - {name: hello, prompt: hello}\n"), 0o644)
+
+	out, err := run(t, "promptest", suite)
+	if err != nil {
+		t.Fatalf("first run: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "NEW") || !strings.Contains(out, "PASS onboarding: 1 passed, 0 failed") {
+		t.Errorf("first run output:\n%s", out)
+	}
+	if out, err := run(t, "promptest", suite); err != nil || !strings.Contains(out, "hello  PASS") {
+		t.Errorf("second run: %v\n%s", err, out)
+	}
+
+	baseline := filepath.Join(filepath.Dir(suite), "baselines", "onboarding", "hello.txt")
+	os.WriteFile(baseline, []byte("something else entirely"), 0o644)
+	out, err = run(t, "promptest", suite)
+	if err == nil || !strings.Contains(out, "- something else entirely") {
+		t.Errorf("regressed run: %v\n%s", err, out)
+	}
+}
+
+func TestRunWorkflow(t *testing.T) {
+	dir := t.TempDir()
+	workflow := filepath.Join(dir, "triage.yaml")
+	os.WriteFile(workflow, []byte(`name: triage
+vars: {env: dev}
+steps:
+  - name: metrics
+    agent: azureVmMetricsAgent
+    prompt: "Check CPU for VM '{{.Input}}' in {{.Vars.env}}"
+    retries: 1
+  - name: onboard
+    agent: onboardingAgent
+    prompt: "Explain to a new engineer:\n{{.Previous}}"
+    if: '{{eq .Vars.env "prod"}}'
+`), 0o644)
+
+	out, err := run(t, "run", workflow, "webserver01")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(out, "VM Metrics Analysis") || !strings.Contains(out, "step skipped") || strings.Contains(out, "Setup Azure CLI") {
+		t.Errorf("dev run output:\n%s", out)
+	}
+
+	reportPath := filepath.Join(dir, "report.json")
+	out, err = run(t, "run", workflow, "webserver01", "--var", "env=prod", "--report", reportPath)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(out, "1. Setup Azure CLI") || !strings.Contains(out, "step=onboard") {
+		t.Errorf("prod run output:\n%s", out)
+	}
+	b, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep struct {
+		Status string
+		Vars   map[string]string
+		Steps  []struct{ Name, Status, Prompt string }
+	}
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, b)
+	}
+	if rep.Status != "succeeded" || rep.Vars["env"] != "prod" || len(rep.Steps) != 2 || rep.Steps[1].Status != "succeeded" ||
+		rep.Steps[0].Prompt != "Check CPU for VM 'webserver01' in prod" {
+		t.Errorf("report = %+v", rep)
+	}
+
+	if _, err := run(t, "run", workflow, "--var", "env"); err == nil {
+		t.Error("--var without a value accepted")
+	}
+}
+
+func TestAgentsScaffold(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "bot")
+	out, err := run(t, "agents", "scaffold", "helpBot", "--dir", dir, "--description", "Answers questions about the workshop.")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(out, "created "+filepath.Join(dir, "agent.go")) || !strings.Contains(out, `import _ "helpbot"`) {
+		t.Errorf("output:\n%s", out)
+	}
+	src, err := os.ReadFile(filepath.Join(dir, "agent.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package helpbot", `const Name = "helpBot"`, `Description:  "Answers questions about the workshop."`, "which answers questions about the workshop.\n"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("agent.go lacks %q", want)
+		}
+	}
+	for _, f := range []string{"agent_test.go", "README.md"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Error(err)
+		}
+	}
+	set, err := prompttmpl.LoadDir(filepath.Join(dir, "prompts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, err := set.Render("helpBot", map[string]any{"topic": "Go"}); err != nil || req.Agent != "helpBot" || !strings.Contains(req.Request.Prompt, "Tell me about Go") {
+		t.Errorf("example prompt rendered %+v, %v", req, err)
+	}
+
+	if _, err := run(t, "agents", "scaffold", "helpBot", "--dir", dir); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second scaffold: err = %v, want it to refuse overwriting", err)
+	}
+	if _, err := run(t, "agents", "scaffold", "helpBot", "--dir", dir, "--force"); err != nil {
+		t.Errorf("scaffold --force: %v", err)
+	}
+	if _, err := run(t, "agents", "scaffold", "help bot"); err == nil {
+		t.Error("accepted an agent name with a space")
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	for agent, want := range map[string]string{"weatherAgent": "weather", "cost-report": "costreport", "agent": "agent", "k8s_agent": "k8s"} {
+		if got := packageName(agent); got != want {
+			t.Errorf("packageName(%q) = %q, want %q", agent, got, want)
+		}
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	out, err := run(t, "doctor", "azureVmMetricsAgent")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	for _, want := range []string{"ok    health", "ok    auth    the server accepts calls without an API key", "ok    agents", "9 checks, 0 failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	out, err = run(t, "doctor", "noSuchAgent")
+	if err == nil || !strings.Contains(out, "FAIL  agents  agent noSuchAgent is not registered") || !strings.Contains(out, "hint: run \"mpcctl agents list\"") {
+		t.Errorf("doctor noSuchAgent = %v\n%s", err, out)
+	}
+}
+
+// runDoctor runs mpcctl doctor with args, returning its checks by name.
+func runDoctor(t *testing.T, args ...string) (map[string]check, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(append([]string{"--output", "json", "doctor"}, args...))
+	err := cmd.Execute()
+	var list []check
+	if jerr := json.Unmarshal(out.Bytes(), &list); jerr != nil {
+		t.Fatalf("output is not JSON: %v\n%s", jerr, out.String())
+	}
+	checks := make(map[string]check)
+	for _, c := range list {
+		checks[c.Name] = c
+	}
+	return checks, err
+}
+
+func TestDoctorFindsProblems(t *testing.T) {
+	// A port nothing listens on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	checks, err := runDoctor(t, "--server", "http://"+addr)
+	if err == nil || checks["tcp"].Status != checkFail || !strings.Contains(checks["tcp"].Hint, "start the server") ||
+		checks["health"].Status != checkSkip || checks["dns"].Status != checkOK {
+		t.Errorf("closed port: %v, %+v", err, checks)
+	}
+
+	s := mpcserver.New(mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	if err := demo.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	checks, err = runDoctor(t, "--server", ts.URL)
+	if err == nil || checks["auth"].Status != checkFail || !strings.Contains(checks["auth"].Hint, "MPC_API_KEY") || checks["health"].Status != checkOK {
+		t.Errorf("missing key: %v, %+v", err, checks)
+	}
+	checks, err = runDoctor(t, "--server", ts.URL, "--api-key", "wrong")
+	if err == nil || checks["auth"].Status != checkFail || !strings.Contains(checks["auth"].Detail, "refused the API key") {
+		t.Errorf("wrong key: %v, %+v", err, checks["auth"])
+	}
+	if checks, err = runDoctor(t, "--server", ts.URL, "--api-key", "s3cret"); err != nil || checks["auth"].Detail != "API key accepted" {
+		t.Errorf("right key: %v, %+v", err, checks)
+	}
+
+	bad := filepath.Join(t.TempDir(), "mpc.yaml")
+	os.WriteFile(bad, []byte("serverr: http://localhost:8080\n"), 0o644)
+	t.Setenv("MPC_CONFIG", bad)
+	checks, err = runDoctor(t, "--server", ts.URL)
+	if err == nil || checks["config"].Status != checkFail || checks["proxy"].Status != checkSkip {
+		t.Errorf("bad $MPC_CONFIG: %v, %+v", err, checks)
+	}
+}
+
+func TestDoctorTLS(t *testing.T) {
+	s := mpcserver.New()
+	if err := demo.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(s)
+	defer ts.Close()
+
+	checks, err := runDoctor(t, "--server", ts.URL)
+	if err == nil || checks["health"].Status != checkFail || !strings.Contains(checks["health"].Hint, "--ca-file") {
+		t.Errorf("untrusted certificate: %v, %+v", err, checks["health"])
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o644)
+	checks, err = runDoctor(t, "--server", ts.URL, "--ca-file", ca)
+	if err != nil || checks["tls"].Status == checkFail || !strings.Contains(checks["tls"].Detail, "TLS 1.3") {
+		t.Errorf("trusted certificate: %v, %+v", err, checks)
+	}
+}
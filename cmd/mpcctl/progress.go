@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Progress display settings.
+const (
+	progressRedraw      = 200 * time.Millisecond
+	progressLogInterval = 5 * time.Second
+	progressBarWidth    = 24
+)
+
+// progress reports how far a long command has got on stderr. On a terminal
+// it redraws a bar with the call rate, error count and ETA in place; when
+// stdout or stderr is not a terminal, so that output is being captured, it
+// logs the same figures as a plain line every interval instead. A nil
+// progress reports nothing.
+type progress struct {
+	w        io.Writer
+	label    string
+	duration time.Duration
+	tty      bool
+	interval time.Duration
+	start    time.Time
+
+	mu sync.Mutex
+	// total is the number of items the command works through, or 0 when it
+	// runs for duration instead or has yet to learn it.
+	total        int
+	done, failed int
+
+	stopc chan struct{}
+	wg    sync.WaitGroup
+}
+
+// startProgress starts reporting progress for cmd, unless --no-progress is
+// set. Give total for commands working through a known number of items,
+// duration for those running for a fixed time, or neither for those that
+// set the total once they know it.
+func (o *globalOptions) startProgress(cmd *cobra.Command, label string, total int, duration time.Duration) *progress {
+	if o.noProgress {
+		return nil
+	}
+	w := cmd.ErrOrStderr()
+	p := &progress{w: w, label: label, total: total, duration: duration, interval: progressLogInterval}
+	if isTerminal(w) && isTerminal(cmd.OutOrStdout()) {
+		p.tty, p.interval = true, progressRedraw
+	}
+	p.run()
+	return p
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth returns the number of columns of the terminal w is, or
+// else $COLUMNS, or else 80.
+func terminalWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+func (p *progress) run() {
+	p.start = time.Now()
+	p.stopc = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-p.stopc:
+				if p.tty {
+					fmt.Fprintf(p.w, "\r\x1b[K%s\n", p.line())
+				}
+				return
+			case <-t.C:
+				if p.tty {
+					fmt.Fprintf(p.w, "\r\x1b[K%s", p.line())
+				} else {
+					fmt.Fprintln(p.w, p.line())
+				}
+			}
+		}
+	}()
+}
+
+// record counts one finished item or call.
+func (p *progress) record(failed bool) {
+	p.add(1, failed)
+}
+
+// add counts n finished items, all failed if failed is set.
+func (p *progress) add(n int, failed bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if failed {
+		p.failed += n
+	}
+}
+
+// setTotal sets the number of items, for commands that only learn it
+// once under way.
+func (p *progress) setTotal(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// stop stops reporting. On a terminal it leaves the final bar in place.
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.stopc)
+	p.wg.Wait()
+}
+
+// line formats the current progress: a bar on a terminal, "label: ..."
+// otherwise.
+func (p *progress) line() string {
+	p.mu.Lock()
+	total, done, failed := p.total, p.done, p.failed
+	p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	rate := float64(done) / elapsed.Seconds()
+
+	var (
+		fraction float64
+		count    string
+		eta      time.Duration = -1
+	)
+	switch {
+	case total > 0:
+		fraction = float64(done) / float64(total)
+		count = fmt.Sprintf("%d/%d", done, total)
+		if rate > 0 {
+			eta = time.Duration(float64(total-done) / rate * float64(time.Second))
+		}
+	case p.duration > 0:
+		fraction = elapsed.Seconds() / p.duration.Seconds()
+		count = fmt.Sprintf("%d calls", done)
+		eta = max(p.duration-elapsed, 0)
+	default:
+		count = strconv.Itoa(done)
+	}
+	fraction = min(fraction, 1)
+	etaText := "?"
+	if eta >= 0 {
+		etaText = eta.Round(time.Second).String()
+	}
+	errs := "errors"
+	if failed == 1 {
+		errs = "error"
+	}
+	if !p.tty {
+		return fmt.Sprintf("%s: %s, %.1f/s, %d %s, ETA %s", p.label, count, rate, failed, errs, etaText)
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	return fmt.Sprintf("%s [%s] %s  %.1f/s  %d %s  ETA %s", p.label, bar, count, rate, failed, errs, etaText)
+}
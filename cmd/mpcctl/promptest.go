@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/promptest"
+)
+
+func newPromptestCmd(opts *globalOptions) *cobra.Command {
+	var update bool
+	cmd := &cobra.Command{
+		Use:   "promptest <suite.yaml>...",
+		Short: "Check agents' responses against stored baselines",
+		Long: "Run golden prompt suites against the server and compare each response with its stored baseline, " +
+			"failing when any case regressed. Cases without a baseline record one; --update re-records them all.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			suites := make([]*promptest.Suite, len(args))
+			for i, path := range args {
+				s, err := promptest.LoadFile(path)
+				if err != nil {
+					return err
+				}
+				suites[i] = s
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			runner := &promptest.Runner{Client: c, Update: update}
+			var reports []*promptest.Report
+			failed := false
+			for _, s := range suites {
+				rep, err := runner.Run(cmd.Context(), s)
+				if err != nil {
+					return err
+				}
+				reports = append(reports, rep)
+				failed = failed || !rep.OK()
+			}
+			err = opts.render(cmd.OutOrStdout(), reports, func(w io.Writer) error {
+				for i, rep := range reports {
+					if i > 0 {
+						fmt.Fprintln(w)
+					}
+					if err := rep.WriteText(w); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err == nil && failed {
+				err = errors.New("prompt regressions found")
+			}
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&update, "update", false, "store every response as the new baseline instead of comparing")
+	return cmd
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// globalOptions holds the flags shared by every subcommand.
+type globalOptions struct {
+	server  string
+	tenant  string
+	output  string
+	timeout time.Duration
+	apiKey  string
+	// historyPath is the history file ask and chat record calls to.
+	historyPath string
+	proxy       string
+	tls         mpcclient.TLSConfig
+	// logLevel enables client logging to stderr when set.
+	logLevel string
+	logger   *slog.Logger
+	// metadata labels every call for the server's logs and audit records.
+	metadata map[string]string
+	// noProgress turns off the progress display of long commands.
+	noProgress bool
+	// compression is the encoding large request bodies are compressed
+	// with, if any.
+	compression string
+	// dryRun prints the requests calls would send instead of sending them.
+	dryRun bool
+	// clients are the clients client has built, whose calls the stats
+	// command reports on.
+	clients []*mpcclient.Client
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &globalOptions{}
+	cmd := &cobra.Command{
+		Use:          "mpcctl",
+		Short:        "Interact with an MPC server",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.output != "text" && opts.output != "json" {
+				return fmt.Errorf("--output must be text or json, not %q", opts.output)
+			}
+			if opts.logLevel != "" {
+				var lvl slog.Level
+				if err := lvl.UnmarshalText([]byte(opts.logLevel)); err != nil {
+					return fmt.Errorf("--log-level must be debug, info, warn or error, not %q", opts.logLevel)
+				}
+				opts.logger = slog.New(slog.NewTextHandler(cmd.ErrOrStderr(), &slog.HandlerOptions{Level: lvl}))
+			}
+			return nil
+		},
+	}
+
+	f := cmd.PersistentFlags()
+	f.StringVarP(&opts.server, "server", "s", envOr("MPC_SERVER", mpcclient.DefaultBaseURL), "MPC server base URL [$MPC_SERVER]")
+	f.StringVar(&opts.tenant, "tenant", os.Getenv("MPC_TENANT"), "tenant of the MPC server to call the agents of [$MPC_TENANT]")
+	f.StringVarP(&opts.output, "output", "o", envOr("MPC_OUTPUT", "text"), "output format: text or json [$MPC_OUTPUT]")
+	f.DurationVar(&opts.timeout, "timeout", envDuration("MPC_TIMEOUT", 60*time.Second), "request timeout [$MPC_TIMEOUT]")
+	f.StringVar(&opts.apiKey, "api-key", os.Getenv("MPC_API_KEY"), "API key sent with every request [$MPC_API_KEY]")
+	f.StringVar(&opts.proxy, "proxy", os.Getenv("MPC_PROXY"), "proxy URL; defaults to $HTTPS_PROXY and $HTTP_PROXY [$MPC_PROXY]")
+	f.StringVar(&opts.tls.CAFile, "ca-file", os.Getenv("MPC_CA_FILE"), "PEM bundle of extra root certificates to trust [$MPC_CA_FILE]")
+	f.StringVar(&opts.tls.CertFile, "client-cert", os.Getenv("MPC_CLIENT_CERT"), "PEM client certificate for mutual TLS [$MPC_CLIENT_CERT]")
+	f.StringVar(&opts.tls.KeyFile, "client-key", os.Getenv("MPC_CLIENT_KEY"), "PEM private key of the client certificate [$MPC_CLIENT_KEY]")
+	f.BoolVar(&opts.tls.InsecureSkipVerify, "insecure-skip-verify", envBool("MPC_INSECURE_SKIP_VERIFY"), "accept any server certificate, for test servers only [$MPC_INSECURE_SKIP_VERIFY]")
+	f.StringVar(&opts.historyPath, "history", os.Getenv("MPC_HISTORY"), "record ask and chat calls to this SQLite file, read by the history commands [$MPC_HISTORY]")
+	f.StringToStringVar(&opts.metadata, "metadata", envMetadata("MPC_METADATA"), "key=value labels sent with every call, such as team=blue,exercise=3 [$MPC_METADATA]")
+	f.BoolVar(&opts.noProgress, "no-progress", envBool("MPC_NO_PROGRESS"), "do not report the progress of batch, loadtest and ingest runs on stderr [$MPC_NO_PROGRESS]")
+	f.StringVar(&opts.compression, "compression", os.Getenv("MPC_COMPRESSION"), "compress request bodies of 1 KiB or more, such as long prompts and attachments: gzip or zstd [$MPC_COMPRESSION]")
+	f.BoolVar(&opts.dryRun, "dry-run", envBool("MPC_DRY_RUN"), "print the requests ask and chat would send, credentials redacted, instead of sending them [$MPC_DRY_RUN]")
+	f.StringVar(&opts.logLevel, "log-level", os.Getenv("MPC_LOG_LEVEL"), "log requests to stderr at this level: debug, info, warn or error [$MPC_LOG_LEVEL]")
+
+	cmd.AddCommand(
+		newAskCmd(opts),
+		newChatCmd(opts),
+		newAgentsCmd(opts),
+		newHealthCmd(opts),
+		newDoctorCmd(opts),
+		newLoadtestCmd(opts),
+		newBatchCmd(opts),
+		newIngestCmd(opts),
+		newHistoryCmd(opts),
+		newPromptestCmd(opts),
+		newRunCmd(opts),
+		newStatsCmd(opts),
+	)
+	return cmd
+}
+
+// client builds an MPC client from the global options and extra.
+func (o *globalOptions) client(extra ...mpcclient.Option) (*mpcclient.Client, error) {
+	clientOpts := []mpcclient.Option{mpcclient.WithTimeout(o.timeout)}
+	if o.apiKey != "" {
+		clientOpts = append(clientOpts, mpcclient.WithAPIKey(o.apiKey))
+	}
+	if o.tenant != "" {
+		clientOpts = append(clientOpts, mpcclient.WithTenant(o.tenant))
+	}
+	if o.logger != nil {
+		clientOpts = append(clientOpts, mpcclient.WithLogger(o.logger))
+	}
+	if o.proxy != "" {
+		clientOpts = append(clientOpts, mpcclient.WithProxy(o.proxy))
+	}
+	if len(o.metadata) > 0 {
+		clientOpts = append(clientOpts, mpcclient.WithDefaultMetadata(o.metadata))
+	}
+	if t := o.tls; t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" || t.InsecureSkipVerify {
+		clientOpts = append(clientOpts, mpcclient.WithTLS(o.tls))
+	}
+	if o.compression != "" {
+		clientOpts = append(clientOpts, mpcclient.WithCompression(mpcclient.Encoding(o.compression), 0))
+	}
+	if o.dryRun {
+		clientOpts = append(clientOpts, mpcclient.WithDryRun())
+	}
+	c, err := mpcclient.NewClient(o.server, append(clientOpts, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	o.clients = append(o.clients, c)
+	return c, nil
+}
+
+// render writes v as indented JSON when --output=json, and otherwise calls
+// text to produce the human-readable form.
+func (o *globalOptions) render(w io.Writer, v any, text func(io.Writer) error) error {
+	if o.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	return text(w)
+}
+
+// printDryRun prints the request err holds, if it is the
+// *mpcclient.DryRunError of a dry run, and reports whether it was one.
+func (o *globalOptions) printDryRun(w io.Writer, err error) (bool, error) {
+	var dr *mpcclient.DryRunError
+	if !errors.As(err, &dr) {
+		return false, nil
+	}
+	var body json.RawMessage
+	switch {
+	case json.Valid(dr.Body):
+		body = dr.Body
+	case len(dr.Body) > 0:
+		body, _ = json.Marshal(string(dr.Body))
+	}
+	v := struct {
+		Method string              `json:"method"`
+		URL    string              `json:"url"`
+		Header map[string][]string `json:"header"`
+		Body   json.RawMessage     `json:"body,omitempty"`
+	}{dr.Method, dr.URL, dr.Header, body}
+	return true, o.render(w, v, func(w io.Writer) error {
+		_, err := dr.WriteTo(w)
+		return err
+	})
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envMetadata reads comma-separated key=value pairs from the environment,
+// ignoring malformed ones.
+func envMetadata(key string) map[string]string {
+	md := make(map[string]string)
+	for pair := range strings.SplitSeq(os.Getenv(key), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && k != "" {
+			md[k] = v
+		}
+	}
+	return md
+}
+
+func envBool(key string) bool {
+	b, _ := strconv.ParseBool(os.Getenv(key))
+	return b
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
+}
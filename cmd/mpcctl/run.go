@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/orchestrator"
+)
+
+func newRunCmd(opts *globalOptions) *cobra.Command {
+	var (
+		vars       []string
+		reportPath string
+	)
+	cmd := &cobra.Command{
+		Use:   "run <workflow.yaml> [input]",
+		Short: "Run a workflow of agent calls described in a YAML file",
+		Long: "Run the steps of a YAML workflow in order, each calling an agent with a prompt templated from the input, " +
+			"the workflow's variables and the outputs of earlier steps, and print the output of the last step that ran. " +
+			"Steps can retry, run in parallel, and run only if their if: template holds. --var sets variables, " +
+			"overriding the workflow's vars:; pass - as the input to read it from stdin.\n\n" +
+			"Each step is logged on stderr as it finishes. --report writes a JSON record of the run, with every step's " +
+			"prompt, output, status, attempts and duration; with --output json the record is printed instead of the output.",
+		Example: "  mpcctl run vm-triage.yaml webserver01 --var env=prod\n" +
+			"  mpcctl run vm-triage.yaml webserver01 --report run.json",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			wf, err := orchestrator.LoadFile(args[0])
+			if err != nil {
+				return err
+			}
+			values, err := parseVars(vars)
+			if err != nil {
+				return err
+			}
+			input := strings.Join(args[1:], " ")
+			if input == "-" {
+				b, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return fmt.Errorf("read input: %w", err)
+				}
+				input = string(b)
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			logger := opts.logger
+			if logger == nil {
+				logger = slog.New(slog.NewTextHandler(cmd.ErrOrStderr(), nil))
+			}
+
+			res, runErr := wf.Run(cmd.Context(), c, input, orchestrator.WithVars(values), orchestrator.WithLogger(logger))
+			if res == nil {
+				return runErr
+			}
+			rep := res.Report()
+			if reportPath != "" {
+				if err := writeReport(reportPath, rep); err != nil {
+					return err
+				}
+			}
+			if err := opts.render(cmd.OutOrStdout(), rep, func(w io.Writer) error {
+				if !rep.OK() {
+					return rep.WriteText(cmd.ErrOrStderr())
+				}
+				_, err := fmt.Fprintln(w, rep.Output)
+				return err
+			}); err != nil {
+				return err
+			}
+			return runErr
+		},
+	}
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "set a workflow variable, as key=value; repeatable")
+	cmd.Flags().StringVar(&reportPath, "report", "", "write a JSON report of the run to this file")
+	return cmd
+}
+
+// parseVars parses key=value pairs, as given with --var.
+func parseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--var %q is not key=value", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// writeReport writes rep to the file at path as indented JSON.
+func writeReport(path string, rep *orchestrator.Report) error {
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
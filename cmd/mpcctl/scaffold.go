@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed scaffold/*.tmpl
+var scaffoldFS embed.FS
+
+var scaffoldTemplates = template.Must(template.ParseFS(scaffoldFS, "scaffold/*.tmpl"))
+
+// scaffoldFiles maps the files of a new agent package onto the templates
+// generating them.
+var scaffoldFiles = []struct{ path, tmpl string }{
+	{"agent.go", "agent.go.tmpl"},
+	{"agent_test.go", "agent_test.go.tmpl"},
+	{"README.md", "README.md.tmpl"},
+	{"prompts/{{name}}.prompt", "prompt.tmpl"},
+}
+
+var agentName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// scaffoldData is what the templates are rendered with.
+type scaffoldData struct {
+	Name        string
+	Package     string
+	Description string
+	// Purpose is Description as the end of a sentence.
+	Purpose    string
+	ImportPath string
+	// RelDir is the package directory relative to the module root.
+	RelDir string
+}
+
+// scaffoldResult reports a generated package.
+type scaffoldResult struct {
+	Agent      string   `json:"agent"`
+	Dir        string   `json:"dir"`
+	ImportPath string   `json:"import_path"`
+	Files      []string `json:"files"`
+}
+
+func newAgentsScaffoldCmd(opts *globalOptions) *cobra.Command {
+	var dir, pkg, description string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "scaffold <agent>",
+		Short: "Generate the boilerplate of a new Go agent",
+		Long: "Generate a Go package implementing a new agent: the agent with its configuration struct and plugin " +
+			"registration, a unit test, an example prompt template and a README explaining how to link it into mpcserver. " +
+			"The package goes in mpcserver/agents/<package> when run from the workshop repository, and in ./<package> otherwise.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if !agentName.MatchString(name) {
+				return fmt.Errorf("agent name %q must start with a letter and hold only letters, digits, dashes and underscores", name)
+			}
+			if pkg == "" {
+				pkg = packageName(name)
+			}
+			if !token.IsIdentifier(pkg) || token.IsKeyword(pkg) {
+				return fmt.Errorf("%q is not a valid package name; choose one with --package", pkg)
+			}
+			if dir == "" {
+				dir = pkg
+				if fi, err := os.Stat(filepath.Join("mpcserver", "agents")); err == nil && fi.IsDir() {
+					dir = filepath.Join("mpcserver", "agents", pkg)
+				}
+			}
+			if description == "" {
+				description = "Replies to prompts about a topic."
+			}
+			res, err := scaffoldAgent(dir, scaffoldData{Name: name, Package: pkg, Description: description}, force)
+			if err != nil {
+				return err
+			}
+			return opts.render(cmd.OutOrStdout(), res, func(w io.Writer) error {
+				for _, f := range res.Files {
+					fmt.Fprintf(w, "created %s\n", f)
+				}
+				fmt.Fprintf(w, "\nLink %s into mpcserver by importing it from cmd/mpcserver/main.go:\n\n", res.Agent)
+				fmt.Fprintf(w, "\timport _ %q\n\n", res.ImportPath)
+				fmt.Fprintf(w, "and enabling it in the -agents-config file:\n\n\t%s:\n\t  greeting: Hello\n", res.Agent)
+				return nil
+			})
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&dir, "dir", "", "directory to create the package in")
+	f.StringVar(&pkg, "package", "", "package name; derived from the agent name by default")
+	f.StringVar(&description, "description", "", "what the agent does, as reported to clients")
+	f.BoolVar(&force, "force", false, "overwrite existing files")
+	return cmd
+}
+
+// packageName derives a package name from an agent name, such as
+// weather from weatherAgent.
+func packageName(agent string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(agent) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	pkg := b.String()
+	if trimmed := strings.TrimSuffix(pkg, "agent"); trimmed != "" {
+		pkg = trimmed
+	}
+	return pkg
+}
+
+// scaffoldAgent renders the agent package into dir. Existing files are
+// left alone, and nothing is written, unless force is set.
+func scaffoldAgent(dir string, data scaffoldData, force bool) (*scaffoldResult, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	data.Purpose = strings.TrimRight(lowerFirst(data.Description), ".")
+	data.ImportPath, data.RelDir = importPath(abs, data.Package)
+
+	type file struct {
+		path string
+		body []byte
+	}
+	var files []file
+	for _, f := range scaffoldFiles {
+		path := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(f.path, "{{name}}", data.Name)))
+		var buf bytes.Buffer
+		if err := scaffoldTemplates.ExecuteTemplate(&buf, f.tmpl, data); err != nil {
+			return nil, fmt.Errorf("render %s: %w", path, err)
+		}
+		body := buf.Bytes()
+		if filepath.Ext(path) == ".go" {
+			if body, err = format.Source(body); err != nil {
+				return nil, fmt.Errorf("format %s: %w", path, err)
+			}
+		}
+		if _, err := os.Stat(path); err == nil && !force {
+			return nil, fmt.Errorf("%s already exists; use --force to overwrite it", path)
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		files = append(files, file{path, body})
+	}
+
+	res := &scaffoldResult{Agent: data.Name, Dir: dir, ImportPath: data.ImportPath}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(f.path, f.body, 0o644); err != nil {
+			return nil, err
+		}
+		res.Files = append(res.Files, f.path)
+	}
+	return res, nil
+}
+
+// importPath returns the import path of the package in dir and dir's path
+// relative to its module root, reading the module path from the nearest
+// go.mod above it. Outside a module the package name stands in for both.
+func importPath(dir, pkg string) (path, rel string) {
+	for root := dir; ; {
+		if mod := modulePath(filepath.Join(root, "go.mod")); mod != "" {
+			r, err := filepath.Rel(root, dir)
+			if err != nil {
+				break
+			}
+			r = filepath.ToSlash(r)
+			if r == "." {
+				return mod, "."
+			}
+			return mod + "/" + r, r
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			break
+		}
+		root = parent
+	}
+	return pkg, pkg
+}
+
+// modulePath returns the module path declared in the go.mod file at path,
+// or "" if there is none.
+func modulePath(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if mod, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module"); ok {
+			return strings.Trim(strings.TrimSpace(mod), `"`)
+		}
+	}
+	return ""
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+func newStatsCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats <command> [args...]",
+		Short: "Run a command and report statistics on its agent calls",
+		Long: "Run another mpcctl command and, once it ends, report on stderr the calls it made to each agent: " +
+			"how many there were and how many failed, their latency percentiles, the bytes sent and received, " +
+			"and the errors by kind. Global flags go before stats and the command's flags after its name.",
+		Example: "  mpcctl stats batch --agent azureVmMetricsAgent --input prompts.csv\n" +
+			"  mpcctl --output json stats loadtest --agent onboardingAgent --rps 20 --duration 30s",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sub, subArgs, err := cmd.Root().Find(args)
+			if err != nil || sub == cmd.Root() || sub == cmd || sub.RunE == nil {
+				return fmt.Errorf("stats runs an mpcctl command, such as ask or batch, not %q", strings.Join(args, " "))
+			}
+			runErr := runCommand(cmd, sub, subArgs)
+			if len(opts.clients) == 0 {
+				return runErr
+			}
+			st := opts.clients[0].Stats()
+			if err := opts.render(cmd.ErrOrStderr(), st, func(w io.Writer) error {
+				return writeStats(w, st)
+			}); err != nil {
+				return errors.Join(runErr, err)
+			}
+			return runErr
+		},
+	}
+	// Flags after the command's name are the command's.
+	cmd.Flags().SetInterspersed(false)
+	return cmd
+}
+
+// runCommand runs sub with args, as Execute would have, under the context
+// and global options of the command cmd.
+func runCommand(cmd, sub *cobra.Command, args []string) error {
+	sub.SetContext(cmd.Context())
+	if err := sub.ParseFlags(args); err != nil {
+		return err
+	}
+	args = sub.Flags().Args()
+	if err := sub.ValidateArgs(args); err != nil {
+		return err
+	}
+	return sub.RunE(sub, args)
+}
+
+// writeStats writes st as a table with a row per agent, followed by the
+// errors by kind.
+func writeStats(w io.Writer, st mpcclient.Stats) error {
+	if len(st.Agents) == 0 {
+		_, err := fmt.Fprintln(w, "No agent calls.")
+		return err
+	}
+	agents := slices.Sorted(maps.Keys(st.Agents))
+	fmt.Fprintf(w, "Agent calls over %s:\n", time.Since(st.Since).Round(time.Millisecond))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "AGENT\tCALLS\tERRORS\tP50\tP95\tP99\tMAX\tSENT\tRECEIVED")
+	for _, name := range agents {
+		a := st.Agents[name]
+		l := a.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", name, a.Calls, a.Errors,
+			roundLatency(l.P50), roundLatency(l.P95), roundLatency(l.P99), roundLatency(l.Max),
+			formatBytes(a.BytesOut.Total), formatBytes(a.BytesIn.Total))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, name := range agents {
+		kinds := st.Agents[name].ErrorKinds
+		if len(kinds) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "Errors of %s:\n", name)
+		for _, k := range slices.Sorted(maps.Keys(kinds)) {
+			fmt.Fprintf(w, "  %-16s %d\n", k, kinds[k])
+		}
+	}
+	return nil
+}
+
+// roundLatency rounds d to a precision that suits its size.
+func roundLatency(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
+
+// formatBytes formats n with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
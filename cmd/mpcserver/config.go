@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver/sqlitestore"
+)
+
+// agentsFile is the layout of the -agents-config file, in YAML or JSON:
+//
+//	agents:
+//	  azureVmMetricsAgent:
+//	    subscription_id: 00000000-0000-0000-0000-000000000000
+//	  echo:
+//	    enabled: false
+type agentsFile struct {
+	Agents map[string]mpcserver.ConfigSection `yaml:"agents"`
+}
+
+// loadAgentsConfig reads the agent configuration sections from path. An
+// empty path yields no sections.
+func loadAgentsConfig(path string) (map[string]mpcserver.ConfigSection, error) {
+	if path == "" {
+		return make(map[string]mpcserver.ConfigSection), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f agentsFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Agents == nil {
+		f.Agents = make(map[string]mpcserver.ConfigSection)
+	}
+	return f.Agents, nil
+}
+
+// keysFile is the layout of the -keys-config file, in YAML or JSON:
+//
+//	keys:
+//	  - name: ci
+//	    key: s3cret
+//	    agents: [echo, summarizer]
+//	    rate_limit: 5
+//	    burst: 10
+//	    daily_tokens: 100000
+type keysFile struct {
+	Keys []keyEntry `yaml:"keys"`
+}
+
+type keyEntry struct {
+	Name        string   `yaml:"name"`
+	Key         string   `yaml:"key"`
+	Agents      []string `yaml:"agents"`
+	RateLimit   float64  `yaml:"rate_limit"`
+	Burst       int      `yaml:"burst"`
+	DailyTokens int      `yaml:"daily_tokens"`
+}
+
+// apiKeys converts the key entries of the file at path.
+func apiKeys(path string, entries []keyEntry) ([]mpcserver.APIKey, error) {
+	keys := make([]mpcserver.APIKey, 0, len(entries))
+	for i, k := range entries {
+		if k.Key == "" {
+			return nil, fmt.Errorf("%s: keys[%d]: key is required", path, i)
+		}
+		keys = append(keys, mpcserver.APIKey{
+			Name: k.Name, Key: k.Key, Agents: k.Agents,
+			RateLimit: k.RateLimit, Burst: k.Burst, DailyTokens: k.DailyTokens,
+		})
+	}
+	return keys, nil
+}
+
+// loadAPIKeys reads API keys from path, if not empty, and from env, a
+// comma-separated list of keys, each optionally prefixed with its name
+// and a colon, as in "ci:s3cret,dev:0th3r".
+func loadAPIKeys(path, env string) ([]mpcserver.APIKey, error) {
+	var keys []mpcserver.APIKey
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f keysFile
+		if err := yaml.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if keys, err = apiKeys(path, f.Keys); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range strings.Split(env, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			name, key = "", entry
+		}
+		keys = append(keys, mpcserver.APIKey{Name: name, Key: key})
+	}
+	names, secrets := make(map[string]bool), make(map[string]bool)
+	for i, k := range keys {
+		if k.Name != "" && names[k.Name] || secrets[k.Key] {
+			return nil, fmt.Errorf("API key %d (%q) is defined twice", i+1, k.Name)
+		}
+		names[k.Name], secrets[k.Key] = true, true
+	}
+	return keys, nil
+}
+
+// tenantsFile is the layout of the -tenants-config file, in YAML or JSON.
+// Each tenant has API keys laid out as in the -keys-config file, an
+// optional admin key, and agent sections as in the -agents-config file,
+// on top of the demo agents:
+//
+//	tenants:
+//	  blue:
+//	    admin_key: blue-admin
+//	    keys:
+//	      - {name: team, key: s3cret, daily_tokens: 100000}
+//	    agents:
+//	      shellAgent: {}
+type tenantsFile struct {
+	Tenants map[string]struct {
+		AdminKey string                             `yaml:"admin_key"`
+		Keys     []keyEntry                         `yaml:"keys"`
+		Agents   map[string]mpcserver.ConfigSection `yaml:"agents"`
+	} `yaml:"tenants"`
+}
+
+// tenantConfig is the configuration of one tenant.
+type tenantConfig struct {
+	opts   []mpcserver.Option
+	agents map[string]mpcserver.ConfigSection
+}
+
+// loadTenants reads the tenants from path. An empty path yields none.
+func loadTenants(path string) (map[string]tenantConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f tenantsFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	tenants := make(map[string]tenantConfig, len(f.Tenants))
+	for id, t := range f.Tenants {
+		keys, err := apiKeys(path+": tenants."+id, t.Keys)
+		if err != nil {
+			return nil, err
+		}
+		var cfg tenantConfig
+		if len(keys) > 0 {
+			cfg.opts = append(cfg.opts, mpcserver.WithAPIKeys(keys...))
+		}
+		if t.AdminKey != "" {
+			cfg.opts = append(cfg.opts, mpcserver.WithAdminKey(t.AdminKey))
+		}
+		cfg.agents = t.Agents
+		if cfg.agents == nil {
+			cfg.agents = make(map[string]mpcserver.ConfigSection)
+		}
+		tenants[id] = cfg
+	}
+	return tenants, nil
+}
+
+// filtersFile is the layout of the -content-filter file, in YAML or JSON,
+// with the filter under "*" applying to agents without one of their own:
+//
+//	filters:
+//	  "*":
+//	    pii: true
+//	  shellAgent:
+//	    keywords: [password]
+//	    block: {private_key: 'BEGIN [A-Z ]*PRIVATE KEY'}
+//	    max_length: 20000
+type filtersFile struct {
+	Filters map[string]mpcserver.ConfigSection `yaml:"filters"`
+}
+
+// loadFilters reads the response filters of agents from path. An empty
+// path yields none.
+func loadFilters(path string) (map[string]mpcserver.ResponseFilter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f filtersFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	filters := make(map[string]mpcserver.ResponseFilter, len(f.Filters))
+	for name, section := range f.Filters {
+		var cfg mpcserver.ContentFilterConfig
+		if err := section.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("%s: filters.%s: %w", path, name, err)
+		}
+		cf, err := mpcserver.NewContentFilter(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: filters.%s: %w", path, name, err)
+		}
+		filters[name] = cf
+	}
+	return filters, nil
+}
+
+// schedulesFile is the layout of the -schedules-config file, in YAML or
+// JSON, with specs as mpcserver.Schedule describes them. A webhook_url
+// needs -job-callback-secret, and an owner, naming an API key, is
+// required on servers with keys:
+//
+//	schedules:
+//	  - name: vm-metrics
+//	    agent: azureVmMetricsAgent
+//	    spec: "@hourly"
+//	    jitter: 2m
+//	    prompt: Summarize CPU and memory of VM 'webserver01'
+//	    webhook_url: https://hooks.example.com/mpc
+type schedulesFile struct {
+	Schedules []scheduleEntry `yaml:"schedules"`
+}
+
+type scheduleEntry struct {
+	Name       string            `yaml:"name"`
+	Agent      string            `yaml:"agent"`
+	Spec       string            `yaml:"spec"`
+	Jitter     string            `yaml:"jitter"`
+	Prompt     string            `yaml:"prompt"`
+	Context    map[string]any    `yaml:"context"`
+	Parameters map[string]any    `yaml:"parameters"`
+	Metadata   map[string]string `yaml:"metadata"`
+	WebhookURL string            `yaml:"webhook_url"`
+	Owner      string            `yaml:"owner"`
+}
+
+// loadSchedules reads the schedules from path. An empty path yields none.
+func loadSchedules(path string) ([]mpcserver.Schedule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f schedulesFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	schedules := make([]mpcserver.Schedule, 0, len(f.Schedules))
+	for i, e := range f.Schedules {
+		sc := mpcserver.Schedule{
+			Name: e.Name, Agent: e.Agent, Spec: e.Spec, Jitter: e.Jitter, WebhookURL: e.WebhookURL, Owner: e.Owner,
+			Request: mpcserver.Request{Prompt: e.Prompt, Context: e.Context, Parameters: e.Parameters, Metadata: e.Metadata},
+		}
+		if err := sc.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: schedules[%d]: %w", path, i, err)
+		}
+		schedules = append(schedules, sc)
+	}
+	return schedules, nil
+}
+
+// stringsFlag collects the values of a repeated flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// openStore opens the -store backend spec names: "memory", for which it
+// returns nil and the server keeps its state itself, or "sqlite:" followed
+// by the path of a SQLite file.
+func openStore(spec string) (mpcserver.Store, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "memory":
+		return nil, nil
+	case "sqlite":
+		return sqlitestore.Open(path)
+	}
+	return nil, fmt.Errorf("-store %q: use memory or sqlite:file", spec)
+}
@@ -0,0 +1,253 @@
+// Command mpcserver runs the Go MPC server with the workshop demo agents.
+//
+// Further agents are loaded from plugins, either linked into the binary or
+// opened with -plugin, for each section of the -agents-config file that
+// names them. A section naming a demo agent replaces it, or disables it
+// with "enabled: false".
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver/agents/azurevm"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver/agents/demo"
+	_ "github.com/olafkfreund/ai_team_workshop/mpcserver/agents/github"
+	_ "github.com/olafkfreund/ai_team_workshop/mpcserver/agents/kube"
+	_ "github.com/olafkfreund/ai_team_workshop/mpcserver/agents/shell"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve the gRPC API on, in addition to HTTP; empty disables it")
+	grace := flag.Duration("shutdown-timeout", 10*time.Second, "how long to let in-flight agent calls finish on shutdown before cancelling them")
+	compressMin := flag.Int("compress-min-bytes", mpcserver.DefaultCompressionMinSize, "smallest response body, in bytes, compressed for clients accepting zstd or gzip; 0 disables response compression")
+	keepAlive := flag.Duration("stream-keepalive", mpcserver.DefaultStreamKeepAlive, "how often agent streams send a keepalive comment while the agent is quiet; 0 disables them")
+	level := flag.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	format := flag.String("log-format", "text", "log format: text or json")
+	subscription := flag.String("azure-subscription", os.Getenv("AZURE_SUBSCRIPTION_ID"),
+		"serve "+azurevm.Name+" from Azure Monitor for this subscription instead of canned replies [$AZURE_SUBSCRIPTION_ID]")
+	agentsConfig := flag.String("agents-config", "", "YAML or JSON `file` of agent configuration sections, keyed by agent name; read again on SIGHUP")
+	var pluginPaths stringsFlag
+	flag.Var(&pluginPaths, "plugin", "Go plugin `file` registering more agents; may be repeated")
+	var limits mpcserver.RequestLimits
+	flag.Int64Var(&limits.MaxBodySize, "max-body-bytes", mpcserver.DefaultMaxBodySize, "largest JSON request body accepted, in bytes")
+	flag.IntVar(&limits.MaxPromptLength, "max-prompt-length", mpcserver.DefaultMaxPromptLength, "longest prompt accepted, in characters")
+	keysConfig := flag.String("keys-config", "", "YAML or JSON `file` of API keys with their agents and quotas, added to those in $MPC_API_KEYS; with keys, or an admin key, every agent call needs one")
+	auditLog := flag.String("audit-log", "", "append an audit record of every agent call to `file`, as JSON lines rotated at 100 MB")
+	auditWebhook := flag.String("audit-webhook", "", "also post audit records, in batches, to `url`")
+	adminKey := flag.String("admin-key", os.Getenv("MPC_ADMIN_KEY"), "key for managing API keys under /admin/keys; empty disables it [$MPC_ADMIN_KEY]")
+	tenantsConfig := flag.String("tenants-config", "", "YAML or JSON `file` of tenants, each with its own API keys and agents, served under /tenant/{id}/")
+	contentFilter := flag.String("content-filter", "", "YAML or JSON `file` of response filters, keyed by agent name or * for all, blocking or redacting unsafe content")
+	callbackSecret := flag.String("job-callback-secret", os.Getenv("MPC_JOB_CALLBACK_SECRET"), "secret signing the callbacks of jobs submitted with a Callback-URL; empty disables callbacks [$MPC_JOB_CALLBACK_SECRET]")
+	signingSecret := flag.String("signing-secret", os.Getenv("MPC_SIGNING_SECRET"), "secret shared with clients that every request must be signed with; empty accepts unsigned requests [$MPC_SIGNING_SECRET]")
+	signingTolerance := flag.Duration("signing-tolerance", mpcserver.DefaultSignatureTolerance, "how far the timestamp of a signed request may be from the server's clock")
+	schedulesConfig := flag.String("schedules-config", "", "YAML or JSON `file` of schedules running agent prompts at recurring times, their results kept as jobs")
+	storeSpec := flag.String("store", "memory", "where jobs, idempotent responses, WebSocket sessions and the audit trail are kept: memory, or sqlite:`file` to keep them across restarts")
+	flag.Parse()
+
+	logger, err := newLogger(*level, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	if err := openPlugins(pluginPaths); err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	// The agents configuration is read again on SIGHUP and /admin/reload.
+	source := func(context.Context) (map[string]mpcserver.ConfigSection, error) {
+		configs, err := loadAgentsConfig(*agentsConfig)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := configs[azurevm.Name]; !ok && *subscription != "" {
+			configs[azurevm.Name] = mpcserver.ConfigSection{"subscription_id": *subscription}
+		}
+		return configs, nil
+	}
+	configs, err := source(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	keys, err := loadAPIKeys(*keysConfig, os.Getenv("MPC_API_KEYS"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	tenants, err := loadTenants(*tenantsConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	filters, err := loadFilters(*contentFilter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	schedules, err := loadSchedules(*schedulesConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	store, err := openStore(*storeSpec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mpcserver:", err)
+		os.Exit(2)
+	}
+	opts := []mpcserver.Option{mpcserver.WithLogger(logger), mpcserver.WithRequestLimits(limits), mpcserver.WithConfigSource(source), mpcserver.WithStreamKeepAlive(*keepAlive), mpcserver.WithCompressionMinSize(*compressMin)}
+	if store != nil {
+		opts = append(opts, mpcserver.WithStore(store))
+	}
+	if len(filters) > 0 {
+		opts = append(opts, mpcserver.WithResponseFilters(filters))
+	}
+	if len(keys) > 0 {
+		opts = append(opts, mpcserver.WithAPIKeys(keys...))
+	}
+	if *adminKey != "" {
+		opts = append(opts, mpcserver.WithAdminKey(*adminKey))
+	}
+	if *callbackSecret != "" {
+		opts = append(opts, mpcserver.WithJobCallbacks(mpcserver.JobCallbacks{Secret: []byte(*callbackSecret)}))
+	}
+	if *signingSecret != "" {
+		opts = append(opts, mpcserver.WithRequestSigning(mpcserver.RequestSigning{Secret: []byte(*signingSecret), Tolerance: *signingTolerance}))
+	}
+	if *auditLog != "" {
+		f, err := mpcserver.OpenAuditFile(*auditLog, mpcserver.AuditRotation{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "mpcserver:", err)
+			os.Exit(2)
+		}
+		opts = append(opts, mpcserver.WithAuditLog(f))
+	}
+	if *auditWebhook != "" {
+		opts = append(opts, mpcserver.WithAuditLog(mpcserver.NewAuditWebhook(*auditWebhook, mpcserver.AuditWebhookOptions{
+			OnError: func(err error) { logger.Error("audit", "error", err) },
+		})))
+	}
+	if err := run(logger, *addr, *grpcAddr, *grace, opts, configs, tenants, schedules); err != nil {
+		logger.Error("mpcserver failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(logger *slog.Logger, addr, grpcAddr string, grace time.Duration, opts []mpcserver.Option, configs map[string]mpcserver.ConfigSection, tenants map[string]tenantConfig, schedules []mpcserver.Schedule) error {
+	s := mpcserver.New(opts...)
+	if err := loadAgents(s, configs); err != nil {
+		return err
+	}
+	for id, cfg := range tenants {
+		t, err := s.AddTenant(id, cfg.opts...)
+		if err != nil {
+			return err
+		}
+		if err := loadAgents(t, cfg.agents); err != nil {
+			return fmt.Errorf("tenant %q: %w", id, err)
+		}
+	}
+	for _, sc := range schedules {
+		if err := s.AddSchedule(sc); err != nil {
+			return err
+		}
+	}
+	if err := s.Start(context.Background()); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			// Failures are logged with the rest; the agents stay as they were.
+			if _, err := s.Reload(ctx); err != nil {
+				logger.Error("reload failed", "error", err)
+			}
+		}
+	}()
+
+	errc := make(chan error, 1)
+	go func() {
+		logger.Info("mpcserver listening", "addr", addr, "agents", s.Registry().Len(), "tenants", s.Tenants(), "schedules", len(schedules))
+		errc <- s.ListenAndServe(addr)
+	}()
+	grpcErrc := make(chan error, 1)
+	if grpcAddr != "" {
+		l, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return fmt.Errorf("grpc: %w", err)
+		}
+		go func() {
+			logger.Info("mpcserver serving gRPC", "addr", grpcAddr)
+			grpcErrc <- s.ServeGRPC(l)
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case err := <-grpcErrc:
+		return fmt.Errorf("grpc: %w", err)
+	case <-ctx.Done():
+	}
+	// Restore default signal handling, so that a second signal ends the
+	// process without waiting for the drain.
+	stop()
+
+	logger.Info("shutting down", "timeout", grace)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// loadAgents registers the demo agents and loads the plugins configs
+// names on s. A section naming a demo agent replaces it with the plugin of
+// the same name, such as the live azureVmMetricsAgent, or disables it.
+func loadAgents(s *mpcserver.Server, configs map[string]mpcserver.ConfigSection) error {
+	for name, a := range demo.Agents() {
+		if _, ok := configs[name]; ok {
+			continue
+		}
+		if err := s.Register(name, a); err != nil {
+			return err
+		}
+	}
+	return s.LoadPlugins(configs)
+}
+
+func newLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid -log-format %q: must be text or json", format)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package main
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// openPlugins opens the Go plugins at paths, whose init functions register
+// their agents with mpcserver.RegisterPlugin.
+func openPlugins(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("open plugin: %w", err)
+		}
+	}
+	return nil
+}
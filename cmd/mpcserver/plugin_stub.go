@@ -0,0 +1,14 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package main
+
+import "errors"
+
+// openPlugins fails if given any paths: Go plugins need cgo on Linux,
+// macOS or FreeBSD. Link agents in by import instead.
+func openPlugins(paths []string) error {
+	if len(paths) > 0 {
+		return errors.New("open plugin: Go plugins are not supported by this build")
+	}
+	return nil
+}
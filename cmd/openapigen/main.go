@@ -0,0 +1,257 @@
+// Command openapigen writes the OpenAPI document of the Go MPC server and
+// generates Go types from it, keeping the committed document and the
+// client's wire models in step with the server:
+//
+//	openapigen spec -o api/openapi.json
+//	openapigen models -spec api/openapi.json -package wire -o mpcclient/wire/models_gen.go
+//
+// The document describes a server with API keys and an admin key, so that
+// it covers every route and security requirement. Run make openapi, or go
+// generate ./mpcclient/wire, after changing the server's routes or types.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "spec":
+		fs := flag.NewFlagSet("spec", flag.ExitOnError)
+		out := fs.String("o", "", "`file` to write the document to; standard output when empty")
+		fs.Parse(args)
+		err = writeOutput(*out, specJSON)
+	case "models":
+		fs := flag.NewFlagSet("models", flag.ExitOnError)
+		spec := fs.String("spec", "api/openapi.json", "OpenAPI `file` to generate from")
+		pkg := fs.String("package", "wire", "package `name` of the generated file")
+		out := fs.String("o", "", "`file` to write the models to; standard output when empty")
+		fs.Parse(args)
+		err = writeOutput(*out, func() ([]byte, error) {
+			b, err := os.ReadFile(*spec)
+			if err != nil {
+				return nil, err
+			}
+			return models(b, *pkg, *spec)
+		})
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "openapigen:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: openapigen spec [-o file]\n       openapigen models [-spec file] [-package name] [-o file]")
+	os.Exit(2)
+}
+
+func writeOutput(path string, gen func() ([]byte, error)) error {
+	b, err := gen()
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// specJSON returns the server's OpenAPI document as indented JSON.
+func specJSON() ([]byte, error) {
+	srv := mpcserver.New(
+		mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "spec", Key: "spec"}),
+		mpcserver.WithAdminKey("spec"),
+		mpcserver.WithConfigSource(func(context.Context) (map[string]mpcserver.ConfigSection, error) { return nil, nil }),
+	)
+	b, err := json.MarshalIndent(srv.OpenAPI(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// schema is the subset of an OpenAPI schema object the models use.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []string           `json:"enum"`
+	Items                *schema            `json:"items"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+}
+
+// models generates a Go file declaring a struct for each schema in the
+// components of the OpenAPI document spec, and a string type with
+// constants for each enumerated property.
+func models(spec []byte, pkg, source string) ([]byte, error) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", source, err)
+	}
+	g := &modelGen{imports: map[string]bool{}}
+
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		s := doc.Components.Schemas[name]
+		if s.Type != "object" || s.Properties == nil {
+			return nil, fmt.Errorf("schema %s: only objects are supported", name)
+		}
+		fmt.Fprintf(&g.buf, "\n// %s is the %s schema of the MPC server's API.\ntype %s struct {\n", name, name, name)
+		for _, prop := range sortedKeys(s.Properties) {
+			field := goName(prop)
+			typ, err := g.goType(name+field, s.Properties[prop], true)
+			if err != nil {
+				return nil, fmt.Errorf("schema %s, property %s: %w", name, prop, err)
+			}
+			tag := prop
+			switch {
+			case slices.Contains(s.Required, prop):
+			case typ == "time.Time":
+				tag += ",omitzero"
+			case s.Properties[prop].Ref != "":
+				typ = "*" + typ
+				tag += ",omitempty"
+			default:
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&g.buf, "\t%s %s `json:%q`\n", field, typ, tag)
+		}
+		fmt.Fprintf(&g.buf, "}\n")
+	}
+	g.buf.Write(g.enums.Bytes())
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by openapigen from %s. DO NOT EDIT.\n\npackage %s\n", source, pkg)
+	if len(g.imports) > 0 {
+		fmt.Fprintf(&out, "\nimport (\n")
+		for _, path := range sortedKeys(g.imports) {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		fmt.Fprintf(&out, ")\n")
+	}
+	out.Write(g.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+type modelGen struct {
+	buf, enums bytes.Buffer
+	imports    map[string]bool
+}
+
+// goType returns the Go type of s, declaring it as name when it is an
+// enumeration. Untyped values are json.RawMessage at the top of a field,
+// so that they can be decoded later, and any inside collections.
+func (g *modelGen) goType(name string, s *schema, field bool) (string, error) {
+	if s.Ref != "" {
+		ref, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			return "", fmt.Errorf("unsupported reference %s", s.Ref)
+		}
+		return ref, nil
+	}
+	switch s.Type {
+	case "":
+		if field {
+			g.imports["encoding/json"] = true
+			return "json.RawMessage", nil
+		}
+		return "any", nil
+	case "string":
+		switch {
+		case s.Format == "date-time":
+			g.imports["time"] = true
+			return "time.Time", nil
+		case len(s.Enum) > 0:
+			g.enum(name, s.Enum)
+			return name, nil
+		}
+		return "string", nil
+	case "boolean":
+		return "bool", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		if s.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		elem, err := g.goType(name, s.Items, false)
+		return "[]" + elem, err
+	case "object":
+		if s.AdditionalProperties == nil {
+			return "", fmt.Errorf("inline objects are not supported")
+		}
+		elem, err := g.goType(name, s.AdditionalProperties, false)
+		return "map[string]" + elem, err
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+func (g *modelGen) enum(name string, values []string) {
+	fmt.Fprintf(&g.enums, "\n// %s enumerates the values of a string property.\ntype %s string\n\nconst (\n", name, name)
+	for _, v := range values {
+		fmt.Fprintf(&g.enums, "\t%s%s %s = %q\n", name, goName(v), name, v)
+	}
+	fmt.Fprintf(&g.enums, ")\n")
+}
+
+// initialisms are the words written in capitals in Go names.
+var initialisms = map[string]bool{"id": true, "url": true, "api": true, "ms": true, "json": true, "http": true}
+
+// goName converts a snake_case JSON name to an exported Go name.
+func goName(s string) string {
+	var b strings.Builder
+	for word := range strings.FieldsFuncSeq(s, func(r rune) bool { return r == '_' || r == '-' }) {
+		switch {
+		case word == "ids":
+			b.WriteString("IDs")
+		case initialisms[word]:
+			b.WriteString(strings.ToUpper(word))
+		default:
+			r := []rune(word)
+			r[0] = unicode.ToUpper(r[0])
+			b.WriteString(string(r))
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
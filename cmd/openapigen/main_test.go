@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestGeneratedFilesUpToDate fails when the committed OpenAPI document or
+// the wire models no longer match the server.
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	spec, err := specJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../../api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spec, committed) {
+		t.Error("api/openapi.json is out of date; run make openapi")
+	}
+
+	got, err := models(spec, "wire", "api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err = os.ReadFile("../../mpcclient/wire/models_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, committed) {
+		t.Error("mpcclient/wire/models_gen.go is out of date; run make openapi")
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"agent":             "Agent",
+		"request_id":        "RequestID",
+		"execution_time_ms": "ExecutionTimeMS",
+		"tool_call_ids":     "ToolCallIDs",
+		"not-ready":         "NotReady",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults applied by Default.
+const (
+	DefaultServer  = "http://localhost:8080"
+	DefaultTimeout = 60 * time.Second
+)
+
+// EnvConfigFile names the environment variable holding the path of the
+// configuration file, used when the -config flag is not set.
+const EnvConfigFile = "MPC_CONFIG"
+
+// Config holds the settings needed to build an MPC client.
+type Config struct {
+	// Server is the base URL of the MPC server.
+	Server string `yaml:"server" json:"server"`
+	// Servers are the base URLs of further servers hosting the same
+	// agents. Requests are balanced over them and Server.
+	Servers []string `yaml:"servers" json:"servers"`
+	// Balancing is how requests are spread over the servers: BalanceRoundRobin,
+	// the default, or BalanceLeastLatency.
+	Balancing string `yaml:"balancing" json:"balancing"`
+	// Tenant is the tenant of the server whose agents are called, on
+	// servers hosting several.
+	Tenant string `yaml:"tenant" json:"tenant"`
+	// DefaultAgent is called when a call names no agent.
+	DefaultAgent string `yaml:"default_agent" json:"default_agent"`
+	// Timeout bounds each call. Zero means no client-side limit.
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+	Auth    Auth     `yaml:"auth" json:"auth"`
+	Retry   Retry    `yaml:"retry" json:"retry"`
+	// Proxy is the http, https or socks5 URL of the proxy requests go
+	// through. When empty, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	// environment variables apply.
+	Proxy string `yaml:"proxy" json:"proxy"`
+	TLS   TLS    `yaml:"tls" json:"tls"`
+	// Metadata labels every call, such as with the user, team or workshop
+	// exercise, for the server's logs and audit records.
+	Metadata map[string]string `yaml:"metadata" json:"metadata"`
+	Offline  Offline           `yaml:"offline" json:"offline"`
+	// Compression is the encoding request bodies of 1 KiB or more are
+	// compressed with, gzip or zstd, for servers that decode them; empty
+	// sends them as they are.
+	Compression string `yaml:"compression" json:"compression"`
+	// DryRun has clients print the requests they build instead of sending
+	// them.
+	DryRun bool `yaml:"dry_run" json:"dry_run"`
+}
+
+// Balancing strategies for Config.Balancing.
+const (
+	BalanceRoundRobin   = "round_robin"
+	BalanceLeastLatency = "least_latency"
+)
+
+// Auth holds the client's credentials. At most one method may be set.
+type Auth struct {
+	APIKey string `yaml:"api_key" json:"api_key"`
+	// APIKeyHeader overrides the header the API key is sent in.
+	APIKeyHeader string   `yaml:"api_key_header" json:"api_key_header"`
+	BearerToken  string   `yaml:"bearer_token" json:"bearer_token"`
+	AzureAD      *AzureAD `yaml:"azure_ad" json:"azure_ad"`
+	// SigningSecret signs every request, alongside any of the methods,
+	// for servers requiring signed requests.
+	SigningSecret string `yaml:"signing_secret" json:"signing_secret"`
+}
+
+// Encodings for Config.Compression.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Offline modes for Offline.Mode.
+const (
+	OfflineAlways   = "always"
+	OfflineFallback = "fallback"
+)
+
+// Offline serves canned responses from a fixtures directory, for when the
+// network or the model backend is down.
+type Offline struct {
+	// Dir holds the fixtures; empty disables offline mode.
+	Dir string `yaml:"dir" json:"dir"`
+	// Mode is OfflineAlways, the default, to answer every call from the
+	// fixtures, or OfflineFallback to answer only the calls that fail.
+	Mode string `yaml:"mode" json:"mode"`
+}
+
+// AzureAD holds Azure AD client-credentials settings.
+type AzureAD struct {
+	TenantID     string `yaml:"tenant_id" json:"tenant_id"`
+	ClientID     string `yaml:"client_id" json:"client_id"`
+	ClientSecret string `yaml:"client_secret" json:"client_secret"`
+	Scope        string `yaml:"scope" json:"scope"`
+	// Authority overrides the identity endpoint, for sovereign clouds.
+	Authority string `yaml:"authority" json:"authority"`
+}
+
+// Retry configures retries of failed calls. Zero MaxAttempts disables
+// them; zero delays take the client's defaults.
+type Retry struct {
+	MaxAttempts int      `yaml:"max_attempts" json:"max_attempts"`
+	BaseDelay   Duration `yaml:"base_delay" json:"base_delay"`
+	MaxDelay    Duration `yaml:"max_delay" json:"max_delay"`
+}
+
+// TLS configures how servers are verified and how the client
+// authenticates to them.
+type TLS struct {
+	// CAFile is a PEM bundle of root certificates trusted in addition to
+	// the system's.
+	CAFile string `yaml:"ca_file" json:"ca_file"`
+	// CertFile and KeyFile are a PEM client certificate and key for mutual
+	// TLS.
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+	// InsecureSkipVerify accepts any server certificate. Use it only with
+	// test servers.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in files.
+type Duration time.Duration
+
+// UnmarshalText parses a Go duration string.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats d as a Go duration string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the configuration used when nothing else is set.
+func Default() Config {
+	return Config{Server: DefaultServer, Timeout: Duration(DefaultTimeout)}
+}
+
+// Setting is one configuration value that can be set from the environment
+// or a flag.
+type Setting struct {
+	// Env is the environment variable name.
+	Env string
+	// Flag is the flag name, or empty for settings, such as secrets, that
+	// are not accepted on the command line.
+	Flag  string
+	Usage string
+	set   func(*Config, string) error
+}
+
+// Settings lists the values read from the environment and flags.
+var Settings = []Setting{
+	{"MPC_SERVER", "server", "MPC server base URL", func(c *Config, v string) error {
+		c.Server = v
+		return nil
+	}},
+	{"MPC_SERVERS", "servers", "comma-separated base URLs of further MPC servers to balance over", func(c *Config, v string) error {
+		c.Servers = strings.Split(v, ",")
+		for i := range c.Servers {
+			c.Servers[i] = strings.TrimSpace(c.Servers[i])
+		}
+		return nil
+	}},
+	{"MPC_BALANCING", "balancing", "how calls are spread over the servers: round_robin or least_latency", func(c *Config, v string) error {
+		c.Balancing = v
+		return nil
+	}},
+	{"MPC_TENANT", "tenant", "tenant of the MPC server whose agents are called", func(c *Config, v string) error {
+		c.Tenant = v
+		return nil
+	}},
+	{"MPC_DEFAULT_AGENT", "agent", "agent called when none is named", func(c *Config, v string) error {
+		c.DefaultAgent = v
+		return nil
+	}},
+	{"MPC_TIMEOUT", "timeout", "timeout of each call, such as 30s", func(c *Config, v string) error {
+		return c.Timeout.UnmarshalText([]byte(v))
+	}},
+	{"MPC_API_KEY", "api-key", "API key sent with every request", func(c *Config, v string) error {
+		c.Auth.APIKey = v
+		return nil
+	}},
+	{"MPC_BEARER_TOKEN", "", "bearer token sent with every request", func(c *Config, v string) error {
+		c.Auth.BearerToken = v
+		return nil
+	}},
+	{"MPC_SIGNING_SECRET", "", "secret shared with the server that requests are signed with", func(c *Config, v string) error {
+		c.Auth.SigningSecret = v
+		return nil
+	}},
+	{"MPC_AZURE_TENANT_ID", "", "Azure AD tenant", func(c *Config, v string) error {
+		c.azureAD().TenantID = v
+		return nil
+	}},
+	{"MPC_AZURE_CLIENT_ID", "", "Azure AD application (client) ID", func(c *Config, v string) error {
+		c.azureAD().ClientID = v
+		return nil
+	}},
+	{"MPC_AZURE_CLIENT_SECRET", "", "Azure AD client secret", func(c *Config, v string) error {
+		c.azureAD().ClientSecret = v
+		return nil
+	}},
+	{"MPC_AZURE_SCOPE", "", "Azure AD scope, such as api://<app-id>/.default", func(c *Config, v string) error {
+		c.azureAD().Scope = v
+		return nil
+	}},
+	{"MPC_RETRY_MAX_ATTEMPTS", "retry-attempts", "attempts per call, including the first; 0 disables retries", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Retry.MaxAttempts = n
+		return err
+	}},
+	{"MPC_RETRY_BASE_DELAY", "", "wait before the first retry", func(c *Config, v string) error {
+		return c.Retry.BaseDelay.UnmarshalText([]byte(v))
+	}},
+	{"MPC_RETRY_MAX_DELAY", "", "cap on the wait between retries", func(c *Config, v string) error {
+		return c.Retry.MaxDelay.UnmarshalText([]byte(v))
+	}},
+	{"MPC_PROXY", "proxy", "URL of the proxy requests go through", func(c *Config, v string) error {
+		c.Proxy = v
+		return nil
+	}},
+	{"MPC_CA_FILE", "ca-file", "PEM bundle of extra root certificates to trust", func(c *Config, v string) error {
+		c.TLS.CAFile = v
+		return nil
+	}},
+	{"MPC_CLIENT_CERT", "client-cert", "PEM client certificate for mutual TLS", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"MPC_CLIENT_KEY", "client-key", "PEM private key of the client certificate", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+	{"MPC_INSECURE_SKIP_VERIFY", "insecure-skip-verify", "accept any server certificate (test servers only)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.TLS.InsecureSkipVerify = b
+		return err
+	}},
+	{"MPC_METADATA", "metadata", "comma-separated key=value labels sent with every call, such as team=blue,exercise=3", func(c *Config, v string) error {
+		for pair := range strings.SplitSeq(v, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || key == "" {
+				return fmt.Errorf("metadata %q is not key=value", pair)
+			}
+			if c.Metadata == nil {
+				c.Metadata = make(map[string]string)
+			}
+			c.Metadata[key] = value
+		}
+		return nil
+	}},
+	{"MPC_OFFLINE_DIR", "offline-dir", "directory of canned responses to answer calls from when offline", func(c *Config, v string) error {
+		c.Offline.Dir = v
+		return nil
+	}},
+	{"MPC_OFFLINE_MODE", "offline-mode", "when canned responses answer: always, or fallback when calls fail", func(c *Config, v string) error {
+		c.Offline.Mode = v
+		return nil
+	}},
+	{"MPC_COMPRESSION", "compression", "compress request bodies of 1 KiB or more: gzip or zstd", func(c *Config, v string) error {
+		c.Compression = v
+		return nil
+	}},
+	{"MPC_DRY_RUN", "dry-run", "build requests without sending them, for checking prompts and parameters", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.DryRun = b
+		return err
+	}},
+}
+
+func (c *Config) azureAD() *AzureAD {
+	if c.Auth.AzureAD == nil {
+		c.Auth.AzureAD = &AzureAD{}
+	}
+	return c.Auth.AzureAD
+}
+
+// RegisterFlags defines the -config flag and a flag for each setting that
+// has one on fs. Their defaults are empty, so only flags set explicitly
+// take precedence in Load.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.String("config", "", "path of a YAML or JSON configuration file [$"+EnvConfigFile+"]")
+	for _, s := range Settings {
+		if s.Flag != "" {
+			fs.String(s.Flag, "", s.Usage+" [$"+s.Env+"]")
+		}
+	}
+}
+
+// Load resolves the configuration in the order described in the package
+// documentation and validates it. fs must have been parsed; it may be nil
+// if the program registers no flags.
+func Load(fs *flag.FlagSet) (Config, error) {
+	set := make(map[string]string)
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = f.Value.String() })
+	}
+
+	cfg := Default()
+	path, ok := set["config"]
+	if !ok {
+		path = os.Getenv(EnvConfigFile)
+	}
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, s := range Settings {
+		if v := os.Getenv(s.Env); v != "" {
+			if err := s.set(&cfg, v); err != nil {
+				return Config{}, fmt.Errorf("config: $%s: %w", s.Env, err)
+			}
+		}
+	}
+	for _, s := range Settings {
+		if v, ok := set[s.Flag]; ok && s.Flag != "" {
+			if err := s.set(&cfg, v); err != nil {
+				return Config{}, fmt.Errorf("config: -%s: %w", s.Flag, err)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadFile returns the defaults overridden by the file at path, without
+// consulting the environment. Files ending in .json are parsed as JSON and
+// all others as YAML.
+func LoadFile(path string) (Config, error) {
+	cfg := Default()
+	if err := cfg.readFile(path); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// readFile overrides the fields of c present in the file at path.
+func (c *Config) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(c); errors.Is(err, io.EOF) {
+			err = nil // an empty file sets nothing
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports the first invalid or conflicting setting.
+func (c Config) Validate() error {
+	u, err := url.Parse(c.Server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("config: server %q must be an http or https URL", c.Server)
+	}
+	for _, s := range c.Servers {
+		if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("config: server %q must be an http or https URL", s)
+		}
+	}
+	switch c.Balancing {
+	case "", BalanceRoundRobin, BalanceLeastLatency:
+	default:
+		return fmt.Errorf("config: balancing %q must be %s or %s", c.Balancing, BalanceRoundRobin, BalanceLeastLatency)
+	}
+	if c.Timeout < 0 || c.Retry.BaseDelay < 0 || c.Retry.MaxDelay < 0 {
+		return errors.New("config: durations must not be negative")
+	}
+	if c.Retry.MaxAttempts < 0 {
+		return errors.New("config: retry max_attempts must not be negative")
+	}
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			return errors.New("config: proxy must be an http, https or socks5 URL")
+		}
+	}
+	switch c.Compression {
+	case "", CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("config: compression %q must be %s or %s", c.Compression, CompressionGzip, CompressionZstd)
+	}
+	switch c.Offline.Mode {
+	case "", OfflineAlways, OfflineFallback:
+	default:
+		return fmt.Errorf("config: offline mode %q must be %s or %s", c.Offline.Mode, OfflineAlways, OfflineFallback)
+	}
+	if c.Offline.Mode != "" && c.Offline.Dir == "" {
+		return errors.New("config: offline mode needs an offline dir")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("config: tls cert_file and key_file must be set together")
+	}
+
+	methods := 0
+	if c.Auth.APIKey != "" {
+		methods++
+	}
+	if c.Auth.BearerToken != "" {
+		methods++
+	}
+	if az := c.Auth.AzureAD; az != nil {
+		methods++
+		if az.TenantID == "" || az.ClientID == "" || az.ClientSecret == "" || az.Scope == "" {
+			return errors.New("config: azure_ad needs tenant_id, client_id, client_secret and scope")
+		}
+	}
+	if methods > 1 {
+		return errors.New("config: set only one of auth api_key, bearer_token and azure_ad")
+	}
+	return nil
+}
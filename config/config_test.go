@@ -0,0 +1,135 @@
+package config
+
+import (
+	"flag"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "mpc.yaml", `
+server: https://file.example.com
+default_agent: fileAgent
+timeout: 5s
+retry:
+  max_attempts: 2
+  base_delay: 100ms
+metadata:
+  team: red
+  user: ada
+`)
+	t.Setenv(EnvConfigFile, path)
+	t.Setenv("MPC_DEFAULT_AGENT", "envAgent")
+	t.Setenv("MPC_TIMEOUT", "10s")
+	t.Setenv("MPC_SERVERS", "https://a.example.com, https://b.example.com")
+	t.Setenv("MPC_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("MPC_METADATA", "team=blue, exercise=3")
+	t.Setenv("MPC_DRY_RUN", "1")
+	t.Setenv("MPC_COMPRESSION", "zstd")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-timeout", "15s", "-ca-file", "corp-ca.pem"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server != "https://file.example.com" {
+		t.Errorf("Server = %q, want the file's value", cfg.Server)
+	}
+	if !slices.Equal(cfg.Servers, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Errorf("Servers = %q, want the environment's list", cfg.Servers)
+	}
+	if cfg.DefaultAgent != "envAgent" {
+		t.Errorf("DefaultAgent = %q, want the environment's value", cfg.DefaultAgent)
+	}
+	if time.Duration(cfg.Timeout) != 15*time.Second {
+		t.Errorf("Timeout = %v, want the flag's value", time.Duration(cfg.Timeout))
+	}
+	if cfg.Retry.MaxAttempts != 2 || time.Duration(cfg.Retry.BaseDelay) != 100*time.Millisecond {
+		t.Errorf("Retry = %+v", cfg.Retry)
+	}
+	if cfg.TLS.CAFile != "corp-ca.pem" || !cfg.TLS.InsecureSkipVerify {
+		t.Errorf("TLS = %+v", cfg.TLS)
+	}
+	if !cfg.DryRun || cfg.Compression != CompressionZstd {
+		t.Errorf("DryRun = %v, Compression = %q, want the environment's values", cfg.DryRun, cfg.Compression)
+	}
+	if want := map[string]string{"team": "blue", "user": "ada", "exercise": "3"}; !maps.Equal(cfg.Metadata, want) {
+		t.Errorf("Metadata = %v, want the environment's labels over the file's: %v", cfg.Metadata, want)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != DefaultServer || time.Duration(cfg.Timeout) != DefaultTimeout {
+		t.Errorf("Load(nil) = %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadFileJSON(t *testing.T) {
+	path := writeFile(t, "mpc.json", `{"auth": {"azure_ad": {"tenant_id": "t", "client_id": "c", "client_secret": "s", "scope": "api://x/.default"}}}`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != DefaultServer || cfg.Auth.AzureAD == nil || cfg.Auth.AzureAD.TenantID != "t" {
+		t.Errorf("LoadFile = %+v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"unknown field", "mpc.yaml", "sever: http://x\n", "field sever not found"},
+		{"bad duration", "mpc.json", `{"timeout": "soon"}`, "invalid duration"},
+		{"bad server", "mpc.yaml", "server: localhost:8080\n", "must be an http or https URL"},
+		{"two auth methods", "mpc.yaml", "auth:\n  api_key: a\n  bearer_token: b\n", "only one"},
+		{"partial azure", "mpc.yaml", "auth:\n  azure_ad:\n    tenant_id: t\n", "azure_ad needs"},
+		{"bad servers", "mpc.yaml", "servers: [ftp://x]\n", "must be an http or https URL"},
+		{"bad balancing", "mpc.yaml", "balancing: random\n", "balancing \"random\""},
+		{"bad proxy", "mpc.yaml", "proxy: proxy.corp:3128\n", "proxy must be"},
+		{"cert without key", "mpc.yaml", "tls:\n  cert_file: client.pem\n", "set together"},
+		{"bad offline mode", "mpc.yaml", "offline:\n  dir: fixtures\n  mode: sometimes\n", "offline mode \"sometimes\""},
+		{"bad compression", "mpc.yaml", "compression: br\n", "compression \"br\""},
+		{"offline mode without dir", "mpc.yaml", "offline:\n  mode: fallback\n", "needs an offline dir"},
+	}
+	for _, tt := range tests {
+		_, err := LoadFile(writeFile(t, tt.file, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+
+	t.Setenv("MPC_METADATA", "team")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "not key=value") {
+		t.Errorf("bad metadata: err = %v", err)
+	}
+	t.Setenv("MPC_METADATA", "")
+
+	t.Setenv("MPC_RETRY_MAX_ATTEMPTS", "many")
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "$MPC_RETRY_MAX_ATTEMPTS") {
+		t.Errorf("bad environment value: err = %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+// Package config loads MPC client settings: the server URLs, default agent,
+// credentials, timeout, retry policy, proxy and TLS settings, and the
+// directory of canned responses for offline mode, and whether requests are
+// only printed in a dry run. Each setting is resolved
+// from, in increasing order of precedence:
+//
+//  1. the defaults returned by Default
+//  2. a YAML or JSON file, named by the -config flag or $MPC_CONFIG
+//  3. environment variables such as $MPC_SERVER
+//  4. flags registered with RegisterFlags and set on the command line
+//
+// A typical program registers the flags, parses them and builds a client:
+//
+//	config.RegisterFlags(flag.CommandLine)
+//	flag.Parse()
+//	cfg, err := config.Load(flag.CommandLine)
+//	if err != nil {
+//		return err
+//	}
+//	client, err := mpcclient.NewClientFromConfig(cfg)
+//
+// A file sets any subset of the fields, for example:
+//
+//	server: https://mpc.example.com
+//	servers: [https://mpc2.example.com]
+//	balancing: least_latency
+//	default_agent: azureVmMetricsAgent
+//	timeout: 30s
+//	auth:
+//	  api_key: s3cret
+//	retry:
+//	  max_attempts: 4
+//	  base_delay: 200ms
+//	proxy: http://proxy.corp.example.com:3128
+//	compression: zstd
+//	tls:
+//	  ca_file: /etc/ssl/corp-ca.pem
+//	offline:
+//	  dir: ./fixtures
+//	  mode: fallback
+//
+// The environment variables and flags are listed in Settings.
+package config
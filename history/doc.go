@@ -0,0 +1,19 @@
+// Package history records agent calls to a local SQLite file, so that
+// workshop participants can review and share what they asked during a
+// session. Open a store and attach it to a client as a call hook:
+//
+//	store, err := history.Open("history.db")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//	c, err := mpcclient.NewClient(url, mpcclient.WithCallHook(store.Hook(nil)))
+//
+// Every call and stream the client completes is then stored with its
+// agent, time, latency and token usage. List queries the store by agent,
+// time range and text, and Export writes the results as JSON Lines, CSV
+// or Markdown.
+//
+// Prompts are stored as the client's call hooks see them; configure the
+// client WithRedaction to keep secrets out of the file.
+package history
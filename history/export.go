@@ -0,0 +1,85 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats.
+const (
+	// FormatJSONL writes one JSON object per entry and line.
+	FormatJSONL = "jsonl"
+	// FormatCSV writes a header row and one row per entry.
+	FormatCSV = "csv"
+	// FormatMarkdown writes a document with a section per entry, for
+	// sharing.
+	FormatMarkdown = "markdown"
+)
+
+// Export writes entries to w in format, one of the Format constants.
+// Entries are written in the order given.
+func Export(w io.Writer, format string, entries []Entry) error {
+	switch format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		return exportCSV(w, entries)
+	case FormatMarkdown:
+		return exportMarkdown(w, entries)
+	default:
+		return fmt.Errorf("history: unknown export format %q", format)
+	}
+}
+
+func exportCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "agent", "prompt", "response", "error", "latency_ms", "prompt_tokens", "completion_tokens", "total_tokens", "request_id"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.Time.Format(time.RFC3339),
+			e.Agent,
+			e.Prompt,
+			e.Response,
+			e.Error,
+			strconv.FormatInt(e.Latency.Milliseconds(), 10),
+			strconv.Itoa(e.Usage.PromptTokens),
+			strconv.Itoa(e.Usage.CompletionTokens),
+			strconv.Itoa(e.Usage.TotalTokens),
+			e.RequestID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportMarkdown(w io.Writer, entries []Entry) error {
+	var b strings.Builder
+	b.WriteString("# Prompt history\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\n## %s · %s\n\n", e.Agent, e.Time.Format(time.RFC1123))
+		fmt.Fprintf(&b, "Latency: %s", e.Latency.Round(time.Millisecond))
+		if e.Usage.TotalTokens > 0 {
+			fmt.Fprintf(&b, "  \nTokens: %d", e.Usage.TotalTokens)
+		}
+		fmt.Fprintf(&b, "\n\n### Prompt\n\n%s\n", strings.TrimSpace(e.Prompt))
+		if e.Error != "" {
+			fmt.Fprintf(&b, "\n### Error\n\n%s\n", e.Error)
+		} else {
+			fmt.Fprintf(&b, "\n### Response\n\n%s\n", strings.TrimSpace(e.Response))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,275 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// schemaVersion is stored in the file's user_version. Files written by a
+// newer version are refused rather than misread.
+const schemaVersion = 1
+
+const schema = `
+CREATE TABLE IF NOT EXISTS exchanges (
+	id                INTEGER PRIMARY KEY,
+	time              INTEGER NOT NULL,
+	agent             TEXT    NOT NULL,
+	prompt            TEXT    NOT NULL,
+	response          TEXT    NOT NULL DEFAULT '',
+	error             TEXT    NOT NULL DEFAULT '',
+	streamed          INTEGER NOT NULL DEFAULT 0,
+	latency           INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	total_tokens      INTEGER NOT NULL DEFAULT 0,
+	request_id        TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS exchanges_time ON exchanges (time);
+CREATE INDEX IF NOT EXISTS exchanges_agent ON exchanges (agent, time);
+`
+
+// Entry is one recorded prompt and response.
+type Entry struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Agent  string    `json:"agent"`
+	Prompt string    `json:"prompt"`
+	// Response is the agent's result; it is empty for failed calls.
+	Response string `json:"response,omitempty"`
+	// Error is the failure message of a failed call.
+	Error     string          `json:"error,omitempty"`
+	Streamed  bool            `json:"streamed,omitempty"`
+	Latency   time.Duration   `json:"latency"`
+	Usage     mpcclient.Usage `json:"usage"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+// Query selects entries for List. Zero fields match everything.
+type Query struct {
+	Agent string
+	// Text matches entries whose prompt or response contains it, ignoring
+	// case.
+	Text string
+	// Since and Until bound the entries' times, Until exclusively.
+	Since, Until time.Time
+	// Limit caps the number of entries returned, the most recent first.
+	Limit int
+
+	// after, set by Entries, continues a listing after the entry of that
+	// time and ID.
+	after *entryKey
+}
+
+type entryKey struct{ time, id int64 }
+
+// Store is a history file. It is safe for concurrent use, including by
+// several processes sharing the file.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the history file at path, creating it and its directory if
+// they do not exist.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("history: path is required")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("history: %w", err)
+		}
+	}
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("history: open %s: %w", path, err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history: open %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("written by a newer version (schema %d)", version)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	_, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	return err
+}
+
+// Close closes the file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add records e and returns its ID. A zero Time is set to now.
+func (s *Store) Add(ctx context.Context, e Entry) (int64, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO exchanges
+		(time, agent, prompt, response, error, streamed, latency, prompt_tokens, completion_tokens, total_tokens, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UnixNano(), e.Agent, e.Prompt, e.Response, e.Error, e.Streamed, int64(e.Latency),
+		e.Usage.PromptTokens, e.Usage.CompletionTokens, e.Usage.Total(), e.RequestID)
+	if err != nil {
+		return 0, fmt.Errorf("history: add: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// Get returns the entry with the given ID.
+func (s *Store) Get(ctx context.Context, id int64) (*Entry, error) {
+	entries, err := s.query(ctx, "id = ?", []any{id}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("history: no entry %d", id)
+	}
+	return &entries[0], nil
+}
+
+// List returns the entries matching q, the most recent first.
+func (s *Store) List(ctx context.Context, q Query) ([]Entry, error) {
+	var where []string
+	var args []any
+	if q.Agent != "" {
+		where = append(where, "agent = ?")
+		args = append(args, q.Agent)
+	}
+	if q.Text != "" {
+		where = append(where, `(prompt LIKE ? ESCAPE '\' OR response LIKE ? ESCAPE '\')`)
+		pattern := "%" + likeEscaper.Replace(q.Text) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	if k := q.after; k != nil {
+		where = append(where, "(time < ? OR (time = ? AND id < ?))")
+		args = append(args, k.time, k.time, k.id)
+	}
+	return s.query(ctx, strings.Join(where, " AND "), args, q.Limit)
+}
+
+// DefaultPageSize is the page size of Entries when given none.
+const DefaultPageSize = 100
+
+// Entries returns an Iterator over the entries matching q, the most
+// recent first, reading pageSize of them at a time so that large files
+// need not be loaded whole. q.Limit is ignored. Entries added while
+// iterating are not visited.
+func (s *Store) Entries(q Query, pageSize int) *mpcclient.Iterator[Entry] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	q.Limit = pageSize
+	return mpcclient.NewIterator(func(ctx context.Context, cursor string) ([]Entry, string, error) {
+		q := q
+		if cursor != "" {
+			var k entryKey
+			if _, err := fmt.Sscanf(cursor, "%d/%d", &k.time, &k.id); err != nil {
+				return nil, "", fmt.Errorf("history: invalid cursor %q", cursor)
+			}
+			q.after = &k
+		}
+		entries, err := s.List(ctx, q)
+		if err != nil || len(entries) < pageSize {
+			return entries, "", err
+		}
+		last := entries[len(entries)-1]
+		return entries, fmt.Sprintf("%d/%d", last.Time.UnixNano(), last.ID), nil
+	})
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *Store) query(ctx context.Context, where string, args []any, limit int) ([]Entry, error) {
+	stmt := `SELECT id, time, agent, prompt, response, error, streamed, latency,
+		prompt_tokens, completion_tokens, total_tokens, request_id FROM exchanges`
+	if where != "" {
+		stmt += " WHERE " + where
+	}
+	stmt += " ORDER BY time DESC, id DESC"
+	if limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history: query: %w", err)
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var t, latency int64
+		if err := rows.Scan(&e.ID, &t, &e.Agent, &e.Prompt, &e.Response, &e.Error, &e.Streamed, &latency,
+			&e.Usage.PromptTokens, &e.Usage.CompletionTokens, &e.Usage.TotalTokens, &e.RequestID); err != nil {
+			return nil, fmt.Errorf("history: query: %w", err)
+		}
+		e.Time = time.Unix(0, t)
+		e.Latency = time.Duration(latency)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history: query: %w", err)
+	}
+	return entries, nil
+}
+
+// Hook returns a call hook recording every call into the store, for
+// mpcclient.WithCallHook. Failures to record are passed to onError, if
+// set, and do not affect the call.
+func (s *Store) Hook(onError func(error)) mpcclient.CallHook {
+	return func(ctx context.Context, ex mpcclient.Exchange) {
+		e := Entry{
+			Time:      ex.Start,
+			Agent:     ex.Agent,
+			Prompt:    ex.Prompt,
+			Streamed:  ex.Streamed,
+			Latency:   ex.Latency,
+			RequestID: ex.RequestID,
+		}
+		if ex.Err != nil {
+			e.Error = ex.Err.Error()
+		}
+		if r := ex.Response; r != nil {
+			e.Response = r.Text()
+			if r.Usage != nil {
+				e.Usage = *r.Usage
+			}
+		}
+		// Record even calls whose context was cancelled.
+		if _, err := s.Add(context.WithoutCancel(ctx), e); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
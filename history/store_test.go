@@ -0,0 +1,230 @@
+package history_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/history"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+func open(t *testing.T) *history.Store {
+	t.Helper()
+	s, err := history.Open(filepath.Join(t.TempDir(), "sub", "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreList(t *testing.T) {
+	s := open(t)
+	ctx := context.Background()
+	base := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	for i, e := range []history.Entry{
+		{Agent: "vm", Prompt: "Check CPU", Response: "CPU at 40%"},
+		{Agent: "docs", Prompt: "Document main.tf", Response: "## Inputs"},
+		{Agent: "vm", Prompt: "Check disk_usage", Error: "server returned 503"},
+	} {
+		e.Time = base.Add(time.Duration(i) * time.Hour)
+		e.Latency = 120 * time.Millisecond
+		e.Usage = mpcclient.Usage{PromptTokens: 10, CompletionTokens: 5}
+		if _, err := s.Add(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prompts := func(q history.Query) string {
+		t.Helper()
+		entries, err := s.List(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Prompt)
+		}
+		return strings.Join(out, "|")
+	}
+	for _, tc := range []struct {
+		q    history.Query
+		want string
+	}{
+		{history.Query{}, "Check disk_usage|Document main.tf|Check CPU"},
+		{history.Query{Agent: "vm"}, "Check disk_usage|Check CPU"},
+		{history.Query{Text: "cpu"}, "Check CPU"},
+		{history.Query{Text: "40%"}, "Check CPU"},
+		{history.Query{Text: "k_u"}, "Check disk_usage"},
+		{history.Query{Text: "%"}, "Check CPU"},
+		{history.Query{Since: base.Add(time.Hour)}, "Check disk_usage|Document main.tf"},
+		{history.Query{Until: base.Add(time.Hour)}, "Check CPU"},
+		{history.Query{Limit: 1}, "Check disk_usage"},
+	} {
+		if got := prompts(tc.q); got != tc.want {
+			t.Errorf("List(%+v) = %q, want %q", tc.q, got, tc.want)
+		}
+	}
+
+	e, err := s.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Time.Equal(base) || e.Latency != 120*time.Millisecond || e.Usage.TotalTokens != 15 || e.Response != "CPU at 40%" {
+		t.Errorf("Get(1) = %+v", e)
+	}
+	if _, err := s.Get(ctx, 42); err == nil {
+		t.Error("Get of a missing entry succeeded")
+	}
+}
+
+func TestStoreHook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.Error(w, `{"error":"no such agent"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Request-ID", "req-1")
+		w.Write([]byte(`{"agent":"vm","result":"all good","request_id":"req-1","usage":{"prompt_tokens":3,"completion_tokens":4}}`))
+	}))
+	defer srv.Close()
+
+	s := open(t)
+	c, err := mpcclient.NewClient(srv.URL, mpcclient.WithCallHook(s.Hook(func(err error) { t.Error(err) })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.CallAgent(ctx, "vm", "how are things?"); err != nil {
+		t.Fatal(err)
+	}
+	c.CallAgent(ctx, "missing", "hello")
+
+	entries, err := s.List(ctx, history.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(entries))
+	}
+	failed, ok := entries[0], entries[1]
+	if ok.Agent != "vm" || ok.Prompt != "how are things?" || ok.Response != "all good" || ok.RequestID != "req-1" ||
+		ok.Usage.TotalTokens != 7 || ok.Latency <= 0 || ok.Time.IsZero() {
+		t.Errorf("successful call recorded as %+v", ok)
+	}
+	if failed.Agent != "missing" || failed.Response != "" || !strings.Contains(failed.Error, "no such agent") {
+		t.Errorf("failed call recorded as %+v", failed)
+	}
+}
+
+func TestStoreRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	s, err := history.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("PRAGMA user_version = 99")
+	db.Close()
+	if _, err := history.Open(path); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Open = %v, want newer version error", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	entries := []history.Entry{
+		{ID: 1, Time: time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC), Agent: "vm", Prompt: "Check CPU", Response: "CPU at 40%",
+			Latency: 1500 * time.Millisecond, Usage: mpcclient.Usage{TotalTokens: 12}},
+		{ID: 2, Time: time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC), Agent: "vm", Prompt: "Check, \"disk\"", Error: "timeout"},
+	}
+
+	var b bytes.Buffer
+	if err := history.Export(&b, history.FormatJSONL, entries); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	var first history.Entry
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &first) != nil || first.Response != "CPU at 40%" {
+		t.Errorf("jsonl = %s", b.String())
+	}
+
+	b.Reset()
+	if err := history.Export(&b, history.FormatCSV, entries); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][3] != "prompt" || rows[2][3] != `Check, "disk"` || rows[1][6] != "1500" {
+		t.Errorf("csv = %q", rows)
+	}
+
+	b.Reset()
+	if err := history.Export(&b, history.FormatMarkdown, entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Prompt history", "## vm · Fri, 01 May 2026 09:00:00 UTC", "Tokens: 12",
+		"### Response\n\nCPU at 40%", "### Error\n\ntimeout"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("markdown lacks %q:\n%s", want, b.String())
+		}
+	}
+
+	if err := history.Export(&b, "xml", entries); err == nil {
+		t.Error("Export accepted an unknown format")
+	}
+}
+
+func TestStoreEntries(t *testing.T) {
+	s := open(t)
+	ctx := context.Background()
+	base := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	for i := range 8 {
+		agent := "vm"
+		if i%4 == 3 {
+			agent = "docs"
+		}
+		// Pairs of entries share a time, so pages must break ties by ID.
+		e := history.Entry{Time: base.Add(time.Duration(i/2) * time.Minute), Agent: agent, Prompt: "p" + string(rune('0'+i))}
+		if _, err := s.Add(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		q    history.Query
+		size int
+		want string
+	}{
+		{history.Query{}, 3, "p7 p6 p5 p4 p3 p2 p1 p0"},
+		{history.Query{Agent: "vm", Limit: 1}, 2, "p6 p5 p4 p2 p1 p0"},
+		{history.Query{Since: base.Add(2 * time.Minute)}, 0, "p7 p6 p5 p4"},
+	} {
+		it := s.Entries(tt.q, tt.size)
+		var got []string
+		for it.Next(ctx) {
+			got = append(got, it.Item().Prompt)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if g := strings.Join(got, " "); g != tt.want {
+			t.Errorf("Entries(%+v, %d) = %s, want %s", tt.q, tt.size, g, tt.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package mdterm renders Markdown, such as the replies of agents, for a
+// terminal as it arrives. A Writer takes text in chunks of any size, the
+// way a stream delivers it, and writes out each line as soon as its end
+// has arrived: headings and strong text in bold, emphasis in italics,
+// inline code in colour, fenced code blocks indented with their strings,
+// comments and keywords picked out, lists with bullets and hanging
+// indents, and paragraphs wrapped to the width of the terminal:
+//
+//	md := mdterm.NewWriter(os.Stdout, mdterm.WithWidth(100))
+//	_, err := client.StreamAgentTo(ctx, "onboardingAgent", prompt, md)
+//	md.Close()
+//
+// Close writes the last line when the text does not end with a newline.
+// WithPlain keeps the layout but leaves out the ANSI escapes, for
+// terminals without colour or users who set NO_COLOR.
+//
+// Rendering works a line at a time, so lines of a paragraph are wrapped
+// one by one rather than joined, and tables are written as they are.
+package mdterm
@@ -0,0 +1,493 @@
+package mdterm
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// style is a set of text attributes.
+type style uint8
+
+const (
+	styleBold style = 1 << iota
+	styleDim
+	styleItalic
+	styleUnderline
+	styleCode
+	styleString
+	styleKeyword
+)
+
+// sgrCodes are the SGR parameters of each style, in the order of the bits.
+var sgrCodes = []string{"1", "2", "3", "4", "36", "32", "35"}
+
+// sgr returns the escape sequence switching to s.
+func (s style) sgr() string {
+	var codes []string
+	for i, code := range sgrCodes {
+		if s&(1<<i) != 0 {
+			codes = append(codes, code)
+		}
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+const reset = "\x1b[0m"
+
+// span is a run of text in one style.
+type span struct {
+	text  string
+	style style
+}
+
+// Layout settings.
+const (
+	codeIndent = "  "
+	// ruleWidth is the width of horizontal rules when lines are not wrapped.
+	ruleWidth = 40
+)
+
+var (
+	fenceRE   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	ruleRE    = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	headingRE = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*)$`)
+	quoteRE   = regexp.MustCompile(`^ {0,3}>[ \t]?(.*)$`)
+	listRE    = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])[ \t]+(.*)$`)
+	linkRE    = regexp.MustCompile(`^\[([^\]]*)\]\(([^)\s]*)\)`)
+)
+
+// keywords are the words picked out in code blocks, common to the
+// languages agents answer in.
+var keywords = map[string]bool{
+	"break": true, "case": true, "class": true, "const": true, "continue": true, "def": true,
+	"default": true, "defer": true, "elif": true, "else": true, "false": true, "fn": true,
+	"for": true, "from": true, "func": true, "function": true, "go": true, "if": true,
+	"import": true, "in": true, "let": true, "nil": true, "None": true, "null": true,
+	"package": true, "range": true, "resource": true, "return": true, "struct": true,
+	"switch": true, "then": true, "true": true, "True": true, "False": true, "type": true,
+	"var": true, "variable": true, "while": true,
+}
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// WithWidth wraps lines at width columns. Lists and quotes keep their
+// indent on the lines they wrap onto. The default, zero, does not wrap.
+func WithWidth(width int) Option {
+	return func(md *Writer) {
+		md.width = width
+	}
+}
+
+// WithPlain leaves out the ANSI escapes, writing the text without its
+// markup but laid out as it would be with them.
+func WithPlain() Option {
+	return func(md *Writer) {
+		md.plain = true
+	}
+}
+
+// Writer renders the Markdown written to it onto an underlying writer, a
+// line at a time. It is not safe for concurrent use.
+type Writer struct {
+	w     io.Writer
+	width int
+	plain bool
+	// line is the text after the last newline written.
+	line []byte
+	// fence is the marker that opened the code block the text is in, if
+	// any.
+	fence string
+	// err is the first error writing to w.
+	err error
+}
+
+// NewWriter returns a Writer rendering onto w.
+func NewWriter(w io.Writer, opts ...Option) *Writer {
+	md := &Writer{w: w}
+	for _, opt := range opts {
+		opt(md)
+	}
+	return md
+}
+
+// Write renders the lines p completes and holds back the text after the
+// last newline. Once writing to the underlying writer has failed, every
+// call returns that error.
+func (md *Writer) Write(p []byte) (int, error) {
+	if md.err != nil {
+		return 0, md.err
+	}
+	md.line = append(md.line, p...)
+	var out strings.Builder
+	rest := md.line
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+		md.render(&out, string(rest[:i]))
+		rest = rest[i+1:]
+	}
+	md.line = append(md.line[:0], rest...)
+	if err := md.flush(&out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close renders the text held back, ending it with a newline, and ends
+// the document, so that text written afterwards starts outside any code
+// block. It does not close the underlying writer.
+func (md *Writer) Close() error {
+	if md.err != nil {
+		return md.err
+	}
+	var out strings.Builder
+	if len(md.line) > 0 {
+		md.render(&out, string(md.line))
+		md.line = md.line[:0]
+	}
+	md.fence = ""
+	return md.flush(&out)
+}
+
+func (md *Writer) flush(out *strings.Builder) error {
+	if out.Len() == 0 {
+		return nil
+	}
+	if _, err := io.WriteString(md.w, out.String()); err != nil {
+		md.err = err
+		return err
+	}
+	return nil
+}
+
+// render writes the rendering of one line, without its newline, to out.
+func (md *Writer) render(out *strings.Builder, line string) {
+	line = strings.TrimSuffix(line, "\r")
+	trimmed := strings.TrimSpace(line)
+	if md.fence != "" {
+		if strings.HasPrefix(trimmed, md.fence) && strings.TrimLeft(trimmed, md.fence[:1]) == "" {
+			md.fence = ""
+			return
+		}
+		md.code(out, line)
+		return
+	}
+	if m := fenceRE.FindStringSubmatch(line); m != nil {
+		md.fence = m[1]
+		return
+	}
+
+	switch {
+	case trimmed == "":
+		out.WriteString("\n")
+	case strings.HasPrefix(trimmed, "|"):
+		// Wrapping or restyling a table would break its columns.
+		out.WriteString(line + "\n")
+	case ruleRE.MatchString(trimmed):
+		n := md.width
+		if n <= 0 {
+			n = ruleWidth
+		}
+		md.put(out, span{strings.Repeat("─", n), styleDim})
+		out.WriteString("\n")
+	default:
+		if m := headingRE.FindStringSubmatch(line); m != nil {
+			md.heading(out, len(m[1]), m[2])
+			return
+		}
+		if m := quoteRE.FindStringSubmatch(line); m != nil {
+			bar := span{"│ ", styleDim}
+			if md.plain {
+				bar.text = "> "
+			}
+			md.wrap(out, bar, bar, inline(m[1], 0))
+			return
+		}
+		if m := listRE.FindStringSubmatch(line); m != nil {
+			bullet := m[2]
+			if !isDigit(bullet[0]) {
+				bullet = "•"
+			}
+			first := span{m[1] + bullet + " ", 0}
+			rest := span{m[1] + strings.Repeat(" ", width(bullet)+1), 0}
+			md.wrap(out, first, rest, inline(m[3], 0))
+			return
+		}
+		indent := span{line[:len(line)-len(strings.TrimLeft(line, " \t"))], 0}
+		md.wrap(out, indent, indent, inline(trimmed, 0))
+	}
+}
+
+// heading writes a heading of the given level. Without escapes, the top
+// two levels are underlined with a row of = or -.
+func (md *Writer) heading(out *strings.Builder, level int, text string) {
+	base := styleBold
+	if level == 1 {
+		base |= styleUnderline
+	}
+	spans := inline(strings.TrimSpace(text), base)
+	md.wrap(out, span{}, span{}, spans)
+	if !md.plain || level > 2 {
+		return
+	}
+	n := 0
+	for _, s := range spans {
+		n += width(s.text)
+	}
+	if md.width > 0 {
+		n = min(n, md.width)
+	}
+	mark := "="
+	if level == 2 {
+		mark = "-"
+	}
+	out.WriteString(strings.Repeat(mark, n) + "\n")
+}
+
+// code writes a line of a fenced code block, indented and with its
+// strings, comments and keywords picked out. Code is never wrapped.
+func (md *Writer) code(out *strings.Builder, line string) {
+	out.WriteString(codeIndent)
+	if md.plain {
+		out.WriteString(line + "\n")
+		return
+	}
+	for _, s := range highlight(line) {
+		md.put(out, s)
+	}
+	out.WriteString("\n")
+}
+
+// wrap writes spans word by word after the prefix first, starting a new
+// line after the prefix rest whenever the next word would overrun the
+// width. Words longer than the width get a line of their own.
+func (md *Writer) wrap(out *strings.Builder, first, rest span, spans []span) {
+	md.put(out, first)
+	col, n := width(first.text), 0
+	for _, w := range words(spans) {
+		ww := 0
+		for _, s := range w {
+			ww += width(s.text)
+		}
+		if n > 0 && md.width > 0 && col+1+ww > md.width {
+			out.WriteString("\n")
+			md.put(out, rest)
+			col, n = width(rest.text), 0
+		}
+		if n > 0 {
+			out.WriteString(" ")
+			col++
+		}
+		for _, s := range w {
+			md.put(out, s)
+		}
+		col += ww
+		n++
+	}
+	out.WriteString("\n")
+}
+
+// put writes s to out in its style.
+func (md *Writer) put(out *strings.Builder, s span) {
+	if md.plain || s.style == 0 || s.text == "" {
+		out.WriteString(s.text)
+		return
+	}
+	out.WriteString(s.style.sgr() + s.text + reset)
+}
+
+// inline parses the emphasis, code spans and links of text, in base
+// style. Markers that are not closed on the line are kept as text.
+func inline(text string, base style) []span {
+	var (
+		spans []span
+		cur   strings.Builder
+		st    = base
+		// open holds the styles opened by markers in text.
+		open style
+	)
+	emit := func() {
+		if cur.Len() > 0 {
+			spans = append(spans, span{cur.String(), st})
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && unicode.IsPunct(rune(text[i+1])):
+			cur.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			marker := text[i : i+n]
+			j := strings.Index(text[i+n:], marker)
+			if j < 0 {
+				cur.WriteString(marker)
+				i += n
+				continue
+			}
+			code := text[i+n : i+n+j]
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			emit()
+			spans = append(spans, span{code, st | styleCode})
+			i += n + j + n
+			continue
+		case c == '*' || c == '_':
+			n := 1
+			if i+1 < len(text) && text[i+1] == c {
+				n = 2
+			}
+			marker, flag := text[i:i+n], styleItalic
+			if n == 2 {
+				flag = styleBold
+			}
+			switch {
+			case open&flag != 0:
+				emit()
+				open &^= flag
+				st = st&^flag | base&flag
+			case opens(text, i, n) && strings.Contains(text[i+n:], marker):
+				emit()
+				open |= flag
+				st |= flag
+			default:
+				cur.WriteString(marker)
+			}
+			i += n
+			continue
+		case c == '[':
+			if m := linkRE.FindStringSubmatch(text[i:]); m != nil {
+				emit()
+				spans = append(spans, inline(m[1], st|styleUnderline)...)
+				if m[2] != m[1] {
+					spans = append(spans, span{" (" + m[2] + ")", st | styleDim})
+				}
+				i += len(m[0])
+				continue
+			}
+		}
+		cur.WriteByte(c)
+		i++
+	}
+	emit()
+	return spans
+}
+
+// opens reports whether the n-character emphasis marker at text[i] can
+// open emphasis: it must be followed by text, and underscores must not be
+// inside a word, as in snake_case.
+func opens(text string, i, n int) bool {
+	if i+n >= len(text) || text[i+n] == ' ' || text[i+n] == '\t' {
+		return false
+	}
+	if text[i] == '_' && i > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:i])
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	return true
+}
+
+// words splits spans into words at the spaces outside code spans.
+func words(spans []span) [][]span {
+	var ws [][]span
+	var cur []span
+	for _, s := range spans {
+		if s.style&styleCode != 0 {
+			cur = append(cur, s)
+			continue
+		}
+		for s.text != "" {
+			i := strings.IndexFunc(s.text, unicode.IsSpace)
+			if i < 0 {
+				cur = append(cur, s)
+				break
+			}
+			if i > 0 {
+				cur = append(cur, span{s.text[:i], s.style})
+			}
+			if len(cur) > 0 {
+				ws = append(ws, cur)
+				cur = nil
+			}
+			_, size := utf8.DecodeRuneInString(s.text[i:])
+			s.text = s.text[i+size:]
+		}
+	}
+	if len(cur) > 0 {
+		ws = append(ws, cur)
+	}
+	return ws
+}
+
+// highlight splits a line of code into spans picking out comments,
+// strings and keywords.
+func highlight(line string) []span {
+	var spans []span
+	from := 0 // start of the code not yet in a span
+	text := func(end int) {
+		if end > from {
+			spans = append(spans, span{line[from:end], styleCode})
+		}
+	}
+	for i := 0; i < len(line); {
+		c := line[i]
+		atSpace := i == 0 || line[i-1] == ' ' || line[i-1] == '\t'
+		switch {
+		case atSpace && (c == '#' || strings.HasPrefix(line[i:], "//")):
+			text(i)
+			return append(spans, span{line[i:], styleDim})
+		case c == '"' || c == '\'' || c == '`':
+			j := i + 1
+			for j < len(line) && line[j] != c {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(line))
+			text(i)
+			spans = append(spans, span{line[i:j], styleString})
+			i, from = j, j
+			continue
+		case isIdent(c) && !isDigit(c):
+			j := i
+			for j < len(line) && isIdent(line[j]) {
+				j++
+			}
+			if keywords[line[i:j]] {
+				text(i)
+				spans = append(spans, span{line[i:j], styleKeyword})
+				from = j
+			}
+			i = j
+			continue
+		}
+		i++
+	}
+	text(len(line))
+	return spans
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// width returns the number of columns s takes up.
+func width(s string) int {
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,120 @@
+package mdterm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// render renders doc in one write.
+func render(t *testing.T, doc string, opts ...Option) string {
+	t.Helper()
+	var out bytes.Buffer
+	md := NewWriter(&out, opts...)
+	if _, err := md.Write([]byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := md.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestPlain(t *testing.T) {
+	for _, tc := range []struct{ name, in, want string }{
+		{"emphasis", "Use **bold**, *italic*, `go vet` and snake_case_names.", "Use bold, italic, go vet and snake_case_names.\n"},
+		{"unclosed", "2 * 3 = 6 and **almost", "2 * 3 = 6 and **almost\n"},
+		{"escape", `\*not italic\*`, "*not italic*\n"},
+		{"link", "See [the docs](https://example.com/docs).", "See the docs (https://example.com/docs).\n"},
+		{"headings", "# Overview\n## Steps\n### Detail", "Overview\n========\nSteps\n-----\nDetail\n"},
+		{"lists", "- one\n* two\n  + nested\n3. three", "• one\n• two\n  • nested\n3. three\n"},
+		{"quote", "> careful", "> careful\n"},
+		{"code", "```go\nx := \"a\" // b\n```\nafter", "  x := \"a\" // b\nafter\n"},
+		{"rule", "---", strings.Repeat("─", ruleWidth) + "\n"},
+		{"table", "| a | **b** |", "| a | **b** |\n"},
+	} {
+		if got := render(t, tc.in, WithPlain()); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	in := "- a list item long enough to wrap onto a second line\n> quoted text long enough to wrap as well\nplain text `code span stays whole` here"
+	want := "• a list item long enough to\n" +
+		"  wrap onto a second line\n" +
+		"> quoted text long enough to\n" +
+		"> wrap as well\n" +
+		"plain text\n" +
+		"code span stays whole here\n"
+	if got := render(t, in, WithPlain(), WithWidth(28)); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := render(t, "```\n"+strings.Repeat("x", 40)+"\n```", WithPlain(), WithWidth(10)); got != codeIndent+strings.Repeat("x", 40)+"\n" {
+		t.Errorf("code was wrapped: %q", got)
+	}
+}
+
+func TestStyles(t *testing.T) {
+	got := render(t, "# Title\nsome **bold** and `code`\n```\nif x { return \"y\" } # note\n```")
+	for _, want := range []string{
+		"\x1b[1;4mTitle" + reset,
+		"\x1b[1mbold" + reset,
+		"\x1b[36mcode" + reset,
+		"\x1b[35mif" + reset,
+		"\x1b[32m\"y\"" + reset,
+		"\x1b[2m# note" + reset,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%q", want, got)
+		}
+	}
+	if strings.Contains(got, "**") || strings.Contains(got, "```") {
+		t.Errorf("markup left in %q", got)
+	}
+}
+
+func TestStreamed(t *testing.T) {
+	doc := "# Plan\n1. check **CPU** usage\n```sh\necho 'hi'\n```\ndone"
+	want := render(t, doc, WithWidth(20))
+
+	var out bytes.Buffer
+	md := NewWriter(&out, WithWidth(20))
+	for i := range len(doc) {
+		md.Write([]byte(doc[i : i+1]))
+		if i == strings.Index(doc, "usage")+2 && strings.Contains(out.String(), "CPU") {
+			t.Error("a partial line was written")
+		}
+	}
+	md.Close()
+	if out.String() != want {
+		t.Errorf("streamed %q, want %q", out.String(), want)
+	}
+
+	// A document left inside a code block does not leak into the next.
+	out.Reset()
+	md.Write([]byte("```\nopen"))
+	md.Close()
+	md.Write([]byte("**after**\n"))
+	if !strings.HasSuffix(out.String(), "\x1b[1mafter"+reset+"\n") {
+		t.Errorf("after Close: %q", out.String())
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("closed pipe") }
+
+func TestWriteError(t *testing.T) {
+	md := NewWriter(failWriter{})
+	if _, err := md.Write([]byte("held back")); err != nil {
+		t.Errorf("partial line: %v", err)
+	}
+	if _, err := md.Write([]byte("\n")); err == nil {
+		t.Error("no error from the failed write")
+	}
+	if err := md.Close(); err == nil {
+		t.Error("Close forgot the error")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Clock tells the time and waits. The processor and the simulated work
+// take one so that tests and workshops can run them on a fake clock and
+// get the same timings every run.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the real clock.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SimulatedWork stands in for per-item work such as a network call, taking
+// Base plus a random share of Jitter per item. The extra time is drawn
+// from Seed and the item alone, so a seed gives the same latencies
+// whatever order the workers pick items up in.
+type SimulatedWork struct {
+	Seed   uint64
+	Base   time.Duration
+	Jitter time.Duration
+	// Clock waits out the latencies; SystemClock when nil.
+	Clock Clock
+}
+
+// Latency returns how long the work on item x takes.
+func (w SimulatedWork) Latency(x int) time.Duration {
+	if w.Jitter <= 0 {
+		return w.Base
+	}
+	rnd := rand.New(rand.NewPCG(w.Seed, uint64(x)))
+	return w.Base + time.Duration(rnd.Int64N(int64(w.Jitter)))
+}
+
+// Square is Square after the item's latency, giving up when ctx is
+// cancelled.
+func (w SimulatedWork) Square(ctx context.Context, x int) (int, error) {
+	clock := w.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	select {
+	case <-clock.After(w.Latency(x)):
+		return Square(ctx, x)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
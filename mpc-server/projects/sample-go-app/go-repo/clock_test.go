@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestSimulatedWorkLatency(t *testing.T) {
+	w := SimulatedWork{Seed: 7, Base: 75 * time.Millisecond, Jitter: 50 * time.Millisecond}
+	other := w
+	other.Seed = 8
+	same := 0
+	for x := range 20 {
+		d := w.Latency(x)
+		if d < w.Base || d >= w.Base+w.Jitter {
+			t.Errorf("latency of %d = %v, outside [75ms, 125ms)", x, d)
+		}
+		if d != w.Latency(x) {
+			t.Errorf("latency of %d changed between draws", x)
+		}
+		if d == other.Latency(x) {
+			same++
+		}
+	}
+	if same == 20 {
+		t.Error("seeds 7 and 8 gave the same latencies")
+	}
+	if d := (SimulatedWork{Base: time.Second}).Latency(3); d != time.Second {
+		t.Errorf("latency without jitter = %v", d)
+	}
+}
+
+// schedule returns when each item finishes if workers take items in order
+// as soon as they are free, as both bounded implementations do.
+func schedule(latencies []time.Duration, workers int) []time.Duration {
+	free := make([]time.Duration, workers)
+	finish := make([]time.Duration, len(latencies))
+	for i, d := range latencies {
+		w := slices.Index(free, slices.Min(free))
+		free[w] += d
+		finish[i] = free[w]
+	}
+	return finish
+}
+
+// TestProcessDeterministic runs the processor on simulated work under a
+// fake clock, where the scheduling, and so which items beat a deadline,
+// follows from the seed alone.
+func TestProcessDeterministic(t *testing.T) {
+	data := benchmarkInput(12)
+	for _, tc := range []struct {
+		name     string
+		impl     int
+		workers  int
+		seed     uint64
+		deadline time.Duration
+	}{
+		{"pool/1 worker", 0, 1, 1, 0},
+		{"pool/3 workers", 0, 3, 2, 0},
+		{"pool/deadline", 0, 3, 3, 250 * time.Millisecond},
+		{"errgroup/4 workers", 1, 4, 4, 0},
+		{"errgroup/deadline", 1, 2, 5, 330 * time.Millisecond},
+		{"unbounded", 2, 0, 6, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				work := SimulatedWork{Seed: tc.seed, Base: 75 * time.Millisecond, Jitter: 50 * time.Millisecond}
+				latencies := make([]time.Duration, len(data))
+				for i, x := range data {
+					latencies[i] = work.Latency(x)
+				}
+				workers := tc.workers
+				if workers == 0 {
+					workers = len(data)
+				}
+				finish := schedule(latencies, workers)
+
+				ctx := context.Background()
+				if tc.deadline > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tc.deadline)
+					defer cancel()
+				}
+				p := NewDataProcessor(data, work.Square)
+				p.Workers = tc.workers
+				var last Progress
+				p.OnProgress = func(pr Progress) { last = pr }
+				start := time.Now()
+				results, err := implementations[tc.impl].run(p, ctx)
+				elapsed := time.Since(start)
+
+				var want []int
+				end := slices.Max(finish)
+				for i, f := range finish {
+					if tc.deadline == 0 || f < tc.deadline {
+						want = append(want, data[i]*data[i])
+					}
+				}
+				if tc.deadline > 0 {
+					end = tc.deadline
+					if !errors.Is(err, context.DeadlineExceeded) {
+						t.Errorf("err = %v, want the deadline", err)
+					}
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if got := Values(results); !slices.Equal(got, want) {
+					t.Errorf("finished %v, want %v", got, want)
+				}
+				if elapsed != end {
+					t.Errorf("took %v, want %v", elapsed, end)
+				}
+				if tc.impl < 2 && last.Elapsed > end {
+					t.Errorf("last progress at %v, after the run ended at %v", last.Elapsed, end)
+				}
+			})
+		})
+	}
+}
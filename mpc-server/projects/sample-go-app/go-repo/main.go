@@ -2,32 +2,100 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"sync"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strconv"
 	"time"
 )
 
-type DataProcessor struct {
-	data []int
+func parseInt(_ context.Context, s string) (int, error) {
+	return strconv.Atoi(s)
 }
 
-func (p *DataProcessor) Process() []int {
-	var wg sync.WaitGroup
-	results := make([]int, len(p.data))
-	for i, x := range p.data {
-		wg.Add(1)
-		go func(i, x int) {
-			defer wg.Done()
-			time.Sleep(100 * time.Millisecond)
-			results[i] = x * x
-		}(i, x)
+func main() {
+	seed := flag.Uint64("seed", 0, "seed for the simulated latencies, to reproduce a run; 0 picks one at random")
+	flag.Parse()
+
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL")))
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	// Each item takes 75-125ms, as drawn from the seed; the same seed
+	// gives the same latencies, and so the same output, every run.
+	if *seed == 0 {
+		*seed = rand.Uint64()
 	}
-	wg.Wait()
-	return results
-}
+	logger.Info("simulating work", "seed", *seed)
+	work := SimulatedWork{Seed: *seed, Base: 75 * time.Millisecond, Jitter: 50 * time.Millisecond}
+	slowSquare := work.Square
 
-func main() {
-	processor := DataProcessor{data: []int{1, 2, 3, 4, 5}}
-	results := processor.Process()
-	fmt.Printf("Squared results: %v\n", results)
+	// Ctrl-C cancels the run: unstarted items are skipped and the results
+	// finished so far are still returned.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	processor := NewDataProcessor([]int{1, 2, 3, 4, 5}, slowSquare)
+	processor.Workers = 3
+	processor.OnProgress = func(p Progress) {
+		logger.Debug("progress", "done", p.Done, "total", p.Total, "failed", p.Failed, "elapsed", p.Elapsed)
+	}
+	start := time.Now()
+	results, err := processor.Process(ctx)
+	if err != nil {
+		logger.Error("square batch failed", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("processed batch", "items", len(results), "workers", processor.Workers, "latency", time.Since(start))
+	fmt.Printf("Squared results: %v\n", Values(results))
+
+	// The same processor type works for any input and output types.
+	labels := NewDataProcessor([]string{"go", "copilot"}, func(_ context.Context, s string) (int, error) {
+		return len(s), nil
+	})
+	lengths, err := labels.Process(context.Background())
+	if err != nil {
+		logger.Error("length batch failed", "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Word lengths: %v\n", Values(lengths))
+
+	// Failures are reported per item; the rest of the batch still succeeds.
+	parsed, err := NewDataProcessor([]string{"1", "two", "3"}, parseInt).Process(context.Background())
+	if err != nil {
+		logger.Warn("some items failed to parse", "error", err)
+	}
+	fmt.Printf("Parsed: %v, errors: %v\n", Values(parsed), err)
+
+	// A panicking transform fails only its own item.
+	checked, err := NewDataProcessor([]int{4, 0, 2}, func(_ context.Context, x int) (int, error) {
+		return 100 / x, nil
+	}).Process(context.Background())
+	fmt.Printf("Divided: %v, errors: %v\n", Values(checked), err)
+
+	// Stages can also be chained into a pipeline, each running concurrently
+	// and holding back the one before it when it falls behind.
+	evens := NewPipeline([]int{1, 2, 3, 4, 5, 6, 7, 8}).
+		Map(Square).
+		Filter(func(x int) bool { return x%2 == 0 })
+	sums, err := MapTo(Batch(evens, 2), func(_ context.Context, b []int) (int, error) {
+		return b[0] + b[len(b)-1], nil
+	}).Collect(ctx)
+	if err != nil {
+		logger.Error("pipeline failed", "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Pairwise sums of even squares: %v\n", sums)
+
+	// A deadline stops a long run part way through.
+	ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	long := NewDataProcessor([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, slowSquare)
+	long.Workers = 2
+	partial, err := long.Process(ctx)
+	fmt.Printf("Before the deadline: %v (%d of %d), error: %v\n", Values(partial), len(Values(partial)), len(partial), err)
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Pipeline is a chain of stages, each running in its own goroutine and
+// connected to the next by an unbuffered channel. A slow stage therefore
+// holds back the ones before it instead of letting items pile up in
+// memory. Nothing runs until a terminal operation such as Collect or
+// Reduce; the first stage error, or cancelling the context, stops every
+// stage.
+//
+// Stages that keep the element type are methods, so they chain:
+//
+//	NewPipeline(data).Map(f).Filter(keep)
+//
+// Go methods cannot introduce type parameters, so stages that change it,
+// such as MapTo and Batch, and the terminal Reduce, are functions:
+//
+//	batches := Batch(NewPipeline(data).Map(f).Filter(keep), 10)
+//	total, err := Reduce(ctx, batches, 0, sumBatch)
+type Pipeline[T any] struct {
+	start func(r *run) <-chan T
+}
+
+// run is one execution of a pipeline, shared by all of its stages.
+type run struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+}
+
+// stage runs f in its own goroutine as part of r.
+func (r *run) stage(f func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		f()
+	}()
+}
+
+// send delivers v on out, or reports false once the run is stopping.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// NewPipeline returns a pipeline whose source emits items in order.
+func NewPipeline[T any](items []T) *Pipeline[T] {
+	return &Pipeline[T]{start: func(r *run) <-chan T {
+		out := make(chan T)
+		r.stage(func() {
+			defer close(out)
+			for _, v := range items {
+				if !send(r.ctx, out, v) {
+					return
+				}
+			}
+		})
+		return out
+	}}
+}
+
+// FromChannel returns a pipeline whose source emits the values received
+// from in until it is closed.
+func FromChannel[T any](in <-chan T) *Pipeline[T] {
+	return &Pipeline[T]{start: func(r *run) <-chan T {
+		out := make(chan T)
+		r.stage(func() {
+			defer close(out)
+			for {
+				select {
+				case v, ok := <-in:
+					if !ok || !send(r.ctx, out, v) {
+						return
+					}
+				case <-r.ctx.Done():
+					return
+				}
+			}
+		})
+		return out
+	}}
+}
+
+// Map adds a stage applying f to each item. An error from f stops the
+// pipeline.
+func (p *Pipeline[T]) Map(f func(ctx context.Context, item T) (T, error)) *Pipeline[T] {
+	return MapTo(p, f)
+}
+
+// Filter adds a stage passing on only the items keep returns true for.
+func (p *Pipeline[T]) Filter(keep func(item T) bool) *Pipeline[T] {
+	return &Pipeline[T]{start: func(r *run) <-chan T {
+		in := p.start(r)
+		out := make(chan T)
+		r.stage(func() {
+			defer close(out)
+			for v := range in {
+				if keep(v) && !send(r.ctx, out, v) {
+					return
+				}
+			}
+		})
+		return out
+	}}
+}
+
+// Collect runs the pipeline and returns every item reaching its end.
+func (p *Pipeline[T]) Collect(ctx context.Context) ([]T, error) {
+	return Reduce(ctx, p, []T(nil), func(acc []T, v T) []T { return append(acc, v) })
+}
+
+// MapTo adds a stage converting each item with f. An error from f stops
+// the pipeline.
+func MapTo[T, R any](p *Pipeline[T], f func(ctx context.Context, item T) (R, error)) *Pipeline[R] {
+	return &Pipeline[R]{start: func(r *run) <-chan R {
+		in := p.start(r)
+		out := make(chan R)
+		r.stage(func() {
+			defer close(out)
+			for v := range in {
+				res, err := f(r.ctx, v)
+				if err != nil {
+					r.cancel(err)
+					return
+				}
+				if !send(r.ctx, out, res) {
+					return
+				}
+			}
+		})
+		return out
+	}}
+}
+
+// Batch adds a stage grouping items into slices of n. The last batch holds
+// the remainder and may be shorter. n less than 1 is treated as 1.
+func Batch[T any](p *Pipeline[T], n int) *Pipeline[[]T] {
+	n = max(n, 1)
+	return &Pipeline[[]T]{start: func(r *run) <-chan []T {
+		in := p.start(r)
+		out := make(chan []T)
+		r.stage(func() {
+			defer close(out)
+			batch := make([]T, 0, n)
+			for v := range in {
+				if batch = append(batch, v); len(batch) == n {
+					if !send(r.ctx, out, batch) {
+						return
+					}
+					batch = make([]T, 0, n)
+				}
+			}
+			if len(batch) > 0 && r.ctx.Err() == nil {
+				send(r.ctx, out, batch)
+			}
+		})
+		return out
+	}}
+}
+
+// Reduce runs the pipeline, folding every item reaching its end into an
+// accumulator starting at init. It returns once all stages have stopped,
+// with the first stage error or ctx's error if the run did not complete.
+func Reduce[T, A any](ctx context.Context, p *Pipeline[T], init A, fn func(acc A, item T) A) (A, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	r := &run{ctx: ctx, cancel: cancel}
+
+	acc := init
+	for v := range p.start(r) {
+		acc = fn(acc, v)
+	}
+	r.wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		var zero A
+		return zero, err
+	}
+	return acc, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	evens := NewPipeline([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}).
+		Map(Square).
+		Filter(func(x int) bool { return x%2 == 0 })
+	batches, err := Batch(evens, 2).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{4, 16}, {36, 64}, {100}}
+	if !slices.EqualFunc(batches, want, slices.Equal) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+
+	sum, err := Reduce(context.Background(), Batch(evens, 2), 0, func(acc int, b []int) int {
+		for _, x := range b {
+			acc += x
+		}
+		return acc
+	})
+	if err != nil || sum != 220 {
+		t.Errorf("sum = %d, %v, want 220", sum, err)
+	}
+}
+
+func TestPipelineMapTo(t *testing.T) {
+	got, err := MapTo(NewPipeline([]string{"go", "copilot"}), func(_ context.Context, s string) (int, error) {
+		return len(s), nil
+	}).Collect(context.Background())
+	if err != nil || !slices.Equal(got, []int{2, 7}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestPipelineStopsOnError(t *testing.T) {
+	var mapped atomic.Int32
+	_, err := MapTo(NewPipeline([]string{"1", "2", "x", "4", "5", "6"}), func(ctx context.Context, s string) (int, error) {
+		mapped.Add(1)
+		return parseInt(ctx, s)
+	}).Collect(context.Background())
+	if err == nil || mapped.Load() != 3 {
+		t.Errorf("err = %v after %d items, want a parse error after 3", err, mapped.Load())
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	var produced, consumed, maxLead atomic.Int32
+	p := NewPipeline(make([]int, 20)).Map(func(_ context.Context, x int) (int, error) {
+		lead := produced.Add(1) - consumed.Load()
+		if lead > maxLead.Load() {
+			maxLead.Store(lead)
+		}
+		return x, nil
+	})
+	Reduce(context.Background(), p, 0, func(acc, x int) int {
+		time.Sleep(time.Millisecond)
+		consumed.Add(1)
+		return acc + x
+	})
+	// One item in the consumer, one blocked in the map stage and one
+	// already mapped but not yet handed over.
+	if maxLead.Load() > 3 {
+		t.Errorf("producer ran %d items ahead of a slow consumer", maxLead.Load())
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	in := make(chan int) // never closed
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case in <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	_, err := FromChannel(in).Filter(func(int) bool { return false }).Collect(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+}
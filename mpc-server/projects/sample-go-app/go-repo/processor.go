@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrSkipped marks items that were never processed because the run stopped
+// early, either in fail-fast mode after a failure or because the caller's
+// context was cancelled.
+var ErrSkipped = errors.New("skipped after earlier failure")
+
+// PanicError is the error of an item whose transform panicked. The panic is
+// recovered in the worker, so the other items of the run carry on.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("transform panicked: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, such as a
+// runtime.Error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Transform converts one input item into a result.
+type Transform[T, R any] func(ctx context.Context, item T) (R, error)
+
+// Result is the outcome of transforming the input item at Index: either a
+// Value or an Err.
+type Result[R any] struct {
+	Index int
+	Value R
+	Err   error
+}
+
+// Progress reports how far a run has got.
+type Progress struct {
+	Done   int
+	Failed int
+	// Total is the number of items in the run, or zero for a stream,
+	// whose length is not known.
+	Total int
+	// Elapsed is the time since the run started, on the processor's
+	// Clock.
+	Elapsed time.Duration
+}
+
+// DataProcessor applies a Transform to every item of its input concurrently.
+type DataProcessor[T, R any] struct {
+	data      []T
+	transform Transform[T, R]
+	// Workers bounds how many items are processed at once. Zero means
+	// runtime.NumCPU().
+	Workers int
+	// FailFast stops scheduling new items and cancels the context passed to
+	// in-flight transforms as soon as any item fails.
+	FailFast bool
+	// OnProgress, if set, is called after each item finishes. Calls are
+	// serialized, so it may update state without locking, but it should
+	// return quickly as it holds up the workers.
+	OnProgress func(Progress)
+	// Clock times the run for OnProgress. Nil means SystemClock.
+	Clock Clock
+	// Buffer is the capacity of the channels ProcessStream reads input
+	// ahead into and delivers results through. Zero leaves them
+	// unbuffered, so workers wait for each result to be taken; a larger
+	// buffer absorbs a consumer that is slow at times, at the cost of
+	// holding that many more items in memory.
+	Buffer int
+}
+
+// NewDataProcessor returns a processor applying transform to data. Data may
+// be nil for a processor used only with ProcessStream.
+func NewDataProcessor[T, R any](data []T, transform Transform[T, R]) *DataProcessor[T, R] {
+	return &DataProcessor[T, R]{data: data, transform: transform}
+}
+
+// Process transforms every item using a fixed pool of workers fed from a job
+// channel, so memory use stays flat however large the input grows. It
+// returns one Result per input item, in input order, and an error joining
+// every item failure, or nil if all items succeeded.
+//
+// Cancelling ctx stops scheduling: items not yet started are marked with
+// ErrSkipped, transforms in flight see their context cancelled, and the
+// returned error includes ctx.Err(). Process still returns the results of
+// the items that finished.
+//
+// A transform that panics fails its item with a *PanicError; the run
+// carries on, as it does in every implementation.
+func (p *DataProcessor[T, R]) Process(parent context.Context) ([]Result[R], error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	workers := p.workers()
+	results := skippedResults[R](len(p.data))
+	finished := p.progress(len(p.data))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue // leave the item skipped
+				}
+				v, err := p.apply(ctx, p.data[i])
+				results[i] = Result[R]{Index: i, Value: v, Err: err}
+				if err != nil && p.FailFast {
+					cancel()
+				}
+				finished(err)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range p.data {
+		// A select with both cases ready picks at random, so check first
+		// to stop promptly once cancelled.
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	err := joinErrors(results)
+	if parent.Err() != nil {
+		err = errors.Join(err, parent.Err())
+	}
+	return results, err
+}
+
+// ProcessErrgroup is Process built on errgroup: a goroutine per item, with
+// errgroup's limit keeping at most Workers of them running. The context
+// from errgroup.WithContext is cancelled on the first error a goroutine
+// returns, which fail-fast mode relies on. It returns the same results as
+// Process and is kept for comparison in the benchmarks.
+func (p *DataProcessor[T, R]) ProcessErrgroup(parent context.Context) ([]Result[R], error) {
+	g, ctx := errgroup.WithContext(parent)
+	g.SetLimit(p.workers())
+	results := skippedResults[R](len(p.data))
+	finished := p.progress(len(p.data))
+	for i, x := range p.data {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil // leave the item skipped
+			}
+			v, err := p.apply(ctx, x)
+			results[i] = Result[R]{Index: i, Value: v, Err: err}
+			finished(err)
+			if p.FailFast {
+				return err // cancels ctx
+			}
+			return nil
+		})
+	}
+	_ = g.Wait() // the failures are in results
+	err := joinErrors(results)
+	if parent.Err() != nil {
+		err = errors.Join(err, parent.Err())
+	}
+	return results, err
+}
+
+// ProcessUnbounded is the original implementation: one goroutine per item.
+// It is kept for comparison in the benchmarks.
+func (p *DataProcessor[T, R]) ProcessUnbounded(ctx context.Context) ([]Result[R], error) {
+	var wg sync.WaitGroup
+	results := make([]Result[R], len(p.data))
+	for i, x := range p.data {
+		wg.Add(1)
+		go func(i int, x T) {
+			defer wg.Done()
+			v, err := p.apply(ctx, x)
+			results[i] = Result[R]{Index: i, Value: v, Err: err}
+		}(i, x)
+	}
+	wg.Wait()
+	return results, joinErrors(results)
+}
+
+// apply runs the transform on item, turning a panic into a *PanicError so
+// that it fails the item rather than crashing the program. Every
+// implementation calls it, since a panic in a goroutine cannot be recovered
+// by any other one: errgroup, in particular, does not recover them.
+func (p *DataProcessor[T, R]) apply(ctx context.Context, item T) (v R, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero R
+			v, err = zero, &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return p.transform(ctx, item)
+}
+
+// workers returns the number of items of the data to process at once.
+func (p *DataProcessor[T, R]) workers() int {
+	return max(min(p.poolSize(), len(p.data)), 1)
+}
+
+// poolSize returns the number of workers configured.
+func (p *DataProcessor[T, R]) poolSize() int {
+	if p.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return p.Workers
+}
+
+// progress returns the function recording that one of total items
+// finished, which reports to OnProgress if it is set. It is safe for
+// concurrent use.
+func (p *DataProcessor[T, R]) progress(total int) func(err error) {
+	clock := p.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	var (
+		mu       sync.Mutex
+		progress = Progress{Total: total}
+		start    = clock.Now()
+	)
+	return func(err error) {
+		if p.OnProgress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Done++
+		if err != nil {
+			progress.Failed++
+		}
+		progress.Elapsed = clock.Now().Sub(start)
+		p.OnProgress(progress)
+	}
+}
+
+// skippedResults returns n results, each marked with ErrSkipped until its
+// item is processed.
+func skippedResults[R any](n int) []Result[R] {
+	results := make([]Result[R], n)
+	for i := range results {
+		results[i] = Result[R]{Index: i, Err: ErrSkipped}
+	}
+	return results
+}
+
+// joinErrors combines the failures in results, leaving out skipped items.
+func joinErrors[R any](results []Result[R]) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, ErrSkipped) {
+			errs = append(errs, fmt.Errorf("item %d: %w", r.Index, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Values returns the values of the successful results, in order.
+func Values[R any](results []Result[R]) []R {
+	values := make([]R, 0, len(results))
+	for _, r := range results {
+		if r.Err == nil {
+			values = append(values, r.Value)
+		}
+	}
+	return values
+}
+
+// Square is the sample's original transform.
+func Square(_ context.Context, x int) (int, error) {
+	return x * x, nil
+}
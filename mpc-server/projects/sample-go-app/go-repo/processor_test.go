@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProcess(t *testing.T) {
+	want := []int{1, 4, 9, 16, 25}
+	for _, workers := range []int{0, 1, 2, 10} {
+		p := NewDataProcessor([]int{1, 2, 3, 4, 5}, Square)
+		p.Workers = workers
+		results, err := p.Process(context.Background())
+		if got := Values(results); err != nil || !slices.Equal(got, want) {
+			t.Errorf("workers=%d: got %v, %v, want %v", workers, got, err, want)
+		}
+	}
+	got, err := NewDataProcessor(nil, Square).Process(context.Background())
+	if err != nil || len(got) != 0 {
+		t.Errorf("empty input: got %v, %v", got, err)
+	}
+}
+
+func TestProcessPartialResults(t *testing.T) {
+	p := NewDataProcessor([]string{"1", "x", "22", "y"}, parseInt)
+	results, err := p.Process(context.Background())
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("err = %v, want *strconv.NumError", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 2 {
+		t.Errorf("aggregate holds %d errors, want 2", n)
+	}
+	if got := Values(results); !slices.Equal(got, []int{1, 22}) {
+		t.Errorf("values = %v", got)
+	}
+	if results[1].Err == nil || results[3].Err == nil || results[2].Value != 22 {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestProcessFailFast(t *testing.T) {
+	boom := errors.New("boom")
+	var ran atomic.Int32
+	p := NewDataProcessor(make([]int, 100), func(ctx context.Context, x int) (int, error) {
+		if ran.Add(1) == 1 {
+			return 0, boom
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return x, nil
+		}
+	})
+	p.Workers = 2
+	p.FailFast = true
+	results, err := p.Process(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	skipped := 0
+	for _, r := range results {
+		if errors.Is(r.Err, ErrSkipped) {
+			skipped++
+		}
+	}
+	if skipped < 90 || ran.Load() > 10 {
+		t.Errorf("ran %d items, skipped %d; fail-fast did not stop the run", ran.Load(), skipped)
+	}
+}
+
+func TestProcessBoundsConcurrency(t *testing.T) {
+	// Eight items at 20ms each on two workers take four rounds.
+	p := NewDataProcessor(make([]int, 8), sleepy(20*time.Millisecond))
+	p.Workers = 2
+	start := time.Now()
+	p.Process(context.Background())
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("finished in %v; more than two workers ran at once", elapsed)
+	}
+}
+
+func sleepy(d time.Duration) Transform[int, int] {
+	return func(ctx context.Context, x int) (int, error) {
+		time.Sleep(d)
+		return Square(ctx, x)
+	}
+}
+
+func benchmarkInput(n int) []int {
+	data := make([]int, n)
+	for i := range data {
+		data[i] = i
+	}
+	return data
+}
+
+// implementations are the processor's interchangeable ways of running a
+// batch, compared by the benchmarks and the stress test.
+var implementations = []struct {
+	name string
+	run  func(*DataProcessor[int, int], context.Context) ([]Result[int], error)
+}{
+	{"pool", (*DataProcessor[int, int]).Process},
+	{"errgroup", (*DataProcessor[int, int]).ProcessErrgroup},
+	{"unbounded", (*DataProcessor[int, int]).ProcessUnbounded},
+}
+
+// BenchmarkProcess compares the implementations on CPU-bound items. Run
+// with -benchmem to see the unbounded version's allocations grow with the
+// input while the pool's stay flat; errgroup sits between the two, paying
+// for a goroutine per item but never holding more than Workers at once.
+func BenchmarkProcess(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{100, 1_000, 10_000, 100_000} {
+		p := NewDataProcessor(benchmarkInput(n), Square)
+		for _, impl := range implementations {
+			b.Run(fmt.Sprintf("%s/n=%d", impl.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					impl.run(p, ctx)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkProcessLatency simulates I/O-bound items, where the pool size
+// rather than the CPU count determines throughput.
+func BenchmarkProcessLatency(b *testing.B) {
+	ctx := context.Background()
+	data := benchmarkInput(256)
+	for _, impl := range implementations[:2] {
+		for _, workers := range []int{8, 64, 256} {
+			b.Run(fmt.Sprintf("%s/workers=%d", impl.name, workers), func(b *testing.B) {
+				p := NewDataProcessor(data, sleepy(time.Millisecond))
+				p.Workers = workers
+				for b.Loop() {
+					impl.run(p, ctx)
+				}
+			})
+		}
+	}
+	b.Run("unbounded", func(b *testing.B) {
+		p := NewDataProcessor(data, sleepy(time.Millisecond))
+		for b.Loop() {
+			p.ProcessUnbounded(ctx)
+		}
+	})
+}
+
+func TestImplementationsAgree(t *testing.T) {
+	data := benchmarkInput(1_000)
+	odd := func(ctx context.Context, x int) (int, error) {
+		if x%7 == 0 {
+			return 0, fmt.Errorf("%d is a multiple of 7", x)
+		}
+		return Square(ctx, x)
+	}
+	want, wantErr := NewDataProcessor(data, odd).ProcessUnbounded(context.Background())
+	for _, impl := range implementations {
+		p := NewDataProcessor(data, odd)
+		p.Workers = 4
+		got, err := impl.run(p, context.Background())
+		if !slices.Equal(Values(got), Values(want)) || err.Error() != wantErr.Error() {
+			t.Errorf("%s: results differ from ProcessUnbounded", impl.name)
+		}
+	}
+}
+
+func TestProcessRecoversPanics(t *testing.T) {
+	data := []int{1, 2, 3, 4}
+	var nilMap map[int]int
+	panicky := func(ctx context.Context, x int) (int, error) {
+		switch x {
+		case 2:
+			panic("two")
+		case 3:
+			nilMap[x] = x // a runtime error
+		}
+		return Square(ctx, x)
+	}
+	check := func(name string, results []Result[int]) {
+		t.Helper()
+		var pe *PanicError
+		if len(results) != 4 || !errors.As(results[1].Err, &pe) || pe.Value != "two" || !strings.Contains(string(pe.Stack), "TestProcessRecoversPanics") {
+			t.Errorf("%s: item 2 = %+v", name, results[1])
+		}
+		var re runtime.Error
+		if !errors.As(results[2].Err, &re) {
+			t.Errorf("%s: item 3 err = %v, want a runtime.Error", name, results[2].Err)
+		}
+		if results[0].Value != 1 || results[3].Value != 16 {
+			t.Errorf("%s: surviving items = %+v", name, results)
+		}
+	}
+	for _, impl := range implementations {
+		p := NewDataProcessor(data, panicky)
+		p.Workers = 2
+		results, err := impl.run(p, context.Background())
+		if err == nil {
+			t.Errorf("%s: panics not reported", impl.name)
+		}
+		check(impl.name, results)
+	}
+
+	p := NewDataProcessor(nil, panicky)
+	in := make(chan int, len(data))
+	for _, x := range data {
+		in <- x
+	}
+	close(in)
+	results := make([]Result[int], len(data))
+	for r := range p.ProcessStream(context.Background(), in) {
+		results[r.Index] = r
+	}
+	check("stream", results)
+}
+
+// TestProcessStress runs many batches at once, mixing failures,
+// cancellation and progress reporting, to give the race detector
+// something to find. Run it with go test -race.
+func TestProcessStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	data := benchmarkInput(2_000)
+	var wg sync.WaitGroup
+	for round := range 8 {
+		for _, impl := range implementations[:2] {
+			wg.Go(func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				var calls atomic.Int32
+				p := NewDataProcessor(data, func(ctx context.Context, x int) (int, error) {
+					switch n := calls.Add(1); {
+					case round%4 == 1 && n == 500:
+						cancel()
+					case x%97 == 0:
+						return 0, errors.New("unlucky")
+					}
+					return Square(ctx, x)
+				})
+				p.Workers = 1 + round
+				p.FailFast = round%4 == 2
+				var last Progress
+				p.OnProgress = func(pr Progress) { last = pr }
+
+				results, err := impl.run(p, ctx)
+				if len(results) != len(data) || err == nil {
+					t.Errorf("%s round %d: %d results, err %v", impl.name, round, len(results), err)
+				}
+				done := 0
+				for i, r := range results {
+					if r.Index != i {
+						t.Errorf("%s round %d: result %d has index %d", impl.name, round, i, r.Index)
+					}
+					if !errors.Is(r.Err, ErrSkipped) {
+						done++
+					}
+				}
+				if last.Done != done {
+					t.Errorf("%s round %d: progress reported %d done, results show %d", impl.name, round, last.Done, done)
+				}
+			})
+		}
+	}
+	wg.Wait()
+}
+
+func TestProcessCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var started atomic.Int32
+	p := NewDataProcessor(make([]int, 50), func(ctx context.Context, x int) (int, error) {
+		if started.Add(1) == 4 {
+			cancel()
+		}
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	p.Workers = 4
+	results, err := p.Process(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	skipped := 0
+	for _, r := range results {
+		if errors.Is(r.Err, ErrSkipped) {
+			skipped++
+		}
+	}
+	if started.Load() != 4 || skipped != 46 {
+		t.Errorf("started %d items and skipped %d after cancel, want 4 and 46", started.Load(), skipped)
+	}
+}
+
+func TestProcessProgress(t *testing.T) {
+	p := NewDataProcessor([]string{"1", "x", "3", "4"}, parseInt)
+	p.Workers = 2
+	var updates []Progress
+	p.OnProgress = func(pr Progress) { updates = append(updates, pr) }
+	p.Process(context.Background())
+	if len(updates) != 4 {
+		t.Fatalf("got %d progress updates, want 4", len(updates))
+	}
+	for i, u := range updates {
+		if u.Done != i+1 || u.Total != 4 {
+			t.Errorf("update %d = %+v", i, u)
+		}
+	}
+	if last := updates[3]; last.Failed != 1 {
+		t.Errorf("final update = %+v, want 1 failure", last)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// indexed is an item of a stream with its position in the input.
+type indexed[T any] struct {
+	index int
+	item  T
+}
+
+// ProcessStream transforms the items received from in until it is closed,
+// using the same pool of workers as Process, and delivers a Result for each
+// on the returned channel, which is closed once every item has been
+// processed. Results arrive in the order they finish; their Index is the
+// item's position in the input.
+//
+// Neither the input nor the results are ever held in a slice: at most
+// Workers items are in transform and Buffer more wait on each side of the
+// pool, however long the stream runs. The pool only takes items as fast as
+// the results are consumed, so a slow consumer holds back the reading of
+// in, and through it whatever feeds the channel.
+//
+// In FailFast mode, the first failure cancels the transforms in flight,
+// and every item still to come is delivered marked with ErrSkipped, so the
+// sender of in is never left blocked. Cancelling ctx stops reading in;
+// results not yet delivered are dropped and the channel is closed.
+func (p *DataProcessor[T, R]) ProcessStream(parent context.Context, in <-chan T) <-chan Result[R] {
+	ctx, cancel := context.WithCancel(parent)
+	jobs := make(chan indexed[T], p.Buffer)
+	out := make(chan Result[R], p.Buffer)
+	finished := p.progress(0)
+
+	var wg sync.WaitGroup
+	for range p.poolSize() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				r := Result[R]{Index: job.index, Err: ErrSkipped}
+				if ctx.Err() == nil {
+					r.Value, r.Err = p.apply(ctx, job.item)
+					if r.Err != nil && p.FailFast {
+						cancel()
+					}
+					finished(r.Err)
+				}
+				select {
+				case out <- r:
+				case <-parent.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := 0; parent.Err() == nil; i++ {
+			var item T
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				item = v
+			case <-parent.Done():
+				return
+			}
+			select {
+			case jobs <- indexed[T]{index: i, item: item}:
+			case <-parent.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+	return out
+}
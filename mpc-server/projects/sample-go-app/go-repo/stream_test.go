@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// generate sends 0 to n-1 on the returned channel, counting each send.
+func generate(n int, sent *atomic.Int32) <-chan int {
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := range n {
+			in <- i
+			if sent != nil {
+				sent.Add(1)
+			}
+		}
+	}()
+	return in
+}
+
+func TestProcessStream(t *testing.T) {
+	p := NewDataProcessor(nil, Square)
+	p.Workers = 4
+	var updates []Progress
+	p.OnProgress = func(pr Progress) { updates = append(updates, pr) }
+	values := make([]int, 100)
+	seen := 0
+	for r := range p.ProcessStream(context.Background(), generate(100, nil)) {
+		if r.Err != nil {
+			t.Fatalf("item %d: %v", r.Index, r.Err)
+		}
+		values[r.Index] = r.Value
+		seen++
+	}
+	if seen != 100 {
+		t.Fatalf("got %d results, want 100", seen)
+	}
+	for i, v := range values {
+		if v != i*i {
+			t.Fatalf("item %d = %d", i, v)
+		}
+	}
+	if last := updates[len(updates)-1]; len(updates) != 100 || last.Done != 100 || last.Total != 0 {
+		t.Errorf("%d updates, last %+v", len(updates), last)
+	}
+}
+
+func TestProcessStreamBackpressure(t *testing.T) {
+	p := NewDataProcessor(nil, Square)
+	p.Workers = 2
+	p.Buffer = 1
+	var sent atomic.Int32
+	out := p.ProcessStream(context.Background(), generate(50, &sent))
+	time.Sleep(50 * time.Millisecond)
+	// One result waits in the buffer and one with each worker, which a
+	// buffered item and one the reader holds follow.
+	if n := sent.Load(); n > 5 {
+		t.Errorf("%d items read ahead of an idle consumer, want at most 5", n)
+	}
+	n := 0
+	for range out {
+		n++
+	}
+	if n != 50 {
+		t.Errorf("got %d results, want 50", n)
+	}
+}
+
+func TestProcessStreamFailFast(t *testing.T) {
+	boom := errors.New("boom")
+	p := NewDataProcessor(nil, func(_ context.Context, x int) (int, error) {
+		if x == 0 {
+			return 0, boom
+		}
+		return x, nil
+	})
+	p.Workers = 1
+	p.FailFast = true
+	var failed, skipped int
+	for r := range p.ProcessStream(context.Background(), generate(100, nil)) {
+		switch {
+		case errors.Is(r.Err, boom):
+			failed++
+		case errors.Is(r.Err, ErrSkipped):
+			skipped++
+		}
+	}
+	// The whole input is still read, so the sender is not left blocked.
+	if failed != 1 || skipped != 99 {
+		t.Errorf("%d failed and %d skipped, want 1 and 99", failed, skipped)
+	}
+}
+
+func TestProcessStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewDataProcessor(nil, Square)
+	p.Workers = 2
+	in := make(chan int)
+	out := p.ProcessStream(ctx, in)
+	in <- 1
+	cancel()
+	// The output closes although in never does and results go unread.
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-out:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("output not closed after cancel")
+		}
+	}
+}
+
+// BenchmarkProcessMillion runs a million items through Process, which
+// needs the input and the results as slices, and through ProcessStream fed
+// by a generator. Run with -benchmem: the stream's memory stays at a few
+// kilobytes, growing with Buffer rather than the input, while the slices
+// cost tens of megabytes.
+func BenchmarkProcessMillion(b *testing.B) {
+	const n = 1_000_000
+	ctx := context.Background()
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			p := NewDataProcessor(benchmarkInput(n), Square)
+			results, _ := p.Process(ctx)
+			sum := 0
+			for _, r := range results {
+				sum += r.Value
+			}
+		}
+	})
+	for _, buffer := range []int{0, 64, 1024} {
+		b.Run(fmt.Sprintf("stream/buffer=%d", buffer), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				p := NewDataProcessor(nil, Square)
+				p.Buffer = buffer
+				sum := 0
+				for r := range p.ProcessStream(ctx, generate(n, nil)) {
+					sum += r.Value
+				}
+			}
+		})
+	}
+}
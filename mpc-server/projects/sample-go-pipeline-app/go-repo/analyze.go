@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// DefaultMaxEntries is how many warnings and errors AgentAnalyzer puts in
+// one prompt when MaxEntries is zero.
+const DefaultMaxEntries = 50
+
+// AgentAnalyzer asks an MPC agent to summarize each batch.
+type AgentAnalyzer struct {
+	Client *mpcclient.Client
+	Agent  string
+	// MaxEntries bounds the entries quoted in a prompt; the rest are
+	// left out. It defaults to DefaultMaxEntries.
+	MaxEntries int
+}
+
+// Analyze sends the batch's warnings and errors to the agent and returns
+// its answer. The client's retry policy applies to each call, and
+// cancelling ctx abandons it.
+//
+// TODO(lab): rather than dropping the entries past MaxEntries, split a
+// large batch into several calls, run them through ctx with a bound of
+// their own, and have the agent merge the partial summaries.
+func (a AgentAnalyzer) Analyze(ctx context.Context, b Batch) (string, error) {
+	resp, err := a.Client.Invoke(ctx, a.Agent, mpcclient.AgentRequest{
+		Prompt:  a.prompt(b),
+		Context: map[string]any{"vm": b.VM, "source": b.Source},
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Result, nil
+}
+
+func (a AgentAnalyzer) prompt(b Batch) string {
+	limit := a.MaxEntries
+	if limit <= 0 {
+		limit = DefaultMaxEntries
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Summarize the health of VM %q from these %d log entries, %d of them errors, and suggest what to check first.\n", b.VM, len(b.Entries), b.count("ERROR"))
+	quoted := 0
+	for _, e := range b.Entries {
+		if e.Level != "WARN" && e.Level != "ERROR" {
+			continue
+		}
+		if quoted == limit {
+			fmt.Fprintf(&sb, "(further entries left out)\n")
+			break
+		}
+		fmt.Fprintf(&sb, "%s %s %s\n", e.Time.Format("15:04"), e.Level, e.Message)
+		quoted++
+	}
+	return sb.String()
+}
+
+// LocalAnalyzer summarizes batches by counting their levels, for running
+// the pipeline without a server.
+type LocalAnalyzer struct{}
+
+// Analyze counts the batch's entries by level.
+func (LocalAnalyzer) Analyze(ctx context.Context, b Batch) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d errors, %d warnings in %d entries", b.count("ERROR"), b.count("WARN"), len(b.Entries)), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirFetcher reads sources as the names of files in a directory.
+//
+// TODO(lab): fetch sources starting with http:// or https:// over HTTP
+// instead, bounding each request with its own timeout and failing on
+// statuses other than 200.
+type DirFetcher struct {
+	Dir string
+}
+
+// Fetch reads the file source names. Names leaving the directory are
+// refused.
+func (f DirFetcher) Fetch(ctx context.Context, source string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !filepath.IsLocal(source) {
+		return nil, fmt.Errorf("source %q is outside %s", source, f.Dir)
+	}
+	return os.ReadFile(filepath.Join(f.Dir, source))
+}
+
+// DemoFetcher makes up a log for each source, named after the VM it is
+// about, taking Latency to do so as a network fetch would. The same seed
+// gives the same logs.
+type DemoFetcher struct {
+	Seed    uint64
+	Lines   int
+	Latency time.Duration
+}
+
+var demoMessages = map[string][]string{
+	"INFO":  {"health check passed", "deployment finished", "backup completed"},
+	"WARN":  {"CPU above 80% for 5 minutes", "disk /var is 85% full", "slow response from dependency"},
+	"ERROR": {"disk /var is 95% full", "out of memory: killed process 4242", "connection to database refused"},
+}
+
+// Fetch returns the made-up log of the VM source names.
+func (f DemoFetcher) Fetch(ctx context.Context, source string) ([]byte, error) {
+	t := time.NewTimer(f.Latency)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var h uint64
+	for _, c := range source {
+		h = h*31 + uint64(c)
+	}
+	r := rand.New(rand.NewPCG(f.Seed, h))
+	start := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	for i := range max(f.Lines, 1) {
+		level := "INFO"
+		switch n := r.IntN(10); {
+		case n == 0:
+			level = "ERROR"
+		case n < 3:
+			level = "WARN"
+		}
+		msgs := demoMessages[level]
+		fmt.Fprintf(&b, "%s %s %s %s\n", start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339), source, level, msgs[r.IntN(len(msgs))])
+	}
+	return []byte(b.String()), nil
+}
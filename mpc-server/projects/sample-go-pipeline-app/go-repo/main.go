@@ -0,0 +1,91 @@
+// Pipeline sample for Copilot exercises: VM logs are fetched, parsed,
+// summarized by an MPC agent and aggregated into a report, in bounded
+// concurrent stages that a Ctrl-C or a deadline stops cleanly.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+func main() {
+	server := flag.String("server", envOr("MPC_SERVER", mpcclient.DefaultBaseURL), "MPC server base URL [$MPC_SERVER]")
+	agent := flag.String("agent", "azureVmMetricsAgent", "agent summarizing each VM's log")
+	local := flag.Bool("local", false, "summarize logs by counting levels, without a server")
+	dir := flag.String("dir", "", "directory of log files to analyze, named by the arguments; without it, logs are made up for the VMs named")
+	seed := flag.Uint64("seed", 1, "seed of the made-up logs")
+	workers := flag.Int("workers", 4, "agent calls in flight at once")
+	timeout := flag.Duration("timeout", time.Minute, "deadline of the whole run")
+	flag.Parse()
+
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL")))
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	sources := flag.Args()
+	if len(sources) == 0 {
+		sources = []string{"web01", "web02", "web03", "db01", "db02", "cache01"}
+	}
+	var fetcher Fetcher = DemoFetcher{Seed: *seed, Lines: 40, Latency: 50 * time.Millisecond}
+	if *dir != "" {
+		fetcher = DirFetcher{Dir: *dir}
+	}
+	var analyzer Analyzer = LocalAnalyzer{}
+	if !*local {
+		c, err := mpcclient.NewClient(*server, mpcclient.WithLogger(logger))
+		if err != nil {
+			logger.Error("create client", "error", err)
+			os.Exit(2)
+		}
+		defer c.Close()
+		analyzer = AgentAnalyzer{Client: c, Agent: *agent}
+	}
+
+	// Ctrl-C, or the deadline, cancels the run: every stage stops, and the
+	// findings completed so far are still reported.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	metrics := new(Metrics)
+	p := &Pipeline{
+		Fetcher:        fetcher,
+		Analyzer:       analyzer,
+		FetchWorkers:   2,
+		ParseWorkers:   1,
+		AnalyzeWorkers: *workers,
+		Buffer:         2,
+		Metrics:        metrics,
+	}
+	start := time.Now()
+	report, err := p.Run(ctx, sources)
+	if err != nil {
+		logger.Warn("run stopped early", "error", err)
+	}
+	for _, f := range report.Findings {
+		fmt.Printf("%s (%d lines, %d errors): %s\n", f.VM, f.Lines, f.Errors, strings.TrimSpace(f.Summary))
+	}
+	for _, f := range report.Failures {
+		fmt.Printf("FAILED %v\n", f)
+	}
+	fmt.Printf("\n%d of %d sources analyzed in %s\n\n%s", len(report.Findings), len(sources), time.Since(start).Round(time.Millisecond), metrics)
+	if err != nil || len(report.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics counts the work of each stage of a pipeline. Its counters may
+// be read while the pipeline runs.
+type Metrics struct {
+	Fetch   StageMetrics
+	Parse   StageMetrics
+	Analyze StageMetrics
+}
+
+// StageMetrics counts the items a stage has handled.
+type StageMetrics struct {
+	succeeded   atomic.Int64
+	failed      atomic.Int64
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+	busy        atomic.Int64 // nanoseconds
+}
+
+// start records an item entering the stage, and returns the function
+// recording it leaving, successfully or not.
+func (m *StageMetrics) start() func(ok bool) {
+	n := m.inFlight.Add(1)
+	for {
+		peak := m.maxInFlight.Load()
+		if n <= peak || m.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	begin := time.Now()
+	return func(ok bool) {
+		m.busy.Add(int64(time.Since(begin)))
+		m.inFlight.Add(-1)
+		if ok {
+			m.succeeded.Add(1)
+		} else {
+			m.failed.Add(1)
+		}
+	}
+}
+
+// StageStats is a snapshot of a stage's counters.
+type StageStats struct {
+	Succeeded, Failed int64
+	// InFlight is how many items the stage is working on, and
+	// MaxInFlight the most it ever worked on at once.
+	InFlight, MaxInFlight int64
+	// Busy is the time spent on items, summed over the workers.
+	Busy time.Duration
+}
+
+// Stats returns a snapshot of the stage's counters.
+func (m *StageMetrics) Stats() StageStats {
+	return StageStats{
+		Succeeded:   m.succeeded.Load(),
+		Failed:      m.failed.Load(),
+		InFlight:    m.inFlight.Load(),
+		MaxInFlight: m.maxInFlight.Load(),
+		Busy:        time.Duration(m.busy.Load()),
+	}
+}
+
+// String formats the counters of every stage as a table.
+//
+// TODO(lab): serve the counters while the pipeline runs, with expvar or
+// as Prometheus metrics, and add each stage's p95 latency.
+func (m *Metrics) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-8s %9s %6s %9s %12s\n", "stage", "succeeded", "failed", "peak busy", "busy time")
+	for _, s := range []struct {
+		name string
+		m    *StageMetrics
+	}{{"fetch", &m.Fetch}, {"parse", &m.Parse}, {"analyze", &m.Analyze}} {
+		st := s.m.Stats()
+		fmt.Fprintf(&b, "%-8s %9d %6d %9d %12s\n", s.name, st.Succeeded, st.Failed, st.MaxInFlight, st.Busy.Round(time.Millisecond))
+	}
+	return b.String()
+}
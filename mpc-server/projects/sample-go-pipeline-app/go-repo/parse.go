@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Entry is one line of a VM log.
+type Entry struct {
+	Time    time.Time
+	VM      string
+	Level   string
+	Message string
+}
+
+// Parse reads the entries of a log of lines such as
+//
+//	2026-10-14T08:00:00Z web01 ERROR disk /var is 95% full
+//
+// skipping blank lines and comments starting with #. Every entry of a
+// document must be about the same VM.
+//
+// TODO(lab): accept JSON lines as well, such as
+// {"time": "...", "vm": "web01", "level": "ERROR", "msg": "..."}, telling
+// the two formats apart by the first character of each line.
+func Parse(d Document) (Batch, error) {
+	b := Batch{Source: d.Source}
+	sc := bufio.NewScanner(bytes.NewReader(d.Body))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseLine(line)
+		if err != nil {
+			return Batch{}, fmt.Errorf("line %d: %w", n, err)
+		}
+		if b.VM == "" {
+			b.VM = e.VM
+		} else if e.VM != b.VM {
+			return Batch{}, fmt.Errorf("line %d: entry for VM %q in a log of %q", n, e.VM, b.VM)
+		}
+		b.Entries = append(b.Entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return Batch{}, err
+	}
+	if len(b.Entries) == 0 {
+		return Batch{}, errors.New("no log entries")
+	}
+	return b, nil
+}
+
+func parseLine(line string) (Entry, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 4 {
+		return Entry{}, fmt.Errorf("want time, VM, level and message, got %q", line)
+	}
+	t, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return Entry{}, fmt.Errorf("bad time: %w", err)
+	}
+	switch fields[2] {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		return Entry{}, fmt.Errorf("unknown level %q", fields[2])
+	}
+	return Entry{Time: t, VM: fields[1], Level: fields[2], Message: fields[3]}, nil
+}
+
+// count returns the number of entries at level.
+func (b Batch) count(level string) int {
+	n := 0
+	for _, e := range b.Entries {
+		if e.Level == level {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Fetcher retrieves the raw log named by source.
+type Fetcher interface {
+	Fetch(ctx context.Context, source string) ([]byte, error)
+}
+
+// Analyzer has an agent summarize a batch of log entries.
+type Analyzer interface {
+	Analyze(ctx context.Context, b Batch) (string, error)
+}
+
+// Document is a fetched log.
+type Document struct {
+	Source string
+	Body   []byte
+}
+
+// Batch is the entries parsed from one source, all about one VM.
+type Batch struct {
+	Source  string
+	VM      string
+	Entries []Entry
+}
+
+// Finding is the agent's analysis of one batch.
+type Finding struct {
+	Source  string
+	VM      string
+	Lines   int
+	Errors  int
+	Summary string
+}
+
+// Failure is a source the pipeline gave up on, and the stage it failed in.
+type Failure struct {
+	Source string
+	Stage  string
+	Err    error
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s %s: %v", f.Stage, f.Source, f.Err)
+}
+
+// Report is what a run produced: a finding per source that made it
+// through every stage, sorted by VM, and the sources that did not.
+type Report struct {
+	Findings []Finding
+	Failures []Failure
+}
+
+// Pipeline analyzes logs in four stages, fetch → parse → analyze →
+// aggregate, each connected to the next by a channel of Buffer items. The
+// first three run a fixed number of workers, so no more than that many
+// fetches, parses or agent calls are ever in flight, and a slow stage
+// holds back the ones before it instead of letting work pile up in
+// memory.
+//
+// A source that fails a stage is recorded in the report and the rest
+// carry on. Cancelling the context stops every stage; Run then returns the
+// findings completed so far along with the context's error.
+type Pipeline struct {
+	Fetcher  Fetcher
+	Analyzer Analyzer
+
+	// Workers per stage; values below 1 are treated as 1.
+	FetchWorkers   int
+	ParseWorkers   int
+	AnalyzeWorkers int
+	// Buffer is the capacity of the channels between stages.
+	Buffer int
+
+	// Metrics, if set, counts the work of each stage.
+	Metrics *Metrics
+}
+
+// Run puts sources through the pipeline.
+func (p *Pipeline) Run(ctx context.Context, sources []string) (*Report, error) {
+	m := p.Metrics
+	if m == nil {
+		m = new(Metrics)
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	report := new(Report)
+	var mu sync.Mutex
+	fail := func(source, stage string, err error) {
+		// Work cut short by cancellation is not the source's fault.
+		if ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		report.Failures = append(report.Failures, Failure{Source: source, Stage: stage, Err: err})
+	}
+
+	in := make(chan string)
+	g.Go(func() error {
+		defer close(in)
+		for _, s := range sources {
+			if !send(ctx, in, s) {
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	docs := runStage(ctx, g, &m.Fetch, p.FetchWorkers, p.Buffer, in, func(ctx context.Context, source string) (Document, bool) {
+		body, err := p.Fetcher.Fetch(ctx, source)
+		if err != nil {
+			fail(source, "fetch", err)
+			return Document{}, false
+		}
+		return Document{Source: source, Body: body}, true
+	})
+	batches := runStage(ctx, g, &m.Parse, p.ParseWorkers, p.Buffer, docs, func(_ context.Context, d Document) (Batch, bool) {
+		b, err := Parse(d)
+		if err != nil {
+			fail(d.Source, "parse", err)
+			return Batch{}, false
+		}
+		return b, true
+	})
+	findings := runStage(ctx, g, &m.Analyze, p.AnalyzeWorkers, p.Buffer, batches, func(ctx context.Context, b Batch) (Finding, bool) {
+		summary, err := p.Analyzer.Analyze(ctx, b)
+		if err != nil {
+			fail(b.Source, "analyze", err)
+			return Finding{}, false
+		}
+		return Finding{Source: b.Source, VM: b.VM, Lines: len(b.Entries), Errors: b.count("ERROR"), Summary: summary}, true
+	})
+
+	// Aggregate as findings arrive, so the last stage never blocks.
+	for f := range findings {
+		report.Findings = append(report.Findings, f)
+	}
+	err := g.Wait()
+
+	// TODO(lab): rank the findings by error rate rather than by VM name,
+	// so the VMs needing attention come first.
+	slices.SortFunc(report.Findings, func(a, b Finding) int {
+		return cmp.Or(cmp.Compare(a.VM, b.VM), cmp.Compare(a.Source, b.Source))
+	})
+	slices.SortFunc(report.Failures, func(a, b Failure) int { return cmp.Compare(a.Source, b.Source) })
+	return report, err
+}
+
+// runStage starts workers goroutines applying fn to the items of in, and
+// returns the channel of their results, closed once every worker is
+// done. Items fn reports false for are dropped. Workers stop early when
+// ctx is done.
+func runStage[In, Out any](ctx context.Context, g *errgroup.Group, m *StageMetrics, workers, buffer int, in <-chan In, fn func(context.Context, In) (Out, bool)) <-chan Out {
+	out := make(chan Out, max(buffer, 0))
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		g.Go(func() error {
+			defer wg.Done()
+			for {
+				var v In
+				select {
+				case item, ok := <-in:
+					if !ok {
+						return nil
+					}
+					v = item
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				done := m.start()
+				res, ok := fn(ctx, v)
+				done(ok)
+				if ok && !send(ctx, out, res) {
+					return ctx.Err()
+				}
+			}
+		})
+	}
+	g.Go(func() error {
+		wg.Wait()
+		close(out)
+		return nil
+	})
+	return out
+}
+
+// send delivers v on out, or reports false once ctx is done.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient/mpcclienttest"
+)
+
+func TestPipelineWithAgent(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("logAgent").Handle(func(req mpcclient.AgentRequest) mpcclienttest.Reply {
+		return mpcclienttest.Reply{Text: "checked " + req.Context["vm"].(string)}
+	})
+	p := &Pipeline{
+		Fetcher:        DemoFetcher{Seed: 1, Lines: 20},
+		Analyzer:       AgentAnalyzer{Client: srv.Client(), Agent: "logAgent"},
+		AnalyzeWorkers: 2,
+	}
+	report, err := p.Run(context.Background(), []string{"web02", "db01", "web01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 3 || len(report.Failures) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	for i, vm := range []string{"db01", "web01", "web02"} {
+		if f := report.Findings[i]; f.VM != vm || f.Lines != 20 || f.Summary != "checked "+vm {
+			t.Errorf("finding %d = %+v", i, f)
+		}
+	}
+	prompt := srv.LastCall("logAgent").Body.Prompt
+	if !strings.Contains(prompt, "these 20 log entries") {
+		t.Errorf("prompt = %q", prompt)
+	}
+}
+
+func TestPipelineFailuresPerSource(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "web01.log"), []byte("2026-10-14T08:00:00Z web01 ERROR disk full\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "garbled.log"), []byte("not a log line\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "db01.log"), []byte("# quiet\n2026-10-14T08:00:00Z db01 INFO ok\n"), 0o644)
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("logAgent").Handle(func(req mpcclient.AgentRequest) mpcclienttest.Reply {
+		if req.Context["vm"] == "db01" {
+			return mpcclienttest.Reply{Status: 500, Code: "agent_error", Message: "backend down"}
+		}
+		return mpcclienttest.Reply{Text: "ok"}
+	})
+	p := &Pipeline{
+		Fetcher:  DirFetcher{Dir: dir},
+		Analyzer: AgentAnalyzer{Client: srv.Client(mpcclient.WithRetryPolicy(mpcclient.RetryPolicy{MaxAttempts: 1})), Agent: "logAgent"},
+	}
+	report, err := p.Run(context.Background(), []string{"web01.log", "garbled.log", "missing.log", "db01.log", "../etc/passwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].VM != "web01" || report.Findings[0].Errors != 1 {
+		t.Errorf("findings = %+v", report.Findings)
+	}
+	var stages []string
+	for _, f := range report.Failures {
+		stages = append(stages, f.Source+":"+f.Stage)
+	}
+	if got := strings.Join(stages, " "); got != "../etc/passwd:fetch db01.log:analyze garbled.log:parse missing.log:fetch" {
+		t.Errorf("failures = %s", got)
+	}
+}
+
+// blockingAnalyzer holds every call until its context is done.
+type blockingAnalyzer struct {
+	started chan struct{}
+}
+
+func (a blockingAnalyzer) Analyze(ctx context.Context, _ Batch) (string, error) {
+	a.started <- struct{}{}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestPipelineCancel(t *testing.T) {
+	sources := make([]string, 100)
+	for i := range sources {
+		sources[i] = "vm" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+	}
+	a := blockingAnalyzer{started: make(chan struct{}, len(sources))}
+	m := new(Metrics)
+	p := &Pipeline{Fetcher: DemoFetcher{Lines: 5}, Analyzer: a, FetchWorkers: 2, AnalyzeWorkers: 3, Buffer: 1, Metrics: m}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for range 3 {
+			<-a.started
+		}
+		cancel()
+	}()
+	done := make(chan struct{})
+	var report *Report
+	var err error
+	go func() {
+		report, err = p.Run(ctx, sources)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if !errors.Is(err, context.Canceled) || len(report.Findings) != 0 || len(report.Failures) != 0 {
+		t.Errorf("Run = %+v, %v", report, err)
+	}
+	// The stages are bounded: three calls in flight held the rest back,
+	// so only a handful of sources were ever fetched.
+	if st := m.Analyze.Stats(); st.MaxInFlight != 3 || st.InFlight != 0 {
+		t.Errorf("analyze stats = %+v", st)
+	}
+	if st := m.Fetch.Stats(); st.MaxInFlight > 2 || st.Succeeded+st.Failed > 10 {
+		t.Errorf("fetch stats = %+v", st)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		body, err string
+	}{
+		{"2026-10-14T08:00:00Z web01 INFO ok\n\n2026-10-14T08:01:00Z web01 WARN slow disk\n", ""},
+		{"", "no log entries"},
+		{"2026-10-14T08:00:00Z web01 INFO", "want time, VM, level and message"},
+		{"yesterday web01 INFO all ok", "bad time"},
+		{"2026-10-14T08:00:00Z web01 LOUD ok", "unknown level"},
+		{"2026-10-14T08:00:00Z web01 INFO ok\n2026-10-14T08:00:00Z db01 INFO ok", `line 2: entry for VM "db01"`},
+	} {
+		b, err := Parse(Document{Source: "s", Body: []byte(tt.body)})
+		switch {
+		case tt.err == "" && (err != nil || b.VM != "web01" || len(b.Entries) != 2 || b.Entries[1].Message != "slow disk"):
+			t.Errorf("Parse(%q) = %+v, %v", tt.body, b, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("Parse(%q): err = %v, want %q", tt.body, err, tt.err)
+		}
+	}
+}
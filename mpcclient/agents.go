@@ -0,0 +1,91 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AgentInfo describes an agent registered with the MPC server.
+type AgentInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Version is the agent's own version, and ProtocolVersion that of
+	// the server's request and response envelope, for servers that report
+	// them; see WithMinAgentVersion.
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+	// Capabilities lists what the agent can do, such as CapabilityTools;
+	// see WithRequiredCapabilities.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Parameters lists the structured parameters the agent accepts.
+	Parameters []ParameterInfo `json:"parameters,omitempty"`
+	// RequiredContext lists context keys the agent expects to be supplied.
+	RequiredContext []string `json:"required_context,omitempty"`
+	ExamplePrompts  []string `json:"example_prompts,omitempty"`
+	// Formats lists the response formats the agent can produce; see
+	// WithFormat.
+	Formats []Format `json:"formats,omitempty"`
+	// Models lists the models the agent can generate with, and MaxTokens
+	// the most tokens a call may ask for; see WithModel and WithMaxTokens.
+	Models    []string `json:"models,omitempty"`
+	MaxTokens int      `json:"max_tokens,omitempty"`
+	// ExampleUsage is the single example some servers send instead of
+	// ExamplePrompts.
+	ExampleUsage string `json:"example_usage,omitempty"`
+}
+
+// Examples returns the agent's example prompts, folding in ExampleUsage.
+func (a AgentInfo) Examples() []string {
+	if a.ExampleUsage == "" {
+		return a.ExamplePrompts
+	}
+	return append([]string{a.ExampleUsage}, a.ExamplePrompts...)
+}
+
+// ParameterInfo describes one parameter an agent accepts.
+type ParameterInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// agentList is the body returned by GET /agents.
+type agentList struct {
+	Agents     []AgentInfo `json:"agents"`
+	Count      int         `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// ListAgents returns the agents registered with the server, fetching
+// every page of the listing.
+func (c *Client) ListAgents(ctx context.Context, opts ...CallOption) ([]AgentInfo, error) {
+	return c.Agents(opts...).All(ctx)
+}
+
+// Agents returns an Iterator over the agents registered with the server,
+// sorted by name, fetching them a page at a time; WithPageSize sets the
+// size of the pages. Servers that do not page their listing send it whole.
+func (c *Client) Agents(opts ...CallOption) *Iterator[AgentInfo] {
+	return NewIterator(pageFetcher(c, "list agents", "/agents", opts, func(l *agentList) ([]AgentInfo, string) {
+		return l.Agents, l.NextCursor
+	}))
+}
+
+// DescribeAgent returns the metadata of the named agent.
+func (c *Client) DescribeAgent(ctx context.Context, agentName string, opts ...CallOption) (*AgentInfo, error) {
+	if agentName == "" {
+		return nil, errors.New("mpcclient: agent name is required")
+	}
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+
+	var info AgentInfo
+	if err := c.do(ctx, http.MethodGet, "/agents/"+url.PathEscape(agentName), nil, &info); err != nil {
+		return nil, fmt.Errorf("mpcclient: describe agent %q: %w", agentName, err)
+	}
+	return &info, nil
+}
@@ -0,0 +1,44 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListAndDescribeAgents(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /agents", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"agents":[{"name":"azureVmMetricsAgent","capabilities":["metrics_analysis"],"example_usage":"Check CPU"}],"count":1}`))
+	})
+	mux.HandleFunc("GET /agents/azureVmMetricsAgent", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"azureVmMetricsAgent","parameters":[{"name":"vm_name","type":"string","required":true}],"example_prompts":["Check disk"]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	agents, err := c.ListAgents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Name != "azureVmMetricsAgent" || agents[0].Examples()[0] != "Check CPU" {
+		t.Errorf("agents = %+v", agents)
+	}
+
+	info, err := c.DescribeAgent(context.Background(), "azureVmMetricsAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Parameters) != 1 || !info.Parameters[0].Required || info.Examples()[0] != "Check disk" {
+		t.Errorf("info = %+v", info)
+	}
+
+	_, err = c.DescribeAgent(context.Background(), "missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %v, want 404 APIError", err)
+	}
+}
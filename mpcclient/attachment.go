@@ -0,0 +1,170 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+)
+
+// DefaultMaxAttachmentSize is the largest attachment the client uploads
+// unless changed with WithMaxAttachmentSize. It matches the server default.
+const DefaultMaxAttachmentSize = 10 << 20
+
+// ErrAttachmentTooLarge is returned when an attachment exceeds the client's
+// size limit. The upload is aborted without the request being completed.
+var ErrAttachmentTooLarge = errors.New("attachment too large")
+
+// Multipart form field names shared with mpcserver.
+const (
+	formFieldRequest    = "request"
+	formFieldAttachment = "attachment"
+)
+
+// Attachment is a file sent alongside a prompt, such as a log, screenshot
+// or CSV. Its content is streamed from Reader while the request is sent, so
+// large files are never held in memory. If Reader is an io.Closer it is
+// closed once the upload ends.
+type Attachment struct {
+	// Name is the file name reported to the agent.
+	Name string
+	// ContentType defaults to the type registered for Name's extension, or
+	// application/octet-stream.
+	ContentType string
+	Reader      io.Reader
+}
+
+// AttachBytes returns an attachment holding data.
+func AttachBytes(name, contentType string, data []byte) Attachment {
+	return Attachment{Name: name, ContentType: contentType, Reader: bytes.NewReader(data)}
+}
+
+// AttachFile opens the file at path as an attachment named after its base
+// name. The file is closed after the upload.
+func AttachFile(path string) (Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("mpcclient: attach: %w", err)
+	}
+	return Attachment{Name: filepath.Base(path), Reader: f}, nil
+}
+
+// WithMaxAttachmentSize sets the largest attachment the client uploads.
+func WithMaxAttachmentSize(n int64) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.maxAttachment = n
+		}
+	}
+}
+
+func (a Attachment) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if t := mime.TypeByExtension(filepath.Ext(a.Name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// doMultipart posts req as a multipart form: the JSON request in the
+// "request" field followed by one "attachment" part per file. The body is
+// streamed, so, unlike do, failed attempts are not retried.
+func (c *Client) doMultipart(ctx context.Context, path string, req AgentRequest, out any) error {
+	for _, a := range req.Attachments {
+		if a.Name == "" || a.Reader == nil {
+			closeAttachments(req.Attachments)
+			return errors.New("attachment needs a name and a reader")
+		}
+	}
+	body, err := encodeBody(req)
+	if err != nil {
+		closeAttachments(req.Attachments)
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(c.writeMultipart(mw, body, req.Attachments))
+	}()
+
+	httpReq, err := c.newRequest(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Body = pr
+	httpReq.Header.Set("Content-Type", mw.FormDataContentType())
+	httpReq.Header.Set("Accept", "application/json")
+	res, err := c.send(httpReq)
+	if err != nil {
+		// Prefer the upload's own failure, such as an oversized file, over
+		// the transport error it caused.
+		var up *uploadError
+		if errors.As(err, &up) {
+			return up.err
+		}
+		return err
+	}
+	defer res.Body.Close()
+	return c.decode(res, out)
+}
+
+// uploadError marks a failure producing the multipart body.
+type uploadError struct{ err error }
+
+func (e *uploadError) Error() string { return e.err.Error() }
+func (e *uploadError) Unwrap() error { return e.err }
+
+func (c *Client) writeMultipart(mw *multipart.Writer, body []byte, attachments []Attachment) error {
+	defer closeAttachments(attachments)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="`+formFieldRequest+`"`)
+	h.Set("Content-Type", "application/json")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	for _, a := range attachments {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     formFieldAttachment,
+			"filename": a.Name,
+		}))
+		h.Set("Content-Type", a.contentType())
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(w, io.LimitReader(a.Reader, c.maxAttachment+1))
+		if err != nil {
+			return &uploadError{fmt.Errorf("read attachment %s: %w", a.Name, err)}
+		}
+		if n > c.maxAttachment {
+			return &uploadError{fmt.Errorf("%w: %s exceeds %d bytes", ErrAttachmentTooLarge, a.Name, c.maxAttachment)}
+		}
+	}
+	return mw.Close()
+}
+
+func closeAttachments(attachments []Attachment) {
+	for _, a := range attachments {
+		if c, ok := a.Reader.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAttachmentsUploadAsMultipart(t *testing.T) {
+	type part struct{ field, name, contentType, body string }
+	var parts []part
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("not multipart: %v", err)
+			return
+		}
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := io.ReadAll(p)
+			parts = append(parts, part{p.FormName(), p.FileName(), p.Header.Get("Content-Type"), string(b)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"result": "ok"})
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	if err := os.WriteFile(path, []byte(`{"cpu":97}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := AttachFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := NewClient(srv.URL)
+	resp, err := c.Invoke(context.Background(), "logs", AgentRequest{
+		Prompt:      "what failed?",
+		Attachments: []Attachment{file, AttachBytes("shot.png", "image/png", []byte("png"))},
+	})
+	if err != nil || resp.Result != "ok" {
+		t.Fatalf("Invoke = %+v, %v", resp, err)
+	}
+
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3: %+v", len(parts), parts)
+	}
+	if parts[0].field != "request" || !strings.Contains(parts[0].body, `"prompt":"what failed?"`) {
+		t.Errorf("request part = %+v", parts[0])
+	}
+	if want := (part{"attachment", "metrics.json", "application/json", `{"cpu":97}`}); parts[1] != want {
+		t.Errorf("file part = %+v, want %+v", parts[1], want)
+	}
+	if want := (part{"attachment", "shot.png", "image/png", "png"}); parts[2] != want {
+		t.Errorf("bytes part = %+v, want %+v", parts[2], want)
+	}
+}
+
+func TestAttachmentTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		json.NewEncoder(w).Encode(map[string]any{"result": "ok"})
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithMaxAttachmentSize(4))
+	big := &closeTracker{Reader: strings.NewReader("too many bytes")}
+	_, err := c.Invoke(context.Background(), "logs", AgentRequest{
+		Prompt:      "hi",
+		Attachments: []Attachment{{Name: "big.txt", Reader: big}},
+	})
+	if !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("err = %v, want ErrAttachmentTooLarge", err)
+	}
+	if !big.closed {
+		t.Error("attachment reader was not closed")
+	}
+}
@@ -0,0 +1,222 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to outgoing requests. Implementations must
+// be safe for concurrent use.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(ctx context.Context, req *http.Request) error
+
+// Authenticate calls f(ctx, req).
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, req *http.Request) error {
+	return f(ctx, req)
+}
+
+// authInterceptor adds the client's credentials to each attempt, so tokens
+// are refreshed between retries.
+func (c *Client) authInterceptor(next Handler) Handler {
+	return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if err := c.authenticate(req); err != nil {
+			return nil, err
+		}
+		return next.Do(req)
+	})
+}
+
+func (c *Client) authenticate(req *http.Request) error {
+	if c.auth == nil {
+		return nil
+	}
+	if c.dryRun && !offlineAuthenticator(c.auth) {
+		req.Header.Set("Authorization", redacted)
+		return nil
+	}
+	if err := c.auth.Authenticate(req.Context(), req); err != nil {
+		return fmt.Errorf("authenticate: %w", err)
+	}
+	return nil
+}
+
+// DefaultAPIKeyHeader is the header APIKey sends the key in when none is
+// given.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKey authenticates with a static key sent in a request header.
+type APIKey struct {
+	Key string
+	// Header defaults to DefaultAPIKeyHeader.
+	Header string
+}
+
+// Authenticate sets the API key header on req.
+func (a APIKey) Authenticate(_ context.Context, req *http.Request) error {
+	if a.Key == "" {
+		return errors.New("api key is empty")
+	}
+	h := a.Header
+	if h == "" {
+		h = DefaultAPIKeyHeader
+	}
+	req.Header.Set(h, a.Key)
+	return nil
+}
+
+// BearerToken authenticates with a static bearer token.
+type BearerToken string
+
+// Authenticate sets the Authorization header on req.
+func (t BearerToken) Authenticate(_ context.Context, req *http.Request) error {
+	if t == "" {
+		return errors.New("bearer token is empty")
+	}
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// defaultAzureAuthority is the Microsoft identity platform endpoint.
+const defaultAzureAuthority = "https://login.microsoftonline.com"
+
+// tokenExpirySkew is how long before expiry a cached token is refreshed.
+const tokenExpirySkew = 2 * time.Minute
+
+// AzureADConfig configures the Azure AD client-credentials flow.
+type AzureADConfig struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// Scope is the resource scope to request, typically
+	// "api://<app-id>/.default".
+	Scope string
+	// Authority overrides the identity endpoint, for sovereign clouds or
+	// tests. It defaults to https://login.microsoftonline.com.
+	Authority string
+	// HTTPClient is used for token requests. It defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// AzureADAuthenticator obtains bearer tokens from Azure AD with the OAuth 2.0
+// client-credentials grant and refreshes them shortly before they expire.
+type AzureADAuthenticator struct {
+	cfg      AzureADConfig
+	tokenURL string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewAzureADAuthenticator validates cfg and returns an authenticator for it.
+func NewAzureADAuthenticator(cfg AzureADConfig) (*AzureADAuthenticator, error) {
+	switch {
+	case cfg.TenantID == "":
+		return nil, errors.New("mpcclient: azure ad: tenant ID is required")
+	case cfg.ClientID == "":
+		return nil, errors.New("mpcclient: azure ad: client ID is required")
+	case cfg.ClientSecret == "":
+		return nil, errors.New("mpcclient: azure ad: client secret is required")
+	case cfg.Scope == "":
+		return nil, errors.New("mpcclient: azure ad: scope is required")
+	}
+	if cfg.Authority == "" {
+		cfg.Authority = defaultAzureAuthority
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &AzureADAuthenticator{
+		cfg:      cfg,
+		tokenURL: strings.TrimSuffix(cfg.Authority, "/") + "/" + url.PathEscape(cfg.TenantID) + "/oauth2/v2.0/token",
+		now:      time.Now,
+	}, nil
+}
+
+// Authenticate sets a current access token as the bearer credential on req.
+func (a *AzureADAuthenticator) Authenticate(ctx context.Context, req *http.Request) error {
+	tok, err := a.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return nil
+}
+
+// Token returns a cached access token, fetching a new one when the cached
+// token is missing or close to expiry.
+func (a *AzureADAuthenticator) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && a.now().Before(a.expires.Add(-tokenExpirySkew)) {
+		return a.token, nil
+	}
+	tok, ttl, err := a.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("azure ad: %w", err)
+	}
+	a.token, a.expires = tok, a.now().Add(ttl)
+	return tok, nil
+}
+
+func (a *AzureADAuthenticator) fetch(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.cfg.ClientID},
+		"client_secret": {a.cfg.ClientSecret},
+		"scope":         {a.cfg.Scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := a.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var payload struct {
+		AccessToken      string          `json:"access_token"`
+		ExpiresIn        json.RawMessage `json:"expires_in"`
+		Error            string          `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", 0, fmt.Errorf("token endpoint returned %d: decode: %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || payload.AccessToken == "" {
+		msg := payload.ErrorDescription
+		if msg == "" {
+			msg = payload.Error
+		}
+		return "", 0, fmt.Errorf("token endpoint returned %d: %s", res.StatusCode, msg)
+	}
+	// expires_in is a number, but some endpoints send it as a string.
+	secs, _ := json.Number(strings.Trim(string(payload.ExpiresIn), `"`)).Int64()
+	if secs <= 0 {
+		secs = 3600
+	}
+	return payload.AccessToken, time.Duration(secs) * time.Second, nil
+}
@@ -0,0 +1,89 @@
+package mpcclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaticAuthenticators(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    Option
+		header string
+		want   string
+	}{
+		{"api key", WithAPIKey("k-123"), "X-API-Key", "k-123"},
+		{"custom header", WithAuthenticator(APIKey{Key: "k", Header: "X-Workshop-Key"}), "X-Workshop-Key", "k"},
+		{"bearer", WithBearerToken("tok"), "Authorization", "Bearer tok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get(tt.header); got != tt.want {
+					t.Errorf("%s = %q, want %q", tt.header, got, tt.want)
+				}
+				w.Write([]byte(`{"agent":"a","result":"ok"}`))
+			}))
+			defer srv.Close()
+
+			c, _ := NewClient(srv.URL, tt.opt)
+			if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAzureADAuthenticatorCachesAndRefreshes(t *testing.T) {
+	var fetches atomic.Int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" {
+			t.Errorf("token path = %s", r.URL.Path)
+		}
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "api://mpc/.default" {
+			t.Errorf("form = %v", r.PostForm)
+		}
+		fetches.Add(1)
+		w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+	}))
+	defer idp.Close()
+
+	a, err := NewAzureADAuthenticator(AzureADConfig{
+		TenantID: "tenant-1", ClientID: "id", ClientSecret: "secret",
+		Scope: "api://mpc/.default", Authority: idp.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	for range 3 {
+		tok, err := a.Token(context.Background())
+		if err != nil || tok != "tok" {
+			t.Fatalf("Token() = %q, %v", tok, err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("fetches = %d, want 1 while cached", fetches.Load())
+	}
+
+	now = now.Add(59 * time.Minute)
+	if _, err := a.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("fetches = %d, want refresh near expiry", fetches.Load())
+	}
+}
+
+func TestNewAzureADAuthenticatorValidates(t *testing.T) {
+	if _, err := NewAzureADAuthenticator(AzureADConfig{TenantID: "t"}); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
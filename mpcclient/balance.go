@@ -0,0 +1,259 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Balancing selects which endpoint serves each request of a client
+// configured with WithEndpoints.
+type Balancing int
+
+// Balancing strategies.
+const (
+	// RoundRobin spreads requests evenly over the healthy endpoints.
+	RoundRobin Balancing = iota
+	// LeastLatency sends each request to the healthy endpoint that has
+	// been answering fastest. Endpoints without a measurement yet are
+	// tried first.
+	LeastLatency
+)
+
+func (b Balancing) String() string {
+	switch b {
+	case RoundRobin:
+		return "round-robin"
+	case LeastLatency:
+		return "least-latency"
+	default:
+		return fmt.Sprintf("Balancing(%d)", int(b))
+	}
+}
+
+// EndpointConfig configures load balancing over several MPC servers. Zero
+// fields take the documented defaults.
+type EndpointConfig struct {
+	Balancing Balancing
+	// FailureThreshold is how many consecutive failures eject an endpoint.
+	// It defaults to 3. Failures are counted as by the circuit breaker:
+	// transport errors, timeouts and 5xx responses.
+	FailureThreshold int
+	// EjectFor is how long an ejected endpoint receives no requests. Once
+	// it has passed, the endpoint is tried again: a success re-admits it,
+	// a failure ejects it for another period. It defaults to 30s.
+	EjectFor time.Duration
+}
+
+// EndpointStatus is the health of one endpoint, as reported by
+// Client.Endpoints.
+type EndpointStatus struct {
+	URL string
+	// Healthy is false while the endpoint is ejected.
+	Healthy bool
+	// Failures counts consecutive failed requests.
+	Failures int
+	// Latency is a moving average of the endpoint's response times, or
+	// zero before its first response.
+	Latency time.Duration
+	// EjectedUntil is when an ejected endpoint is next tried.
+	EjectedUntil time.Time `json:",omitzero"`
+}
+
+// WithEndpoints balances the client's HTTP requests over the base URL and
+// urls, which must be MPC servers hosting the same agents. Each endpoint's
+// health is tracked from the requests it serves: one that keeps failing
+// is ejected, and re-admitted once it answers again, so servers can be
+// added to shared infrastructure or restarted without restarting clients.
+// A request that cannot reach its endpoint at all is sent to the next;
+// WithRetryPolicy covers other failures, each retry picking an endpoint
+// afresh.
+//
+// WebSocket connections and streams are placed on an endpoint when they
+// are opened. gRPC connections, set up by the caller, are not balanced.
+func WithEndpoints(cfg EndpointConfig, urls ...string) Option {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+	if cfg.EjectFor <= 0 {
+		cfg.EjectFor = 30 * time.Second
+	}
+	return func(c *Client) {
+		c.endpoints = &balancer{cfg: cfg, now: time.Now, extra: urls}
+	}
+}
+
+// Endpoints reports the health of each endpoint configured with
+// WithEndpoints, in the order given, or nil for a client without them.
+func (c *Client) Endpoints() []EndpointStatus {
+	return c.endpoints.status()
+}
+
+// latencyWeight is the weight of each new sample in an endpoint's moving
+// average latency.
+const latencyWeight = 0.2
+
+// balancer spreads requests over a client's endpoints.
+type balancer struct {
+	cfg   EndpointConfig
+	now   func() time.Time
+	extra []string
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+type endpoint struct {
+	url          *url.URL
+	failures     int
+	latency      time.Duration
+	ejectedUntil time.Time
+}
+
+// init parses the endpoint URLs, the client's base URL first.
+func (b *balancer) init(base *url.URL) error {
+	b.endpoints = []*endpoint{{url: base}}
+	for _, raw := range b.extra {
+		u, err := parseBaseURL(raw)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(b.endpoints, func(e *endpoint) bool { return *e.url == *u }) {
+			b.endpoints = append(b.endpoints, &endpoint{url: u})
+		}
+	}
+	return nil
+}
+
+// order returns the endpoints in the order to try them for one request:
+// the strategy's choice among the healthy ones first, then the rest of the
+// healthy ones, then the ejected ones, soonest re-admitted first, so that
+// a request is never refused outright.
+func (b *balancer) order() []*endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	var healthy, ejected []*endpoint
+	n := len(b.endpoints)
+	for i := range n {
+		e := b.endpoints[(b.next+i)%n]
+		if e.ejectedUntil.After(now) {
+			ejected = append(ejected, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+	b.next = (b.next + 1) % n
+	if b.cfg.Balancing == LeastLatency {
+		slices.SortStableFunc(healthy, func(x, y *endpoint) int { return int(x.latency - y.latency) })
+	}
+	slices.SortStableFunc(ejected, func(x, y *endpoint) int { return x.ejectedUntil.Compare(y.ejectedUntil) })
+	return append(healthy, ejected...)
+}
+
+// record updates e's health with the outcome of a request that took d.
+func (b *balancer) record(e *endpoint, d time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil && isBreakerFailure(err) {
+		e.failures++
+		if e.failures >= b.cfg.FailureThreshold {
+			e.ejectedUntil = b.now().Add(b.cfg.EjectFor)
+		}
+		return
+	}
+	e.failures = 0
+	e.ejectedUntil = time.Time{}
+	if e.latency == 0 {
+		e.latency = d
+	} else {
+		e.latency += time.Duration(latencyWeight * float64(d-e.latency))
+	}
+}
+
+func (b *balancer) status() []EndpointStatus {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	out := make([]EndpointStatus, len(b.endpoints))
+	for i, e := range b.endpoints {
+		out[i] = EndpointStatus{URL: e.url.String(), Failures: e.failures, Latency: e.latency, Healthy: !e.ejectedUntil.After(now)}
+		if !out[i].Healthy {
+			out[i].EjectedUntil = e.ejectedUntil
+		}
+	}
+	return out
+}
+
+// balanceInterceptor sends each request to an endpoint chosen by the
+// client's balancer, moving on to the next endpoint while requests fail
+// without reaching the server.
+func (c *Client) balanceInterceptor(next Handler) Handler {
+	if c.endpoints == nil {
+		return next
+	}
+	return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		var err error
+		for i, e := range c.endpoints.order() {
+			attempt := req
+			if i > 0 {
+				if attempt, err = rewind(req); err != nil {
+					break
+				}
+			}
+			attempt = c.onEndpoint(attempt, e.url)
+			start := time.Now()
+			var res *http.Response
+			res, err = next.Do(attempt)
+			c.endpoints.record(e, time.Since(start), err)
+			if err == nil || !unreachable(req.Context(), err) {
+				return res, err
+			}
+		}
+		return nil, err
+	})
+}
+
+// place moves req, which opens a long-lived connection bypassing the
+// interceptor chain, to the endpoint the balancer picks. It returns a
+// function recording whether the connection could be opened.
+func (c *Client) place(req *http.Request) (*http.Request, func(error)) {
+	if c.endpoints == nil {
+		return req, func(error) {}
+	}
+	e := c.endpoints.order()[0]
+	start := time.Now()
+	return c.onEndpoint(req, e.url), func(err error) { c.endpoints.record(e, time.Since(start), err) }
+}
+
+// onEndpoint returns req redirected from the client's base URL to u.
+func (c *Client) onEndpoint(req *http.Request, u *url.URL) *http.Request {
+	if *u == *c.baseURL {
+		return req
+	}
+	r := req.Clone(req.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = u.Scheme, u.Host, ""
+	r.URL.Path = u.Path + strings.TrimPrefix(req.URL.Path, c.baseURL.Path)
+	if req.URL.RawPath != "" {
+		r.URL.RawPath = u.EscapedPath() + strings.TrimPrefix(req.URL.RawPath, c.baseURL.EscapedPath())
+	}
+	return r
+}
+
+// unreachable reports whether err means no connection to the server could
+// be made, so the request never reached it and is safe to send elsewhere.
+func unreachable(ctx context.Context, err error) bool {
+	var opErr *net.OpError
+	return ctx.Err() == nil && errors.As(err, &opErr) && opErr.Op == "dial"
+}
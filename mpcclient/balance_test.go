@@ -0,0 +1,126 @@
+package mpcclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// endpointServer answers agent calls with status, counting them.
+func endpointServer(t *testing.T, status *atomic.Int32, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(delay)
+		if s := status.Load(); s != 0 {
+			w.WriteHeader(int(s))
+			return
+		}
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestEndpointsRoundRobin(t *testing.T) {
+	var ok atomic.Int32
+	a, aCalls := endpointServer(t, &ok, 0)
+	b, bCalls := endpointServer(t, &ok, 0)
+	mux := http.NewServeMux()
+	var cCalls atomic.Int32
+	mux.HandleFunc("POST /mpc/agent/a", func(w http.ResponseWriter, r *http.Request) {
+		cCalls.Add(1)
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	})
+	prefixed := httptest.NewServer(mux)
+	defer prefixed.Close()
+
+	c, err := NewClient(a.URL, WithEndpoints(EndpointConfig{}, b.URL, prefixed.URL+"/mpc/", a.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 6 {
+		if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if aCalls.Load() != 2 || bCalls.Load() != 2 || cCalls.Load() != 2 {
+		t.Errorf("calls = %d, %d, %d, want 2 each", aCalls.Load(), bCalls.Load(), cCalls.Load())
+	}
+	if st := c.Endpoints(); len(st) != 3 || !st[2].Healthy || st[2].Latency == 0 {
+		t.Errorf("Endpoints() = %+v", st)
+	}
+}
+
+func TestEndpointsEjectAndReadmit(t *testing.T) {
+	var ok, failing atomic.Int32
+	failing.Store(http.StatusServiceUnavailable)
+	good, goodCalls := endpointServer(t, &ok, 0)
+	bad, badCalls := endpointServer(t, &failing, 0)
+
+	c, _ := NewClient(good.URL, WithEndpoints(EndpointConfig{FailureThreshold: 2, EjectFor: time.Minute}, bad.URL))
+	now := time.Now()
+	c.endpoints.now = func() time.Time { return now }
+	for range 10 {
+		c.CallAgent(context.Background(), "a", "hi")
+	}
+	if badCalls.Load() != 2 || goodCalls.Load() != 8 {
+		t.Errorf("bad endpoint served %d calls and good %d, want 2 and 8", badCalls.Load(), goodCalls.Load())
+	}
+	if st := c.Endpoints(); st[1].Healthy || st[1].Failures != 2 || !st[1].EjectedUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("bad endpoint status = %+v", st[1])
+	}
+
+	// Once the ejection has passed, a success re-admits the endpoint.
+	failing.Store(0)
+	now = now.Add(2 * time.Minute)
+	for range 4 {
+		if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st := c.Endpoints(); !st[1].Healthy || st[1].Failures != 0 || badCalls.Load() != 4 {
+		t.Errorf("after recovery: status %+v, bad endpoint served %d calls", st[1], badCalls.Load())
+	}
+}
+
+func TestEndpointsSkipUnreachable(t *testing.T) {
+	var ok atomic.Int32
+	up, upCalls := endpointServer(t, &ok, 0)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c, _ := NewClient(down.URL, WithEndpoints(EndpointConfig{FailureThreshold: 2}, up.URL))
+	for range 4 {
+		if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+			t.Fatalf("call not moved to the reachable endpoint: %v", err)
+		}
+	}
+	if upCalls.Load() != 4 {
+		t.Errorf("reachable endpoint served %d calls, want 4", upCalls.Load())
+	}
+	if st := c.Endpoints(); st[0].Healthy {
+		t.Errorf("unreachable endpoint still healthy: %+v", st[0])
+	}
+}
+
+func TestEndpointsLeastLatency(t *testing.T) {
+	var ok atomic.Int32
+	slow, slowCalls := endpointServer(t, &ok, 20*time.Millisecond)
+	fast, fastCalls := endpointServer(t, &ok, 0)
+
+	c, _ := NewClient(slow.URL, WithEndpoints(EndpointConfig{Balancing: LeastLatency}, fast.URL))
+	for range 10 {
+		if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each endpoint is measured once, then the fast one takes the rest.
+	if slowCalls.Load() != 1 || fastCalls.Load() != 9 {
+		t.Errorf("slow endpoint served %d calls and fast %d, want 1 and 9", slowCalls.Load(), fastCalls.Load())
+	}
+}
@@ -0,0 +1,191 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBatchConcurrency is how many calls of a batch run at once when
+// BatchOptions.Concurrency is zero.
+const DefaultBatchConcurrency = 4
+
+// ErrBatchSkipped is the error of batch items that were never sent because
+// the batch stopped early.
+var ErrBatchSkipped = errors.New("mpcclient: skipped after batch stopped")
+
+// BatchRequest is one call in a batch.
+type BatchRequest struct {
+	Agent   string
+	Request AgentRequest
+}
+
+// FanOut builds a batch sending the same request to each agent.
+func FanOut(req AgentRequest, agents ...string) []BatchRequest {
+	batch := make([]BatchRequest, len(agents))
+	for i, a := range agents {
+		batch[i] = BatchRequest{Agent: a, Request: req}
+	}
+	return batch
+}
+
+// Prompts builds a batch sending each prompt to the same agent.
+func Prompts(agentName string, prompts ...string) []BatchRequest {
+	batch := make([]BatchRequest, len(prompts))
+	for i, p := range prompts {
+		batch[i] = BatchRequest{Agent: agentName, Request: AgentRequest{Prompt: p}}
+	}
+	return batch
+}
+
+// BatchOptions configures CallAgentBatch.
+type BatchOptions struct {
+	// Concurrency bounds the calls in flight. It defaults to
+	// DefaultBatchConcurrency.
+	Concurrency int
+	// StopOnError cancels the calls in flight and skips the rest as soon as
+	// one call fails.
+	StopOnError bool
+	// OnProgress is called after each item completes, one call at a time.
+	OnProgress func(BatchProgress)
+	// Retry resends items that fail, as a whole call, following the
+	// policy. It comes on top of the client's own retry policy, which
+	// resends single requests, and also covers failures that policy leaves
+	// alone, such as responses failing schema validation or
+	// post-processing. The zero value sends each item once.
+	Retry RetryPolicy
+	// CallOptions apply to every call of the batch.
+	CallOptions []CallOption
+}
+
+// BatchResult is the outcome of one batch item.
+type BatchResult struct {
+	// Index is the item's position in the batch.
+	Index    int
+	Agent    string
+	Response *AgentResponse
+	Err      error
+	// Attempts is how many times the item was sent; zero if it was
+	// skipped.
+	Attempts int
+	// Latency is how long the item took, across its attempts.
+	Latency time.Duration
+}
+
+// BatchProgress reports how far a batch has got.
+type BatchProgress struct {
+	Completed int
+	Failed    int
+	Total     int
+	// Last is the item that just completed.
+	Last BatchResult
+}
+
+// CallAgentBatch sends every request in reqs and returns their results in
+// the same order. Every item gets a result, whether it succeeded, failed or
+// was skipped. The error joins the errors of all failed items, plus one
+// wrapping ErrBatchSkipped if any were skipped, so it is nil only when
+// every call succeeded. Cancelling ctx skips the items not yet started.
+func (c *Client) CallAgentBatch(ctx context.Context, reqs []BatchRequest, opts BatchOptions) ([]BatchResult, error) {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultBatchConcurrency
+	}
+	workers = min(workers, len(reqs))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]BatchResult, len(reqs))
+	for i, r := range reqs {
+		results[i] = BatchResult{Index: i, Agent: r.Agent, Err: ErrBatchSkipped}
+	}
+
+	var (
+		mu       sync.Mutex
+		progress = BatchProgress{Total: len(reqs)}
+	)
+	done := func(res BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[res.Index] = res
+		progress.Completed++
+		if res.Err != nil {
+			progress.Failed++
+			if opts.StopOnError {
+				cancel()
+			}
+		}
+		progress.Last = res
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					continue // leave the item skipped
+				}
+				start := time.Now()
+				resp, attempts, err := c.invokeItem(ctx, reqs[i], opts)
+				done(BatchResult{Index: i, Agent: reqs[i].Agent, Response: resp, Err: err, Attempts: attempts, Latency: time.Since(start)})
+			}
+		}()
+	}
+dispatch:
+	for i := range reqs {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	var errs []error
+	skipped := 0
+	for _, res := range results {
+		switch {
+		case errors.Is(res.Err, ErrBatchSkipped):
+			skipped++
+		case res.Err != nil:
+			errs = append(errs, fmt.Errorf("item %d: %w", res.Index, res.Err))
+		}
+	}
+	if skipped > 0 {
+		errs = append(errs, fmt.Errorf("%d items: %w", skipped, ErrBatchSkipped))
+	}
+	return results, errors.Join(errs...)
+}
+
+// invokeItem sends one batch item, retrying it as opts.Retry allows, and
+// returns the number of attempts made.
+func (c *Client) invokeItem(ctx context.Context, r BatchRequest, opts BatchOptions) (*AgentResponse, int, error) {
+	p := opts.Retry
+	callOpts := opts.CallOptions
+	if c.idempotency && p.MaxAttempts > 1 {
+		// The item's retries repeat one call.
+		callOpts = append(callOpts[:len(callOpts):len(callOpts)], WithIdempotencyKey(newRequestID()))
+	}
+	for n := 1; ; n++ {
+		resp, err := c.Invoke(ctx, r.Agent, r.Request, callOpts...)
+		if err == nil || n >= p.MaxAttempts || !p.retryable(ctx, err) {
+			return resp, n, err
+		}
+		if sleepCtx(ctx, p.delay(n, err, c.rand)) != nil {
+			return nil, n, err
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newBatchServer(t *testing.T, delay time.Duration) (*Client, *atomic.Int32) {
+	t.Helper()
+	var inflight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		time.Sleep(delay)
+		if req.Prompt == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"bad prompt"}`))
+			return
+		}
+		agent := strings.TrimPrefix(r.URL.Path, "/agent/")
+		json.NewEncoder(w).Encode(map[string]any{"agent": agent, "result": agent + ": " + req.Prompt})
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, &peak
+}
+
+func TestCallAgentBatch(t *testing.T) {
+	c, peak := newBatchServer(t, 20*time.Millisecond)
+	batch := append(FanOut(AgentRequest{Prompt: "hi"}, "a", "b", "c"), Prompts("d", "x", "fail", "y")...)
+
+	var progress []BatchProgress
+	results, err := c.CallAgentBatch(context.Background(), batch, BatchOptions{
+		Concurrency: 2,
+		OnProgress:  func(p BatchProgress) { progress = append(progress, p) },
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("err = %v, want the failed item's APIError", err)
+	}
+	if len(results) != len(batch) {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, want := range []string{"a: hi", "b: hi", "c: hi", "d: x", "", "d: y"} {
+		res := results[i]
+		if res.Index != i || res.Agent != batch[i].Agent {
+			t.Errorf("result %d = %+v", i, res)
+		}
+		if want == "" {
+			if res.Err == nil {
+				t.Errorf("result %d: expected error", i)
+			}
+			continue
+		}
+		if res.Err != nil || res.Response.Result != want {
+			t.Errorf("result %d = %+v, want %q", i, res, want)
+		}
+		if res.Latency < 20*time.Millisecond {
+			t.Errorf("result %d: latency %v, shorter than the call", i, res.Latency)
+		}
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", got)
+	}
+	if len(progress) != len(batch) {
+		t.Fatalf("got %d progress updates", len(progress))
+	}
+	if last := progress[len(progress)-1]; last.Completed != 6 || last.Failed != 1 || last.Total != 6 {
+		t.Errorf("final progress = %+v", last)
+	}
+}
+
+func TestCallAgentBatchStopOnError(t *testing.T) {
+	c, _ := newBatchServer(t, 10*time.Millisecond)
+	prompts := []string{"fail"}
+	for range 20 {
+		prompts = append(prompts, "ok")
+	}
+	results, err := c.CallAgentBatch(context.Background(), Prompts("a", prompts...), BatchOptions{Concurrency: 1, StopOnError: true})
+	if !errors.Is(err, ErrBatchSkipped) {
+		t.Errorf("err = %v, want ErrBatchSkipped", err)
+	}
+	skipped := 0
+	for _, res := range results {
+		if errors.Is(res.Err, ErrBatchSkipped) {
+			skipped++
+		}
+	}
+	if skipped < 19 {
+		t.Errorf("skipped %d items, want at least 19", skipped)
+	}
+}
+
+func TestCallAgentBatchEmpty(t *testing.T) {
+	c, _ := newBatchServer(t, 0)
+	results, err := c.CallAgentBatch(context.Background(), nil, BatchOptions{})
+	if err != nil || len(results) != 0 {
+		t.Errorf("got %v, %v", results, err)
+	}
+}
@@ -0,0 +1,166 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Board is the shared context board of a session: keyed JSON values that
+// agents called WithBoard, and the client, read and write to hand each
+// other intermediate results along a chain of calls. Boards belong to the
+// API key they are used with and expire on the server when they have not
+// been written for a while.
+type Board struct {
+	Session string       `json:"session"`
+	Entries []BoardEntry `json:"entries"`
+	// ExpiresAt is when the server drops the board unless it is written
+	// again; it is zero for an empty board.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// BoardEntry is a value on a board.
+type BoardEntry struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Get returns the value under key.
+func (b *Board) Get(key string) (json.RawMessage, bool) {
+	for _, e := range b.Entries {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// NewBoardSession returns a random session ID for a new board.
+func NewBoardSession() string {
+	return newRequestID()
+}
+
+// WithBoard lets the agent read and write the shared context board of
+// session, so that the calls of a workflow sharing it can exchange
+// intermediate results.
+func WithBoard(session string) CallOption {
+	return func(o *callOptions) {
+		o.board = session
+	}
+}
+
+func boardPath(session string, key ...string) (string, error) {
+	if session == "" {
+		return "", errors.New("board session is required")
+	}
+	path := "/context/" + url.PathEscape(session)
+	for _, k := range key {
+		if k == "" {
+			return "", errors.New("board key is required")
+		}
+		path += "/" + url.PathEscape(k)
+	}
+	return path, nil
+}
+
+// Board returns the board of session, with no entries if it was never
+// written or has expired.
+func (c *Client) Board(ctx context.Context, session string, opts ...CallOption) (*Board, error) {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+	path, err := boardPath(session)
+	var b Board
+	if err == nil {
+		err = c.do(ctx, http.MethodGet, path, nil, &b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: get board %q: %w", session, err)
+	}
+	return &b, nil
+}
+
+// BoardValue decodes the value under key on the board of session into
+// target. A key the board does not hold is an error matching
+// ErrBoardKeyNotFound.
+func (c *Client) BoardValue(ctx context.Context, session, key string, target any, opts ...CallOption) error {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+	path, err := boardPath(session, key)
+	var e BoardEntry
+	if err == nil {
+		err = c.do(ctx, http.MethodGet, path, nil, &e)
+	}
+	if err == nil {
+		err = json.Unmarshal(e.Value, target)
+	}
+	if err != nil {
+		return fmt.Errorf("mpcclient: get %q from board %q: %w", key, session, err)
+	}
+	return nil
+}
+
+// SetBoardValue writes the JSON encoding of value under key on the board
+// of session and returns the entry as stored.
+func (c *Client) SetBoardValue(ctx context.Context, session, key string, value any, opts ...CallOption) (*BoardEntry, error) {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+	path, err := boardPath(session, key)
+	var raw json.RawMessage
+	if err == nil {
+		raw, err = json.Marshal(value)
+	}
+	var e BoardEntry
+	if err == nil {
+		err = c.do(ctx, http.MethodPut, path, raw, &e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: set %q on board %q: %w", key, session, err)
+	}
+	return &e, nil
+}
+
+// SeedBoard writes values to the board of session, in key order, before
+// the calls that read them.
+func (c *Client) SeedBoard(ctx context.Context, session string, values map[string]any, opts ...CallOption) error {
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if _, err := c.SetBoardValue(ctx, session, key, values[key], opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBoardValue removes the value under key from the board of session.
+func (c *Client) DeleteBoardValue(ctx context.Context, session, key string, opts ...CallOption) error {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+	path, err := boardPath(session, key)
+	if err == nil {
+		err = c.do(ctx, http.MethodDelete, path, nil, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("mpcclient: delete %q from board %q: %w", key, session, err)
+	}
+	return nil
+}
+
+// ClearBoard removes every value from the board of session.
+func (c *Client) ClearBoard(ctx context.Context, session string, opts ...CallOption) error {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+	path, err := boardPath(session)
+	if err == nil {
+		err = c.do(ctx, http.MethodDelete, path, nil, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("mpcclient: clear board %q: %w", session, err)
+	}
+	return nil
+}
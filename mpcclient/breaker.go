@@ -0,0 +1,200 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by errors.Is for calls rejected by an open
+// circuit breaker. The error itself is a *CircuitOpenError.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError reports a call rejected without being sent because its
+// agent's circuit breaker is open.
+type CircuitOpenError struct {
+	Agent string
+	// RetryAt is when the breaker lets a trial call through.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for agent %q until %s", e.Agent, e.RetryAt.Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) hold.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerState is the state of one agent's circuit breaker.
+type BreakerState int
+
+// Breaker states.
+const (
+	// BreakerClosed lets calls through while counting failures.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects calls until the cool-down has passed.
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of trial calls through; their
+	// outcome closes or re-opens the breaker.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerConfig configures the per-agent circuit breakers. Zero fields take
+// the documented defaults.
+type BreakerConfig struct {
+	// FailureThreshold is how many consecutive failures open the breaker.
+	// It defaults to 5.
+	FailureThreshold int
+	// CoolDown is how long an open breaker rejects calls before allowing a
+	// trial. It defaults to 30s.
+	CoolDown time.Duration
+	// HalfOpenCalls is how many trial calls may be in flight while half
+	// open. It defaults to 1.
+	HalfOpenCalls int
+	// IsFailure reports whether a call's error counts against the agent. By
+	// default transport errors, timeouts and 5xx responses count; client
+	// errors such as 400 and 404, and calls cancelled by the caller, do not.
+	IsFailure func(error) bool
+}
+
+// WithCircuitBreaker gives every agent its own circuit breaker, so calls to
+// an agent that keeps failing are rejected immediately with an error
+// matching ErrCircuitOpen instead of being sent.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 30 * time.Second
+	}
+	if cfg.HalfOpenCalls <= 0 {
+		cfg.HalfOpenCalls = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = isBreakerFailure
+	}
+	return func(c *Client) {
+		c.breakers = &breakerSet{cfg: cfg, now: time.Now, agents: make(map[string]*breaker)}
+	}
+}
+
+// BreakerState returns the state of the named agent's circuit breaker. It
+// is BreakerClosed for agents not yet called and for clients without
+// breakers.
+func (c *Client) BreakerState(agentName string) BreakerState {
+	return c.breakers.state(agentName)
+}
+
+func isBreakerFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrDryRun) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+type breakerSet struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	agents map[string]*breaker
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trials   int
+}
+
+// allow reports whether a call to agent may proceed. On success the caller
+// must pass the call's error to done.
+func (bs *breakerSet) allow(agentName string) (done func(error), err error) {
+	if bs == nil {
+		return func(error) {}, nil
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b := bs.agents[agentName]
+	if b == nil {
+		b = &breaker{}
+		bs.agents[agentName] = b
+	}
+	bs.advance(b)
+
+	switch b.state {
+	case BreakerOpen:
+		return nil, &CircuitOpenError{Agent: agentName, RetryAt: b.openedAt.Add(bs.cfg.CoolDown)}
+	case BreakerHalfOpen:
+		if b.trials >= bs.cfg.HalfOpenCalls {
+			return nil, &CircuitOpenError{Agent: agentName, RetryAt: bs.now()}
+		}
+		b.trials++
+		return func(err error) { bs.record(b, true, err) }, nil
+	default:
+		return func(err error) { bs.record(b, false, err) }, nil
+	}
+}
+
+func (bs *breakerSet) record(b *breaker, trial bool, err error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if trial {
+		b.trials--
+	}
+	switch {
+	case err == nil:
+		b.state, b.failures = BreakerClosed, 0
+	case !bs.cfg.IsFailure(err):
+		// Errors such as a 404 say nothing about the agent's health.
+	case b.state == BreakerHalfOpen:
+		b.state, b.openedAt = BreakerOpen, bs.now()
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= bs.cfg.FailureThreshold {
+			b.state, b.openedAt = BreakerOpen, bs.now()
+		}
+	}
+}
+
+// advance moves an open breaker whose cool-down has passed to half open.
+func (bs *breakerSet) advance(b *breaker) {
+	if b.state == BreakerOpen && !bs.now().Before(b.openedAt.Add(bs.cfg.CoolDown)) {
+		b.state, b.trials = BreakerHalfOpen, 0
+	}
+}
+
+func (bs *breakerSet) state(agentName string) BreakerState {
+	if bs == nil {
+		return BreakerClosed
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b := bs.agents[agentName]
+	if b == nil {
+		return BreakerClosed
+	}
+	bs.advance(b)
+	return b.state
+}
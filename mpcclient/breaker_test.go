@@ -0,0 +1,113 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	var calls atomic.Int32
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/agent/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithCircuitBreaker(BreakerConfig{FailureThreshold: 3, CoolDown: time.Minute}))
+	now := time.Now()
+	c.breakers.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := c.CallAgent(ctx, "flaky", "hi"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatal("breaker opened early")
+		}
+	}
+	if got := c.BreakerState("flaky"); got != BreakerOpen {
+		t.Fatalf("state = %v, want open", got)
+	}
+
+	_, err := c.CallAgent(ctx, "flaky", "hi")
+	var open *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &open) || open.Agent != "flaky" || !open.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("err = %v, want CircuitOpenError", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("open breaker let a call through: %d calls", calls.Load())
+	}
+
+	// Other agents and client errors are unaffected.
+	for range 5 {
+		c.CallAgent(ctx, "missing", "hi")
+	}
+	if got := c.BreakerState("missing"); got != BreakerClosed {
+		t.Errorf("404s opened the breaker: %v", got)
+	}
+
+	// After the cool-down a failed trial re-opens the breaker...
+	now = now.Add(time.Minute)
+	if got := c.BreakerState("flaky"); got != BreakerHalfOpen {
+		t.Fatalf("state = %v, want half-open", got)
+	}
+	if _, err := c.CallAgent(ctx, "flaky", "hi"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("half-open breaker rejected the trial call")
+	}
+	if got := c.BreakerState("flaky"); got != BreakerOpen {
+		t.Fatalf("state after failed trial = %v, want open", got)
+	}
+
+	// ...and a successful one closes it.
+	now = now.Add(time.Minute)
+	failing.Store(false)
+	if _, err := c.CallAgent(ctx, "flaky", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.BreakerState("flaky"); got != BreakerClosed {
+		t.Errorf("state after successful trial = %v, want closed", got)
+	}
+}
+
+func TestBreakerHalfOpenLimitsTrials(t *testing.T) {
+	bs := &breakerSet{
+		cfg:    BreakerConfig{FailureThreshold: 1, CoolDown: time.Second, HalfOpenCalls: 1, IsFailure: isBreakerFailure},
+		now:    time.Now,
+		agents: make(map[string]*breaker),
+	}
+	done, _ := bs.allow("a")
+	done(errors.New("connection refused"))
+	bs.agents["a"].openedAt = time.Now().Add(-time.Second)
+
+	trial, err := bs.allow("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.allow("a"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second concurrent trial err = %v, want ErrCircuitOpen", err)
+	}
+	trial(nil)
+	if bs.state("a") != BreakerClosed {
+		t.Errorf("state = %v", bs.state("a"))
+	}
+}
+
+func TestClientWithoutBreaker(t *testing.T) {
+	c, _ := NewClient("")
+	if got := c.BreakerState("any"); got != BreakerClosed || got.String() != "closed" {
+		t.Errorf("state = %v", got)
+	}
+}
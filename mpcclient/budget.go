@@ -0,0 +1,141 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrStreamIdle is the cause of a stream connection dropped because no
+// event arrived within the budget's StreamIdle timeout.
+var ErrStreamIdle = errors.New("stream idle")
+
+// Budget splits the time a call may take between its parts, so that
+// retries, reconnects and backoff all fit in one deadline. It budgets time
+// only; sessions limit tokens and cost with a BudgetFunc. Zero fields
+// impose no limit.
+type Budget struct {
+	// Total bounds the whole call, every attempt, reconnect and backoff
+	// included. It is what WithTimeout and WithRequestTimeout set. A
+	// deadline already on the caller's context still applies if it is
+	// earlier.
+	Total time.Duration
+	// Attempt bounds each HTTP attempt, so that a hung attempt is given up
+	// and retried while Total still leaves room. For streams it bounds
+	// the wait for the response to start; StreamIdle covers the rest. It
+	// does not apply to the WebSocket and gRPC transports.
+	Attempt time.Duration
+	// StreamIdle drops a stream connection when neither an event nor a
+	// heartbeat arrives for this long, time spent in the chunk function
+	// included. Servers send ": keepalive" comments as heartbeats while an
+	// agent is slow to answer, every 15 seconds by default on the Go
+	// server, so a StreamIdle above that interval tells a slow agent from
+	// a dead connection. The stream is re-established, as after any
+	// broken connection; when it cannot be resumed, the error wraps both
+	// ErrStreamInterrupted and ErrStreamIdle.
+	StreamIdle time.Duration
+}
+
+// WithTimeBudget sets the default budget of every call, replacing any
+// timeout set with WithTimeout.
+func WithTimeBudget(b Budget) Option {
+	return func(c *Client) {
+		c.budget = b
+	}
+}
+
+// WithCallBudget sets the budget of a single call, replacing the client's.
+func WithCallBudget(b Budget) CallOption {
+	return func(o *callOptions) {
+		o.budget = b
+	}
+}
+
+// RemainingBudget reports how long the call ctx belongs to has left before
+// its deadline, whether set by the call's budget or by the caller. ok is
+// false when the call has no deadline. Interceptors can use it to adapt,
+// such as skipping a retry that could not finish in time.
+func RemainingBudget(ctx context.Context) (remaining time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return max(time.Until(deadline), 0), true
+}
+
+// budgetKey carries the call's Budget to the handler chain.
+type budgetKey struct{}
+
+func budgetFrom(ctx context.Context) Budget {
+	b, _ := ctx.Value(budgetKey{}).(Budget)
+	return b
+}
+
+// errAttemptTimeout is the cause of an attempt cut short by the budget's
+// Attempt timeout.
+var errAttemptTimeout = fmt.Errorf("mpcclient: attempt exceeded its budget: %w", context.DeadlineExceeded)
+
+// attemptContext derives the context of one HTTP attempt under the call's
+// Attempt budget. Once the attempt has succeeded, release must be called
+// with its response: it stops the attempt timer when the response is a
+// stream, and otherwise ties the timer to the response body, which keeps
+// it running until the body is closed. On failure, release(nil) frees the
+// context.
+func attemptContext(req *http.Request) (ctx context.Context, release func(*http.Response)) {
+	ctx = req.Context()
+	b := budgetFrom(ctx)
+	if b.Attempt <= 0 {
+		return ctx, func(*http.Response) {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(b.Attempt, func() { cancel(errAttemptTimeout) })
+	done := func() {
+		timer.Stop()
+		cancel(nil)
+	}
+	return ctx, func(res *http.Response) {
+		switch {
+		case res == nil:
+			done()
+		case req.Header.Get("Accept") == "text/event-stream":
+			timer.Stop()
+			res.Body = &attemptBody{ReadCloser: res.Body, ctx: ctx, done: func() { cancel(nil) }}
+		default:
+			res.Body = &attemptBody{ReadCloser: res.Body, ctx: ctx, done: done}
+		}
+	}
+}
+
+// attemptErr returns the error of an attempt made under ctx, reporting it
+// as a timeout when the Attempt budget cut it short.
+func attemptErr(ctx context.Context, err error) error {
+	if err != nil && context.Cause(ctx) == errAttemptTimeout {
+		return errAttemptTimeout
+	}
+	return err
+}
+
+// attemptBody is the body of a response received under an Attempt budget.
+// Closing it releases the attempt's context.
+type attemptBody struct {
+	io.ReadCloser
+	ctx  context.Context
+	done func()
+}
+
+func (b *attemptBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != io.EOF {
+		err = attemptErr(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *attemptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done()
+	return err
+}
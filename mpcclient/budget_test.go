@@ -0,0 +1,137 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBudgetAttemptTimeoutRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if hits.Add(1) == 1 {
+			stall(w, r)
+			return
+		}
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		WithTimeBudget(Budget{Total: 5 * time.Second, Attempt: 100 * time.Millisecond}),
+	)
+
+	start := time.Now()
+	resp, err := c.CallAgent(context.Background(), "a", "hi")
+	if err != nil || resp.Result != "ok" {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+	if hits.Load() != 2 || time.Since(start) > 900*time.Millisecond {
+		t.Errorf("%d attempts in %v, want the hung one abandoned", hits.Load(), time.Since(start))
+	}
+}
+
+func TestBudgetTotalBoundsRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		hits.Add(1)
+		stall(w, r)
+	}))
+	defer srv.Close()
+	var remaining []time.Duration
+	c, _ := NewClient(srv.URL,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 100, BaseDelay: time.Millisecond}),
+		WithInterceptor(func(next Handler) Handler {
+			return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+				if d, ok := RemainingBudget(req.Context()); ok {
+					remaining = append(remaining, d)
+				}
+				return next.Do(req)
+			})
+		}),
+	)
+
+	start := time.Now()
+	_, err := c.CallAgent(context.Background(), "a", "hi", WithCallBudget(Budget{Total: 300 * time.Millisecond, Attempt: 100 * time.Millisecond}))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("call took %v, over its budget", elapsed)
+	}
+	if n := hits.Load(); n < 2 || n > 4 {
+		t.Errorf("made %d attempts, want those fitting the budget", n)
+	}
+	if len(remaining) != 1 || remaining[0] <= 0 || remaining[0] > 300*time.Millisecond {
+		t.Errorf("interceptor saw remaining budget %v", remaining)
+	}
+
+	remaining = nil
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	})
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil || len(remaining) != 0 {
+		t.Errorf("call without a budget saw %v, %v", remaining, err)
+	}
+}
+
+func TestBudgetStreamIdle(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		switch r.URL.Path {
+		case "/agent/quiet/stream":
+			if conns.Add(1) == 1 {
+				stall(w, r)
+				return
+			}
+		case "/agent/stalls/stream":
+			fmt.Fprint(w, "data: {\"text\":\"partial\"}\n\n")
+			w.(http.Flusher).Flush()
+			stall(w, r)
+			return
+		}
+		// A slow but steady stream, each event well within the idle
+		// timeout though the whole takes longer than the attempt timeout.
+		for _, text := range []string{"a", "b", "c", "d"} {
+			time.Sleep(40 * time.Millisecond)
+			fmt.Fprintf(w, "data: {\"text\":%q}\n\n", text)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "event: done\ndata: {}\n\n")
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL,
+		WithStreamReconnects(2),
+		WithTimeBudget(Budget{Total: 5 * time.Second, Attempt: 100 * time.Millisecond, StreamIdle: 100 * time.Millisecond}),
+	)
+	ctx := context.Background()
+
+	var text string
+	collect := func(ch Chunk) error {
+		text += ch.Text
+		return nil
+	}
+	if err := c.StreamAgent(ctx, "quiet", "hi", collect); err != nil || text != "abcd" {
+		t.Errorf("quiet stream gave %q, %v; want it re-established", text, err)
+	}
+	if conns.Load() != 2 {
+		t.Errorf("opened %d connections, want 2", conns.Load())
+	}
+
+	err := c.StreamAgent(ctx, "stalls", "hi", collect)
+	if !errors.Is(err, ErrStreamIdle) || !errors.Is(err, ErrStreamInterrupted) {
+		t.Errorf("err = %v, want an interrupted idle stream", err)
+	}
+}
@@ -0,0 +1,167 @@
+package mpcclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Cache defaults.
+const (
+	DefaultCacheTTL     = 5 * time.Minute
+	DefaultCacheEntries = 1000
+)
+
+// Cache stores agent responses for reuse. Implementations must be safe for
+// concurrent use. MemoryCache is the built-in implementation; others can
+// share a cache between processes.
+type Cache interface {
+	// Get returns the response stored under key, if present and fresh.
+	Get(key string) (*AgentResponse, bool)
+	// Set stores resp under key for ttl.
+	Set(key string, resp *AgentResponse, ttl time.Duration)
+}
+
+// CacheConfig configures response caching. Zero fields take the documented
+// defaults.
+type CacheConfig struct {
+	// Cache stores the responses. It defaults to a MemoryCache holding
+	// DefaultCacheEntries responses.
+	Cache Cache
+	// TTL is how long a response is reused. It defaults to
+	// DefaultCacheTTL.
+	TTL time.Duration
+	// Agents limits caching to the named agents, which should be read-only:
+	// answering from the cache skips any side effects of the call. Empty
+	// means every agent is cached.
+	Agents []string
+	// Key derives the cache key of a call. It defaults to CacheKey.
+	Key func(agentName string, req AgentRequest) string
+}
+
+// WithCache answers repeated identical calls from a cache instead of
+// sending them. Only successful responses are cached. Use WithCacheBypass
+// to force a fresh call.
+func WithCache(cfg CacheConfig) Option {
+	if cfg.Cache == nil {
+		cfg.Cache = NewMemoryCache(DefaultCacheEntries)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	if cfg.Key == nil {
+		cfg.Key = CacheKey
+	}
+	return func(c *Client) {
+		c.cache = &cfg
+	}
+}
+
+// WithCacheBypass sends the call even if a cached response exists. The
+// fresh response replaces the cached one.
+func WithCacheBypass() CallOption {
+	return func(o *callOptions) {
+		o.bypassCache = true
+	}
+}
+
+// CacheKey returns a SHA-256 hash of the agent name and the full request,
+// so calls differing in context, parameters or history are cached apart.
+func CacheKey(agentName string, req AgentRequest) string {
+	h := sha256.New()
+	h.Write([]byte(agentName))
+	h.Write([]byte{0})
+	// Maps marshal with sorted keys, so equal requests hash equally.
+	_ = json.NewEncoder(h).Encode(req)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheable reports whether calls to agentName are cached, returning the
+// key to use. Calls with attachments are never cached.
+func (cfg *CacheConfig) cacheable(agentName string, req AgentRequest) (string, bool) {
+	if cfg == nil || len(req.Attachments) > 0 || (len(cfg.Agents) > 0 && !slices.Contains(cfg.Agents, agentName)) {
+		return "", false
+	}
+	return cfg.Key(agentName, req), true
+}
+
+// MemoryCache is an in-process Cache that evicts the least recently used
+// response once full.
+type MemoryCache struct {
+	max int
+	now func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	resp    *AgentResponse
+	expires time.Time
+}
+
+// NewMemoryCache returns a cache holding at most maxEntries responses. A
+// maxEntries of zero or less selects DefaultCacheEntries.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheEntries
+	}
+	return &MemoryCache{
+		max:     maxEntries,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache. It returns a copy of the stored response.
+func (m *MemoryCache) Get(key string) (*AgentResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !m.now().Before(e.expires) {
+		m.order.Remove(el)
+		delete(m.entries, key)
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	resp := *e.resp
+	return &resp, true
+}
+
+// Set implements Cache.
+func (m *MemoryCache) Set(key string, resp *AgentResponse, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *resp
+	e := &cacheEntry{key: key, resp: &stored, expires: m.now().Add(ttl)}
+	if el, ok := m.entries[key]; ok {
+		el.Value = e
+		m.order.MoveToFront(el)
+		return
+	}
+	m.entries[key] = m.order.PushFront(e)
+	for m.order.Len() > m.max {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of stored responses, including expired ones not
+// yet evicted.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
@@ -0,0 +1,89 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"result": "answer", "request_id": string(rune('0' + n))})
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithCache(CacheConfig{Agents: []string{"readonly"}}))
+	ctx := context.Background()
+
+	first, _ := c.CallAgent(ctx, "readonly", "describe agent X")
+	second, _ := c.CallAgent(ctx, "readonly", "describe agent X")
+	if calls.Load() != 1 || second.RequestID != first.RequestID {
+		t.Errorf("repeated call was not cached: %d calls", calls.Load())
+	}
+	second.Result = "mutated"
+	if third, _ := c.CallAgent(ctx, "readonly", "describe agent X"); third.Result != "answer" {
+		t.Errorf("cached response was aliased: %q", third.Result)
+	}
+
+	c.CallAgent(ctx, "readonly", "another prompt")
+	c.Invoke(ctx, "readonly", AgentRequest{Prompt: "describe agent X", Context: map[string]any{"team": "a"}})
+	if calls.Load() != 3 {
+		t.Errorf("distinct requests shared a cache entry: %d calls", calls.Load())
+	}
+
+	fresh, _ := c.CallAgent(ctx, "readonly", "describe agent X", WithCacheBypass())
+	if calls.Load() != 4 || fresh.RequestID == first.RequestID {
+		t.Error("bypass was served from the cache")
+	}
+	if again, _ := c.CallAgent(ctx, "readonly", "describe agent X"); again.RequestID != fresh.RequestID {
+		t.Error("bypassed call did not refresh the cache")
+	}
+
+	c.CallAgent(ctx, "writer", "deploy")
+	c.CallAgent(ctx, "writer", "deploy")
+	if calls.Load() != 6 {
+		t.Errorf("agent outside CacheConfig.Agents was cached: %d calls", calls.Load())
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	m := NewMemoryCache(2)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	m.Set("a", &AgentResponse{Result: "a"}, time.Minute)
+	m.Set("b", &AgentResponse{Result: "b"}, time.Minute)
+	m.Get("a") // a is now most recently used
+	m.Set("c", &AgentResponse{Result: "c"}, time.Minute)
+	if _, ok := m.Get("b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if r, ok := m.Get("a"); !ok || r.Result != "a" {
+		t.Error("recently used entry was evicted")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := m.Get("c"); ok {
+		t.Error("expired entry was returned")
+	}
+	if m.Len() != 1 {
+		t.Errorf("Len = %d, want 1 after expiry", m.Len())
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	a := CacheKey("x", AgentRequest{Prompt: "p", Parameters: map[string]any{"a": 1, "b": 2}})
+	b := CacheKey("x", AgentRequest{Prompt: "p", Parameters: map[string]any{"b": 2, "a": 1}})
+	if a != b {
+		t.Error("equal requests hash differently")
+	}
+	if a == CacheKey("y", AgentRequest{Prompt: "p", Parameters: map[string]any{"a": 1, "b": 2}}) {
+		t.Error("agent name is not part of the key")
+	}
+}
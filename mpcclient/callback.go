@@ -0,0 +1,127 @@
+package mpcclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Job callback headers, as the server sends them.
+const (
+	callbackURLHeader       = "Callback-URL"
+	callbackTimestampHeader = "Callback-Timestamp"
+	callbackSignatureHeader = "Callback-Signature"
+)
+
+// DefaultCallbackTolerance is how far the timestamp of a callback may be
+// from the receiver's clock before VerifyCallback refuses it as a replay.
+const DefaultCallbackTolerance = 5 * time.Minute
+
+// maxCallbackBody bounds the callback bodies VerifyCallbackRequest reads.
+const maxCallbackBody = 32 << 20
+
+// ErrInvalidSignature is returned for callbacks whose signature does not
+// match their body, or whose timestamp is out of tolerance.
+var ErrInvalidSignature = errors.New("mpcclient: invalid callback signature")
+
+// WithCallback asks the server to POST the job to url once it finishes, as
+// SubmitJob submits it. The server signs the callback with a secret it
+// shares with the receiver, which checks it with VerifyCallback or
+// CallbackHandler. Servers refuse callbacks unless they enable them.
+func WithCallback(url string) CallOption {
+	return func(o *callOptions) {
+		o.callbackURL = url
+	}
+}
+
+type callbackURLKey struct{}
+
+func withCallbackURL(ctx context.Context, url string) context.Context {
+	return context.WithValue(ctx, callbackURLKey{}, url)
+}
+
+func callbackURLFrom(ctx context.Context) string {
+	url, _ := ctx.Value(callbackURLKey{}).(string)
+	return url
+}
+
+// VerifyCallback checks the signature of a job callback with the header
+// and body it arrived with, and returns the job it reports. The timestamp
+// it was signed at must be within tolerance of now; zero means
+// DefaultCallbackTolerance.
+func VerifyCallback(secret []byte, header http.Header, body []byte, tolerance time.Duration) (*Job, error) {
+	if tolerance <= 0 {
+		tolerance = DefaultCallbackTolerance
+	}
+	ts := header.Get(callbackTimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad timestamp %q", ErrInvalidSignature, ts)
+	}
+	if d := time.Since(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return nil, fmt.Errorf("%w: timestamp %s is out of tolerance", ErrInvalidSignature, time.Unix(sec, 0).UTC().Format(time.RFC3339))
+	}
+	sig, ok := strings.CutPrefix(header.Get(callbackSignatureHeader), "sha256=")
+	want, err := hex.DecodeString(sig)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("%w: malformed %s", ErrInvalidSignature, callbackSignatureHeader)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return nil, ErrInvalidSignature
+	}
+	var job Job
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, fmt.Errorf("mpcclient: parse callback: %w", err)
+	}
+	return &job, nil
+}
+
+// VerifyCallbackRequest is VerifyCallback for an incoming request, reading
+// its body.
+func VerifyCallbackRequest(secret []byte, r *http.Request, tolerance time.Duration) (*Job, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBody))
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: read callback: %w", err)
+	}
+	return VerifyCallback(secret, r.Header, body, tolerance)
+}
+
+// CallbackHandler serves job callbacks, calling fn with each job whose
+// signature checks out and answering 204. Callbacks failing the check get
+// 401, and those fn fails 500, which the server retries.
+func CallbackHandler(secret []byte, fn func(context.Context, *Job) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		job, err := VerifyCallbackRequest(secret, r, 0)
+		switch {
+		case errors.Is(err, ErrInvalidSignature):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := fn(r.Context(), job); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,89 @@
+package mpcclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedCallback returns the headers a server signing body at t sends.
+func signedCallback(secret []byte, t time.Time, body string) http.Header {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "." + body))
+	h := http.Header{}
+	h.Set(callbackTimestampHeader, ts)
+	h.Set(callbackSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return h
+}
+
+func TestVerifyCallback(t *testing.T) {
+	secret := []byte("s3cret")
+	body := `{"id":"j1","agent":"a","status":"succeeded","response":{"result":"ok"}}`
+
+	job, err := VerifyCallback(secret, signedCallback(secret, time.Now(), body), []byte(body), 0)
+	if err != nil || job.ID != "j1" || job.Status != JobSucceeded || job.Response.Result != "ok" {
+		t.Fatalf("VerifyCallback = %+v, %v", job, err)
+	}
+
+	for name, tt := range map[string]struct {
+		header http.Header
+		body   string
+	}{
+		"tampered":   {signedCallback(secret, time.Now(), body), strings.Replace(body, "ok", "ko", 1)},
+		"wrong key":  {signedCallback([]byte("other"), time.Now(), body), body},
+		"stale":      {signedCallback(secret, time.Now().Add(-time.Hour), body), body},
+		"unsigned":   {http.Header{callbackTimestampHeader: {"1"}}, body},
+		"no headers": {http.Header{}, body},
+	} {
+		if _, err := VerifyCallback(secret, tt.header, []byte(tt.body), 0); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", name, err)
+		}
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	secret := []byte("s3cret")
+	var got []string
+	srv := httptest.NewServer(CallbackHandler(secret, func(_ context.Context, job *Job) error {
+		if job.Status == JobFailed {
+			return errors.New("cannot handle failures")
+		}
+		got = append(got, job.ID)
+		return nil
+	}))
+	defer srv.Close()
+
+	post := func(h http.Header, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header = h
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	ok := `{"id":"j1","status":"succeeded"}`
+	if code := post(signedCallback(secret, time.Now(), ok), ok); code != http.StatusNoContent || len(got) != 1 {
+		t.Errorf("signed callback: %d, handled %q", code, got)
+	}
+	if code := post(signedCallback([]byte("x"), time.Now(), ok), ok); code != http.StatusUnauthorized {
+		t.Errorf("badly signed callback: %d", code)
+	}
+	failed := `{"id":"j2","status":"failed"}`
+	if code := post(signedCallback(secret, time.Now(), failed), failed); code != http.StatusInternalServerError {
+		t.Errorf("callback fn failed: %d", code)
+	}
+	if code := post(signedCallback(secret, time.Now(), "{"), "{"); code != http.StatusBadRequest {
+		t.Errorf("malformed callback: %d", code)
+	}
+}
@@ -0,0 +1,198 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallAgentJSON sends prompt to the named agent and decodes its answer into
+// target, a non-nil pointer to the Go value the answer should fill. The
+// agent is asked for JSON, with the schema SchemaFor derives from target's
+// type added to the prompt, and the answer is validated against that
+// schema as with WithResponseSchema: an answer that is not JSON, or not
+// the JSON asked for, is re-requested with the problems listed, up to the
+// repairs set with WithSchemaRepairs, after which the call fails with a
+// *SchemaError. The response is returned along with the decoded target.
+func (c *Client) CallAgentJSON(ctx context.Context, agentName, prompt string, target any, opts ...CallOption) (*AgentResponse, error) {
+	if rv := reflect.ValueOf(target); rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, fmt.Errorf("mpcclient: call agent %q: JSON target must be a non-nil pointer, not %T", agentName, target)
+	}
+	schema, err := SchemaFor(target)
+	if err != nil {
+		return nil, err
+	}
+	req := AgentRequest{Prompt: prompt + "\n\nAnswer with only a JSON document, without any other text, that satisfies this JSON schema:\n" + schema.raw}
+	opts = append([]CallOption{WithFormat(FormatJSON), WithResponseSchema(schema)}, opts...)
+	resp, err := c.Invoke(ctx, agentName, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.JSON(target); err != nil {
+		return resp, fmt.Errorf("mpcclient: call agent %q: %w", agentName, err)
+	}
+	return resp, nil
+}
+
+// schemaCache holds the schemas SchemaFor derived, by type.
+var schemaCache sync.Map // reflect.Type → *Schema
+
+// SchemaFor derives a JSON Schema from the type of v, or of what v points
+// to, describing the JSON encoding/json reads into it. Struct fields follow
+// their json tags: fields tagged omitempty or omitzero, and pointers, are
+// optional, while the others are required and no others are allowed. A
+// field's description tag becomes its description. Types decoding
+// themselves with UnmarshalText are strings, and those with UnmarshalJSON
+// accept any value. Recursive types, channels, functions and complex
+// numbers have no schema.
+func SchemaFor(v any) (*Schema, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, errors.New("mpcclient: schema for nil")
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if s, ok := schemaCache.Load(t); ok {
+		return s.(*Schema), nil
+	}
+	doc, err := typeSchema(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: schema for %v: %w", t, err)
+	}
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: schema for %v: %w", t, err)
+	}
+	s, err := CompileSchema(b)
+	if err != nil {
+		return nil, err
+	}
+	schemaCache.Store(t, s)
+	return s, nil
+}
+
+var (
+	timeType            = reflect.TypeFor[time.Time]()
+	rawMessageType      = reflect.TypeFor[json.RawMessage]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// typeSchema returns the schema of t. visiting holds the structs being
+// described, to catch recursion.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) (map[string]any, error) {
+	if t.Kind() == reflect.Pointer {
+		elem, err := typeSchema(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"anyOf": []any{elem, map[string]any{"type": "null"}}}, nil
+	}
+	ptr := reflect.PointerTo(t)
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	case t == rawMessageType, t.Kind() == reflect.Interface, ptr.Implements(jsonUnmarshalerType):
+		return map[string]any{}, nil
+	case ptr.Implements(textUnmarshalerType):
+		return map[string]any{"type": "string"}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := typeSchema(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		s := map[string]any{"type": "array", "items": items}
+		if t.Kind() == reflect.Array {
+			s["minItems"], s["maxItems"] = t.Len(), t.Len()
+		}
+		return s, nil
+	case reflect.Map:
+		values, err := typeSchema(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		if visiting[t] {
+			return nil, fmt.Errorf("recursive type %v", t)
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		return objectSchema(t, visiting)
+	}
+	return nil, fmt.Errorf("no JSON for %v", t)
+}
+
+// objectSchema returns the schema of struct t, with the fields of embedded
+// structs inlined as encoding/json does.
+func objectSchema(t reflect.Type, visiting map[reflect.Type]bool) (map[string]any, error) {
+	props := map[string]any{}
+	required := []string{}
+	var add func(t reflect.Type) error
+	add = func(t reflect.Type) error {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if ft := f.Type; f.Anonymous && name == "" {
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					if err := add(ft); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			s, err := typeSchema(f.Type, visiting)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			if desc := f.Tag.Get("description"); desc != "" {
+				s["description"] = desc
+			}
+			props[name] = s
+			if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") && f.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+		return nil
+	}
+	if err := add(t); err != nil {
+		return nil, err
+	}
+	return map[string]any{"type": "object", "properties": props, "required": required, "additionalProperties": false}, nil
+}
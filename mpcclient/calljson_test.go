@@ -0,0 +1,95 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type vmReport struct {
+	VM      string    `json:"vm" description:"name of the VM"`
+	CPU     float64   `json:"cpu"`
+	Disks   []string  `json:"disks,omitempty"`
+	Checked time.Time `json:"checked"`
+	Owner   *struct {
+		Team string `json:"team"`
+	} `json:"owner"`
+}
+
+func TestCallAgentJSON(t *testing.T) {
+	srv, reqs := scriptedServer(t,
+		"Sure! web01 is at 42% CPU.",
+		`{"vm": "web01", "cpu": "42%", "checked": "2026-10-14T08:00:00Z"}`,
+		"```json\n"+`{"vm": "web01", "cpu": 42, "checked": "2026-10-14T08:00:00Z", "owner": {"team": "ops"}}`+"\n```")
+	c, _ := NewClient(srv.URL)
+
+	var report vmReport
+	resp, err := c.CallAgentJSON(context.Background(), "vm", "cpu of web01?", &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.VM != "web01" || report.CPU != 42 || report.Owner == nil || report.Owner.Team != "ops" || report.Checked.Hour() != 8 || resp == nil {
+		t.Errorf("report = %+v", report)
+	}
+	if len(*reqs) != 3 {
+		t.Fatalf("server saw %d calls, want 3", len(*reqs))
+	}
+	first := (*reqs)[0]
+	if first.Format != FormatJSON || !strings.HasPrefix(first.Prompt, "cpu of web01?\n\n") || !strings.Contains(first.Prompt, `"description":"name of the VM"`) {
+		t.Errorf("first request = %+v", first)
+	}
+	if repair := (*reqs)[2].Prompt; !strings.Contains(repair, "/cpu:") {
+		t.Errorf("repair prompt lacks the violation:\n%s", repair)
+	}
+
+	if _, err := c.CallAgentJSON(context.Background(), "vm", "cpu?", report); err == nil {
+		t.Error("non-pointer target accepted")
+	}
+	giveUp, _ := scriptedServer(t, "no idea")
+	c, _ = NewClient(giveUp.URL)
+	if _, err := c.CallAgentJSON(context.Background(), "vm", "cpu?", &report, WithSchemaRepairs(0)); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("err = %v, want ErrSchemaMismatch", err)
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	type base struct {
+		ID string `json:"id"`
+	}
+	type item struct {
+		base
+		Count  uint              `json:"count,omitempty"`
+		Tags   map[string]string `json:"tags,omitzero"`
+		Coords [2]float64        `json:"coords"`
+		Blob   []byte            `json:"blob,omitempty"`
+		Hidden string            `json:"-"`
+		Any    any               `json:"any,omitempty"`
+	}
+	s, err := SchemaFor([]item{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"type":"array"`, `"required":["id","coords"]`, `"additionalProperties":false`, `"minimum":0`, `"maxItems":2`, `"contentEncoding":"base64"`} {
+		if !strings.Contains(s.raw, want) {
+			t.Errorf("schema lacks %s: %s", want, s.raw)
+		}
+	}
+	if strings.Contains(s.raw, "Hidden") {
+		t.Errorf("schema has a skipped field: %s", s.raw)
+	}
+	if again, _ := SchemaFor(&[]item{}); again != s {
+		t.Error("schema not cached")
+	}
+
+	type node struct {
+		Next *node `json:"next"`
+	}
+	if _, err := SchemaFor(node{}); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("recursive type: err = %v", err)
+	}
+	if _, err := SchemaFor(struct{ C chan int }{}); err == nil {
+		t.Error("channel field accepted")
+	}
+}
@@ -0,0 +1,342 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoInteraction is returned in replay mode for a call the cassette has no
+// recording of.
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+// Redacted replaces secret values in recorded requests.
+const Redacted = "[REDACTED]"
+
+// CassetteMode selects whether a cassette records calls or replays them.
+type CassetteMode int
+
+const (
+	// ModeReplay answers every call from the cassette, never contacting the
+	// server. Calls without a recording fail with ErrNoInteraction.
+	ModeReplay CassetteMode = iota
+	// ModeRecord sends every call and records it, replacing the cassette's
+	// previous contents.
+	ModeRecord
+	// ModeAuto replays calls the cassette has a recording of and sends and
+	// records the rest.
+	ModeAuto
+)
+
+// CassetteConfig configures WithCassette.
+type CassetteConfig struct {
+	// Path is the cassette file. Files ending in .yaml or .yml are written
+	// as YAML, anything else as JSON.
+	Path string
+	Mode CassetteMode
+	// SecretKeys lists context and parameter keys whose values are
+	// replaced with Redacted before recording, matched case-insensitively
+	// as substrings. It defaults to DefaultSecretKeys.
+	SecretKeys []string
+	// Redact, if set, scrubs secrets from prompts or results. It is applied
+	// after SecretKeys, both before a call is matched and before it is
+	// written, so it must give the same result when applied twice.
+	Redact func(*Interaction)
+}
+
+// DefaultSecretKeys are the key fragments redacted when CassetteConfig
+// lists none.
+var DefaultSecretKeys = []string{"password", "secret", "token", "api_key", "apikey", "authorization", "credential"}
+
+// Interaction is one recorded agent call.
+type Interaction struct {
+	Agent      string         `json:"agent"`
+	Request    AgentRequest   `json:"request"`
+	Response   *AgentResponse `json:"response,omitempty"`
+	Error      *RecordedError `json:"error,omitempty"`
+	RecordedAt time.Time      `json:"recorded_at"`
+}
+
+// RecordedError is a failed call as stored in a cassette. Server errors
+// replay as an *APIError, anything else as a plain error with the same
+// message.
+type RecordedError struct {
+	Message    string `json:"message"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Code       string `json:"code,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// WithCassette records agent calls to a cassette file or replays them from
+// it, so demos and tests run offline and deterministically. Calls are
+// matched on agent and request; identical calls replay their recordings in
+// order, the last one repeating. Secrets in request context and
+// parameters are redacted before anything is written, and WithRedaction
+// scrubs prompts and results as well. Only agent calls are
+// recorded; discovery, health and streaming requests go to the server.
+func WithCassette(cfg CassetteConfig) Option {
+	return func(c *Client) {
+		c.cassette = &cfg
+	}
+}
+
+// recorder is the transport installed by WithCassette.
+type recorder struct {
+	next Transport
+	cfg  CassetteConfig
+
+	mu       sync.Mutex
+	cassette Cassette
+	// played counts the replays of each match key.
+	played map[string]int
+}
+
+func newRecorder(next Transport, cfg CassetteConfig) (*recorder, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("mpcclient: cassette path is required")
+	}
+	if cfg.SecretKeys == nil {
+		cfg.SecretKeys = DefaultSecretKeys
+	}
+	r := &recorder{next: next, cfg: cfg, played: make(map[string]int)}
+	if cfg.Mode == ModeRecord {
+		return r, nil
+	}
+	cas, err := LoadCassette(cfg.Path)
+	switch {
+	case err == nil:
+		r.cassette = *cas
+	case cfg.Mode == ModeAuto && errors.Is(err, os.ErrNotExist):
+	default:
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recorder) RoundTrip(ctx context.Context, call *Call) (*AgentResponse, error) {
+	it := Interaction{Agent: call.Agent, Request: call.Request}
+	it.Request.Attachments = nil
+	r.redact(&it)
+	key := matchKey(&it)
+
+	if r.cfg.Mode != ModeRecord {
+		if found, ok := r.lookup(key); ok {
+			closeAttachments(call.Request.Attachments)
+			return found.replay()
+		}
+		if r.cfg.Mode == ModeReplay {
+			closeAttachments(call.Request.Attachments)
+			return nil, fmt.Errorf("%w for agent %q", ErrNoInteraction, call.Agent)
+		}
+	}
+
+	resp, err := r.next.RoundTrip(ctx, call)
+	if ctx.Err() != nil {
+		// A cancelled call says nothing about the agent; don't record it.
+		return resp, err
+	}
+	it.RecordedAt = time.Now().UTC()
+	if err != nil {
+		it.Error = recordError(err)
+	} else {
+		recorded := *resp
+		it.Response = &recorded
+	}
+	if r.cfg.Redact != nil {
+		r.cfg.Redact(&it)
+	}
+	if serr := r.record(key, it); serr != nil && err == nil {
+		return nil, serr
+	}
+	return resp, err
+}
+
+// Close closes the wrapped transport.
+func (r *recorder) Close() error {
+	if closer, ok := r.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// lookup returns the next recording for key.
+func (r *recorder) lookup(key string) (Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matches []Interaction
+	for _, it := range r.cassette.Interactions {
+		if matchKey(&it) == key {
+			matches = append(matches, it)
+		}
+	}
+	if len(matches) == 0 {
+		return Interaction{}, false
+	}
+	n := r.played[key]
+	r.played[key]++
+	return matches[min(n, len(matches)-1)], true
+}
+
+// record appends it and rewrites the cassette. In auto mode it also counts
+// as played, so a later identical call moves on to the next recording.
+func (r *recorder) record(key string, it Interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, it)
+	r.played[key]++
+	if err := r.cassette.Save(r.cfg.Path); err != nil {
+		return fmt.Errorf("mpcclient: %w", err)
+	}
+	return nil
+}
+
+// redact replaces the values of secret-looking keys in its request and
+// then applies the configured Redact function.
+func (r *recorder) redact(it *Interaction) {
+	it.Request.Context = redactMap(it.Request.Context, r.cfg.SecretKeys)
+	it.Request.Parameters = redactMap(it.Request.Parameters, r.cfg.SecretKeys)
+	if r.cfg.Redact != nil {
+		r.cfg.Redact(it)
+	}
+}
+
+func redactMap(m map[string]any, keys []string) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		if isSecretKey(k, keys) {
+			out[k] = Redacted
+		} else if sub, ok := v.(map[string]any); ok {
+			out[k] = redactMap(sub, keys)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func isSecretKey(k string, keys []string) bool {
+	k = strings.ToLower(k)
+	for _, s := range keys {
+		if strings.Contains(k, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchKey identifies the call an interaction records.
+func matchKey(it *Interaction) string {
+	b, _ := json.Marshal(struct {
+		Agent   string       `json:"agent"`
+		Request AgentRequest `json:"request"`
+	}{it.Agent, it.Request})
+	// Round-trip through a generic value so that a request read back from
+	// a cassette keys the same as the one that was recorded.
+	var v any
+	if json.Unmarshal(b, &v) == nil {
+		b, _ = json.Marshal(v)
+	}
+	return string(b)
+}
+
+func recordError(err error) *RecordedError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return &RecordedError{Message: apiErr.Message, StatusCode: apiErr.StatusCode, Code: apiErr.Code, RequestID: apiErr.RequestID}
+	}
+	return &RecordedError{Message: err.Error()}
+}
+
+// replay returns the recorded outcome.
+func (it Interaction) replay() (*AgentResponse, error) {
+	if e := it.Error; e != nil {
+		if e.StatusCode != 0 {
+			return nil, &APIError{StatusCode: e.StatusCode, Message: e.Message, Code: e.Code, RequestID: e.RequestID}
+		}
+		return nil, errors.New(e.Message)
+	}
+	if it.Response == nil {
+		return nil, errors.New("recorded interaction has neither response nor error")
+	}
+	resp := *it.Response
+	return &resp, nil
+}
+
+// LoadCassette reads the cassette at path.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: load cassette: %w", err)
+	}
+	if isYAML(path) {
+		// Cassettes are defined by their JSON form; YAML is converted
+		// through a generic value so JSON tags and raw payloads apply.
+		var v any
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("mpcclient: load cassette %s: %w", path, err)
+		}
+		if b, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("mpcclient: load cassette %s: %w", path, err)
+		}
+	}
+	var cas Cassette
+	if err := json.Unmarshal(b, &cas); err != nil {
+		return nil, fmt.Errorf("mpcclient: load cassette %s: %w", path, err)
+	}
+	return &cas, nil
+}
+
+// Save writes the cassette to path, replacing the file atomically.
+func (cas *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(cas, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save cassette: %w", err)
+	}
+	if isYAML(path) {
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("save cassette: %w", err)
+		}
+		if b, err = yaml.Marshal(v); err != nil {
+			return fmt.Errorf("save cassette: %w", err)
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cassette-*")
+	if err != nil {
+		return fmt.Errorf("save cassette: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save cassette: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save cassette: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save cassette: %w", err)
+	}
+	return nil
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,117 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func countingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Prompt == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"bad prompt","code":"invalid_request"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"agent":"vm","result":"answer %d to %s"}`, n, req.Prompt)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	for _, name := range []string{"calls.json", "calls.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			srv, calls := countingServer(t)
+			ctx := context.Background()
+			req := AgentRequest{Prompt: "cpu", Context: map[string]any{"vm": "web01", "api_token": "s3cret"}}
+
+			rec, err := NewClient(srv.URL, WithCassette(CassetteConfig{Path: path, Mode: ModeRecord}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 2 {
+				if _, err := rec.Invoke(ctx, "vm", req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := rec.CallAgent(ctx, "vm", "fail"); err == nil {
+				t.Fatal("want error for fail prompt")
+			}
+			b, _ := os.ReadFile(path)
+			if strings.Contains(string(b), "s3cret") || !strings.Contains(string(b), Redacted) {
+				t.Errorf("secret not redacted:\n%s", b)
+			}
+
+			srv.Close()
+			play, err := NewClient(srv.URL, WithCassette(CassetteConfig{Path: path, Mode: ModeReplay}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range []string{"answer 1 to cpu", "answer 2 to cpu", "answer 2 to cpu"} {
+				resp, err := play.Invoke(ctx, "vm", req)
+				if err != nil || resp.Result != want {
+					t.Errorf("replay %d = %+v, %v; want %q", i, resp, err, want)
+				}
+			}
+			_, err = play.CallAgent(ctx, "vm", "fail")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "invalid_request" {
+				t.Errorf("replayed error = %v", err)
+			}
+			if _, err := play.CallAgent(ctx, "vm", "unrecorded"); !errors.Is(err, ErrNoInteraction) {
+				t.Errorf("err = %v, want ErrNoInteraction", err)
+			}
+			if calls.Load() != 3 {
+				t.Errorf("server saw %d calls, want 3", calls.Load())
+			}
+		})
+	}
+}
+
+func TestCassetteAuto(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auto.json")
+	srv, calls := countingServer(t)
+	ctx := context.Background()
+	cfg := CassetteConfig{Path: path, Mode: ModeAuto, Redact: func(it *Interaction) {
+		it.Request.Prompt = strings.ReplaceAll(it.Request.Prompt, "hunter2", Redacted)
+	}}
+
+	for range 2 {
+		c, err := NewClient(srv.URL, WithCassette(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.CallAgent(ctx, "vm", "login hunter2")
+		if err != nil || resp.Result != "answer 1 to login hunter2" {
+			t.Errorf("call = %+v, %v", resp, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server saw %d calls, want 1", calls.Load())
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), `"prompt": "login hunter2"`) {
+		t.Errorf("prompt not redacted:\n%s", b)
+	}
+}
+
+func TestCassetteReplayMissingFile(t *testing.T) {
+	_, err := NewClient("", WithCassette(CassetteConfig{Path: filepath.Join(t.TempDir(), "none.json")}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,404 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultBaseURL is the address the workshop MPC server listens on locally.
+const DefaultBaseURL = "http://localhost:8080"
+
+// defaultStreamReconnects is how many times a stream is re-established when
+// its connection fails before the first chunk.
+const defaultStreamReconnects = 2
+
+// maxErrorBody bounds how much of a failed response body is kept on an APIError.
+const maxErrorBody = 4 << 10
+
+// Client calls agents hosted by an MPC server.
+type Client struct {
+	baseURL *url.URL
+	// tenant is the tenant of the server requests go to, if any.
+	tenant     string
+	httpClient *http.Client
+	headers    http.Header
+	budget     Budget
+
+	defaultAgent     string
+	streamReconnects int
+	strictDecoding   bool
+	retry            RetryPolicy
+	rand             func() float64
+	auth             Authenticator
+	signingSecret    []byte
+	transport        Transport
+	throttle         *throttle
+	breakers         *breakerSet
+	cache            *CacheConfig
+	flights          flightGroup
+	maxAttachment    int64
+	interceptors     []Interceptor
+	cassette         *CassetteConfig
+	offline          *OfflineConfig
+	pool             *PoolConfig
+	tls              *TLSConfig
+	proxy            *string
+	redaction        *RedactionConfig
+	endpoints        *balancer
+	fallbacks        map[string][]Target
+	hooks            []CallHook
+	postProcessors   []PostProcessor
+	language         string
+	translator       string
+	usage            usageMeter
+	stats            statsCollector
+	handler          Handler
+	tools            map[string]Tool
+	toolOrder        []string
+	maxToolRounds    int
+	logger           *slog.Logger
+	logCfg           LogConfig
+	idempotency      bool
+	dryRun           bool
+	compression      Encoding
+	compressMinSize  int
+	metadata         map[string]string
+
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagator     propagation.TextMapPropagator
+	tel            telemetry
+}
+
+// NewClient returns a Client for the MPC server at baseURL. An empty baseURL
+// selects DefaultBaseURL.
+func NewClient(baseURL string, opts ...Option) (*Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	u, err := parseBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		baseURL: u,
+		headers: make(http.Header),
+
+		streamReconnects: defaultStreamReconnects,
+		rand:             defaultRand,
+		throttle:         &throttle{},
+		maxAttachment:    DefaultMaxAttachmentSize,
+		maxToolRounds:    DefaultMaxToolRounds,
+		propagator:       propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		stats:            statsCollector{since: time.Now()},
+	}
+	c.transport = httpTransport{c: c}
+	for _, opt := range opts {
+		opt(c)
+	}
+	switch {
+	case c.httpClient == nil:
+		t := newPooledTransport(c.poolConfig())
+		if err := c.configureTransport(t); err != nil {
+			return nil, err
+		}
+		c.httpClient = &http.Client{Transport: t}
+	case c.pool != nil:
+		return nil, errors.New("mpcclient: WithPool cannot be combined with WithHTTPClient")
+	case c.tls != nil, c.proxy != nil:
+		return nil, errors.New("mpcclient: WithTLS and WithProxy cannot be combined with WithHTTPClient")
+	}
+	if _, ok := encoders[c.compression]; c.compression != "" && !ok {
+		return nil, fmt.Errorf("mpcclient: unsupported compression %q, want gzip or zstd", c.compression)
+	}
+	if _, ok := c.transport.(httpTransport); c.dryRun && !ok {
+		return nil, errors.New("mpcclient: WithDryRun works with the HTTP transport only")
+	}
+	if _, ok := c.transport.(*grpcTransport); ok && c.tenant != "" {
+		return nil, errors.New("mpcclient: WithTenant cannot be combined with WithGRPCTransport")
+	}
+	if c.endpoints != nil {
+		if err := c.endpoints.init(u); err != nil {
+			return nil, err
+		}
+	}
+	if c.cassette != nil {
+		cfg := *c.cassette
+		if r := c.redactor(); r != nil {
+			redact := cfg.Redact
+			cfg.Redact = func(it *Interaction) {
+				r.RedactInteraction(it)
+				if redact != nil {
+					redact(it)
+				}
+			}
+		}
+		rec, err := newRecorder(c.transport, cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.transport = rec
+	}
+	if c.offline != nil {
+		off, err := newOffline(c.transport, *c.offline, c.logger)
+		if err != nil {
+			return nil, err
+		}
+		c.transport = off
+	}
+	c.handler = c.buildChain()
+	if c.tel, err = newTelemetry(c.tracerProvider, c.meterProvider); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseBaseURL parses the URL of an MPC server.
+func parseBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: parse base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("mpcclient: base URL %q must use http or https", raw)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
+
+// Close releases resources held by the client's transport, such as a
+// WebSocket connection, and closes idle HTTP connections. The client must
+// not be used afterwards.
+func (c *Client) Close() error {
+	defer c.CloseIdleConnections()
+	if closer, ok := c.transport.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// BaseURL returns the server address the client sends requests to.
+func (c *Client) BaseURL() string {
+	return c.baseURL.String()
+}
+
+// CallAgent sends prompt to the named agent and returns its response.
+// Cancelling ctx aborts the request in flight.
+func (c *Client) CallAgent(ctx context.Context, agentName, prompt string, opts ...CallOption) (*AgentResponse, error) {
+	return c.Invoke(ctx, agentName, AgentRequest{Prompt: prompt}, opts...)
+}
+
+// Invoke sends a fully specified request to the named agent and returns its
+// response. An empty agentName selects the agent set with WithDefaultAgent.
+// Calls to an agent configured with WithFallback that fail are rerouted.
+func (c *Client) Invoke(ctx context.Context, agentName string, req AgentRequest, opts ...CallOption) (*AgentResponse, error) {
+	if agentName == "" {
+		agentName = c.defaultAgent
+	}
+	if agentName == "" {
+		return nil, errors.New("mpcclient: agent name is required")
+	}
+	ctx = ensureRequestID(ctx)
+	start := time.Now()
+	o := c.callOptions(opts)
+	ctx = c.idempotencyContext(ctx, o)
+	req = c.redactOutgoing(o.request(req))
+	resp, err := c.invokeAgent(ctx, agentName, req, o)
+	if len(c.fallbacks[agentName]) > 0 && !errors.Is(err, ErrDryRun) {
+		resp, err = c.fallback(ctx, agentName, req, opts, resp, err)
+	}
+	if err == nil {
+		resp, err = c.postProcess(resp, o)
+	}
+	if err == nil {
+		resp = c.translate(ctx, resp, o)
+	}
+	if err != nil {
+		err = fmt.Errorf("mpcclient: call agent %q: %w", agentName, classify(err))
+		c.observe(ctx, Exchange{Agent: agentName, Prompt: req.Prompt, Err: err, Start: start})
+		return nil, err
+	}
+	c.observe(ctx, Exchange{Agent: agentName, Prompt: req.Prompt, Response: resp, Start: start})
+	return resp, nil
+}
+
+// invokeAgent makes one call to agentName under its own deadline,
+// repairing responses that fail the call's schema.
+func (c *Client) invokeAgent(ctx context.Context, agentName string, req AgentRequest, o callOptions) (*AgentResponse, error) {
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+
+	resp, err := c.invokeObserved(ctx, agentName, req, o)
+	for attempt := 1; err == nil && o.schema != nil && len(resp.ToolCalls) == 0; attempt++ {
+		problems := o.schema.Validate(resp)
+		if problems == nil {
+			break
+		}
+		if attempt > o.schemaRepairs {
+			err = &SchemaError{Problems: problems, Response: resp, Attempts: attempt}
+			break
+		}
+		req = repairRequest(req, resp, o.schema, problems)
+		resp, err = c.invokeObserved(nextIdempotencyStep(ctx, "repair", attempt), agentName, req, o)
+	}
+	return resp, err
+}
+
+// invokeObserved is invoke wrapped in the client's tracing, metrics and
+// logging.
+func (c *Client) invokeObserved(ctx context.Context, agentName string, req AgentRequest, o callOptions) (*AgentResponse, error) {
+	ctx, end := c.instrument(ctx, "call_agent", agentName)
+	start := time.Now()
+	resp, err := c.invoke(ctx, agentName, req, o)
+	end(resp, err)
+	c.logCall(ctx, "mpcclient: agent call", agentName, req.Prompt, start, resp, err)
+	return resp, err
+}
+
+// invoke answers the call from the cache, shares it with an identical
+// coalesced call in flight, or sends it through the circuit breaker and
+// transport.
+func (c *Client) invoke(ctx context.Context, agentName string, req AgentRequest, o callOptions) (*AgentResponse, error) {
+	key, cacheable := c.cache.cacheable(agentName, req)
+	if cacheable && !o.bypassCache {
+		if resp, ok := c.cache.Cache.Get(key); ok {
+			return resp, nil
+		}
+	}
+	if o.coalesce && len(req.Attachments) == 0 {
+		return c.flights.do(ctx, CacheKey(agentName, req), func(ctx context.Context) (*AgentResponse, error) {
+			return c.sendCall(ctx, agentName, req, o, key, cacheable)
+		})
+	}
+	return c.sendCall(ctx, agentName, req, o, key, cacheable)
+}
+
+// sendCall sends the call through the circuit breaker and transport, caching
+// its response under key if cacheable.
+func (c *Client) sendCall(ctx context.Context, agentName string, req AgentRequest, o callOptions, key string, cacheable bool) (*AgentResponse, error) {
+	done, err := c.breakers.allow(agentName)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.transport.RoundTrip(ctx, &Call{Agent: agentName, Request: req, OnStatus: o.onStatus})
+	done(err)
+	if err == nil {
+		if resp.RequestID == "" {
+			resp.RequestID = RequestIDFromContext(ctx)
+		}
+		c.usage.record(agentName, resp)
+	}
+	if err == nil && cacheable && !resp.Canned {
+		c.cache.Cache.Set(key, resp, c.cache.TTL)
+	}
+	return resp, err
+}
+
+// do sends a JSON request to path and decodes a JSON response into out.
+// A nil in sends no body; a nil out discards the response body.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	body, err := encodeBody(in)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return c.decode(res, out)
+}
+
+// decode reads the JSON body of res into out. A nil out discards it. A
+// body that is not JSON fails with a *ContentTypeError.
+func (c *Client) decode(res *http.Response, out any) error {
+	if err := checkJSON(res); err != nil {
+		return err
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	dec := json.NewDecoder(res.Body)
+	if c.strictDecoding {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// encodeBody marshals in as a JSON request body. A nil in yields no body.
+func encodeBody(in any) ([]byte, error) {
+	if in == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	return b, nil
+}
+
+// newRequest builds a request to path carrying the client's default headers,
+// the request ID from ctx or a fresh one, the idempotency key and job
+// callback URL from ctx if any, and, when body is non-nil, a JSON body.
+func (c *Client) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	if c.tenant != "" {
+		path = "/tenant/" + url.PathEscape(c.tenant) + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, r)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	for k, vs := range c.headers {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		id = newRequestID()
+	}
+	req.Header.Set(requestIDHeader, id)
+	if key := idempotencyKeyFrom(ctx); key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	if url := callbackURLFrom(ctx); url != "" {
+		req.Header.Set(callbackURLHeader, url)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// send passes req through the client's interceptor chain. On success the
+// caller owns the response body.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	res, err := c.handler.Do(req)
+	return res, classify(err)
+}
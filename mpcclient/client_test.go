@@ -0,0 +1,94 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCallAgent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/agent/azureVmMetricsAgent" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("X-Workshop"); got != "team-1" {
+			t.Errorf("X-Workshop = %q", got)
+		}
+		var body struct{ Prompt string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"agent":  "azureVmMetricsAgent",
+			"prompt": body.Prompt,
+			"result": "CPU: 45%",
+			"status": "success",
+		})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithHeader("X-Workshop", "team-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.CallAgent(context.Background(), "azureVmMetricsAgent", "check cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "CPU: 45%" || resp.Prompt != "check cpu" || resp.Status != "success" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestCallAgentAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"Invalid request"}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CallAgent(context.Background(), "x", "")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "Invalid request" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestNewClientRejectsBadScheme(t *testing.T) {
+	if _, err := NewClient("ftp://example.com"); err == nil {
+		t.Fatal("expected error for ftp scheme")
+	}
+}
+
+func TestCallAgentTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c, err := NewClient(srv.URL, WithTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CallAgent(context.Background(), "slow", "hi", WithRequestTimeout(20*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
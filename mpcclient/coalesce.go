@@ -0,0 +1,99 @@
+package mpcclient
+
+import (
+	"context"
+	"sync"
+)
+
+// WithCoalescing shares one agent call between the concurrent calls made
+// with this option for the same agent and request: the first is sent, and
+// the others wait for its response instead of sending their own. This
+// saves duplicate model calls when several parts of a UI ask the same
+// question at once. The shared call runs until every caller waiting on it
+// has given up, so cancelling one caller's context does not fail the
+// others. The callers receive copies of one response, with its request
+// ID; status updates go to the first caller only. Calls with attachments
+// are never coalesced.
+func WithCoalescing() CallOption {
+	return func(o *callOptions) {
+		o.coalesce = true
+	}
+}
+
+// flight is a call shared by coalesced callers.
+type flight struct {
+	done    chan struct{}
+	resp    *AgentResponse
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup tracks the calls in flight by key. The zero value is ready
+// to use.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do returns the result of fn, run once for all the callers asking for key
+// at the same time. fn runs under a context carrying the values and
+// deadline of the first caller's, cancelled once no caller waits.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*AgentResponse, error)) (*AgentResponse, error) {
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		var (
+			shared context.Context
+			cancel context.CancelFunc
+		)
+		if deadline, ok := ctx.Deadline(); ok {
+			shared, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		} else {
+			shared, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		}
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		if g.flights == nil {
+			g.flights = make(map[string]*flight)
+		}
+		g.flights[key] = f
+		go func() {
+			f.resp, f.err = fn(shared)
+			cancel()
+			g.forget(key, f)
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		if f.resp == nil {
+			return nil, f.err
+		}
+		resp := *f.resp
+		return &resp, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		if f.waiters--; f.waiters == 0 {
+			f.cancel()
+			g.forgetLocked(key, f)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// forget removes f from the group, unless another flight took its key.
+func (g *flightGroup) forget(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.forgetLocked(key, f)
+}
+
+func (g *flightGroup) forgetLocked(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
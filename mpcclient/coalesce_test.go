@@ -0,0 +1,115 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowAgentServer answers every call once release is closed, counting the
+// calls it receives and those whose client gave up.
+func slowAgentServer(t *testing.T) (*httptest.Server, chan struct{}, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	release := make(chan struct{})
+	var calls, canceled atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// The server notices a client going away only once it has read
+		// the body.
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-release:
+			w.Write([]byte(`{"agent":"vm","result":"42%","request_id":"r1"}`))
+		case <-r.Context().Done():
+			canceled.Add(1)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, release, &calls, &canceled
+}
+
+func TestCoalescing(t *testing.T) {
+	srv, release, calls, _ := slowAgentServer(t)
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make([]*AgentResponse, 5)
+	errs := make([]error, 5)
+	for i := range results {
+		wg.Go(func() {
+			results[i], errs[i] = c.CallAgent(ctx, "vm", "cpu?", WithCoalescing())
+		})
+	}
+	// One caller gives up; the call goes on for the others.
+	cctx, cancel := context.WithCancel(ctx)
+	quit := make(chan error, 1)
+	go func() {
+		_, err := c.CallAgent(cctx, "vm", "cpu?", WithCoalescing())
+		quit <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-quit; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller: err = %v", err)
+	}
+	close(release)
+	wg.Wait()
+	for i, resp := range results {
+		if errs[i] != nil || resp.Result != "42%" {
+			t.Errorf("caller %d: %+v, %v", i, resp, errs[i])
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("callers share one response value")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("server received %d calls, want 1", n)
+	}
+
+	// Later calls, and calls without the option, are sent.
+	if _, err := c.CallAgent(ctx, "vm", "cpu?", WithCoalescing()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(ctx, "vm", "cpu?"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("server received %d calls, want 3", n)
+	}
+}
+
+func TestCoalescingAbandoned(t *testing.T) {
+	srv, _, calls, canceled := slowAgentServer(t)
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			if _, err := c.CallAgent(ctx, "vm", "cpu?", WithCoalescing()); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("err = %v, want the deadline", err)
+			}
+		})
+	}
+	wg.Wait()
+	deadline := time.Now().Add(2 * time.Second)
+	for canceled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if calls.Load() != 1 || canceled.Load() != 1 {
+		t.Errorf("calls = %d, canceled = %d; want one call, cancelled once every caller left", calls.Load(), canceled.Load())
+	}
+}
@@ -0,0 +1,191 @@
+package mpcclient
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// CodeBlock is a fenced code block in a response.
+type CodeBlock struct {
+	// Language is the block's language tag, such as "go", lowercased; it
+	// is empty for untagged blocks.
+	Language string
+	// Filename is the slash-separated path the fence names, as in
+	// ```go main.go, ```go:cmd/main.go or ```python title="app.py", if any.
+	Filename string
+	Code     string
+}
+
+// CodeBlocks returns the fenced code blocks of the response's result, in
+// order. A block left open at the end of the result, as in a truncated
+// answer, runs to the end.
+func (r *AgentResponse) CodeBlocks() []CodeBlock {
+	var blocks []CodeBlock
+	var cur *CodeBlock
+	var fence string
+	var code strings.Builder
+	sc := bufio.NewScanner(strings.NewReader(r.Result))
+	sc.Buffer(nil, len(r.Result)+1)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimLeft(line, " ")
+		if cur == nil {
+			if f, info, ok := openFence(trimmed, len(line)-len(trimmed)); ok {
+				fence = f
+				cur = &CodeBlock{}
+				cur.Language, cur.Filename = parseInfo(info)
+			}
+			continue
+		}
+		if len(line)-len(trimmed) <= 3 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+			cur.Code = code.String()
+			blocks = append(blocks, *cur)
+			cur = nil
+			code.Reset()
+			continue
+		}
+		code.WriteString(line)
+		code.WriteByte('\n')
+	}
+	if cur != nil {
+		cur.Code = code.String()
+		blocks = append(blocks, *cur)
+	}
+	return blocks
+}
+
+// openFence reports whether line, indented by indent spaces, opens a code
+// fence, and returns the fence and its info string.
+func openFence(line string, indent int) (fence, info string, ok bool) {
+	if indent > 3 || len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return "", "", false
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 {
+		return "", "", false
+	}
+	fence, info = line[:n], strings.TrimSpace(line[n:])
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return fence, info, true
+}
+
+// parseInfo splits a fence's info string into a language and a filename.
+func parseInfo(info string) (lang, filename string) {
+	fields := strings.Fields(info)
+	for i, f := range fields {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			switch strings.ToLower(k) {
+			case "title", "file", "filename", "path":
+				filename = strings.Trim(v, `"'`)
+			}
+			continue
+		}
+		if i == 0 {
+			if l, name, ok := strings.Cut(f, ":"); ok {
+				lang, filename = l, name
+			} else if strings.ContainsAny(f, "./") {
+				filename = f
+			} else {
+				lang = f
+			}
+		} else if filename == "" && strings.ContainsAny(f, "./") {
+			filename = f
+		}
+	}
+	if lang == "" && filename != "" {
+		lang = strings.TrimPrefix(path.Ext(filename), ".")
+	}
+	return strings.ToLower(lang), filename
+}
+
+// codeExtensions maps language tags onto the file extensions
+// WriteCodeBlocks gives unnamed blocks.
+var codeExtensions = map[string]string{
+	"go": ".go", "python": ".py", "py": ".py", "javascript": ".js", "js": ".js",
+	"typescript": ".ts", "ts": ".ts", "bash": ".sh", "sh": ".sh", "shell": ".sh",
+	"json": ".json", "yaml": ".yaml", "yml": ".yaml", "toml": ".toml", "html": ".html",
+	"css": ".css", "sql": ".sql", "rust": ".rs", "rs": ".rs", "java": ".java",
+	"c": ".c", "cpp": ".cpp", "c++": ".cpp", "markdown": ".md", "md": ".md",
+	"hcl": ".tf", "terraform": ".tf", "dockerfile": ".dockerfile", "powershell": ".ps1",
+}
+
+// WriteCodeBlocks writes the response's code blocks into dir, creating it
+// if needed, and returns the paths written. Blocks naming a file are
+// written there, relative to dir, with the last block winning when
+// several name the same file; others are written as block-N with an
+// extension following their language. Names that are absolute or would
+// escape dir are rejected before anything is written, and writes never
+// follow symbolic links out of dir.
+func (r *AgentResponse) WriteCodeBlocks(dir string) ([]string, error) {
+	blocks := r.CodeBlocks()
+	names := make([]string, len(blocks))
+	for i, b := range blocks {
+		name := b.Filename
+		if name == "" {
+			ext, ok := codeExtensions[b.Language]
+			if !ok {
+				ext = ".txt"
+			}
+			name = fmt.Sprintf("block-%d%s", i+1, ext)
+		}
+		name = filepath.FromSlash(name)
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("mpcclient: code block %d: unsafe file name %q", i+1, b.Filename)
+		}
+		names[i] = name
+	}
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mpcclient: write code blocks: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: write code blocks: %w", err)
+	}
+	defer root.Close()
+	var written []string
+	for i, b := range blocks {
+		if d := filepath.Dir(names[i]); d != "." {
+			if err := root.MkdirAll(d, 0o755); err != nil {
+				return written, fmt.Errorf("mpcclient: write code block %d: %w", i+1, err)
+			}
+		}
+		if err := root.WriteFile(names[i], []byte(b.Code), 0o644); err != nil {
+			return written, fmt.Errorf("mpcclient: write code block %d: %w", i+1, err)
+		}
+		p := filepath.Join(dir, names[i])
+		if !slices.Contains(written, p) {
+			written = append(written, p)
+		}
+	}
+	return written, nil
+}
+
+// ExtractCodeBlocks returns a post-processor writing the code blocks of
+// every response into dir, as WriteCodeBlocks does, and listing the paths
+// written in the response's "code_files" metadata.
+func ExtractCodeBlocks(dir string) PostProcessor {
+	return func(resp *AgentResponse) error {
+		paths, err := resp.WriteCodeBlocks(dir)
+		if err != nil {
+			return err
+		}
+		if len(paths) > 0 {
+			if resp.Metadata == nil {
+				resp.Metadata = make(map[string]any)
+			}
+			resp.Metadata["code_files"] = paths
+		}
+		return nil
+	}
+}
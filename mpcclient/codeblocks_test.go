@@ -0,0 +1,107 @@
+package mpcclient
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const codeAnswer = "Here is the program:\n\n" +
+	"```go main.go\npackage main\n\nfunc main() {}\n```\n\n" +
+	"And its test, with a fence inside:\n\n" +
+	"````markdown title=\"docs/README.md\"\n```sh\ngo run .\n```\n````\n\n" +
+	"```python\nprint('hi')\n```\n\n" +
+	"~~~\nplain\n~~~\n\n" +
+	"```sh:scripts/run.sh\n./run"
+
+func TestCodeBlocks(t *testing.T) {
+	got := (&AgentResponse{Result: codeAnswer}).CodeBlocks()
+	want := []CodeBlock{
+		{Language: "go", Filename: "main.go", Code: "package main\n\nfunc main() {}\n"},
+		{Language: "markdown", Filename: "docs/README.md", Code: "```sh\ngo run .\n```\n"},
+		{Language: "python", Code: "print('hi')\n"},
+		{Code: "plain\n"},
+		{Language: "sh", Filename: "scripts/run.sh", Code: "./run\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CodeBlocks() =\n%+v\nwant\n%+v", got, want)
+	}
+	if blocks := (&AgentResponse{Result: "no code here, just `inline`"}).CodeBlocks(); blocks != nil {
+		t.Errorf("CodeBlocks() of prose = %+v", blocks)
+	}
+}
+
+func TestParseFenceInfo(t *testing.T) {
+	for _, tc := range []struct{ info, lang, file string }{
+		{"go", "go", ""},
+		{"Go main.go", "go", "main.go"},
+		{"main.go", "go", "main.go"},
+		{"go:cmd/app/main.go", "go", "cmd/app/main.go"},
+		{`python title="app.py"`, "python", "app.py"},
+		{"shell script", "shell", ""},
+		{"", "", ""},
+	} {
+		if lang, file := parseInfo(tc.info); lang != tc.lang || file != tc.file {
+			t.Errorf("parseInfo(%q) = %q, %q; want %q, %q", tc.info, lang, file, tc.lang, tc.file)
+		}
+	}
+}
+
+func TestWriteCodeBlocks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	paths, err := (&AgentResponse{Result: codeAnswer}).WriteCodeBlocks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"main.go", "docs/README.md", "block-3.py", "block-4.txt", "scripts/run.sh"}
+	if len(paths) != len(want) {
+		t.Fatalf("wrote %v, want %v", paths, want)
+	}
+	for i, name := range want {
+		if p := filepath.Join(dir, filepath.FromSlash(name)); paths[i] != p {
+			t.Errorf("paths[%d] = %s, want %s", i, paths[i], p)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "main.go")); err != nil || !strings.HasPrefix(string(b), "package main") {
+		t.Errorf("main.go = %q, %v", b, err)
+	}
+}
+
+func TestWriteCodeBlocksRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../escape.go", "/etc/passwd", "a/../../b.go"} {
+		dir := t.TempDir()
+		resp := &AgentResponse{Result: "```go ok.go\nx\n```\n```go " + name + "\ny\n```"}
+		if _, err := resp.WriteCodeBlocks(dir); err == nil || !strings.Contains(err.Error(), "unsafe") {
+			t.Errorf("%s: err = %v, want unsafe file name", name, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+			t.Errorf("%s: wrote %v before rejecting", name, entries)
+		}
+	}
+
+	// A symbolic link inside dir does not lead writes out of it.
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	resp := &AgentResponse{Result: "```go link/evil.go\nx\n```"}
+	if _, err := resp.WriteCodeBlocks(dir); err == nil {
+		t.Error("wrote through a symbolic link out of dir")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.go")); err == nil {
+		t.Error("file created outside dir")
+	}
+}
+
+func TestExtractCodeBlocks(t *testing.T) {
+	dir := t.TempDir()
+	resp := &AgentResponse{Result: "```go main.go\npackage main\n```"}
+	if err := ExtractCodeBlocks(dir)(resp); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := resp.Metadata["code_files"].([]string); len(files) != 1 || files[0] != filepath.Join(dir, "main.go") {
+		t.Errorf("code_files = %v", resp.Metadata["code_files"])
+	}
+}
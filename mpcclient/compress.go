@@ -0,0 +1,180 @@
+package mpcclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding is a content coding compressing request bodies.
+type Encoding string
+
+// Encodings for WithCompression.
+const (
+	EncodingGzip Encoding = "gzip"
+	// EncodingZstd compresses faster than gzip, and usually smaller.
+	EncodingZstd Encoding = "zstd"
+)
+
+// DefaultCompressionMinSize is the smallest request body, in bytes, that
+// WithCompression compresses unless told otherwise.
+const DefaultCompressionMinSize = 1024
+
+// acceptEncoding is the Accept-Encoding header of every request.
+const acceptEncoding = "zstd, gzip"
+
+// WithCompression compresses the bodies of requests of at least minSize
+// bytes with enc, for servers that decode them, such as mpcserver. Bodies
+// streamed without a known size, such as those of requests with
+// attachments, are compressed whatever their size. A minSize of zero or
+// less selects DefaultCompressionMinSize.
+//
+// Responses are decompressed whether or not it is set: the client asks for
+// zstd or gzip and decodes what the server sends, streams included, as it
+// arrives.
+func WithCompression(enc Encoding, minSize int) Option {
+	return func(c *Client) {
+		if minSize <= 0 {
+			minSize = DefaultCompressionMinSize
+		}
+		c.compression, c.compressMinSize = enc, minSize
+	}
+}
+
+// encoders pools the writers compressing request bodies, by encoding.
+var encoders = map[Encoding]*sync.Pool{
+	EncodingGzip: {New: func() any { return gzip.NewWriter(nil) }},
+	EncodingZstd: {New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// encoder is a pooled gzip or zstd writer.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// newEncoder returns a writer compressing to w with enc, to be returned
+// with putEncoder once closed.
+func newEncoder(enc Encoding, w io.Writer) (encoder, error) {
+	pool, ok := encoders[enc]
+	if !ok {
+		return nil, fmt.Errorf("mpcclient: unsupported compression %q, want gzip or zstd", enc)
+	}
+	zw := pool.Get().(encoder)
+	zw.Reset(w)
+	return zw, nil
+}
+
+func putEncoder(enc Encoding, zw encoder) {
+	zw.Reset(nil)
+	encoders[enc].Put(zw)
+}
+
+// compressRequest returns req with its body compressed, if the client
+// compresses requests and the body is large enough or of unknown size.
+func (c *Client) compressRequest(req *http.Request) (*http.Request, error) {
+	if c.compression == "" || req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return req, nil
+	}
+	if req.ContentLength > 0 && req.ContentLength < int64(c.compressMinSize) {
+		return req, nil
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set("Content-Encoding", string(c.compression))
+	if req.ContentLength <= 0 {
+		pr, pw := io.Pipe()
+		zw, err := newEncoder(c.compression, pw)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			_, err := io.Copy(zw, req.Body)
+			req.Body.Close()
+			err = errors.Join(err, zw.Close())
+			putEncoder(c.compression, zw)
+			pw.CloseWithError(err)
+		}()
+		r.Body, r.ContentLength, r.GetBody = pr, -1, nil
+		return r, nil
+	}
+
+	var b bytes.Buffer
+	zw, err := newEncoder(c.compression, &b)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(zw, req.Body)
+	req.Body.Close()
+	err = errors.Join(err, zw.Close())
+	putEncoder(c.compression, zw)
+	if err != nil {
+		return nil, fmt.Errorf("compress request: %w", err)
+	}
+	body := b.Bytes()
+	r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return r, nil
+}
+
+// decompressResponse has res's body decoded as it is read, if the server
+// compressed it.
+func decompressResponse(res *http.Response) {
+	enc := Encoding(strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))))
+	if enc != EncodingGzip && enc != EncodingZstd {
+		return
+	}
+	res.Body = &decodingBody{enc: enc, body: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+}
+
+// decodingBody decodes a compressed response body. The decoder is created
+// on the first read, so that a stream's headers are available before its
+// first event has arrived.
+type decodingBody struct {
+	enc  Encoding
+	body io.ReadCloser
+	r    io.ReadCloser
+}
+
+func (b *decodingBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		var err error
+		switch b.enc {
+		case EncodingGzip:
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(b.body); err == nil {
+				b.r = zr
+			}
+		case EncodingZstd:
+			var zr *zstd.Decoder
+			if zr, err = zstd.NewReader(b.body, zstd.WithDecoderConcurrency(1)); err == nil {
+				b.r = zr.IOReadCloser()
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("decode %s response: %w", b.enc, err)
+		}
+	}
+	return b.r.Read(p)
+}
+
+func (b *decodingBody) Close() error {
+	var err error
+	if b.r != nil {
+		err = b.r.Close()
+	}
+	return errors.Join(err, b.body.Close())
+}
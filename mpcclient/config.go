@@ -0,0 +1,93 @@
+package mpcclient
+
+import (
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/config"
+)
+
+// NewClientFromConfig returns a client for the servers, tenant, default agent,
+// credentials, signing secret, timeout, retry policy, proxy, TLS settings,
+// metadata, compression, offline fixtures and dry run in cfg, as loaded by config.Load. opts are applied afterwards and override
+// the configuration.
+func NewClientFromConfig(cfg config.Config, opts ...Option) (*Client, error) {
+	var fromCfg []Option
+	if cfg.Tenant != "" {
+		fromCfg = append(fromCfg, WithTenant(cfg.Tenant))
+	}
+	if cfg.DefaultAgent != "" {
+		fromCfg = append(fromCfg, WithDefaultAgent(cfg.DefaultAgent))
+	}
+	if len(cfg.Servers) > 0 {
+		ec := EndpointConfig{}
+		if cfg.Balancing == config.BalanceLeastLatency {
+			ec.Balancing = LeastLatency
+		}
+		fromCfg = append(fromCfg, WithEndpoints(ec, cfg.Servers...))
+	}
+	if cfg.Timeout > 0 {
+		fromCfg = append(fromCfg, WithTimeout(time.Duration(cfg.Timeout)))
+	}
+
+	switch a := cfg.Auth; {
+	case a.APIKey != "":
+		fromCfg = append(fromCfg, WithAuthenticator(APIKey{Key: a.APIKey, Header: a.APIKeyHeader}))
+	case a.BearerToken != "":
+		fromCfg = append(fromCfg, WithBearerToken(a.BearerToken))
+	case a.AzureAD != nil:
+		auth, err := NewAzureADAuthenticator(AzureADConfig{
+			TenantID:     a.AzureAD.TenantID,
+			ClientID:     a.AzureAD.ClientID,
+			ClientSecret: a.AzureAD.ClientSecret,
+			Scope:        a.AzureAD.Scope,
+			Authority:    a.AzureAD.Authority,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fromCfg = append(fromCfg, WithAuthenticator(auth))
+	}
+	if cfg.Auth.SigningSecret != "" {
+		fromCfg = append(fromCfg, WithRequestSigning([]byte(cfg.Auth.SigningSecret)))
+	}
+
+	if r := cfg.Retry; r.MaxAttempts > 0 {
+		p := DefaultRetryPolicy()
+		p.MaxAttempts = r.MaxAttempts
+		if r.BaseDelay > 0 {
+			p.BaseDelay = time.Duration(r.BaseDelay)
+		}
+		if r.MaxDelay > 0 {
+			p.MaxDelay = time.Duration(r.MaxDelay)
+		}
+		fromCfg = append(fromCfg, WithRetryPolicy(p))
+	}
+	if cfg.Proxy != "" {
+		fromCfg = append(fromCfg, WithProxy(cfg.Proxy))
+	}
+	if t := cfg.TLS; t != (config.TLS{}) {
+		fromCfg = append(fromCfg, WithTLS(TLSConfig{
+			CAFile:             t.CAFile,
+			CertFile:           t.CertFile,
+			KeyFile:            t.KeyFile,
+			InsecureSkipVerify: t.InsecureSkipVerify,
+		}))
+	}
+	if len(cfg.Metadata) > 0 {
+		fromCfg = append(fromCfg, WithDefaultMetadata(cfg.Metadata))
+	}
+	if o := cfg.Offline; o.Dir != "" {
+		oc := OfflineConfig{Dir: o.Dir}
+		if o.Mode == config.OfflineFallback {
+			oc.Mode = OfflineFallback
+		}
+		fromCfg = append(fromCfg, WithOffline(oc))
+	}
+	if cfg.Compression != "" {
+		fromCfg = append(fromCfg, WithCompression(Encoding(cfg.Compression), 0))
+	}
+	if cfg.DryRun {
+		fromCfg = append(fromCfg, WithDryRun())
+	}
+	return NewClient(cfg.Server, append(fromCfg, opts...)...)
+}
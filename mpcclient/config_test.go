@@ -0,0 +1,65 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/config"
+)
+
+func TestNewClientFromConfig(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("X-Team-Key") != "s3cret" {
+			t.Errorf("API key header not sent: %v", r.Header)
+		}
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"agent": r.URL.Path, "result": "ok"})
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.Server = srv.URL
+	cfg.DefaultAgent = "opsAgent"
+	cfg.Auth = config.Auth{APIKey: "s3cret", APIKeyHeader: "X-Team-Key"}
+	cfg.Retry = config.Retry{MaxAttempts: 2, BaseDelay: config.Duration(1)}
+	c, err := NewClientFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.CallAgent(context.Background(), "", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Agent != "/agent/opsAgent" || attempts != 2 {
+		t.Errorf("called %q in %d attempts, want /agent/opsAgent in 2", resp.Agent, attempts)
+	}
+}
+
+func TestNewClientFromConfigTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(okHandler))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, serverCAPEM(srv), 0o644)
+
+	cfg := config.Default()
+	cfg.Server = srv.URL
+	cfg.TLS.CAFile = caFile
+	c, err := NewClientFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Package mpcclient is a Go client for the workshop MPC server.
+//
+// A Client is created once with NewClient and reused for every call:
+//
+//	c, err := mpcclient.NewClient("http://localhost:8080")
+//	if err != nil {
+//		return err
+//	}
+//	resp, err := c.CallAgent(ctx, "azureVmMetricsAgent", "Check CPU for VM 'webserver01'")
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(resp.Result)
+//
+// Every call carries a request ID in the X-Request-ID header, which the
+// server logs and returns in AgentResponse.RequestID and APIError.RequestID.
+// Set it with WithRequestID to follow one task through a chain of agents.
+//
+// A Budget, set with WithTimeBudget or WithCallBudget, bounds a call as a
+// whole, each of its attempts, and the silence a stream may keep, so that
+// retries and reconnects never outlast the caller's deadline.
+// RemainingBudget tells interceptors how much time a call has left.
+//
+// WithModel, WithTemperature, WithMaxTokens and WithStopSequences set the
+// generation parameters of a call, which servers check against the agent's
+// AgentInfo before passing them on.
+//
+// WithMinAgentVersion and WithRequiredCapabilities pin a call to agents of
+// a version, or able to stream, take tools or read attachments. Servers
+// check them against the agent's AgentInfo and refuse the call with an
+// error matching ErrIncompatibleAgent rather than have an older agent
+// quietly ignore what it does not support.
+//
+// WithRequestSigning signs each attempt of a call with a secret shared
+// with the server, for servers that refuse unsigned requests.
+//
+// Responses compressed with zstd or gzip are decoded as they arrive,
+// streams included. WithCompression compresses large request bodies too,
+// such as prompts carrying logs, for servers that decode them.
+//
+// A response that is not JSON, or not an event stream for a stream, such as
+// the HTML page of a proxy or captive portal, fails with a
+// *ContentTypeError matching ErrUnexpectedContentType. It carries the
+// status, content type and the start of the body; for a non-2xx status it
+// also unwraps to the *APIError, so a 504 page still matches ErrTimeout and
+// is retried.
+//
+// WithDryRun builds each request in full, authenticated and signed, and
+// returns it in a *DryRunError instead of sending it; its WriteTo prints the
+// request, credentials redacted, to check how prompts and parameters reach
+// the server.
+//
+// Client.Stats reports what the client's calls have done, by agent: the
+// number of calls and errors, the errors by kind, latency percentiles and
+// the bytes sent and received. It is collected in memory and needs no
+// metrics backend, for when OpenTelemetry is more than a task calls for.
+//
+// Agents and Jobs return an Iterator over a listing, fetching it a page,
+// of WithPageSize items, at a time as Next advances; NewIterator builds one
+// over other paged sources.
+//
+// WithEndpoints spreads calls over several servers hosting the same agents,
+// ejecting those that keep failing; Endpoints reports their health.
+//
+// Embed fetches embedding vectors from agents that produce them, batching
+// large inputs; CosineSimilarity compares the results.
+//
+// CallAgentJSON decodes an agent's answer straight into a Go value: it asks
+// for JSON matching the schema SchemaFor derives from the value's type, and
+// has the agent correct answers that do not match, as WithResponseSchema
+// does for schemas written by hand.
+//
+// CallAgentBatch runs many calls with bounded concurrency, and MapReduce
+// builds such a batch from a dataset and folds its results into one
+// value, as when labeling items.
+//
+// WithPostProcessors tidies responses before calls return them, with
+// PostProcessors such as StripJSONFence and NormalizeWhitespace;
+// WithPostProcessing overrides them for a single call. WithTargetLanguage
+// goes on to have results translated by a translator agent, leaving their
+// code untouched.
+//
+// CodeBlocks pulls the fenced code out of a response and WriteCodeBlocks
+// saves it under a directory, refusing paths that would leave it;
+// ExtractCodeBlocks does the same as a post-processor.
+//
+// StreamAgentTo writes a stream straight to an io.Writer such as a
+// terminal or file, flushing it as WithFlush says and holding back partial
+// lines under WithLineBuffering, and summarizes what it wrote. Streams
+// whose connection drops reconnect by themselves and, when the server sends
+// event IDs, resume after the last chunk received with a Last-Event-ID
+// header rather than losing the partial output. StreamAgentChan delivers
+// the chunks on a channel instead, for select loops: the chunk channel is
+// always closed when the stream ends, the error channel then yields one
+// value, and a consumer that stops reading holds the stream back until it
+// cancels the context.
+//
+// WithMetadata labels a call, and WithDefaultMetadata every call of a
+// client, with key-value metadata such as the user, team or exercise, which
+// the Go server records in its logs and audit records.
+//
+// WithIdempotencyKey, or WithIdempotency for a random key per call, sends
+// an Idempotency-Key that a call's retries repeat, so that a server
+// deduplicating calls runs the agent once even when a response is lost.
+// WithCoalescing dedups on the client instead: identical calls made at the
+// same time share one request and its response.
+//
+// WithBoard lets the agent of a call read and write the server's context
+// board of a session, so that the calls of a workflow can hand each other
+// intermediate results. SeedBoard writes the board's starting values
+// before the first call, and Board and BoardValue inspect it afterwards.
+//
+// A Session's TruncationPolicy fits its history into MaxTokens with a
+// TrimStrategy: DropOldest, SummarizeWith, which has an agent summarize the
+// oldest turns, or ImportanceWeighted, which keeps the exchanges a function
+// scores highest. CountTokens estimates a history's size with a pluggable
+// estimator, and FitContext picks the most important retrieved context
+// that fits a window.
+//
+// WithSummarizer gives a session a summarization memory: once the history
+// passes a Summarizer's turn or token threshold, a summarizer agent
+// replaces the older turns with a summary, so long conversations keep
+// their start within budget.
+//
+// Session.Export writes a conversation as FormatOpenAIJSONL, the chat
+// format of fine-tuning datasets and many other tools, or as a Markdown
+// transcript, and ImportSession continues a conversation from either.
+//
+// WithOffline answers agent calls from a directory of canned responses,
+// keyed by agent and a hash of the prompt with fuzzy matching on its
+// words, so that workshops carry on when the network or model backend is
+// down; OfflineFallback uses them only for calls that fail. Canned
+// responses are logged and marked Canned.
+//
+// # Concurrency
+//
+// A Client is safe for concurrent use by any number of goroutines once
+// NewClient returns; its configuration is fixed by the options and never
+// changes afterwards. The cache, circuit breakers, rate limiter and usage
+// counters it shares between calls are internally synchronized. Share one
+// Client rather than creating one per goroutine: its HTTP transport pools
+// connections, keeping up to DefaultMaxIdleConnsPerHost idle connections
+// to the server and negotiating HTTP/2 over TLS. Tune the pool with
+// WithPool, and release idle connections with CloseIdleConnections.
+//
+// A Session serializes its own sends, so concurrent sends on one session
+// take turns; use a session per conversation for parallel work.
+package mpcclient
@@ -0,0 +1,103 @@
+package mpcclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// ErrDryRun matches the error returned by the calls of a client created
+// with WithDryRun, a *DryRunError holding the request that was not sent.
+var ErrDryRun = errors.New("dry run")
+
+// WithDryRun makes the client build every request in full, through the
+// interceptors that authenticate, sign and trace it, and then return it
+// in a *DryRunError instead of sending it, so that the construction of
+// prompts and parameters can be checked without calling an agent. The
+// client makes no connection at all: authenticators other than APIKey and
+// BearerToken, which may fetch tokens, are not called, and a redacted
+// Authorization header stands in for their credentials. Dry runs work
+// with the HTTP transport only.
+func WithDryRun() Option {
+	return func(c *Client) {
+		c.dryRun = true
+	}
+}
+
+// DryRunError is the request a client created with WithDryRun did not
+// send.
+type DryRunError struct {
+	Method string
+	URL    string
+	// Header holds the request's headers, credentials redacted.
+	Header http.Header
+	// Body is the request body, such as an AgentRequest as JSON.
+	Body []byte
+}
+
+func (e *DryRunError) Error() string {
+	return fmt.Sprintf("dry run: %s %s not sent", e.Method, e.URL)
+}
+
+// Is makes errors.Is(err, ErrDryRun) hold.
+func (e *DryRunError) Is(target error) bool {
+	return target == ErrDryRun
+}
+
+// WriteTo writes the request for reading: the request line, the headers
+// sorted by name and the body, indented if it is JSON.
+func (e *DryRunError) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\n", e.Method, e.URL)
+	for _, k := range slices.Sorted(maps.Keys(e.Header)) {
+		for _, v := range e.Header[k] {
+			fmt.Fprintf(&b, "%s: %s\n", k, v)
+		}
+	}
+	if len(e.Body) > 0 {
+		var body bytes.Buffer
+		if json.Indent(&body, e.Body, "", "  ") != nil {
+			body.Reset()
+			body.Write(e.Body)
+		}
+		fmt.Fprintf(&b, "\n%s\n", bytes.TrimRight(body.Bytes(), "\n"))
+	}
+	return b.WriteTo(w)
+}
+
+// dryRunTrip ends the interceptor chain of a dry-run client, returning req
+// in a *DryRunError rather than sending it.
+func (c *Client) dryRunTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		body = b
+	}
+	h := req.Header.Clone()
+	for k := range h {
+		if sensitiveHeader(k) {
+			h[k] = []string{redacted}
+		}
+	}
+	return nil, &DryRunError{Method: req.Method, URL: req.URL.Redacted(), Header: h, Body: body}
+}
+
+// offlineAuthenticator reports whether a dry run may call auth, because it
+// sets static credentials without fetching them.
+func offlineAuthenticator(auth Authenticator) bool {
+	switch auth.(type) {
+	case APIKey, BearerToken:
+		return true
+	default:
+		return false
+	}
+}
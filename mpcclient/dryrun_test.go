@@ -0,0 +1,75 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run sent %s %s", r.Method, r.URL)
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, WithDryRun(), WithAPIKey("s3cret"), WithRequestSigning([]byte("k")),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Invoke(context.Background(), "vm", AgentRequest{Prompt: "Check CPU", Parameters: map[string]any{"hours": 6}},
+		WithModel("small"))
+	var dr *DryRunError
+	if !errors.Is(err, ErrDryRun) || !errors.As(err, &dr) {
+		t.Fatalf("err = %v", err)
+	}
+	if dr.Method != http.MethodPost || dr.URL != srv.URL+"/agent/vm" {
+		t.Errorf("request line = %s %s", dr.Method, dr.URL)
+	}
+	if dr.Header.Get("X-API-Key") != redacted || dr.Header.Get(signatureHeader) == "" || dr.Header.Get(requestIDHeader) == "" {
+		t.Errorf("header = %v", dr.Header)
+	}
+	var out bytes.Buffer
+	dr.WriteTo(&out)
+	for _, want := range []string{"POST " + srv.URL + "/agent/vm\n", "X-Api-Key: [REDACTED]\n", `"prompt": "Check CPU"`, `"hours": 6`, `"model": "small"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteTo lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "s3cret") {
+		t.Errorf("credentials leaked:\n%s", out.String())
+	}
+	if _, err := c.ListAgents(context.Background()); !errors.Is(err, ErrDryRun) {
+		t.Errorf("ListAgents: err = %v", err)
+	}
+	if err := c.StreamAgent(context.Background(), "vm", "hi", func(Chunk) error { return nil }); !errors.Is(err, ErrDryRun) {
+		t.Errorf("StreamAgent: err = %v", err)
+	}
+}
+
+func TestDryRunSkipsFetchingCredentials(t *testing.T) {
+	fetched := false
+	auth := AuthenticatorFunc(func(context.Context, *http.Request) error {
+		fetched = true
+		return nil
+	})
+	c, _ := NewClient("http://mpc.test", WithDryRun(), WithAuthenticator(auth))
+	_, err := c.CallAgent(context.Background(), "vm", "hi")
+	var dr *DryRunError
+	if !errors.As(err, &dr) || fetched || dr.Header.Get("Authorization") != redacted {
+		t.Errorf("err = %v, fetched = %v", err, fetched)
+	}
+
+	if _, err := NewClient("http://mpc.test", WithDryRun(), WithTransport(echoTransport{})); err == nil {
+		t.Error("dry run accepted with another transport")
+	}
+}
+
+type echoTransport struct{}
+
+func (echoTransport) RoundTrip(_ context.Context, call *Call) (*AgentResponse, error) {
+	return &AgentResponse{Agent: call.Agent, Result: call.Request.Prompt}, nil
+}
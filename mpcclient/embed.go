@@ -0,0 +1,136 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+)
+
+// DefaultEmbedBatchSize is the number of texts Embed sends per request
+// unless WithEmbedBatchSize says otherwise.
+const DefaultEmbedBatchSize = 64
+
+// Embeddings is the result of an embeddings call.
+type Embeddings struct {
+	Agent string
+	// Vectors holds one embedding per input text, in input order.
+	Vectors [][]float32
+	// Dimensions is the length of every vector.
+	Dimensions int
+	// RequestIDs holds the server's ID for each batch request sent.
+	RequestIDs []string
+}
+
+// embedRequest and embedResponse are the JSON bodies exchanged with
+// POST /agent/{name}/embed.
+type embedRequest struct {
+	Inputs []string `json:"inputs"`
+}
+
+type embedResponse struct {
+	Agent           string      `json:"agent"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	Dimensions      int         `json:"dimensions"`
+	RequestID       string      `json:"request_id,omitempty"`
+	ExecutionTimeMS float64     `json:"execution_time_ms,omitempty"`
+}
+
+// WithEmbedBatchSize sets how many texts Embed and EmbedDetailed send per
+// request. Servers bound the inputs of one request; the Go server accepts
+// at most 256.
+func WithEmbedBatchSize(n int) CallOption {
+	return func(o *callOptions) {
+		o.embedBatch = n
+	}
+}
+
+// Embed returns an embedding vector for each of texts from the named
+// agent, which must support embeddings; other agents fail with an error
+// matching ErrEmbeddingsUnsupported. Large inputs are split into batches
+// sent one after another, all within the call's timeout. Embeddings always
+// go over HTTP, whatever transport agent calls use.
+func (c *Client) Embed(ctx context.Context, agentName string, texts []string, opts ...CallOption) ([][]float32, error) {
+	res, err := c.EmbedDetailed(ctx, agentName, texts, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.Vectors, nil
+}
+
+// EmbedDetailed is Embed returning the vectors with their dimensions and
+// the IDs of the requests that produced them.
+func (c *Client) EmbedDetailed(ctx context.Context, agentName string, texts []string, opts ...CallOption) (*Embeddings, error) {
+	if agentName == "" {
+		agentName = c.defaultAgent
+	}
+	if agentName == "" {
+		return nil, errors.New("mpcclient: agent name is required")
+	}
+	if len(texts) == 0 {
+		return nil, errors.New("mpcclient: texts to embed are required")
+	}
+	o := c.callOptions(opts)
+	batch := o.embedBatch
+	if batch <= 0 {
+		batch = DefaultEmbedBatchSize
+	}
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	ctx, end := c.instrument(ctx, "embed", agentName)
+
+	res, err := c.embed(ctx, agentName, texts, batch)
+	end(nil, err)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: embed with agent %q: %w", agentName, err)
+	}
+	return res, nil
+}
+
+func (c *Client) embed(ctx context.Context, agentName string, texts []string, batch int) (*Embeddings, error) {
+	path := "/agent/" + url.PathEscape(agentName) + "/embed"
+	res := &Embeddings{Agent: agentName, Vectors: make([][]float32, 0, len(texts))}
+	for start := 0; start < len(texts); start += batch {
+		inputs := texts[start:min(start+batch, len(texts))]
+		var out embedResponse
+		if err := c.do(ctx, http.MethodPost, path, embedRequest{Inputs: inputs}, &out); err != nil {
+			return nil, err
+		}
+		if len(out.Embeddings) != len(inputs) {
+			return nil, fmt.Errorf("server returned %d embeddings for %d inputs", len(out.Embeddings), len(inputs))
+		}
+		for _, v := range out.Embeddings {
+			if res.Dimensions == 0 {
+				res.Dimensions = len(v)
+			}
+			if len(v) != res.Dimensions || len(v) == 0 {
+				return nil, errors.New("server returned embeddings of inconsistent dimensions")
+			}
+		}
+		res.Vectors = append(res.Vectors, out.Embeddings...)
+		res.RequestIDs = append(res.RequestIDs, out.RequestID)
+	}
+	return res, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, from
+// -1 for opposite vectors to 1 for vectors pointing the same way. It
+// returns 0 when the vectors differ in length or either is all zeros.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
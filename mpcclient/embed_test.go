@@ -0,0 +1,102 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// embedServer embeds each input as {len(input), batch number}, recording
+// the size of every batch it receives.
+func embedServer(t *testing.T, batches *[]int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent/embedder/embed" {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte(`{"error":"agent does not support embeddings","code":"embeddings_unsupported"}`))
+			return
+		}
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*batches = append(*batches, len(req.Inputs))
+		out := embedResponse{Agent: "embedder", Dimensions: 2, RequestID: r.Header.Get(requestIDHeader)}
+		for _, in := range req.Inputs {
+			out.Embeddings = append(out.Embeddings, []float32{float32(len(in)), float32(len(*batches))})
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEmbedBatches(t *testing.T) {
+	var batches []int
+	c, _ := NewClient(embedServer(t, &batches).URL, WithStrictDecoding())
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+
+	res, err := c.EmbedDetailed(context.Background(), "embedder", texts, WithEmbedBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || batches[0] != 2 || batches[2] != 1 {
+		t.Errorf("batches = %v, want [2 2 1]", batches)
+	}
+	if res.Dimensions != 2 || len(res.Vectors) != len(texts) || len(res.RequestIDs) != 3 {
+		t.Fatalf("result = %+v", res)
+	}
+	for i, v := range res.Vectors {
+		if int(v[0]) != len(texts[i]) || int(v[1]) != i/2+1 {
+			t.Errorf("vector %d = %v, out of order", i, v)
+		}
+	}
+
+	batches = nil
+	if _, err := c.Embed(context.Background(), "embedder", texts); err != nil || len(batches) != 1 {
+		t.Errorf("default batch size: batches = %v, err = %v", batches, err)
+	}
+}
+
+func TestEmbedErrors(t *testing.T) {
+	var batches []int
+	c, _ := NewClient(embedServer(t, &batches).URL)
+	ctx := context.Background()
+
+	if _, err := c.Embed(ctx, "chat", []string{"hi"}); !errors.Is(err, ErrEmbeddingsUnsupported) {
+		t.Errorf("unsupported agent: err = %v", err)
+	}
+	if _, err := c.Embed(ctx, "embedder", nil); err == nil {
+		t.Error("no texts: Embed succeeded")
+	}
+
+	short := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"agent":"embedder","embeddings":[[1,2]],"dimensions":2}`))
+	}))
+	defer short.Close()
+	c, _ = NewClient(short.URL)
+	if _, err := c.Embed(ctx, "embedder", []string{"a", "b"}); err == nil || !strings.Contains(err.Error(), "1 embeddings for 2 inputs") {
+		t.Errorf("short response: err = %v", err)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 3}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{1, 0}, []float32{1, 1}, math.Sqrt2 / 2},
+		{[]float32{0, 0}, []float32{1, 1}, 0},
+		{[]float32{1}, []float32{1, 1}, 0},
+	} {
+		if got := CosineSimilarity(tc.a, tc.b); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
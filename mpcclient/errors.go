@@ -0,0 +1,330 @@
+package mpcclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentinel errors classifying failures, for use with errors.Is. The error
+// matched is an *APIError, a *TimeoutError for timeouts detected by the
+// client, or a *ContentTypeError for responses that are not JSON; errors.As
+// recovers it with the status, code and request ID.
+var (
+	// ErrAgentNotFound matches a 404 for an agent the server does not know.
+	ErrAgentNotFound = errors.New("agent not found")
+	// ErrJobNotFound matches a 404 for an unknown or expired job.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrUnauthorized matches a 401 or 403: missing, invalid or
+	// insufficient credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited matches a 429.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrQuotaExceeded matches a 429 for an API key that has used its
+	// daily token quota. Unlike other rate limits, it is not retryable.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrTimeout matches a 408 or 504 from the server, and requests the
+	// client gave up on because a deadline passed.
+	ErrTimeout = errors.New("timeout")
+	// ErrServerOverloaded matches a 502 or 503.
+	ErrServerOverloaded = errors.New("server overloaded")
+	// ErrUnsupportedFormat matches a 406 for a format, asked for with
+	// WithFormat, that the agent cannot produce.
+	ErrUnsupportedFormat = errors.New("unsupported response format")
+	// ErrUnsupportedModel matches a 400 for a model, asked for with
+	// WithModel, that the agent does not list. It also matches
+	// ErrInvalidRequest.
+	ErrUnsupportedModel = errors.New("unsupported model")
+	// ErrIncompatibleAgent matches a 412 for a call whose Requirements,
+	// set with WithMinAgentVersion or WithRequiredCapabilities, the agent
+	// or server does not meet. The error's Details name the agent's
+	// version and the capabilities it lacks.
+	ErrIncompatibleAgent = errors.New("incompatible agent")
+	// ErrEmbeddingsUnsupported matches a 501 for embeddings requested from
+	// an agent that does not produce them.
+	ErrEmbeddingsUnsupported = errors.New("embeddings unsupported")
+	// ErrInvalidRequest matches a 400, 413, 415 or 422: a request the
+	// server rejected as malformed or over its limits, which fails again
+	// unless changed.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrRequestTooLarge matches a 413 for a body, prompt, conversation or
+	// attachment over the server's limits.
+	ErrRequestTooLarge = errors.New("request too large")
+	// ErrBoardKeyNotFound matches a 404 for a key a shared context board
+	// does not hold, and ErrBoardFull a 409 for a write over the board's
+	// limits on entries.
+	ErrBoardKeyNotFound = errors.New("board key not found")
+	ErrBoardFull        = errors.New("board full")
+	// ErrUnexpectedContentType matches a response that is neither JSON
+	// nor, for a stream, an event stream: typically the HTML page of a
+	// proxy, load balancer or captive portal in front of the server.
+	ErrUnexpectedContentType = errors.New("unexpected content type")
+)
+
+// Retryable reports whether err is worth retrying later: a timeout, a rate
+// limit, an overloaded server or a transport failure. Cancellation and
+// client errors such as a bad request or missing credentials are not
+// retryable.
+func Retryable(err error) bool {
+	var apiErr *APIError
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, ErrCircuitOpen):
+		return false
+	case errors.As(err, &apiErr):
+		return apiErr.Retryable()
+	case errors.Is(err, ErrTimeout):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// APIError is returned when the MPC server answers with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	// Message is the server's "error" field, or the status text when the
+	// body did not carry one.
+	Message string
+	// Code is the server's machine-readable error code, if any.
+	Code string
+	// Details holds the server's "details" field verbatim.
+	Details json.RawMessage
+	// Body holds the leading bytes of the raw response body.
+	Body string
+	// RequestID is the server's ID for the failed request, from the
+	// X-Request-ID header or the body's "request_id" field, or else the ID
+	// the request was sent with.
+	RequestID string
+	// RetryAfter is the delay requested by the server's Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is match the sentinel error for e's status and code.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAgentNotFound:
+		return e.Code == "agent_not_found" || e.StatusCode == http.StatusNotFound && e.Code == ""
+	case ErrJobNotFound:
+		return e.Code == "job_not_found"
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrQuotaExceeded:
+		return e.Code == "quota_exceeded"
+	case ErrTimeout:
+		return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusGatewayTimeout
+	case ErrServerOverloaded:
+		return e.StatusCode == http.StatusBadGateway || e.StatusCode == http.StatusServiceUnavailable
+	case ErrUnsupportedFormat:
+		return e.Code == "unsupported_format" || e.StatusCode == http.StatusNotAcceptable
+	case ErrUnsupportedModel:
+		return e.Code == "unsupported_model"
+	case ErrIncompatibleAgent:
+		return e.Code == "incompatible_agent"
+	case ErrInvalidRequest:
+		switch e.Code {
+		case "invalid_request", "request_too_large", "prompt_too_long", "unsupported_media_type":
+			return true
+		}
+		switch e.StatusCode {
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+			return true
+		}
+		return false
+	case ErrRequestTooLarge:
+		return e.Code == "request_too_large" || e.Code == "prompt_too_long" || e.StatusCode == http.StatusRequestEntityTooLarge
+	case ErrEmbeddingsUnsupported:
+		return e.Code == "embeddings_unsupported" || e.StatusCode == http.StatusNotImplemented
+	case ErrBoardKeyNotFound:
+		return e.Code == "board_key_not_found"
+	case ErrBoardFull:
+		return e.Code == "board_full"
+	}
+	return false
+}
+
+// Retryable reports whether the same request may succeed later.
+func (e *APIError) Retryable() bool {
+	if errors.Is(e, ErrQuotaExceeded) {
+		return false
+	}
+	return errors.Is(e, ErrRateLimited) || errors.Is(e, ErrTimeout) || errors.Is(e, ErrServerOverloaded)
+}
+
+// TimeoutError reports a request abandoned by the client because its
+// deadline passed. It matches ErrTimeout and unwraps to the underlying
+// error, such as context.DeadlineExceeded.
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string { return e.Err.Error() }
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// Is makes errors.Is(err, ErrTimeout) hold.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// ContentTypeError reports a response in a format other than the one asked
+// for. It matches ErrUnexpectedContentType. A non-2xx response also unwraps
+// to the *APIError for its status, so that it matches, and is retried, as
+// that status would be.
+type ContentTypeError struct {
+	StatusCode  int
+	ContentType string
+	// Snippet is the start of the body, whitespace collapsed, to tell
+	// which page came back.
+	Snippet string
+	// RequestID is the ID the request was sent with: pages not from the
+	// server carry none of their own.
+	RequestID string
+	// Err is the error for a non-2xx status, or nil.
+	Err *APIError
+
+	want string
+}
+
+func (e *ContentTypeError) Error() string {
+	got := "has no content type"
+	if e.ContentType != "" {
+		got = "is " + e.ContentType
+	}
+	return fmt.Sprintf("response %s, not %s (status %d): %q", got, e.want, e.StatusCode, e.Snippet)
+}
+
+func (e *ContentTypeError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrUnexpectedContentType) hold.
+func (e *ContentTypeError) Is(target error) bool {
+	return target == ErrUnexpectedContentType
+}
+
+// maxSnippet bounds ContentTypeError.Snippet, in bytes.
+const maxSnippet = 256
+
+// newContentTypeError returns the error for res, which is not want, with
+// body the leading bytes of its body.
+func newContentTypeError(res *http.Response, want string, body []byte) *ContentTypeError {
+	snippet := strings.Join(strings.Fields(string(body)), " ")
+	if len(snippet) > maxSnippet {
+		snippet = strings.ToValidUTF8(snippet[:maxSnippet], "") + "..."
+	}
+	e := &ContentTypeError{
+		StatusCode:  res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+		Snippet:     snippet,
+		want:        want,
+	}
+	if res.Request != nil {
+		e.RequestID = res.Request.Header.Get(requestIDHeader)
+	}
+	return e
+}
+
+// isJSON reports whether a body of content type ct starting with b is JSON,
+// going by its type or, since not every server sets it, its first byte.
+func isJSON(ct string, b []byte) bool {
+	if jsonType(ct) {
+		return true
+	}
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) == 0 || b[0] == '{' || b[0] == '['
+}
+
+func jsonType(ct string) bool {
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// checkJSON returns a *ContentTypeError if res, a 2xx response, is not
+// JSON. It leaves res.Body to be read from its start either way.
+func checkJSON(res *http.Response) error {
+	ct := res.Header.Get("Content-Type")
+	if jsonType(ct) {
+		return nil
+	}
+	br := bufio.NewReaderSize(res.Body, maxSnippet)
+	b, _ := br.Peek(maxSnippet)
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, res.Body}
+	if isJSON(ct, b) {
+		return nil
+	}
+	return newContentTypeError(res, "JSON", b)
+}
+
+// classify wraps err in a *TimeoutError when it reports a passed deadline,
+// so that it matches ErrTimeout.
+func classify(err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) {
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return &TimeoutError{Err: err}
+	}
+	return err
+}
+
+func newAPIError(res *http.Response) *APIError {
+	b, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	e := &APIError{
+		StatusCode: res.StatusCode,
+		Message:    http.StatusText(res.StatusCode),
+		Body:       string(b),
+		RequestID:  res.Header.Get(requestIDHeader),
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+	var payload AgentError
+	if json.Unmarshal(b, &payload) == nil && strings.TrimSpace(payload.Message) != "" {
+		e.Message = payload.Message
+		e.Code = payload.Code
+		e.Details = payload.Details
+	}
+	if e.RequestID == "" {
+		var id struct {
+			RequestID string `json:"request_id"`
+		}
+		if json.Unmarshal(b, &id) == nil {
+			e.RequestID = id.RequestID
+		}
+	}
+	if e.RequestID == "" && res.Request != nil {
+		e.RequestID = res.Request.Header.Get(requestIDHeader)
+	}
+	return e
+}
+
+// responseError returns the error for res, a non-2xx response: its
+// *APIError, wrapped in a *ContentTypeError if the body is not JSON.
+func responseError(res *http.Response) error {
+	apiErr := newAPIError(res)
+	if isJSON(res.Header.Get("Content-Type"), []byte(apiErr.Body)) {
+		return apiErr
+	}
+	e := newContentTypeError(res, "JSON", []byte(apiErr.Body))
+	e.Err = apiErr
+	return e
+}
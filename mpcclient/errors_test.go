@@ -0,0 +1,213 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAPIErrorSentinels(t *testing.T) {
+	tests := []struct {
+		status    int
+		body      string
+		want      error
+		retryable bool
+	}{
+		{http.StatusNotFound, `{"error":"agent \"x\" not found","code":"agent_not_found"}`, ErrAgentNotFound, false},
+		{http.StatusUnauthorized, `{"error":"missing token"}`, ErrUnauthorized, false},
+		{http.StatusForbidden, `{"error":"forbidden"}`, ErrUnauthorized, false},
+		{http.StatusTooManyRequests, `{"error":"slow down"}`, ErrRateLimited, true},
+		{http.StatusGatewayTimeout, `{"error":"upstream timeout"}`, ErrTimeout, true},
+		{http.StatusServiceUnavailable, `{"error":"busy"}`, ErrServerOverloaded, true},
+		{http.StatusBadRequest, `{"error":"prompt is required","code":"invalid_request"}`, ErrInvalidRequest, false},
+		{http.StatusUnsupportedMediaType, `{"error":"content type","code":"unsupported_media_type"}`, ErrInvalidRequest, false},
+		{http.StatusRequestEntityTooLarge, `{"error":"prompt too long","code":"prompt_too_long"}`, ErrRequestTooLarge, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-ID", "req-1")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c, _ := NewClient(srv.URL)
+			_, err := c.CallAgent(context.Background(), "x", "hi")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want match for %v", err, tt.want)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status || apiErr.RequestID != "req-1" {
+				t.Errorf("APIError = %+v", apiErr)
+			}
+			if got := Retryable(err); got != tt.retryable {
+				t.Errorf("Retryable = %v, want %v", got, tt.retryable)
+			}
+			for _, other := range []error{ErrAgentNotFound, ErrUnauthorized, ErrRateLimited, ErrTimeout, ErrServerOverloaded} {
+				if other != tt.want && errors.Is(err, other) {
+					t.Errorf("err also matches %v", other)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIErrorQuotaExceeded(t *testing.T) {
+	err := error(&APIError{StatusCode: http.StatusTooManyRequests, Code: "quota_exceeded", RetryAfter: time.Hour})
+	if !errors.Is(err, ErrQuotaExceeded) || !errors.Is(err, ErrRateLimited) {
+		t.Errorf("quota error does not match ErrQuotaExceeded and ErrRateLimited")
+	}
+	if Retryable(err) {
+		t.Error("spent quota reported as retryable")
+	}
+	if errors.Is(&APIError{StatusCode: http.StatusTooManyRequests, Code: "rate_limited"}, ErrQuotaExceeded) {
+		t.Error("rate limit matches ErrQuotaExceeded")
+	}
+}
+
+func TestAPIErrorRequestIDFromBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"boom","code":"agent_error","request_id":"req-2"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	_, err := c.CallAgent(context.Background(), "x", "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RequestID != "req-2" || apiErr.Code != "agent_error" {
+		t.Errorf("err = %#v", err)
+	}
+	if Retryable(err) {
+		t.Error("500 reported as retryable")
+	}
+}
+
+func TestErrorsSurviveRetriesAndInterceptors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"slow down"}`))
+	}))
+	defer srv.Close()
+
+	wrap := func(next Handler) Handler {
+		return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.Do(req)
+			if err != nil {
+				err = fmt.Errorf("audit: %w", err)
+			}
+			return res, err
+		})
+	}
+	c, _ := NewClient(srv.URL,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, RetryableStatus: []int{http.StatusTooManyRequests}}),
+		WithInterceptor(wrap))
+	_, err := c.CallAgent(context.Background(), "x", "hi")
+	if calls.Load() != 3 {
+		t.Errorf("server saw %d calls, want 3", calls.Load())
+	}
+	var apiErr *APIError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.Message != "slow down" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestClientTimeoutMatchesErrTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c, _ := NewClient(srv.URL)
+	_, err := c.CallAgent(context.Background(), "x", "hi", WithRequestTimeout(20*time.Millisecond))
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrTimeout wrapping context.DeadlineExceeded", err)
+	}
+	var te *TimeoutError
+	if !errors.As(err, &te) || !Retryable(err) {
+		t.Errorf("err = %#v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.CallAgent(ctx, "x", "hi")
+	if errors.Is(err, ErrTimeout) || Retryable(err) {
+		t.Errorf("cancelled call err = %v, want neither timeout nor retryable", err)
+	}
+}
+
+func TestUnexpectedContentType(t *testing.T) {
+	const gatewayPage = "<html>\r\n<head><title>504 Gateway Time-out</title></head>\r\n<body>\r\n<center><h1>504 Gateway Time-out</h1></center>\r\n</body>\r\n</html>\r\n"
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/agent/gateway", "/agent/gateway/stream":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			w.Write([]byte(gatewayPage))
+		case "/agent/portal", "/agent/portal/stream":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<!DOCTYPE html><html><head><title>Sign in to Hotel WiFi</title></head><body>" + strings.Repeat("<p>Accept the terms.</p>", 50) + "</body></html>"))
+		default:
+			// Untyped JSON is still JSON.
+			w.Write([]byte(`{"result":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, RetryableStatus: []int{http.StatusGatewayTimeout}}))
+	ctx := context.Background()
+
+	_, err := c.CallAgent(WithRequestID(ctx, "req-1"), "gateway", "hi")
+	var cte *ContentTypeError
+	if !errors.Is(err, ErrUnexpectedContentType) || !errors.As(err, &cte) {
+		t.Fatalf("504 page: err = %v", err)
+	}
+	if cte.StatusCode != http.StatusGatewayTimeout || cte.ContentType != "text/html" || cte.RequestID != "req-1" ||
+		!strings.HasPrefix(cte.Snippet, "<html> <head><title>504 Gateway Time-out</title>") {
+		t.Errorf("504 page: %+v", cte)
+	}
+	var apiErr *APIError
+	if !errors.Is(err, ErrTimeout) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusGatewayTimeout || !Retryable(err) {
+		t.Errorf("504 page not classified by its status: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("504 page sent %d times, want 2", calls.Load())
+	}
+
+	calls.Store(0)
+	_, err = c.CallAgent(ctx, "portal", "hi")
+	if !errors.As(err, &cte) || cte.StatusCode != http.StatusOK || cte.Err != nil || errors.As(err, &apiErr) {
+		t.Fatalf("portal: err = %#v", err)
+	}
+	if len(cte.Snippet) > maxSnippet+len("...") || !strings.Contains(err.Error(), "Sign in to Hotel WiFi") ||
+		!strings.Contains(err.Error(), "not JSON (status 200)") {
+		t.Errorf("portal: err = %v", err)
+	}
+	if Retryable(err) || calls.Load() != 1 {
+		t.Errorf("portal page retried: %d calls, Retryable = %v", calls.Load(), Retryable(err))
+	}
+
+	err = c.StreamAgent(ctx, "portal", "hi", func(Chunk) error { return nil })
+	if !errors.As(err, &cte) || !strings.Contains(err.Error(), "not an event stream") {
+		t.Errorf("portal stream: err = %v", err)
+	}
+	if err := c.StreamAgent(ctx, "gateway", "hi", func(Chunk) error { return nil }); !errors.Is(err, ErrUnexpectedContentType) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("gateway stream: err = %v", err)
+	}
+
+	if resp, err := c.CallAgent(ctx, "json", "hi"); err != nil || resp.Result != "ok" {
+		t.Errorf("untyped JSON = %+v, %v", resp, err)
+	}
+}
@@ -0,0 +1,113 @@
+package mpcclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Target is an agent a call can be routed to.
+type Target struct {
+	// Agent is the name of the agent to call.
+	Agent string
+	// Client is the client the call is sent with, for a target on another
+	// MPC server. Nil means the client the fallback is configured on.
+	Client *Client
+}
+
+// Route reports which target answered a call to an agent configured with
+// WithFallback.
+type Route struct {
+	// Agent is the agent that answered.
+	Agent string
+	// BaseURL is the address of the server hosting it.
+	BaseURL string
+	// Fallback is the position of the answering target in the fallback
+	// list, starting at 1; it is 0 when the agent called answered itself.
+	Fallback int
+	// Errors holds the failures of the targets tried before, in order.
+	Errors []error
+}
+
+// FallbackError reports a call that failed on its agent and on every
+// fallback. errors.Is and errors.As match any of the failures.
+type FallbackError struct {
+	// Errors holds the failure of each target, the agent called first.
+	Errors []error
+}
+
+func (e *FallbackError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("all %d targets failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *FallbackError) Unwrap() []error {
+	return e.Errors
+}
+
+// WithFallback routes calls to agent that fail on to targets, tried in
+// order until one answers. A target on another server names the Client to
+// send it with; that client's own fallbacks are not consulted. Every
+// target is called with the call's options, and is bounded separately by
+// its timeout, so a call set to time out reaches the fallbacks too. Calls
+// whose caller's context is done are not rerouted.
+//
+// Responses to agents with fallbacks carry a Route naming the target that
+// answered.
+func WithFallback(agent string, targets ...Target) Option {
+	return func(c *Client) {
+		if c.fallbacks == nil {
+			c.fallbacks = make(map[string][]Target)
+		}
+		c.fallbacks[agent] = append(c.fallbacks[agent], targets...)
+	}
+}
+
+// fallback continues a call to agentName that ended with resp and err
+// through the agent's fallbacks.
+func (c *Client) fallback(ctx context.Context, agentName string, req AgentRequest, opts []CallOption, resp *AgentResponse, err error) (*AgentResponse, error) {
+	var errs []error
+	target := Target{Agent: agentName, Client: c}
+	for i, next := range c.fallbacks[agentName] {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target, classify(err)))
+		target = next
+		if target.Client == nil {
+			target.Client = c
+		}
+		if c.logger != nil {
+			c.logger.LogAttrs(ctx, slog.LevelWarn, "mpcclient: falling back",
+				slog.String("agent", agentName), slog.String("target", target.String()), slog.Int("fallback", i+1), c.logError(err))
+		}
+		resp, err = target.Client.invokeAgent(ctx, target.Agent, req, target.Client.callOptions(opts))
+		if err == nil {
+			routed := *resp
+			routed.Route = &Route{Agent: target.Agent, BaseURL: target.Client.BaseURL(), Fallback: i + 1, Errors: errs}
+			return &routed, nil
+		}
+	}
+	if err != nil {
+		if errs == nil {
+			return nil, err
+		}
+		return nil, &FallbackError{Errors: append(errs, fmt.Errorf("%s: %w", target, classify(err)))}
+	}
+	routed := *resp
+	routed.Route = &Route{Agent: agentName, BaseURL: c.BaseURL()}
+	return &routed, nil
+}
+
+// String returns the target's agent name, qualified by the server address
+// when it has a client of its own.
+func (t Target) String() string {
+	if t.Client == nil {
+		return t.Agent
+	}
+	return t.Agent + "@" + t.Client.BaseURL()
+}
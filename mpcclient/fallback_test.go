@@ -0,0 +1,130 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// agentServer answers /agent/{name} with handlers[name], or 404 for agents
+// it does not host.
+func agentServer(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	for name, h := range handlers {
+		mux.HandleFunc("POST /agent/"+name, h)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func answer(result string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AgentResponse{Agent: strings.TrimPrefix(r.URL.Path, "/agent/"), Result: result})
+	}
+}
+
+// stall answers after a second, outlasting the tests' deadlines.
+func stall(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+}
+
+func TestFallbackAgent(t *testing.T) {
+	srv := agentServer(t, map[string]http.HandlerFunc{
+		"metrics": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"backend down"}`, http.StatusBadGateway)
+		},
+		"metricsV2": answer("cpu 40%"),
+	})
+	c, _ := NewClient(srv.URL, WithFallback("metrics", Target{Agent: "metricsV2"}))
+
+	resp, err := c.CallAgent(context.Background(), "metrics", "cpu?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "cpu 40%" || resp.Route == nil || resp.Route.Agent != "metricsV2" || resp.Route.Fallback != 1 || resp.Route.BaseURL != srv.URL {
+		t.Fatalf("resp = %+v, route %+v", resp, resp.Route)
+	}
+	var apiErr *APIError
+	if len(resp.Route.Errors) != 1 || !errors.As(resp.Route.Errors[0], &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("route errors = %v", resp.Route.Errors)
+	}
+}
+
+func TestFallbackServerOnTimeout(t *testing.T) {
+	slow := agentServer(t, map[string]http.HandlerFunc{
+		"metrics": stall,
+	})
+	secondary := agentServer(t, map[string]http.HandlerFunc{"metrics": answer("from secondary")})
+	backup, _ := NewClient(secondary.URL)
+	c, _ := NewClient(slow.URL, WithFallback("metrics", Target{Agent: "metrics", Client: backup}))
+
+	resp, err := c.CallAgent(context.Background(), "metrics", "cpu?", WithRequestTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "from secondary" || resp.Route.BaseURL != secondary.URL {
+		t.Fatalf("resp = %+v, route %+v", resp, resp.Route)
+	}
+	if len(resp.Route.Errors) != 1 || !errors.Is(resp.Route.Errors[0], ErrTimeout) {
+		t.Errorf("route errors = %v", resp.Route.Errors)
+	}
+}
+
+func TestFallbackPrimaryServes(t *testing.T) {
+	srv := agentServer(t, map[string]http.HandlerFunc{"metrics": answer("ok")})
+	c, _ := NewClient(srv.URL, WithFallback("metrics", Target{Agent: "metricsV2"}))
+
+	resp, err := c.CallAgent(context.Background(), "metrics", "cpu?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Route == nil || resp.Route.Agent != "metrics" || resp.Route.Fallback != 0 || resp.Route.Errors != nil {
+		t.Errorf("route = %+v", resp.Route)
+	}
+}
+
+func TestFallbackAllFail(t *testing.T) {
+	srv := agentServer(t, nil)
+	c, _ := NewClient(srv.URL, WithFallback("metrics", Target{Agent: "metricsV2"}, Target{Agent: "metricsV3"}))
+
+	_, err := c.CallAgent(context.Background(), "metrics", "cpu?")
+	var fbErr *FallbackError
+	if !errors.As(err, &fbErr) || len(fbErr.Errors) != 3 {
+		t.Fatalf("err = %v, want FallbackError of 3 targets", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err does not match the targets' APIError: %v", err)
+	}
+	if !strings.Contains(err.Error(), "metricsV3@"+srv.URL) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestFallbackNotAfterCancel(t *testing.T) {
+	var calls atomic.Int32
+	srv := agentServer(t, map[string]http.HandlerFunc{
+		"metrics":   stall,
+		"metricsV2": func(w http.ResponseWriter, r *http.Request) { calls.Add(1) },
+	})
+	c, _ := NewClient(srv.URL, WithFallback("metrics", Target{Agent: "metricsV2"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallAgent(ctx, "metrics", "cpu?"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("err = %v, want timeout", err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("fallback called %d times after the caller's deadline", n)
+	}
+}
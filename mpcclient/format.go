@@ -0,0 +1,57 @@
+package mpcclient
+
+import "fmt"
+
+// Format is a response format a call can ask for with WithFormat.
+type Format string
+
+// Response formats understood by the workshop servers.
+const (
+	FormatText     Format = "text"
+	FormatJSON     Format = "json"
+	FormatMarkdown Format = "markdown"
+)
+
+// WithFormat asks the agent to answer in format f. Agents declaring the
+// formats they support, in AgentInfo.Formats, reject any other with an
+// error matching ErrUnsupportedFormat; other agents may ignore it, so the
+// response's Format, when set, reports what was actually returned.
+func WithFormat(f Format) CallOption {
+	return func(o *callOptions) {
+		o.format = f
+	}
+}
+
+// FormatError reports a response read as one format while the agent said
+// it returned another.
+type FormatError struct {
+	Want, Got Format
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("response is %s, not %s", e.Got, e.Want)
+}
+
+// checkFormat returns a *FormatError if the response reports a format
+// other than one of want. Responses that report none pass.
+func (r *AgentResponse) checkFormat(want ...Format) error {
+	if r.Format == "" {
+		return nil
+	}
+	for _, f := range want {
+		if r.Format == f {
+			return nil
+		}
+	}
+	return &FormatError{Want: want[0], Got: r.Format}
+}
+
+// Markdown returns the response's Markdown result. Plain text is valid
+// Markdown, so only responses reporting another format, such as JSON, are
+// an error.
+func (r *AgentResponse) Markdown() (string, error) {
+	if err := r.checkFormat(FormatMarkdown, FormatText); err != nil {
+		return "", err
+	}
+	return r.Text(), nil
+}
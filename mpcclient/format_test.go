@@ -0,0 +1,70 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithFormat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Format != FormatMarkdown {
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write([]byte(`{"error":"agent cannot produce format","code":"unsupported_format"}`))
+			return
+		}
+		w.Write([]byte(`{"agent":"a","result":"# Report","format":"markdown"}`))
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	resp, err := c.CallAgent(context.Background(), "a", "hi", WithFormat(FormatMarkdown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md, err := resp.Markdown(); err != nil || md != "# Report" {
+		t.Errorf("Markdown() = %q, %v", md, err)
+	}
+	var v any
+	var fmtErr *FormatError
+	if err := resp.JSON(&v); !errors.As(err, &fmtErr) || fmtErr.Got != FormatMarkdown || fmtErr.Want != FormatJSON {
+		t.Errorf("JSON() err = %v, want a FormatError", err)
+	}
+
+	_, err = c.CallAgent(context.Background(), "a", "hi", WithFormat(FormatJSON))
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("err = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestResponseFormatHelpers(t *testing.T) {
+	for _, tc := range []struct {
+		resp            AgentResponse
+		jsonOK, mdOK    bool
+		wantText, wantV string
+	}{
+		{AgentResponse{Result: `{"vm":"web01"}`}, true, true, `{"vm":"web01"}`, "web01"},
+		{AgentResponse{Result: `{"vm":"web01"}`, Format: FormatJSON}, true, false, `{"vm":"web01"}`, "web01"},
+		{AgentResponse{Result: "plain", Format: FormatText}, false, true, "plain", ""},
+		// A structured payload decodes whatever format the text is in.
+		{AgentResponse{Result: "*web01*", Format: FormatMarkdown, Data: []byte(`{"vm":"web01"}`)}, true, true, "*web01*", "web01"},
+	} {
+		var v struct{ VM string }
+		err := tc.resp.JSON(&v)
+		if (err == nil) != tc.jsonOK || v.VM != tc.wantV {
+			t.Errorf("%+v: JSON() = %+v, %v", tc.resp, v, err)
+		}
+		md, err := tc.resp.Markdown()
+		if (err == nil) != tc.mdOK || tc.mdOK && md != tc.wantText {
+			t.Errorf("%+v: Markdown() = %q, %v", tc.resp, md, err)
+		}
+		if got := tc.resp.Text(); got != tc.wantText {
+			t.Errorf("%+v: Text() = %q", tc.resp, got)
+		}
+	}
+}
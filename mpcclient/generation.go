@@ -0,0 +1,76 @@
+package mpcclient
+
+import "slices"
+
+// Generation carries the model and sampling parameters a call asks its
+// agent to generate with. Zero fields leave the choice to the agent.
+// Servers check them before the agent sees them, rejecting a temperature
+// out of range, too many stop sequences or more tokens than the agent
+// allows with an error matching ErrInvalidRequest, and a model the agent
+// does not list with one matching ErrUnsupportedModel.
+type Generation struct {
+	Model string `json:"model,omitempty"`
+	// Temperature is a pointer so that 0 can be asked for.
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// WithModel asks the agent to generate with the named model. Agents
+// listing their models in AgentInfo.Models accept only those.
+func WithModel(name string) CallOption {
+	return func(o *callOptions) {
+		o.generation.Model = name
+	}
+}
+
+// WithTemperature sets the sampling temperature, from 0 for the most
+// deterministic answers to 2.
+func WithTemperature(t float64) CallOption {
+	return func(o *callOptions) {
+		o.generation.Temperature = &t
+	}
+}
+
+// WithMaxTokens bounds the tokens the agent generates for the call. Unlike
+// the session budget MaxTokens, it is enforced by the agent's model.
+func WithMaxTokens(n int) CallOption {
+	return func(o *callOptions) {
+		o.generation.MaxTokens = n
+	}
+}
+
+// WithStopSequences asks the agent to stop generating at any of seqs.
+// Servers accept at most four.
+func WithStopSequences(seqs ...string) CallOption {
+	return func(o *callOptions) {
+		o.generation.Stop = seqs
+	}
+}
+
+// withGeneration returns req with the call's generation parameters over
+// those of req.Generation.
+func (o callOptions) withGeneration(req AgentRequest) AgentRequest {
+	g := o.generation
+	if g.Model == "" && g.Temperature == nil && g.MaxTokens == 0 && g.Stop == nil {
+		return req
+	}
+	var merged Generation
+	if req.Generation != nil {
+		merged = *req.Generation
+	}
+	if g.Model != "" {
+		merged.Model = g.Model
+	}
+	if g.Temperature != nil {
+		merged.Temperature = g.Temperature
+	}
+	if g.MaxTokens != 0 {
+		merged.MaxTokens = g.MaxTokens
+	}
+	if g.Stop != nil {
+		merged.Stop = slices.Clone(g.Stop)
+	}
+	req.Generation = &merged
+	return req
+}
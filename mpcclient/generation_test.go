@@ -0,0 +1,26 @@
+package mpcclient
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWithGenerationMerges(t *testing.T) {
+	var o callOptions
+	for _, opt := range []CallOption{WithTemperature(0.2), WithStopSequences("END")} {
+		opt(&o)
+	}
+	hot := 1.5
+	base := AgentRequest{Prompt: "hi", Generation: &Generation{Model: "small", Temperature: &hot, MaxTokens: 50}}
+	req := o.request(base)
+	g := req.Generation
+	if g.Model != "small" || *g.Temperature != 0.2 || g.MaxTokens != 50 || !slices.Equal(g.Stop, []string{"END"}) {
+		t.Errorf("generation = %+v", g)
+	}
+	if *base.Generation.Temperature != 1.5 || base.Generation.Stop != nil {
+		t.Errorf("base request modified: %+v", base.Generation)
+	}
+	if req := (callOptions{}).request(AgentRequest{Prompt: "hi"}); req.Generation != nil {
+		t.Errorf("generation without options = %+v", req.Generation)
+	}
+}
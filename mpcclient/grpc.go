@@ -0,0 +1,249 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcpb"
+)
+
+// WithGRPCTransport sends agent calls over gRPC on cc, typically a
+// *grpc.ClientConn dialled to the server's gRPC listener. Calls made with
+// WithStatusHandler use the streaming RPC so agent status updates are
+// delivered as they happen. Default headers, credentials and trace context
+// travel as request metadata. The connection belongs to the caller;
+// Client.Close leaves it open.
+func WithGRPCTransport(cc grpc.ClientConnInterface) Option {
+	return func(c *Client) {
+		c.transport = &grpcTransport{c: c, rpc: mpcpb.NewMPCClient(cc)}
+	}
+}
+
+type grpcTransport struct {
+	c   *Client
+	rpc mpcpb.MPCClient
+}
+
+func (t *grpcTransport) RoundTrip(ctx context.Context, call *Call) (*AgentResponse, error) {
+	if len(call.Request.Attachments) > 0 {
+		closeAttachments(call.Request.Attachments)
+		return nil, errors.New("attachments are not supported over gRPC")
+	}
+	if err := t.c.throttle.wait(ctx, call.Agent); err != nil {
+		return nil, err
+	}
+	ctx, err := t.outgoing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	in := &mpcpb.InvokeRequest{Agent: call.Agent, Request: requestToPB(call.Request)}
+
+	var header metadata.MD
+	if call.OnStatus == nil {
+		out, err := t.rpc.Invoke(ctx, in, grpc.Header(&header))
+		if err != nil {
+			return nil, grpcAPIError(err, header)
+		}
+		return responseFromPB(out), nil
+	}
+
+	stream, err := t.rpc.Stream(ctx, in)
+	if err != nil {
+		return nil, grpcAPIError(err, nil)
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			header, _ = stream.Header()
+			if err == io.EOF {
+				return nil, errors.New("grpc stream ended without a response")
+			}
+			return nil, grpcAPIError(err, header)
+		}
+		if chunk.GetResponse() != nil {
+			return responseFromPB(chunk.GetResponse()), nil
+		}
+		if chunk.GetStatus() != "" {
+			call.OnStatus(chunk.GetStatus())
+		}
+	}
+}
+
+// outgoing attaches the client's default headers, credentials and trace
+// context to ctx as gRPC metadata. Authenticators work on HTTP requests,
+// so they are run against a placeholder request whose headers are copied.
+func (t *grpcTransport) outgoing(ctx context.Context) (context.Context, error) {
+	req, err := t.c.newRequest(ctx, http.MethodPost, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	t.c.injectTrace(ctx, req)
+	if err := t.c.authenticate(req); err != nil {
+		return nil, err
+	}
+	md := make(metadata.MD, len(req.Header))
+	for k, vs := range req.Header {
+		md[strings.ToLower(k)] = vs
+	}
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// grpcAPIError converts a failed RPC into the *APIError the HTTP transport
+// would have returned, using the ErrorInfo the server attaches. Failures
+// without one, such as a refused connection, are mapped from their gRPC
+// code; a passed deadline or cancellation is reported as the context error.
+func grpcAPIError(err error, header metadata.MD) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var info *mpcpb.ErrorInfo
+	for _, d := range st.Details() {
+		if ei, ok := d.(*mpcpb.ErrorInfo); ok {
+			info = ei
+			break
+		}
+	}
+	if info == nil {
+		switch st.Code() {
+		case codes.DeadlineExceeded:
+			return &TimeoutError{Err: err}
+		case codes.Canceled:
+			return context.Canceled
+		}
+	}
+	e := &APIError{
+		StatusCode: httpStatus(st.Code()),
+		Message:    st.Message(),
+	}
+	if ids := header.Get("x-request-id"); len(ids) > 0 {
+		e.RequestID = ids[0]
+	}
+	if info != nil {
+		e.StatusCode = int(info.GetHttpStatus())
+		e.Code = info.GetCode()
+		e.Details = info.GetDetails()
+		if info.GetRequestId() != "" {
+			e.RequestID = info.GetRequestId()
+		}
+	}
+	return e
+}
+
+// httpStatus maps a gRPC code onto the closest HTTP status.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func requestToPB(r AgentRequest) *mpcpb.AgentRequest {
+	out := &mpcpb.AgentRequest{
+		Prompt:     r.Prompt,
+		Context:    toStruct(r.Context),
+		Parameters: toStruct(r.Parameters),
+		Format:     string(r.Format),
+		Metadata:   r.Metadata,
+	}
+	if q := r.Requires; q != nil {
+		out.Requires = &mpcpb.Requirements{ProtocolVersion: int32(q.ProtocolVersion), MinVersion: q.MinVersion, Capabilities: q.Capabilities}
+	}
+	for _, m := range r.Messages {
+		out.Messages = append(out.Messages, &mpcpb.Message{Role: string(m.Role), Content: m.Content})
+	}
+	for _, t := range r.Tools {
+		out.Tools = append(out.Tools, &mpcpb.ToolSpec{Name: t.Name, Description: t.Description, Parameters: t.Parameters})
+	}
+	for _, tr := range r.ToolResults {
+		out.ToolResults = append(out.ToolResults, &mpcpb.ToolResult{
+			Call:   &mpcpb.ToolCall{Id: tr.ID, Name: tr.Name, Arguments: tr.Arguments},
+			Output: tr.Output,
+			Error:  tr.Error,
+		})
+	}
+	return out
+}
+
+func responseFromPB(r *mpcpb.AgentResponse) *AgentResponse {
+	out := &AgentResponse{
+		Agent:           r.GetAgent(),
+		Prompt:          r.GetPrompt(),
+		Result:          r.GetResult(),
+		Status:          r.GetStatus(),
+		RequestID:       r.GetRequestId(),
+		ExecutionTimeMS: r.GetExecutionTimeMs(),
+		Timestamp:       r.GetTimestamp(),
+		Data:            json.RawMessage(r.GetData()),
+		Format:          Format(r.GetFormat()),
+		AgentVersion:    r.GetAgentVersion(),
+		ProtocolVersion: int(r.GetProtocolVersion()),
+	}
+	if len(out.Data) == 0 {
+		out.Data = nil
+	}
+	if md := r.GetMetadata().AsMap(); len(md) > 0 {
+		out.Metadata = md
+	}
+	for _, tc := range r.GetToolCalls() {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{ID: tc.GetId(), Name: tc.GetName(), Arguments: tc.GetArguments()})
+	}
+	if u := r.GetUsage(); u != nil {
+		out.Usage = &Usage{
+			PromptTokens:     int(u.GetPromptTokens()),
+			CompletionTokens: int(u.GetCompletionTokens()),
+			TotalTokens:      int(u.GetTotalTokens()),
+		}
+	}
+	return out
+}
+
+// toStruct converts m to a Struct, going through JSON for values such as
+// typed slices that structpb does not accept directly.
+func toStruct(m map[string]any) *structpb.Struct {
+	if m == nil {
+		return nil
+	}
+	if st, err := structpb.NewStruct(m); err == nil {
+		return st
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var st structpb.Struct
+	if err := protojson.Unmarshal(b, &st); err != nil {
+		return nil
+	}
+	return &st
+}
@@ -0,0 +1,79 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcpb"
+)
+
+type fakeMPC struct {
+	mpcpb.UnimplementedMPCServer
+	md  chan metadata.MD
+	err error
+}
+
+func (f *fakeMPC) Invoke(ctx context.Context, in *mpcpb.InvokeRequest) (*mpcpb.AgentResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.md <- md
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &mpcpb.AgentResponse{Agent: in.GetAgent(), Result: "ok: " + in.GetRequest().GetPrompt()}, nil
+}
+
+func grpcClient(t *testing.T, f *fakeMPC, opts ...Option) *Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	mpcpb.RegisterMPCServer(gs, f)
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	c, err := NewClient("", append(opts, WithGRPCTransport(cc))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGRPCTransportMetadata(t *testing.T) {
+	f := &fakeMPC{md: make(chan metadata.MD, 1)}
+	c := grpcClient(t, f, WithHeader("X-Team", "ops"), WithBearerToken("tok"))
+	resp, err := c.CallAgent(context.Background(), "vm", "hi")
+	if err != nil || resp.Result != "ok: hi" {
+		t.Fatalf("call = %+v, %v", resp, err)
+	}
+	md := <-f.md
+	if got := md.Get("x-team"); len(got) != 1 || got[0] != "ops" {
+		t.Errorf("x-team = %q", got)
+	}
+	if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer tok" {
+		t.Errorf("authorization = %q", got)
+	}
+}
+
+func TestGRPCTransportStatusWithoutDetails(t *testing.T) {
+	f := &fakeMPC{md: make(chan metadata.MD, 1), err: status.Error(codes.Unavailable, "draining")}
+	c := grpcClient(t, f)
+	_, err := c.CallAgent(context.Background(), "vm", "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "draining" || !errors.Is(err, ErrServerOverloaded) || !Retryable(err) {
+		t.Errorf("err = %v, want retryable ErrServerOverloaded", err)
+	}
+}
@@ -0,0 +1,160 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// readyPollInterval is how often WaitUntilReady probes the server.
+const readyPollInterval = 250 * time.Millisecond
+
+// ErrNotReady is returned by Ready when the server answers but is not yet,
+// or no longer, ready to serve calls.
+var ErrNotReady = errors.New("server not ready")
+
+// HealthStatus is the server's answer to a health check.
+type HealthStatus struct {
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+	Uptime  string `json:"uptime,omitempty"`
+	// Agents is the number of registered agents, as reported by the Go
+	// server.
+	Agents int `json:"agents,omitempty"`
+	// Services maps backing services to their state, as reported by the
+	// Python server.
+	Services  map[string]string `json:"services,omitempty"`
+	Timestamp string            `json:"timestamp,omitempty"`
+}
+
+// Healthy reports whether the server described itself as healthy.
+func (h *HealthStatus) Healthy() bool {
+	return h.Status == "healthy" || h.Status == "ok"
+}
+
+// ReadyStatus is the server's answer to a readiness probe.
+type ReadyStatus struct {
+	// Status is "ready", "not_ready" or "shutting_down".
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+	Uptime  string `json:"uptime,omitempty"`
+	// Agents maps each registered agent to its availability.
+	Agents map[string]AgentAvailability `json:"agents,omitempty"`
+}
+
+// AgentAvailability reports whether one agent can serve calls.
+type AgentAvailability struct {
+	// Status is "available" or "unavailable".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Ready reports whether the server is ready to serve calls.
+func (r *ReadyStatus) Ready() bool {
+	return r.Status == "ready"
+}
+
+// Health queries the server's /healthz liveness endpoint, falling back to
+// /health on servers that do not have it.
+func (c *Client) Health(ctx context.Context, opts ...CallOption) (*HealthStatus, error) {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+
+	var h HealthStatus
+	err := c.do(ctx, http.MethodGet, "/healthz", nil, &h)
+	if isNotFound(err) {
+		err = c.do(ctx, http.MethodGet, "/health", nil, &h)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: health: %w", err)
+	}
+	return &h, nil
+}
+
+// Ready queries the server's /readyz readiness endpoint. A server that is
+// not ready yields its status, naming any unavailable agents, together with
+// an error wrapping ErrNotReady. On servers without /readyz, readiness is
+// derived from Health. The probe is never retried.
+func (c *Client) Ready(ctx context.Context, opts ...CallOption) (*ReadyStatus, error) {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+
+	st, err := c.probeReady(ctx)
+	if isNotFound(err) {
+		h, herr := c.Health(ctx)
+		if herr != nil {
+			return nil, herr
+		}
+		st, err = &ReadyStatus{Status: "not_ready", Version: h.Version, Uptime: h.Uptime}, nil
+		if h.Healthy() {
+			st.Status = "ready"
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: ready: %w", err)
+	}
+	if !st.Ready() {
+		return st, fmt.Errorf("mpcclient: ready: %w: status %q", ErrNotReady, st.Status)
+	}
+	return st, nil
+}
+
+// probeReady sends a single /readyz request, decoding the body of a 503
+// as well as of a 200.
+func (c *Client) probeReady(ctx context.Context) (*ReadyStatus, error) {
+	req, err := c.newRequest(context.WithValue(ctx, noRetryKey{}, true), http.MethodGet, "/readyz", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	var st ReadyStatus
+	res, err := c.send(req)
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable:
+		if json.Unmarshal([]byte(apiErr.Body), &st) != nil || st.Status == "" {
+			return nil, err
+		}
+		return &st, nil
+	case err != nil:
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err := c.decode(res, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// WaitUntilReady polls the server until it reports ready, ctx is done or
+// timeout has passed. Connection failures count as not ready, so it can be
+// called while the server is still starting. A zero timeout waits as long as
+// ctx allows. The error on giving up wraps the last probe's failure.
+func (c *Client) WaitUntilReady(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	t := time.NewTicker(readyPollInterval)
+	defer t.Stop()
+	for {
+		_, err := c.Ready(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("mpcclient: wait until ready: %w (last probe: %v)", ctx.Err(), err)
+		case <-t.C:
+		}
+	}
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,76 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthFallsBackToLegacyEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"healthy","services":{"azure":"connected"}}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	h, err := c.Health(context.Background())
+	if err != nil || !h.Healthy() || h.Services["azure"] != "connected" {
+		t.Fatalf("Health = %+v, %v", h, err)
+	}
+	st, err := c.Ready(context.Background())
+	if err != nil || !st.Ready() {
+		t.Errorf("Ready derived from /health = %+v, %v", st, err)
+	}
+}
+
+func TestReadyReportsUnavailableAgents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"not_ready","agents":{"vm":{"status":"unavailable","error":"azure: 401"}}}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithRetryPolicy(DefaultRetryPolicy()))
+	st, err := c.Ready(context.Background())
+	if !errors.Is(err, ErrNotReady) {
+		t.Fatalf("err = %v, want ErrNotReady", err)
+	}
+	if st == nil || st.Agents["vm"].Error != "azure: 401" {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probes.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"not_ready"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ready"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	if err := c.WaitUntilReady(context.Background(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if probes.Load() != 3 {
+		t.Errorf("ready after %d probes, want 3", probes.Load())
+	}
+
+	srv.Close()
+	err := c.WaitUntilReady(context.Background(), 300*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+}
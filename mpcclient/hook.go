@@ -0,0 +1,54 @@
+package mpcclient
+
+import (
+	"context"
+	"time"
+)
+
+// Exchange is one completed agent call, as passed to a CallHook.
+type Exchange struct {
+	Agent string
+	// Prompt is the prompt as sent, scrubbed by the client's redactor
+	// when WithRedaction is configured.
+	Prompt string
+	// Response is the agent's answer, or nil if the call failed. For
+	// streams it carries the concatenated chunks in Result.
+	Response *AgentResponse
+	Err      error
+	// Streamed is set for calls made with StreamAgent or Session.Stream.
+	Streamed  bool
+	RequestID string
+	Start     time.Time
+	Latency   time.Duration
+	// TimeToFirstChunk is how long a stream took to deliver its first
+	// text, reconnects included, or zero if it delivered none.
+	TimeToFirstChunk time.Duration
+}
+
+// CallHook observes completed agent calls.
+type CallHook func(ctx context.Context, ex Exchange)
+
+// WithCallHook calls fn once for every agent call and stream the client
+// completes, successful or not, after retries, fallbacks and schema
+// repairs. Hooks run in the order they were added, on the calling
+// goroutine before the call returns, so they should be quick.
+func WithCallHook(fn CallHook) Option {
+	return func(c *Client) {
+		if fn != nil {
+			c.hooks = append(c.hooks, fn)
+		}
+	}
+}
+
+// observe passes a completed call to the client's hooks.
+func (c *Client) observe(ctx context.Context, ex Exchange) {
+	if len(c.hooks) == 0 {
+		return
+	}
+	ex.Latency = time.Since(ex.Start)
+	ex.Prompt = c.redactor().Redact(ex.Prompt)
+	ex.RequestID = logRequestID(ctx, ex.Response, ex.Err)
+	for _, fn := range c.hooks {
+		fn(ctx, ex)
+	}
+}
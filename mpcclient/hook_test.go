@@ -0,0 +1,43 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCallHook(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /agent/vm", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"agent":"vm","result":"ok","usage":{"total_tokens":9}}`))
+	})
+	mux.HandleFunc("POST /agent/writer/stream", sseHandler(t, "data: {\"text\":\"Hel\"}\n\ndata: {\"text\":\"lo\"}\n\nevent: done\ndata: {}\n\n"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var seen []Exchange
+	c, _ := NewClient(srv.URL,
+		WithRedaction(RedactionConfig{}),
+		WithCallHook(func(ctx context.Context, ex Exchange) { seen = append(seen, ex) }))
+	ctx := WithRequestID(context.Background(), "trace-1")
+	c.CallAgent(ctx, "vm", "password=hunter2")
+	c.CallAgent(ctx, "missing", "hi")
+	c.StreamAgent(ctx, "writer", "hello", func(Chunk) error { return nil })
+
+	if len(seen) != 3 {
+		t.Fatalf("hook saw %d calls, want 3", len(seen))
+	}
+	ok, failed, streamed := seen[0], seen[1], seen[2]
+	if ok.Agent != "vm" || ok.Prompt == "password=hunter2" || ok.Response.Usage.TotalTokens != 9 ||
+		ok.RequestID != "trace-1" || ok.Err != nil || ok.Latency <= 0 || ok.Start.IsZero() {
+		t.Errorf("call = %+v", ok)
+	}
+	if !errors.Is(failed.Err, ErrAgentNotFound) || failed.Response != nil {
+		t.Errorf("failed call = %+v", failed)
+	}
+	if !streamed.Streamed || streamed.Response == nil || streamed.Response.Result != "Hello" {
+		t.Errorf("stream = %+v", streamed)
+	}
+}
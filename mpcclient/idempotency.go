@@ -0,0 +1,85 @@
+package mpcclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// idempotencyKeyHeader carries the key by which the server recognizes
+// repeats of an agent call, so that a retry after a lost response gets the
+// first response instead of running the agent again.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey sends key as the Idempotency-Key of the call, and of
+// every retry and fallback of it, so that a server deduplicating calls
+// runs the agent at most once however often the request is resent. Reusing
+// a key for a different request is an error on the server; the tool
+// rounds and schema repairs of a call are sent under keys derived from it.
+// Keys are carried by the HTTP transport only.
+func WithIdempotencyKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// WithIdempotency gives every agent call a random Idempotency-Key, shared
+// by its retries, as WithIdempotencyKey does with a key of the caller's.
+// Batch items keep their key across the batch's item retries.
+func WithIdempotency() Option {
+	return func(c *Client) {
+		c.idempotency = true
+	}
+}
+
+type idempotencyKeyKey struct{}
+
+func withIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+func idempotencyKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+	return key
+}
+
+// idempotencyContext returns ctx carrying the Idempotency-Key of a call:
+// the one set with WithIdempotencyKey or, with WithIdempotency, a new one.
+// A key ctx already carries is dropped otherwise, so that agents called
+// from a tool are not sent the key of the call running it.
+func (c *Client) idempotencyContext(ctx context.Context, o callOptions) context.Context {
+	switch {
+	case o.idempotencyKey != "":
+		return withIdempotencyKey(ctx, o.idempotencyKey)
+	case c.idempotency:
+		return withIdempotencyKey(ctx, newRequestID())
+	case idempotencyKeyFrom(ctx) != "":
+		return withIdempotencyKey(ctx, "")
+	}
+	return ctx
+}
+
+// idempotencyStep derives the key of the nth follow-up request of a call,
+// such as a tool round, which must not be answered with the call's first
+// response.
+func idempotencyStep(key, step string, n int) string {
+	return fmt.Sprintf("%s/%s-%d", key, step, n)
+}
+
+// nextIdempotencyStep returns ctx with the key it carries, if any,
+// derived for the nth follow-up request.
+func nextIdempotencyStep(ctx context.Context, step string, n int) context.Context {
+	if key := idempotencyKeyFrom(ctx); key != "" {
+		return withIdempotencyKey(ctx, idempotencyStep(key, step, n))
+	}
+	return ctx
+}
+
+// idempotencyRound derives the key set with WithIdempotencyKey, if any,
+// for the nth tool round of a call.
+func idempotencyRound(n int) CallOption {
+	return func(o *callOptions) {
+		if o.idempotencyKey != "" {
+			o.idempotencyKey = idempotencyStep(o.idempotencyKey, "round", n)
+		}
+	}
+}
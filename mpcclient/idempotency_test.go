@@ -0,0 +1,136 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// keyRecorder serves agent calls with handle, recording the
+// Idempotency-Key of each request; n counts the requests.
+type keyRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (k *keyRecorder) server(t *testing.T, handle func(w http.ResponseWriter, req AgentRequest, n int)) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		k.mu.Lock()
+		k.keys = append(k.keys, r.Header.Get(idempotencyKeyHeader))
+		n := len(k.keys)
+		k.mu.Unlock()
+		handle(w, req, n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func answerOK(w http.ResponseWriter, req AgentRequest, n int) {
+	json.NewEncoder(w).Encode(map[string]any{"result": "ok"})
+}
+
+func TestIdempotencyKeySharedByRetries(t *testing.T) {
+	var rec keyRecorder
+	srv := rec.server(t, func(w http.ResponseWriter, req AgentRequest, n int) {
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		answerOK(w, req, n)
+	})
+	c, _ := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, RetryableStatus: []int{http.StatusServiceUnavailable}}))
+
+	if _, err := c.CallAgent(context.Background(), "echo", "hi", WithIdempotencyKey("order-42")); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.keys) != 2 || rec.keys[0] != "order-42" || rec.keys[1] != "order-42" {
+		t.Errorf("keys = %q, want order-42 twice", rec.keys)
+	}
+}
+
+func TestWithIdempotency(t *testing.T) {
+	var rec keyRecorder
+	srv := rec.server(t, answerOK)
+	c, _ := NewClient(srv.URL, WithIdempotency())
+	ctx := context.Background()
+	for range 2 {
+		if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rec.keys) != 2 || rec.keys[0] == "" || rec.keys[0] == rec.keys[1] {
+		t.Errorf("keys = %q, want a different one per call", rec.keys)
+	}
+
+	// Without either option no key is sent.
+	rec.keys = nil
+	plain, _ := NewClient(srv.URL)
+	if _, err := plain.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if rec.keys[0] != "" {
+		t.Errorf("key %q sent without idempotency", rec.keys[0])
+	}
+}
+
+func TestIdempotencyKeyOfBatchItemRetries(t *testing.T) {
+	var rec keyRecorder
+	srv := rec.server(t, func(w http.ResponseWriter, req AgentRequest, n int) {
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		answerOK(w, req, n)
+	})
+	c, _ := NewClient(srv.URL, WithIdempotency())
+	_, err := c.CallAgentBatch(context.Background(), []BatchRequest{{Agent: "echo", Request: AgentRequest{Prompt: "hi"}}}, BatchOptions{
+		Retry: RetryPolicy{MaxAttempts: 2, RetryableStatus: []int{http.StatusServiceUnavailable}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.keys) != 2 || rec.keys[0] == "" || rec.keys[0] != rec.keys[1] {
+		t.Errorf("keys = %q, want one key for both attempts", rec.keys)
+	}
+}
+
+func TestIdempotencyKeyOfToolRounds(t *testing.T) {
+	var rec keyRecorder
+	var inner *Client
+	srv := rec.server(t, func(w http.ResponseWriter, req AgentRequest, n int) {
+		if req.Prompt == "outer" && len(req.ToolResults) == 0 {
+			json.NewEncoder(w).Encode(map[string]any{"tool_calls": []map[string]any{{"id": "1", "name": "ask"}}})
+			return
+		}
+		answerOK(w, req, n)
+	})
+	ask := Tool{Name: "ask", Handler: ToolFunc(func(ctx context.Context, _ struct{}) (any, error) {
+		resp, err := inner.CallAgent(ctx, "other", "inner")
+		if err != nil {
+			return nil, err
+		}
+		return resp.Result, nil
+	})}
+	c, _ := NewClient(srv.URL, WithTools(ask))
+	inner = c
+
+	if _, err := c.InvokeWithTools(context.Background(), "ops", AgentRequest{Prompt: "outer"}, WithIdempotencyKey("k")); err != nil {
+		t.Fatal(err)
+	}
+	// The tool's own call carries no key; the second round a derived one.
+	want := []string{"k", "", "k/round-1"}
+	if len(rec.keys) != len(want) {
+		t.Fatalf("keys = %q, want %q", rec.keys, want)
+	}
+	for i := range want {
+		if rec.keys[i] != want[i] {
+			t.Errorf("keys = %q, want %q", rec.keys, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package mpcclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// Handler sends one HTTP request to the MPC server. Non-2xx responses are
+// returned as an *APIError rather than a response. On success the caller
+// owns the response body.
+type Handler interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f HandlerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Interceptor wraps the handler sending the client's HTTP requests, to
+// observe, mutate or short-circuit them.
+type Interceptor func(next Handler) Handler
+
+// WithInterceptor adds ic to the chain every HTTP request passes through,
+// including agent calls, streams, discovery and health checks. Interceptors
+// run in the order added, outside the built-in ones: next retries the
+// request according to the retry policy, injects trace context, waits for
+// the rate limit and authenticates and signs each attempt, so an interceptor sees
+// one request and its final outcome. WebSocket traffic does not pass
+// through the chain.
+func WithInterceptor(ic Interceptor) Option {
+	return func(c *Client) {
+		if ic != nil {
+			c.interceptors = append(c.interceptors, ic)
+		}
+	}
+}
+
+// buildChain assembles the handler sending requests: the caller's
+// interceptors, then retries, endpoint selection, tracing, rate limiting,
+// authentication and request signing around the HTTP client itself.
+func (c *Client) buildChain() Handler {
+	builtin := []Interceptor{c.retryInterceptor, c.balanceInterceptor, c.traceInterceptor, c.throttleInterceptor, c.authInterceptor, c.signInterceptor}
+	chain := append(append([]Interceptor(nil), c.interceptors...), builtin...)
+	var next Handler = HandlerFunc(c.roundTrip)
+	if c.dryRun {
+		next = HandlerFunc(c.dryRunTrip)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		next = chain[i](next)
+	}
+	return next
+}
+
+// roundTrip sends req with the client's HTTP client, compressing its body
+// as WithCompression asks and decoding a compressed response, and turns
+// non-2xx responses into an *APIError, or a *ContentTypeError wrapping one
+// if the body is not JSON.
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	req, err := c.compressRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	start := time.Now()
+	res, err := c.httpClient.Do(req)
+	c.logHTTP(req, res, err, start)
+	if err != nil {
+		return nil, err
+	}
+	decompressResponse(res)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+	return res, nil
+}
@@ -0,0 +1,68 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"result": r.Header.Get("X-Tenant") + " " + r.Header.Get("X-Api-Key")})
+	}))
+	defer srv.Close()
+
+	var order []string
+	record := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				req.Header.Set("X-Tenant", name)
+				return next.Do(req)
+			})
+		}
+	}
+	c, _ := NewClient(srv.URL,
+		WithInterceptor(record("outer")),
+		WithInterceptor(record("inner")),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, RetryableStatus: []int{http.StatusServiceUnavailable}}),
+		WithAPIKey("k"),
+	)
+	resp, err := c.CallAgent(context.Background(), "echo", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "inner k" {
+		t.Errorf("server saw %q, want interceptor and auth headers", resp.Result)
+	}
+	if attempts != 2 || !slices.Equal(order, []string{"outer", "inner"}) {
+		t.Errorf("interceptors ran %v for %d attempts, want once each around the retries", order, attempts)
+	}
+}
+
+func TestInterceptorShortCircuits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the server")
+	}))
+	defer srv.Close()
+
+	errBlocked := errors.New("blocked by policy")
+	c, _ := NewClient(srv.URL, WithInterceptor(func(next Handler) Handler {
+		return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errBlocked
+		})
+	}))
+	if _, err := c.CallAgent(context.Background(), "echo", "hi"); !errors.Is(err, errBlocked) {
+		t.Errorf("err = %v, want the interceptor's error", err)
+	}
+}
@@ -0,0 +1,179 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// jobWait is the long-poll wait WaitJob asks the server for on each
+// request.
+const jobWait = 30 * time.Second
+
+// JobStatus is the state of an asynchronous job.
+type JobStatus string
+
+// Job states. A job moves from pending to running to succeeded or failed.
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is an agent call running in the background on the server.
+type Job struct {
+	ID          string    `json:"id"`
+	Agent       string    `json:"agent"`
+	Status      JobStatus `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CompletedAt time.Time `json:"completed_at,omitzero"`
+	// ExpiresAt is when the server may forget a finished job.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Response is the agent's response, set once the job succeeded.
+	Response *AgentResponse `json:"response,omitempty"`
+	// Error describes the failure of a failed job.
+	Error *JobError `json:"error,omitempty"`
+	// CallbackURL is where the server POSTs the finished job, as set with
+	// WithCallback.
+	CallbackURL string `json:"callback_url,omitempty"`
+	// Owner names the API key that submitted the job, on servers requiring
+	// keys.
+	Owner string `json:"owner,omitempty"`
+	// Schedule names the server schedule that ran the job, if it was not
+	// submitted by a client.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+type jobList struct {
+	Jobs       []Job  `json:"jobs"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Jobs returns an Iterator over the jobs submitted with the client's API
+// key that the server still holds, the most recent first, fetching them a
+// page at a time; WithPageSize sets the size of the pages.
+func (c *Client) Jobs(opts ...CallOption) *Iterator[Job] {
+	return NewIterator(pageFetcher(c, "list jobs", "/jobs", opts, func(l *jobList) ([]Job, string) {
+		return l.Jobs, l.NextCursor
+	}))
+}
+
+// JobError is the failure of a job, as the server would have reported it
+// for a synchronous call.
+type JobError struct {
+	StatusCode int             `json:"status_code"`
+	Message    string          `json:"error"`
+	Code       string          `json:"code,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+}
+
+// Done reports whether the job has finished.
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// Err returns the failure of a failed job as an *APIError, so it matches
+// the same sentinel errors as a failed synchronous call, or nil.
+func (j *Job) Err() error {
+	if j.Status != JobFailed {
+		return nil
+	}
+	e := &APIError{StatusCode: http.StatusInternalServerError, Message: "job failed", RequestID: j.ID}
+	if j.Error != nil {
+		e.StatusCode, e.Message, e.Code, e.Details = j.Error.StatusCode, j.Error.Message, j.Error.Code, j.Error.Details
+	}
+	return e
+}
+
+// SubmitJob starts req on the named agent in the background and returns
+// the pending job at once. Use it for tasks that outlive an HTTP request,
+// then follow the job with GetJob or WaitJob, or have the server POST it to
+// a URL with WithCallback once it finishes. Jobs always go over HTTP,
+// whatever transport agent calls use.
+func (c *Client) SubmitJob(ctx context.Context, agentName string, req AgentRequest, opts ...CallOption) (*Job, error) {
+	if agentName == "" {
+		agentName = c.defaultAgent
+	}
+	if agentName == "" {
+		return nil, errors.New("mpcclient: agent name is required")
+	}
+	o := c.callOptions(opts)
+	req = o.request(req)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	if o.callbackURL != "" {
+		ctx = withCallbackURL(ctx, o.callbackURL)
+	}
+
+	path := "/jobs/" + url.PathEscape(agentName)
+	var job Job
+	var err error
+	if len(req.Attachments) > 0 {
+		err = c.doMultipart(ctx, path, req, &job)
+	} else {
+		err = c.do(ctx, http.MethodPost, path, req, &job)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: submit job to agent %q: %w", agentName, err)
+	}
+	return &job, nil
+}
+
+// GetJob returns the current state of a job.
+func (c *Client) GetJob(ctx context.Context, id string, opts ...CallOption) (*Job, error) {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+	job, err := c.getJob(ctx, id, 0)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: get job %q: %w", id, err)
+	}
+	return job, nil
+}
+
+// WaitJob long-polls the server until the job finishes and returns it. A
+// failed job is returned together with its Err. WaitJob gives up only when
+// ctx is done; the client's timeout, or one set with WithRequestTimeout,
+// bounds each poll rather than the whole wait.
+func (c *Client) WaitJob(ctx context.Context, id string, opts ...CallOption) (*Job, error) {
+	o := c.callOptions(opts)
+	wait := jobWait
+	if t := o.budget.Total; t > 0 && t <= 2*wait {
+		wait = t / 2
+	}
+	for {
+		pctx, cancel := o.context(ctx)
+		job, err := c.getJob(pctx, id, wait)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("mpcclient: wait for job %q: %w", id, err)
+		}
+		if job.Done() {
+			return job, job.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return job, fmt.Errorf("mpcclient: wait for job %q: %w", id, classify(err))
+		}
+	}
+}
+
+func (c *Client) getJob(ctx context.Context, id string, wait time.Duration) (*Job, error) {
+	if id == "" {
+		return nil, errors.New("job ID is required")
+	}
+	path := "/jobs/" + url.PathEscape(id)
+	if wait > 0 {
+		path += "?" + url.Values{"wait": {wait.String()}}.Encode()
+	}
+	var job Job
+	if err := c.do(ctx, http.MethodGet, path, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
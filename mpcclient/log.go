@@ -0,0 +1,149 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultMaxPromptLen is how many characters of a prompt are logged when
+// LogConfig.MaxPromptLen is zero.
+const defaultMaxPromptLen = 64
+
+// redacted replaces the values of sensitive fields in logs.
+const redacted = "[REDACTED]"
+
+// LogConfig controls what a client configured with WithLogger records.
+type LogConfig struct {
+	// Level is the level completed agent calls are logged at; the zero value
+	// is slog.LevelInfo. Failed calls are logged at slog.LevelWarn or above,
+	// and individual HTTP exchanges at slog.LevelDebug.
+	Level slog.Level
+	// IncludePrompts adds prompts to call records. Prompts may carry
+	// sensitive data, so they are redacted unless this is set; with
+	// WithRedaction, secrets are scrubbed from the prompts included.
+	IncludePrompts bool
+	// MaxPromptLen truncates logged prompts to this many characters. It
+	// defaults to 64.
+	MaxPromptLen int
+}
+
+// logCall records the outcome of one agent call or stream.
+func (c *Client) logCall(ctx context.Context, msg, agentName, prompt string, start time.Time, resp *AgentResponse, err error) {
+	if c.logger == nil {
+		return
+	}
+	level := c.logCfg.Level
+	attrs := []slog.Attr{
+		slog.String("agent", agentName),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("prompt", c.logPrompt(prompt)),
+	}
+	if err != nil {
+		level = max(level, slog.LevelWarn)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			attrs = append(attrs, slog.Int("status", apiErr.StatusCode))
+		}
+		attrs = append(attrs, c.logError(err))
+	} else if resp != nil {
+		attrs = append(attrs, slog.String("status", resp.Status))
+	}
+	if id := logRequestID(ctx, resp, err); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logRequestID returns the ID to log for a call: the server's, if it
+// reported one, or else the one the call was sent with.
+func logRequestID(ctx context.Context, resp *AgentResponse, err error) string {
+	var apiErr *APIError
+	switch {
+	case resp != nil && resp.RequestID != "":
+		return resp.RequestID
+	case errors.As(err, &apiErr) && apiErr.RequestID != "":
+		return apiErr.RequestID
+	}
+	return RequestIDFromContext(ctx)
+}
+
+// logHTTP records one HTTP exchange at debug level.
+func (c *Client) logHTTP(req *http.Request, res *http.Response, err error, start time.Time) {
+	if c.logger == nil || !c.logger.Enabled(req.Context(), slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.Redacted()),
+		slog.Any("headers", redactedHeader(req.Header)),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, c.logError(err))
+	} else {
+		attrs = append(attrs, slog.Int("status", res.StatusCode))
+	}
+	c.logger.LogAttrs(req.Context(), slog.LevelDebug, "mpcclient: http request", attrs...)
+}
+
+// logError returns the attribute recording err, scrubbed by the client's
+// redactor if it has one.
+func (c *Client) logError(err error) slog.Attr {
+	if r := c.redactor(); r != nil {
+		return slog.String("error", r.Redact(err.Error()))
+	}
+	return slog.Any("error", err)
+}
+
+// logPrompt returns the form of prompt that may be logged.
+func (c *Client) logPrompt(prompt string) string {
+	if !c.logCfg.IncludePrompts {
+		return redacted
+	}
+	prompt = c.redactor().Redact(prompt)
+	n := c.logCfg.MaxPromptLen
+	if n <= 0 {
+		n = defaultMaxPromptLen
+	}
+	if utf8.RuneCountInString(prompt) <= n {
+		return prompt
+	}
+	return string([]rune(prompt)[:n]) + "…"
+}
+
+// redactedHeader logs a header set with credentials masked.
+type redactedHeader http.Header
+
+func (h redactedHeader) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for k, vs := range h {
+		v := strings.Join(vs, ", ")
+		if sensitiveHeader(k) {
+			v = redacted
+		}
+		attrs = append(attrs, slog.String(k, v))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// sensitiveHeader reports whether a header's value must not be logged.
+// Besides the standard credential headers it matches custom ones such as
+// X-API-Key or X-Auth-Token by name.
+func sensitiveHeader(key string) bool {
+	switch k := strings.ToLower(key); k {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	default:
+		for _, s := range []string{"key", "token", "secret", "password"} {
+			if strings.Contains(k, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,109 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logRecords decodes the JSON lines written by a slog.JSONHandler.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func newLoggingClient(t *testing.T, status int, cfg LogConfig) (*Client, *bytes.Buffer) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"result":"ok","status":"success","request_id":"req-1","error":"boom"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, err := NewClient(srv.URL, WithLogger(logger), WithLogConfig(cfg), WithAPIKey("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, &buf
+}
+
+func TestLoggingRedactsByDefault(t *testing.T) {
+	c, buf := newLoggingClient(t, http.StatusOK, LogConfig{})
+	if _, err := c.CallAgent(context.Background(), "echo", "my password is hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "s3cret") || strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("log leaks credentials or prompt:\n%s", buf)
+	}
+
+	recs := logRecords(t, buf)
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want http + call:\n%s", len(recs), buf)
+	}
+	httpRec, call := recs[0], recs[1]
+	if httpRec["level"] != "DEBUG" || httpRec["method"] != "POST" || httpRec["status"] != float64(200) {
+		t.Errorf("http record = %v", httpRec)
+	}
+	if h := httpRec["headers"].(map[string]any); h["X-Api-Key"] != redacted {
+		t.Errorf("headers = %v", h)
+	}
+	if call["level"] != "INFO" || call["agent"] != "echo" || call["prompt"] != redacted ||
+		call["status"] != "success" || call["request_id"] != "req-1" {
+		t.Errorf("call record = %v", call)
+	}
+	if _, ok := call["latency"]; !ok {
+		t.Error("call record has no latency")
+	}
+}
+
+func TestLoggingTruncatesPrompts(t *testing.T) {
+	c, buf := newLoggingClient(t, http.StatusOK, LogConfig{Level: slog.LevelDebug, IncludePrompts: true, MaxPromptLen: 5})
+	if _, err := c.CallAgent(context.Background(), "echo", "héllo world"); err != nil {
+		t.Fatal(err)
+	}
+	call := logRecords(t, buf)[1]
+	if call["level"] != "DEBUG" || call["prompt"] != "héllo…" {
+		t.Errorf("call record = %v", call)
+	}
+}
+
+func TestLoggingFailedCall(t *testing.T) {
+	c, buf := newLoggingClient(t, http.StatusBadGateway, LogConfig{})
+	if _, err := c.CallAgent(context.Background(), "echo", "hi"); err == nil {
+		t.Fatal("expected error")
+	}
+	call := logRecords(t, buf)[1]
+	if call["level"] != "WARN" || call["status"] != float64(502) || !strings.Contains(call["error"].(string), "boom") {
+		t.Errorf("call record = %v", call)
+	}
+}
+
+func TestSensitiveHeader(t *testing.T) {
+	for k, want := range map[string]bool{
+		"Authorization": true,
+		"X-API-Key":     true,
+		"X-Auth-Token":  true,
+		"Cookie":        true,
+		"Content-Type":  false,
+		"X-Workshop":    false,
+	} {
+		if got := sensitiveHeader(k); got != want {
+			t.Errorf("sensitiveHeader(%q) = %v, want %v", k, got, want)
+		}
+	}
+}
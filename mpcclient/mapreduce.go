@@ -0,0 +1,37 @@
+package mpcclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// MapReduce sends one call per item, building each with mapPrompt, and
+// combines their results with reduce, as when labeling or classifying a
+// dataset. The calls run as a batch under opts, with its concurrency
+// limit, item retries and progress reports, while reduce sees every
+// item's result in the order of items, failed or not, and decides what
+// failures mean. MapReduce returns what reduce returns, except that it
+// returns without reducing when ctx is cancelled or, with
+// opts.StopOnError, when an item fails.
+//
+// MapReduce is a function rather than a Client method because methods
+// cannot have type parameters.
+func MapReduce[T, R any](ctx context.Context, c *Client, items []T, mapPrompt func(T) BatchRequest, reduce func([]BatchResult) (R, error), opts BatchOptions) (R, error) {
+	var zero R
+	reqs := make([]BatchRequest, len(items))
+	for i, item := range items {
+		reqs[i] = mapPrompt(item)
+	}
+	results, err := c.CallAgentBatch(ctx, reqs, opts)
+	if ctx.Err() != nil {
+		return zero, ctx.Err()
+	}
+	if err != nil && opts.StopOnError {
+		return zero, err
+	}
+	out, err := reduce(results)
+	if err != nil {
+		return zero, fmt.Errorf("mpcclient: reduce: %w", err)
+	}
+	return out, nil
+}
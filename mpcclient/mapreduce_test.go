@@ -0,0 +1,87 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMapReduce(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		seen[req.Prompt]++
+		n := seen[req.Prompt]
+		mu.Unlock()
+		if strings.HasSuffix(req.Prompt, "flaky") && n == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"overloaded"}`))
+			return
+		}
+		label := "negative"
+		if strings.Contains(req.Prompt, "good") {
+			label = "positive"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"agent": "labeler", "result": label})
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	items := []string{"good film", "bad film", "good but flaky", "bad plot"}
+	label := func(s string) BatchRequest {
+		return BatchRequest{Agent: "labeler", Request: AgentRequest{Prompt: "Label: " + s}}
+	}
+	var attempts int
+	count := func(results []BatchResult) (map[string]int, error) {
+		counts := map[string]int{}
+		for _, res := range results {
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			attempts += res.Attempts
+			counts[res.Response.Result]++
+		}
+		return counts, nil
+	}
+
+	counts, err := MapReduce(context.Background(), c, items, label, count, BatchOptions{
+		Concurrency: 2,
+		Retry:       RetryPolicy{MaxAttempts: 2, RetryableStatus: []int{http.StatusInternalServerError}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["positive"] != 2 || counts["negative"] != 2 {
+		t.Errorf("counts = %v", counts)
+	}
+	if attempts != 5 {
+		t.Errorf("made %d attempts, want 5 with one retry", attempts)
+	}
+
+	// Without retries the flaky item reaches reduce as a failure.
+	seen = map[string]int{}
+	_, err = MapReduce(context.Background(), c, items, label, count, BatchOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || !strings.HasPrefix(err.Error(), "mpcclient: reduce: ") {
+		t.Errorf("err = %v, want reduce's error", err)
+	}
+
+	// With StopOnError a failure returns before reducing.
+	seen = map[string]int{}
+	reduced := false
+	_, err = MapReduce(context.Background(), c, items, label, func([]BatchResult) (int, error) {
+		reduced = true
+		return 0, nil
+	}, BatchOptions{Concurrency: 1, StopOnError: true})
+	if err == nil || reduced {
+		t.Errorf("err = %v, reduced = %v; want the batch error without reducing", err, reduced)
+	}
+}
@@ -0,0 +1,132 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultSummaryKeepTurns is the number of newest exchanges a Summarizer
+// keeps verbatim when KeepTurns is zero.
+const DefaultSummaryKeepTurns = 2
+
+// Summarizer configures a session's summarization memory: once the history
+// passes either threshold, the exchanges before the newest KeepTurns are
+// replaced by a summary written by Agent. Zero thresholds never trigger.
+type Summarizer struct {
+	// Agent writes the summaries.
+	Agent string `json:"agent"`
+	// Client calls Agent. It defaults to the session's client, and is not
+	// saved with the session.
+	Client *Client `json:"-"`
+	// MaxTokens summarizes once the estimated token count of the history,
+	// less system prompts, passes it, counted by the session's policy.
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// MaxTurns summarizes once the history holds more exchanges.
+	MaxTurns int `json:"max_turns,omitempty"`
+	// KeepTurns is the number of newest exchanges kept verbatim,
+	// DefaultSummaryKeepTurns when zero.
+	KeepTurns int `json:"keep_turns,omitempty"`
+	// SummaryWords bounds the length of a summary, a quarter of MaxTokens
+	// in words when zero, and 200 words without MaxTokens.
+	SummaryWords int `json:"summary_words,omitempty"`
+}
+
+// WithSummarizer gives the session a summarization memory, so that long
+// conversations stay within bounds without forgetting their start.
+func WithSummarizer(sm Summarizer) SessionOption {
+	return func(s *Session) {
+		s.summarizer = &sm
+	}
+}
+
+// Summarize replaces the exchanges before the newest KeepTurns by a summary
+// now, whether or not the history has reached the summarizer's thresholds.
+// The summarizer's usage counts against the session's budget. It fails
+// when the session has no summarizer or the summarizer agent fails,
+// leaving the history unchanged.
+func (s *Session) Summarize(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.summarizer == nil {
+		return errors.New("mpcclient: session has no summarizer")
+	}
+	return s.summarize(ctx)
+}
+
+// maybeSummarize summarizes the history once it is past the summarizer's
+// thresholds. A failed summary is not fatal to the send that triggered
+// it: the history stays as it is, to be trimmed by the policy and
+// summarized on a later send.
+func (s *Session) maybeSummarize(ctx context.Context) {
+	sm := s.summarizer
+	if sm == nil {
+		return
+	}
+	var rest []Message
+	for _, m := range s.messages {
+		if m.Role != RoleSystem || isSummary(m) {
+			rest = append(rest, m)
+		}
+	}
+	// A summary opens an exchange of its own, which the turns exclude.
+	turns := len(exchanges(rest))
+	if len(rest) > 0 && isSummary(rest[0]) {
+		turns--
+	}
+	if (sm.MaxTurns > 0 && turns > sm.MaxTurns) || (sm.MaxTokens > 0 && CountTokens(rest, s.policy.EstimateTokens) > sm.MaxTokens) {
+		s.summarize(ctx)
+	}
+}
+
+// summarize replaces the older exchanges by a summary. s.mu must be held.
+func (s *Session) summarize(ctx context.Context) error {
+	sm := s.summarizer
+	keepTurns := sm.KeepTurns
+	if keepTurns <= 0 {
+		keepTurns = DefaultSummaryKeepTurns
+	}
+	words := sm.SummaryWords
+	if words <= 0 {
+		words = 200
+		if sm.MaxTokens > 0 {
+			words = max(sm.MaxTokens/4*3/4, 10)
+		}
+	}
+	client := sm.Client
+	if client == nil {
+		client = s.client
+	}
+
+	var system, rest []Message
+	for _, m := range s.messages {
+		if m.Role == RoleSystem && !isSummary(m) {
+			system = append(system, m)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+	turns := exchanges(rest)
+	if len(turns) <= keepTurns {
+		return nil
+	}
+	var old, kept []Message
+	for _, t := range turns[:len(turns)-keepTurns] {
+		old = append(old, t...)
+	}
+	if len(old) == 1 && isSummary(old[0]) {
+		return nil
+	}
+	for _, t := range turns[len(turns)-keepTurns:] {
+		kept = append(kept, t...)
+	}
+	sum, resp, err := summarizeMessages(ctx, client, sm.Agent, old, words)
+	if err != nil {
+		return err
+	}
+	if resp.Usage != nil {
+		s.used = s.used.Add(*resp.Usage)
+		s.cost += client.usage.price(sm.Agent, *resp.Usage)
+	}
+	s.messages = append(append(system, sum), kept...)
+	return nil
+}
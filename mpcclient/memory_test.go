@@ -0,0 +1,118 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// memoryServer serves a "chat" agent echoing prompts and a "summarizer"
+// agent that reports its usage, failing while *down is set.
+func memoryServer(t *testing.T, summaries *[]string, down *atomic.Bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.HasSuffix(r.URL.Path, "/summarizer") {
+			if down.Load() {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "down"})
+				return
+			}
+			*summaries = append(*summaries, req.Prompt)
+			json.NewEncoder(w).Encode(AgentResponse{Agent: "summarizer", Result: "sum", Usage: &Usage{PromptTokens: 10, CompletionTokens: 2}})
+			return
+		}
+		json.NewEncoder(w).Encode(AgentResponse{Agent: "chat", Result: "re: " + req.Prompt})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSessionSummarizes(t *testing.T) {
+	var summaries []string
+	var down atomic.Bool
+	c, _ := NewClient(memoryServer(t, &summaries, &down).URL)
+	s := c.NewSession("chat", WithSystemPrompt("be brief"), WithSummarizer(Summarizer{Agent: "summarizer", MaxTurns: 3, KeepTurns: 1, SummaryWords: 50}))
+
+	ctx := context.Background()
+	for _, p := range []string{"one", "two", "three"} {
+		if _, err := s.Send(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(summaries) != 0 {
+		t.Fatalf("summarized before the threshold: %q", summaries)
+	}
+	if _, err := s.Send(ctx, "four"); err != nil {
+		t.Fatal(err)
+	}
+	if contents(s.History()) != "be brief "+summaryPrefix+"sum four re: four" {
+		t.Errorf("history = %+v", s.History())
+	}
+	if len(summaries) != 1 || !strings.Contains(summaries[0], "at most 50 words") || !strings.Contains(summaries[0], "user: three\nassistant: re: three\n") {
+		t.Errorf("summary prompts = %q", summaries)
+	}
+	if u := s.Usage(); u.PromptTokens != 10 {
+		t.Errorf("usage = %+v, want the summarizer's", u)
+	}
+
+	// A failing summarizer leaves the history to be summarized later.
+	down.Store(true)
+	for _, p := range []string{"five", "six", "seven"} {
+		if _, err := s.Send(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.History()); n != 10 {
+		t.Errorf("history of %d messages, want 10", n)
+	}
+	down.Store(false)
+	if err := s.Summarize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if contents(s.History()) != "be brief "+summaryPrefix+"sum seven re: seven" || !strings.Contains(summaries[1], "earlier summary: sum\n") {
+		t.Errorf("history = %+v after %q", s.History(), summaries[1])
+	}
+
+	// The summarizer survives a save, and Reset forgets the summary.
+	path := filepath.Join(t.TempDir(), "s.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := c.LoadSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.summarizer == nil || loaded.summarizer.MaxTurns != 3 {
+		t.Errorf("loaded summarizer = %+v", loaded.summarizer)
+	}
+	loaded.Reset()
+	if contents(loaded.History()) != "be brief" {
+		t.Errorf("history after reset = %+v", loaded.History())
+	}
+}
+
+func TestSessionSummarizesByTokens(t *testing.T) {
+	var summaries []string
+	c, _ := NewClient(memoryServer(t, &summaries, new(atomic.Bool)).URL)
+	s := c.NewSession("chat", WithSummarizer(Summarizer{Agent: "summarizer", MaxTokens: 10}))
+	for _, p := range []string{"one", "two", "three"} {
+		if _, err := s.Send(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The exchanges are 3, 3 and 5 tokens, so the third passes the
+	// threshold and the two newest are kept.
+	if len(summaries) != 1 || contents(s.History()) != summaryPrefix+"sum two re: two three re: three" {
+		t.Errorf("history = %+v after %d summaries", s.History(), len(summaries))
+	}
+	if err := c.NewSession("chat").Summarize(context.Background()); err == nil {
+		t.Error("Summarize without a summarizer should fail")
+	}
+}
@@ -0,0 +1,44 @@
+package mpcclient
+
+import "maps"
+
+// WithMetadata labels the call with md, such as the user, team or workshop
+// exercise it is made for. The Go server records the labels in its logs
+// and audit records, so that usage can be attributed. They are merged over
+// the client's default metadata and the request's own, and repeated
+// options merge, later ones winning.
+func WithMetadata(md map[string]string) CallOption {
+	return func(o *callOptions) {
+		if o.metadata == nil {
+			o.metadata = make(map[string]string, len(md))
+		}
+		maps.Copy(o.metadata, md)
+	}
+}
+
+// WithDefaultMetadata labels every call of the client with md, as
+// WithMetadata does for one call.
+func WithDefaultMetadata(md map[string]string) Option {
+	return func(c *Client) {
+		if c.metadata == nil {
+			c.metadata = make(map[string]string, len(md))
+		}
+		maps.Copy(c.metadata, md)
+	}
+}
+
+// withMetadata returns req with the client's and the call's metadata
+// merged in.
+func (o callOptions) withMetadata(req AgentRequest) AgentRequest {
+	if o.defaultMetadata == nil && o.metadata == nil {
+		return req
+	}
+	merged := maps.Clone(o.defaultMetadata)
+	if merged == nil {
+		merged = make(map[string]string, len(req.Metadata)+len(o.metadata))
+	}
+	maps.Copy(merged, req.Metadata)
+	maps.Copy(merged, o.metadata)
+	req.Metadata = merged
+	return req
+}
@@ -0,0 +1,53 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithMetadata(t *testing.T) {
+	var got []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		got = append(got, req.Metadata)
+		json.NewEncoder(w).Encode(map[string]any{"result": "ok"})
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithDefaultMetadata(map[string]string{"team": "blue", "exercise": "1"}))
+	ctx := context.Background()
+	req := AgentRequest{Prompt: "hi", Metadata: map[string]string{"exercise": "2", "user": "ada"}}
+	if _, err := c.Invoke(ctx, "echo", req, WithMetadata(map[string]string{"user": "grace"}), WithMetadata(map[string]string{"seat": "4"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := NewClient(srv.URL)
+	if _, err := plain.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Call options win over the request, which wins over the defaults.
+	want := []map[string]string{
+		{"team": "blue", "exercise": "2", "user": "grace", "seat": "4"},
+		{"team": "blue", "exercise": "1"},
+		nil,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d calls, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !maps.Equal(got[i], want[i]) {
+			t.Errorf("call %d sent metadata %v, want %v", i, got[i], want[i])
+		}
+	}
+	if req.Metadata["user"] != "ada" {
+		t.Error("the caller's request was modified")
+	}
+}
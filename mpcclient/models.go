@@ -0,0 +1,200 @@
+package mpcclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AgentRequest is the body posted to /agent/{name}.
+type AgentRequest struct {
+	Prompt string `json:"prompt"`
+	// Context carries free-form data the agent may use alongside the prompt.
+	Context map[string]any `json:"context,omitempty"`
+	// Parameters carries structured arguments for agents that accept them.
+	Parameters map[string]any `json:"parameters,omitempty"`
+	// Messages is the conversation preceding Prompt, oldest first.
+	Messages []Message `json:"messages,omitempty"`
+	// Tools describes the tools the agent may call instead of answering.
+	Tools []ToolSpec `json:"tools,omitempty"`
+	// ToolResults answers the tool calls of earlier rounds, oldest first.
+	ToolResults []ToolResult `json:"tool_results,omitempty"`
+	// Format is the response format asked for; WithFormat sets it.
+	Format Format `json:"format,omitempty"`
+	// Metadata labels the call for attribution; WithMetadata sets it.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Priority is the call's scheduling class; WithPriority sets it.
+	Priority Priority `json:"priority,omitempty"`
+	// Board is the session ID of the shared context board the agent may
+	// read and write; WithBoard sets it.
+	Board string `json:"board,omitempty"`
+	// Generation carries the model and sampling parameters asked for;
+	// WithModel, WithTemperature, WithMaxTokens and WithStopSequences set
+	// it.
+	Generation *Generation `json:"generation,omitempty"`
+	// Requires is what the call needs of its agent;
+	// WithMinAgentVersion and WithRequiredCapabilities set it.
+	Requires *Requirements `json:"requires,omitempty"`
+	// Attachments are files uploaded with the request as multipart form
+	// data. They require the default HTTP transport.
+	Attachments []Attachment `json:"-"`
+}
+
+// AgentResponse is the result of an agent call.
+type AgentResponse struct {
+	Agent           string  `json:"agent"`
+	Prompt          string  `json:"prompt,omitempty"`
+	Result          string  `json:"result"`
+	Status          string  `json:"status,omitempty"`
+	RequestID       string  `json:"request_id,omitempty"`
+	ExecutionTimeMS float64 `json:"execution_time_ms,omitempty"`
+	// Timestamp is passed through as sent; servers differ in the format.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Data holds a structured payload for agents that return one.
+	Data      json.RawMessage `json:"data,omitempty"`
+	ToolCalls []ToolCall      `json:"tool_calls,omitempty"`
+	Usage     *Usage          `json:"usage,omitempty"`
+	Metadata  map[string]any  `json:"metadata,omitempty"`
+	Error     *AgentError     `json:"error,omitempty"`
+	// Format is the format of Result, for agents that report it.
+	Format Format `json:"format,omitempty"`
+	// AgentVersion is the version of the agent that answered, and
+	// ProtocolVersion that of the server, for servers that report them.
+	AgentVersion    string `json:"agent_version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+
+	// Route reports which target answered a call to an agent configured
+	// with WithFallback. It is nil otherwise, and is not sent on the wire.
+	Route *Route `json:"-"`
+	// Canned reports that the response came from an offline fixture, as
+	// WithOffline serves them, rather than from the agent.
+	Canned bool `json:"-"`
+}
+
+// Usage reports the tokens consumed by a call.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ToolCall is a request from the agent to run a named tool.
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// DecodeArguments unmarshals the tool call's arguments into v.
+func (tc ToolCall) DecodeArguments(v any) error {
+	if len(tc.Arguments) == 0 {
+		return fmt.Errorf("tool call %q has no arguments", tc.Name)
+	}
+	if err := json.Unmarshal(tc.Arguments, v); err != nil {
+		return fmt.Errorf("decode arguments of tool call %q: %w", tc.Name, err)
+	}
+	return nil
+}
+
+// AgentError is the error body the server sends with a failed request, or
+// embeds in a response whose status is "error".
+type AgentError struct {
+	Message string          `json:"error"`
+	Code    string          `json:"code,omitempty"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *AgentError) Error() string {
+	if e.Code != "" {
+		return e.Code + ": " + e.Message
+	}
+	return e.Message
+}
+
+// UnmarshalJSON accepts both the object form and the bare string some
+// servers put in the "error" field.
+func (e *AgentError) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*e = AgentError{Message: s}
+		return nil
+	}
+	type plain AgentError
+	return json.Unmarshal(b, (*plain)(e))
+}
+
+// ErrNoPayload is returned by AgentResponse.JSON when the response carries
+// neither a data payload nor a result.
+var ErrNoPayload = errors.New("response has no payload")
+
+// Text returns the response's result text with surrounding whitespace
+// removed.
+func (r *AgentResponse) Text() string {
+	return strings.TrimSpace(r.Result)
+}
+
+// JSON unmarshals the response's structured payload into v. The Data field
+// is used when present; otherwise Result is decoded as JSON, ignoring a
+// surrounding Markdown code fence. A Result the agent reports as another
+// format is a *FormatError.
+func (r *AgentResponse) JSON(v any) error {
+	src, err := r.payload()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(src, v); err != nil {
+		return fmt.Errorf("decode response payload: %w", err)
+	}
+	return nil
+}
+
+// payload returns the bytes JSON decodes.
+func (r *AgentResponse) payload() ([]byte, error) {
+	if len(r.Data) > 0 {
+		return r.Data, nil
+	}
+	if err := r.checkFormat(FormatJSON); err != nil {
+		return nil, err
+	}
+	text := stripFence(r.Text())
+	if text == "" {
+		return nil, ErrNoPayload
+	}
+	return []byte(text), nil
+}
+
+// ToolCall returns the first tool call with the given name.
+func (r *AgentResponse) ToolCall(name string) (ToolCall, bool) {
+	for _, tc := range r.ToolCalls {
+		if tc.Name == name {
+			return tc, true
+		}
+	}
+	return ToolCall{}, false
+}
+
+// Err returns the agent-reported failure carried by a response whose status
+// is "error", or nil.
+func (r *AgentResponse) Err() error {
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.Status == "error" {
+		return &AgentError{Message: r.Text()}
+	}
+	return nil
+}
+
+// stripFence removes a Markdown code fence wrapping the whole of s.
+func stripFence(s string) string {
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	body := strings.TrimSuffix(s[3:], "```")
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	}
+	return strings.TrimSpace(body)
+}
@@ -0,0 +1,81 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAgentResponseJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		resp AgentResponse
+	}{
+		{"data", AgentResponse{Data: json.RawMessage(`{"cpu":45}`), Result: "ignored"}},
+		{"result", AgentResponse{Result: ` {"cpu":45} `}},
+		{"fenced", AgentResponse{Result: "```json\n{\"cpu\":45}\n```"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v struct{ CPU int }
+			if err := tt.resp.JSON(&v); err != nil {
+				t.Fatal(err)
+			}
+			if v.CPU != 45 {
+				t.Errorf("cpu = %d", v.CPU)
+			}
+		})
+	}
+
+	var v any
+	if err := (&AgentResponse{}).JSON(&v); err != ErrNoPayload {
+		t.Errorf("empty response err = %v, want ErrNoPayload", err)
+	}
+}
+
+func TestAgentResponseToolCall(t *testing.T) {
+	var resp AgentResponse
+	err := json.Unmarshal([]byte(`{"agent":"a","result":"","tool_calls":[{"id":"1","name":"get_metrics","arguments":{"vm":"web01"}}]}`), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc, ok := resp.ToolCall("get_metrics")
+	if !ok {
+		t.Fatal("tool call not found")
+	}
+	var args struct{ VM string }
+	if err := tc.DecodeArguments(&args); err != nil || args.VM != "web01" {
+		t.Errorf("args = %+v, err = %v", args, err)
+	}
+}
+
+func TestAgentResponseErr(t *testing.T) {
+	var resp AgentResponse
+	if err := json.Unmarshal([]byte(`{"status":"error","error":"agent crashed"}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.Err(); err == nil || err.Error() != "agent crashed" {
+		t.Errorf("Err() = %v", err)
+	}
+	if err := (&AgentResponse{Status: "success"}).Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"agent":"a","result":"ok","surprise":true}`))
+	}))
+	defer srv.Close()
+
+	lenient, _ := NewClient(srv.URL)
+	if _, err := lenient.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatalf("lenient client: %v", err)
+	}
+	strict, _ := NewClient(srv.URL, WithStrictDecoding())
+	if _, err := strict.CallAgent(context.Background(), "a", "hi"); err == nil {
+		t.Fatal("strict client accepted unknown field")
+	}
+}
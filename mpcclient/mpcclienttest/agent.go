@@ -0,0 +1,179 @@
+package mpcclienttest
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Reply is one scripted answer of a fake agent.
+type Reply struct {
+	// Text is the result of a successful call.
+	Text string
+	// Response, when set, is sent instead of a response built from Text.
+	Response *mpcclient.AgentResponse
+	// Status, when non-zero, fails the call with that HTTP status and an
+	// error body carrying Code and Message.
+	Status  int
+	Code    string
+	Message string
+	// Delay holds the reply back, on top of the agent's latency.
+	Delay time.Duration
+	// Chunks are the pieces a stream delivers. Without them a stream
+	// delivers the result as a single chunk; a plain call answers with them
+	// joined when Text is empty.
+	Chunks []string
+	// StreamError ends a stream with an error event after the chunks.
+	StreamError string
+	// DropAfter, when positive, cuts the connection of a stream after that
+	// many chunks, as a flaky network would. The server resumes the stream
+	// when the client reconnects with a Last-Event-ID header.
+	DropAfter int
+}
+
+// Agent is a scripted agent of a fake server. Its methods may be called
+// while the server is handling requests.
+type Agent struct {
+	mu      sync.Mutex
+	info    mpcclient.AgentInfo
+	replies []Reply
+	handler func(mpcclient.AgentRequest) Reply
+	latency time.Duration
+	chaos   Chaos
+	rand    *rand.Rand
+	faults  Faults
+}
+
+// Describe sets the metadata returned by agent discovery. The name is
+// kept.
+func (a *Agent) Describe(info mpcclient.AgentInfo) *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	info.Name = a.info.Name
+	a.info = info
+	return a
+}
+
+// Script queues replies, given in the order calls should receive them.
+// Once the queue is down to its last reply, that reply answers every
+// further call.
+func (a *Agent) Script(replies ...Reply) *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.replies = append(a.replies, replies...)
+	return a
+}
+
+// Reply queues a successful reply with the given result.
+func (a *Agent) Reply(text string) *Agent {
+	return a.Script(Reply{Text: text})
+}
+
+// Respond queues resp as a reply.
+func (a *Agent) Respond(resp *mpcclient.AgentResponse) *Agent {
+	return a.Script(Reply{Response: resp})
+}
+
+// Fail queues a reply failing with status and message.
+func (a *Agent) Fail(status int, message string) *Agent {
+	code := "agent_error"
+	if status < http.StatusInternalServerError {
+		code = "invalid_request"
+	}
+	return a.Script(Reply{Status: status, Code: code, Message: message})
+}
+
+// Stream queues a reply streaming chunks.
+func (a *Agent) Stream(chunks ...string) *Agent {
+	return a.Script(Reply{Chunks: chunks})
+}
+
+// Handle answers calls with fn once the scripted replies are used up, in
+// place of echoing the prompt.
+func (a *Agent) Handle(fn func(req mpcclient.AgentRequest) Reply) *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handler = fn
+	return a
+}
+
+// Latency delays every reply, and every chunk of a stream, by d.
+func (a *Agent) Latency(d time.Duration) *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.latency = d
+	return a
+}
+
+// next returns the reply to req: the next scripted one, then the handler's,
+// or an echo of the prompt.
+func (a *Agent) next(req mpcclient.AgentRequest) Reply {
+	a.mu.Lock()
+	h := a.handler
+	if n := len(a.replies); n > 1 || n == 1 && h != nil {
+		r := a.replies[0]
+		a.replies = a.replies[1:]
+		a.mu.Unlock()
+		return r
+	} else if n == 1 {
+		r := a.replies[0]
+		a.mu.Unlock()
+		return r
+	}
+	a.mu.Unlock()
+	if h != nil {
+		return h(req)
+	}
+	return Reply{Text: req.Prompt}
+}
+
+// wait sleeps for the agent's latency plus the reply's delay. It reports
+// false if the client went away first.
+func (a *Agent) wait(r *http.Request, reply Reply) bool {
+	a.mu.Lock()
+	d := a.latency + reply.Delay
+	a.mu.Unlock()
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (a *Agent) describe() mpcclient.AgentInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.info
+}
+
+// response builds the response sent for a successful reply to req.
+func (r Reply) response(agent string, req mpcclient.AgentRequest) *mpcclient.AgentResponse {
+	if r.Response != nil {
+		resp := *r.Response
+		if resp.Agent == "" {
+			resp.Agent = agent
+		}
+		return &resp
+	}
+	text := r.Text
+	if text == "" {
+		text = strings.Join(r.Chunks, "")
+	}
+	return &mpcclient.AgentResponse{
+		Agent:     agent,
+		Prompt:    req.Prompt,
+		Result:    text,
+		Status:    "success",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
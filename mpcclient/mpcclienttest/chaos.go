@@ -0,0 +1,121 @@
+package mpcclienttest
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Chaos injects failures into an agent's replies at random, so that code
+// can be checked to retry, time out and report errors as it should under
+// the faults a real deployment sees. Each rate is a probability from 0 to
+// 1, drawn afresh for every call.
+type Chaos struct {
+	// ErrorRate is the share of calls failed with ErrorStatus.
+	ErrorRate float64
+	// ErrorStatus is the status of injected failures, 503 by default,
+	// sent with the code Agent.Fail would send.
+	ErrorStatus int
+	// SlowRate is the share of replies held back by SlowDelay, on top of
+	// the agent's latency.
+	SlowRate  float64
+	SlowDelay time.Duration
+	// TruncateRate is the share of replies cut short: a plain call's body
+	// stops halfway through its JSON, and a stream's connection is cut
+	// before a random chunk, as Reply.DropAfter cuts it.
+	TruncateRate float64
+	// MalformedRate is the share of replies that are not valid JSON: a
+	// plain call is answered with the HTML error page of a proxy, and a
+	// stream ends with an event whose data does not parse.
+	MalformedRate float64
+	// Seed makes the faults repeatable across runs; zero draws them
+	// differently each time.
+	Seed uint64
+}
+
+// Faults counts the faults injected into an agent's replies.
+type Faults struct {
+	Errors    int
+	Slow      int
+	Truncated int
+	Malformed int
+}
+
+// Chaos injects the faults c describes into the agent's replies, scripted
+// or not. A zero Chaos turns injection off.
+func (a *Agent) Chaos(c Chaos) *Agent {
+	if c.ErrorStatus == 0 {
+		c.ErrorStatus = http.StatusServiceUnavailable
+	}
+	seed := c.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.chaos = c
+	a.rand = rand.New(rand.NewPCG(seed, seed))
+	return a
+}
+
+// Faults returns the faults injected so far.
+func (a *Agent) Faults() Faults {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.faults
+}
+
+// injection is what Agent.inject decided for one reply. cutAt and
+// malformedAt are chunk indexes of a stream, or -1.
+type injection struct {
+	truncate    bool
+	malformed   bool
+	cutAt       int
+	malformedAt int
+}
+
+// inject applies the agent's chaos to reply, a stream of chunks pieces
+// when chunks is positive: failing it or slowing it down in place, and
+// returning how its body is to be damaged.
+func (a *Agent) inject(reply *Reply, chunks int) injection {
+	in := injection{cutAt: -1, malformedAt: -1}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.chaos
+	if a.rand == nil || reply.Status != 0 {
+		return in
+	}
+	hit := func(rate float64) bool {
+		return rate > 0 && a.rand.Float64() < rate
+	}
+	if hit(c.ErrorRate) {
+		a.faults.Errors++
+		reply.Status, reply.Code, reply.Message = c.ErrorStatus, "agent_error", "injected failure"
+		if c.ErrorStatus < http.StatusInternalServerError {
+			reply.Code = "invalid_request"
+		}
+		return in
+	}
+	if hit(c.SlowRate) {
+		a.faults.Slow++
+		reply.Delay += c.SlowDelay
+	}
+	switch {
+	case hit(c.TruncateRate):
+		a.faults.Truncated++
+		in.truncate = true
+		if chunks > 0 {
+			in.cutAt = a.rand.IntN(chunks)
+		}
+	case hit(c.MalformedRate):
+		a.faults.Malformed++
+		in.malformed = true
+		if chunks > 0 {
+			in.malformedAt = a.rand.IntN(chunks)
+		}
+	}
+	return in
+}
+
+// proxyErrorPage is the body of a malformed reply.
+const proxyErrorPage = "<html><head><title>502 Bad Gateway</title></head><body><h1>502 Bad Gateway</h1></body></html>\n"
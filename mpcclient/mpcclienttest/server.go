@@ -0,0 +1,400 @@
+// Package mpcclienttest provides an in-memory fake MPC server for testing
+// code built on mpcclient without a live server.
+//
+// Agents are scripted with the replies they should give, in order:
+//
+//	srv := mpcclienttest.NewServer(t)
+//	srv.Agent("azureVmMetricsAgent").
+//		Reply("CPU is at 95%").
+//		Fail(http.StatusServiceUnavailable, "backend down")
+//	c := srv.Client()
+//
+//	// ... exercise code using c ...
+//
+//	if calls := srv.Calls("azureVmMetricsAgent"); len(calls) != 2 {
+//		t.Errorf("got %d calls, want 2", len(calls))
+//	}
+//
+// The server answers the same endpoints as the real one: agent calls,
+// streams, agent discovery and health probes. Calls to agents that were not
+// registered get a 404 with code "agent_not_found".
+//
+// Agent.Chaos injects faults at random into an agent's replies, for
+// checking retry and timeout handling under realistic failures:
+//
+//	srv.Agent("azureVmMetricsAgent").Chaos(mpcclienttest.Chaos{
+//		ErrorRate:     0.2,
+//		SlowRate:      0.1,
+//		SlowDelay:     2 * time.Second,
+//		TruncateRate:  0.05,
+//		MalformedRate: 0.05,
+//	})
+package mpcclienttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Request is a request received by the fake server.
+type Request struct {
+	Method string
+	Path   string
+	// Agent is the agent addressed by an agent call or stream.
+	Agent  string
+	Header http.Header
+	// Body is the decoded agent request.
+	Body mpcclient.AgentRequest
+	// Attachments names the files uploaded with a multipart request.
+	Attachments []string
+	Stream      bool
+	Received    time.Time
+}
+
+// Server is a fake MPC server listening on a local port.
+type Server struct {
+	// URL is the base URL of the server, for use with mpcclient.NewClient.
+	URL string
+
+	srv *httptest.Server
+	tb  testing.TB
+
+	mu       sync.Mutex
+	agents   map[string]*Agent
+	requests []Request
+	notReady bool
+	// dropped holds the streams cut short by Reply.DropAfter, by request
+	// ID, for their resumption.
+	dropped map[string]Reply
+}
+
+// NewServer starts a fake server and closes it when tb's test ends.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+	s := &Server{tb: tb, agents: make(map[string]*Agent), dropped: make(map[string]Reply)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /agent/{name}", s.handleAgent)
+	mux.HandleFunc("POST /agent/{name}/stream", s.handleStream)
+	mux.HandleFunc("GET /agents", s.handleListAgents)
+	mux.HandleFunc("GET /agents/{name}", s.handleDescribeAgent)
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	tb.Cleanup(s.srv.Close)
+	return s
+}
+
+// Client returns a client for the server. It fails the test if the client
+// cannot be created.
+func (s *Server) Client(opts ...mpcclient.Option) *mpcclient.Client {
+	s.tb.Helper()
+	c, err := mpcclient.NewClient(s.URL, opts...)
+	if err != nil {
+		s.tb.Fatalf("mpcclienttest: new client: %v", err)
+	}
+	return c
+}
+
+// Close shuts the server down. It is called automatically when the test
+// ends.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Agent returns the named agent, registering it on first use.
+func (s *Server) Agent(name string) *Agent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.agents[name]
+	if !ok {
+		a = &Agent{info: mpcclient.AgentInfo{Name: name}}
+		s.agents[name] = a
+	}
+	return a
+}
+
+// SetReady sets whether /readyz reports the server as ready. It is ready
+// by default.
+func (s *Server) SetReady(ready bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notReady = !ready
+}
+
+// Requests returns every request received so far, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Calls returns the agent calls and streams received for the named agent,
+// oldest first.
+func (s *Server) Calls(agent string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Request
+	for _, r := range s.requests {
+		if r.Agent == agent {
+			calls = append(calls, r)
+		}
+	}
+	return calls
+}
+
+// LastCall returns the most recent call to the named agent. It fails the
+// test if there was none.
+func (s *Server) LastCall(agent string) Request {
+	s.tb.Helper()
+	calls := s.Calls(agent)
+	if len(calls) == 0 {
+		s.tb.Fatalf("mpcclienttest: agent %q was not called", agent)
+	}
+	return calls[len(calls)-1]
+}
+
+// Reset forgets the requests received so far. Agent scripts are kept.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// record decodes and stores an agent request, and returns it with the
+// addressed agent, or nil if it is not registered.
+func (s *Server) record(r *http.Request, stream bool) (Request, *Agent, error) {
+	req := Request{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Agent:    r.PathValue("name"),
+		Header:   r.Header.Clone(),
+		Stream:   stream,
+		Received: time.Now(),
+	}
+	err := decodeRequest(r, &req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	return req, s.agents[req.Agent], err
+}
+
+func (s *Server) recordOther(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Header:   r.Header.Clone(),
+		Received: time.Now(),
+	})
+}
+
+// decodeRequest reads the JSON or multipart body of r into req.
+func decodeRequest(r *http.Request, req *Request) error {
+	mt, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != "multipart/form-data" {
+		return json.NewDecoder(r.Body).Decode(&req.Body)
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch part.FormName() {
+		case "request":
+			if err := json.NewDecoder(part).Decode(&req.Body); err != nil {
+				return err
+			}
+		case "attachment":
+			req.Attachments = append(req.Attachments, part.FileName())
+			_, _ = io.Copy(io.Discard, part)
+		}
+	}
+}
+
+func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
+	req, a, err := s.record(r, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body: "+err.Error())
+		return
+	}
+	if a == nil {
+		writeError(w, http.StatusNotFound, "agent_not_found", fmt.Sprintf("agent %q not found", req.Agent))
+		return
+	}
+	reply := a.next(req.Body)
+	in := a.inject(&reply, 0)
+	if !a.wait(r, reply) {
+		return
+	}
+	if reply.Status != 0 {
+		writeError(w, reply.Status, reply.Code, reply.Message)
+		return
+	}
+	switch {
+	case in.malformed:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, proxyErrorPage)
+	case in.truncate:
+		// The connection is closed short of the promised length.
+		body, _ := json.Marshal(reply.response(req.Agent, req.Body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body[:len(body)/2])
+	default:
+		writeJSON(w, http.StatusOK, reply.response(req.Agent, req.Body))
+	}
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	req, a, err := s.record(r, true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body: "+err.Error())
+		return
+	}
+	if a == nil {
+		writeError(w, http.StatusNotFound, "agent_not_found", fmt.Sprintf("agent %q not found", req.Agent))
+		return
+	}
+	// A stream resumed after being dropped continues after the last event
+	// the client received; any other stream takes the agent's next reply.
+	id := r.Header.Get("X-Request-ID")
+	after, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	s.mu.Lock()
+	reply, resumed := s.dropped[id]
+	delete(s.dropped, id)
+	s.mu.Unlock()
+	in := injection{cutAt: -1, malformedAt: -1}
+	if !resumed {
+		reply, after = a.next(req.Body), 0
+		in = a.inject(&reply, max(len(reply.Chunks), 1))
+		if !a.wait(r, reply) {
+			return
+		}
+	}
+	if reply.Status != 0 {
+		writeError(w, reply.Status, reply.Code, reply.Message)
+		return
+	}
+	chunks := reply.Chunks
+	if chunks == nil {
+		chunks = []string{reply.response(req.Agent, req.Body).Result}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for i, text := range chunks {
+		if i < after {
+			continue
+		}
+		if i > after && !a.wait(r, Reply{}) {
+			return
+		}
+		if !resumed && (reply.DropAfter > 0 && i == reply.DropAfter || i == in.cutAt) {
+			s.mu.Lock()
+			s.dropped[id] = reply
+			s.mu.Unlock()
+			return
+		}
+		if i == in.malformedAt {
+			fmt.Fprintf(w, "id: %d\nevent: chunk\ndata: {\"text\": %q\n\n", i+1, text)
+			return
+		}
+		writeEvent(w, i+1, "chunk", map[string]string{"text": text})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if reply.StreamError != "" {
+		writeEvent(w, len(chunks)+1, "error", map[string]string{"error": reply.StreamError})
+		return
+	}
+	writeEvent(w, len(chunks)+1, "done", map[string]string{"finish_reason": "stop"})
+}
+
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	s.recordOther(r)
+	s.mu.Lock()
+	agents := make([]mpcclient.AgentInfo, 0, len(s.agents))
+	for _, a := range s.agents {
+		agents = append(agents, a.describe())
+	}
+	s.mu.Unlock()
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"agents": agents, "count": len(agents)})
+}
+
+func (s *Server) handleDescribeAgent(w http.ResponseWriter, r *http.Request) {
+	s.recordOther(r)
+	name := r.PathValue("name")
+	s.mu.Lock()
+	a := s.agents[name]
+	s.mu.Unlock()
+	if a == nil {
+		writeError(w, http.StatusNotFound, "agent_not_found", fmt.Sprintf("agent %q not found", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, a.describe())
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.recordOther(r)
+	s.mu.Lock()
+	n := len(s.agents)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, mpcclient.HealthStatus{Status: "healthy", Agents: n})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	s.recordOther(r)
+	s.mu.Lock()
+	status, code := "ready", http.StatusOK
+	if s.notReady {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	agents := make(map[string]mpcclient.AgentAvailability, len(s.agents))
+	for name := range s.agents {
+		agents[name] = mpcclient.AgentAvailability{Status: "available"}
+	}
+	s.mu.Unlock()
+	writeJSON(w, code, mpcclient.ReadyStatus{Status: status, Agents: agents})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, mpcclient.AgentError{Message: message, Code: code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeEvent(w io.Writer, id int, typ string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, typ, data)
+}
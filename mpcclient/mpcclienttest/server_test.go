@@ -0,0 +1,209 @@
+package mpcclienttest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient/mpcclienttest"
+)
+
+func TestScriptedReplies(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("vm").
+		Reply("first").
+		Fail(http.StatusServiceUnavailable, "down").
+		Reply("last")
+	c := srv.Client()
+	ctx := context.Background()
+
+	resp, err := c.CallAgent(ctx, "vm", "hello")
+	if err != nil || resp.Result != "first" {
+		t.Fatalf("first call = %+v, %v", resp, err)
+	}
+	_, err = c.CallAgent(ctx, "vm", "hello")
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "down" {
+		t.Fatalf("second call err = %v", err)
+	}
+	for range 2 {
+		if resp, err := c.CallAgent(ctx, "vm", "hello"); err != nil || resp.Result != "last" {
+			t.Fatalf("later call = %+v, %v", resp, err)
+		}
+	}
+
+	if calls := srv.Calls("vm"); len(calls) != 4 {
+		t.Errorf("got %d calls, want 4", len(calls))
+	}
+	if last := srv.LastCall("vm"); last.Body.Prompt != "hello" || last.Path != "/agent/vm" {
+		t.Errorf("last call = %+v", last)
+	}
+}
+
+func TestUnknownAgentAndEcho(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("echo")
+	c := srv.Client()
+
+	resp, err := c.Invoke(context.Background(), "echo", mpcclient.AgentRequest{Prompt: "ping", Context: map[string]any{"vm": "web01"}})
+	if err != nil || resp.Result != "ping" {
+		t.Fatalf("echo = %+v, %v", resp, err)
+	}
+	if got := srv.LastCall("echo").Body.Context["vm"]; got != "web01" {
+		t.Errorf("captured context vm = %v", got)
+	}
+
+	_, err = c.CallAgent(context.Background(), "missing", "ping")
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "agent_not_found" {
+		t.Errorf("err = %v, want agent_not_found", err)
+	}
+}
+
+func TestHandleAndLatency(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("upper").
+		Latency(50 * time.Millisecond).
+		Handle(func(req mpcclient.AgentRequest) mpcclienttest.Reply {
+			return mpcclienttest.Reply{Text: strings.ToUpper(req.Prompt)}
+		})
+	c := srv.Client()
+
+	start := time.Now()
+	resp, err := c.CallAgent(context.Background(), "upper", "abc")
+	if err != nil || resp.Result != "ABC" {
+		t.Fatalf("call = %+v, %v", resp, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("call took %v, want at least the agent latency", d)
+	}
+
+	_, err = c.CallAgent(context.Background(), "upper", "abc", mpcclient.WithRequestTimeout(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("writer").
+		Stream("Hel", "lo").
+		Script(mpcclienttest.Reply{Chunks: []string{"par"}, StreamError: "boom"})
+	c := srv.Client()
+
+	var text strings.Builder
+	err := c.StreamAgent(context.Background(), "writer", "go", func(ch mpcclient.Chunk) error {
+		text.WriteString(ch.Text)
+		return nil
+	})
+	if err != nil || text.String() != "Hello" {
+		t.Fatalf("stream = %q, %v", text.String(), err)
+	}
+
+	var se *mpcclient.StreamError
+	err = c.StreamAgent(context.Background(), "writer", "go", func(mpcclient.Chunk) error { return nil })
+	if !errors.As(err, &se) || se.Message != "boom" {
+		t.Errorf("err = %v, want stream error", err)
+	}
+	if !srv.LastCall("writer").Stream {
+		t.Error("last call not recorded as a stream")
+	}
+}
+
+func TestDiscoveryAndHealth(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("b").Describe(mpcclient.AgentInfo{Description: "second"})
+	srv.Agent("a")
+	c := srv.Client()
+	ctx := context.Background()
+
+	agents, err := c.ListAgents(ctx)
+	if err != nil || len(agents) != 2 || agents[0].Name != "a" || agents[1].Description != "second" {
+		t.Fatalf("ListAgents = %+v, %v", agents, err)
+	}
+	if h, err := c.Health(ctx); err != nil || !h.Healthy() {
+		t.Errorf("Health = %+v, %v", h, err)
+	}
+	srv.SetReady(false)
+	if _, err := c.Ready(ctx); !errors.Is(err, mpcclient.ErrNotReady) {
+		t.Errorf("Ready err = %v, want ErrNotReady", err)
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("recorded %d requests, want 3", n)
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	srv.Agent("writer").Script(mpcclienttest.Reply{Chunks: []string{"a", "b", "c", "d"}, DropAfter: 2})
+	c := srv.Client()
+
+	var text strings.Builder
+	err := c.StreamAgent(context.Background(), "writer", "go", func(ch mpcclient.Chunk) error {
+		text.WriteString(ch.Text)
+		return nil
+	})
+	if err != nil || text.String() != "abcd" {
+		t.Fatalf("stream = %q, %v", text.String(), err)
+	}
+	calls := srv.Calls("writer")
+	if len(calls) != 2 || calls[1].Header.Get("Last-Event-ID") != "2" {
+		t.Errorf("calls = %+v", calls)
+	}
+}
+
+func TestChaos(t *testing.T) {
+	srv := mpcclienttest.NewServer(t)
+	ctx := context.Background()
+	p := mpcclient.DefaultRetryPolicy()
+	p.BaseDelay, p.MaxAttempts = time.Millisecond, 10
+	c := srv.Client(mpcclient.WithRetryPolicy(p))
+
+	// Retries see the call through the injected failures.
+	flaky := srv.Agent("flaky").Chaos(mpcclienttest.Chaos{ErrorRate: 0.5, Seed: 1})
+	for range 5 {
+		if resp, err := c.CallAgent(ctx, "flaky", "hi"); err != nil || resp.Result != "hi" {
+			t.Fatalf("call = %+v, %v", resp, err)
+		}
+	}
+	if f, n := flaky.Faults(), len(srv.Calls("flaky")); f.Errors == 0 || f.Errors != n-5 {
+		t.Errorf("%d injected errors over %d calls", f.Errors, n)
+	}
+
+	once := srv.Client(mpcclient.WithRetryPolicy(mpcclient.RetryPolicy{MaxAttempts: 1}))
+	srv.Agent("down").Chaos(mpcclienttest.Chaos{ErrorRate: 1, ErrorStatus: http.StatusBadGateway})
+	if _, err := once.CallAgent(ctx, "down", "hi"); !errors.Is(err, mpcclient.ErrServerOverloaded) {
+		t.Errorf("injected 502: err = %v", err)
+	}
+	srv.Agent("slow").Chaos(mpcclienttest.Chaos{SlowRate: 1, SlowDelay: time.Second})
+	if _, err := once.CallAgent(ctx, "slow", "hi", mpcclient.WithRequestTimeout(20*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow reply: err = %v, want deadline exceeded", err)
+	}
+	srv.Agent("garbled").Chaos(mpcclienttest.Chaos{MalformedRate: 1})
+	if _, err := once.CallAgent(ctx, "garbled", "hi"); err == nil || !strings.Contains(err.Error(), "decode response") {
+		t.Errorf("malformed reply: err = %v", err)
+	}
+	srv.Agent("cut").Chaos(mpcclienttest.Chaos{TruncateRate: 1})
+	if _, err := once.CallAgent(ctx, "cut", "hi"); err == nil {
+		t.Error("truncated reply decoded")
+	}
+
+	// Truncated streams resume; malformed ones fail.
+	srv.Agent("cut").Stream("a", "b", "c")
+	var text strings.Builder
+	err := c.StreamAgent(ctx, "cut", "go", func(ch mpcclient.Chunk) error {
+		text.WriteString(ch.Text)
+		return nil
+	})
+	if err != nil || text.String() != "abc" {
+		t.Errorf("truncated stream = %q, %v", text.String(), err)
+	}
+	srv.Agent("garbled").Stream("a", "b")
+	if err := c.StreamAgent(ctx, "garbled", "go", func(mpcclient.Chunk) error { return nil }); err == nil {
+		t.Error("malformed stream succeeded")
+	}
+}
@@ -0,0 +1,260 @@
+package mpcclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ErrNoFixture is returned in offline mode for a call no fixture answers.
+var ErrNoFixture = errors.New("no offline fixture")
+
+// DefaultFixtureSimilarity is the least word overlap, as a Jaccard index,
+// at which a fixture for a different prompt answers a call.
+const DefaultFixtureSimilarity = 0.5
+
+// defaultFixture is the file answering calls to an agent that no other
+// fixture of it matches.
+const defaultFixture = "default.json"
+
+// OfflineMode selects when canned responses are served.
+type OfflineMode int
+
+const (
+	// OfflineAlways answers every call from the fixtures, never contacting
+	// the server.
+	OfflineAlways OfflineMode = iota
+	// OfflineFallback sends calls to the server and answers from the
+	// fixtures those failing as Retryable errors do, such as when the
+	// network or the model backend is down. Such calls are answered at
+	// once, without waiting for their retries.
+	OfflineFallback
+)
+
+// OfflineConfig configures WithOffline.
+type OfflineConfig struct {
+	// Dir holds the fixtures, one directory per agent, each fixture a
+	// file named by FixtureKey of its prompt, as SaveFixture writes them.
+	// An agent's default.json answers calls no other fixture matches.
+	Dir  string
+	Mode OfflineMode
+	// MinSimilarity is the least word overlap at which a fixture for a
+	// different prompt is used. It defaults to DefaultFixtureSimilarity;
+	// one or more turns fuzzy matching off.
+	MinSimilarity float64
+}
+
+// Fixture is a canned response to a prompt.
+type Fixture struct {
+	Agent    string        `json:"agent"`
+	Prompt   string        `json:"prompt"`
+	Response AgentResponse `json:"response"`
+}
+
+// WithOffline serves canned responses from a fixtures directory, so that
+// workshops and demos carry on when the network or the model backend is
+// down. Calls to an agent are answered by the fixture for their prompt,
+// failing that by the one whose prompt shares the most words with theirs,
+// and failing that by the agent's default fixture. Every canned response
+// is logged at slog.LevelWarn, to the client's logger or else the default
+// one, and has Canned set. Only agent calls are answered; discovery,
+// health and streaming requests go to the server.
+func WithOffline(cfg OfflineConfig) Option {
+	return func(c *Client) {
+		c.offline = &cfg
+	}
+}
+
+// FixtureKey returns the name, without extension, of the fixture file for
+// prompt: a hash of the prompt with case and spacing normalized.
+func FixtureKey(prompt string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(strings.ToLower(prompt)), " ")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SaveFixture writes resp as the fixture answering prompt on the named
+// agent under dir.
+func SaveFixture(dir, agentName, prompt string, resp *AgentResponse) error {
+	if !fixtureAgent(agentName) {
+		return fmt.Errorf("mpcclient: save fixture: invalid agent name %q", agentName)
+	}
+	b, err := json.MarshalIndent(Fixture{Agent: agentName, Prompt: prompt, Response: *resp}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("mpcclient: save fixture: %w", err)
+	}
+	path := filepath.Join(dir, agentName, FixtureKey(prompt)+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("mpcclient: save fixture: %w", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("mpcclient: save fixture: %w", err)
+	}
+	return nil
+}
+
+// offline is the transport installed by WithOffline.
+type offline struct {
+	next   Transport
+	cfg    OfflineConfig
+	logger *slog.Logger
+}
+
+func newOffline(next Transport, cfg OfflineConfig, logger *slog.Logger) (*offline, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("mpcclient: offline fixtures directory is required")
+	}
+	if fi, err := os.Stat(cfg.Dir); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("mpcclient: offline fixtures directory %s is missing", cfg.Dir)
+	}
+	if cfg.MinSimilarity <= 0 {
+		cfg.MinSimilarity = DefaultFixtureSimilarity
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.Mode == OfflineAlways {
+		logger.Warn("mpcclient offline mode: every agent response is canned, from fixtures", "dir", cfg.Dir)
+	}
+	return &offline{next: next, cfg: cfg, logger: logger}, nil
+}
+
+func (o *offline) RoundTrip(ctx context.Context, call *Call) (*AgentResponse, error) {
+	if o.cfg.Mode == OfflineFallback {
+		resp, err := o.next.RoundTrip(ctx, call)
+		if err == nil || !Retryable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+		canned, ferr := o.serve(ctx, call, err)
+		if ferr != nil {
+			return nil, err
+		}
+		return canned, nil
+	}
+	closeAttachments(call.Request.Attachments)
+	return o.serve(ctx, call, nil)
+}
+
+// serve answers call from the fixtures, logging why.
+func (o *offline) serve(ctx context.Context, call *Call, cause error) (*AgentResponse, error) {
+	f, path, err := o.lookup(call.Agent, call.Request.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	attrs := []any{"agent", call.Agent, "fixture", path}
+	if cause != nil {
+		attrs = append(attrs, "cause", cause.Error())
+	}
+	o.logger.WarnContext(ctx, "mpcclient: serving canned offline response", attrs...)
+	resp := f.Response
+	if resp.Agent == "" {
+		resp.Agent = call.Agent
+	}
+	resp.Canned = true
+	return &resp, nil
+}
+
+// lookup finds the fixture answering prompt: an exact match, the closest
+// fuzzy match, or the agent's default.
+func (o *offline) lookup(agentName, prompt string) (*Fixture, string, error) {
+	if !fixtureAgent(agentName) {
+		return nil, "", fmt.Errorf("%w for agent %q", ErrNoFixture, agentName)
+	}
+	dir := filepath.Join(o.cfg.Dir, agentName)
+	exact := filepath.Join(dir, FixtureKey(prompt)+".json")
+	if f, err := loadFixture(exact); err == nil {
+		return f, exact, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+
+	if o.cfg.MinSimilarity < 1 {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		want := promptWords(prompt)
+		var best *Fixture
+		var bestPath string
+		bestScore := o.cfg.MinSimilarity
+		for _, p := range paths {
+			if filepath.Base(p) == defaultFixture {
+				continue
+			}
+			f, err := loadFixture(p)
+			if err != nil {
+				return nil, "", err
+			}
+			if score := jaccard(want, promptWords(f.Prompt)); score > bestScore || (best == nil && score == bestScore) {
+				best, bestPath, bestScore = f, p, score
+			}
+		}
+		if best != nil {
+			return best, bestPath, nil
+		}
+	}
+
+	def := filepath.Join(dir, defaultFixture)
+	if f, err := loadFixture(def); err == nil {
+		return f, def, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+	return nil, "", fmt.Errorf("%w for agent %q", ErrNoFixture, agentName)
+}
+
+// Close closes the wrapped transport.
+func (o *offline) Close() error {
+	if closer, ok := o.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// fixtureAgent reports whether agentName can name a fixtures directory.
+func fixtureAgent(agentName string) bool {
+	return agentName != "" && agentName != "." && agentName != ".." && !strings.ContainsAny(agentName, `/\`)
+}
+
+func loadFixture(path string) (*Fixture, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: load fixture: %w", err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("mpcclient: load fixture %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// promptWords returns the set of lowercased words in s.
+func promptWords(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+// jaccard returns the size of the intersection of a and b over that of
+// their union.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,124 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/config"
+)
+
+func writeFixtures(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range []Fixture{
+		{Agent: "vm", Prompt: "What is the CPU usage of web01?", Response: AgentResponse{Result: "web01 CPU is at 42%."}},
+		{Agent: "vm", Prompt: "List the disks of db01", Response: AgentResponse{Result: "db01 has two disks."}},
+	} {
+		if err := SaveFixture(dir, f.Agent, f.Prompt, &f.Response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	def := []byte(`{"agent":"vm","response":{"result":"The metrics service is offline."}}`)
+	if err := os.WriteFile(filepath.Join(dir, "vm", defaultFixture), def, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOffline(t *testing.T) {
+	dir := writeFixtures(t)
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	// Nothing listens here; offline calls must not try.
+	c, err := NewClient("http://127.0.0.1:1", WithOffline(OfflineConfig{Dir: dir}), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "canned") {
+		t.Errorf("offline mode not announced: %s", logs.String())
+	}
+	ctx := context.Background()
+	for prompt, want := range map[string]string{
+		"what is the cpu usage  of web01?":   "web01 CPU is at 42%.",
+		"what is the CPU usage of web01 now": "web01 CPU is at 42%.",
+		"list disks db01":                    "db01 has two disks.",
+		"who won the match yesterday?":       "The metrics service is offline.",
+	} {
+		resp, err := c.CallAgent(ctx, "vm", prompt)
+		if err != nil {
+			t.Fatalf("%q: %v", prompt, err)
+		}
+		if resp.Result != want || !resp.Canned || resp.Agent != "vm" {
+			t.Errorf("%q: response %+v, want canned %q", prompt, resp, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "serving canned offline response") || !strings.Contains(logs.String(), "fixture=") {
+		t.Errorf("canned responses not logged: %s", logs.String())
+	}
+	if _, err := c.CallAgent(ctx, "other", "hi"); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("agent without fixtures: err = %v, want ErrNoFixture", err)
+	}
+
+	exact, err := NewClient("http://127.0.0.1:1", WithOffline(OfflineConfig{Dir: dir, MinSimilarity: 1}), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := exact.CallAgent(ctx, "vm", "what is the CPU usage of web01 now"); err != nil || resp.Result != "The metrics service is offline." {
+		t.Errorf("without fuzzy matching: %+v, %v", resp, err)
+	}
+
+	if _, err := NewClient("http://127.0.0.1:1", WithOffline(OfflineConfig{Dir: filepath.Join(dir, "missing")})); err == nil {
+		t.Error("missing fixtures directory accepted")
+	}
+}
+
+func TestOfflineFallback(t *testing.T) {
+	dir := writeFixtures(t)
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if strings.Contains(r.URL.Path, "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"agent":"vm","result":"live"}`))
+	}))
+	defer srv.Close()
+	cfg := config.Default()
+	cfg.Server = srv.URL
+	cfg.Offline = config.Offline{Dir: dir, Mode: config.OfflineFallback}
+	c, err := NewClientFromConfig(cfg, WithLogger(slog.New(slog.DiscardHandler)), WithCache(CacheConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if resp, err := c.CallAgent(ctx, "vm", "What is the CPU usage of web01?"); err != nil || resp.Result != "live" || resp.Canned {
+		t.Errorf("server up: %+v, %v", resp, err)
+	}
+	down.Store(true)
+	if resp, err := c.CallAgent(ctx, "vm", "CPU usage of web01 please"); err != nil || resp.Result != "web01 CPU is at 42%." || !resp.Canned {
+		t.Errorf("server down: %+v, %v", resp, err)
+	}
+	down.Store(false)
+	// Canned responses are not cached.
+	if resp, err := c.CallAgent(ctx, "vm", "CPU usage of web01 please"); err != nil || resp.Canned {
+		t.Errorf("server back up: %+v, %v", resp, err)
+	}
+	// Errors offline mode cannot help with are returned as they are.
+	if _, err := c.CallAgent(ctx, "bad", "hi"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("bad request: err = %v", err)
+	}
+}
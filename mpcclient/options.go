@@ -0,0 +1,207 @@
+package mpcclient
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. By default the
+// client creates one of its own, with a connection pool tuned by WithPool
+// and TLS and proxy settings from WithTLS and WithProxy.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// WithHeader adds a header sent with every request.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.headers.Add(key, value)
+	}
+}
+
+// WithTimeout sets a default deadline applied to every call that is not
+// given its own with WithRequestTimeout. Zero, the default, means calls are
+// bounded only by the caller's context. It sets the Total of the client's
+// Budget.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.budget.Total = d
+	}
+}
+
+// WithDefaultAgent sets the agent Invoke, CallAgent and StreamAgent call
+// when given an empty agent name.
+func WithDefaultAgent(name string) Option {
+	return func(c *Client) {
+		c.defaultAgent = name
+	}
+}
+
+// WithTenant sends every request to the tenant id of a server hosting
+// several, under /tenant/{id}/, so that only that tenant's agents are
+// called, with its API keys and quotas. It cannot be combined with
+// WithGRPCTransport.
+func WithTenant(id string) Option {
+	return func(c *Client) {
+		c.tenant = id
+	}
+}
+
+// WithStreamReconnects sets how many times in a row StreamAgent
+// re-establishes or resumes a stream whose connection fails. Zero disables
+// reconnects.
+func WithStreamReconnects(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.streamReconnects = n
+		}
+	}
+}
+
+// WithStrictDecoding makes the client reject responses containing fields
+// the typed models do not know about. It is useful for catching contract
+// drift between client and server in tests.
+func WithStrictDecoding() Option {
+	return func(c *Client) {
+		c.strictDecoding = true
+	}
+}
+
+// WithRetryPolicy enables retries of failed calls. Streams retry only the
+// initial connection; see WithStreamReconnects for mid-stream failures.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithAuthenticator sets how the client authenticates its requests.
+func WithAuthenticator(a Authenticator) Option {
+	return func(c *Client) {
+		c.auth = a
+	}
+}
+
+// WithAPIKey authenticates requests with a static key sent in the
+// DefaultAPIKeyHeader header.
+func WithAPIKey(key string) Option {
+	return WithAuthenticator(APIKey{Key: key})
+}
+
+// WithBearerToken authenticates requests with a static bearer token.
+func WithBearerToken(token string) Option {
+	return WithAuthenticator(BearerToken(token))
+}
+
+// WithLogger records agent calls and HTTP exchanges on l. Credentials are
+// always redacted; see LogConfig for levels and prompt logging.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithLogConfig sets what a client configured with WithLogger records.
+func WithLogConfig(cfg LogConfig) Option {
+	return func(c *Client) {
+		c.logCfg = cfg
+	}
+}
+
+// CallOption configures a single call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	budget        Budget
+	onStatus      func(string)
+	bypassCache   bool
+	coalesce      bool
+	schema        *Schema
+	schemaRepairs int
+	params        map[string]any
+	format        Format
+	priority      Priority
+	board         string
+	generation    Generation
+	requires      Requirements
+	embedBatch    int
+	pageSize      int
+	// idempotencyKey is the call's Idempotency-Key.
+	idempotencyKey string
+	// callbackURL is where a submitted job is to be POSTed once finished.
+	callbackURL string
+	// metadata labels the call, over the client's defaultMetadata.
+	metadata, defaultMetadata map[string]string
+	// flush and lineBuffered set how StreamAgentTo writes.
+	flush        FlushMode
+	lineBuffered bool
+	// postProcessors replace the client's when overridePost is set.
+	postProcessors []PostProcessor
+	overridePost   bool
+	// language is the language to translate the result into, if any.
+	language string
+}
+
+// WithRequestTimeout bounds a single call, overriding the client default set
+// with WithTimeout. A deadline already on the caller's context still applies
+// if it is earlier. It sets the Total of the call's Budget.
+func WithRequestTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.budget.Total = d
+	}
+}
+
+// WithStatusHandler receives intermediate status updates, such as
+// "fetching metrics…", that agents push while handling the call. Only
+// transports that carry them, like the WebSocket transport, deliver
+// updates. fn is called from the transport's receive loop and should return
+// quickly.
+func WithStatusHandler(fn func(status string)) CallOption {
+	return func(o *callOptions) {
+		o.onStatus = fn
+	}
+}
+
+// request returns req as modified by the call's options.
+func (o callOptions) request(req AgentRequest) AgentRequest {
+	req = o.withParams(req)
+	req = o.withMetadata(req)
+	if o.format != "" {
+		req.Format = o.format
+	}
+	if o.priority != "" {
+		req.Priority = o.priority
+	}
+	if o.board != "" {
+		req.Board = o.board
+	}
+	req = o.withGeneration(req)
+	req = o.withRequirements(req)
+	return req
+}
+
+func (c *Client) callOptions(opts []CallOption) callOptions {
+	o := callOptions{budget: c.budget, schemaRepairs: DefaultSchemaRepairs, defaultMetadata: c.metadata, language: c.language}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// context derives the context a call runs under, bounded by its budget.
+func (o callOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, budgetKey{}, o.budget)
+	if o.budget.Total > 0 {
+		return context.WithTimeout(ctx, o.budget.Total)
+	}
+	return context.WithCancel(ctx)
+}
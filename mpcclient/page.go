@@ -0,0 +1,121 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PageFunc fetches the page of a listing after cursor, which is empty for
+// the first page. It returns the page's items and the cursor of the next
+// page, empty after the last one.
+type PageFunc[T any] func(ctx context.Context, cursor string) (items []T, next string, err error)
+
+// Iterator walks a paged listing item by item, fetching each page once
+// the previous one has been used up:
+//
+//	it := c.Jobs(mpcclient.WithPageSize(50))
+//	for it.Next(ctx) {
+//		fmt.Println(it.Item().ID)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+//
+// An Iterator is not safe for concurrent use.
+type Iterator[T any] struct {
+	fetch  PageFunc[T]
+	page   []T
+	item   T
+	cursor string
+	last   bool
+	err    error
+}
+
+// NewIterator returns an Iterator over the pages fetch returns, for
+// listings other than the client's own, such as a history file.
+func NewIterator[T any](fetch PageFunc[T]) *Iterator[T] {
+	return &Iterator[T]{fetch: fetch}
+}
+
+// Next advances to the next item, fetching a page with ctx if needed, and
+// reports whether there is one. It returns false at the end of the listing
+// and after an error, which Err reports.
+func (it *Iterator[T]) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.last {
+			return false
+		}
+		page, next, err := it.fetch(ctx, it.cursor)
+		switch {
+		case err != nil:
+			it.err = err
+			return false
+		case next != "" && next == it.cursor:
+			it.err = errors.New("mpcclient: listing returned the same cursor twice")
+			return false
+		}
+		it.page, it.cursor, it.last = page, next, next == ""
+	}
+	it.item, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Item returns the item Next advanced to.
+func (it *Iterator[T]) Item() T {
+	return it.item
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All returns the remaining items of the listing.
+func (it *Iterator[T]) All(ctx context.Context) ([]T, error) {
+	var all []T
+	for it.Next(ctx) {
+		all = append(all, it.Item())
+	}
+	return all, it.Err()
+}
+
+// WithPageSize sets how many items each page of a listing such as Agents
+// or Jobs holds. Servers cap it, and choose their own size without it.
+func WithPageSize(n int) CallOption {
+	return func(o *callOptions) {
+		o.pageSize = n
+	}
+}
+
+// pageFetcher returns the PageFunc of the listing at path, whose pages
+// decode into a P from which items takes the items and the next cursor.
+// what names the listing in errors.
+func pageFetcher[T, P any](c *Client, what, path string, opts []CallOption, items func(*P) ([]T, string)) PageFunc[T] {
+	return func(ctx context.Context, cursor string) ([]T, string, error) {
+		o := c.callOptions(opts)
+		ctx, cancel := o.context(ctx)
+		defer cancel()
+
+		q := url.Values{}
+		if o.pageSize > 0 {
+			q.Set("limit", strconv.Itoa(o.pageSize))
+		}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		p := path
+		if len(q) > 0 {
+			p += "?" + q.Encode()
+		}
+		var page P
+		if err := c.do(ctx, http.MethodGet, p, nil, &page); err != nil {
+			return nil, "", fmt.Errorf("mpcclient: %s: %w", what, err)
+		}
+		list, next := items(&page)
+		return list, next, nil
+	}
+}
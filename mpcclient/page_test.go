@@ -0,0 +1,63 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	pages := map[string]struct {
+		items []int
+		next  string
+	}{
+		"":  {[]int{1, 2}, "b"},
+		"b": {nil, "c"}, // empty pages are skipped
+		"c": {[]int{3}, ""},
+	}
+	var fetched []string
+	it := NewIterator(func(_ context.Context, cursor string) ([]int, string, error) {
+		fetched = append(fetched, cursor)
+		return pages[cursor].items, pages[cursor].next, nil
+	})
+	got, err := it.All(context.Background())
+	if err != nil || !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("All = %v, %v", got, err)
+	}
+	if strings.Join(fetched, ",") != ",b,c" {
+		t.Errorf("fetched %q", fetched)
+	}
+	if it.Next(context.Background()) {
+		t.Error("Next after the last page")
+	}
+}
+
+func TestIteratorStops(t *testing.T) {
+	boom := errors.New("boom")
+	calls := 0
+	it := NewIterator(func(_ context.Context, cursor string) ([]int, string, error) {
+		calls++
+		if cursor != "" {
+			return nil, "", boom
+		}
+		return []int{1}, "x", nil
+	})
+	if !it.Next(context.Background()) || it.Item() != 1 {
+		t.Fatal("first item missing")
+	}
+	if it.Next(context.Background()) || !errors.Is(it.Err(), boom) {
+		t.Errorf("err = %v", it.Err())
+	}
+	if it.Next(context.Background()) || calls != 2 {
+		t.Errorf("fetched again after an error: %d calls", calls)
+	}
+
+	loop := NewIterator(func(context.Context, string) ([]int, string, error) {
+		return []int{1}, "same", nil
+	})
+	if _, err := loop.All(context.Background()); err == nil || !strings.Contains(err.Error(), "same cursor twice") {
+		t.Errorf("repeated cursor: err = %v", err)
+	}
+}
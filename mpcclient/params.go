@@ -0,0 +1,84 @@
+package mpcclient
+
+import (
+	"maps"
+	"time"
+)
+
+// Parameter names understood by azureVmMetricsAgent and the other Azure
+// agents of the workshop.
+const (
+	ParamVMName         = "vm_name"
+	ParamResourceGroup  = "resource_group"
+	ParamSubscriptionID = "subscription_id"
+	ParamMetrics        = "metrics"
+	ParamTimespan       = "timespan"
+	ParamStart          = "start"
+	ParamEnd            = "end"
+)
+
+// WithParameter sets a parameter of the call's request, replacing any of
+// the same name in AgentRequest.Parameters. Servers check parameters
+// against the types agents declare, so agents receive them validated
+// instead of re-parsing the prompt.
+func WithParameter(name string, value any) CallOption {
+	return func(o *callOptions) {
+		if o.params == nil {
+			o.params = make(map[string]any)
+		}
+		o.params[name] = value
+	}
+}
+
+// WithVM names the virtual machine the call is about.
+func WithVM(name string) CallOption {
+	return WithParameter(ParamVMName, name)
+}
+
+// WithResourceGroup names the resource group of the resource the call is
+// about.
+func WithResourceGroup(name string) CallOption {
+	return WithParameter(ParamResourceGroup, name)
+}
+
+// WithSubscription names the Azure subscription of the resource the call
+// is about, when it is not the server's default.
+func WithSubscription(id string) CallOption {
+	return WithParameter(ParamSubscriptionID, id)
+}
+
+// WithMetrics selects the metric categories to query, such as "cpu" or
+// "disk".
+func WithMetrics(categories ...string) CallOption {
+	return WithParameter(ParamMetrics, categories)
+}
+
+// WithLookback asks about the window of length d ending now.
+func WithLookback(d time.Duration) CallOption {
+	return WithParameter(ParamTimespan, d.String())
+}
+
+// WithTimeRange asks about the window from start to end. A zero end means
+// now.
+func WithTimeRange(start, end time.Time) CallOption {
+	return func(o *callOptions) {
+		WithParameter(ParamStart, start.UTC().Format(time.RFC3339))(o)
+		if !end.IsZero() {
+			WithParameter(ParamEnd, end.UTC().Format(time.RFC3339))(o)
+		}
+	}
+}
+
+// withParams returns req with the call's parameters merged in.
+func (o callOptions) withParams(req AgentRequest) AgentRequest {
+	if o.params == nil {
+		return req
+	}
+	merged := maps.Clone(req.Parameters)
+	if merged == nil {
+		merged = make(map[string]any, len(o.params))
+	}
+	maps.Copy(merged, o.params)
+	req.Parameters = merged
+	return req
+}
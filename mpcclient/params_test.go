@@ -0,0 +1,49 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTypedParameters(t *testing.T) {
+	var got AgentRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"agent":"vm","result":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	c, _ := NewClient(srv.URL)
+
+	req := AgentRequest{Prompt: "Check CPU", Parameters: map[string]any{"vm_name": "old", "extra": true}}
+	start := time.Date(2026, 3, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))
+	_, err := c.Invoke(context.Background(), "vm", req,
+		WithVM("webserver01"), WithResourceGroup("prod-rg"), WithMetrics("cpu", "disk"),
+		WithTimeRange(start, time.Time{}), WithParameter("extra", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := got.Parameters
+	if p[ParamVMName] != "webserver01" || p[ParamResourceGroup] != "prod-rg" || p["extra"] != false {
+		t.Errorf("parameters = %v", p)
+	}
+	if m, _ := p[ParamMetrics].([]any); len(m) != 2 || m[1] != "disk" {
+		t.Errorf("metrics = %v", p[ParamMetrics])
+	}
+	if p[ParamStart] != "2026-03-01T00:00:00Z" || p[ParamEnd] != nil {
+		t.Errorf("time range = %v..%v", p[ParamStart], p[ParamEnd])
+	}
+	if req.Parameters["vm_name"] != "old" {
+		t.Error("call options modified the caller's parameters")
+	}
+
+	if _, err := c.CallAgent(context.Background(), "vm", "cpu", WithLookback(90*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Parameters[ParamTimespan] != "1h30m0s" {
+		t.Errorf("timespan = %v", got.Parameters[ParamTimespan])
+	}
+}
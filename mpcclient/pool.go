@@ -0,0 +1,101 @@
+package mpcclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Connection pool defaults, sized for many goroutines sharing one client
+// against a single server. net/http's own default of two idle connections
+// per host makes busy clients open and tear down connections constantly.
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+)
+
+// PoolConfig tunes the connection pool of the HTTP transport a client
+// creates for itself. Zero fields take the documented defaults.
+type PoolConfig struct {
+	// MaxIdleConns bounds idle connections across all hosts. It defaults to
+	// DefaultMaxIdleConns.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost bounds idle connections kept for reuse per host.
+	// It defaults to DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost bounds all connections per host, including those in
+	// use; calls beyond it wait for a connection. Zero means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept. It defaults
+	// to DefaultIdleConnTimeout.
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval of TCP keep-alive probes. It defaults to
+	// DefaultKeepAlive; a negative value disables them.
+	KeepAlive time.Duration
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+	// DisableHTTP2 keeps HTTPS connections on HTTP/1.1. HTTP/2 is
+	// negotiated by default, multiplexing concurrent calls over one
+	// connection.
+	DisableHTTP2 bool
+	// UnencryptedHTTP2 speaks HTTP/2 without TLS (h2c, with prior
+	// knowledge) to http:// servers. It turns HTTP/1.1 off, so the server
+	// must support it, and the WebSocket transport cannot be used.
+	UnencryptedHTTP2 bool
+}
+
+// WithPool tunes the connection pool of the client's HTTP transport. It
+// cannot be combined with WithHTTPClient, whose transport the caller
+// configures.
+func WithPool(cfg PoolConfig) Option {
+	return func(c *Client) {
+		c.pool = &cfg
+	}
+}
+
+func (c *Client) poolConfig() PoolConfig {
+	if c.pool == nil {
+		return PoolConfig{}
+	}
+	return *c.pool
+}
+
+// newPooledTransport returns a transport configured by cfg.
+func newPooledTransport(cfg PoolConfig) *http.Transport {
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout == 0 {
+		cfg.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = DefaultKeepAlive
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: cfg.KeepAlive}).DialContext
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = cfg.MaxConnsPerHost
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+	t.DisableKeepAlives = cfg.DisableKeepAlives
+
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP1(!cfg.UnencryptedHTTP2)
+	t.Protocols.SetHTTP2(!cfg.DisableHTTP2)
+	t.Protocols.SetUnencryptedHTTP2(cfg.UnencryptedHTTP2)
+	t.ForceAttemptHTTP2 = !cfg.DisableHTTP2
+	return t
+}
+
+// CloseIdleConnections closes connections kept idle for reuse, without
+// interrupting calls in flight. Load tests call it between phases to start
+// each from cold connections.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
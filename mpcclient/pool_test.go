@@ -0,0 +1,100 @@
+package mpcclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connCountingServer counts the connections clients open to it.
+func connCountingServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	var opened, closed atomic.Int32
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		switch s {
+		case http.StateNew:
+			opened.Add(1)
+		case http.StateClosed:
+			closed.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &opened, &closed
+}
+
+func TestSharedClientReusesConnections(t *testing.T) {
+	srv, opened, closed := connCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte(`{"agent":"vm","result":"ok","usage":{"total_tokens":1}}`))
+	})
+	c, err := NewClient(srv.URL, WithCache(CacheConfig{}), WithCircuitBreaker(BreakerConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 100
+	for round := range 2 {
+		var wg sync.WaitGroup
+		for i := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := c.CallAgent(context.Background(), "vm", "cpu", WithCacheBypass())
+				if err != nil || resp.Result != "ok" {
+					t.Errorf("round %d call %d = %+v, %v", round, i, resp, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	if n := opened.Load(); n > workers+workers/10 {
+		t.Errorf("opened %d connections for 2 rounds of %d concurrent calls; idle connections were not reused", n, workers)
+	}
+	if got := c.Usage().Total(); got != 2*workers {
+		t.Errorf("usage total = %d, want %d", got, 2*workers)
+	}
+
+	c.CloseIdleConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	for closed.Load() < opened.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if closed.Load() != opened.Load() {
+		t.Errorf("%d of %d connections closed after CloseIdleConnections", closed.Load(), opened.Load())
+	}
+}
+
+func TestPoolUnencryptedHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Write([]byte(`{"agent":"vm","result":"h2"}`))
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(srv.URL, WithPool(PoolConfig{UnencryptedHTTP2: true, MaxConnsPerHost: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.CallAgent(context.Background(), "vm", "hi"); err != nil || resp.Result != "h2" {
+		t.Errorf("call = %+v, %v", resp, err)
+	}
+}
+
+func TestPoolWithHTTPClientConflict(t *testing.T) {
+	if _, err := NewClient("", WithHTTPClient(&http.Client{}), WithPool(PoolConfig{})); err == nil {
+		t.Error("want error combining WithPool and WithHTTPClient")
+	}
+}
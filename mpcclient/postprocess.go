@@ -0,0 +1,90 @@
+package mpcclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PostProcessor rewrites or checks a successful response before the call
+// returns it. An error fails the call.
+type PostProcessor func(resp *AgentResponse) error
+
+// WithPostProcessors runs ps, in order and after any added before, on the
+// response of every Invoke, CallAgent and call built on them, once
+// fallbacks and schema repairs are done. They see a copy of the response,
+// so cached responses are left as the agent sent them. Streams are not
+// post-processed.
+func WithPostProcessors(ps ...PostProcessor) Option {
+	return func(c *Client) {
+		c.postProcessors = append(c.postProcessors, ps...)
+	}
+}
+
+// WithPostProcessing replaces the client's post-processors with ps for one
+// call. Without arguments, it turns post-processing off for the call.
+func WithPostProcessing(ps ...PostProcessor) CallOption {
+	return func(o *callOptions) {
+		o.postProcessors = slices.Clone(ps)
+		o.overridePost = true
+	}
+}
+
+// ChainPostProcessors returns a post-processor running ps in order,
+// stopping at the first error.
+func ChainPostProcessors(ps ...PostProcessor) PostProcessor {
+	return func(resp *AgentResponse) error {
+		for _, p := range ps {
+			if err := p(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// postProcess runs the call's post-processors on a copy of resp.
+func (c *Client) postProcess(resp *AgentResponse, o callOptions) (*AgentResponse, error) {
+	ps := c.postProcessors
+	if o.overridePost {
+		ps = o.postProcessors
+	}
+	if len(ps) == 0 {
+		return resp, nil
+	}
+	out := *resp
+	out.Metadata = maps.Clone(resp.Metadata)
+	out.ToolCalls = slices.Clone(resp.ToolCalls)
+	if err := ChainPostProcessors(ps...)(&out); err != nil {
+		return nil, fmt.Errorf("post-process response: %w", err)
+	}
+	return &out, nil
+}
+
+// StripJSONFence is a post-processor unwrapping a result that is JSON in
+// a Markdown code fence, as models often send it, so that Result holds the
+// bare JSON. Other results are left alone.
+func StripJSONFence(resp *AgentResponse) error {
+	text := resp.Text()
+	if body := stripFence(text); body != text && json.Valid([]byte(body)) {
+		resp.Result = body
+	}
+	return nil
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// NormalizeWhitespace is a post-processor tidying the result: line endings
+// become "\n", trailing spaces are removed from every line, runs of blank
+// lines shrink to one, and the whole is trimmed.
+func NormalizeWhitespace(resp *AgentResponse) error {
+	lines := strings.Split(strings.ReplaceAll(resp.Result, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	resp.Result = strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	return nil
+}
@@ -0,0 +1,77 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostProcessors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"agent":"a","result":"  ` + "```json\\n{\\\"cpu\\\": 42}\\n```" + `  "}`))
+	}))
+	defer srv.Close()
+	var order []string
+	mark := func(name string) PostProcessor {
+		return func(resp *AgentResponse) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	cache := NewMemoryCache(10)
+	c, _ := NewClient(srv.URL,
+		WithCache(CacheConfig{Cache: cache}),
+		WithPostProcessors(mark("first"), StripJSONFence),
+		WithPostProcessors(mark("second")),
+	)
+	ctx := context.Background()
+
+	resp, err := c.CallAgent(ctx, "a", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != `{"cpu": 42}` {
+		t.Errorf("Result = %q, want the bare JSON", resp.Result)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Errorf("ran in order %v", order)
+	}
+	if cached, _ := c.CallAgent(ctx, "a", "hi", WithPostProcessing()); !strings.Contains(cached.Result, "```") {
+		t.Errorf("cached response was rewritten: %q", cached.Result)
+	}
+
+	order = nil
+	resp, err = c.CallAgent(ctx, "a", "hi", WithPostProcessing(mark("override")))
+	if err != nil || strings.Join(order, ",") != "override" || !strings.Contains(resp.Result, "```") {
+		t.Errorf("override ran %v and gave %q, %v", order, resp.Result, err)
+	}
+
+	bad := errors.New("no code found")
+	_, err = c.CallAgent(ctx, "a", "hi", WithPostProcessing(func(*AgentResponse) error { return bad }))
+	if !errors.Is(err, bad) {
+		t.Errorf("err = %v, want the post-processor's", err)
+	}
+}
+
+func TestBuiltinPostProcessors(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+		p              PostProcessor
+	}{
+		{"fenced JSON", "```json\n[1, 2]\n```", "[1, 2]", StripJSONFence},
+		{"fenced code", "```go\nfunc main() {}\n```", "```go\nfunc main() {}\n```", StripJSONFence},
+		{"bare JSON", `{"a":1}`, `{"a":1}`, StripJSONFence},
+		{"whitespace", "  Title  \r\n\r\n\r\n\r\nbody \t\nend\n\n", "Title\n\nbody\nend", NormalizeWhitespace},
+		{"chain", "\n```json\n{}\n```   \n\n", "{}", ChainPostProcessors(NormalizeWhitespace, StripJSONFence)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &AgentResponse{Result: tc.in}
+			if err := tc.p(resp); err != nil || resp.Result != tc.want {
+				t.Errorf("Result = %q, %v; want %q", resp.Result, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package mpcclient
+
+// Priority is the scheduling class of a call: servers limiting an agent's
+// concurrency admit waiting interactive calls ahead of batch ones.
+type Priority string
+
+// Priorities understood by the workshop servers. Calls default to
+// PriorityInteractive and jobs to PriorityBatch.
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityBatch       Priority = "batch"
+)
+
+// WithPriority sets the scheduling class of the call, such as PriorityBatch
+// for bulk work that should not hold up others' interactive calls.
+func WithPriority(p Priority) CallOption {
+	return func(o *callOptions) {
+		o.priority = p
+	}
+}
@@ -0,0 +1,115 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// WithRateLimit caps the client at rps requests per second, allowing bursts
+// of up to burst requests. Requests beyond the limit wait for capacity and
+// fail only if their context ends first. Retries, stream reconnects and
+// WebSocket calls all count against the limit.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		c.throttle.limiter = rate.NewLimiter(rate.Limit(rps), max(burst, 1))
+	}
+}
+
+// throttle paces outgoing requests. Besides the optional rate limit it
+// holds back every request while the server has asked clients to slow down
+// with a 429 and Retry-After, and the calls to an agent while the server
+// reports that agent busy.
+type throttle struct {
+	limiter *rate.Limiter
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+	// busyUntil holds back the calls to agents that answered agent_busy,
+	// by agent.
+	busyUntil map[string]time.Time
+}
+
+// throttleInterceptor holds requests back until the throttle allows them
+// and pauses the client, or the agent called, when the server answers 429
+// with Retry-After.
+func (c *Client) throttleInterceptor(next Handler) Handler {
+	return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		agent := agentOf(req)
+		if err := c.throttle.wait(req.Context(), agent); err != nil {
+			return nil, err
+		}
+		res, err := next.Do(req)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			c.throttle.observe(agent, apiErr)
+		}
+		return res, err
+	})
+}
+
+// agentOf returns the name of the agent req calls, if it calls one.
+func agentOf(req *http.Request) string {
+	_, rest, ok := strings.Cut(req.URL.Path, "/agent/")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return name
+}
+
+// wait blocks until a request to agent may be sent or ctx is done.
+func (t *throttle) wait(ctx context.Context, agent string) error {
+	t.mu.Lock()
+	until := t.pausedUntil
+	if busy := t.busyUntil[agent]; busy.After(until) {
+		until = busy
+	}
+	t.mu.Unlock()
+	if d := time.Until(until); d > 0 {
+		if err := sleepCtx(ctx, d); err != nil {
+			return err
+		}
+	}
+	if t.limiter != nil {
+		return t.limiter.Wait(ctx)
+	}
+	return nil
+}
+
+// observe pauses the client when err, answering a call to agent, tells it
+// to back off. An agent_busy answer speaks for its agent only, whose
+// concurrency limit the server admits calls under, and pauses just the
+// calls to it. A quota_exceeded answer, whose Retry-After is the next
+// UTC midnight, speaks for the API key's daily tokens and pauses nothing.
+func (t *throttle) observe(agent string, err *APIError) {
+	if err.StatusCode != http.StatusTooManyRequests || err.RetryAfter <= 0 || errors.Is(err, ErrQuotaExceeded) {
+		return
+	}
+	now := time.Now()
+	until := now.Add(err.RetryAfter)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err.Code == "agent_busy" && agent != "" {
+		for name, u := range t.busyUntil {
+			if !u.After(now) {
+				delete(t.busyUntil, name)
+			}
+		}
+		if t.busyUntil == nil {
+			t.busyUntil = make(map[string]time.Time)
+		}
+		if until.After(t.busyUntil[agent]) {
+			t.busyUntil[agent] = until
+		}
+		return
+	}
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
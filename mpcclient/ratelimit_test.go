@@ -0,0 +1,146 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func okServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRateLimit(t *testing.T) {
+	c, _ := NewClient(okServer(t).URL, WithRateLimit(50, 1))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// The first request uses the burst; the other five wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("6 requests at 50 rps took %v", elapsed)
+	}
+}
+
+func TestRateLimitRespectsContext(t *testing.T) {
+	c, _ := NewClient(okServer(t).URL, WithRateLimit(0.1, 1))
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallAgent(ctx, "a", "hi"); err == nil {
+		t.Fatal("expected the throttled call to fail with its context")
+	}
+}
+
+func TestTooManyRequestsPausesClient(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	_, err := c.CallAgent(context.Background(), "a", "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != time.Second {
+		t.Fatalf("err = %v, want 429 with Retry-After", err)
+	}
+
+	// Without any retry policy, the next call still waits out Retry-After.
+	start := time.Now()
+	if _, err := c.CallAgent(context.Background(), "b", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("call after 429 was sent after %v, want ~1s", elapsed)
+	}
+}
+
+func TestDefaultRetryPolicyRetriesTooManyRequests(t *testing.T) {
+	if !DefaultRetryPolicy().retryable(context.Background(), &APIError{StatusCode: http.StatusTooManyRequests}) {
+		t.Error("429 is not retryable by default")
+	}
+}
+
+func TestAgentBusyPausesOnlyThatAgent(t *testing.T) {
+	var busy atomic.Bool
+	busy.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/agent/a" && busy.Swap(false) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"agent \"a\" is busy","code":"agent_busy"}`))
+			return
+		}
+		w.Write([]byte(`{"result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("err = %v, want agent_busy 429", err)
+	}
+	start := time.Now()
+	if _, err := c.CallAgent(context.Background(), "b", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("call to another agent was held back %v", elapsed)
+	}
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("call to the busy agent was sent after %v, want ~1s", elapsed)
+	}
+}
+
+func TestQuotaExceededDoesNotPauseClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/agent/a" {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"API key \"ci\" has used its 5 tokens for today","code":"quota_exceeded"}`))
+			return
+		}
+		w.Write([]byte(`{"result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for range 2 {
+		if _, err := c.CallAgent(ctx, "a", "hi"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("err = %v, want ErrQuotaExceeded", err)
+		}
+	}
+	if _, err := c.CallAgent(ctx, "b", "hi"); err != nil {
+		t.Fatalf("call after an exceeded quota: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package mpcclient
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactionRule replaces every match of a pattern in text.
+type RedactionRule struct {
+	// Name identifies the rule in tests and configuration.
+	Name    string
+	Pattern *regexp.Regexp
+	// Replacement is substituted for each match, with $1-style references
+	// expanded as by regexp.Regexp.ReplaceAllString. It defaults to
+	// Redacted. Rules must give the same result when applied twice, so the
+	// replacement must not itself match a different way.
+	Replacement string
+}
+
+// KeywordRule returns a rule redacting the values assigned to any of
+// keywords, matched case-insensitively, in forms such as "password=hunter2",
+// "api_key: abc" and `"token": "abc"`. The keyword itself is kept.
+func KeywordRule(name string, keywords ...string) RedactionRule {
+	quoted := make([]string, len(keywords))
+	for i, k := range keywords {
+		quoted[i] = regexp.QuoteMeta(k)
+	}
+	return RedactionRule{
+		Name:        name,
+		Pattern:     regexp.MustCompile(`(?i)((?:` + strings.Join(quoted, "|") + `)["']?\s*[:=]\s*["']?)[^\s"',;&]+`),
+		Replacement: "${1}" + Redacted,
+	}
+}
+
+// DefaultRedactionRules returns rules for common credential formats: PEM
+// private keys, AWS access key IDs, GitHub tokens, JWTs, bearer tokens,
+// Azure storage account keys and values assigned to password, secret,
+// token and API key fields.
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+		{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]|github_pat)_[A-Za-z0-9_]{30,}`)},
+		{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+		{Name: "bearer", Pattern: regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{8,}`), Replacement: "${1}" + Redacted},
+		{Name: "azure_account_key", Pattern: regexp.MustCompile(`(?i)(AccountKey=)[A-Za-z0-9+/=]{20,}`), Replacement: "${1}" + Redacted},
+		KeywordRule("credential_field", "password", "passwd", "client_secret", "secret", "api_key", "apikey", "access_key", "token"),
+	}
+}
+
+// Redactor scrubs secrets from text by applying its rules in order. A nil
+// *Redactor leaves text unchanged. It is safe for concurrent use.
+type Redactor struct {
+	rules []RedactionRule
+}
+
+// NewRedactor returns a Redactor applying rules in order.
+func NewRedactor(rules ...RedactionRule) *Redactor {
+	r := &Redactor{rules: make([]RedactionRule, len(rules))}
+	for i, rule := range rules {
+		if rule.Replacement == "" {
+			rule.Replacement = Redacted
+		}
+		r.rules[i] = rule
+	}
+	return r
+}
+
+// Redact returns s with every rule applied.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
+
+// RedactInteraction scrubs the request and response of a recorded call. It
+// can serve as CassetteConfig.Redact.
+func (r *Redactor) RedactInteraction(it *Interaction) {
+	it.Request = r.redactRequest(it.Request)
+	if it.Response != nil {
+		it.Response.Prompt = r.Redact(it.Response.Prompt)
+		it.Response.Result = r.Redact(it.Response.Result)
+	}
+	if it.Error != nil {
+		it.Error.Message = r.Redact(it.Error.Message)
+	}
+}
+
+// redactRequest returns req with its prompt, messages and string values in
+// context and parameters scrubbed.
+func (r *Redactor) redactRequest(req AgentRequest) AgentRequest {
+	if r == nil {
+		return req
+	}
+	req.Prompt = r.Redact(req.Prompt)
+	if req.Messages != nil {
+		msgs := make([]Message, len(req.Messages))
+		for i, m := range req.Messages {
+			msgs[i] = Message{Role: m.Role, Content: r.Redact(m.Content)}
+		}
+		req.Messages = msgs
+	}
+	req.Context = r.redactMap(req.Context)
+	req.Parameters = r.redactMap(req.Parameters)
+	return req
+}
+
+func (r *Redactor) redactMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = r.redactValue(v)
+	}
+	return out
+}
+
+func (r *Redactor) redactValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.Redact(v)
+	case map[string]any:
+		return r.redactMap(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = r.redactValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// RedactionConfig configures WithRedaction.
+type RedactionConfig struct {
+	// Redactor holds the rules. It defaults to a Redactor applying
+	// DefaultRedactionRules.
+	Redactor *Redactor
+	// Outgoing also scrubs requests before they are sent: prompts,
+	// conversation messages and string values in context and parameters.
+	// It is off by default, since agents then see placeholders instead of
+	// the values.
+	Outgoing bool
+}
+
+// WithRedaction scrubs secrets from the prompts and errors the client logs,
+// from the calls cassettes record and from the prompts passed to call
+// hooks, and optionally from requests sent to agents. A cassette's own Redact function runs after the redactor.
+func WithRedaction(cfg RedactionConfig) Option {
+	return func(c *Client) {
+		if cfg.Redactor == nil {
+			cfg.Redactor = NewRedactor(DefaultRedactionRules()...)
+		}
+		c.redaction = &cfg
+	}
+}
+
+// redactor returns the client's redactor, or nil.
+func (c *Client) redactor() *Redactor {
+	if c.redaction == nil {
+		return nil
+	}
+	return c.redaction.Redactor
+}
+
+// redactOutgoing returns req as it may be sent.
+func (c *Client) redactOutgoing(req AgentRequest) AgentRequest {
+	if c.redaction == nil || !c.redaction.Outgoing {
+		return req
+	}
+	return c.redaction.Redactor.redactRequest(req)
+}
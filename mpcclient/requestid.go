@@ -0,0 +1,51 @@
+package mpcclient
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// requestIDHeader carries the ID correlating a call across client and
+// server logs.
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose calls carry id as their request ID,
+// sent in the X-Request-ID header or its gRPC and WebSocket equivalents.
+// Agents calling further agents pass on the ID they were invoked with, so
+// the whole chain can be followed in the logs:
+//
+//	ctx = mpcclient.WithRequestID(ctx, req.RequestID)
+//
+// Without one, each call is given a random UUID, shared by its retries and
+// fallbacks.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID ctx carries, or "" if it
+// carries none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ensureRequestID returns ctx carrying a request ID, generating one if it
+// has none.
+func ensureRequestID(ctx context.Context) context.Context {
+	if RequestIDFromContext(ctx) != "" {
+		return ctx
+	}
+	return WithRequestID(ctx, newRequestID())
+}
+
+// newRequestID returns a random RFC 4122 version 4 UUID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,76 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDGenerated(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get("X-Request-ID"))
+		n := len(ids)
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	p := DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	c, _ := NewClient(srv.URL, WithRetryPolicy(p))
+	resp, err := c.CallAgent(context.Background(), "a", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || !uuidPattern.MatchString(ids[0]) || ids[1] != ids[0] {
+		t.Fatalf("request IDs = %q, want one UUID shared by the retry", ids)
+	}
+	if resp.RequestID != ids[0] {
+		t.Errorf("RequestID = %q, want %q", resp.RequestID, ids[0])
+	}
+
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if ids[2] == ids[0] {
+		t.Errorf("second call reused request ID %q", ids[0])
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad prompt"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	ctx := WithRequestID(context.Background(), "chain-42")
+	_, err := c.CallAgent(ctx, "a", "hi")
+	if id := <-got; id != "chain-42" {
+		t.Errorf("X-Request-ID = %q, want chain-42", id)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RequestID != "chain-42" {
+		t.Errorf("err = %v, want an APIError for request chain-42", err)
+	}
+	if RequestIDFromContext(context.Background()) != "" {
+		t.Error("empty context carries a request ID")
+	}
+}
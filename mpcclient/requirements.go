@@ -0,0 +1,62 @@
+package mpcclient
+
+import "slices"
+
+// Capabilities agents list in AgentInfo.Capabilities for features of the
+// protocol, which calls can require with WithRequiredCapabilities.
+// mpcserver lists CapabilityStreaming for every agent.
+const (
+	CapabilityStreaming   = "streaming"
+	CapabilityTools       = "tools"
+	CapabilityAttachments = "attachments"
+	CapabilityEmbeddings  = "embeddings"
+)
+
+// Requirements are what a call needs of its agent and server. Servers
+// check them before the agent sees the call, and reject it with an error
+// matching ErrIncompatibleAgent if the agent is older or lacks a
+// capability, instead of letting it ignore what it does not support.
+// Servers older than protocol version 1 do not check them.
+type Requirements struct {
+	// ProtocolVersion is the lowest AgentInfo.ProtocolVersion the server
+	// may speak.
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// MinVersion is the lowest AgentInfo.Version the agent may have.
+	MinVersion   string   `json:"min_version,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// WithMinAgentVersion pins the call to agents of version v, such as
+// "1.2.0", or later. Agents reporting no version fail it.
+func WithMinAgentVersion(v string) CallOption {
+	return func(o *callOptions) {
+		o.requires.MinVersion = v
+	}
+}
+
+// WithRequiredCapabilities fails the call unless the agent lists every one
+// of caps, such as CapabilityTools, in AgentInfo.Capabilities.
+func WithRequiredCapabilities(caps ...string) CallOption {
+	return func(o *callOptions) {
+		o.requires.Capabilities = append(o.requires.Capabilities, caps...)
+	}
+}
+
+// withRequirements returns req with the call's requirements added to
+// those of req.Requires.
+func (o callOptions) withRequirements(req AgentRequest) AgentRequest {
+	r := o.requires
+	if r.MinVersion == "" && r.Capabilities == nil {
+		return req
+	}
+	var merged Requirements
+	if req.Requires != nil {
+		merged = *req.Requires
+	}
+	if r.MinVersion != "" {
+		merged.MinVersion = r.MinVersion
+	}
+	merged.Capabilities = slices.Concat(merged.Capabilities, r.Capabilities)
+	req.Requires = &merged
+	return req
+}
@@ -0,0 +1,24 @@
+package mpcclient
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWithRequirementsMerges(t *testing.T) {
+	var o callOptions
+	for _, opt := range []CallOption{WithMinAgentVersion("1.2"), WithRequiredCapabilities(CapabilityTools), WithRequiredCapabilities(CapabilityAttachments)} {
+		opt(&o)
+	}
+	base := AgentRequest{Prompt: "hi", Requires: &Requirements{ProtocolVersion: 1, MinVersion: "1.0", Capabilities: []string{CapabilityStreaming}}}
+	r := o.request(base).Requires
+	if r.ProtocolVersion != 1 || r.MinVersion != "1.2" || !slices.Equal(r.Capabilities, []string{CapabilityStreaming, CapabilityTools, CapabilityAttachments}) {
+		t.Errorf("requirements = %+v", r)
+	}
+	if base.Requires.MinVersion != "1.0" || len(base.Requires.Capabilities) != 1 {
+		t.Errorf("base request modified: %+v", base.Requires)
+	}
+	if req := (callOptions{}).request(AgentRequest{Prompt: "hi"}); req.Requires != nil {
+		t.Errorf("requirements without options = %+v", req.Requires)
+	}
+}
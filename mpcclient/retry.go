@@ -0,0 +1,164 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. The zero value
+// performs a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry; it doubles on each
+	// further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter randomly shortens each delay by up to this fraction, in [0, 1],
+	// so clients that failed together do not retry together.
+	Jitter float64
+	// RetryableStatus lists the HTTP statuses worth retrying. A 429 for an
+	// exhausted daily quota, matching ErrQuotaExceeded, is never retried.
+	RetryableStatus []int
+	// RespectRetryAfter makes the server's Retry-After header, when present,
+	// take precedence over the computed backoff.
+	RespectRetryAfter bool
+}
+
+// DefaultRetryPolicy returns a policy suited to riding out MPC server
+// restarts and overload: four attempts with jittered exponential backoff
+// from 200ms, waiting as long as the server asks on 429 responses. It
+// retries the statuses Retryable reports as retryable.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       4,
+		BaseDelay:         200 * time.Millisecond,
+		MaxDelay:          5 * time.Second,
+		Jitter:            0.5,
+		RetryableStatus:   []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RespectRetryAfter: true,
+	}
+}
+
+// retryable reports whether err from an attempt should be retried.
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrDryRun) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return slices.Contains(p.RetryableStatus, apiErr.StatusCode) && !errors.Is(apiErr, ErrQuotaExceeded)
+	}
+	if errors.Is(err, ErrUnexpectedContentType) {
+		// A page from whatever stands in front of the server, such as a
+		// captive portal, is answered the same way again.
+		return false
+	}
+	// Anything else reaching here is a transport failure: refused or reset
+	// connections, premature EOFs and the like.
+	return true
+}
+
+// delay returns how long to wait before attempt (1-based) is retried.
+func (p RetryPolicy) delay(attempt int, err error, rnd func() float64) time.Duration {
+	var apiErr *APIError
+	if p.RespectRetryAfter && errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if j := min(max(p.Jitter, 0), 1); j > 0 {
+		d -= time.Duration(float64(d) * j * rnd())
+	}
+	return d
+}
+
+// noRetryKey marks a context whose requests are sent once regardless of
+// the retry policy.
+type noRetryKey struct{}
+
+// retryInterceptor resends failed requests until one succeeds, fails
+// permanently, or the policy's attempts are exhausted, returning the last
+// error. Requests whose body cannot be replayed are sent once.
+func (c *Client) retryInterceptor(next Handler) Handler {
+	return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		p := c.retry
+		if ctx.Value(noRetryKey{}) != nil {
+			p.MaxAttempts = 1
+		}
+		attempt := req
+		for n := 1; ; n++ {
+			actx, release := attemptContext(attempt)
+			res, err := next.Do(attempt.WithContext(actx))
+			if err = attemptErr(actx, err); err != nil {
+				release(nil)
+			} else {
+				release(res)
+			}
+			if err == nil || n >= p.MaxAttempts || !p.retryable(ctx, err) {
+				return res, err
+			}
+			r, rerr := rewind(req)
+			if rerr != nil {
+				return nil, err
+			}
+			d := p.delay(n, err, c.rand)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+				return nil, err
+			}
+			if sleepCtx(ctx, d) != nil {
+				return nil, err
+			}
+			attempt = r
+		}
+	})
+}
+
+// rewind returns a copy of req with a fresh body, for sending again.
+func rewind(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return r, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be replayed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+	return r, nil
+}
+
+// parseRetryAfter interprets a Retry-After header given either as seconds
+// or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func defaultRand() float64 { return rand.Float64() }
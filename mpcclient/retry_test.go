@@ -0,0 +1,105 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientStatus(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	p := DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	c, _ := NewClient(srv.URL, WithRetryPolicy(p))
+	resp, err := c.CallAgent(context.Background(), "a", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "ok" || calls.Load() != 3 {
+		t.Errorf("result %q after %d calls", resp.Result, calls.Load())
+	}
+}
+
+func TestRetryStopsOnPermanentStatus(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithRetryPolicy(DefaultRetryPolicy()))
+	_, err := c.CallAgent(context.Background(), "a", "hi")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetrySkipsExceededQuota(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"API key \"ci\" has used its 5 tokens for today","code":"quota_exceeded"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL, WithRetryPolicy(DefaultRetryPolicy()))
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want ErrQuotaExceeded", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, RespectRetryAfter: true}
+	noJitter := func() float64 { return 0 }
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 6: time.Second} {
+		if got := p.delay(attempt, nil, noJitter); got != want {
+			t.Errorf("delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	if got := p.delay(1, nil, func() float64 { return 1 }); got != 50*time.Millisecond {
+		t.Errorf("jittered delay = %v, want 50ms", got)
+	}
+
+	err := &APIError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 3 * time.Second}
+	if got := p.delay(1, err, noJitter); got != 3*time.Second {
+		t.Errorf("Retry-After delay = %v, want 3s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := parseRetryAfter("7", now); got != 7*time.Second {
+		t.Errorf("seconds form = %v", got)
+	}
+	if got := parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now); got != time.Minute {
+		t.Errorf("date form = %v", got)
+	}
+	if got := parseRetryAfter("soon", now); got != 0 {
+		t.Errorf("invalid form = %v", got)
+	}
+}
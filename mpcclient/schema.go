@@ -0,0 +1,149 @@
+package mpcclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// DefaultSchemaRepairs is how many times a response failing its schema is
+// re-requested unless WithSchemaRepairs says otherwise.
+const DefaultSchemaRepairs = 2
+
+// ErrSchemaMismatch matches the *SchemaError returned when an agent's
+// response still fails its schema after every repair attempt.
+var ErrSchemaMismatch = errors.New("response does not match schema")
+
+// Schema is a compiled JSON Schema that agent responses are validated
+// against. It is safe for concurrent use.
+type Schema struct {
+	raw      string
+	compiled *jsonschema.Schema
+}
+
+// CompileSchema compiles a JSON Schema document. Drafts 4 through 2020-12
+// are supported; the draft defaults to 2020-12 when $schema is absent.
+func CompileSchema(schema []byte) (*Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: compile schema: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("response.json", doc); err != nil {
+		return nil, fmt.Errorf("mpcclient: compile schema: %w", err)
+	}
+	compiled, err := c.Compile("response.json")
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: compile schema: %w", err)
+	}
+	return &Schema{raw: string(schema), compiled: compiled}, nil
+}
+
+// MustCompileSchema is like CompileSchema but panics on error. It suits
+// schemas embedded in the program.
+func MustCompileSchema(schema []byte) *Schema {
+	s, err := CompileSchema(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// SchemaError reports a response that does not satisfy its schema.
+type SchemaError struct {
+	// Problems lists each violation as "<JSON pointer>: <message>"; a
+	// response that is not JSON at all has a single problem saying so.
+	Problems []string
+	// Response is the offending response of the last attempt.
+	Response *AgentResponse
+	// Attempts is the number of calls made, including repairs.
+	Attempts int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("response does not match schema after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// Is makes errors.Is(err, ErrSchemaMismatch) hold.
+func (e *SchemaError) Is(target error) bool {
+	return target == ErrSchemaMismatch
+}
+
+// Validate checks resp's structured payload, as read by
+// AgentResponse.JSON, and returns the violations found.
+func (s *Schema) Validate(resp *AgentResponse) []string {
+	src, err := resp.payload()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader(src))
+	if err != nil {
+		return []string{"response is not valid JSON: " + err.Error()}
+	}
+	err = s.compiled.Validate(v)
+	if err == nil {
+		return nil
+	}
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, u := range verr.BasicOutput().Errors {
+		if u.Error == nil {
+			continue
+		}
+		loc := u.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		problems = append(problems, loc+": "+u.Error.String())
+	}
+	if len(problems) == 0 {
+		problems = []string{verr.Error()}
+	}
+	return problems
+}
+
+// WithResponseSchema validates the call's response against schema. A
+// response that fails is re-requested with the violations and the schema
+// included, so the agent can correct itself, up to the number of repairs
+// set with WithSchemaRepairs. If none passes, the call fails with a
+// *SchemaError. Responses asking for tool calls are not validated.
+func WithResponseSchema(schema *Schema) CallOption {
+	return func(o *callOptions) {
+		o.schema = schema
+	}
+}
+
+// WithSchemaRepairs sets how many repair attempts WithResponseSchema makes.
+// Zero fails on the first invalid response.
+func WithSchemaRepairs(n int) CallOption {
+	return func(o *callOptions) {
+		o.schemaRepairs = max(n, 0)
+	}
+}
+
+// repairRequest returns the follow-up to req asking the agent to correct
+// resp, which violated schema.
+func repairRequest(req AgentRequest, resp *AgentResponse, schema *Schema, problems []string) AgentRequest {
+	var b strings.Builder
+	b.WriteString("Your previous answer did not match the required JSON schema:\n")
+	for _, p := range problems {
+		fmt.Fprintf(&b, "- %s\n", p)
+	}
+	fmt.Fprintf(&b, "\nThe schema is:\n%s\n\nAnswer again with only a JSON document that satisfies it.", schema.raw)
+
+	next := req
+	// Attachments were consumed by the first attempt.
+	next.Attachments = nil
+	next.Messages = append(append([]Message(nil), req.Messages...),
+		Message{Role: RoleUser, Content: req.Prompt},
+		Message{Role: RoleAssistant, Content: resp.Result},
+	)
+	next.Prompt = b.String()
+	return next
+}
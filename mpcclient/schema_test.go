@@ -0,0 +1,84 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var vmSchema = MustCompileSchema([]byte(`{
+	"type": "object",
+	"required": ["vm", "cpu"],
+	"properties": {
+		"vm": {"type": "string"},
+		"cpu": {"type": "number", "maximum": 100}
+	}
+}`))
+
+// scriptedServer answers successive calls with results, the last one
+// repeating, and records the requests it received.
+func scriptedServer(t *testing.T, results ...string) (*httptest.Server, *[]AgentRequest) {
+	var reqs []AgentRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		reqs = append(reqs, req)
+		result := results[min(len(reqs), len(results))-1]
+		json.NewEncoder(w).Encode(AgentResponse{Agent: "vm", Result: result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+func TestResponseSchemaRepair(t *testing.T) {
+	srv, reqs := scriptedServer(t, "not json", "```json\n{\"vm\": \"web01\", \"cpu\": 140}\n```", `{"vm": "web01", "cpu": 42.5}`)
+	c, _ := NewClient(srv.URL)
+
+	resp, err := c.CallAgent(context.Background(), "vm", "cpu of web01?", WithResponseSchema(vmSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != `{"vm": "web01", "cpu": 42.5}` {
+		t.Errorf("result = %q", resp.Result)
+	}
+	if len(*reqs) != 3 {
+		t.Fatalf("server saw %d calls, want 3", len(*reqs))
+	}
+	last := (*reqs)[2]
+	if !strings.Contains(last.Prompt, "/cpu:") || !strings.Contains(last.Prompt, `"maximum": 100`) {
+		t.Errorf("repair prompt lacks the violation or schema:\n%s", last.Prompt)
+	}
+	if len(last.Messages) != 4 || last.Messages[0].Content != "cpu of web01?" || last.Messages[1].Content != "not json" {
+		t.Errorf("repair history = %+v", last.Messages)
+	}
+}
+
+func TestResponseSchemaGivesUp(t *testing.T) {
+	srv, reqs := scriptedServer(t, `{"vm": "web01"}`)
+	c, _ := NewClient(srv.URL)
+
+	_, err := c.CallAgent(context.Background(), "vm", "cpu?", WithResponseSchema(vmSchema), WithSchemaRepairs(1))
+	var serr *SchemaError
+	if !errors.Is(err, ErrSchemaMismatch) || !errors.As(err, &serr) {
+		t.Fatalf("err = %v, want SchemaError", err)
+	}
+	if serr.Attempts != 2 || len(*reqs) != 2 || len(serr.Problems) != 1 || !strings.Contains(serr.Problems[0], "cpu") {
+		t.Errorf("SchemaError = %+v after %d calls", serr, len(*reqs))
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	if p := vmSchema.Validate(&AgentResponse{Data: json.RawMessage(`{"vm":"a","cpu":1}`)}); p != nil {
+		t.Errorf("valid data payload: problems %q", p)
+	}
+	if p := vmSchema.Validate(&AgentResponse{}); len(p) != 1 {
+		t.Errorf("empty response: problems %q", p)
+	}
+	if _, err := CompileSchema([]byte(`{"type": 12}`)); err == nil {
+		t.Error("invalid schema compiled")
+	}
+}
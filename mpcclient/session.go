@@ -0,0 +1,316 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Role identifies the author of a conversation message.
+type Role string
+
+// Conversation roles.
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is one entry of a conversation history.
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+// TruncationPolicy bounds the history a session sends. System messages are
+// always kept; the other messages are trimmed by the policy's Strategy,
+// which drops the oldest first by default. Zero fields impose no limit.
+type TruncationPolicy struct {
+	// MaxTurns is the number of user/assistant exchanges to keep.
+	MaxTurns int `json:"max_turns,omitempty"`
+	// MaxTokens bounds the estimated token count of the kept history.
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// EstimateTokens returns the token cost of a message's content. It
+	// defaults to EstimateTokens.
+	EstimateTokens func(string) int `json:"-"`
+	// Strategy trims the history to MaxTokens. It defaults to DropOldest;
+	// should it fail, the session drops the oldest messages instead.
+	Strategy TrimStrategy `json:"-"`
+}
+
+// EstimateTokens approximates the token count of s using the common rule of
+// thumb of four characters per token.
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// Session is a conversation with one agent. Each Send includes the prior
+// history, so the agent can refer back to earlier turns. Sends on a session
+// are serialized; it is safe to share between goroutines.
+type Session struct {
+	client *Client
+	agent  string
+
+	mu       sync.Mutex
+	messages []Message
+	policy   TruncationPolicy
+	// summarizer, if set, replaces older turns by a summary.
+	summarizer *Summarizer
+	budget     BudgetFunc
+	used       Usage
+	cost       float64
+}
+
+// SessionOption configures a Session.
+type SessionOption func(*Session)
+
+// WithSystemPrompt starts the conversation with a system message.
+func WithSystemPrompt(prompt string) SessionOption {
+	return func(s *Session) {
+		s.messages = append([]Message{{Role: RoleSystem, Content: prompt}}, s.messages...)
+	}
+}
+
+// WithTruncation sets the policy bounding the history sent with each call.
+func WithTruncation(p TruncationPolicy) SessionOption {
+	return func(s *Session) {
+		s.policy = p
+	}
+}
+
+// WithTrimStrategy sets the strategy trimming the history to the policy's
+// MaxTokens. It overrides the Strategy of a policy set by an earlier
+// WithTruncation. Strategies are not saved with a session, so pass it again
+// to LoadSession.
+func WithTrimStrategy(st TrimStrategy) SessionOption {
+	return func(s *Session) {
+		s.policy.Strategy = st
+	}
+}
+
+// WithHistory continues a conversation from msgs, such as the History of
+// another session.
+func WithHistory(msgs []Message) SessionOption {
+	return func(s *Session) {
+		s.messages = append(s.messages, msgs...)
+	}
+}
+
+// NewSession starts a conversation with the named agent.
+func (c *Client) NewSession(agentName string, opts ...SessionOption) *Session {
+	s := &Session{client: c, agent: agentName}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Agent returns the name of the agent the session talks to.
+func (s *Session) Agent() string {
+	return s.agent
+}
+
+// TrimStrategy returns the strategy trimming the session's history.
+func (s *Session) TrimStrategy() TrimStrategy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy.strategy()
+}
+
+// Tokens returns the estimated token count of the history, as the
+// session's policy counts it.
+func (s *Session) Tokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return CountTokens(s.messages, s.policy.EstimateTokens)
+}
+
+// Send sends prompt together with the conversation so far and records both
+// the prompt and the agent's reply in the history. A failed call leaves the
+// history unchanged. With a budget set, Send fails without calling the
+// agent once the budget refuses. With a summarizer set, Send summarizes the
+// older turns once the history passes its thresholds.
+func (s *Session) Send(ctx context.Context, prompt string, opts ...CallOption) (*AgentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.budget != nil {
+		if err := s.budget(s.used, s.cost); err != nil {
+			return nil, fmt.Errorf("mpcclient: session with agent %q: %w", s.agent, err)
+		}
+	}
+	req := AgentRequest{Prompt: prompt, Messages: append([]Message(nil), s.messages...)}
+	resp, err := s.client.Invoke(ctx, s.agent, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Usage != nil {
+		s.used = s.used.Add(*resp.Usage)
+		s.cost += s.client.usage.price(s.agent, *resp.Usage)
+	}
+	s.messages = append(s.messages,
+		Message{Role: RoleUser, Content: prompt},
+		Message{Role: RoleAssistant, Content: resp.Result},
+	)
+	s.maybeSummarize(ctx)
+	s.messages = s.policy.apply(ctx, s.messages)
+	return resp, nil
+}
+
+// Stream is like Send, but streams the reply, calling fn for each chunk as
+// StreamAgent does. The assembled reply is recorded in the history once the
+// stream finishes; a failed stream leaves the history unchanged. Streams do
+// not report usage, so they are not counted against the session's budget.
+func (s *Session) Stream(ctx context.Context, prompt string, fn func(Chunk) error, opts ...CallOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.budget != nil {
+		if err := s.budget(s.used, s.cost); err != nil {
+			return fmt.Errorf("mpcclient: session with agent %q: %w", s.agent, err)
+		}
+	}
+	req := AgentRequest{Prompt: prompt, Messages: append([]Message(nil), s.messages...)}
+	var reply strings.Builder
+	err := s.client.stream(ctx, s.agent, req, func(ch Chunk) error {
+		reply.WriteString(ch.Text)
+		return fn(ch)
+	}, opts)
+	if err != nil {
+		return err
+	}
+	s.messages = append(s.messages,
+		Message{Role: RoleUser, Content: prompt},
+		Message{Role: RoleAssistant, Content: reply.String()},
+	)
+	s.maybeSummarize(ctx)
+	s.messages = s.policy.apply(ctx, s.messages)
+	return nil
+}
+
+// History returns a copy of the conversation so far.
+func (s *Session) History() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset clears the conversation, keeping any system prompts.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.messages[:0]
+	for _, m := range s.messages {
+		if m.Role == RoleSystem && !isSummary(m) {
+			kept = append(kept, m)
+		}
+	}
+	s.messages = kept
+}
+
+// strategy returns the policy's strategy, DropOldest when unset.
+func (p TruncationPolicy) strategy() TrimStrategy {
+	if p.Strategy == nil {
+		return DropOldest()
+	}
+	return p.Strategy
+}
+
+// apply returns msgs trimmed to the policy's limits.
+func (p TruncationPolicy) apply(ctx context.Context, msgs []Message) []Message {
+	var system, summary, rest []Message
+	for _, m := range msgs {
+		switch {
+		case isSummary(m):
+			summary = append(summary, m)
+		case m.Role == RoleSystem:
+			system = append(system, m)
+		default:
+			rest = append(rest, m)
+		}
+	}
+	if p.MaxTurns > 0 && len(rest) > 2*p.MaxTurns {
+		rest = rest[len(rest)-2*p.MaxTurns:]
+	}
+	rest = append(summary, rest...)
+	if p.MaxTokens > 0 {
+		estimate := p.EstimateTokens
+		if estimate == nil {
+			estimate = EstimateTokens
+		}
+		budget := p.MaxTokens - CountTokens(system, estimate)
+		if CountTokens(rest, estimate) > budget {
+			trimmed, err := p.strategy().Trim(ctx, rest, budget, estimate)
+			if err != nil {
+				trimmed, _ = DropOldest().Trim(ctx, rest, budget, estimate)
+			}
+			rest = trimmed
+		}
+	}
+	return append(system, rest...)
+}
+
+// sessionFile is the on-disk form of a session.
+type sessionFile struct {
+	Agent      string           `json:"agent"`
+	Messages   []Message        `json:"messages"`
+	Policy     TruncationPolicy `json:"policy"`
+	Summarizer *Summarizer      `json:"summarizer,omitempty"`
+	Usage      Usage            `json:"usage"`
+	Cost       float64          `json:"cost,omitempty"`
+}
+
+// Save writes the session to path as JSON, replacing any existing file
+// atomically.
+func (s *Session) Save(path string) error {
+	s.mu.Lock()
+	b, err := json.MarshalIndent(sessionFile{Agent: s.agent, Messages: s.messages, Policy: s.policy, Summarizer: s.summarizer, Usage: s.used, Cost: s.cost}, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("mpcclient: save session: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".session-*")
+	if err != nil {
+		return fmt.Errorf("mpcclient: save session: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("mpcclient: save session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("mpcclient: save session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("mpcclient: save session: %w", err)
+	}
+	return nil
+}
+
+// LoadSession restores a session saved with Session.Save. Options are
+// applied after the saved state, so they can override the saved policy and
+// summarizer. A saved summarizer calls its agent through c.
+func (c *Client) LoadSession(path string, opts ...SessionOption) (*Session, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: load session: %w", err)
+	}
+	var f sessionFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("mpcclient: load session %s: %w", path, err)
+	}
+	if f.Agent == "" {
+		return nil, errors.New("mpcclient: load session: file names no agent")
+	}
+	s := &Session{client: c, agent: f.Agent, messages: f.Messages, policy: f.Policy, summarizer: f.Summarizer, used: f.Usage, cost: f.Cost}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
@@ -0,0 +1,133 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// historyServer replies with the number of messages it received.
+func historyServer(t *testing.T, got *[][]Message) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		*got = append(*got, req.Messages)
+		json.NewEncoder(w).Encode(AgentResponse{Agent: "chat", Result: "re: " + req.Prompt})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSessionSendsHistory(t *testing.T) {
+	var got [][]Message
+	c, _ := NewClient(historyServer(t, &got).URL)
+	s := c.NewSession("chat", WithSystemPrompt("be brief"))
+
+	for _, p := range []string{"one", "two"} {
+		if _, err := s.Send(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got[0]) != 1 || got[0][0].Role != RoleSystem {
+		t.Errorf("first call history = %+v", got[0])
+	}
+	if len(got[1]) != 3 || got[1][2].Content != "re: one" {
+		t.Errorf("second call history = %+v", got[1])
+	}
+	if h := s.History(); len(h) != 5 {
+		t.Errorf("history has %d messages, want 5", len(h))
+	}
+
+	s.Reset()
+	if h := s.History(); len(h) != 1 || h[0].Role != RoleSystem {
+		t.Errorf("history after reset = %+v", h)
+	}
+}
+
+func TestTruncationPolicy(t *testing.T) {
+	msgs := []Message{{RoleSystem, "sys"}}
+	for _, c := range []string{"u1", "a1", "u2", "a2", "u3", "a3"} {
+		role := RoleUser
+		if c[0] == 'a' {
+			role = RoleAssistant
+		}
+		msgs = append(msgs, Message{role, c})
+	}
+
+	got := TruncationPolicy{MaxTurns: 2}.apply(context.Background(), msgs)
+	if len(got) != 5 || got[0].Role != RoleSystem || got[1].Content != "u2" {
+		t.Errorf("MaxTurns: %+v", got)
+	}
+
+	oneEach := func(string) int { return 1 }
+	got = TruncationPolicy{MaxTokens: 3, EstimateTokens: oneEach}.apply(context.Background(), msgs)
+	if len(got) != 3 || got[1].Content != "u3" {
+		t.Errorf("MaxTokens: %+v", got)
+	}
+}
+
+func TestSessionSaveAndLoad(t *testing.T) {
+	var got [][]Message
+	c, _ := NewClient(historyServer(t, &got).URL)
+	s := c.NewSession("chat", WithTruncation(TruncationPolicy{MaxTurns: 5}))
+	if _, err := s.Send(context.Background(), "remember me"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := c.LoadSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Agent() != "chat" || restored.policy.MaxTurns != 5 {
+		t.Errorf("restored session = %+v", restored)
+	}
+	if _, err := restored.Send(context.Background(), "again"); err != nil {
+		t.Fatal(err)
+	}
+	last := got[len(got)-1]
+	if len(last) != 2 || !strings.Contains(last[1].Content, "remember me") {
+		t.Errorf("restored session sent history %+v", last)
+	}
+}
+
+func TestSessionStream(t *testing.T) {
+	var got [][]Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		got = append(got, req.Messages)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"text\":\"re: \"}\n\ndata: {\"text\":\""+req.Prompt+"\"}\n\nevent: done\ndata: {}\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	c, _ := NewClient(srv.URL)
+	s := c.NewSession("chat", WithHistory([]Message{{RoleUser, "zero"}, {RoleAssistant, "re: zero"}}))
+
+	var chunks int
+	for _, p := range []string{"one", "two"} {
+		if err := s.Stream(context.Background(), p, func(Chunk) error { chunks++; return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chunks != 6 {
+		t.Errorf("got %d chunks, want 6", chunks)
+	}
+	if len(got[1]) != 4 || got[1][3].Content != "re: one" {
+		t.Errorf("second stream history = %+v", got[1])
+	}
+	if h := s.History(); len(h) != 6 || h[5].Content != "re: two" {
+		t.Errorf("history = %+v", h)
+	}
+}
@@ -0,0 +1,242 @@
+package mpcclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// FormatOpenAIJSONL is the chat format of OpenAI fine-tuning datasets,
+// which most other tools read and write too: a conversation per line, as
+// a JSON object whose "messages" hold role and content pairs. It is a
+// format for Session.Export and ImportSession, not a response format.
+const FormatOpenAIJSONL Format = "openai-jsonl"
+
+// markdownHeadings are the section headings of the messages of each role
+// in Markdown exports.
+var markdownHeadings = map[Role]string{
+	RoleSystem:    "System",
+	RoleUser:      "User",
+	RoleAssistant: "Assistant",
+}
+
+var (
+	// headingLineRE matches the lines of a message that would read as a
+	// message heading, with the backslashes escaping them.
+	headingLineRE = regexp.MustCompile(`^(\\*)## (System|User|Assistant)[ \t]*$`)
+	titleRE       = regexp.MustCompile(`^# Conversation with (.+)$`)
+)
+
+// openAIConversation is a line of FormatOpenAIJSONL.
+type openAIConversation struct {
+	Messages []Message `json:"messages"`
+}
+
+// Export writes the conversation so far to w in format f: FormatOpenAIJSONL,
+// to add it to a fine-tuning dataset or hand it to another tool, or
+// FormatMarkdown, a document with a section per message for sharing.
+// Exports of several sessions can be appended to one JSONL file. Only the
+// messages are exported; Save keeps the rest of the session's state.
+func (s *Session) Export(w io.Writer, f Format) error {
+	msgs := s.History()
+	var err error
+	switch f {
+	case FormatOpenAIJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(openAIConversation{Messages: msgs})
+	case FormatMarkdown:
+		_, err = io.WriteString(w, exportMarkdown(s.agent, msgs))
+	default:
+		return fmt.Errorf("mpcclient: export session: unsupported format %q", f)
+	}
+	if err != nil {
+		return fmt.Errorf("mpcclient: export session: %w", err)
+	}
+	return nil
+}
+
+// exportMarkdown returns msgs as a document titled with the agent's name.
+// Lines of a message that would read as a heading are escaped with a
+// backslash, so that importing the document gives back the same messages.
+func exportMarkdown(agent string, msgs []Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation with %s\n", agent)
+	for _, m := range msgs {
+		heading, ok := markdownHeadings[m.Role]
+		if !ok {
+			heading = string(m.Role)
+		}
+		lines := strings.Split(strings.TrimSpace(m.Content), "\n")
+		for i, line := range lines {
+			if headingLineRE.MatchString(line) {
+				lines[i] = `\` + line
+			}
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", heading, strings.Join(lines, "\n"))
+	}
+	return b.String()
+}
+
+// ImportSession starts a session continuing a conversation in format f,
+// as written by Session.Export or by tools using FormatOpenAIJSONL.
+// agentName names the agent the session talks to; when it is empty, the
+// title of a Markdown export names it. JSONL input must hold a single
+// conversation. Messages in the "developer" role that newer tools write
+// are read as system messages, and content given as a list of parts keeps
+// its text parts; messages of other roles, such as tool results, are an
+// error. Options are applied after the imported history.
+func (c *Client) ImportSession(r io.Reader, f Format, agentName string, opts ...SessionOption) (*Session, error) {
+	var (
+		msgs  []Message
+		agent string
+		err   error
+	)
+	switch f {
+	case FormatOpenAIJSONL:
+		msgs, err = importOpenAI(r)
+	case FormatMarkdown:
+		agent, msgs, err = importMarkdown(r)
+	default:
+		err = fmt.Errorf("unsupported format %q", f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mpcclient: import session: %w", err)
+	}
+	if agentName == "" {
+		agentName = agent
+	}
+	if agentName == "" {
+		return nil, errors.New("mpcclient: import session: no agent named")
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("mpcclient: import session: no messages")
+	}
+	return c.NewSession(agentName, append([]SessionOption{WithHistory(msgs)}, opts...)...), nil
+}
+
+// maxImportLine bounds the length of a JSONL conversation.
+const maxImportLine = 64 << 20
+
+func importOpenAI(r io.Reader) ([]Message, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxImportLine)
+	var line []byte
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		if line != nil {
+			return nil, errors.New("input holds more than one conversation")
+		}
+		line = bytes.Clone(sc.Bytes())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if line == nil {
+		return nil, nil
+	}
+	var conv struct {
+		Messages []struct {
+			Role    Role            `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(line, &conv); err != nil {
+		return nil, err
+	}
+	msgs := make([]Message, 0, len(conv.Messages))
+	for i, m := range conv.Messages {
+		switch m.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		case "developer":
+			m.Role = RoleSystem
+		default:
+			return nil, fmt.Errorf("message %d: unsupported role %q", i+1, m.Role)
+		}
+		content, err := openAIContent(m.Content)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		msgs = append(msgs, Message{Role: m.Role, Content: content})
+	}
+	return msgs, nil
+}
+
+// openAIContent returns the text of a message's content, a string or a
+// list of parts of which only the text ones are kept.
+func openAIContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("content is neither text nor a list of parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// importMarkdown reads a document in the layout of exportMarkdown,
+// returning the agent its title names and the messages. Text before the
+// first message heading is ignored.
+func importMarkdown(r io.Reader) (string, []Message, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	roles := make(map[string]Role, len(markdownHeadings))
+	for role, heading := range markdownHeadings {
+		roles[heading] = role
+	}
+	var (
+		agent string
+		msgs  []Message
+		cur   *Message
+		lines []string
+	)
+	end := func() {
+		if cur != nil {
+			cur.Content = strings.TrimSpace(strings.Join(lines, "\n"))
+			msgs = append(msgs, *cur)
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		if m := headingLineRE.FindStringSubmatch(line); m != nil {
+			if m[1] == "" {
+				end()
+				cur = &Message{Role: roles[m[2]]}
+				continue
+			}
+			line = line[1:]
+		}
+		if cur == nil {
+			if m := titleRE.FindStringSubmatch(line); m != nil && agent == "" {
+				agent = strings.TrimSpace(m[1])
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	end()
+	return agent, msgs, nil
+}
@@ -0,0 +1,77 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSessionExportImport(t *testing.T) {
+	var got [][]Message
+	c, _ := NewClient(historyServer(t, &got).URL)
+	s := c.NewSession("chat", WithSystemPrompt("be brief"))
+	for _, p := range []string{"one <b> & two", "a reply quoting\n## User\nand \\## User"} {
+		if _, err := s.Send(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range []Format{FormatOpenAIJSONL, FormatMarkdown} {
+		var buf bytes.Buffer
+		if err := s.Export(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := c.ImportSession(&buf, f, "")
+		if f == FormatOpenAIJSONL {
+			// JSONL does not name the agent.
+			if err == nil {
+				t.Error("imported JSONL without an agent")
+			}
+			s.Export(&buf, f)
+			restored, err = c.ImportSession(&buf, f, "chat")
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if restored.Agent() != "chat" || !slices.Equal(restored.History(), s.History()) {
+			t.Errorf("%s: imported %s %+v, want %+v", f, restored.Agent(), restored.History(), s.History())
+		}
+	}
+
+	var md bytes.Buffer
+	s.Export(&md, FormatMarkdown)
+	if !strings.HasPrefix(md.String(), "# Conversation with chat\n\n## System\n\nbe brief\n\n## User\n\none <b> & two\n") {
+		t.Errorf("Markdown export:\n%s", md.String())
+	}
+	if err := s.Export(&md, FormatJSON); err == nil {
+		t.Error("exported in a response format")
+	}
+}
+
+func TestImportOpenAI(t *testing.T) {
+	c, _ := NewClient("http://mpc.test")
+	in := `{"messages":[{"role":"developer","content":"be brief"},` +
+		`{"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"x"}}]},` +
+		`{"role":"assistant","content":"done","weight":1}]}` + "\n\n"
+	s, err := c.ImportSession(strings.NewReader(in), FormatOpenAIJSONL, "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Message{{RoleSystem, "be brief"}, {RoleUser, "look"}, {RoleAssistant, "done"}}
+	if !slices.Equal(s.History(), want) {
+		t.Errorf("history = %+v", s.History())
+	}
+
+	for _, tc := range []struct{ in, want string }{
+		{"", "no messages"},
+		{`{"messages":[{"role":"tool","content":"42"}]}`, `unsupported role "tool"`},
+		{`{"messages":[{"role":"user","content":7}]}`, "neither text nor"},
+		{"{\"messages\":[]}\n{\"messages\":[]}", "more than one conversation"},
+	} {
+		if _, err := c.ImportSession(strings.NewReader(tc.in), FormatOpenAIJSONL, "chat"); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: err = %v, want %q", tc.in, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package mpcclient
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Request signing headers, as the server reads them.
+const (
+	signatureTimestampHeader = "Request-Timestamp"
+	signatureNonceHeader     = "Request-Nonce"
+	signatureHeader          = "Request-Signature"
+)
+
+// WithRequestSigning signs every HTTP request, and the opening of WebSocket
+// connections, with secret, for servers requiring signed requests: an
+// HMAC-SHA256 of the method, path, body, time and a random nonce lets the
+// server refuse requests altered or replayed on the way. Each attempt is
+// signed afresh, so retries carry their own timestamp and nonce. A server
+// refusing the signature answers 401, matching ErrUnauthorized.
+func WithRequestSigning(secret []byte) Option {
+	return func(c *Client) {
+		c.signingSecret = secret
+	}
+}
+
+// signInterceptor signs each attempt once its URL is final.
+func (c *Client) signInterceptor(next Handler) Handler {
+	return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if err := c.sign(req); err != nil {
+			return nil, err
+		}
+		return next.Do(req)
+	})
+}
+
+// sign adds the signature headers to req, reading its body into memory
+// unless it can be replayed.
+func (c *Client) sign(req *http.Request) error {
+	if len(c.signingSecret) == 0 {
+		return nil
+	}
+	var body []byte
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		r, err := req.GetBody()
+		if err == nil {
+			body, err = io.ReadAll(r)
+			r.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("sign request: %w", err)
+		}
+	default:
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return fmt.Errorf("sign request: %w", err)
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		req.ContentLength = int64(len(b))
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newRequestID()
+	req.Header.Set(signatureTimestampHeader, ts)
+	req.Header.Set(signatureNonceHeader, nonce)
+	req.Header.Set(signatureHeader, signRequest(c.signingSecret, req.Method, req.URL.RequestURI(), ts, nonce, body))
+	return nil
+}
+
+// signRequest returns the signature header value of a request, as the
+// server computes it.
+func signRequest(secret []byte, method, path, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	for _, field := range []string{method, path, timestamp, nonce, hex.EncodeToString(sum[:])} {
+		mac.Write([]byte(field))
+		mac.Write([]byte("\n"))
+	}
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,43 @@
+package mpcclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestSigningPerAttempt(t *testing.T) {
+	secret := []byte("shared-secret")
+	var mu sync.Mutex
+	var nonces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, nonce := r.Header.Get(signatureTimestampHeader), r.Header.Get(signatureNonceHeader)
+		if r.Header.Get(signatureHeader) != signRequest(secret, r.Method, r.URL.RequestURI(), ts, nonce, body) {
+			t.Errorf("attempt signed %q", r.Header.Get(signatureHeader))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		nonces = append(nonces, nonce)
+		if len(nonces) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"agent":"a","result":"ok"}`))
+	}))
+	defer srv.Close()
+
+	p := DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	c, _ := NewClient(srv.URL, WithRetryPolicy(p), WithRequestSigning(secret))
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(nonces) != 2 || nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Errorf("attempts used nonces %q", nonces)
+	}
+}
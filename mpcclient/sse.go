@@ -0,0 +1,95 @@
+package mpcclient
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxEventLine bounds a single line of a text/event-stream body.
+const maxEventLine = 1 << 20
+
+// event is one dispatched Server-Sent Event.
+type event struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// eventReader parses a text/event-stream body as described by the HTML
+// Living Standard: fields accumulate until a blank line dispatches the event.
+type eventReader struct {
+	sc *bufio.Scanner
+	// retry is the most recent reconnection delay sent by the server.
+	retry time.Duration
+	// heartbeat, if set, is called for each comment line, which servers
+	// send as keepalives.
+	heartbeat func()
+}
+
+func newEventReader(r io.Reader) *eventReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxEventLine)
+	return &eventReader{sc: sc}
+}
+
+// Next returns the next event. Events without a data field are not
+// dispatched, matching browser behaviour. It returns io.EOF when the stream
+// ends cleanly on an event boundary and io.ErrUnexpectedEOF when it ends
+// mid-event.
+func (r *eventReader) Next() (event, error) {
+	var (
+		ev      event
+		data    strings.Builder
+		hasData bool
+		pending bool
+	)
+	for r.sc.Scan() {
+		line := r.sc.Text()
+		if line == "" {
+			if !hasData {
+				ev, pending = event{}, false
+				continue
+			}
+			ev.Data = data.String()
+			if ev.Type == "" {
+				ev.Type = "message"
+			}
+			return ev, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			if r.heartbeat != nil {
+				r.heartbeat()
+			}
+			continue
+		}
+		pending = true
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			ev.ID = value
+		case "event":
+			ev.Type = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := r.sc.Err(); err != nil {
+		return event{}, err
+	}
+	if pending {
+		return event{}, io.ErrUnexpectedEOF
+	}
+	return event{}, io.EOF
+}
@@ -0,0 +1,227 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stats sums up the calls a client has made since it was created, by
+// agent, as Client.Stats reports them. It needs no telemetry backend: for
+// dashboards and alerts, use WithMeterProvider instead.
+type Stats struct {
+	Since  time.Time             `json:"since"`
+	Agents map[string]AgentStats `json:"agents"`
+}
+
+// AgentStats sums up the calls to one agent: agent calls, streams and
+// embeddings alike, a call counting once however often it was retried.
+type AgentStats struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	// ErrorKinds breaks Errors down by kind: the code of the server's
+	// error, such as "rate_limited", or its HTTP status, such as
+	// "http_503", if it gave none; "unexpected_content_type" for 2xx
+	// answers that are not JSON; and "timeout", "canceled",
+	// "circuit_open", "dry_run" or "transport" for calls it did not
+	// answer.
+	ErrorKinds map[string]int64 `json:"error_kinds,omitempty"`
+	// Latency is the time calls took, retries included.
+	Latency DurationStats `json:"latency"`
+	// BytesOut and BytesIn are the sizes of the request and response
+	// bodies of calls over HTTP, retries included; other transports
+	// report none.
+	BytesOut SizeStats `json:"bytes_out"`
+	BytesIn  SizeStats `json:"bytes_in"`
+}
+
+// DurationStats summarizes a distribution of durations. Percentiles are
+// estimated to within 5%.
+type DurationStats struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// SizeStats summarizes a distribution of sizes in bytes. Percentiles are
+// estimated to within 5%.
+type SizeStats struct {
+	Total int64 `json:"total"`
+	Mean  int64 `json:"mean"`
+	P50   int64 `json:"p50"`
+	P95   int64 `json:"p95"`
+	P99   int64 `json:"p99"`
+	Max   int64 `json:"max"`
+}
+
+// Stats returns a snapshot of the client's call statistics.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// histogramGrowth is the ratio of the bounds of consecutive histogram
+// buckets. Reporting a bucket's geometric middle puts estimates within 5%
+// of the true value.
+const histogramGrowth = 1.1
+
+// histogram counts observations in buckets that grow exponentially, so
+// that it takes little room whatever the range of values. Bucket i holds
+// the values in (growth^(i-1), growth^i]; values up to 1 go in bucket 0.
+type histogram struct {
+	buckets map[int]int64
+	n       int64
+	sum     float64
+	max     float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.buckets == nil {
+		h.buckets = make(map[int]int64)
+	}
+	i := 0
+	if v > 1 {
+		i = int(math.Ceil(math.Log(v) / math.Log(histogramGrowth)))
+	}
+	h.buckets[i]++
+	h.n++
+	h.sum += v
+	h.max = max(h.max, v)
+}
+
+// quantile estimates the q-quantile of the observed values.
+func (h *histogram) quantile(q float64) float64 {
+	if h.n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.n)))
+	var seen int64
+	for _, i := range slices.Sorted(maps.Keys(h.buckets)) {
+		if seen += h.buckets[i]; seen >= rank {
+			if i == 0 {
+				return min(1, h.max)
+			}
+			return min(math.Pow(histogramGrowth, float64(i)-0.5), h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) mean() float64 {
+	if h.n == 0 {
+		return 0
+	}
+	return h.sum / float64(h.n)
+}
+
+// durations summarizes h, which holds microseconds.
+func (h *histogram) durations() DurationStats {
+	d := func(us float64) time.Duration { return time.Duration(us * float64(time.Microsecond)) }
+	return DurationStats{Mean: d(h.mean()), P50: d(h.quantile(0.5)), P95: d(h.quantile(0.95)), P99: d(h.quantile(0.99)), Max: d(h.max)}
+}
+
+// sizes summarizes h, which holds bytes.
+func (h *histogram) sizes() SizeStats {
+	b := func(v float64) int64 { return int64(math.Round(v)) }
+	return SizeStats{Total: b(h.sum), Mean: b(h.mean()), P50: b(h.quantile(0.5)), P95: b(h.quantile(0.95)), P99: b(h.quantile(0.99)), Max: b(h.max)}
+}
+
+// statsCollector accumulates the statistics Client.Stats reports.
+type statsCollector struct {
+	since time.Time
+
+	mu     sync.Mutex
+	agents map[string]*agentCounters
+}
+
+type agentCounters struct {
+	calls, errors    int64
+	kinds            map[string]int64
+	latency, out, in histogram
+}
+
+// record adds a call to agent that took elapsed and sent and received
+// the given bytes, failing with err if it is not nil.
+func (s *statsCollector) record(agent string, elapsed time.Duration, out, in int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.agents == nil {
+		s.agents = make(map[string]*agentCounters)
+	}
+	a := s.agents[agent]
+	if a == nil {
+		a = &agentCounters{kinds: make(map[string]int64)}
+		s.agents[agent] = a
+	}
+	a.calls++
+	if err != nil {
+		a.errors++
+		a.kinds[errorKind(err)]++
+	}
+	a.latency.observe(float64(elapsed.Microseconds()))
+	a.out.observe(float64(out))
+	a.in.observe(float64(in))
+}
+
+func (s *statsCollector) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{Since: s.since, Agents: make(map[string]AgentStats, len(s.agents))}
+	for name, a := range s.agents {
+		as := AgentStats{
+			Calls:    a.calls,
+			Errors:   a.errors,
+			Latency:  a.latency.durations(),
+			BytesOut: a.out.sizes(),
+			BytesIn:  a.in.sizes(),
+		}
+		if len(a.kinds) > 0 {
+			as.ErrorKinds = maps.Clone(a.kinds)
+		}
+		st.Agents[name] = as
+	}
+	return st
+}
+
+// errorKind names the kind of a failed call's error for AgentStats.
+func errorKind(err error) string {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &apiErr) && apiErr.Code != "":
+		return apiErr.Code
+	case errors.As(err, &apiErr):
+		return "http_" + strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(classify(err), ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrDryRun):
+		return "dry_run"
+	case errors.Is(err, ErrUnexpectedContentType):
+		return "unexpected_content_type"
+	default:
+		return "transport"
+	}
+}
+
+// countingBody counts the bytes read from a response body against the
+// call it answers.
+type countingBody struct {
+	io.ReadCloser
+	st *callStats
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.st.bytesIn.Add(int64(n))
+	return n, err
+}
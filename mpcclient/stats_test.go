@@ -0,0 +1,75 @@
+package mpcclient
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/busy"):
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"slow down","code":"rate_limited"}`))
+		case strings.HasSuffix(r.URL.Path, "/broken"):
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"agent":"vm","result":"` + strings.Repeat("x", 100) + `"}`))
+		}
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	ctx := context.Background()
+	for range 3 {
+		if _, err := c.CallAgent(ctx, "vm", "check cpu"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.CallAgent(ctx, "busy", "hi")
+	c.CallAgent(ctx, "broken", "hi")
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	c.CallAgent(cancelled, "vm", "hi")
+
+	st := c.Stats()
+	if st.Since.IsZero() || st.Since.After(time.Now()) {
+		t.Errorf("Since = %v", st.Since)
+	}
+	vm := st.Agents["vm"]
+	if vm.Calls != 4 || vm.Errors != 1 || vm.ErrorKinds["canceled"] != 1 {
+		t.Errorf("vm = %+v", vm)
+	}
+	if vm.BytesIn.Max < 100 || vm.BytesIn.Total < 300 || vm.BytesOut.P50 == 0 || vm.Latency.Max <= 0 || vm.Latency.P99 > vm.Latency.Max {
+		t.Errorf("vm sizes and latency = %+v", vm)
+	}
+	if k := st.Agents["busy"].ErrorKinds; k["rate_limited"] != 1 {
+		t.Errorf("busy errors = %v", k)
+	}
+	if k := st.Agents["broken"].ErrorKinds; k["http_500"] != 1 {
+		t.Errorf("broken errors = %v", k)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for v := 1; v <= 1000; v++ {
+		h.observe(float64(v))
+	}
+	for _, tc := range []struct{ q, want float64 }{{0.5, 500}, {0.95, 950}, {0.99, 990}} {
+		if got := h.quantile(tc.q); math.Abs(got-tc.want)/tc.want > 0.05 {
+			t.Errorf("quantile(%v) = %v, want %v within 5%%", tc.q, got, tc.want)
+		}
+	}
+	if s := h.sizes(); s.Total != 500500 || s.Mean != 501 || s.Max != 1000 {
+		t.Errorf("sizes = %+v", s)
+	}
+	var empty histogram
+	if empty.quantile(0.5) != 0 || empty.mean() != 0 {
+		t.Error("empty histogram reports values")
+	}
+}
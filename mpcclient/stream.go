@@ -0,0 +1,315 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultStreamRetry is the reconnect delay used until the server sends a
+// retry field.
+const defaultStreamRetry = 250 * time.Millisecond
+
+// ErrStreamInterrupted is returned when a stream breaks after chunks have
+// already been delivered and cannot be resumed: the server sent no event
+// IDs, refused to resume, or the reconnects ran out.
+var ErrStreamInterrupted = errors.New("stream interrupted")
+
+// Chunk is one piece of a streamed agent response. The final chunk of a
+// stream carries a FinishReason and may have empty Text.
+type Chunk struct {
+	// ID is the server-assigned event ID, if any. An interrupted stream
+	// resumes after the last chunk with an ID.
+	ID           string `json:"-"`
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// StreamError reports a failure the server signalled partway through a
+// stream with an "error" event.
+type StreamError struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"error"`
+}
+
+func (e *StreamError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("stream error %s: %s", e.Code, e.Message)
+	}
+	return "stream error: " + e.Message
+}
+
+// callbackError marks an error returned by the caller's chunk function.
+type callbackError struct{ err error }
+
+func (e *callbackError) Error() string { return e.err.Error() }
+func (e *callbackError) Unwrap() error { return e.err }
+
+// StreamAgent sends prompt to the named agent and calls fn for each chunk
+// of the response as it arrives over text/event-stream. Returning an error
+// from fn stops the stream and StreamAgent returns that error.
+//
+// If the connection fails, the stream is re-established up to the limit
+// set with WithStreamReconnects, a limit that starts over whenever a
+// connection delivers a chunk. Once chunks have been delivered, the stream
+// resumes where it broke off: the request carries the ID of the last chunk
+// received in a Last-Event-ID header, so the server sends only the chunks
+// after it, and chunks with numeric IDs up to that one are dropped should
+// the server replay them. A stream that breaks after delivery without any
+// event IDs to resume from, or whose resumption the server refuses, yields
+// an error wrapping ErrStreamInterrupted. Timeouts set
+// with WithTimeout or WithRequestTimeout, or a Budget's Total, bound the
+// whole stream, reconnects included; a Budget's StreamIdle drops
+// connections that go quiet.
+func (c *Client) StreamAgent(ctx context.Context, agentName, prompt string, fn func(Chunk) error, opts ...CallOption) error {
+	return c.stream(ctx, agentName, AgentRequest{Prompt: prompt}, fn, opts)
+}
+
+// stream is StreamAgent for a fully specified request.
+func (c *Client) stream(ctx context.Context, agentName string, req AgentRequest, fn func(Chunk) error, opts []CallOption) error {
+	if agentName == "" {
+		agentName = c.defaultAgent
+	}
+	if agentName == "" {
+		return errors.New("mpcclient: agent name is required")
+	}
+	ctx = ensureRequestID(ctx)
+	req = c.redactOutgoing(c.callOptions(opts).request(req))
+	ctx, end := c.instrument(ctx, "stream_agent", agentName)
+	start := time.Now()
+	var text strings.Builder
+	if len(c.hooks) > 0 {
+		next := fn
+		fn = func(ch Chunk) error {
+			text.WriteString(ch.Text)
+			return next(ch)
+		}
+	}
+	done, err := c.breakers.allow(agentName)
+	if err == nil {
+		err = c.streamAgent(ctx, agentName, req, fn, opts)
+		done(err)
+	}
+	end(nil, err)
+	c.logCall(ctx, "mpcclient: agent stream", agentName, req.Prompt, start, nil, err)
+	ex := Exchange{Agent: agentName, Prompt: req.Prompt, Err: err, Streamed: true, Start: start, TimeToFirstChunk: firstChunkTime(ctx)}
+	if err == nil {
+		ex.Response = &AgentResponse{Agent: agentName, Result: text.String()}
+	}
+	c.observe(ctx, ex)
+	return err
+}
+
+func (c *Client) streamAgent(ctx context.Context, agentName string, req AgentRequest, fn func(Chunk) error, opts []CallOption) error {
+	ctx, cancel := c.callOptions(opts).context(ctx)
+	defer cancel()
+
+	body, err := encodeBody(req)
+	if err != nil {
+		return fmt.Errorf("mpcclient: stream agent %q: %w", agentName, err)
+	}
+	path := "/agent/" + url.PathEscape(agentName) + "/stream"
+	s := &stream{fn: fn, retry: defaultStreamRetry, start: time.Now(), ctx: ctx}
+	for attempt := 0; ; attempt++ {
+		s.progressed = false
+		resuming := s.lastID != ""
+		err := c.streamOnce(ctx, path, body, s)
+		if err == nil {
+			return nil
+		}
+		var cbErr *callbackError
+		if errors.As(err, &cbErr) {
+			return cbErr.err
+		}
+		if s.progressed {
+			attempt = 0
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else if reconnectable(err) && s.resumable() && attempt < c.streamReconnects {
+			if werr := sleepCtx(ctx, s.retry); werr == nil {
+				continue
+			}
+			err = ctx.Err()
+		} else if s.delivered && reconnectable(err) {
+			err = fmt.Errorf("%w: %w", ErrStreamInterrupted, err)
+		} else if resuming && !s.progressed && !isStreamError(err) {
+			err = fmt.Errorf("%w: resuming after event %s: %w", ErrStreamInterrupted, s.lastID, err)
+		}
+		return fmt.Errorf("mpcclient: stream agent %q: %w", agentName, classify(err))
+	}
+}
+
+// stream carries state across the connections making up one StreamAgent call.
+type stream struct {
+	fn    func(Chunk) error
+	retry time.Duration
+	// delivered records whether any chunk reached fn, and progressed
+	// whether one did on the current connection.
+	delivered, progressed bool
+	// lastID is the ID of the last chunk delivered that had one.
+	lastID string
+	// start is when the stream was requested, and gotText whether a
+	// chunk with text has arrived since, timed as the call's first chunk
+	// under ctx.
+	start   time.Time
+	gotText bool
+	ctx     context.Context
+}
+
+// resumable reports whether the stream can be re-established without
+// delivering chunks twice.
+func (s *stream) resumable() bool {
+	return !s.delivered || s.lastID != ""
+}
+
+// seen reports whether an event with id was delivered already, as when a
+// server replays a stream it was asked to resume. Only numeric IDs are
+// ordered.
+func (s *stream) seen(id string) bool {
+	if id == "" || s.lastID == "" {
+		return false
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	last, lerr := strconv.ParseUint(s.lastID, 10, 64)
+	return err == nil && lerr == nil && n <= last
+}
+
+// streamOnce opens one connection and consumes events until the stream
+// finishes, fails, or the connection drops. Under a StreamIdle budget the
+// connection is dropped when neither an event nor a heartbeat comment
+// arrives in time.
+func (c *Client) streamOnce(ctx context.Context, path string, body []byte, s *stream) error {
+	idle := budgetFrom(ctx).StreamIdle
+	keepAlive := func() {}
+	if idle > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		timer := time.AfterFunc(idle, func() { cancel(ErrStreamIdle) })
+		defer timer.Stop()
+		keepAlive = func() { timer.Reset(idle) }
+	}
+	err := c.consumeStream(ctx, path, body, s, keepAlive)
+	if err != nil && context.Cause(ctx) == ErrStreamIdle {
+		return fmt.Errorf("no event for %v: %w", idle, ErrStreamIdle)
+	}
+	return err
+}
+
+// consumeStream is streamOnce without the idle timeout, calling keepAlive
+// on every event and comment.
+func (c *Client) consumeStream(ctx context.Context, path string, body []byte, s *stream, keepAlive func()) error {
+	req, err := c.newRequest(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if s.lastID != "" {
+		req.Header.Set("Last-Event-ID", s.lastID)
+	}
+	res, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt != "text/event-stream" {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, maxSnippet))
+		return newContentTypeError(res, "an event stream", b)
+	}
+
+	events := newEventReader(res.Body)
+	events.heartbeat = keepAlive
+	for {
+		ev, err := events.Next()
+		if err == io.EOF {
+			return fmt.Errorf("stream ended before completion: %w", io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+		keepAlive()
+		if events.retry > 0 {
+			s.retry = events.retry
+		}
+		switch ev.Type {
+		case "error":
+			se := &StreamError{}
+			if json.Unmarshal([]byte(ev.Data), se) != nil || se.Message == "" {
+				se.Message = ev.Data
+			}
+			return se
+		case "done":
+			if s.seen(ev.ID) {
+				continue
+			}
+			ch := Chunk{ID: ev.ID}
+			_ = json.Unmarshal([]byte(ev.Data), &ch)
+			if ch.FinishReason == "" {
+				ch.FinishReason = "stop"
+			}
+			return s.emit(ch)
+		case "message", "chunk":
+			if s.seen(ev.ID) {
+				continue
+			}
+			ch := Chunk{ID: ev.ID}
+			if json.Unmarshal([]byte(ev.Data), &ch) != nil {
+				ch.Text = ev.Data
+			}
+			if err := s.emit(ch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *stream) emit(ch Chunk) error {
+	s.delivered, s.progressed = true, true
+	if !s.gotText && ch.Text != "" {
+		s.gotText = true
+		recordFirstChunk(s.ctx, time.Since(s.start))
+	}
+	if ch.ID != "" {
+		s.lastID = ch.ID
+	}
+	if err := s.fn(ch); err != nil {
+		return &callbackError{err: err}
+	}
+	return nil
+}
+
+// reconnectable reports whether err is a transport-level failure worth
+// re-establishing the stream for, as opposed to a server or protocol answer.
+func reconnectable(err error) bool {
+	var apiErr *APIError
+	return !errors.As(err, &apiErr) && !isStreamError(err) && !errors.Is(err, ErrUnexpectedContentType) &&
+		!errors.Is(err, ErrDryRun)
+}
+
+// isStreamError reports whether err is an error event of the stream.
+func isStreamError(err error) bool {
+	var streamErr *StreamError
+	return errors.As(err, &streamErr)
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
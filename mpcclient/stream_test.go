@@ -0,0 +1,172 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func sseHandler(t *testing.T, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent/writer/stream" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Accept"); got != "text/event-stream" {
+			t.Errorf("Accept = %q", got)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, body)
+	}
+}
+
+func collect(c *Client) (string, []Chunk, error) {
+	var sb strings.Builder
+	var chunks []Chunk
+	err := c.StreamAgent(context.Background(), "writer", "hello", func(ch Chunk) error {
+		sb.WriteString(ch.Text)
+		chunks = append(chunks, ch)
+		return nil
+	})
+	return sb.String(), chunks, err
+}
+
+func TestStreamAgent(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, ""+
+		": comment\n\n"+
+		"id: 1\ndata: {\"text\":\"Hel\"}\n\n"+
+		"id: 2\nevent: chunk\ndata: {\"text\":\"lo\"}\n\n"+
+		"event: done\ndata: {\"finish_reason\":\"length\"}\n\n"))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	text, chunks, err := collect(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Hello" {
+		t.Errorf("text = %q", text)
+	}
+	if len(chunks) != 3 || chunks[0].ID != "1" || chunks[2].FinishReason != "length" {
+		t.Errorf("chunks = %+v", chunks)
+	}
+}
+
+func TestStreamAgentErrorEvent(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, "data: partial\n\nevent: error\ndata: {\"code\":\"agent_failed\",\"error\":\"boom\"}\n\n"))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	text, _, err := collect(c)
+	var se *StreamError
+	if !errors.As(err, &se) || se.Code != "agent_failed" || se.Message != "boom" {
+		t.Fatalf("err = %v, want StreamError", err)
+	}
+	if text != "partial" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestStreamAgentReconnectsBeforeFirstChunk(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if calls.Add(1) == 1 {
+			fmt.Fprint(w, "retry: 1\n\n")
+			return
+		}
+		fmt.Fprint(w, "data: ok\n\nevent: done\ndata:\n\n")
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	text, _, err := collect(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "ok" || calls.Load() != 2 {
+		t.Errorf("text = %q after %d calls", text, calls.Load())
+	}
+}
+
+func TestStreamAgentInterruptedAfterDelivery(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, "data: part\n\n"))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	_, _, err := collect(c)
+	if !errors.Is(err, ErrStreamInterrupted) {
+		t.Fatalf("err = %v, want ErrStreamInterrupted", err)
+	}
+}
+
+func TestStreamAgentResumes(t *testing.T) {
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		switch len(lastIDs) {
+		case 1:
+			fmt.Fprint(w, "id: 1\ndata: a\n\nid: 2\ndata: b\n\n")
+		case 2:
+			fmt.Fprint(w, "id: 3\ndata: c\n\n")
+		case 3:
+			// A server replaying the stream from the start.
+			fmt.Fprint(w, "id: 1\ndata: a\n\nid: 2\ndata: b\n\nid: 3\ndata: c\n\nid: 4\ndata: d\n\nid: 5\nevent: done\ndata:\n\n")
+		}
+	}))
+	defer srv.Close()
+
+	// Each connection delivers a chunk, so a reconnect limit of one lasts
+	// the whole stream.
+	c, _ := NewClient(srv.URL, WithStreamReconnects(1))
+	text, chunks, err := collect(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "abcd" || len(chunks) != 5 {
+		t.Errorf("text = %q in %d chunks", text, len(chunks))
+	}
+	if fmt.Sprint(lastIDs) != "[ 2 3]" {
+		t.Errorf("Last-Event-ID = %q", lastIDs)
+	}
+}
+
+func TestStreamAgentResumeRefused(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			http.Error(w, `{"error":"stream expired","code":"stream_expired"}`, http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 1\ndata: a\n\n")
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(srv.URL)
+	text, _, err := collect(c)
+	var apiErr *APIError
+	if !errors.Is(err, ErrStreamInterrupted) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusGone {
+		t.Fatalf("err = %v, want interrupted by 410", err)
+	}
+	if text != "a" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestStreamAgentCallbackError(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, "data: a\n\ndata: b\n\nevent: done\ndata:\n\n"))
+	defer srv.Close()
+
+	stop := errors.New("stop")
+	c, _ := NewClient(srv.URL)
+	err := c.StreamAgent(context.Background(), "writer", "hello", func(Chunk) error { return stop })
+	if err != stop {
+		t.Fatalf("err = %v, want callback error", err)
+	}
+}
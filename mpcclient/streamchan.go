@@ -0,0 +1,47 @@
+package mpcclient
+
+import "context"
+
+// StreamAgentChan is StreamAgent for consumers that prefer channels, as in
+// a select loop. It starts the stream in a goroutine of its own and returns
+// at once.
+//
+// Chunks arrive on the first channel, in order. When the stream ends, for
+// whatever reason, that channel is closed, and then the second one
+// receives exactly one value, the stream's error or nil on success, and
+// is closed too. Both channels are therefore always closed, and reading
+// the chunks until the channel closes and then the error never blocks for
+// good:
+//
+//	chunks, errc := c.StreamAgentChan(ctx, "writer", prompt)
+//	for ch := range chunks {
+//		fmt.Print(ch.Text)
+//	}
+//	if err := <-errc; err != nil {
+//		return err
+//	}
+//
+// The chunk channel is unbuffered, so the stream applies backpressure: it
+// reads no further from the server until the previous chunk has been
+// received. A consumer that stops reading before the stream ends must
+// cancel ctx, which abandons the stream and releases its goroutine; the
+// error is then ctx's error. Reconnects, timeouts and budgets behave as
+// in StreamAgent.
+func (c *Client) StreamAgentChan(ctx context.Context, agentName, prompt string, opts ...CallOption) (<-chan Chunk, <-chan error) {
+	chunks := make(chan Chunk)
+	errc := make(chan error, 1)
+	go func() {
+		err := c.StreamAgent(ctx, agentName, prompt, func(ch Chunk) error {
+			select {
+			case chunks <- ch:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+		close(chunks)
+		errc <- err
+		close(errc)
+	}()
+	return chunks, errc
+}
@@ -0,0 +1,74 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamAgentChan(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, linesStream))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	chunks, errc := c.StreamAgentChan(context.Background(), "writer", "hello")
+	var text string
+	for ch := range chunks {
+		text += ch.Text
+	}
+	if text != "one\ntwo\nthree" {
+		t.Errorf("text = %q", text)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-errc; ok {
+		t.Error("error channel not closed")
+	}
+}
+
+func TestStreamAgentChanError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"agent_not_found","message":"no agent writer"}}`))
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	chunks, errc := c.StreamAgentChan(context.Background(), "writer", "hello")
+	if _, ok := <-chunks; ok {
+		t.Error("got a chunk from a failed stream")
+	}
+	if err := <-errc; !errors.Is(err, ErrAgentNotFound) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestStreamAgentChanCancelUnblocks(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, linesStream))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, errc := c.StreamAgentChan(ctx, "writer", "hello")
+	// Take one chunk and stop reading: the stream waits on the next send
+	// until the context is cancelled.
+	if ch := <-chunks; ch.Text != "one\ntw" {
+		t.Errorf("first chunk = %+v", ch)
+	}
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not released by cancellation")
+	}
+	for range chunks {
+	}
+}
@@ -0,0 +1,158 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// FlushMode sets when StreamAgentTo flushes its writer, for writers that
+// buffer, such as a bufio.Writer or an http.ResponseWriter.
+type FlushMode int
+
+const (
+	// FlushChunks flushes after every write, so that each chunk is seen
+	// as soon as it arrives. It is the default.
+	FlushChunks FlushMode = iota
+	// FlushLines flushes after writes that complete a line, so that
+	// output is seen a line at a time.
+	FlushLines
+	// FlushEnd flushes once, when the stream ends.
+	FlushEnd
+)
+
+// WithFlush sets when StreamAgentTo flushes its writer.
+func WithFlush(m FlushMode) CallOption {
+	return func(o *callOptions) {
+		o.flush = m
+	}
+}
+
+// WithLineBuffering makes StreamAgentTo write whole lines only, holding
+// back the text after the last newline until the line is complete or the
+// stream ends. It suits line-oriented consumers such as log shippers.
+func WithLineBuffering() CallOption {
+	return func(o *callOptions) {
+		o.lineBuffered = true
+	}
+}
+
+// StreamSummary reports a stream written out by StreamAgentTo.
+type StreamSummary struct {
+	// Bytes is the number of bytes written to the writer.
+	Bytes int64
+	// Chunks is the number of chunks received.
+	Chunks int
+	// Duration is how long the stream took, from the request to its end.
+	Duration time.Duration
+	// TimeToFirstChunk is how long the first text took to arrive; zero
+	// if none did.
+	TimeToFirstChunk time.Duration
+	// FinishReason is that of the final chunk; it is empty when the stream
+	// did not finish.
+	FinishReason string
+}
+
+// StreamAgentTo streams the named agent's response to prompt into w as it
+// arrives, as StreamAgent does with a callback, and reports what it wrote.
+// WithFlush sets when w is flushed, if it has a Flush method, and
+// WithLineBuffering holds back partial lines. Text held back is written
+// when the stream ends, whether or not it fails, and the summary counts
+// what was written even when an error is returned. A failed write stops
+// the stream.
+func (c *Client) StreamAgentTo(ctx context.Context, agentName, prompt string, w io.Writer, opts ...CallOption) (StreamSummary, error) {
+	o := c.callOptions(opts)
+	start := time.Now()
+	sw := &streamWriter{w: w, flush: o.flush, lines: o.lineBuffered, start: start}
+	err := c.stream(ctx, agentName, AgentRequest{Prompt: prompt}, sw.chunk, opts)
+	if werr := sw.close(); werr != nil && err == nil {
+		err = werr
+	}
+	sw.summary.Duration = time.Since(start)
+	if sw.werr != nil && err == sw.werr {
+		err = fmt.Errorf("mpcclient: stream agent %q: write: %w", agentName, err)
+	}
+	return sw.summary, err
+}
+
+// streamWriter writes the chunks of a stream to w.
+type streamWriter struct {
+	w       io.Writer
+	flush   FlushMode
+	lines   bool
+	start   time.Time
+	pending bytes.Buffer
+	summary StreamSummary
+	// werr is the first error writing to or flushing w.
+	werr error
+}
+
+func (sw *streamWriter) chunk(ch Chunk) error {
+	sw.summary.Chunks++
+	if ch.FinishReason != "" {
+		sw.summary.FinishReason = ch.FinishReason
+	}
+	if ch.Text == "" {
+		return nil
+	}
+	if sw.summary.TimeToFirstChunk == 0 {
+		sw.summary.TimeToFirstChunk = time.Since(sw.start)
+	}
+	text := []byte(ch.Text)
+	if sw.lines {
+		sw.pending.Write(text)
+		b := sw.pending.Bytes()
+		i := bytes.LastIndexByte(b, '\n')
+		if i < 0 {
+			return nil
+		}
+		text = bytes.Clone(b[:i+1])
+		sw.pending.Next(i + 1)
+	}
+	if err := sw.write(text); err != nil {
+		return err
+	}
+	if sw.flush == FlushChunks || sw.flush == FlushLines && bytes.IndexByte(text, '\n') >= 0 {
+		return sw.flushWriter()
+	}
+	return nil
+}
+
+// close writes the text held back and flushes w.
+func (sw *streamWriter) close() error {
+	if sw.werr != nil {
+		return sw.werr
+	}
+	if sw.pending.Len() > 0 {
+		if err := sw.write(sw.pending.Bytes()); err != nil {
+			return err
+		}
+		sw.pending.Reset()
+	}
+	return sw.flushWriter()
+}
+
+func (sw *streamWriter) write(b []byte) error {
+	n, err := sw.w.Write(b)
+	sw.summary.Bytes += int64(n)
+	if err != nil {
+		sw.werr = err
+	}
+	return err
+}
+
+func (sw *streamWriter) flushWriter() error {
+	switch f := sw.w.(type) {
+	case interface{ Flush() error }:
+		if err := f.Flush(); err != nil {
+			sw.werr = err
+			return err
+		}
+	case http.Flusher:
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// flushRecorder records each write, and marks flushes with "|".
+type flushRecorder struct {
+	ops []string
+	err error
+}
+
+func (r *flushRecorder) Write(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.ops = append(r.ops, string(p))
+	return len(p), nil
+}
+
+func (r *flushRecorder) Flush() error {
+	r.ops = append(r.ops, "|")
+	return nil
+}
+
+const linesStream = "" +
+	"data: {\"text\":\"one\\ntw\"}\n\n" +
+	"data: {\"text\":\"o\"}\n\n" +
+	"data: {\"text\":\"\\nthr\"}\n\n" +
+	"event: done\ndata: {\"text\":\"ee\",\"finish_reason\":\"stop\"}\n\n"
+
+func TestStreamAgentTo(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []CallOption
+		want []string
+	}{
+		{"chunks", nil, []string{"one\ntw", "|", "o", "|", "\nthr", "|", "ee", "|", "|"}},
+		{"lines", []CallOption{WithFlush(FlushLines)}, []string{"one\ntw", "|", "o", "\nthr", "|", "ee", "|"}},
+		{"end", []CallOption{WithFlush(FlushEnd)}, []string{"one\ntw", "o", "\nthr", "ee", "|"}},
+		{"line buffered", []CallOption{WithLineBuffering(), WithFlush(FlushLines)}, []string{"one\n", "|", "two\n", "|", "three", "|"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(sseHandler(t, linesStream))
+			defer srv.Close()
+			c, _ := NewClient(srv.URL)
+
+			var w flushRecorder
+			sum, err := c.StreamAgentTo(context.Background(), "writer", "hello", &w, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(w.ops, tt.want) {
+				t.Errorf("writes = %q, want %q", w.ops, tt.want)
+			}
+			if sum.Bytes != int64(len("one\ntwo\nthree")) || sum.Chunks != 4 || sum.FinishReason != "stop" || sum.Duration <= 0 {
+				t.Errorf("summary = %+v", sum)
+			}
+		})
+	}
+}
+
+func TestStreamAgentToPlainWriter(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, linesStream))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	var sb strings.Builder
+	if _, err := c.StreamAgentTo(context.Background(), "writer", "hello", &sb, WithLineBuffering()); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "one\ntwo\nthree" {
+		t.Errorf("wrote %q", sb.String())
+	}
+}
+
+func TestStreamAgentToWriteError(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, linesStream))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	errFull := errors.New("disk full")
+	sum, err := c.StreamAgentTo(context.Background(), "writer", "hello", &flushRecorder{err: errFull})
+	if !errors.Is(err, errFull) || !strings.Contains(err.Error(), "write") {
+		t.Fatalf("err = %v, want the write error", err)
+	}
+	if sum.Bytes != 0 || sum.Chunks != 1 || sum.FinishReason != "" {
+		t.Errorf("summary = %+v", sum)
+	}
+}
+
+func TestStreamAgentToWritesHeldBackTextOnError(t *testing.T) {
+	srv := httptest.NewServer(sseHandler(t, "data: {\"text\":\"partial\"}\n\nevent: error\ndata: {\"error\":\"boom\"}\n\n"))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	var sb strings.Builder
+	sum, err := c.StreamAgentTo(context.Background(), "writer", "hello", &sb, WithLineBuffering())
+	var se *StreamError
+	if !errors.As(err, &se) {
+		t.Fatalf("err = %v, want a StreamError", err)
+	}
+	if sb.String() != "partial" || sum.Bytes != 7 {
+		t.Errorf("wrote %q (%d bytes), want the partial line", sb.String(), sum.Bytes)
+	}
+}
@@ -0,0 +1,217 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the client's tracer and meter.
+const instrumentationName = "github.com/olafkfreund/ai_team_workshop/mpcclient"
+
+// Attribute keys recorded on spans and metrics.
+const (
+	attrAgent            = attribute.Key("mpc.agent.name")
+	attrOutcome          = attribute.Key("mpc.call.outcome")
+	attrStatus           = attribute.Key("mpc.response.status")
+	attrRequestID        = attribute.Key("mpc.request.id")
+	attrRetries          = attribute.Key("mpc.retry.count")
+	attrPromptTokens     = attribute.Key("mpc.usage.prompt_tokens")
+	attrCompletionTokens = attribute.Key("mpc.usage.completion_tokens")
+	attrTotalTokens      = attribute.Key("mpc.usage.total_tokens")
+	attrTokenType        = attribute.Key("mpc.token.type")
+	attrHTTPStatus       = attribute.Key("http.response.status_code")
+	attrFirstChunk       = attribute.Key("mpc.stream.time_to_first_chunk_ms")
+)
+
+// WithTracerProvider sets where call spans are recorded. It defaults to the
+// global provider from otel.GetTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets where call metrics are recorded. It defaults to the
+// global provider from otel.GetMeterProvider.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *Client) {
+		c.meterProvider = mp
+	}
+}
+
+// WithPropagator sets how trace context is injected into outgoing requests.
+// It defaults to W3C Trace Context and Baggage headers.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *Client) {
+		if p != nil {
+			c.propagator = p
+		}
+	}
+}
+
+// telemetry holds the client's OpenTelemetry instruments.
+type telemetry struct {
+	tracer   trace.Tracer
+	calls    metric.Int64Counter
+	duration metric.Float64Histogram
+	tokens   metric.Int64Counter
+	// firstChunk records how long streams take to deliver text.
+	firstChunk metric.Float64Histogram
+}
+
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) (telemetry, error) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+	t := telemetry{tracer: tp.Tracer(instrumentationName)}
+	var err, e error
+	t.calls, e = meter.Int64Counter("mpc.client.calls",
+		metric.WithDescription("Agent calls made, by agent and outcome."),
+		metric.WithUnit("{call}"))
+	err = errors.Join(err, e)
+	t.duration, e = meter.Float64Histogram("mpc.client.call.duration",
+		metric.WithDescription("Duration of agent calls, including retries."),
+		metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	t.tokens, e = meter.Int64Counter("mpc.client.tokens",
+		metric.WithDescription("Tokens reported by agents, by token type."),
+		metric.WithUnit("{token}"))
+	err = errors.Join(err, e)
+	t.firstChunk, e = meter.Float64Histogram("mpc.client.stream.time_to_first_chunk",
+		metric.WithDescription("Time from the start of a stream to its first text, reconnects included."),
+		metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	if err != nil {
+		return telemetry{}, fmt.Errorf("mpcclient: create metrics: %w", err)
+	}
+	return t, nil
+}
+
+// callStats collects per-call figures reported by lower layers.
+type callStats struct {
+	attempts atomic.Int64
+	// firstChunk is the time a stream took to deliver text, in
+	// nanoseconds, or zero.
+	firstChunk atomic.Int64
+	// bytesOut and bytesIn are the sizes of the bodies sent and read.
+	bytesOut, bytesIn atomic.Int64
+}
+
+type callStatsKey struct{}
+
+// countAttempt records an HTTP attempt against the call ctx belongs to.
+func countAttempt(ctx context.Context) {
+	if st, ok := ctx.Value(callStatsKey{}).(*callStats); ok {
+		st.attempts.Add(1)
+	}
+}
+
+// recordFirstChunk records how long the stream ctx belongs to took to
+// deliver text.
+func recordFirstChunk(ctx context.Context, d time.Duration) {
+	if st, ok := ctx.Value(callStatsKey{}).(*callStats); ok {
+		st.firstChunk.Store(int64(d))
+	}
+}
+
+// firstChunkTime returns what recordFirstChunk recorded for ctx's call.
+func firstChunkTime(ctx context.Context) time.Duration {
+	if st, ok := ctx.Value(callStatsKey{}).(*callStats); ok {
+		return time.Duration(st.firstChunk.Load())
+	}
+	return 0
+}
+
+// instrument starts a span for one agent call and returns the context to
+// run it under, along with a function that ends the span and records
+// metrics for the outcome.
+func (c *Client) instrument(ctx context.Context, op, agentName string) (context.Context, func(*AgentResponse, error)) {
+	st := &callStats{}
+	ctx = context.WithValue(ctx, callStatsKey{}, st)
+	ctx, span := c.tel.tracer.Start(ctx, op+" "+agentName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrAgent.String(agentName), attrRequestID.String(RequestIDFromContext(ctx))))
+	start := time.Now()
+
+	return ctx, func(resp *AgentResponse, err error) {
+		elapsed := time.Since(start)
+		metricAttrs := []attribute.KeyValue{attrAgent.String(agentName)}
+		span.SetAttributes(attrRetries.Int64(max(st.attempts.Load()-1, 0)))
+		if fc := time.Duration(st.firstChunk.Load()); fc > 0 {
+			span.SetAttributes(attrFirstChunk.Int64(fc.Milliseconds()))
+			c.tel.firstChunk.Record(ctx, fc.Seconds(), metric.WithAttributes(attrAgent.String(agentName)))
+		}
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			metricAttrs = append(metricAttrs, attrOutcome.String("error"))
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				span.SetAttributes(attrHTTPStatus.Int(apiErr.StatusCode))
+				metricAttrs = append(metricAttrs, attrHTTPStatus.Int(apiErr.StatusCode))
+			}
+		} else {
+			metricAttrs = append(metricAttrs, attrOutcome.String("success"))
+		}
+		if resp != nil {
+			span.SetAttributes(attrStatus.String(resp.Status), attrRequestID.String(resp.RequestID))
+			if u := resp.Usage; u != nil {
+				span.SetAttributes(
+					attrPromptTokens.Int(u.PromptTokens),
+					attrCompletionTokens.Int(u.CompletionTokens),
+					attrTotalTokens.Int(u.TotalTokens),
+				)
+				c.tel.tokens.Add(ctx, int64(u.PromptTokens),
+					metric.WithAttributes(attrAgent.String(agentName), attrTokenType.String("prompt")))
+				c.tel.tokens.Add(ctx, int64(u.CompletionTokens),
+					metric.WithAttributes(attrAgent.String(agentName), attrTokenType.String("completion")))
+			}
+		}
+		span.End()
+		c.stats.record(agentName, elapsed, st.bytesOut.Load(), st.bytesIn.Load(), err)
+
+		set := metric.WithAttributes(metricAttrs...)
+		c.tel.calls.Add(ctx, 1, set)
+		c.tel.duration.Record(ctx, elapsed.Seconds(), set)
+	}
+}
+
+// traceInterceptor counts each attempt and the bytes of its bodies
+// against the call's span and statistics, and propagates its trace
+// context in the request headers.
+func (c *Client) traceInterceptor(next Handler) Handler {
+	return HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		countAttempt(req.Context())
+		c.injectTrace(req.Context(), req)
+		st, ok := req.Context().Value(callStatsKey{}).(*callStats)
+		if ok && req.ContentLength > 0 {
+			st.bytesOut.Add(req.ContentLength)
+		}
+		res, err := next.Do(req)
+		if ok && err == nil {
+			res.Body = countingBody{ReadCloser: res.Body, st: st}
+		}
+		return res, err
+	})
+}
+
+// injectTrace propagates the trace context of ctx in req's headers.
+func (c *Client) injectTrace(ctx context.Context, req *http.Request) {
+	c.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
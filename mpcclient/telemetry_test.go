@@ -0,0 +1,115 @@
+package mpcclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetry(t *testing.T) {
+	var calls atomic.Int32
+	var traceparent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get("Traceparent"))
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/agent/broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"nope"}`))
+			return
+		}
+		w.Write([]byte(`{"result":"ok","status":"success","request_id":"req-1","usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`))
+	}))
+	defer srv.Close()
+
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	c, err := NewClient(srv.URL,
+		WithTracerProvider(tp),
+		WithMeterProvider(mp),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryableStatus: []int{503}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(context.Background(), "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(context.Background(), "broken", "hi"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("got %d spans, want 2", len(ended))
+	}
+	ok, failed := ended[0], ended[1]
+	if ok.Name() != "call_agent echo" {
+		t.Errorf("span name = %q", ok.Name())
+	}
+	want := map[attribute.Key]attribute.Value{
+		attrAgent:        attribute.StringValue("echo"),
+		attrRetries:      attribute.Int64Value(1),
+		attrStatus:       attribute.StringValue("success"),
+		attrRequestID:    attribute.StringValue("req-1"),
+		attrTotalTokens:  attribute.IntValue(8),
+		attrPromptTokens: attribute.IntValue(3),
+	}
+	got := map[attribute.Key]attribute.Value{}
+	for _, kv := range ok.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("span attribute %s = %v, want %v", k, got[k].Emit(), v.Emit())
+		}
+	}
+	if failed.Status().Code != codes.Error {
+		t.Errorf("failed span status = %v", failed.Status())
+	}
+
+	header, _ := traceparent.Load().(string)
+	if want := failed.SpanContext().TraceID().String(); len(header) < 36 || header[3:35] != want {
+		t.Errorf("traceparent = %q, want trace ID %s", header, want)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			found[m.Name] = true
+			if m.Name == "mpc.client.calls" {
+				var total int64
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					total += dp.Value
+				}
+				if total != 2 {
+					t.Errorf("mpc.client.calls = %d, want 2", total)
+				}
+			}
+		}
+	}
+	for _, name := range []string{"mpc.client.calls", "mpc.client.call.duration", "mpc.client.tokens"} {
+		if !found[name] {
+			t.Errorf("metric %s not recorded", name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mpcclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// TLSConfig configures how the client's HTTP transport verifies servers
+// and authenticates to them.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of root certificates, such as a corporate CA,
+	// trusted in addition to the system's.
+	CAFile string
+	// CAPEM holds further PEM root certificates, for bundles not stored in
+	// a file.
+	CAPEM []byte
+	// CertFile and KeyFile are a PEM client certificate and its private
+	// key, presented to servers that require mutual TLS. Set both or
+	// neither.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify accepts any server certificate, leaving
+	// connections open to interception. It is meant only for test servers
+	// with self-signed certificates; the client logs a warning when it is
+	// set.
+	InsecureSkipVerify bool
+}
+
+// WithTLS configures TLS for the client's HTTP transport, including
+// WebSocket connections. It cannot be combined with WithHTTPClient, whose
+// transport the caller configures.
+func WithTLS(cfg TLSConfig) Option {
+	return func(c *Client) {
+		c.tls = &cfg
+	}
+}
+
+// WithProxy sends the client's HTTP requests through the proxy at
+// proxyURL, an http, https or socks5 URL that may carry credentials.
+// Without it, the transport uses the proxy named by the HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables. It cannot be combined
+// with WithHTTPClient.
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) {
+		c.proxy = &proxyURL
+	}
+}
+
+// configureTransport applies the client's proxy and TLS settings to t.
+func (c *Client) configureTransport(t *http.Transport) error {
+	if c.proxy != nil {
+		u, err := url.Parse(*c.proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return errors.New("mpcclient: proxy must be an http, https or socks5 URL")
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if c.tls != nil {
+		cfg, err := c.tls.build()
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig = cfg
+		if cfg.InsecureSkipVerify {
+			logger := c.logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			logger.Warn("mpcclient: TLS certificate verification is disabled; connections can be intercepted",
+				slog.String("server", c.baseURL.Redacted()))
+		}
+	}
+	return nil
+}
+
+func (cfg *TLSConfig) build() (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" || len(cfg.CAPEM) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("mpcclient: read CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("mpcclient: no certificates in CA bundle %s", cfg.CAFile)
+			}
+		}
+		if len(cfg.CAPEM) > 0 && !pool.AppendCertsFromPEM(cfg.CAPEM) {
+			return nil, errors.New("mpcclient: no certificates in CAPEM")
+		}
+		tc.RootCAs = pool
+	}
+	switch {
+	case cfg.CertFile != "" && cfg.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("mpcclient: load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		return nil, errors.New("mpcclient: client certificate needs both CertFile and KeyFile")
+	}
+	return tc, nil
+}
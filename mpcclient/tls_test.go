@@ -0,0 +1,177 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`{"agent":"a","result":"ok"}`))
+}
+
+// serverCAPEM returns the PEM certificate of a TLS test server.
+func serverCAPEM(srv *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+func TestWithTLSRootCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(okHandler))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c, _ := NewClient(srv.URL)
+	if _, err := c.CallAgent(ctx, "a", "hi"); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("call without the CA = %v, want a certificate error", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, serverCAPEM(srv), 0o644)
+	for name, cfg := range map[string]TLSConfig{
+		"file": {CAFile: caFile},
+		"pem":  {CAPEM: serverCAPEM(srv)},
+	} {
+		c, err := NewClient(srv.URL, WithTLS(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.CallAgent(ctx, "a", "hi"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestWithTLSInsecureSkipVerifyWarns(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(okHandler))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c, err := NewClient(srv.URL, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))), WithTLS(TLSConfig{InsecureSkipVerify: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "verification is disabled") {
+		t.Errorf("logs = %s", logs.String())
+	}
+}
+
+func TestWithTLSClientCertificate(t *testing.T) {
+	caCert, caKey := newTestCert(t, nil, nil)
+	clientCert, clientKey := newTestCert(t, caCert, caKey)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Raw}), 0o644)
+	der, _ := x509.MarshalECPrivateKey(clientKey)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "mpc-test-leaf" {
+			t.Error("no client certificate presented")
+		}
+		okHandler(w, r)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+	ctx := context.Background()
+
+	c, _ := NewClient(srv.URL, WithTLS(TLSConfig{CAPEM: serverCAPEM(srv)}))
+	if _, err := c.CallAgent(ctx, "a", "hi"); err == nil {
+		t.Error("call without a client certificate succeeded")
+	}
+	c, err := NewClient(srv.URL, WithTLS(TLSConfig{CAPEM: serverCAPEM(srv), CertFile: certFile, KeyFile: keyFile}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(ctx, "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestCert returns a CA certificate when parent is nil, and otherwise a
+// client certificate signed by parent.
+func newTestCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "mpc-test-leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.Subject.CommonName = "mpc-test-ca"
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestWithProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		okHandler(w, r)
+	}))
+	defer proxy.Close()
+
+	c, err := NewClient("http://mpc.internal:8080", WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(context.Background(), "a", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "http://mpc.internal:8080/agent/a" {
+		t.Errorf("proxy received %q", proxied)
+	}
+}
+
+func TestTransportOptionErrors(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"proxy scheme":   {WithProxy("ftp://proxy:21")},
+		"proxy host":     {WithProxy("http://")},
+		"missing CA":     {WithTLS(TLSConfig{CAFile: filepath.Join(t.TempDir(), "none.pem")})},
+		"empty CA":       {WithTLS(TLSConfig{CAPEM: []byte("not a certificate")})},
+		"cert, no key":   {WithTLS(TLSConfig{CertFile: "client.pem"})},
+		"own HTTPClient": {WithHTTPClient(&http.Client{}), WithProxy("http://proxy:3128")},
+	} {
+		if _, err := NewClient("https://mpc.internal", opts...); err == nil {
+			t.Errorf("%s: NewClient succeeded", name)
+		}
+	}
+}
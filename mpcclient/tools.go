@@ -0,0 +1,147 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxToolRounds bounds how many times InvokeWithTools answers tool
+// calls before giving up.
+const DefaultMaxToolRounds = 8
+
+// ErrToolRounds is returned by InvokeWithTools when the agent keeps asking
+// for tools after the maximum number of rounds.
+var ErrToolRounds = errors.New("too many tool call rounds")
+
+// Tool is a Go function the agent may call while answering a request.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the tool's arguments.
+	Parameters json.RawMessage
+	Handler    ToolHandler
+}
+
+// ToolHandler runs a tool call. Its result is marshalled to JSON and sent
+// back to the agent; a returned error is reported to the agent as the
+// call's outcome rather than ending the request.
+type ToolHandler func(ctx context.Context, call ToolCall) (any, error)
+
+// ToolFunc returns a handler decoding the call's arguments into A before
+// calling fn.
+func ToolFunc[A any](fn func(ctx context.Context, args A) (any, error)) ToolHandler {
+	return func(ctx context.Context, call ToolCall) (any, error) {
+		var args A
+		if len(call.Arguments) > 0 {
+			if err := call.DecodeArguments(&args); err != nil {
+				return nil, err
+			}
+		}
+		return fn(ctx, args)
+	}
+}
+
+// ToolSpec is the wire form of a tool, as sent to the agent.
+type ToolSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolResult is the outcome of a tool call, sent back to the agent along
+// with the call it answers.
+type ToolResult struct {
+	ToolCall
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// WithTools registers tools the client offers to agents called through
+// InvokeWithTools. A later tool replaces an earlier one of the same name.
+func WithTools(tools ...Tool) Option {
+	return func(c *Client) {
+		for _, t := range tools {
+			if t.Name == "" || t.Handler == nil {
+				continue
+			}
+			if c.tools == nil {
+				c.tools = make(map[string]Tool)
+			}
+			if _, ok := c.tools[t.Name]; !ok {
+				c.toolOrder = append(c.toolOrder, t.Name)
+			}
+			c.tools[t.Name] = t
+		}
+	}
+}
+
+// WithMaxToolRounds sets how many rounds of tool calls InvokeWithTools
+// answers. It defaults to DefaultMaxToolRounds.
+func WithMaxToolRounds(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.maxToolRounds = n
+		}
+	}
+}
+
+// InvokeWithTools sends req to the named agent along with the schemas of
+// the client's tools. While the agent responds with tool calls, the client
+// runs them and sends the results back, each round repeating the request
+// with every result so far. The first response without tool calls is
+// returned. Each round is a separate call subject to opts.
+func (c *Client) InvokeWithTools(ctx context.Context, agentName string, req AgentRequest, opts ...CallOption) (*AgentResponse, error) {
+	req.Tools = c.toolSpecs()
+	req.ToolResults = append([]ToolResult(nil), req.ToolResults...)
+	for round := range c.maxToolRounds {
+		roundOpts := opts
+		if round > 0 {
+			roundOpts = append(opts[:len(opts):len(opts)], idempotencyRound(round))
+		}
+		resp, err := c.Invoke(ctx, agentName, req, roundOpts...)
+		if err != nil || len(resp.ToolCalls) == 0 {
+			return resp, err
+		}
+		for _, call := range resp.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("mpcclient: call agent %q: %w", agentName, err)
+			}
+			req.ToolResults = append(req.ToolResults, c.runTool(ctx, call))
+		}
+		// Files are uploaded with the first round only.
+		req.Attachments = nil
+	}
+	return nil, fmt.Errorf("mpcclient: call agent %q: %w after %d rounds", agentName, ErrToolRounds, c.maxToolRounds)
+}
+
+func (c *Client) toolSpecs() []ToolSpec {
+	specs := make([]ToolSpec, 0, len(c.toolOrder))
+	for _, name := range c.toolOrder {
+		t := c.tools[name]
+		specs = append(specs, ToolSpec{Name: t.Name, Description: t.Description, Parameters: t.Parameters})
+	}
+	return specs
+}
+
+func (c *Client) runTool(ctx context.Context, call ToolCall) ToolResult {
+	res := ToolResult{ToolCall: call}
+	t, ok := c.tools[call.Name]
+	if !ok {
+		res.Error = fmt.Sprintf("unknown tool %q", call.Name)
+		return res
+	}
+	out, err := t.Handler(ctx, call)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		res.Error = fmt.Sprintf("encode result: %v", err)
+		return res
+	}
+	res.Output = b
+	return res
+}
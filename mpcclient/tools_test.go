@@ -0,0 +1,88 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInvokeWithTools(t *testing.T) {
+	var rounds []AgentRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		rounds = append(rounds, req)
+		switch len(req.ToolResults) {
+		case 0:
+			json.NewEncoder(w).Encode(map[string]any{"tool_calls": []map[string]any{
+				{"id": "1", "name": "get_cpu", "arguments": map[string]any{"vm": "web01"}},
+				{"id": "2", "name": "missing"},
+			}})
+		case 2:
+			json.NewEncoder(w).Encode(map[string]any{"tool_calls": []map[string]any{
+				{"id": "3", "name": "get_cpu", "arguments": map[string]any{"vm": "down"}},
+			}})
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"result": "web01 is at 97% CPU"})
+		}
+	}))
+	defer srv.Close()
+
+	type cpuArgs struct {
+		VM string `json:"vm"`
+	}
+	getCPU := Tool{
+		Name:       "get_cpu",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"vm":{"type":"string"}}}`),
+		Handler: ToolFunc(func(ctx context.Context, args cpuArgs) (any, error) {
+			if args.VM == "down" {
+				return nil, errors.New("vm unreachable")
+			}
+			return map[string]int{"cpu": 97}, nil
+		}),
+	}
+	c, _ := NewClient(srv.URL, WithTools(getCPU))
+
+	resp, err := c.InvokeWithTools(context.Background(), "ops", AgentRequest{Prompt: "how busy is web01?"})
+	if err != nil || resp.Result != "web01 is at 97% CPU" {
+		t.Fatalf("InvokeWithTools = %+v, %v", resp, err)
+	}
+	if len(rounds) != 3 {
+		t.Fatalf("got %d rounds, want 3", len(rounds))
+	}
+	if len(rounds[0].Tools) != 1 || rounds[0].Tools[0].Name != "get_cpu" || rounds[2].Tools[0].Name != "get_cpu" {
+		t.Errorf("tool specs not sent every round: %+v", rounds[0].Tools)
+	}
+	results := rounds[2].ToolResults
+	if len(results) != 3 {
+		t.Fatalf("final round carried %d results, want 3", len(results))
+	}
+	if results[0].ID != "1" || string(results[0].Output) != `{"cpu":97}` {
+		t.Errorf("result 1 = %+v", results[0])
+	}
+	if results[1].ID != "2" || results[1].Error != `unknown tool "missing"` {
+		t.Errorf("result 2 = %+v", results[1])
+	}
+	if results[2].ID != "3" || results[2].Error != "vm unreachable" || results[2].Output != nil {
+		t.Errorf("result 3 = %+v", results[2])
+	}
+}
+
+func TestInvokeWithToolsLimitsRounds(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]any{"tool_calls": []map[string]any{{"name": "noop"}}})
+	}))
+	defer srv.Close()
+
+	noop := Tool{Name: "noop", Handler: func(context.Context, ToolCall) (any, error) { return nil, nil }}
+	c, _ := NewClient(srv.URL, WithTools(noop), WithMaxToolRounds(3))
+	_, err := c.InvokeWithTools(context.Background(), "ops", AgentRequest{Prompt: "loop"})
+	if !errors.Is(err, ErrToolRounds) || calls != 3 {
+		t.Errorf("err = %v after %d calls, want ErrToolRounds after 3", err, calls)
+	}
+}
@@ -0,0 +1,165 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultTranslatorAgent is the agent WithTargetLanguage sends results to
+// unless WithTranslator names another.
+const DefaultTranslatorAgent = "translatorAgent"
+
+// WithTargetLanguage has the result of every Invoke, CallAgent and call
+// built on them translated into lang, a language name or code such as
+// "de", by the translator agent, after the post-processors have run. Code
+// blocks and inline code are held back from the translator and put back
+// unchanged, so commands and snippets keep working. JSON results and
+// calls with a response schema are not translated. Translated responses
+// carry the language in their "language" metadata; if the translator
+// fails or mangles the code markers, the response is returned
+// untranslated and the failure logged. Streams are not translated.
+func WithTargetLanguage(lang string) Option {
+	return func(c *Client) {
+		c.language = lang
+	}
+}
+
+// WithTranslator sets the agent WithTargetLanguage uses.
+func WithTranslator(agent string) Option {
+	return func(c *Client) {
+		c.translator = agent
+	}
+}
+
+// WithResponseLanguage overrides the client's target language for one
+// call. An empty lang turns translation off for the call.
+func WithResponseLanguage(lang string) CallOption {
+	return func(o *callOptions) {
+		o.language = lang
+	}
+}
+
+// translate returns resp with its result translated into the call's
+// target language, or resp itself when there is nothing to translate or
+// translation fails.
+func (c *Client) translate(ctx context.Context, resp *AgentResponse, o callOptions) *AgentResponse {
+	if o.language == "" || o.schema != nil || o.format == FormatJSON || json.Valid([]byte(strings.TrimSpace(resp.Result))) {
+		return resp
+	}
+	text, codes := protectCode(resp.Result)
+	if strings.TrimSpace(placeholder.ReplaceAllString(text, "")) == "" {
+		return resp
+	}
+	agent := c.translator
+	if agent == "" {
+		agent = DefaultTranslatorAgent
+	}
+	req := AgentRequest{
+		Prompt: "Translate the text below into " + o.language + ". Reply with the translation only. Keep Markdown " +
+			"formatting, and copy every marker such as " + marker(0) + " exactly as it is, in the place it belongs.\n\n" + text,
+		Parameters: map[string]any{"target_language": o.language},
+	}
+	tr, err := c.Invoke(ctx, agent, req, WithResponseLanguage(""), WithPostProcessing())
+	if err == nil {
+		var ok bool
+		if text, ok = restoreCode(tr.Text(), codes); !ok {
+			err = fmt.Errorf("translator %q changed the code markers", agent)
+		}
+	}
+	if err != nil {
+		if c.logger != nil {
+			c.logger.LogAttrs(ctx, slog.LevelWarn, "mpcclient: response left untranslated",
+				slog.String("agent", resp.Agent), slog.String("language", o.language), c.logError(err))
+		}
+		return resp
+	}
+	out := *resp
+	out.Result = text
+	out.Metadata = maps.Clone(resp.Metadata)
+	if out.Metadata == nil {
+		out.Metadata = make(map[string]any)
+	}
+	out.Metadata["language"] = o.language
+	return &out
+}
+
+// placeholder matches the markers protectCode leaves in place of code.
+var placeholder = regexp.MustCompile(`@@CODE(\d+)@@`)
+
+// inlineCode matches code spans within a line.
+var inlineCode = regexp.MustCompile("`[^`\n]+`")
+
+func marker(i int) string {
+	return "@@CODE" + strconv.Itoa(i) + "@@"
+}
+
+// protectCode replaces the fenced code blocks and inline code of text with
+// numbered markers, returning the text and the code they stand for.
+func protectCode(text string) (string, []string) {
+	var (
+		codes []string
+		out   strings.Builder
+		block strings.Builder
+		fence string
+	)
+	for line := range strings.SplitAfterSeq(text, "\n") {
+		bare := strings.TrimRight(line, "\n")
+		trimmed := strings.TrimLeft(bare, " ")
+		indent := len(bare) - len(trimmed)
+		if fence == "" {
+			if f, _, ok := openFence(trimmed, indent); ok {
+				fence = f
+				block.WriteString(line)
+				continue
+			}
+			out.WriteString(inlineCode.ReplaceAllStringFunc(line, func(code string) string {
+				codes = append(codes, code)
+				return marker(len(codes) - 1)
+			}))
+			continue
+		}
+		block.WriteString(line)
+		if indent <= 3 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+			fence = ""
+			// The newline ending the block stays outside the marker.
+			code, nl := strings.CutSuffix(block.String(), "\n")
+			block.Reset()
+			codes = append(codes, code)
+			out.WriteString(marker(len(codes) - 1))
+			if nl {
+				out.WriteString("\n")
+			}
+		}
+	}
+	if block.Len() > 0 {
+		codes = append(codes, block.String())
+		out.WriteString(marker(len(codes) - 1))
+	}
+	return out.String(), codes
+}
+
+// restoreCode puts codes back in place of their markers in text. It
+// reports false unless every marker appears exactly once.
+func restoreCode(text string, codes []string) (string, bool) {
+	seen := make([]bool, len(codes))
+	ok := true
+	text = placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		i, _ := strconv.Atoi(placeholder.FindStringSubmatch(m)[1])
+		if i >= len(codes) || seen[i] {
+			ok = false
+			return m
+		}
+		seen[i] = true
+		return codes[i]
+	})
+	for _, s := range seen {
+		ok = ok && s
+	}
+	return text, ok
+}
@@ -0,0 +1,79 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTargetLanguage(t *testing.T) {
+	const answer = "Run `go test ./...` first.\n\n```sh\n# run the tests\ngo test ./...\n```\n\nThen deploy."
+	var translated []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var resp AgentResponse
+		switch r.URL.Path {
+		case "/agent/translatorAgent":
+			_, text, _ := strings.Cut(req.Prompt, "\n\n")
+			translated = append(translated, text)
+			text = strings.NewReplacer("Run", "Führe", "first", "zuerst aus", "Then deploy", "Dann ausrollen").Replace(text)
+			if req.Parameters["target_language"] != "de" {
+				text = "wrong language"
+			}
+			resp = AgentResponse{Agent: "translatorAgent", Result: text}
+		case "/agent/mangler":
+			resp = AgentResponse{Agent: "mangler", Result: "Alles gut."}
+		case "/agent/json":
+			resp = AgentResponse{Agent: "json", Result: `{"cpu": 42}`}
+		default:
+			resp = AgentResponse{Agent: "docs", Result: answer}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL, WithTargetLanguage("de"))
+	ctx := context.Background()
+
+	resp, err := c.CallAgent(ctx, "docs", "how do I ship?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Führe `go test ./...` zuerst aus.\n\n```sh\n# run the tests\ngo test ./...\n```\n\nDann ausrollen."
+	if resp.Result != want || resp.Metadata["language"] != "de" {
+		t.Errorf("translated response = %q, %v", resp.Result, resp.Metadata)
+	}
+	if len(translated) != 1 || strings.Contains(translated[0], "go test") {
+		t.Errorf("translator was sent code: %q", translated)
+	}
+
+	if resp, err := c.CallAgent(ctx, "docs", "how do I ship?", WithResponseLanguage("")); err != nil || resp.Result != answer {
+		t.Errorf("with translation off: %q, %v", resp.Result, err)
+	}
+	if resp, err := c.CallAgent(ctx, "json", "cpu?"); err != nil || resp.Result != `{"cpu": 42}` || len(translated) != 1 {
+		t.Errorf("JSON result: %q, %v", resp.Result, err)
+	}
+
+	// A translator losing the code markers leaves the response as it was.
+	mangled, _ := NewClient(srv.URL, WithTargetLanguage("de"), WithTranslator("mangler"))
+	if resp, err := mangled.CallAgent(ctx, "docs", "how do I ship?"); err != nil || resp.Result != answer || resp.Metadata["language"] != nil {
+		t.Errorf("mangled translation: %q, %v", resp.Result, err)
+	}
+}
+
+func TestProtectCode(t *testing.T) {
+	text := "Use `ls`.\n~~~\nopen fence\n"
+	masked, codes := protectCode(text)
+	if masked != "Use @@CODE0@@.\n@@CODE1@@" || len(codes) != 2 {
+		t.Fatalf("protectCode = %q, %q", masked, codes)
+	}
+	if got, ok := restoreCode(masked, codes); !ok || got != text {
+		t.Errorf("restoreCode = %q, %v", got, ok)
+	}
+	if _, ok := restoreCode("@@CODE0@@ @@CODE0@@ @@CODE1@@", codes); ok {
+		t.Error("duplicated marker accepted")
+	}
+}
@@ -0,0 +1,54 @@
+package mpcclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Call is one agent invocation as handed to a Transport.
+type Call struct {
+	Agent   string
+	Request AgentRequest
+	// OnStatus receives intermediate status updates on transports that
+	// carry them. It may be nil.
+	OnStatus func(status string)
+}
+
+// Transport carries agent calls to the server. The default transport posts
+// JSON over HTTP; WithWebSocketTransport selects a persistent WebSocket
+// connection instead. Implementations must be safe for concurrent use.
+type Transport interface {
+	RoundTrip(ctx context.Context, call *Call) (*AgentResponse, error)
+}
+
+// WithTransport sets the transport used for agent calls. Discovery, health
+// and streaming requests always use HTTP.
+func WithTransport(t Transport) Option {
+	return func(c *Client) {
+		if t != nil {
+			c.transport = t
+		}
+	}
+}
+
+// httpTransport posts calls to /agent/{name}, as multipart form data when
+// they carry attachments.
+type httpTransport struct {
+	c *Client
+}
+
+func (t httpTransport) RoundTrip(ctx context.Context, call *Call) (*AgentResponse, error) {
+	path := "/agent/" + url.PathEscape(call.Agent)
+	var resp AgentResponse
+	var err error
+	if len(call.Request.Attachments) > 0 {
+		err = t.c.doMultipart(ctx, path, call.Request, &resp)
+	} else {
+		err = t.c.do(ctx, http.MethodPost, path, call.Request, &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
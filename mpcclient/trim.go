@@ -0,0 +1,240 @@
+package mpcclient
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TrimStrategy fits a conversation history into a token budget. A Session
+// uses its policy's strategy once the history is over MaxTokens.
+type TrimStrategy interface {
+	// Trim returns msgs cut to at most budget tokens, as counted by
+	// estimate. msgs hold no system messages but an earlier summary.
+	Trim(ctx context.Context, msgs []Message, budget int, estimate func(string) int) ([]Message, error)
+}
+
+// CountTokens returns the estimated token count of the contents of msgs;
+// a nil estimate means EstimateTokens.
+func CountTokens(msgs []Message, estimate func(string) int) int {
+	if estimate == nil {
+		estimate = EstimateTokens
+	}
+	n := 0
+	for _, m := range msgs {
+		n += estimate(m.Content)
+	}
+	return n
+}
+
+// DropOldest returns the strategy that drops the oldest messages until the
+// rest fit. It is the default.
+func DropOldest() TrimStrategy {
+	return dropOldest{}
+}
+
+type dropOldest struct{}
+
+func (dropOldest) Trim(_ context.Context, msgs []Message, budget int, estimate func(string) int) ([]Message, error) {
+	// Walk back from the newest message, keeping as many as fit.
+	keep := len(msgs)
+	for keep > 0 {
+		cost := estimate(msgs[keep-1].Content)
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		keep--
+	}
+	return msgs[keep:], nil
+}
+
+// summaryPrefix opens the system message holding the summary of the
+// messages a SummarizeWith strategy replaced.
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// isSummary reports whether m is a summary written by SummarizeWith, which
+// is trimmed with the history rather than kept like other system messages.
+func isSummary(m Message) bool {
+	return m.Role == RoleSystem && strings.HasPrefix(m.Content, summaryPrefix)
+}
+
+// SummarizeWith returns the strategy that has the named agent summarize
+// the oldest messages, and any earlier summary, into a system message
+// taking up to a quarter of the budget, keeping the newest exchanges that
+// fit alongside it verbatim. Messages still over the budget are dropped
+// oldest first.
+func SummarizeWith(c *Client, agentName string) TrimStrategy {
+	return summarize{client: c, agent: agentName}
+}
+
+type summarize struct {
+	client *Client
+	agent  string
+}
+
+func (s summarize) Trim(ctx context.Context, msgs []Message, budget int, estimate func(string) int) ([]Message, error) {
+	if CountTokens(msgs, estimate) <= budget {
+		return msgs, nil
+	}
+	if budget <= 0 {
+		return nil, nil
+	}
+	reserve := budget / 4
+	turns := exchanges(msgs)
+	// Keep the newest exchanges that fit beside the summary.
+	keep, room := len(turns), budget-reserve
+	for keep > 0 {
+		cost := CountTokens(turns[keep-1], estimate)
+		if cost > room {
+			break
+		}
+		room -= cost
+		keep--
+	}
+	var old []Message
+	for _, t := range turns[:keep] {
+		old = append(old, t...)
+	}
+	if len(old) == 0 {
+		return dropOldest{}.Trim(ctx, msgs, budget, estimate)
+	}
+
+	// Summaries are asked for in words, at about three per four tokens.
+	sum, _, err := summarizeMessages(ctx, s.client, s.agent, old, max(reserve*3/4, 10))
+	if err != nil {
+		return nil, err
+	}
+	out := []Message{sum}
+	for _, t := range turns[keep:] {
+		out = append(out, t...)
+	}
+	return dropOldest{}.Trim(ctx, out, budget, estimate)
+}
+
+// summarizeMessages has the named agent summarize msgs in at most words
+// words, returning the summary message and the response it came from.
+func summarizeMessages(ctx context.Context, c *Client, agentName string, msgs []Message, words int) (Message, *AgentResponse, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Summarize the conversation below in at most %d words, keeping the facts, decisions and open questions needed to continue it.\n\n", words)
+	for _, m := range msgs {
+		role := string(m.Role)
+		if isSummary(m) {
+			role, m.Content = "earlier summary", strings.TrimPrefix(m.Content, summaryPrefix)
+		}
+		fmt.Fprintf(&prompt, "%s: %s\n", role, m.Content)
+	}
+	resp, err := c.CallAgent(ctx, agentName, prompt.String())
+	if err != nil {
+		return Message{}, nil, fmt.Errorf("mpcclient: summarize history with agent %q: %w", agentName, err)
+	}
+	return Message{Role: RoleSystem, Content: summaryPrefix + strings.TrimSpace(resp.Result)}, resp, nil
+}
+
+// ImportanceFunc scores a message for ImportanceWeighted; age is 0 for the
+// newest exchange, 1 for the one before and so on.
+type ImportanceFunc func(m Message, age int) float64
+
+// ImportanceWeighted returns the strategy that keeps the most important
+// exchanges that fit, in their original order, and drops the others
+// wherever they are in the history. An exchange, a user message with the
+// replies to it, is as important as its most important message, and ties
+// go to the newer exchange. A nil score weighs exchanges by recency only.
+func ImportanceWeighted(score ImportanceFunc) TrimStrategy {
+	if score == nil {
+		score = func(_ Message, age int) float64 { return 1 / float64(age+1) }
+	}
+	return importanceWeighted{score}
+}
+
+type importanceWeighted struct {
+	score ImportanceFunc
+}
+
+func (w importanceWeighted) Trim(_ context.Context, msgs []Message, budget int, estimate func(string) int) ([]Message, error) {
+	turns := exchanges(msgs)
+	type ranked struct {
+		index      int
+		importance float64
+	}
+	order := make([]ranked, len(turns))
+	for i, t := range turns {
+		order[i] = ranked{index: i}
+		for j, m := range t {
+			if s := w.score(m, len(turns)-1-i); j == 0 || s > order[i].importance {
+				order[i].importance = s
+			}
+		}
+	}
+	slices.SortFunc(order, func(a, b ranked) int {
+		return cmp.Or(cmp.Compare(b.importance, a.importance), cmp.Compare(b.index, a.index))
+	})
+	kept := make([]bool, len(turns))
+	for _, r := range order {
+		if cost := CountTokens(turns[r.index], estimate); cost <= budget {
+			kept[r.index] = true
+			budget -= cost
+		}
+	}
+	var out []Message
+	for i, t := range turns {
+		if kept[i] {
+			out = append(out, t...)
+		}
+	}
+	return out, nil
+}
+
+// exchanges splits msgs into exchanges, each starting at a user message
+// and holding the replies that follow it. A summary opens an exchange of
+// its own.
+func exchanges(msgs []Message) [][]Message {
+	var out [][]Message
+	for i, m := range msgs {
+		if i == 0 || m.Role == RoleUser || isSummary(m) || isSummary(msgs[i-1]) {
+			out = append(out, nil)
+		}
+		out[len(out)-1] = append(out[len(out)-1], m)
+	}
+	return out
+}
+
+// ContextItem is a piece of retrieved context, such as a document chunk,
+// with the importance deciding what is kept when not all of it fits.
+type ContextItem struct {
+	Text       string
+	Importance float64
+}
+
+// FitContext returns the most important items that fit in maxTokens, as
+// counted by estimate, in their original order; a nil estimate means
+// EstimateTokens. Items are taken by descending importance, ties going to
+// the earlier item, skipping those too large for what is left.
+func FitContext(items []ContextItem, maxTokens int, estimate func(string) int) []ContextItem {
+	if estimate == nil {
+		estimate = EstimateTokens
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(items[b].Importance, items[a].Importance)
+	})
+	kept := make([]bool, len(items))
+	for _, i := range order {
+		if cost := estimate(items[i].Text); cost <= maxTokens {
+			kept[i] = true
+			maxTokens -= cost
+		}
+	}
+	var out []ContextItem
+	for i, it := range items {
+		if kept[i] {
+			out = append(out, it)
+		}
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package mpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func conversation(contents ...string) []Message {
+	var msgs []Message
+	for _, c := range contents {
+		role := RoleUser
+		if c[0] == 'a' {
+			role = RoleAssistant
+		}
+		msgs = append(msgs, Message{role, c})
+	}
+	return msgs
+}
+
+func contents(msgs []Message) string {
+	var s []string
+	for _, m := range msgs {
+		s = append(s, m.Content)
+	}
+	return strings.Join(s, " ")
+}
+
+func oneEach(string) int { return 1 }
+
+func TestCountTokens(t *testing.T) {
+	msgs := conversation("u1234567", "a1")
+	if n := CountTokens(msgs, nil); n != 3 {
+		t.Errorf("CountTokens = %d, want 3", n)
+	}
+	if n := CountTokens(msgs, oneEach); n != 2 {
+		t.Errorf("CountTokens with estimator = %d, want 2", n)
+	}
+}
+
+func TestSummarizeWith(t *testing.T) {
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Prompt)
+		json.NewEncoder(w).Encode(AgentResponse{Result: " s "})
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	p := TruncationPolicy{MaxTokens: 5, EstimateTokens: oneEach, Strategy: SummarizeWith(c, "summarizer")}
+	msgs := append([]Message{{RoleSystem, "sys"}}, conversation("u1", "a1", "u2", "a2", "u3", "a3")...)
+	got := p.apply(context.Background(), msgs)
+	// The system prompt and summary leave room for the last exchange only.
+	if contents(got) != "sys "+summaryPrefix+"s u3 a3" || got[1].Role != RoleSystem {
+		t.Errorf("trimmed to %+v", got)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "user: u1\nassistant: a1\nuser: u2\nassistant: a2\n") {
+		t.Fatalf("summarizer prompts = %q", prompts)
+	}
+
+	// A later trim folds the earlier summary into the new one.
+	got = p.apply(context.Background(), append(got, conversation("u4", "a4")...))
+	if contents(got) != "sys "+summaryPrefix+"s u4 a4" {
+		t.Errorf("trimmed again to %+v", got)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "earlier summary: s\nuser: u3\nassistant: a3\n") {
+		t.Errorf("second summarizer prompt = %q", prompts[1])
+	}
+}
+
+func TestSummarizeWithFallsBack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	c, _ := NewClient(srv.URL)
+
+	p := TruncationPolicy{MaxTokens: 3, EstimateTokens: oneEach, Strategy: SummarizeWith(c, "summarizer")}
+	got := p.apply(context.Background(), conversation("u1", "a1", "u2", "a2"))
+	if contents(got) != "a1 u2 a2" {
+		t.Errorf("a failed summary should drop the oldest messages, got %+v", got)
+	}
+}
+
+func TestImportanceWeighted(t *testing.T) {
+	pinned := func(m Message, age int) float64 {
+		if strings.Contains(m.Content, "!") {
+			return 10
+		}
+		return -float64(age)
+	}
+	msgs := conversation("u1!", "a1", "u2", "a2", "u3", "a3", "u4", "a4")
+	got, err := ImportanceWeighted(pinned).Trim(context.Background(), msgs, 4, oneEach)
+	if err != nil || contents(got) != "u1! a1 u4 a4" {
+		t.Errorf("kept %+v, %v", got, err)
+	}
+
+	// By recency alone, the newest exchanges win.
+	got, _ = ImportanceWeighted(nil).Trim(context.Background(), msgs, 5, oneEach)
+	if contents(got) != "u3 a3 u4 a4" {
+		t.Errorf("kept %+v by recency", got)
+	}
+}
+
+func TestSessionTrimStrategy(t *testing.T) {
+	var got [][]Message
+	c, _ := NewClient(historyServer(t, &got).URL)
+	if _, ok := c.NewSession("chat").TrimStrategy().(dropOldest); !ok {
+		t.Error("sessions should drop the oldest messages by default")
+	}
+
+	s := c.NewSession("chat", WithTruncation(TruncationPolicy{MaxTokens: 6}), WithTrimStrategy(ImportanceWeighted(nil)))
+	if _, ok := s.TrimStrategy().(importanceWeighted); !ok {
+		t.Errorf("TrimStrategy = %T, want the one set", s.TrimStrategy())
+	}
+	for _, p := range []string{"hello", "again"} {
+		if _, err := s.Send(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each exchange is 5 tokens, so only the newest fits.
+	if h := s.History(); contents(h) != "again re: again" || s.Tokens() != 5 {
+		t.Errorf("history of %d tokens = %+v", s.Tokens(), h)
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	items := []ContextItem{
+		{"aaaa", 0.2},
+		{"bbbbbbbb", 0.9},
+		{"cccc", 0.5},
+		{"dddd", 0.5},
+	}
+	got := FitContext(items, 3, nil)
+	var texts []string
+	for _, it := range got {
+		texts = append(texts, it.Text)
+	}
+	if strings.Join(texts, " ") != "bbbbbbbb cccc" {
+		t.Errorf("FitContext = %q", texts)
+	}
+	if got := FitContext(items, 0, nil); len(got) != 0 {
+		t.Errorf("FitContext with no room = %+v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package mpcclient
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned by the budget functions MaxTokens and
+// MaxCost once a session has used up its allowance.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Add returns the sum of u and v.
+func (u Usage) Add(v Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + v.PromptTokens,
+		CompletionTokens: u.CompletionTokens + v.CompletionTokens,
+		TotalTokens:      u.Total() + v.Total(),
+	}
+}
+
+// Total returns TotalTokens, or the sum of prompt and completion tokens
+// for servers that leave it out.
+func (u Usage) Total() int {
+	if u.TotalTokens == 0 {
+		return u.PromptTokens + u.CompletionTokens
+	}
+	return u.TotalTokens
+}
+
+// Pricer estimates what a call's token usage cost.
+type Pricer interface {
+	Cost(agent string, u Usage) float64
+}
+
+// Price is the cost of an agent's tokens, per thousand.
+type Price struct {
+	PromptPer1K     float64 `json:"prompt_per_1k" yaml:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k" yaml:"completion_per_1k"`
+}
+
+// PricingTable prices usage by agent name. The entry under "*", if any,
+// applies to agents without their own.
+type PricingTable map[string]Price
+
+// Cost implements Pricer. Usage reporting only a total is charged at the
+// prompt rate.
+func (t PricingTable) Cost(agent string, u Usage) float64 {
+	p, ok := t[agent]
+	if !ok {
+		p = t["*"]
+	}
+	if u.PromptTokens == 0 && u.CompletionTokens == 0 {
+		return float64(u.TotalTokens) / 1000 * p.PromptPer1K
+	}
+	return float64(u.PromptTokens)/1000*p.PromptPer1K + float64(u.CompletionTokens)/1000*p.CompletionPer1K
+}
+
+// WithPricing sets the pricer used by Client.Cost and Session.Cost.
+func WithPricing(p Pricer) Option {
+	return func(c *Client) {
+		c.usage.pricer = p
+	}
+}
+
+// usageMeter accumulates the usage reported by a client's calls.
+type usageMeter struct {
+	pricer Pricer
+
+	mu      sync.Mutex
+	total   Usage
+	cost    float64
+	byAgent map[string]Usage
+}
+
+// record adds the usage of resp, if it reports any, and returns its cost.
+func (m *usageMeter) record(agent string, resp *AgentResponse) float64 {
+	if resp == nil || resp.Usage == nil {
+		return 0
+	}
+	cost := m.price(agent, *resp.Usage)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.byAgent == nil {
+		m.byAgent = make(map[string]Usage)
+	}
+	m.total = m.total.Add(*resp.Usage)
+	m.byAgent[agent] = m.byAgent[agent].Add(*resp.Usage)
+	m.cost += cost
+	return cost
+}
+
+func (m *usageMeter) price(agent string, u Usage) float64 {
+	if m.pricer == nil {
+		return 0
+	}
+	return m.pricer.Cost(agent, u)
+}
+
+// Usage returns the tokens consumed by every call the client has sent.
+// Responses served from the cache are not counted.
+func (c *Client) Usage() Usage {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return c.usage.total
+}
+
+// UsageByAgent returns the client's token usage broken down by agent.
+func (c *Client) UsageByAgent() map[string]Usage {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return maps.Clone(c.usage.byAgent)
+}
+
+// Cost returns the estimated cost of the client's usage under the pricer
+// set with WithPricing, or zero without one.
+func (c *Client) Cost() float64 {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return c.usage.cost
+}
+
+// BudgetFunc decides whether a session may send another message, given
+// the usage and estimated cost of its calls so far. A non-nil error aborts
+// the send.
+type BudgetFunc func(used Usage, cost float64) error
+
+// WithBudget checks fn before every send on the session.
+func WithBudget(fn BudgetFunc) SessionOption {
+	return func(s *Session) {
+		s.budget = fn
+	}
+}
+
+// MaxTokens allows sends until the session has used n tokens.
+func MaxTokens(n int) BudgetFunc {
+	return func(used Usage, _ float64) error {
+		if used.Total() >= n {
+			return fmt.Errorf("%w: used %d of %d tokens", ErrBudgetExceeded, used.Total(), n)
+		}
+		return nil
+	}
+}
+
+// MaxCost allows sends until the session's estimated cost reaches limit.
+func MaxCost(limit float64) BudgetFunc {
+	return func(_ Usage, cost float64) error {
+		if cost >= limit {
+			return fmt.Errorf("%w: spent %.4f of %.4f", ErrBudgetExceeded, cost, limit)
+		}
+		return nil
+	}
+}
+
+// Usage returns the tokens consumed by the session's calls.
+func (s *Session) Usage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// Cost returns the estimated cost of the session's calls under the
+// client's pricer.
+func (s *Session) Cost() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cost
+}
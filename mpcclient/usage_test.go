@@ -0,0 +1,108 @@
+package mpcclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func usageServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"agent":"vm","result":"ok","usage":{"prompt_tokens":100,"completion_tokens":50,"total_tokens":150}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestPricingTable(t *testing.T) {
+	table := PricingTable{
+		"vm": {PromptPer1K: 0.01, CompletionPer1K: 0.03},
+		"*":  {PromptPer1K: 0.002},
+	}
+	if got := table.Cost("vm", Usage{PromptTokens: 1000, CompletionTokens: 2000}); math.Abs(got-0.07) > 1e-9 {
+		t.Errorf("vm cost = %v, want 0.07", got)
+	}
+	if got := table.Cost("other", Usage{TotalTokens: 500}); math.Abs(got-0.001) > 1e-9 {
+		t.Errorf("fallback cost = %v, want 0.001", got)
+	}
+	if got := (Usage{PromptTokens: 1, CompletionTokens: 2}).Add(Usage{TotalTokens: 4}); got.Total() != 7 || got.PromptTokens != 1 {
+		t.Errorf("Add = %+v", got)
+	}
+}
+
+func TestClientAndSessionUsage(t *testing.T) {
+	srv, _ := usageServer(t)
+	c, _ := NewClient(srv.URL, WithPricing(PricingTable{"vm": {PromptPer1K: 1, CompletionPer1K: 2}}))
+	ctx := context.Background()
+
+	if _, err := c.CallAgent(ctx, "other", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	s := c.NewSession("vm")
+	for range 2 {
+		if _, err := s.Send(ctx, "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Usage(); got != (Usage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300}) {
+		t.Errorf("session usage = %+v", got)
+	}
+	if got := s.Cost(); math.Abs(got-0.4) > 1e-9 {
+		t.Errorf("session cost = %v, want 0.4", got)
+	}
+	if got := c.Usage().Total(); got != 450 {
+		t.Errorf("client total = %d, want 450", got)
+	}
+	if got := c.UsageByAgent()["other"].Total(); got != 150 {
+		t.Errorf("other agent total = %d, want 150", got)
+	}
+	if got := c.Cost(); math.Abs(got-0.4) > 1e-9 {
+		t.Errorf("client cost = %v, want 0.4 (unpriced agent is free)", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "s.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := c.LoadSession(path)
+	if err != nil || loaded.Usage().Total() != 300 || loaded.Cost() != s.Cost() {
+		t.Errorf("loaded session usage = %+v cost %v, %v", loaded.Usage(), loaded.Cost(), err)
+	}
+}
+
+func TestSessionBudget(t *testing.T) {
+	srv, calls := usageServer(t)
+	c, _ := NewClient(srv.URL, WithPricing(PricingTable{"*": {PromptPer1K: 1, CompletionPer1K: 1}}))
+	ctx := context.Background()
+
+	s := c.NewSession("vm", WithBudget(MaxTokens(200)))
+	for i := range 2 {
+		if _, err := s.Send(ctx, "hi"); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if _, err := s.Send(ctx, "hi"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v, want ErrBudgetExceeded", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server saw %d calls, want 2", calls.Load())
+	}
+
+	s = c.NewSession("vm", WithBudget(MaxCost(0.1)))
+	if _, err := s.Send(ctx, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send(ctx, "hi"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v, want ErrBudgetExceeded", err)
+	}
+	if len(s.History()) != 2 {
+		t.Errorf("history has %d messages, want 2", len(s.History()))
+	}
+}
@@ -0,0 +1,173 @@
+// Package vmmetrics decodes the structured reports of the workshop's
+// azureVmMetricsAgent into Go values and renders them for terminal demos:
+//
+//	resp, err := c.CallAgent(ctx, vmmetrics.AgentName, "CPU of vm web01 in rg prod")
+//	...
+//	report, err := vmmetrics.Decode(resp)
+//	...
+//	fmt.Print(report.Render(40))
+package vmmetrics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// AgentName is the name the workshop serves the agent under.
+const AgentName = "azureVmMetricsAgent"
+
+// Report is the data payload of the agent's responses.
+type Report struct {
+	VMName        string    `json:"vm_name"`
+	ResourceGroup string    `json:"resource_group"`
+	ResourceID    string    `json:"resource_id"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	// Interval is the span each point covers, as an ISO 8601 duration
+	// such as PT1M.
+	Interval        string   `json:"interval"`
+	Metrics         []Metric `json:"metrics"`
+	Recommendations []string `json:"recommendations,omitempty"`
+}
+
+// Metric is the series of one metric over the report's window, with its
+// summary.
+type Metric struct {
+	Name     string    `json:"name"`
+	Unit     string    `json:"unit"`
+	Average  float64   `json:"average"`
+	Maximum  float64   `json:"maximum"`
+	Minimum  float64   `json:"minimum"`
+	Latest   float64   `json:"latest"`
+	LatestAt time.Time `json:"latest_at,omitzero"`
+	Samples  int       `json:"samples"`
+	// Aggregation says how each point's value summarizes its interval,
+	// such as "Average".
+	Aggregation string  `json:"aggregation"`
+	Points      []Point `json:"points"`
+}
+
+// Point is one value of a series.
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Decode returns the report carried by a response of the agent.
+func Decode(resp *mpcclient.AgentResponse) (*Report, error) {
+	var r Report
+	if err := resp.JSON(&r); err != nil {
+		return nil, fmt.Errorf("vmmetrics: %w", err)
+	}
+	return &r, nil
+}
+
+// Metric returns the metric of the given name, such as "Percentage CPU".
+func (r *Report) Metric(name string) (Metric, bool) {
+	for _, m := range r.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// Values returns the values of the metric's points, oldest first.
+func (m Metric) Values() []float64 {
+	values := make([]float64, len(m.Points))
+	for i, p := range m.Points {
+		values[i] = p.Value
+	}
+	return values
+}
+
+// Render draws each metric of the report as a line with its sparkline, at
+// most width characters wide, and its latest and peak values, followed by
+// the recommendations.
+func (r *Report) Render(width int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)\n", r.VMName, r.ResourceGroup)
+	pad := 0
+	for _, m := range r.Metrics {
+		pad = max(pad, len(m.Name))
+	}
+	for _, m := range r.Metrics {
+		if m.Samples == 0 {
+			fmt.Fprintf(&b, "%-*s  no data\n", pad, m.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "%-*s  %s  latest %s, max %s\n", pad, m.Name, Sparkline(m.Values(), width),
+			formatValue(m.Latest, m.Unit), formatValue(m.Maximum, m.Unit))
+	}
+	for _, rec := range r.Recommendations {
+		fmt.Fprintf(&b, "Recommendation: %s\n", rec)
+	}
+	return b.String()
+}
+
+// sparks are the levels of a sparkline, lowest first.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws values as a line of block characters scaled between
+// their minimum and maximum. With width above zero, longer series are
+// averaged down to width characters. NaN values are drawn as spaces.
+func Sparkline(values []float64, width int) string {
+	if width > 0 && len(values) > width {
+		values = downsample(values, width)
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			b.WriteRune(' ')
+		case hi == lo:
+			b.WriteRune(sparks[0])
+		default:
+			b.WriteRune(sparks[int((v-lo)/(hi-lo)*float64(len(sparks)-1)+0.5)])
+		}
+	}
+	return b.String()
+}
+
+// downsample averages values into n buckets of about equal size.
+func downsample(values []float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		bucket := values[i*len(values)/n : (i+1)*len(values)/n]
+		var sum float64
+		var count int
+		for _, v := range bucket {
+			if !math.IsNaN(v) {
+				sum += v
+				count++
+			}
+		}
+		out[i] = math.NaN()
+		if count > 0 {
+			out[i] = sum / float64(count)
+		}
+	}
+	return out
+}
+
+// formatValue renders v with its unit.
+func formatValue(v float64, unit string) string {
+	switch unit {
+	case "Percent":
+		return fmt.Sprintf("%.1f%%", v)
+	case "", "Count", "Unspecified":
+		return fmt.Sprintf("%.1f", v)
+	default:
+		return fmt.Sprintf("%.1f %s", v, unit)
+	}
+}
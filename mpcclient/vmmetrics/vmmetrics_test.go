@@ -0,0 +1,66 @@
+package vmmetrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+const payload = `{
+  "vm_name": "web01", "resource_group": "prod", "interval": "PT1M",
+  "start": "2026-03-01T11:00:00Z", "end": "2026-03-01T12:00:00Z",
+  "metrics": [
+    {"name": "Percentage CPU", "unit": "Percent", "average": 45, "maximum": 95, "minimum": 30, "latest": 50, "samples": 3, "aggregation": "Average",
+     "points": [{"timestamp": "2026-03-01T11:58:00Z", "value": 40}, {"timestamp": "2026-03-01T11:59:00Z", "value": 45}, {"timestamp": "2026-03-01T12:00:00Z", "value": 50}]},
+    {"name": "Network Out Total", "unit": "Bytes", "samples": 0, "aggregation": "Average", "points": []}
+  ],
+  "recommendations": ["CPU peaks above 90%; monitor during peak hours"]
+}`
+
+func TestDecode(t *testing.T) {
+	r, err := Decode(&mpcclient.AgentResponse{Result: "summary", Data: []byte(payload)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu, ok := r.Metric("Percentage CPU")
+	if !ok || cpu.Unit != "Percent" || cpu.Aggregation != "Average" || len(cpu.Points) != 3 || cpu.Points[2].Value != 50 || cpu.Points[2].Timestamp.Minute() != 0 {
+		t.Errorf("cpu = %+v", cpu)
+	}
+	if r.Interval != "PT1M" || r.End.Sub(r.Start).Hours() != 1 {
+		t.Errorf("window = %v..%v every %s", r.Start, r.End, r.Interval)
+	}
+	if _, ok := r.Metric("Available Memory Bytes"); ok {
+		t.Error("found a metric not in the report")
+	}
+
+	out := r.Render(20)
+	for _, want := range []string{"web01 (prod)", "Percentage CPU     ▁▅█  latest 50.0%, max 95.0%", "Network Out Total  no data", "Recommendation: CPU peaks"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render missing %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := Decode(&mpcclient.AgentResponse{Result: "CPU: 45%"}); err == nil {
+		t.Errorf("text-only response: err = %v", err)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	for _, tt := range []struct {
+		values []float64
+		width  int
+		want   string
+	}{
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, 0, "▁▂▃▄▅▆▇█"},
+		{[]float64{3, 3, 3}, 0, "▁▁▁"},
+		{[]float64{0, math.NaN(), 7}, 0, "▁ █"},
+		{[]float64{0, 0, 7, 7}, 2, "▁█"},
+		{nil, 10, ""},
+	} {
+		if got := Sparkline(tt.values, tt.width); got != tt.want {
+			t.Errorf("Sparkline(%v, %d) = %q, want %q", tt.values, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package mpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// ErrTransportClosed is returned by calls made after Client.Close, and by
+// calls still pending when it is called.
+var ErrTransportClosed = errors.New("transport closed")
+
+// wsReadLimit bounds a single WebSocket message from the server.
+const wsReadLimit = 8 << 20
+
+// WebSocketConfig configures the WebSocket transport. Zero fields take the
+// documented defaults.
+type WebSocketConfig struct {
+	// Path is the server's WebSocket endpoint. It defaults to "/ws".
+	Path string
+	// PingInterval is how often the connection is checked with a ping. It
+	// defaults to 20s.
+	PingInterval time.Duration
+	// ReconnectDelay is the wait before the first reconnection attempt; it
+	// grows linearly with each further attempt. It defaults to 500ms.
+	ReconnectDelay time.Duration
+	// MaxReconnects is how many consecutive reconnection attempts are made
+	// before pending calls fail. It defaults to 5.
+	MaxReconnects int
+}
+
+func (cfg WebSocketConfig) withDefaults() WebSocketConfig {
+	if cfg.Path == "" {
+		cfg.Path = "/ws"
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = 20 * time.Second
+	}
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = 500 * time.Millisecond
+	}
+	if cfg.MaxReconnects <= 0 {
+		cfg.MaxReconnects = 5
+	}
+	return cfg
+}
+
+// WithWebSocketTransport sends agent calls over a single persistent
+// WebSocket connection, multiplexing concurrent calls and delivering the
+// status updates agents push to WithStatusHandler. A dropped connection is
+// re-established in the background and the server session resumed, so
+// calls in flight complete without being resent. Call Client.Close to
+// release the connection.
+func WithWebSocketTransport(cfg WebSocketConfig) Option {
+	return func(c *Client) {
+		c.transport = &wsTransport{c: c, cfg: cfg.withDefaults(), pending: make(map[string]*wsCall)}
+	}
+}
+
+// wsMessage is the envelope of every message on the connection; see
+// mpcserver for the protocol.
+type wsMessage struct {
+	Type        string          `json:"type"`
+	ID          string          `json:"id,omitempty"`
+	Seq         int64           `json:"seq,omitempty"`
+	Agent       string          `json:"agent,omitempty"`
+	Request     *AgentRequest   `json:"request,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       *AgentError     `json:"error,omitempty"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	RequestID   string          `json:"request_id,omitempty"`
+	ResumeToken string          `json:"resume_token,omitempty"`
+	Resumed     bool            `json:"resumed,omitempty"`
+}
+
+type wsCall struct {
+	msg      wsMessage
+	onStatus func(string)
+	done     chan wsOutcome
+	// sent is set while the request is known to have reached the current
+	// server session.
+	sent bool
+}
+
+type wsOutcome struct {
+	msg wsMessage
+	err error
+}
+
+func (call *wsCall) finish(o wsOutcome) {
+	select {
+	case call.done <- o:
+	default:
+	}
+}
+
+type wsTransport struct {
+	c   *Client
+	cfg WebSocketConfig
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	dialing chan struct{}
+	token   string
+	lastSeq int64
+	pending map[string]*wsCall
+	nextID  uint64
+	closed  bool
+}
+
+func (t *wsTransport) RoundTrip(ctx context.Context, call *Call) (*AgentResponse, error) {
+	if len(call.Request.Attachments) > 0 {
+		closeAttachments(call.Request.Attachments)
+		return nil, errors.New("attachments are not supported over WebSocket")
+	}
+	if err := t.c.throttle.wait(ctx, call.Agent); err != nil {
+		return nil, err
+	}
+	conn, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.nextID++
+	id := strconv.FormatUint(t.nextID, 10)
+	req := call.Request
+	wc := &wsCall{
+		msg:      wsMessage{Type: "request", ID: id, Agent: call.Agent, Request: &req, RequestID: RequestIDFromContext(ctx)},
+		onStatus: call.OnStatus,
+		done:     make(chan wsOutcome, 1),
+	}
+	t.pending[id] = wc
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	t.send(ctx, conn, wc)
+
+	select {
+	case o := <-wc.done:
+		if o.err != nil {
+			return nil, o.err
+		}
+		return t.response(o.msg)
+	case <-ctx.Done():
+		t.mu.Lock()
+		conn := t.conn
+		t.mu.Unlock()
+		if conn != nil {
+			cctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_ = wsjson.Write(cctx, conn, wsMessage{Type: "cancel", ID: id})
+			cancel()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// response converts a result or error message into the call's outcome.
+func (t *wsTransport) response(m wsMessage) (*AgentResponse, error) {
+	if m.Type == "error" {
+		e := &APIError{StatusCode: m.StatusCode, Message: http.StatusText(m.StatusCode), RequestID: m.RequestID}
+		if m.Error != nil {
+			e.Message, e.Code, e.Details = m.Error.Message, m.Error.Code, m.Error.Details
+		}
+		return nil, e
+	}
+	var resp AgentResponse
+	dec := json.NewDecoder(bytes.NewReader(m.Result))
+	if t.c.strictDecoding {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+// send writes call's request on conn unless it has already been sent. A
+// failed write closes the connection; the reconnect logic resends it.
+func (t *wsTransport) send(ctx context.Context, conn *websocket.Conn, call *wsCall) {
+	t.mu.Lock()
+	if call.sent {
+		t.mu.Unlock()
+		return
+	}
+	call.sent = true
+	t.mu.Unlock()
+
+	if err := wsjson.Write(ctx, conn, call.msg); err != nil {
+		t.mu.Lock()
+		call.sent = false
+		t.mu.Unlock()
+		conn.CloseNow()
+	}
+}
+
+// connect returns the current connection, dialing one if there is none.
+// Concurrent callers share a single dial.
+func (t *wsTransport) connect(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		t.mu.Lock()
+		switch {
+		case t.closed:
+			t.mu.Unlock()
+			return nil, ErrTransportClosed
+		case t.conn != nil:
+			conn := t.conn
+			t.mu.Unlock()
+			return conn, nil
+		case t.dialing != nil:
+			wait := t.dialing
+			t.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		t.dialing = make(chan struct{})
+		token, lastSeq := t.token, t.lastSeq
+		t.mu.Unlock()
+
+		conn, hello, err := t.dial(ctx, token, lastSeq)
+
+		t.mu.Lock()
+		close(t.dialing)
+		t.dialing = nil
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		if t.closed {
+			t.mu.Unlock()
+			conn.CloseNow()
+			return nil, ErrTransportClosed
+		}
+		t.conn, t.token = conn, hello.ResumeToken
+		if !hello.Resumed {
+			t.lastSeq = 0
+		}
+		var resend []*wsCall
+		for _, call := range t.pending {
+			if !hello.Resumed {
+				// The server has no record of earlier requests.
+				call.sent = false
+			}
+			if !call.sent {
+				resend = append(resend, call)
+			}
+		}
+		t.mu.Unlock()
+
+		go t.readLoop(conn)
+		go t.pingLoop(conn)
+		for _, call := range resend {
+			t.send(context.Background(), conn, call)
+		}
+		return conn, nil
+	}
+}
+
+// dial opens a connection, resuming the session named by token if it is
+// non-empty, and reads the server's hello.
+func (t *wsTransport) dial(ctx context.Context, token string, lastSeq int64) (*websocket.Conn, wsMessage, error) {
+	path := t.cfg.Path
+	if token != "" {
+		path += "?" + url.Values{"resume": {token}, "last_seq": {strconv.FormatInt(lastSeq, 10)}}.Encode()
+	}
+	req, err := t.c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, wsMessage{}, err
+	}
+	t.c.injectTrace(ctx, req)
+	if err := t.c.authenticate(req); err != nil {
+		return nil, wsMessage{}, err
+	}
+	req, opened := t.c.place(req)
+	if err := t.c.sign(req); err != nil {
+		opened(err)
+		return nil, wsMessage{}, err
+	}
+	u := *req.URL
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+
+	conn, _, err := websocket.Dial(ctx, u.String(), &websocket.DialOptions{
+		HTTPClient: t.c.httpClient,
+		HTTPHeader: req.Header,
+	})
+	opened(err)
+	if err != nil {
+		return nil, wsMessage{}, fmt.Errorf("websocket dial: %w", err)
+	}
+	conn.SetReadLimit(wsReadLimit)
+
+	var hello wsMessage
+	if err := wsjson.Read(ctx, conn, &hello); err != nil {
+		conn.CloseNow()
+		return nil, wsMessage{}, fmt.Errorf("websocket handshake: %w", err)
+	}
+	if hello.Type != "hello" || hello.ResumeToken == "" {
+		conn.CloseNow()
+		return nil, wsMessage{}, fmt.Errorf("websocket handshake: unexpected %q message", hello.Type)
+	}
+	return conn, hello, nil
+}
+
+// readLoop dispatches server messages to pending calls until conn fails.
+func (t *wsTransport) readLoop(conn *websocket.Conn) {
+	for {
+		var m wsMessage
+		if err := wsjson.Read(context.Background(), conn, &m); err != nil {
+			t.connLost(conn, err)
+			return
+		}
+
+		if m.Type == "shutdown" {
+			// The server is going away; calls it has not answered will not
+			// be answered on a resumed session either.
+			t.failPending(&APIError{StatusCode: http.StatusServiceUnavailable, Code: "shutting_down", Message: m.Status})
+			continue
+		}
+
+		t.mu.Lock()
+		if m.Seq != 0 && m.Seq <= t.lastSeq {
+			// Already seen before a reconnect.
+			t.mu.Unlock()
+			continue
+		}
+		t.lastSeq = max(t.lastSeq, m.Seq)
+		call := t.pending[m.ID]
+		t.mu.Unlock()
+		if call == nil {
+			continue
+		}
+
+		switch m.Type {
+		case "status":
+			if call.onStatus != nil {
+				call.onStatus(m.Status)
+			}
+		case "result", "error":
+			call.finish(wsOutcome{msg: m})
+		}
+	}
+}
+
+// pingLoop checks conn's liveness and closes it when a ping goes
+// unanswered, which readLoop then observes.
+func (t *wsTransport) pingLoop(conn *websocket.Conn) {
+	tick := time.NewTicker(t.cfg.PingInterval)
+	defer tick.Stop()
+	for range tick.C {
+		t.mu.Lock()
+		current := t.conn == conn
+		t.mu.Unlock()
+		if !current {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.cfg.PingInterval)
+		err := conn.Ping(ctx)
+		cancel()
+		if err != nil {
+			conn.CloseNow()
+			return
+		}
+	}
+}
+
+// connLost forgets conn and, if calls are waiting on it, reconnects in the
+// background.
+func (t *wsTransport) connLost(conn *websocket.Conn, cause error) {
+	conn.CloseNow()
+	t.mu.Lock()
+	if t.conn == conn {
+		t.conn = nil
+	}
+	reconnect := !t.closed && len(t.pending) > 0
+	t.mu.Unlock()
+	if reconnect {
+		go t.reconnect(cause)
+	}
+}
+
+func (t *wsTransport) reconnect(cause error) {
+	for attempt := 1; attempt <= t.cfg.MaxReconnects; attempt++ {
+		time.Sleep(time.Duration(attempt) * t.cfg.ReconnectDelay)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := t.connect(ctx)
+		cancel()
+		if err == nil || errors.Is(err, ErrTransportClosed) {
+			return
+		}
+		cause = err
+	}
+	t.failPending(fmt.Errorf("websocket connection lost after %d reconnect attempts: %w", t.cfg.MaxReconnects, cause))
+}
+
+func (t *wsTransport) failPending(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, call := range t.pending {
+		call.finish(wsOutcome{err: err})
+	}
+}
+
+// Close closes the connection and fails any pending calls.
+func (t *wsTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	conn := t.conn
+	t.conn = nil
+	t.mu.Unlock()
+	t.failPending(ErrTransportClosed)
+	if conn != nil {
+		return conn.Close(websocket.StatusNormalClosure, "")
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+// Package wire holds the types of the MPC server's HTTP API, generated from
+// its OpenAPI document, api/openapi.json. They follow the server's contract
+// field for field, and the client's own request and response types are
+// checked against them. Run go generate, or make openapi, after changing
+// the server's routes or types.
+package wire
+
+//go:generate sh -c "cd ../.. && go run ./cmd/openapigen spec -o api/openapi.json && go run ./cmd/openapigen models -spec api/openapi.json -package wire -o mpcclient/wire/models_gen.go"
@@ -0,0 +1,297 @@
+// Code generated by openapigen from api/openapi.json. DO NOT EDIT.
+
+package wire
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// APIKey is the APIKey schema of the MPC server's API.
+type APIKey struct {
+	Agents      []string `json:"agents,omitempty"`
+	Burst       int      `json:"burst,omitempty"`
+	DailyTokens int      `json:"daily_tokens,omitempty"`
+	Key         string   `json:"key,omitempty"`
+	Name        string   `json:"name"`
+	RateLimit   float64  `json:"rate_limit,omitempty"`
+}
+
+// APIKeyInfo is the APIKeyInfo schema of the MPC server's API.
+type APIKeyInfo struct {
+	Agents          []string `json:"agents,omitempty"`
+	Burst           int      `json:"burst,omitempty"`
+	DailyTokens     int      `json:"daily_tokens,omitempty"`
+	Key             string   `json:"key,omitempty"`
+	Name            string   `json:"name"`
+	RateLimit       float64  `json:"rate_limit,omitempty"`
+	TokensUsedToday int      `json:"tokens_used_today"`
+}
+
+// APIKeyList is the APIKeyList schema of the MPC server's API.
+type APIKeyList struct {
+	Count int          `json:"count"`
+	Keys  []APIKeyInfo `json:"keys"`
+}
+
+// AgentInfo is the AgentInfo schema of the MPC server's API.
+type AgentInfo struct {
+	Capabilities    []string        `json:"capabilities,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	ExamplePrompts  []string        `json:"example_prompts,omitempty"`
+	Formats         []string        `json:"formats,omitempty"`
+	MaxTokens       int             `json:"max_tokens,omitempty"`
+	Models          []string        `json:"models,omitempty"`
+	Name            string          `json:"name"`
+	Parameters      []ParameterInfo `json:"parameters,omitempty"`
+	ProtocolVersion int             `json:"protocol_version,omitempty"`
+	RequiredContext []string        `json:"required_context,omitempty"`
+	Version         string          `json:"version,omitempty"`
+}
+
+// AgentList is the AgentList schema of the MPC server's API.
+type AgentList struct {
+	Agents     []AgentInfo `json:"agents"`
+	Count      int         `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// AgentRequest is the AgentRequest schema of the MPC server's API.
+type AgentRequest struct {
+	Board       string               `json:"board,omitempty"`
+	Context     map[string]any       `json:"context,omitempty"`
+	Format      string               `json:"format,omitempty"`
+	Generation  *Generation          `json:"generation,omitempty"`
+	Messages    []Message            `json:"messages,omitempty"`
+	Metadata    map[string]string    `json:"metadata,omitempty"`
+	Parameters  map[string]any       `json:"parameters,omitempty"`
+	Priority    AgentRequestPriority `json:"priority,omitempty"`
+	Prompt      string               `json:"prompt"`
+	Requires    *Requirements        `json:"requires,omitempty"`
+	ToolResults []ToolResult         `json:"tool_results,omitempty"`
+	Tools       []ToolSpec           `json:"tools,omitempty"`
+}
+
+// AgentResponse is the AgentResponse schema of the MPC server's API.
+type AgentResponse struct {
+	Agent           string          `json:"agent"`
+	AgentVersion    string          `json:"agent_version,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	ExecutionTimeMS float64         `json:"execution_time_ms"`
+	Format          string          `json:"format,omitempty"`
+	Metadata        map[string]any  `json:"metadata,omitempty"`
+	Prompt          string          `json:"prompt"`
+	ProtocolVersion int             `json:"protocol_version"`
+	RequestID       string          `json:"request_id"`
+	Result          string          `json:"result"`
+	Status          string          `json:"status"`
+	Timestamp       string          `json:"timestamp"`
+	ToolCalls       []ToolCall      `json:"tool_calls,omitempty"`
+	Usage           *Usage          `json:"usage,omitempty"`
+}
+
+// AgentStatus is the AgentStatus schema of the MPC server's API.
+type AgentStatus struct {
+	Error  string `json:"error,omitempty"`
+	Status string `json:"status"`
+}
+
+// Board is the Board schema of the MPC server's API.
+type Board struct {
+	Entries   []BoardEntry `json:"entries"`
+	ExpiresAt time.Time    `json:"expires_at,omitzero"`
+	Session   string       `json:"session"`
+}
+
+// BoardEntry is the BoardEntry schema of the MPC server's API.
+type BoardEntry struct {
+	Key       string          `json:"key"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// EmbedRequest is the EmbedRequest schema of the MPC server's API.
+type EmbedRequest struct {
+	Inputs []string `json:"inputs"`
+}
+
+// EmbedResponse is the EmbedResponse schema of the MPC server's API.
+type EmbedResponse struct {
+	Agent           string      `json:"agent"`
+	Dimensions      int         `json:"dimensions"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	ExecutionTimeMS float64     `json:"execution_time_ms"`
+	RequestID       string      `json:"request_id"`
+}
+
+// Error is the Error schema of the MPC server's API.
+type Error struct {
+	Code      string          `json:"code,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	Error     string          `json:"error"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+// Generation is the Generation schema of the MPC server's API.
+type Generation struct {
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Temperature float64  `json:"temperature,omitempty"`
+}
+
+// Health is the Health schema of the MPC server's API.
+type Health struct {
+	Agents  int    `json:"agents"`
+	Status  string `json:"status"`
+	Uptime  string `json:"uptime"`
+	Version string `json:"version"`
+}
+
+// Job is the Job schema of the MPC server's API.
+type Job struct {
+	Agent       string          `json:"agent"`
+	CallbackURL string          `json:"callback_url,omitempty"`
+	CompletedAt time.Time       `json:"completed_at,omitzero"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Error       *JobError       `json:"error,omitempty"`
+	ExpiresAt   time.Time       `json:"expires_at,omitzero"`
+	ID          string          `json:"id"`
+	Owner       string          `json:"owner,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	Schedule    string          `json:"schedule,omitempty"`
+	Status      JobStatus       `json:"status"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobError is the JobError schema of the MPC server's API.
+type JobError struct {
+	Code       string          `json:"code,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	Error      string          `json:"error"`
+	StatusCode int             `json:"status_code"`
+}
+
+// JobList is the JobList schema of the MPC server's API.
+type JobList struct {
+	Count      int    `json:"count"`
+	Jobs       []Job  `json:"jobs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Message is the Message schema of the MPC server's API.
+type Message struct {
+	Content string `json:"content"`
+	Role    string `json:"role"`
+}
+
+// ParameterInfo is the ParameterInfo schema of the MPC server's API.
+type ParameterInfo struct {
+	Description string `json:"description,omitempty"`
+	Name        string `json:"name"`
+	Required    bool   `json:"required,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
+
+// Readiness is the Readiness schema of the MPC server's API.
+type Readiness struct {
+	Agents  map[string]AgentStatus `json:"agents"`
+	Status  string                 `json:"status"`
+	Uptime  string                 `json:"uptime"`
+	Version string                 `json:"version"`
+}
+
+// ReloadReport is the ReloadReport schema of the MPC server's API.
+type ReloadReport struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Replaced []string `json:"replaced"`
+}
+
+// Requirements is the Requirements schema of the MPC server's API.
+type Requirements struct {
+	Capabilities    []string `json:"capabilities,omitempty"`
+	MinVersion      string   `json:"min_version,omitempty"`
+	ProtocolVersion int      `json:"protocol_version,omitempty"`
+}
+
+// Schedule is the Schedule schema of the MPC server's API.
+type Schedule struct {
+	Agent      string       `json:"agent"`
+	Jitter     string       `json:"jitter,omitempty"`
+	Name       string       `json:"name"`
+	Owner      string       `json:"owner,omitempty"`
+	Request    AgentRequest `json:"request"`
+	Spec       string       `json:"spec"`
+	WebhookURL string       `json:"webhook_url,omitempty"`
+}
+
+// ScheduleList is the ScheduleList schema of the MPC server's API.
+type ScheduleList struct {
+	Count     int              `json:"count"`
+	Schedules []ScheduleStatus `json:"schedules"`
+}
+
+// ScheduleStatus is the ScheduleStatus schema of the MPC server's API.
+type ScheduleStatus struct {
+	Agent      string       `json:"agent"`
+	Jitter     string       `json:"jitter,omitempty"`
+	LastJob    string       `json:"last_job,omitempty"`
+	LastRun    time.Time    `json:"last_run,omitzero"`
+	Name       string       `json:"name"`
+	NextRun    time.Time    `json:"next_run,omitzero"`
+	Owner      string       `json:"owner,omitempty"`
+	Request    AgentRequest `json:"request"`
+	Running    bool         `json:"running"`
+	Skipped    int          `json:"skipped"`
+	Spec       string       `json:"spec"`
+	WebhookURL string       `json:"webhook_url,omitempty"`
+}
+
+// ToolCall is the ToolCall schema of the MPC server's API.
+type ToolCall struct {
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+}
+
+// ToolResult is the ToolResult schema of the MPC server's API.
+type ToolResult struct {
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Output    json.RawMessage `json:"output,omitempty"`
+}
+
+// ToolSpec is the ToolSpec schema of the MPC server's API.
+type ToolSpec struct {
+	Description string          `json:"description,omitempty"`
+	Name        string          `json:"name"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// Usage is the Usage schema of the MPC server's API.
+type Usage struct {
+	CompletionTokens int `json:"completion_tokens"`
+	PromptTokens     int `json:"prompt_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// AgentRequestPriority enumerates the values of a string property.
+type AgentRequestPriority string
+
+const (
+	AgentRequestPriorityInteractive AgentRequestPriority = "interactive"
+	AgentRequestPriorityBatch       AgentRequestPriority = "batch"
+)
+
+// JobStatus enumerates the values of a string property.
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
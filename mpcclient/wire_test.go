@@ -0,0 +1,69 @@
+package mpcclient
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient/wire"
+)
+
+// jsonFields returns the JSON names of t's fields, embedded structs' included.
+func jsonFields(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			for n := range jsonFields(f.Type) {
+				names[n] = true
+			}
+		case f.IsExported():
+			if name == "" {
+				name = f.Name
+			}
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// TestWireContract checks that the client's types carry every field of the
+// server's, as described by the OpenAPI document.
+func TestWireContract(t *testing.T) {
+	for _, tt := range []struct {
+		client, server any
+	}{
+		{AgentRequest{}, wire.AgentRequest{}},
+		{AgentResponse{}, wire.AgentResponse{}},
+		{AgentInfo{}, wire.AgentInfo{}},
+		{ParameterInfo{}, wire.ParameterInfo{}},
+		{Job{}, wire.Job{}},
+		{Usage{}, wire.Usage{}},
+		{ToolCall{}, wire.ToolCall{}},
+		{ToolSpec{}, wire.ToolSpec{}},
+		{ToolResult{}, wire.ToolResult{}},
+		{Message{}, wire.Message{}},
+		{HealthStatus{}, wire.Health{}},
+		{ReadyStatus{}, wire.Readiness{}},
+		{AgentAvailability{}, wire.AgentStatus{}},
+		{embedRequest{}, wire.EmbedRequest{}},
+		{embedResponse{}, wire.EmbedResponse{}},
+		{Board{}, wire.Board{}},
+		{BoardEntry{}, wire.BoardEntry{}},
+		{Generation{}, wire.Generation{}},
+		{Requirements{}, wire.Requirements{}},
+		{agentList{}, wire.AgentList{}},
+		{jobList{}, wire.JobList{}},
+	} {
+		client, server := reflect.TypeOf(tt.client), reflect.TypeOf(tt.server)
+		have := jsonFields(client)
+		for name := range jsonFields(server) {
+			if !have[name] {
+				t.Errorf("%v has no field for %s.%s", client, server.Name(), name)
+			}
+		}
+	}
+}
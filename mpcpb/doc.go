@@ -0,0 +1,6 @@
+// Package mpcpb holds the protobuf messages and gRPC stubs of the MPC
+// protocol, generated from proto/mpc/v1/mpc.proto with buf. Run go generate
+// after editing the schema.
+package mpcpb
+
+//go:generate sh -c "cd ../proto && buf generate"
@@ -0,0 +1,259 @@
+// The MPC protocol over gRPC. It mirrors the HTTP+JSON API: fields holding
+// free-form JSON, such as tool schemas and structured payloads, carry the
+// JSON encoding as bytes.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: mpc/v1/mpc.proto
+
+package mpcpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MPC_Invoke_FullMethodName        = "/mpc.v1.MPC/Invoke"
+	MPC_Stream_FullMethodName        = "/mpc.v1.MPC/Stream"
+	MPC_ListAgents_FullMethodName    = "/mpc.v1.MPC/ListAgents"
+	MPC_DescribeAgent_FullMethodName = "/mpc.v1.MPC/DescribeAgent"
+)
+
+// MPCClient is the client API for MPC service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// MPC serves the agents registered with an MPC server.
+type MPCClient interface {
+	// Invoke runs one agent call.
+	Invoke(ctx context.Context, in *InvokeRequest, opts ...grpc.CallOption) (*AgentResponse, error)
+	// Stream runs one agent call, delivering the status updates the agent
+	// reports as they happen. The last chunk carries the answer, a finish
+	// reason and the full response.
+	Stream(ctx context.Context, in *InvokeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error)
+	// ListAgents returns the registered agents.
+	ListAgents(ctx context.Context, in *ListAgentsRequest, opts ...grpc.CallOption) (*ListAgentsResponse, error)
+	// DescribeAgent returns the metadata of one agent.
+	DescribeAgent(ctx context.Context, in *DescribeAgentRequest, opts ...grpc.CallOption) (*AgentInfo, error)
+}
+
+type mPCClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMPCClient(cc grpc.ClientConnInterface) MPCClient {
+	return &mPCClient{cc}
+}
+
+func (c *mPCClient) Invoke(ctx context.Context, in *InvokeRequest, opts ...grpc.CallOption) (*AgentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AgentResponse)
+	err := c.cc.Invoke(ctx, MPC_Invoke_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mPCClient) Stream(ctx context.Context, in *InvokeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MPC_ServiceDesc.Streams[0], MPC_Stream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[InvokeRequest, Chunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MPC_StreamClient = grpc.ServerStreamingClient[Chunk]
+
+func (c *mPCClient) ListAgents(ctx context.Context, in *ListAgentsRequest, opts ...grpc.CallOption) (*ListAgentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAgentsResponse)
+	err := c.cc.Invoke(ctx, MPC_ListAgents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mPCClient) DescribeAgent(ctx context.Context, in *DescribeAgentRequest, opts ...grpc.CallOption) (*AgentInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AgentInfo)
+	err := c.cc.Invoke(ctx, MPC_DescribeAgent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MPCServer is the server API for MPC service.
+// All implementations must embed UnimplementedMPCServer
+// for forward compatibility.
+//
+// MPC serves the agents registered with an MPC server.
+type MPCServer interface {
+	// Invoke runs one agent call.
+	Invoke(context.Context, *InvokeRequest) (*AgentResponse, error)
+	// Stream runs one agent call, delivering the status updates the agent
+	// reports as they happen. The last chunk carries the answer, a finish
+	// reason and the full response.
+	Stream(*InvokeRequest, grpc.ServerStreamingServer[Chunk]) error
+	// ListAgents returns the registered agents.
+	ListAgents(context.Context, *ListAgentsRequest) (*ListAgentsResponse, error)
+	// DescribeAgent returns the metadata of one agent.
+	DescribeAgent(context.Context, *DescribeAgentRequest) (*AgentInfo, error)
+	mustEmbedUnimplementedMPCServer()
+}
+
+// UnimplementedMPCServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMPCServer struct{}
+
+func (UnimplementedMPCServer) Invoke(context.Context, *InvokeRequest) (*AgentResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Invoke not implemented")
+}
+func (UnimplementedMPCServer) Stream(*InvokeRequest, grpc.ServerStreamingServer[Chunk]) error {
+	return status.Error(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedMPCServer) ListAgents(context.Context, *ListAgentsRequest) (*ListAgentsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListAgents not implemented")
+}
+func (UnimplementedMPCServer) DescribeAgent(context.Context, *DescribeAgentRequest) (*AgentInfo, error) {
+	return nil, status.Error(codes.Unimplemented, "method DescribeAgent not implemented")
+}
+func (UnimplementedMPCServer) mustEmbedUnimplementedMPCServer() {}
+func (UnimplementedMPCServer) testEmbeddedByValue()             {}
+
+// UnsafeMPCServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MPCServer will
+// result in compilation errors.
+type UnsafeMPCServer interface {
+	mustEmbedUnimplementedMPCServer()
+}
+
+func RegisterMPCServer(s grpc.ServiceRegistrar, srv MPCServer) {
+	// If the following call panics, it indicates UnimplementedMPCServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MPC_ServiceDesc, srv)
+}
+
+func _MPC_Invoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MPCServer).Invoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MPC_Invoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MPCServer).Invoke(ctx, req.(*InvokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MPC_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(InvokeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MPCServer).Stream(m, &grpc.GenericServerStream[InvokeRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MPC_StreamServer = grpc.ServerStreamingServer[Chunk]
+
+func _MPC_ListAgents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAgentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MPCServer).ListAgents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MPC_ListAgents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MPCServer).ListAgents(ctx, req.(*ListAgentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MPC_DescribeAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeAgentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MPCServer).DescribeAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MPC_DescribeAgent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MPCServer).DescribeAgent(ctx, req.(*DescribeAgentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MPC_ServiceDesc is the grpc.ServiceDesc for MPC service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MPC_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mpc.v1.MPC",
+	HandlerType: (*MPCServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Invoke",
+			Handler:    _MPC_Invoke_Handler,
+		},
+		{
+			MethodName: "ListAgents",
+			Handler:    _MPC_ListAgents_Handler,
+		},
+		{
+			MethodName: "DescribeAgent",
+			Handler:    _MPC_DescribeAgent_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _MPC_Stream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mpc/v1/mpc.proto",
+}
@@ -0,0 +1,89 @@
+package mpcserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// keyInfo describes an API key under /admin/keys, without its secret
+// except in the response creating it.
+type keyInfo struct {
+	APIKey
+	TokensUsedToday int `json:"tokens_used_today"`
+}
+
+// keyList is the body of a key listing.
+type keyList struct {
+	Keys  []keyInfo `json:"keys"`
+	Count int       `json:"count"`
+}
+
+// admin wraps an /admin handler with the admin key check.
+func (s *Server) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.keys.isAdmin(credential(r)) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, Errorf(http.StatusUnauthorized, CodeUnauthorized, "admin key required"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	kr := s.keys
+	now := kr.now().UTC()
+	kr.mu.Lock()
+	keys := make([]keyInfo, 0, len(kr.byName))
+	for _, st := range kr.byName {
+		k := st.APIKey
+		k.Key = ""
+		keys = append(keys, keyInfo{APIKey: k, TokensUsedToday: st.usedOn(now)})
+	}
+	kr.mu.Unlock()
+	slices.SortFunc(keys, func(a, b keyInfo) int { return strings.Compare(a.Name, b.Name) })
+	writeJSON(w, http.StatusOK, keyList{Keys: keys, Count: len(keys)})
+}
+
+// handleCreateKey adds the key in the body, generating its secret unless
+// one is given, and returns it with the secret.
+func (s *Server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
+	if _, apiErr := checkContentType(r, "application/json"); apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	var k APIKey
+	if apiErr := s.decodeJSON(w, r, &k); apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if k.Key == "" {
+		k.Key = newAPIKey()
+	}
+	if apiErr := s.keys.add(k); apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	st := s.keys.lookup(k.Key)
+	w.Header().Set("Location", "/admin/keys/"+st.Name)
+	writeJSON(w, http.StatusCreated, keyInfo{APIKey: st.APIKey})
+}
+
+func (s *Server) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.keys.remove(name) {
+		writeError(w, Errorf(http.StatusNotFound, CodeKeyNotFound, "API key %q not found", name))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newAPIKey returns a random key.
+func newAPIKey() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "mpc_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,240 @@
+package mpcserver
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Admission defaults.
+const (
+	DefaultQueueTimeout = 30 * time.Second
+	DefaultRetryAfter   = time.Second
+)
+
+// ConcurrencyLimit bounds the calls an agent runs at once, so that one
+// heavy agent cannot take every worker from the rest. Calls over the limit
+// wait in a queue; calls that find it full, or wait too long, are rejected
+// with a 429 agent_busy error carrying a Retry-After header.
+type ConcurrencyLimit struct {
+	// MaxConcurrent is the most calls the agent runs at once. Zero leaves
+	// the agent unlimited.
+	MaxConcurrent int
+	// QueueDepth is how many calls may wait for a free slot. When zero,
+	// calls over MaxConcurrent are rejected at once.
+	QueueDepth int
+	// MaxPerKey is the most calls one caller runs at once, leaving the
+	// other slots to other callers; zero leaves callers to share all of
+	// them. Callers are told apart by API key or, on servers without keys,
+	// by the "user" metadata entry.
+	MaxPerKey int
+	// QueueTimeout bounds the wait for a slot; DefaultQueueTimeout when
+	// zero.
+	QueueTimeout time.Duration
+	// RetryAfter is the delay rejected callers are asked to wait before
+	// trying again; DefaultRetryAfter when zero.
+	RetryAfter time.Duration
+}
+
+// ConcurrencyLimiter is implemented by agents that declare a concurrency
+// limit. WithConcurrencyLimits overrides it.
+type ConcurrencyLimiter interface {
+	ConcurrencyLimit() ConcurrencyLimit
+}
+
+// WithConcurrencyLimits sets the concurrency limits of agents by name,
+// replacing any they declare as ConcurrencyLimiters.
+func WithConcurrencyLimits(limits map[string]ConcurrencyLimit) Option {
+	return func(s *Server) {
+		for name, l := range limits {
+			s.admission.limits[name] = l
+		}
+	}
+}
+
+// admission holds a gate for every agent with a concurrency limit.
+type admission struct {
+	mu     sync.Mutex
+	limits map[string]ConcurrencyLimit
+	gates  map[string]*gate
+}
+
+func newAdmission() *admission {
+	return &admission{limits: make(map[string]ConcurrencyLimit), gates: make(map[string]*gate)}
+}
+
+// forget drops the gates of the named agents, for agents a reload
+// replaced or removed to start afresh. Calls holding a slot of an old gate
+// still release it.
+func (a *admission) forget(names ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, name := range names {
+		delete(a.gates, name)
+	}
+}
+
+// gate returns the gate of the agent registered under name, or nil if it
+// is unlimited.
+func (a *admission) gate(name string, agent Agent) *gate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if g, ok := a.gates[name]; ok {
+		return g
+	}
+	l, ok := a.limits[name]
+	if lim, isLimiter := agent.(ConcurrencyLimiter); !ok && isLimiter {
+		l = lim.ConcurrencyLimit()
+	}
+	var g *gate
+	if l.MaxConcurrent > 0 {
+		if l.QueueTimeout <= 0 {
+			l.QueueTimeout = DefaultQueueTimeout
+		}
+		if l.RetryAfter <= 0 {
+			l.RetryAfter = DefaultRetryAfter
+		}
+		g = &gate{name: name, limit: l}
+	}
+	a.gates[name] = g
+	return g
+}
+
+// gate admits an agent's calls within its limit, scheduling those waiting
+// for a slot: interactive calls ahead of batch ones and, within a class,
+// callers with the fewest calls running first, so that one caller's bulk
+// work cannot take every slot from the rest.
+type gate struct {
+	name  string
+	limit ConcurrencyLimit
+
+	mu      sync.Mutex
+	running int
+	perKey  map[string]int
+	queue   []*waiter
+}
+
+// waiter is a call waiting in a gate's queue.
+type waiter struct {
+	key      string
+	batch    bool
+	admitted chan struct{} // closed once the call holds a slot
+}
+
+// acquire waits for a slot for a call of the given fairness key and
+// priority, and returns the function releasing it, or the error to reject
+// the call with. A nil gate admits every call.
+func (g *gate) acquire(ctx context.Context, key string, priority Priority) (release func(), apiErr *Error) {
+	if g == nil {
+		return func() {}, nil
+	}
+	w := &waiter{key: key, batch: priority == PriorityBatch, admitted: make(chan struct{})}
+	release = func() { g.release(key) }
+
+	g.mu.Lock()
+	g.queue = append(g.queue, w)
+	g.dispatch()
+	select {
+	case <-w.admitted:
+		g.mu.Unlock()
+		return release, nil
+	default:
+	}
+	if len(g.queue) > g.limit.QueueDepth {
+		g.remove(w)
+		g.mu.Unlock()
+		if g.limit.MaxPerKey > 0 && g.running < g.limit.MaxConcurrent {
+			return nil, g.busy("caller is at its limit of %d concurrent calls to agent %q", g.limit.MaxPerKey, g.name)
+		}
+		return nil, g.busy("agent %q is at its limit of %d concurrent calls", g.name, g.limit.MaxConcurrent)
+	}
+	g.mu.Unlock()
+
+	timer := time.NewTimer(g.limit.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.admitted:
+		return release, nil
+	case <-timer.C:
+		apiErr = g.busy("agent %q had no free slot within %v", g.name, g.limit.QueueTimeout)
+	case <-ctx.Done():
+		apiErr = callError(ctx, ctx.Err())
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-w.admitted:
+		// Admitted while giving up: pass the slot on.
+		g.free(key)
+	default:
+		g.remove(w)
+	}
+	return nil, apiErr
+}
+
+// release frees a slot held by a call of key.
+func (g *gate) release(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.free(key)
+}
+
+// free frees a slot held by a call of key and admits the next call. g.mu
+// must be held.
+func (g *gate) free(key string) {
+	g.running--
+	if g.perKey[key]--; g.perKey[key] == 0 {
+		delete(g.perKey, key)
+	}
+	g.dispatch()
+}
+
+// dispatch admits waiting calls while slots are free. g.mu must be held.
+func (g *gate) dispatch() {
+	for g.running < g.limit.MaxConcurrent {
+		next := -1
+		for i, w := range g.queue {
+			if g.limit.MaxPerKey > 0 && g.perKey[w.key] >= g.limit.MaxPerKey {
+				continue
+			}
+			if next < 0 || g.before(w, g.queue[next]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return
+		}
+		w := g.queue[next]
+		g.queue = slices.Delete(g.queue, next, next+1)
+		if g.perKey == nil {
+			g.perKey = make(map[string]int)
+		}
+		g.running++
+		g.perKey[w.key]++
+		close(w.admitted)
+	}
+}
+
+// before reports whether w is to be admitted ahead of v, which arrived
+// earlier.
+func (g *gate) before(w, v *waiter) bool {
+	if w.batch != v.batch {
+		return !w.batch
+	}
+	return g.perKey[w.key] < g.perKey[v.key]
+}
+
+// remove takes w out of the queue. g.mu must be held.
+func (g *gate) remove(w *waiter) {
+	if i := slices.Index(g.queue, w); i >= 0 {
+		g.queue = slices.Delete(g.queue, i, i+1)
+	}
+}
+
+func (g *gate) busy(format string, args ...any) *Error {
+	e := Errorf(http.StatusTooManyRequests, CodeAgentBusy, format, args...)
+	e.RetryAfter = g.limit.RetryAfter
+	return e
+}
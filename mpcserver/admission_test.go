@@ -0,0 +1,238 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// limitedAgent is a blockingAgent declaring its own concurrency limit.
+type limitedAgent struct {
+	blockingAgent
+	limit mpcserver.ConcurrencyLimit
+}
+
+func (a limitedAgent) ConcurrencyLimit() mpcserver.ConcurrencyLimit { return a.limit }
+
+// callAsync calls agent in the background and returns where its error
+// will arrive.
+func callAsync(c *mpcclient.Client, agent string) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.CallAgent(context.Background(), agent, "x")
+		errc <- err
+	}()
+	return errc
+}
+
+func TestConcurrencyLimitRejectsExcess(t *testing.T) {
+	agent := newBlockingAgent(4)
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"heavy": agent}, mpcserver.WithConcurrencyLimits(map[string]mpcserver.ConcurrencyLimit{
+		"heavy": {MaxConcurrent: 1, RetryAfter: 1500 * time.Millisecond},
+	}))
+	ctx := context.Background()
+
+	first := callAsync(c, "heavy")
+	<-agent.started
+
+	_, err := c.CallAgent(ctx, "heavy", "y")
+	var apiErr *mpcclient.APIError
+	if !errors.Is(err, mpcclient.ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.Code != "agent_busy" {
+		t.Fatalf("call over the limit: err = %v, want agent_busy", err)
+	}
+	if apiErr.RetryAfter != 2*time.Second {
+		t.Errorf("RetryAfter = %v, want 2s", apiErr.RetryAfter)
+	}
+	if _, err := c.CallAgent(ctx, "echo", "z"); err != nil {
+		t.Errorf("other agent while heavy is busy: %v", err)
+	}
+
+	res, err := http.Post(c.BaseURL()+"/agent/heavy", "application/json", strings.NewReader(`{"prompt":"y"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "2" {
+		t.Errorf("raw call over the limit = %d, Retry-After %q", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+
+	close(agent.release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(ctx, "heavy", "y"); err != nil {
+		t.Errorf("call after the slot was freed: %v", err)
+	}
+}
+
+func TestConcurrencyLimitQueues(t *testing.T) {
+	agent := newBlockingAgent(4)
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"heavy": agent}, mpcserver.WithConcurrencyLimits(map[string]mpcserver.ConcurrencyLimit{
+		"heavy": {MaxConcurrent: 1, QueueDepth: 1},
+	}))
+
+	first := callAsync(c, "heavy")
+	<-agent.started
+	queued := callAsync(c, "heavy")
+	// Give the second call time to take the only place in the queue.
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.CallAgent(context.Background(), "heavy", "z"); !errors.Is(err, mpcclient.ErrRateLimited) {
+		t.Fatalf("call over a full queue: err = %v, want agent_busy", err)
+	}
+
+	close(agent.release)
+	for _, errc := range []<-chan error{first, queued} {
+		if err := <-errc; err != nil {
+			t.Errorf("admitted call: %v", err)
+		}
+	}
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	agent := newBlockingAgent(4)
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"heavy": agent}, mpcserver.WithConcurrencyLimits(map[string]mpcserver.ConcurrencyLimit{
+		"heavy": {MaxConcurrent: 1, QueueDepth: 1, QueueTimeout: 20 * time.Millisecond},
+	}))
+
+	first := callAsync(c, "heavy")
+	<-agent.started
+	start := time.Now()
+	_, err := c.CallAgent(context.Background(), "heavy", "y")
+	if !errors.Is(err, mpcclient.ErrRateLimited) {
+		t.Errorf("queued call past its timeout: err = %v, want agent_busy", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("rejected after %v, before the queue timeout", waited)
+	}
+	close(agent.release)
+	<-first
+}
+
+func TestConcurrencyLimitDeclaredByAgent(t *testing.T) {
+	agent := limitedAgent{blockingAgent: newBlockingAgent(1), limit: mpcserver.ConcurrencyLimit{MaxConcurrent: 1}}
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"limited": agent})
+
+	first := callAsync(c, "limited")
+	<-agent.started
+	if _, err := c.CallAgent(context.Background(), "limited", "y"); !errors.Is(err, mpcclient.ErrRateLimited) {
+		t.Errorf("call over the declared limit: err = %v, want agent_busy", err)
+	}
+	close(agent.release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// orderAgent reports each call's prompt as it starts, then holds it until
+// told to finish one.
+type orderAgent struct {
+	started chan string
+	finish  chan struct{}
+}
+
+func (a orderAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	a.started <- req.Prompt
+	select {
+	case <-a.finish:
+		return mpcserver.Response{Result: req.Prompt}, nil
+	case <-ctx.Done():
+		return mpcserver.Response{}, ctx.Err()
+	}
+}
+
+// callOrdered calls the ordered agent in the background, giving the call
+// time to reach the queue.
+func callOrdered(c *mpcclient.Client, prompt string, opts ...mpcclient.CallOption) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.CallAgent(context.Background(), "ordered", prompt, opts...)
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	return errc
+}
+
+func as(user string) mpcclient.CallOption {
+	return mpcclient.WithMetadata(map[string]string{"user": user})
+}
+
+func TestInteractiveCallsGoFirst(t *testing.T) {
+	agent := orderAgent{started: make(chan string, 8), finish: make(chan struct{})}
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"ordered": agent},
+		mpcserver.WithConcurrencyLimits(map[string]mpcserver.ConcurrencyLimit{"ordered": {MaxConcurrent: 1, QueueDepth: 4}}))
+	var calls []<-chan error
+	calls = append(calls, callOrdered(c, "running"))
+	<-agent.started
+	calls = append(calls, callOrdered(c, "batch", mpcclient.WithPriority(mpcclient.PriorityBatch)))
+	calls = append(calls, callOrdered(c, "chat"))
+
+	for _, want := range []string{"chat", "batch"} {
+		agent.finish <- struct{}{}
+		if got := <-agent.started; got != want {
+			t.Errorf("admitted %q, want %q", got, want)
+		}
+	}
+	agent.finish <- struct{}{}
+	for _, errc := range calls {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFairShareAcrossCallers(t *testing.T) {
+	agent := orderAgent{started: make(chan string, 8), finish: make(chan struct{})}
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"ordered": agent},
+		mpcserver.WithConcurrencyLimits(map[string]mpcserver.ConcurrencyLimit{"ordered": {MaxConcurrent: 2, QueueDepth: 4}}))
+	var calls []<-chan error
+	for _, prompt := range []string{"alice 1", "alice 2"} {
+		calls = append(calls, callOrdered(c, prompt, as("alice")))
+		<-agent.started
+	}
+	calls = append(calls, callOrdered(c, "alice 3", as("alice")))
+	calls = append(calls, callOrdered(c, "bob 1", as("bob")))
+
+	// Bob has no call running, so his goes ahead of Alice's third.
+	agent.finish <- struct{}{}
+	if got := <-agent.started; got != "bob 1" {
+		t.Errorf("admitted %q, want bob's call", got)
+	}
+	for range 3 {
+		agent.finish <- struct{}{}
+	}
+	for _, errc := range calls {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMaxPerKey(t *testing.T) {
+	agent := orderAgent{started: make(chan string, 8), finish: make(chan struct{})}
+	_, c := newTestServer(t, map[string]mpcserver.Agent{"ordered": agent},
+		mpcserver.WithConcurrencyLimits(map[string]mpcserver.ConcurrencyLimit{"ordered": {MaxConcurrent: 2, MaxPerKey: 1}}))
+	first := callOrdered(c, "alice 1", as("alice"))
+	<-agent.started
+	_, err := c.CallAgent(context.Background(), "ordered", "alice 2", as("alice"))
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "agent_busy" || !strings.Contains(apiErr.Message, "caller") {
+		t.Errorf("caller over its share: err = %v, want agent_busy", err)
+	}
+	bob := callOrdered(c, "bob 1", as("bob"))
+	if got := <-agent.started; got != "bob 1" {
+		t.Errorf("admitted %q, want bob's call", got)
+	}
+	agent.finish <- struct{}{}
+	agent.finish <- struct{}{}
+	for _, errc := range []<-chan error{first, bob} {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package mpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Request is an agent invocation as decoded from the wire.
+type Request struct {
+	// Agent is the name the request was routed by.
+	Agent      string         `json:"-"`
+	Prompt     string         `json:"prompt"`
+	Context    map[string]any `json:"context,omitempty"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+	// Messages is the conversation preceding Prompt, oldest first.
+	Messages []Message `json:"messages,omitempty"`
+	// Tools describes the client-side tools the agent may call by
+	// returning Response.ToolCalls instead of a final answer.
+	Tools []ToolSpec `json:"tools,omitempty"`
+	// ToolResults answers the tool calls of earlier rounds, oldest first.
+	ToolResults []ToolResult `json:"tool_results,omitempty"`
+	// Format is the response format the caller asks for, such as
+	// FormatJSON. Empty leaves the choice to the agent.
+	Format string `json:"format,omitempty"`
+	// Metadata labels the call for attribution, such as by user, team or
+	// workshop exercise. It is recorded in logs and audit records.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Priority is the call's scheduling class, PriorityInteractive when
+	// empty.
+	Priority Priority `json:"priority,omitempty"`
+	// Board is the session ID of the shared context board the agent may
+	// read and write with BoardFrom, if any.
+	Board string `json:"board,omitempty"`
+	// Generation carries the model and sampling parameters asked for, if
+	// any, checked against the agent's AgentInfo.
+	Generation *Generation `json:"generation,omitempty"`
+	// Requires is what the call needs of its agent, if anything, checked
+	// against the agent's AgentInfo.
+	Requires *Requirements `json:"requires,omitempty"`
+	// Attachments are the files uploaded with the request, if it was sent
+	// as multipart form data.
+	Attachments []Attachment `json:"-"`
+	// RequestID identifies the invocation in responses and logs.
+	RequestID string `json:"-"`
+}
+
+// Response formats a caller may ask for in Request.Format.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// Message is one entry of a conversation history. Role is "system",
+// "user" or "assistant".
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ToolSpec describes a tool offered by the client.
+type ToolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON schema of the tool's arguments.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall asks the client to run a tool. ID pairs it with its result.
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// ToolResult is the client's outcome of a tool call. Error is set instead
+// of Output when the tool failed.
+type ToolResult struct {
+	ToolCall
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Response is what an agent returns for a request.
+type Response struct {
+	Result string `json:"result"`
+	// Data optionally carries a structured payload alongside Result.
+	Data json.RawMessage `json:"data,omitempty"`
+	// ToolCalls asks the client to run tools and repeat the request with
+	// their results. Result may be empty when it is set.
+	ToolCalls []ToolCall     `json:"tool_calls,omitempty"`
+	Usage     *Usage         `json:"usage,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	// Format is the format of Result. The server fills it in for agents
+	// declaring a single format.
+	Format string `json:"format,omitempty"`
+}
+
+// Usage reports the tokens an agent consumed.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Agent handles requests routed to it by name. Handle must be safe for
+// concurrent use and should return promptly once ctx is done, which it is
+// when the caller gives up the call; passing ctx on to backend requests
+// stops them then too.
+type Agent interface {
+	Handle(ctx context.Context, req Request) (Response, error)
+}
+
+// AgentFunc adapts a function to the Agent interface.
+type AgentFunc func(ctx context.Context, req Request) (Response, error)
+
+// Handle calls f(ctx, req).
+func (f AgentFunc) Handle(ctx context.Context, req Request) (Response, error) {
+	return f(ctx, req)
+}
+
+// AgentInfo describes an agent in /agents listings.
+type AgentInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Version is the agent's own version, such as "1.2.0", which calls
+	// can require a minimum of.
+	Version string `json:"version,omitempty"`
+	// ProtocolVersion is filled in by the server with the ProtocolVersion
+	// it speaks.
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// Capabilities lists what the agent can do, such as CapabilityTools,
+	// for calls to require and callers to discover.
+	Capabilities    []string        `json:"capabilities,omitempty"`
+	Parameters      []ParameterInfo `json:"parameters,omitempty"`
+	RequiredContext []string        `json:"required_context,omitempty"`
+	ExamplePrompts  []string        `json:"example_prompts,omitempty"`
+	// Formats lists the response formats the agent can produce. Requests
+	// for any other are rejected with CodeUnsupportedFormat; agents that
+	// list none receive every request and may ignore its Format.
+	Formats []string `json:"formats,omitempty"`
+	// Models lists the models the agent can generate with. Requests
+	// naming any other in Generation.Model are rejected with
+	// CodeUnsupportedModel; agents that list none accept any name.
+	Models []string `json:"models,omitempty"`
+	// MaxTokens, if set, is the most tokens a request's
+	// Generation.MaxTokens may ask for.
+	MaxTokens int `json:"max_tokens,omitempty"`
+}
+
+// ParameterInfo describes one parameter an agent accepts.
+type ParameterInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Describer is implemented by agents that publish metadata about
+// themselves. Agents that do not are listed by name only.
+type Describer interface {
+	Describe() AgentInfo
+}
+
+// ErrDuplicateAgent is returned when registering a name already in use.
+var ErrDuplicateAgent = errors.New("agent already registered")
+
+type registration struct {
+	agent Agent
+	info  AgentInfo
+	// calls counts the calls in progress on the agent, so that a reload
+	// replacing it can wait for them before stopping it.
+	calls *callTracker
+}
+
+func newRegistration(name string, a Agent) (registration, error) {
+	if name == "" {
+		return registration{}, errors.New("mpcserver: agent name is required")
+	}
+	if a == nil {
+		return registration{}, fmt.Errorf("mpcserver: agent %q is nil", name)
+	}
+	info := AgentInfo{}
+	if d, ok := a.(Describer); ok {
+		info = d.Describe()
+	}
+	info.Name = name
+	info.ProtocolVersion = ProtocolVersion
+	if !slices.Contains(info.Capabilities, CapabilityStreaming) {
+		info.Capabilities = append(slices.Clip(info.Capabilities), CapabilityStreaming)
+	}
+	if _, ok := a.(Embedder); ok && !slices.Contains(info.Capabilities, CapabilityEmbeddings) {
+		info.Capabilities = append(slices.Clip(info.Capabilities), CapabilityEmbeddings)
+	}
+	return registration{agent: a, info: info, calls: &callTracker{}}, nil
+}
+
+// Registry maps agent names to agents. It is safe for concurrent use.
+// Changes copy the map and swap it in whole, so lookups never wait and see
+// either every agent of a reload or none.
+type Registry struct {
+	// mu serializes changes.
+	mu     sync.Mutex
+	agents atomic.Pointer[map[string]registration]
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	r := &Registry{}
+	r.agents.Store(&map[string]registration{})
+	return r
+}
+
+// Register adds a under name.
+func (r *Registry) Register(name string, a Agent) error {
+	reg, err := newRegistration(name, a)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.snapshot()[name]; ok {
+		return fmt.Errorf("mpcserver: register %q: %w", name, ErrDuplicateAgent)
+	}
+	next := maps.Clone(r.snapshot())
+	next[name] = reg
+	r.agents.Store(&next)
+	return nil
+}
+
+// swap replaces the agents named in set, adds those new to the registry
+// and removes those named in remove, all at once, returning the
+// registrations it replaced or removed.
+func (r *Registry) swap(set map[string]registration, remove []string) []registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := maps.Clone(r.snapshot())
+	var retired []registration
+	for _, name := range remove {
+		if reg, ok := next[name]; ok {
+			retired = append(retired, reg)
+			delete(next, name)
+		}
+	}
+	for name, reg := range set {
+		if old, ok := next[name]; ok {
+			retired = append(retired, old)
+		}
+		next[name] = reg
+	}
+	r.agents.Store(&next)
+	return retired
+}
+
+func (r *Registry) snapshot() map[string]registration {
+	return *r.agents.Load()
+}
+
+// Lookup returns the agent registered under name.
+func (r *Registry) Lookup(name string) (Agent, AgentInfo, bool) {
+	reg, ok := r.snapshot()[name]
+	return reg.agent, reg.info, ok
+}
+
+// acquire returns the registration of name, counting a call on it until
+// release is called. A registration acquired is never retired without
+// waiting for its calls.
+func (r *Registry) acquire(name string) (reg registration, release func(), ok bool) {
+	for {
+		reg, ok = r.snapshot()[name]
+		if !ok {
+			return registration{}, func() {}, false
+		}
+		reg.calls.add()
+		// A swap may have retired reg between the lookup and the count;
+		// then look again, since the retiring reload may not have seen
+		// this call.
+		if cur, ok := r.snapshot()[name]; ok && cur.calls == reg.calls {
+			return reg, reg.calls.done, true
+		}
+		reg.calls.done()
+	}
+}
+
+// List returns the metadata of every registered agent, sorted by name.
+func (r *Registry) List() []AgentInfo {
+	agents := r.snapshot()
+	list := make([]AgentInfo, 0, len(agents))
+	for _, reg := range agents {
+		list = append(list, reg.info)
+	}
+	slices.SortFunc(list, func(a, b AgentInfo) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Len returns the number of registered agents.
+func (r *Registry) Len() int {
+	return len(r.snapshot())
+}
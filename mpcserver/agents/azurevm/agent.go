@@ -0,0 +1,291 @@
+// Package azurevm implements azureVmMetricsAgent, which summarizes the CPU,
+// network, disk and memory metrics Azure Monitor records for a virtual
+// machine.
+package azurevm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Name is the name the workshop registers the agent under.
+const Name = "azureVmMetricsAgent"
+
+// DefaultLookback is the window summarized when the request names none.
+const DefaultLookback = time.Hour
+
+// MetricsSource fetches metric time series for an Azure resource. AzureMetrics
+// implements it against Azure Monitor; tests substitute a fake.
+type MetricsSource interface {
+	Metrics(ctx context.Context, q Query) ([]Series, error)
+}
+
+// Query selects the metrics to fetch.
+type Query struct {
+	// ResourceID is the full ARM ID of the resource.
+	ResourceID string
+	// Metrics are Azure Monitor metric names such as "Percentage CPU".
+	Metrics  []string
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration
+}
+
+// Series is the time series of one metric.
+type Series struct {
+	Name   string
+	Unit   string
+	Points []Point
+}
+
+// Point is one aggregated sample of a series.
+type Point struct {
+	Time    time.Time
+	Average float64
+	Maximum float64
+	Minimum float64
+}
+
+// AggregationAverage is the aggregation of the points the agent returns:
+// each is the average of its metric over one interval.
+const AggregationAverage = "Average"
+
+// MetricSummary condenses a series over the queried window, and carries
+// the series itself for charting.
+type MetricSummary struct {
+	Name     string    `json:"name"`
+	Unit     string    `json:"unit"`
+	Average  float64   `json:"average"`
+	Maximum  float64   `json:"maximum"`
+	Minimum  float64   `json:"minimum"`
+	Latest   float64   `json:"latest"`
+	LatestAt time.Time `json:"latest_at,omitzero"`
+	Samples  int       `json:"samples"`
+	// Aggregation says how each point's value summarizes its interval.
+	Aggregation string      `json:"aggregation"`
+	Points      []DataPoint `json:"points"`
+}
+
+// DataPoint is one value of a series, oldest first.
+type DataPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Report is the structured payload returned in the response's data field.
+type Report struct {
+	VMName        string    `json:"vm_name"`
+	ResourceGroup string    `json:"resource_group"`
+	ResourceID    string    `json:"resource_id"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	// Interval is the span each point covers, as an ISO 8601 duration
+	// such as PT1M.
+	Interval        string          `json:"interval"`
+	Metrics         []MetricSummary `json:"metrics"`
+	Recommendations []string        `json:"recommendations,omitempty"`
+}
+
+// Agent answers questions about a VM's recent performance.
+type Agent struct {
+	source         MetricsSource
+	subscriptionID string
+	now            func() time.Time
+}
+
+// New returns an agent that reads metrics from source for VMs in the given
+// subscription. Requests may name another subscription with the
+// subscription_id parameter.
+func New(source MetricsSource, subscriptionID string) *Agent {
+	return &Agent{source: source, subscriptionID: subscriptionID, now: time.Now}
+}
+
+// Describe reports the agent's capabilities.
+func (a *Agent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{
+		Description:     "Analyzes Azure VM performance metrics and provides optimization recommendations",
+		Version:         "1.0.0",
+		Capabilities:    []string{"metrics_analysis", "performance_optimization", "cost_analysis"},
+		RequiredContext: []string{"resource_group", "vm_name"},
+		Parameters: []mpcserver.ParameterInfo{
+			{Name: paramVM, Type: mpcserver.TypeString, Description: "Name of the virtual machine", Required: true},
+			{Name: paramResourceGroup, Type: mpcserver.TypeString, Description: "Resource group containing the VM", Required: true},
+			{Name: paramSubscription, Type: mpcserver.TypeString, Description: "Subscription containing the VM, if not the server default"},
+			{Name: paramMetrics, Type: mpcserver.TypeList, Description: "Categories to query: cpu, network, disk, memory"},
+			{Name: paramTimespan, Type: mpcserver.TypeDuration, Description: "Window to summarize, such as 30m or 24h"},
+			{Name: paramStart, Type: mpcserver.TypeTime, Description: "Start of the window; overrides timespan"},
+			{Name: paramEnd, Type: mpcserver.TypeTime, Description: "End of the window; defaults to now"},
+		},
+		ExamplePrompts: []string{
+			"Check CPU and memory usage for VM 'web-server-01' in resource group 'production'",
+			"Show network and disk metrics for vm webserver01 in resource group prod-rg over the last 24 hours",
+		},
+	}
+}
+
+// Handle queries the metrics the request asks about and summarizes them.
+func (a *Agent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	p, err := parseParams(req)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	sub := p.subscription
+	if sub == "" {
+		sub = a.subscriptionID
+	}
+	if sub == "" {
+		return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "subscription_id is required")
+	}
+
+	start, end := p.window(a.now())
+	if !start.Before(end) {
+		return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "start must be in the past")
+	}
+	report := Report{
+		VMName:        p.vm,
+		ResourceGroup: p.resourceGroup,
+		ResourceID:    resourceID(sub, p.resourceGroup, p.vm),
+		Start:         start,
+		End:           end,
+		Interval:      isoDuration(interval(end.Sub(start))),
+	}
+	var names []string
+	for _, c := range p.categories {
+		names = append(names, categoryMetrics[c]...)
+	}
+
+	mpcserver.ReportStatus(ctx, "querying Azure Monitor")
+	series, err := a.source.Metrics(ctx, Query{
+		ResourceID: report.ResourceID,
+		Metrics:    names,
+		Start:      report.Start,
+		End:        report.End,
+		Interval:   interval(end.Sub(start)),
+	})
+	if err != nil {
+		return mpcserver.Response{}, fmt.Errorf("query metrics for %s: %w", report.ResourceID, err)
+	}
+	for _, s := range series {
+		report.Metrics = append(report.Metrics, summarize(s))
+	}
+	report.Recommendations = recommend(report.Metrics)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	return mpcserver.Response{Result: report.text(), Data: data}, nil
+}
+
+// resourceID builds the ARM ID of a virtual machine.
+func resourceID(sub, rg, vm string) string {
+	return "/subscriptions/" + sub + "/resourceGroups/" + rg + "/providers/Microsoft.Compute/virtualMachines/" + vm
+}
+
+// interval picks a sample granularity Azure Monitor supports that keeps
+// the number of points per series modest.
+func interval(lookback time.Duration) time.Duration {
+	switch {
+	case lookback <= 2*time.Hour:
+		return time.Minute
+	case lookback <= 12*time.Hour:
+		return 5 * time.Minute
+	case lookback <= 48*time.Hour:
+		return 15 * time.Minute
+	case lookback <= 7*24*time.Hour:
+		return time.Hour
+	default:
+		return 6 * time.Hour
+	}
+}
+
+func summarize(s Series) MetricSummary {
+	sum := MetricSummary{Name: s.Name, Unit: s.Unit, Samples: len(s.Points), Aggregation: AggregationAverage, Points: []DataPoint{}}
+	if len(s.Points) == 0 {
+		return sum
+	}
+	sum.Minimum, sum.Maximum = s.Points[0].Minimum, s.Points[0].Maximum
+	var total float64
+	for _, pt := range s.Points {
+		sum.Points = append(sum.Points, DataPoint{Timestamp: pt.Time, Value: pt.Average})
+		total += pt.Average
+		sum.Maximum = max(sum.Maximum, pt.Maximum)
+		sum.Minimum = min(sum.Minimum, pt.Minimum)
+	}
+	sum.Average = total / float64(len(s.Points))
+	last := s.Points[len(s.Points)-1]
+	sum.Latest, sum.LatestAt = last.Average, last.Time
+	return sum
+}
+
+// recommend applies simple sizing heuristics to the CPU summary.
+func recommend(metrics []MetricSummary) []string {
+	var recs []string
+	for _, m := range metrics {
+		if m.Name != metricCPU || m.Samples == 0 {
+			continue
+		}
+		switch {
+		case m.Average >= 80:
+			recs = append(recs, "CPU is consistently high; consider scaling up or out")
+		case m.Maximum >= 90:
+			recs = append(recs, "CPU peaks above 90%; monitor during peak hours")
+		case m.Maximum < 10:
+			recs = append(recs, "CPU stays below 10%; consider a smaller VM size to reduce cost")
+		}
+	}
+	return recs
+}
+
+func (r Report) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "VM Metrics Analysis for %s (%s), %s to %s UTC:\n",
+		r.VMName, r.ResourceGroup, r.Start.Format("2006-01-02 15:04"), r.End.Format("2006-01-02 15:04"))
+	if len(r.Metrics) == 0 {
+		b.WriteString("No metrics were returned for this VM.\n")
+	}
+	for _, m := range r.Metrics {
+		if m.Samples == 0 {
+			fmt.Fprintf(&b, "- %s: no data\n", m.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "- %s: avg %s, max %s, min %s, latest %s\n",
+			m.Name, formatValue(m.Average, m.Unit), formatValue(m.Maximum, m.Unit),
+			formatValue(m.Minimum, m.Unit), formatValue(m.Latest, m.Unit))
+	}
+	for _, rec := range r.Recommendations {
+		fmt.Fprintf(&b, "Recommendation: %s\n", rec)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatValue renders v in a unit-appropriate, human-readable form.
+func formatValue(v float64, unit string) string {
+	switch unit {
+	case "Percent":
+		return fmt.Sprintf("%.1f%%", v)
+	case "Bytes", "BytesPerSecond":
+		suffix := ""
+		if unit == "BytesPerSecond" {
+			suffix = "/s"
+		}
+		const k = 1024
+		units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+		i := 0
+		for v >= k && i < len(units)-1 {
+			v /= k
+			i++
+		}
+		return fmt.Sprintf("%.1f %s%s", v, units[i], suffix)
+	case "CountPerSecond":
+		return fmt.Sprintf("%.1f/s", v)
+	default:
+		return fmt.Sprintf("%.1f", v)
+	}
+}
@@ -0,0 +1,126 @@
+package azurevm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+type fakeSource struct {
+	got    Query
+	series []Series
+	err    error
+}
+
+func (f *fakeSource) Metrics(_ context.Context, q Query) ([]Series, error) {
+	f.got = q
+	return f.series, f.err
+}
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 30, 0, time.UTC)
+
+func newTestAgent(src MetricsSource) *Agent {
+	a := New(src, "sub-1")
+	a.now = func() time.Time { return testNow }
+	return a
+}
+
+func TestHandleSummarizesMetrics(t *testing.T) {
+	src := &fakeSource{series: []Series{
+		{Name: metricCPU, Unit: "Percent", Points: []Point{
+			{Time: testNow.Add(-2 * time.Minute), Average: 40, Maximum: 55, Minimum: 30},
+			{Time: testNow.Add(-time.Minute), Average: 50, Maximum: 95, Minimum: 35},
+		}},
+		{Name: metricNetworkIn, Unit: "Bytes", Points: []Point{{Time: testNow, Average: 2048, Maximum: 4096, Minimum: 1024}}},
+		{Name: metricNetworkOut, Unit: "Bytes"},
+	}}
+	resp, err := newTestAgent(src).Handle(context.Background(), mpcserver.Request{
+		Prompt: "Check the CPU and network metrics for VM 'webserver01' in resource group 'prod-rg'.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantID := "/subscriptions/sub-1/resourceGroups/prod-rg/providers/Microsoft.Compute/virtualMachines/webserver01"
+	if src.got.ResourceID != wantID {
+		t.Errorf("resource ID = %q", src.got.ResourceID)
+	}
+	if want := []string{metricCPU, metricNetworkIn, metricNetworkOut}; !slices.Equal(src.got.Metrics, want) {
+		t.Errorf("metrics = %q, want %q", src.got.Metrics, want)
+	}
+	if src.got.End.Sub(src.got.Start) != DefaultLookback || src.got.Interval != time.Minute {
+		t.Errorf("window = %v..%v every %v", src.got.Start, src.got.End, src.got.Interval)
+	}
+
+	var report Report
+	if err := json.Unmarshal(resp.Data, &report); err != nil {
+		t.Fatal(err)
+	}
+	cpu := report.Metrics[0]
+	if cpu.Average != 45 || cpu.Maximum != 95 || cpu.Minimum != 30 || cpu.Latest != 50 || cpu.Samples != 2 {
+		t.Errorf("cpu summary = %+v", cpu)
+	}
+	if want := []DataPoint{{testNow.Add(-2 * time.Minute), 40}, {testNow.Add(-time.Minute), 50}}; !slices.Equal(cpu.Points, want) || cpu.Aggregation != AggregationAverage {
+		t.Errorf("cpu series = %s %+v, want %+v", cpu.Aggregation, cpu.Points, want)
+	}
+	if report.Interval != "PT1M" || report.Metrics[2].Points == nil {
+		t.Errorf("interval = %q, empty series points = %v", report.Interval, report.Metrics[2].Points)
+	}
+	if len(report.Recommendations) != 1 {
+		t.Errorf("recommendations = %q", report.Recommendations)
+	}
+	for _, want := range []string{"webserver01 (prod-rg)", "Percentage CPU: avg 45.0%, max 95.0%", "Network In Total: avg 2.0 KiB", "Network Out Total: no data", "Recommendation:"} {
+		if !strings.Contains(resp.Result, want) {
+			t.Errorf("result missing %q:\n%s", want, resp.Result)
+		}
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  *fakeSource
+		sub  string
+		req  mpcserver.Request
+		code int
+	}{
+		{"missing vm", &fakeSource{}, "sub-1", mpcserver.Request{Prompt: "how is resource group prod doing?"}, http.StatusBadRequest},
+		{"no subscription", &fakeSource{}, "", mpcserver.Request{Prompt: "check vm a in rg b"}, http.StatusBadRequest},
+		{"bad timespan", &fakeSource{}, "sub-1", mpcserver.Request{Prompt: "check vm a in rg b", Parameters: map[string]any{"timespan": "soon"}}, http.StatusBadRequest},
+		{"source failure", &fakeSource{err: errors.New("throttled")}, "sub-1", mpcserver.Request{Prompt: "check vm a in rg b"}, 0},
+	}
+	for _, tt := range tests {
+		a := newTestAgent(tt.src)
+		a.subscriptionID = tt.sub
+		_, err := a.Handle(context.Background(), tt.req)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		var e *mpcserver.Error
+		if got := errors.As(err, &e); got != (tt.code != 0) || (got && e.Status != tt.code) {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestIsoDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		time.Minute:      "PT1M",
+		15 * time.Minute: "PT15M",
+		time.Hour:        "PT1H",
+		6 * time.Hour:    "PT6H",
+		24 * time.Hour:   "P1D",
+	} {
+		if got := isoDuration(d); got != want {
+			t.Errorf("isoDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package azurevm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+)
+
+// AzureMetrics reads metrics from Azure Monitor.
+type AzureMetrics struct {
+	client *armmonitor.MetricsClient
+}
+
+// NewAzureMetrics returns a MetricsSource authenticating with cred, such as
+// the credential from azidentity.NewDefaultAzureCredential. opts may be nil.
+func NewAzureMetrics(cred azcore.TokenCredential, opts *arm.ClientOptions) (*AzureMetrics, error) {
+	// Metric queries are addressed by resource ID, so the client needs no
+	// subscription of its own.
+	client, err := armmonitor.NewMetricsClient("", cred, opts)
+	if err != nil {
+		return nil, fmt.Errorf("azurevm: create metrics client: %w", err)
+	}
+	return &AzureMetrics{client: client}, nil
+}
+
+// Metrics queries the average, maximum and minimum of each metric in q.
+func (m *AzureMetrics) Metrics(ctx context.Context, q Query) ([]Series, error) {
+	resp, err := m.client.List(ctx, q.ResourceID, &armmonitor.MetricsClientListOptions{
+		Metricnames: to.Ptr(strings.Join(q.Metrics, ",")),
+		Timespan:    to.Ptr(q.Start.Format(time.RFC3339) + "/" + q.End.Format(time.RFC3339)),
+		Interval:    to.Ptr(isoDuration(q.Interval)),
+		Aggregation: to.Ptr("Average,Maximum,Minimum"),
+		ResultType:  to.Ptr(armmonitor.ResultTypeData),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Series
+	for _, metric := range resp.Value {
+		if metric == nil {
+			continue
+		}
+		var s Series
+		if metric.Name != nil && metric.Name.Value != nil {
+			s.Name = *metric.Name.Value
+		}
+		if metric.Unit != nil {
+			s.Unit = string(*metric.Unit)
+		}
+		for _, ts := range metric.Timeseries {
+			if ts == nil {
+				continue
+			}
+			for _, v := range ts.Data {
+				// Intervals without samples carry only a timestamp.
+				if v == nil || v.TimeStamp == nil || v.Average == nil {
+					continue
+				}
+				pt := Point{Time: *v.TimeStamp, Average: *v.Average, Maximum: *v.Average, Minimum: *v.Average}
+				if v.Maximum != nil {
+					pt.Maximum = *v.Maximum
+				}
+				if v.Minimum != nil {
+					pt.Minimum = *v.Minimum
+				}
+				s.Points = append(s.Points, pt)
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// isoDuration formats d as the ISO 8601 duration Azure Monitor expects,
+// such as PT5M or P1D.
+func isoDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("P%dD", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("PT%dH", d/time.Hour)
+	default:
+		return fmt.Sprintf("PT%dM", max(d/time.Minute, 1))
+	}
+}
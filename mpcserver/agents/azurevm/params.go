@@ -0,0 +1,195 @@
+package azurevm
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Azure Monitor metric names for virtual machines.
+const (
+	metricCPU             = "Percentage CPU"
+	metricNetworkIn       = "Network In Total"
+	metricNetworkOut      = "Network Out Total"
+	metricDiskReadBytes   = "Disk Read Bytes"
+	metricDiskWriteBytes  = "Disk Write Bytes"
+	metricDiskReadOps     = "Disk Read Operations/Sec"
+	metricDiskWriteOps    = "Disk Write Operations/Sec"
+	metricAvailableMemory = "Available Memory Bytes"
+)
+
+// categoryMetrics maps the categories users ask about to metric names.
+var categoryMetrics = map[string][]string{
+	"cpu":     {metricCPU},
+	"network": {metricNetworkIn, metricNetworkOut},
+	"disk":    {metricDiskReadBytes, metricDiskWriteBytes, metricDiskReadOps, metricDiskWriteOps},
+	"memory":  {metricAvailableMemory},
+}
+
+// Parameter names, shared with mpcclient's typed call options.
+const (
+	paramVM            = "vm_name"
+	paramResourceGroup = "resource_group"
+	paramSubscription  = "subscription_id"
+	paramMetrics       = "metrics"
+	paramTimespan      = "timespan"
+	paramStart         = "start"
+	paramEnd           = "end"
+)
+
+// defaultCategories are queried when the request names none.
+var defaultCategories = []string{"cpu", "network", "disk"}
+
+// Patterns picking parameters out of prompts such as "Check CPU for VM
+// 'webserver01' in resource group 'prod-rg' over the last 24 hours".
+var (
+	vmPattern       = regexp.MustCompile(`(?i)\b(?:vm|virtual machine)\s+(?:named\s+|called\s+)?['"]?([A-Za-z0-9][\w.-]*)`)
+	groupPattern    = regexp.MustCompile(`(?i)\b(?:resource[\s-]*group|rg)\s+(?:named\s+|called\s+)?['"]?([\w.()-]*\w)`)
+	lookbackPattern = regexp.MustCompile(`(?i)\b(?:last|past)\s+(?:(\d+)\s*)?(minute|min|hour|hr|day|week)s?\b`)
+	categoryWords   = map[string][]string{
+		"cpu":     {"cpu", "processor"},
+		"network": {"network", "bandwidth", "throughput"},
+		"disk":    {"disk", "storage", "iops"},
+		"memory":  {"memory", "ram"},
+	}
+)
+
+// params are the inputs of one request.
+type params struct {
+	vm            string
+	resourceGroup string
+	subscription  string
+	categories    []string
+	lookback      time.Duration
+	// start and end bound the window when given; zero means relative to
+	// now.
+	start, end time.Time
+}
+
+// parseParams reads the request's parameters, falling back to its context
+// and then to the prompt for anything not given explicitly.
+func parseParams(req mpcserver.Request) (params, error) {
+	p := params{
+		vm:            req.StringParam(paramVM),
+		resourceGroup: req.StringParam(paramResourceGroup),
+		subscription:  req.StringParam(paramSubscription),
+	}
+	if p.vm == "" {
+		p.vm = submatch(vmPattern, req.Prompt)
+	}
+	if p.resourceGroup == "" {
+		p.resourceGroup = submatch(groupPattern, req.Prompt)
+	}
+	var missing []string
+	if p.vm == "" {
+		missing = append(missing, paramVM)
+	}
+	if p.resourceGroup == "" {
+		missing = append(missing, paramResourceGroup)
+	}
+	if len(missing) > 0 {
+		return p, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest,
+			"could not determine %s; name them in the prompt or pass them as parameters", strings.Join(missing, " and "))
+	}
+
+	if cats := req.ListParam(paramMetrics); cats != nil {
+		for _, c := range cats {
+			c = strings.ToLower(c)
+			if _, ok := categoryMetrics[c]; !ok {
+				return p, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "unknown metric category %q", c)
+			}
+			p.categories = append(p.categories, c)
+		}
+	} else {
+		p.categories = promptCategories(req.Prompt)
+	}
+
+	var err error
+	if p.start, err = req.TimeParam(paramStart); err != nil {
+		return p, err
+	}
+	if p.end, err = req.TimeParam(paramEnd); err != nil {
+		return p, err
+	}
+	if !p.start.IsZero() && !p.end.IsZero() && !p.start.Before(p.end) {
+		return p, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "start must be before end")
+	}
+	if p.lookback, err = req.DurationParam(paramTimespan); err != nil {
+		return p, err
+	}
+	switch {
+	case p.lookback < 0:
+		return p, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "invalid timespan %s", p.lookback)
+	case p.lookback == 0:
+		p.lookback = promptLookback(req.Prompt)
+	}
+	return p, nil
+}
+
+// window returns the period p covers when the time is now.
+func (p params) window(now time.Time) (start, end time.Time) {
+	end = now.UTC().Truncate(time.Minute)
+	if !p.end.IsZero() {
+		end = p.end.UTC()
+	}
+	start = end.Add(-p.lookback)
+	if !p.start.IsZero() {
+		start = p.start.UTC()
+	}
+	return start, end
+}
+
+func submatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// promptCategories returns the metric categories a prompt mentions, or the
+// defaults if it mentions none.
+func promptCategories(prompt string) []string {
+	words := strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	var cats []string
+	for _, c := range []string{"cpu", "network", "disk", "memory"} {
+		for _, w := range categoryWords[c] {
+			if slices.Contains(words, w) {
+				cats = append(cats, c)
+				break
+			}
+		}
+	}
+	if len(cats) == 0 {
+		return defaultCategories
+	}
+	return cats
+}
+
+// promptLookback reads a window such as "last 24 hours" or "past week" from
+// the prompt.
+func promptLookback(prompt string) time.Duration {
+	m := lookbackPattern.FindStringSubmatch(prompt)
+	if m == nil {
+		return DefaultLookback
+	}
+	n := 1
+	if m[1] != "" {
+		n, _ = strconv.Atoi(m[1])
+	}
+	unit := map[string]time.Duration{
+		"minute": time.Minute, "min": time.Minute,
+		"hour": time.Hour, "hr": time.Hour,
+		"day": 24 * time.Hour, "week": 7 * 24 * time.Hour,
+	}[strings.ToLower(m[2])]
+	if n <= 0 {
+		return DefaultLookback
+	}
+	return time.Duration(n) * unit
+}
@@ -0,0 +1,98 @@
+package azurevm
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		req        mpcserver.Request
+		vm, rg     string
+		categories []string
+		lookback   time.Duration
+	}{
+		{
+			req:        mpcserver.Request{Prompt: "Check CPU and memory usage for VM 'web-server-01' in resource group 'production'"},
+			vm:         "web-server-01",
+			rg:         "production",
+			categories: []string{"cpu", "memory"},
+			lookback:   time.Hour,
+		},
+		{
+			req:        mpcserver.Request{Prompt: "show disk iops for virtual machine db01 in rg data-rg over the past 3 days"},
+			vm:         "db01",
+			rg:         "data-rg",
+			categories: []string{"disk"},
+			lookback:   72 * time.Hour,
+		},
+		{
+			req:        mpcserver.Request{Prompt: "how is vm app1 in resource-group apps doing in the last week?"},
+			vm:         "app1",
+			rg:         "apps",
+			categories: defaultCategories,
+			lookback:   7 * 24 * time.Hour,
+		},
+		{
+			// Explicit parameters win over the prompt, and context fills gaps.
+			req: mpcserver.Request{
+				Prompt:     "check vm ignored",
+				Parameters: map[string]any{"vm_name": "vm-a", "metrics": []any{"network", "CPU"}, "timespan": "30m"},
+				Context:    map[string]any{"resource_group": "rg-a"},
+			},
+			vm:         "vm-a",
+			rg:         "rg-a",
+			categories: []string{"network", "cpu"},
+			lookback:   30 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		p, err := parseParams(tt.req)
+		if err != nil {
+			t.Errorf("%q: %v", tt.req.Prompt, err)
+			continue
+		}
+		if p.vm != tt.vm || p.resourceGroup != tt.rg || !slices.Equal(p.categories, tt.categories) || p.lookback != tt.lookback {
+			t.Errorf("%q: got vm=%q rg=%q categories=%q lookback=%v", tt.req.Prompt, p.vm, p.resourceGroup, p.categories, p.lookback)
+		}
+	}
+}
+
+func TestParseParamsRejectsUnknownCategory(t *testing.T) {
+	_, err := parseParams(mpcserver.Request{Prompt: "vm a in rg b", Parameters: map[string]any{"metrics": "cpu,gpu"}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseParamsTimeRange(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 30, 45, 0, time.UTC)
+	p, err := parseParams(mpcserver.Request{Prompt: "vm a in rg b", Parameters: map[string]any{
+		"start": "2026-03-01T00:00:00Z",
+		"end":   "2026-03-01T06:00:00+01:00",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end := p.window(now)
+	if !start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 3, 1, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("window = %v..%v", start, end)
+	}
+
+	p, err = parseParams(mpcserver.Request{Prompt: "vm a in rg b", Parameters: map[string]any{"timespan": "2h"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start, end := p.window(now); end.Sub(start) != 2*time.Hour || !end.Equal(now.Truncate(time.Minute)) {
+		t.Errorf("window = %v..%v", start, end)
+	}
+
+	if _, err := parseParams(mpcserver.Request{Prompt: "vm a in rg b", Parameters: map[string]any{
+		"start": "2026-03-01T06:00:00Z", "end": "2026-03-01T00:00:00Z",
+	}}); err == nil {
+		t.Error("expected error for start after end")
+	}
+}
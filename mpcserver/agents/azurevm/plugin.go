@@ -0,0 +1,38 @@
+package azurevm
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Config is the agent's configuration section.
+type Config struct {
+	// SubscriptionID is the default subscription of the VMs asked about.
+	SubscriptionID string `json:"subscription_id"`
+}
+
+func init() {
+	mpcserver.RegisterPlugin(mpcserver.Plugin{Name: Name, New: newPlugin})
+}
+
+// newPlugin builds an agent reading Azure Monitor, authenticating with the
+// default Azure credential chain: environment variables, workload or
+// managed identity, or the Azure CLI.
+func newPlugin(section mpcserver.ConfigSection) (mpcserver.Agent, error) {
+	var cfg Config
+	if err := section.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("azure credential: %w", err)
+	}
+	source, err := NewAzureMetrics(cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	return New(source, cfg.SubscriptionID), nil
+}
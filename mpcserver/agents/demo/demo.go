@@ -0,0 +1,67 @@
+// Package demo provides the canned workshop agents served by the Python
+// server.py, so the Go server can stand in for it during exercises.
+package demo
+
+import (
+	"context"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// canned is an agent that answers every prompt with a fixed reply.
+type canned struct {
+	info  mpcserver.AgentInfo
+	reply string
+}
+
+func (a canned) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	return mpcserver.Response{Result: a.reply}, nil
+}
+
+func (a canned) Describe() mpcserver.AgentInfo { return a.info }
+
+// Agents returns the demo agents keyed by the names the workshop uses.
+func Agents() map[string]mpcserver.Agent {
+	return map[string]mpcserver.Agent{
+		"azureVmMetricsAgent": canned{
+			info: mpcserver.AgentInfo{
+				Description:     "Analyzes Azure VM performance metrics and provides optimization recommendations",
+				Version:         "1.0.0",
+				Capabilities:    []string{"metrics_analysis", "performance_optimization", "cost_analysis"},
+				RequiredContext: []string{"resource_group", "vm_name"},
+				ExamplePrompts:  []string{"Check CPU and memory usage for VM 'web-server-01' in resource group 'production'"},
+			},
+			reply: "✅ VM Metrics Analysis:\nCPU: 45%, Memory: 62%, Disk I/O: Normal\nRecommendation: Monitor during peak hours",
+		},
+		"terraformDocsAgent": canned{
+			info: mpcserver.AgentInfo{
+				Description:     "Generates comprehensive documentation for Terraform infrastructure code",
+				Version:         "1.0.0",
+				Capabilities:    []string{"documentation_generation", "cost_estimation", "security_analysis"},
+				RequiredContext: []string{"project_path"},
+				ExamplePrompts:  []string{"Generate documentation for the Terraform code in the './infrastructure' directory"},
+			},
+			reply: "📋 Generated Terraform Documentation:\n# Infrastructure Overview\nResources: 5 VMs, 2 Load Balancers\nEstimated cost: $340/month",
+		},
+		"onboardingAgent": canned{
+			info: mpcserver.AgentInfo{
+				Description:     "Provides personalized onboarding guidance for new team members",
+				Version:         "1.0.0",
+				Capabilities:    []string{"personalized_guidance", "checklist_generation", "resource_links"},
+				RequiredContext: []string{"role", "team"},
+				ExamplePrompts:  []string{"Help me get started as a new DevOps engineer on the platform team"},
+			},
+			reply: "🎯 Welcome! Here's your onboarding checklist:\n1. Setup Azure CLI\n2. Clone repositories\n3. Configure VS Code",
+		},
+	}
+}
+
+// Register adds every demo agent to s.
+func Register(s *mpcserver.Server) error {
+	for name, a := range Agents() {
+		if err := s.Register(name, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
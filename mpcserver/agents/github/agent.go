@@ -0,0 +1,389 @@
+// Package github implements githubContextAgent, which answers questions
+// about a GitHub repository from its file tree, README, recent commits and
+// the files that bear on the question, fetched through the GitHub API.
+//
+// The agent is the workshop's example of bringing your own data source:
+// it assembles what it fetched into a context document and hands that,
+// with the question, to an Answerer, such as an agent backed by a language
+// model. Without an Answerer it returns the context itself.
+package github
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Name is the name the agent is registered under and the key of its
+// configuration section.
+const Name = "githubContextAgent"
+
+// Defaults used for the zero values of Options.
+const (
+	DefaultMaxFiles   = 3
+	DefaultCommits    = 10
+	DefaultMaxContext = 48 << 10
+)
+
+// Parameter names.
+const (
+	paramRepo  = "repo"
+	paramQuery = "query"
+	paramRef   = "ref"
+)
+
+// Limits of what goes into the context, beyond Options.
+const (
+	// maxTreeEntries caps the paths listed from the file tree.
+	maxTreeEntries = 200
+	// maxREADME caps the bytes of README included.
+	maxREADME = 8 << 10
+	// maxFileBytes caps the bytes included of each selected file, and
+	// larger files are not selected.
+	maxFileBytes = 16 << 10
+)
+
+// Source reads a GitHub repository. Client implements it with the GitHub
+// REST API; tests substitute a fake.
+type Source interface {
+	DefaultBranch(ctx context.Context, repo Repo) (string, error)
+	Tree(ctx context.Context, repo Repo, ref string) ([]TreeEntry, error)
+	README(ctx context.Context, repo Repo, ref string) (string, error)
+	File(ctx context.Context, repo Repo, path, ref string) (string, error)
+	Commits(ctx context.Context, repo Repo, ref string, n int) ([]Commit, error)
+}
+
+// Repo names a repository.
+type Repo struct {
+	Owner, Name string
+}
+
+func (r Repo) String() string { return r.Owner + "/" + r.Name }
+
+// path returns the API path of the repository followed by rest.
+func (r Repo) path(rest string) string {
+	return "/repos/" + r.Owner + "/" + r.Name + rest
+}
+
+// TreeEntry is a file in a repository.
+type TreeEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Commit is a commit on a branch.
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+}
+
+// Answerer answers a question from the context assembled for it,
+// typically with a language model.
+type Answerer interface {
+	Answer(ctx context.Context, question, context string) (string, error)
+}
+
+// AgentAnswerer answers with an agent on an MPC server, sending it the
+// question and the context in its prompt.
+type AgentAnswerer struct {
+	Client *mpcclient.Client
+	Agent  string
+}
+
+// Answer calls the agent with the question and context.
+func (a AgentAnswerer) Answer(ctx context.Context, question, context string) (string, error) {
+	prompt := "Answer the question about the GitHub repository described below, using only that description.\n\n" +
+		"Question: " + question + "\n\n" + context
+	resp, err := a.Client.CallAgent(ctx, a.Agent, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Result, nil
+}
+
+// Options configure an Agent.
+type Options struct {
+	// Answerer answers from the assembled context; without one, the
+	// context is the result.
+	Answerer Answerer
+	// Repo is the repository asked about when a request names none, as
+	// "owner/name".
+	Repo string
+	// MaxFiles caps the files whose contents are included.
+	MaxFiles int
+	// Commits is the number of recent commits included.
+	Commits int
+	// MaxContext caps the bytes of the assembled context.
+	MaxContext int
+}
+
+// Report is the structured payload returned in the response's data field.
+type Report struct {
+	Repo    string   `json:"repo"`
+	Ref     string   `json:"ref"`
+	Query   string   `json:"query"`
+	Files   []string `json:"files"`
+	Commits []Commit `json:"commits"`
+	// Context is the document the answer was drawn from.
+	Context string `json:"context"`
+	// Answered reports whether an Answerer wrote the result.
+	Answered bool `json:"answered"`
+}
+
+// Agent answers questions about GitHub repositories.
+type Agent struct {
+	source Source
+	opts   Options
+}
+
+// New returns an agent reading repositories from source.
+func New(source Source, opts Options) *Agent {
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+	if opts.Commits <= 0 {
+		opts.Commits = DefaultCommits
+	}
+	if opts.MaxContext <= 0 {
+		opts.MaxContext = DefaultMaxContext
+	}
+	return &Agent{source: source, opts: opts}
+}
+
+// Describe reports the agent's capabilities.
+func (a *Agent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{
+		Description:     "Answers questions about a GitHub repository from its files, README and recent commits",
+		Version:         "1.0.0",
+		Capabilities:    []string{"repository_context", "code_search", "commit_history"},
+		RequiredContext: []string{paramRepo},
+		Parameters: []mpcserver.ParameterInfo{
+			{Name: paramRepo, Type: mpcserver.TypeString, Description: "Repository as owner/name or a github.com URL", Required: a.opts.Repo == ""},
+			{Name: paramQuery, Type: mpcserver.TypeString, Description: "Question to answer; the prompt when not given"},
+			{Name: paramRef, Type: mpcserver.TypeString, Description: "Branch, tag or commit to read; the default branch when not given"},
+		},
+		ExamplePrompts: []string{
+			"How is configuration loaded in olafkfreund/ai_team_workshop?",
+			"What changed recently in github.com/golang/go?",
+		},
+	}
+}
+
+// Handle fetches the repository's context and answers the request's
+// question from it.
+func (a *Agent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	repo, err := a.repo(req)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	query := req.StringParam(paramQuery)
+	if query == "" {
+		query = strings.TrimSpace(req.Prompt)
+	}
+	if query == "" {
+		return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "a prompt or the %s parameter is required", paramQuery)
+	}
+	ref := req.StringParam(paramRef)
+	if ref == "" {
+		if ref, err = a.source.DefaultBranch(ctx, repo); err != nil {
+			return mpcserver.Response{}, sourceError(repo, err)
+		}
+	}
+
+	mpcserver.ReportStatus(ctx, "reading "+repo.String())
+	var (
+		tree    []TreeEntry
+		readme  string
+		commits []Commit
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) { tree, err = a.source.Tree(gctx, repo, ref); return err })
+	g.Go(func() (err error) { readme, err = a.source.README(gctx, repo, ref); return err })
+	g.Go(func() (err error) { commits, err = a.source.Commits(gctx, repo, ref, a.opts.Commits); return err })
+	if err := g.Wait(); err != nil {
+		return mpcserver.Response{}, sourceError(repo, err)
+	}
+
+	selected := selectFiles(tree, query, repo, a.opts.MaxFiles)
+	contents := make([]string, len(selected))
+	g, gctx = errgroup.WithContext(ctx)
+	for i, p := range selected {
+		g.Go(func() (err error) { contents[i], err = a.source.File(gctx, repo, p, ref); return err })
+	}
+	if err := g.Wait(); err != nil {
+		return mpcserver.Response{}, sourceError(repo, err)
+	}
+
+	report := Report{Repo: repo.String(), Ref: ref, Query: query, Files: selected, Commits: commits}
+	report.Context = assemble(report, tree, readme, contents, a.opts.MaxContext)
+	result := report.Context
+	if a.opts.Answerer != nil {
+		mpcserver.ReportStatus(ctx, "answering")
+		if result, err = a.opts.Answerer.Answer(ctx, query, report.Context); err != nil {
+			return mpcserver.Response{}, fmt.Errorf("answer: %w", err)
+		}
+		report.Answered = true
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	return mpcserver.Response{Result: result, Data: data}, nil
+}
+
+// Patterns of repositories: repoName the whole of an "owner/name", and
+// repoMention one in a prompt, optionally as a github.com URL.
+var (
+	repoName    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,38}/[A-Za-z0-9._-]{1,100}$`)
+	repoMention = regexp.MustCompile(`(?:github\.com/)?\b([A-Za-z0-9][A-Za-z0-9-]{0,38}/[A-Za-z0-9_-][A-Za-z0-9._-]*[A-Za-z0-9_-])`)
+)
+
+// repo reads the repository from the request's parameters, its prompt or
+// the agent's default, in that order.
+func (a *Agent) repo(req mpcserver.Request) (Repo, error) {
+	if s := req.StringParam(paramRepo); s != "" {
+		name := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "www."), "github.com/")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "/"), ".git")
+		if !repoName.MatchString(name) {
+			return Repo{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "invalid %s %q; use owner/name", paramRepo, s)
+		}
+		return parseRepo(name), nil
+	}
+	if m := repoMention.FindStringSubmatch(req.Prompt); m != nil {
+		return parseRepo(strings.TrimSuffix(m[1], ".git")), nil
+	}
+	if a.opts.Repo != "" {
+		return parseRepo(a.opts.Repo), nil
+	}
+	return Repo{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest,
+		"could not determine the repository; name it as owner/name in the prompt or pass the %s parameter", paramRepo)
+}
+
+func parseRepo(s string) Repo {
+	owner, name, _ := strings.Cut(s, "/")
+	return Repo{Owner: owner, Name: name}
+}
+
+// sourceError reports a failed read of repo, as a client error when the
+// repository or ref does not exist.
+func sourceError(repo Repo, err error) error {
+	var e *APIError
+	if errors.As(err, &e) && (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusUnprocessableEntity) {
+		return mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "repository %s or its ref not found", repo)
+	}
+	return fmt.Errorf("read %s: %w", repo, err)
+}
+
+// selectFiles picks up to n files of tree whose paths share the most words
+// with query, other than the words of the repository's name, preferring
+// shallower paths, and skipping files too large to include.
+func selectFiles(tree []TreeEntry, query string, repo Repo, n int) []string {
+	named := words(repo.String())
+	terms := slices.DeleteFunc(words(query), func(w string) bool { return slices.Contains(named, w) })
+	type scored struct {
+		path  string
+		score int
+	}
+	var candidates []scored
+	for _, e := range tree {
+		if e.Size > maxFileBytes || isBinary(e.Path) {
+			continue
+		}
+		score := 0
+		for _, w := range words(e.Path) {
+			if slices.Contains(terms, w) {
+				score++
+			}
+		}
+		if score > 0 {
+			candidates = append(candidates, scored{e.Path, score})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b scored) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(strings.Count(a.path, "/"), strings.Count(b.path, "/")))
+	})
+	var out []string
+	for _, c := range candidates[:min(n, len(candidates))] {
+		out = append(out, c.path)
+	}
+	return out
+}
+
+// words returns the lowercase words of s of three letters or more,
+// splitting paths and identifiers too.
+func words(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	var out []string
+	for _, f := range fields {
+		if len(f) >= 3 {
+			out = append(out, strings.TrimSuffix(f, "s"))
+		}
+	}
+	return out
+}
+
+// binaryExts are extensions of files not worth reading as text.
+var binaryExts = []string{".png", ".jpg", ".jpeg", ".gif", ".ico", ".pdf", ".zip", ".gz", ".tar", ".jar", ".exe", ".so", ".dll", ".woff", ".woff2"}
+
+func isBinary(p string) bool {
+	return slices.Contains(binaryExts, strings.ToLower(path.Ext(p)))
+}
+
+// assemble writes the context document of a report: the README, recent
+// commits, file tree and selected files, in that order, within max bytes.
+func assemble(r Report, tree []TreeEntry, readme string, contents []string, max int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Repository %s at %s\n", r.Repo, r.Ref)
+	if readme != "" {
+		fmt.Fprintf(&b, "\n## README\n\n%s\n", truncate(readme, maxREADME))
+	}
+	if len(r.Commits) > 0 {
+		b.WriteString("\n## Recent commits\n\n")
+		for _, c := range r.Commits {
+			subject, _, _ := strings.Cut(c.Message, "\n")
+			fmt.Fprintf(&b, "- %.7s %s (%s, %s)\n", c.SHA, subject, c.Author, c.Date.Format(time.DateOnly))
+		}
+	}
+	fmt.Fprintf(&b, "\n## Files (%d)\n\n", len(tree))
+	for _, e := range tree[:min(len(tree), maxTreeEntries)] {
+		fmt.Fprintf(&b, "- %s\n", e.Path)
+	}
+	if len(tree) > maxTreeEntries {
+		fmt.Fprintf(&b, "- ... and %d more\n", len(tree)-maxTreeEntries)
+	}
+	for i, p := range r.Files {
+		fmt.Fprintf(&b, "\n## %s\n\n```\n%s\n```\n", p, truncate(contents[i], maxFileBytes))
+	}
+	return truncate(b.String(), max)
+}
+
+// truncate cuts s to at most n bytes, at a line boundary when there is one
+// in its second half, marking the cut.
+func truncate(s string, n int) string {
+	s = strings.TrimRight(s, "\n")
+	if len(s) <= n {
+		return s
+	}
+	s = strings.ToValidUTF8(s[:n], "")
+	if i := strings.LastIndexByte(s, '\n'); i > n/2 {
+		s = s[:i]
+	}
+	return s + "\n[truncated]"
+}
@@ -0,0 +1,207 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+type fakeSource struct {
+	tree    []TreeEntry
+	files   map[string]string
+	commits []Commit
+	err     error
+	// repo and ref are those of the last call.
+	repo Repo
+	ref  string
+}
+
+func (f *fakeSource) DefaultBranch(_ context.Context, repo Repo) (string, error) {
+	f.repo = repo
+	return "main", f.err
+}
+
+func (f *fakeSource) Tree(_ context.Context, repo Repo, ref string) ([]TreeEntry, error) {
+	f.ref = ref
+	return f.tree, f.err
+}
+
+func (f *fakeSource) README(context.Context, Repo, string) (string, error) {
+	return "# Shop\nAn online shop.", nil
+}
+
+func (f *fakeSource) File(_ context.Context, _ Repo, path, _ string) (string, error) {
+	return f.files[path], nil
+}
+
+func (f *fakeSource) Commits(_ context.Context, _ Repo, _ string, n int) ([]Commit, error) {
+	return f.commits[:min(n, len(f.commits))], nil
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		tree: []TreeEntry{
+			{Path: "README.md", Size: 20},
+			{Path: "internal/config/load.go", Size: 900},
+			{Path: "config/defaults.yaml", Size: 100},
+			{Path: "cmd/shop/main.go", Size: 400},
+			{Path: "docs/config-diagram.png", Size: 100},
+			{Path: "testdata/config/huge.json", Size: 1 << 20},
+		},
+		files: map[string]string{
+			"internal/config/load.go": "package config\n\nfunc Load() {}\n",
+			"config/defaults.yaml":    "port: 8080\n",
+		},
+		commits: []Commit{{SHA: "abc1234def", Message: "Read config from env\n\nMore.", Author: "Ada", Date: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+}
+
+func TestHandleAssemblesContext(t *testing.T) {
+	src := newFakeSource()
+	resp, err := New(src, Options{}).Handle(context.Background(), mpcserver.Request{Prompt: "How is config loaded in acme/shop?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.repo != (Repo{"acme", "shop"}) || src.ref != "main" {
+		t.Errorf("read %v at %q", src.repo, src.ref)
+	}
+	var report Report
+	if err := json.Unmarshal(resp.Data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"config/defaults.yaml", "internal/config/load.go"}; !slices.Equal(report.Files, want) {
+		t.Errorf("files = %q, want %q", report.Files, want)
+	}
+	if report.Answered || resp.Result != report.Context {
+		t.Errorf("without an answerer the result should be the context")
+	}
+	for _, want := range []string{
+		"# Repository acme/shop at main",
+		"## README\n\n# Shop\nAn online shop.",
+		"- abc1234 Read config from env (Ada, 2026-10-01)",
+		"## Files (6)",
+		"## internal/config/load.go\n\n```\npackage config",
+	} {
+		if !strings.Contains(resp.Result, want) {
+			t.Errorf("context missing %q:\n%s", want, resp.Result)
+		}
+	}
+}
+
+type fakeAnswerer struct{ question, context string }
+
+func (f *fakeAnswerer) Answer(_ context.Context, question, context string) (string, error) {
+	f.question, f.context = question, context
+	return "Load reads config/defaults.yaml.", nil
+}
+
+func TestHandleAnswers(t *testing.T) {
+	ans := &fakeAnswerer{}
+	a := New(newFakeSource(), Options{Answerer: ans, Repo: "acme/shop"})
+	resp, err := a.Handle(context.Background(), mpcserver.Request{
+		Prompt:     "ignored",
+		Parameters: map[string]any{"query": "Where are the config defaults?", "ref": "v1.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "Load reads config/defaults.yaml." || ans.question != "Where are the config defaults?" || !strings.Contains(ans.context, "at v1.2") {
+		t.Errorf("result %q for question %q", resp.Result, ans.question)
+	}
+}
+
+func TestAgentAnswerer(t *testing.T) {
+	s := mpcserver.New()
+	s.Register("llm", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		if !strings.Contains(req.Prompt, "Question: why?") || !strings.Contains(req.Prompt, "# Repository") {
+			return mpcserver.Response{}, errors.New("prompt lacks the question or context")
+		}
+		return mpcserver.Response{Result: "because"}, nil
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, err := mpcclient.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := AgentAnswerer{Client: c, Agent: "llm"}.Answer(context.Background(), "why?", "# Repository acme/shop at main")
+	if err != nil || answer != "because" {
+		t.Errorf("answer = %q, %v", answer, err)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	a := New(nil, Options{})
+	for _, tt := range []struct {
+		req  mpcserver.Request
+		want Repo
+	}{
+		{mpcserver.Request{Prompt: "what changed recently in github.com/golang/go?"}, Repo{"golang", "go"}},
+		{mpcserver.Request{Prompt: "summarize https://github.com/acme/shop.git please"}, Repo{"acme", "shop"}},
+		{mpcserver.Request{Parameters: map[string]any{"repo": "https://github.com/acme/shop/"}}, Repo{"acme", "shop"}},
+		{mpcserver.Request{Parameters: map[string]any{"repo": "acme/my.repo"}}, Repo{"acme", "my.repo"}},
+	} {
+		got, err := a.repo(tt.req)
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: repo = %v, %v; want %v", tt.req, got, err, tt.want)
+		}
+	}
+	for _, req := range []mpcserver.Request{
+		{Prompt: "what does this repository do?"},
+		{Parameters: map[string]any{"repo": "acme"}},
+		{Parameters: map[string]any{"repo": "acme/shop/../other"}},
+	} {
+		if _, err := a.repo(req); err == nil {
+			t.Errorf("%+v: expected error", req)
+		}
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	notFound := newFakeSource()
+	notFound.err = &APIError{StatusCode: http.StatusNotFound, Message: "Not Found"}
+	down := newFakeSource()
+	down.err = errors.New("connection reset")
+	tests := []struct {
+		name string
+		src  *fakeSource
+		req  mpcserver.Request
+		code int
+	}{
+		{"no repo", newFakeSource(), mpcserver.Request{Prompt: "what is this?"}, http.StatusBadRequest},
+		{"no query", newFakeSource(), mpcserver.Request{Parameters: map[string]any{"repo": "acme/shop"}}, http.StatusBadRequest},
+		{"not found", notFound, mpcserver.Request{Prompt: "about acme/gone"}, http.StatusBadRequest},
+		{"api failure", down, mpcserver.Request{Prompt: "about acme/shop"}, 0},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.src, Options{}).Handle(context.Background(), tt.req)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		var e *mpcserver.Error
+		if got := errors.As(err, &e); got != (tt.code != 0) || (got && e.Status != tt.code) {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	s := strings.Repeat("line\n", 100)
+	got := truncate(s, 52)
+	if len(got) > 52+len("\n[truncated]") || !strings.HasSuffix(got, "line\n[truncated]") {
+		t.Errorf("truncate = %q", got)
+	}
+	if truncate("short\n", 100) != "short" {
+		t.Error("short text changed")
+	}
+}
@@ -0,0 +1,187 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the REST API of github.com.
+const DefaultAPIURL = "https://api.github.com"
+
+// maxFileSize caps the bytes read of one file or README.
+const maxFileSize = 1 << 20
+
+// APIError is a failed GitHub API request.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github: %d %s", e.StatusCode, e.Message)
+}
+
+// Client reads repositories through the GitHub REST API.
+type Client struct {
+	apiURL string
+	token  string
+	http   *http.Client
+}
+
+// NewClient returns a Source reading from the REST API at apiURL, such as
+// DefaultAPIURL or a GitHub Enterprise server's "/api/v3" URL, sending
+// token, if not empty, to read private repositories and for a higher rate
+// limit. httpClient may be nil.
+func NewClient(apiURL, token string, httpClient *http.Client) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{apiURL: strings.TrimSuffix(apiURL, "/"), token: token, http: httpClient}
+}
+
+// DefaultBranch returns the repository's default branch.
+func (c *Client) DefaultBranch(ctx context.Context, repo Repo) (string, error) {
+	var body struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := c.getJSON(ctx, repo.path(""), nil, &body); err != nil {
+		return "", err
+	}
+	return body.DefaultBranch, nil
+}
+
+// Tree returns the files of the repository at ref, recursively.
+func (c *Client) Tree(ctx context.Context, repo Repo, ref string) ([]TreeEntry, error) {
+	var body struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+			Size int64  `json:"size"`
+		} `json:"tree"`
+	}
+	if err := c.getJSON(ctx, repo.path("/git/trees/"+url.PathEscape(ref)), url.Values{"recursive": {"1"}}, &body); err != nil {
+		return nil, err
+	}
+	var out []TreeEntry
+	for _, e := range body.Tree {
+		if e.Type == "blob" {
+			out = append(out, TreeEntry{Path: e.Path, Size: e.Size})
+		}
+	}
+	return out, nil
+}
+
+// README returns the repository's README at ref, or "" if it has none.
+func (c *Client) README(ctx context.Context, repo Repo, ref string) (string, error) {
+	s, err := c.getRaw(ctx, repo.path("/readme"), url.Values{"ref": {ref}})
+	if e, ok := err.(*APIError); ok && e.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	return s, err
+}
+
+// File returns the contents of the file at path at ref.
+func (c *Client) File(ctx context.Context, repo Repo, path, ref string) (string, error) {
+	return c.getRaw(ctx, repo.path("/contents/"+escapePath(path)), url.Values{"ref": {ref}})
+}
+
+// Commits returns the latest n commits on ref.
+func (c *Client) Commits(ctx context.Context, repo Repo, ref string, n int) ([]Commit, error) {
+	var body []struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string    `json:"name"`
+				Date time.Time `json:"date"`
+			} `json:"author"`
+		} `json:"commit"`
+	}
+	q := url.Values{"sha": {ref}, "per_page": {strconv.Itoa(n)}}
+	if err := c.getJSON(ctx, repo.path("/commits"), q, &body); err != nil {
+		return nil, err
+	}
+	out := make([]Commit, 0, len(body))
+	for _, b := range body {
+		out = append(out, Commit{SHA: b.SHA, Message: b.Commit.Message, Author: b.Commit.Author.Name, Date: b.Commit.Author.Date})
+	}
+	return out, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, v any) error {
+	res, err := c.get(ctx, path, q, "application/vnd.github+json")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("github: decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Client) getRaw(ctx context.Context, path string, q url.Values) (string, error) {
+	res, err := c.get(ctx, path, q, "application/vnd.github.raw+json")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxFileSize))
+	if err != nil {
+		return "", fmt.Errorf("github: read %s: %w", path, err)
+	}
+	return string(b), nil
+}
+
+// get sends a GET request, returning the response when it succeeded and
+// an *APIError otherwise.
+func (c *Client) get(ctx context.Context, path string, q url.Values, accept string) (*http.Response, error) {
+	u := c.apiURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("github: %w", err)
+	}
+	if res.StatusCode == http.StatusOK {
+		return res, nil
+	}
+	defer res.Body.Close()
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+	if body.Message == "" {
+		body.Message = http.StatusText(res.StatusCode)
+	}
+	return nil, &APIError{StatusCode: res.StatusCode, Message: body.Message}
+}
+
+// escapePath escapes each element of a slash-separated path.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		parts[i] = url.PathEscape(s)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,104 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestAPI serves a repository "acme/shop" on branch "main" the way the
+// GitHub REST API does, checking that requests carry the token.
+func newTestAPI(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/acme/shop", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"default_branch": "main"})
+	})
+	mux.HandleFunc("GET /repos/acme/shop/git/trees/main", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("recursive") != "1" {
+			t.Errorf("tree not recursive: %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"tree": []map[string]any{
+			{"path": "cmd", "type": "tree"},
+			{"path": "cmd/main.go", "type": "blob", "size": 120},
+			{"path": "README.md", "type": "blob", "size": 40},
+		}})
+	})
+	mux.HandleFunc("GET /repos/acme/shop/readme", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.github.raw+json" {
+			t.Errorf("README requested as %q", r.Header.Get("Accept"))
+		}
+		w.Write([]byte("# Shop\n"))
+	})
+	mux.HandleFunc("GET /repos/acme/shop/contents/cmd/main.go", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("package main\n"))
+	})
+	mux.HandleFunc("GET /repos/acme/shop/commits", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sha") != "main" || r.URL.Query().Get("per_page") != "2" {
+			t.Errorf("commits requested as %s", r.URL)
+		}
+		json.NewEncoder(w).Encode([]map[string]any{{
+			"sha":    "abc123",
+			"commit": map[string]any{"message": "Fix checkout\n\nDetails.", "author": map[string]any{"name": "Ada", "date": "2026-10-01T12:00:00Z"}},
+		}})
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" || r.Header.Get("X-GitHub-Api-Version") == "" {
+			t.Errorf("%s sent without the token and API version", r.URL.Path)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestAPI(t)
+	c := NewClient(srv.URL, "t0ken", nil)
+	ctx := context.Background()
+	repo := Repo{Owner: "acme", Name: "shop"}
+
+	if ref, err := c.DefaultBranch(ctx, repo); err != nil || ref != "main" {
+		t.Errorf("default branch = %q, %v", ref, err)
+	}
+	tree, err := c.Tree(ctx, repo, "main")
+	if err != nil || !slices.Equal(tree, []TreeEntry{{"cmd/main.go", 120}, {"README.md", 40}}) {
+		t.Errorf("tree = %+v, %v", tree, err)
+	}
+	if readme, err := c.README(ctx, repo, "main"); err != nil || readme != "# Shop\n" {
+		t.Errorf("README = %q, %v", readme, err)
+	}
+	if file, err := c.File(ctx, repo, "cmd/main.go", "main"); err != nil || file != "package main\n" {
+		t.Errorf("file = %q, %v", file, err)
+	}
+	commits, err := c.Commits(ctx, repo, "main", 2)
+	want := Commit{SHA: "abc123", Message: "Fix checkout\n\nDetails.", Author: "Ada", Date: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	if err != nil || len(commits) != 1 || commits[0] != want {
+		t.Errorf("commits = %+v, %v", commits, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Not Found"}`))
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "", nil)
+	ctx := context.Background()
+	repo := Repo{Owner: "acme", Name: "gone"}
+
+	_, err := c.DefaultBranch(ctx, repo)
+	var e *APIError
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Message != "Not Found" {
+		t.Errorf("err = %v, want a 404 APIError", err)
+	}
+	// A repository without a README is not an error.
+	if readme, err := c.README(ctx, repo, "main"); err != nil || readme != "" {
+		t.Errorf("README = %q, %v", readme, err)
+	}
+}
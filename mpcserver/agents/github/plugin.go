@@ -0,0 +1,66 @@
+package github
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Config is the agent's configuration section, read from the server's
+// -agents-config file:
+//
+//	agents:
+//	  githubContextAgent:
+//	    token: ghp_...
+//	    repo: olafkfreund/ai_team_workshop
+//	    answer_server: http://localhost:8080
+//	    answer_agent: summarizer
+type Config struct {
+	// Token authenticates to the GitHub API; $GITHUB_TOKEN is used when
+	// it is empty. Without either only public repositories can be read,
+	// at a low rate limit.
+	Token string `json:"token"`
+	// APIURL is the GitHub REST API, DefaultAPIURL when empty.
+	APIURL string `json:"api_url"`
+	// Repo is the repository asked about when a request names none.
+	Repo string `json:"repo"`
+	// AnswerAgent, when set, is the agent on AnswerServer that answers
+	// from the assembled context.
+	AnswerAgent  string `json:"answer_agent"`
+	AnswerServer string `json:"answer_server"`
+	MaxFiles     int    `json:"max_files"`
+	Commits      int    `json:"commits"`
+}
+
+func init() {
+	mpcserver.RegisterPlugin(mpcserver.Plugin{Name: Name, New: newPlugin})
+}
+
+// newPlugin builds an agent reading the GitHub API with the section's
+// token.
+func newPlugin(section mpcserver.ConfigSection) (mpcserver.Agent, error) {
+	var cfg Config
+	if err := section.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	if cfg.Repo != "" && !repoName.MatchString(cfg.Repo) {
+		return nil, fmt.Errorf("github: invalid repo %q; use owner/name", cfg.Repo)
+	}
+	opts := Options{Repo: cfg.Repo, MaxFiles: cfg.MaxFiles, Commits: cfg.Commits}
+	if cfg.AnswerAgent != "" {
+		if cfg.AnswerServer == "" {
+			return nil, fmt.Errorf("github: answer_agent needs answer_server")
+		}
+		c, err := mpcclient.NewClient(cfg.AnswerServer)
+		if err != nil {
+			return nil, fmt.Errorf("github: answer_server: %w", err)
+		}
+		opts.Answerer = AgentAnswerer{Client: c, Agent: cfg.AnswerAgent}
+	}
+	return New(NewClient(cfg.APIURL, cfg.Token, nil), opts), nil
+}
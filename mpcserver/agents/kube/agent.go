@@ -0,0 +1,294 @@
+// Package kube implements kubernetesMetricsAgent, which reports the status,
+// restarts and resource usage of the pods and deployments in a Kubernetes
+// namespace.
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Name is the name the workshop registers the agent under.
+const Name = "kubernetesMetricsAgent"
+
+// DefaultNamespace is the namespace asked about when neither the request
+// nor the agent's configuration names one.
+const DefaultNamespace = "default"
+
+// Thresholds above which the report warns about a pod.
+const (
+	restartWarning = 5
+	usageWarning   = 0.9
+)
+
+// Cluster reads workloads from a Kubernetes cluster. KubeCluster implements
+// it with client-go; tests substitute a fake.
+type Cluster interface {
+	// Deployments returns the deployments in namespace, or only the one
+	// called name when it is not empty. A deployment that does not exist
+	// is reported with ErrNotFound.
+	Deployments(ctx context.Context, namespace, name string) ([]Deployment, error)
+	// Pods returns the pods in namespace matching the label selector.
+	Pods(ctx context.Context, namespace, selector string) ([]Pod, error)
+	// PodUsage returns the current resource usage of the pods in namespace
+	// matching the label selector, keyed by pod name. It returns
+	// ErrMetricsUnavailable when the cluster serves no resource metrics.
+	PodUsage(ctx context.Context, namespace, selector string) (map[string]Resources, error)
+}
+
+var (
+	// ErrNotFound is returned by Cluster for a deployment that does not
+	// exist.
+	ErrNotFound = errors.New("kube: not found")
+	// ErrMetricsUnavailable is returned by Cluster.PodUsage when the
+	// cluster has no resource metrics API, as without metrics-server.
+	ErrMetricsUnavailable = errors.New("kube: resource metrics unavailable")
+)
+
+// Resources is an amount of CPU and memory.
+type Resources struct {
+	CPUMillicores int64 `json:"cpu_millicores"`
+	MemoryBytes   int64 `json:"memory_bytes"`
+}
+
+// Pod is the state of one pod.
+type Pod struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+	// Reason explains a pod that is not running normally, such as
+	// CrashLoopBackOff or OOMKilled.
+	Reason          string    `json:"reason,omitempty"`
+	Node            string    `json:"node,omitempty"`
+	ReadyContainers int       `json:"ready_containers"`
+	Containers      int       `json:"containers"`
+	Restarts        int32     `json:"restarts"`
+	StartedAt       time.Time `json:"started_at,omitzero"`
+	// Requests and Limits add up those of the pod's containers.
+	Requests Resources `json:"requests"`
+	Limits   Resources `json:"limits"`
+	// Usage is the pod's current usage, when the cluster reports it.
+	Usage *Resources `json:"usage,omitempty"`
+}
+
+// Deployment is the state of one deployment.
+type Deployment struct {
+	Name              string `json:"name"`
+	Replicas          int32  `json:"replicas"`
+	ReadyReplicas     int32  `json:"ready_replicas"`
+	UpdatedReplicas   int32  `json:"updated_replicas"`
+	AvailableReplicas int32  `json:"available_replicas"`
+	// Selector is the label selector of the deployment's pods.
+	Selector string `json:"selector"`
+}
+
+// Report is the structured payload returned in the response's data field.
+type Report struct {
+	Namespace   string       `json:"namespace"`
+	Deployment  string       `json:"deployment,omitempty"`
+	Selector    string       `json:"selector,omitempty"`
+	Deployments []Deployment `json:"deployments,omitempty"`
+	Pods        []Pod        `json:"pods,omitempty"`
+	// UsageAvailable reports whether pod usage was asked for and the
+	// cluster reported it.
+	UsageAvailable bool     `json:"usage_available"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// Agent answers questions about the workloads in a namespace.
+type Agent struct {
+	cluster   Cluster
+	namespace string
+}
+
+// New returns an agent reading workloads from cluster, in namespace unless
+// a request names another; an empty namespace means DefaultNamespace.
+func New(cluster Cluster, namespace string) *Agent {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return &Agent{cluster: cluster, namespace: namespace}
+}
+
+// Describe reports the agent's capabilities.
+func (a *Agent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{
+		Description:  "Reports the status, restarts and resource usage of Kubernetes pods and deployments in a namespace",
+		Version:      "1.0.0",
+		Capabilities: []string{"kubernetes", "workload_status", "resource_usage"},
+		Parameters: []mpcserver.ParameterInfo{
+			{Name: paramNamespace, Type: mpcserver.TypeString, Description: "Namespace to inspect; defaults to " + a.namespace},
+			{Name: paramDeployment, Type: mpcserver.TypeString, Description: "Deployment to report on, with its pods"},
+			{Name: paramSelector, Type: mpcserver.TypeString, Description: "Label selector the pods must match, such as app=web"},
+			{Name: paramInclude, Type: mpcserver.TypeList, Description: "What to report: pods, deployments, usage"},
+		},
+		ExamplePrompts: []string{
+			"Show the status of pods in namespace 'payments'",
+			"How many restarts and how much CPU and memory for deployment checkout in namespace shop?",
+		},
+	}
+}
+
+// Handle reads the workloads the request asks about and summarizes them.
+func (a *Agent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	p, err := parseParams(req)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	if p.namespace == "" {
+		p.namespace = a.namespace
+	}
+	report := Report{Namespace: p.namespace, Deployment: p.deployment, Selector: p.selector}
+
+	selector := p.selector
+	if p.deployment != "" || p.include[includeDeployments] {
+		mpcserver.ReportStatus(ctx, "listing deployments")
+		deps, err := a.cluster.Deployments(ctx, p.namespace, p.deployment)
+		if errors.Is(err, ErrNotFound) {
+			return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest,
+				"deployment %q not found in namespace %q", p.deployment, p.namespace)
+		}
+		if err != nil {
+			return mpcserver.Response{}, fmt.Errorf("list deployments in %s: %w", p.namespace, err)
+		}
+		if p.deployment != "" && len(deps) == 1 {
+			selector = joinSelectors(deps[0].Selector, p.selector)
+		}
+		if p.include[includeDeployments] {
+			report.Deployments = deps
+		}
+	}
+
+	if p.include[includePods] || p.include[includeUsage] {
+		mpcserver.ReportStatus(ctx, "listing pods")
+		if report.Pods, err = a.cluster.Pods(ctx, p.namespace, selector); err != nil {
+			return mpcserver.Response{}, fmt.Errorf("list pods in %s: %w", p.namespace, err)
+		}
+	}
+	if p.include[includeUsage] {
+		mpcserver.ReportStatus(ctx, "reading pod metrics")
+		usage, err := a.cluster.PodUsage(ctx, p.namespace, selector)
+		switch {
+		case errors.Is(err, ErrMetricsUnavailable):
+			report.Warnings = append(report.Warnings, "resource usage is unavailable; is metrics-server installed?")
+		case err != nil:
+			return mpcserver.Response{}, fmt.Errorf("read pod metrics in %s: %w", p.namespace, err)
+		default:
+			report.UsageAvailable = true
+			for i := range report.Pods {
+				if u, ok := usage[report.Pods[i].Name]; ok {
+					report.Pods[i].Usage = &u
+				}
+			}
+		}
+	}
+	report.Warnings = append(report.Warnings, warnings(report)...)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	return mpcserver.Response{Result: report.text(p.include), Data: data}, nil
+}
+
+// joinSelectors requires the labels of both selectors.
+func joinSelectors(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + "," + b
+}
+
+// warnings points out the deployments short of ready replicas and the
+// pods that are unready, restarting often or near their limits.
+func warnings(r Report) []string {
+	var out []string
+	for _, d := range r.Deployments {
+		if d.ReadyReplicas < d.Replicas {
+			out = append(out, fmt.Sprintf("deployment %s has %d of %d replicas ready", d.Name, d.ReadyReplicas, d.Replicas))
+		}
+	}
+	for _, p := range r.Pods {
+		switch {
+		case p.Reason != "":
+			out = append(out, fmt.Sprintf("pod %s is %s", p.Name, p.Reason))
+		case p.Phase != "Succeeded" && p.ReadyContainers < p.Containers:
+			out = append(out, fmt.Sprintf("pod %s has %d of %d containers ready", p.Name, p.ReadyContainers, p.Containers))
+		}
+		if p.Restarts >= restartWarning {
+			out = append(out, fmt.Sprintf("pod %s has restarted %d times", p.Name, p.Restarts))
+		}
+		if p.Usage == nil {
+			continue
+		}
+		if l := p.Limits.MemoryBytes; l > 0 && float64(p.Usage.MemoryBytes) >= usageWarning*float64(l) {
+			out = append(out, fmt.Sprintf("pod %s uses %s of its %s memory limit", p.Name, formatBytes(p.Usage.MemoryBytes), formatBytes(l)))
+		}
+		if l := p.Limits.CPUMillicores; l > 0 && float64(p.Usage.CPUMillicores) >= usageWarning*float64(l) {
+			out = append(out, fmt.Sprintf("pod %s uses %dm of its %dm CPU limit", p.Name, p.Usage.CPUMillicores, l))
+		}
+	}
+	return out
+}
+
+func (r Report) text(include map[string]bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Kubernetes workloads in namespace %s", r.Namespace)
+	if r.Deployment != "" {
+		fmt.Fprintf(&b, ", deployment %s", r.Deployment)
+	}
+	b.WriteString(":\n")
+	if include[includeDeployments] {
+		if len(r.Deployments) == 0 {
+			b.WriteString("No deployments.\n")
+		}
+		for _, d := range r.Deployments {
+			fmt.Fprintf(&b, "- deployment %s: %d/%d ready, %d updated, %d available\n",
+				d.Name, d.ReadyReplicas, d.Replicas, d.UpdatedReplicas, d.AvailableReplicas)
+		}
+	}
+	if include[includePods] || include[includeUsage] {
+		if len(r.Pods) == 0 {
+			b.WriteString("No pods.\n")
+		}
+		for _, p := range r.Pods {
+			status := p.Phase
+			if p.Reason != "" {
+				status += " (" + p.Reason + ")"
+			}
+			fmt.Fprintf(&b, "- pod %s: %s, %d/%d ready, %d restarts", p.Name, status, p.ReadyContainers, p.Containers, p.Restarts)
+			if p.Usage != nil {
+				fmt.Fprintf(&b, ", cpu %dm, memory %s", p.Usage.CPUMillicores, formatBytes(p.Usage.MemoryBytes))
+			}
+			b.WriteString("\n")
+		}
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", w)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatBytes renders n bytes in binary units.
+func formatBytes(n int64) string {
+	const k = 1024
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v, i := float64(n), 0
+	for v >= k && i < len(units)-1 {
+		v /= k
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
@@ -0,0 +1,155 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+type fakeCluster struct {
+	deployments []Deployment
+	pods        []Pod
+	usage       map[string]Resources
+	usageErr    error
+	err         error
+	// Arguments of the last calls.
+	namespace, name, selector string
+}
+
+func (f *fakeCluster) Deployments(_ context.Context, namespace, name string) ([]Deployment, error) {
+	f.namespace, f.name = namespace, name
+	if f.err != nil {
+		return nil, f.err
+	}
+	if name == "" {
+		return f.deployments, nil
+	}
+	for _, d := range f.deployments {
+		if d.Name == name {
+			return []Deployment{d}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (f *fakeCluster) Pods(_ context.Context, namespace, selector string) ([]Pod, error) {
+	f.namespace, f.selector = namespace, selector
+	return f.pods, f.err
+}
+
+func (f *fakeCluster) PodUsage(_ context.Context, namespace, selector string) (map[string]Resources, error) {
+	return f.usage, f.usageErr
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		deployments: []Deployment{
+			{Name: "checkout", Replicas: 3, ReadyReplicas: 2, UpdatedReplicas: 3, AvailableReplicas: 2, Selector: "app=checkout"},
+			{Name: "web", Replicas: 2, ReadyReplicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2, Selector: "app=web"},
+		},
+		pods: []Pod{
+			{Name: "checkout-1", Phase: "Running", ReadyContainers: 1, Containers: 1, Limits: Resources{CPUMillicores: 500, MemoryBytes: 256 << 20}},
+			{Name: "checkout-2", Phase: "Running", Reason: "CrashLoopBackOff", Containers: 1, Restarts: 7},
+		},
+		usage: map[string]Resources{"checkout-1": {CPUMillicores: 120, MemoryBytes: 250 << 20}},
+	}
+}
+
+func TestHandleDeployment(t *testing.T) {
+	cluster := newFakeCluster()
+	resp, err := New(cluster, "").Handle(context.Background(), mpcserver.Request{
+		Prompt: "Show pod restarts and memory usage for deployment 'checkout' in namespace shop",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.namespace != "shop" || cluster.name != "checkout" || cluster.selector != "app=checkout" {
+		t.Errorf("asked for %q in %s with selector %q", cluster.name, cluster.namespace, cluster.selector)
+	}
+
+	var report Report
+	if err := json.Unmarshal(resp.Data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Pods) != 2 || !report.UsageAvailable || report.Pods[0].Usage == nil || report.Pods[0].Usage.CPUMillicores != 120 {
+		t.Errorf("report = %+v", report)
+	}
+	for _, want := range []string{
+		"namespace shop, deployment checkout",
+		"- deployment checkout: 2/3 ready",
+		"- pod checkout-1: Running, 1/1 ready, 0 restarts, cpu 120m, memory 250.0 MiB",
+		"- pod checkout-2: Running (CrashLoopBackOff), 0/1 ready, 7 restarts",
+		"Warning: deployment checkout has 2 of 3 replicas ready",
+		"Warning: pod checkout-2 is CrashLoopBackOff",
+		"Warning: pod checkout-2 has restarted 7 times",
+		"Warning: pod checkout-1 uses 250.0 MiB of its 256.0 MiB memory limit",
+	} {
+		if !strings.Contains(resp.Result, want) {
+			t.Errorf("result missing %q:\n%s", want, resp.Result)
+		}
+	}
+}
+
+func TestHandleNamespaceDefaults(t *testing.T) {
+	cluster := newFakeCluster()
+	a := New(cluster, "payments")
+	resp, err := a.Handle(context.Background(), mpcserver.Request{Prompt: "list the pods", Parameters: map[string]any{"label_selector": "tier=api"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.namespace != "payments" || cluster.selector != "tier=api" {
+		t.Errorf("listed pods in %s with selector %q", cluster.namespace, cluster.selector)
+	}
+	if strings.Contains(resp.Result, "deployment") {
+		t.Errorf("result of a pods question lists deployments:\n%s", resp.Result)
+	}
+	if _, err := New(cluster, "").Handle(context.Background(), mpcserver.Request{Prompt: "list the pods"}); err != nil || cluster.namespace != DefaultNamespace {
+		t.Errorf("namespace = %s (err %v), want %s", cluster.namespace, err, DefaultNamespace)
+	}
+}
+
+func TestHandleMetricsUnavailable(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.usageErr = ErrMetricsUnavailable
+	resp, err := New(cluster, "shop").Handle(context.Background(), mpcserver.Request{Prompt: "cpu usage of the pods"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	json.Unmarshal(resp.Data, &report)
+	if report.UsageAvailable || len(report.Pods) != 2 || !strings.Contains(resp.Result, "metrics-server") {
+		t.Errorf("report = %+v\n%s", report, resp.Result)
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster *fakeCluster
+		req     mpcserver.Request
+		code    int
+	}{
+		{"bad namespace", newFakeCluster(), mpcserver.Request{Parameters: map[string]any{"namespace": "Not_Valid"}}, http.StatusBadRequest},
+		{"bad selector", newFakeCluster(), mpcserver.Request{Parameters: map[string]any{"label_selector": "app in (web"}}, http.StatusBadRequest},
+		{"bad include", newFakeCluster(), mpcserver.Request{Parameters: map[string]any{"include": "secrets"}}, http.StatusBadRequest},
+		{"unknown deployment", newFakeCluster(), mpcserver.Request{Prompt: "status of deployment billing"}, http.StatusBadRequest},
+		{"cluster failure", &fakeCluster{err: errors.New("connection refused")}, mpcserver.Request{Prompt: "list pods"}, 0},
+		{"metrics failure", &fakeCluster{usageErr: errors.New("timeout")}, mpcserver.Request{Prompt: "memory usage"}, 0},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.cluster, "shop").Handle(context.Background(), tt.req)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		var e *mpcserver.Error
+		if got := errors.As(err, &e); got != (tt.code != 0) || (got && e.Status != tt.code) {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
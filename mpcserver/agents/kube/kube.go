@@ -0,0 +1,168 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// KubeCluster reads workloads with client-go, and pod usage from the
+// resource metrics API that metrics-server serves.
+type KubeCluster struct {
+	client  kubernetes.Interface
+	metrics metricsclient.Interface
+}
+
+// NewKubeCluster returns a Cluster reading through the given clientsets.
+func NewKubeCluster(client kubernetes.Interface, metrics metricsclient.Interface) *KubeCluster {
+	return &KubeCluster{client: client, metrics: metrics}
+}
+
+// NewKubeClusterForConfig returns a Cluster talking to the API server cfg
+// describes, as returned by LoadConfig.
+func NewKubeClusterForConfig(cfg *rest.Config) (*KubeCluster, error) {
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("kube: create client: %w", err)
+	}
+	metrics, err := metricsclient.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("kube: create metrics client: %w", err)
+	}
+	return NewKubeCluster(client, metrics), nil
+}
+
+// LoadConfig returns the configuration for reaching the cluster: that of
+// the pod's service account when running in a cluster and kubeconfig is
+// empty, and otherwise that of the kubeconfig file, $KUBECONFIG or
+// ~/.kube/config, in that order, using kubeContext instead of the current
+// context when it is not empty.
+func LoadConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeconfig == "" && kubeContext == "" {
+		if cfg, err := rest.InClusterConfig(); err == nil {
+			return cfg, nil
+		} else if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, fmt.Errorf("kube: in-cluster config: %w", err)
+		}
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kube: load kubeconfig: %w", err)
+	}
+	return cfg, nil
+}
+
+// Deployments lists the deployments in namespace, or gets the one called
+// name.
+func (c *KubeCluster) Deployments(ctx context.Context, namespace, name string) ([]Deployment, error) {
+	api := c.client.AppsV1().Deployments(namespace)
+	if name != "" {
+		d, err := api.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("deployment %s/%s: %w", namespace, name, ErrNotFound)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []Deployment{deployment(d.Name, d.Spec.Replicas, d.Status.ReadyReplicas, d.Status.UpdatedReplicas, d.Status.AvailableReplicas, d.Spec.Selector)}, nil
+	}
+	list, err := api.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Deployment, 0, len(list.Items))
+	for _, d := range list.Items {
+		out = append(out, deployment(d.Name, d.Spec.Replicas, d.Status.ReadyReplicas, d.Status.UpdatedReplicas, d.Status.AvailableReplicas, d.Spec.Selector))
+	}
+	return out, nil
+}
+
+func deployment(name string, replicas *int32, ready, updated, available int32, selector *metav1.LabelSelector) Deployment {
+	d := Deployment{Name: name, Replicas: 1, ReadyReplicas: ready, UpdatedReplicas: updated, AvailableReplicas: available}
+	if replicas != nil {
+		d.Replicas = *replicas
+	}
+	if selector != nil {
+		d.Selector = metav1.FormatLabelSelector(selector)
+	}
+	return d
+}
+
+// Pods lists the pods in namespace matching selector.
+func (c *KubeCluster) Pods(ctx context.Context, namespace, selector string) ([]Pod, error) {
+	list, err := c.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Pod, 0, len(list.Items))
+	for i := range list.Items {
+		out = append(out, pod(&list.Items[i]))
+	}
+	return out, nil
+}
+
+func pod(p *corev1.Pod) Pod {
+	out := Pod{
+		Name:       p.Name,
+		Phase:      string(p.Status.Phase),
+		Reason:     p.Status.Reason,
+		Node:       p.Spec.NodeName,
+		Containers: len(p.Spec.Containers),
+	}
+	if p.Status.StartTime != nil {
+		out.StartedAt = p.Status.StartTime.UTC()
+	}
+	for _, c := range p.Spec.Containers {
+		out.Requests.CPUMillicores += c.Resources.Requests.Cpu().MilliValue()
+		out.Requests.MemoryBytes += c.Resources.Requests.Memory().Value()
+		out.Limits.CPUMillicores += c.Resources.Limits.Cpu().MilliValue()
+		out.Limits.MemoryBytes += c.Resources.Limits.Memory().Value()
+	}
+	for _, s := range p.Status.ContainerStatuses {
+		if s.Ready {
+			out.ReadyContainers++
+		}
+		out.Restarts += s.RestartCount
+		// A container waiting to start again, as in CrashLoopBackOff,
+		// explains more than the pod's phase does.
+		if out.Reason == "" && s.State.Waiting != nil && s.State.Waiting.Reason != "ContainerCreating" {
+			out.Reason = s.State.Waiting.Reason
+		}
+		if out.Reason == "" && !s.Ready && s.LastTerminationState.Terminated != nil {
+			out.Reason = s.LastTerminationState.Terminated.Reason
+		}
+	}
+	return out
+}
+
+// PodUsage reads the usage of the pods in namespace matching selector from
+// the resource metrics API.
+func (c *KubeCluster) PodUsage(ctx context.Context, namespace, selector string) (map[string]Resources, error) {
+	list, err := c.metrics.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+		return nil, fmt.Errorf("%w: %v", ErrMetricsUnavailable, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Resources, len(list.Items))
+	for _, m := range list.Items {
+		var r Resources
+		for _, c := range m.Containers {
+			r.CPUMillicores += c.Usage.Cpu().MilliValue()
+			r.MemoryBytes += c.Usage.Memory().Value()
+		}
+		out[m.Name] = r
+	}
+	return out, nil
+}
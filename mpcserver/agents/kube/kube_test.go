@@ -0,0 +1,121 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func newTestKubeCluster() (*KubeCluster, *metricsfake.Clientset) {
+	client := fake.NewClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr(int32(2)),
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			Status: appsv1.DeploymentStatus{ReadyReplicas: 1, UpdatedReplicas: 2, AvailableReplicas: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop", Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{NodeName: "node-a", Containers: []corev1.Container{
+				{Name: "app", Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+					Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+				}},
+				{Name: "sidecar", Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+				}},
+			}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: true, RestartCount: 1},
+				{Name: "sidecar", RestartCount: 4, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			}},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-1", Namespace: "shop", Labels: map[string]string{"app": "db"}}},
+	)
+	// The fake tracker files PodMetrics under the wrong resource, so the
+	// list the metrics API serves is given by a reactor.
+	metrics := metricsfake.NewSimpleClientset()
+	metrics.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop", Labels: map[string]string{"app": "web"}},
+			Containers: []metricsv1beta1.ContainerMetrics{
+				{Name: "app", Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m"), corev1.ResourceMemory: resource.MustParse("100Mi")}},
+				{Name: "sidecar", Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("5m"), corev1.ResourceMemory: resource.MustParse("10Mi")}},
+			},
+		}}}, nil
+	})
+	return NewKubeCluster(client, metrics), metrics
+}
+
+func TestKubeClusterDeployments(t *testing.T) {
+	c, _ := newTestKubeCluster()
+	ctx := context.Background()
+	deps, err := c.Deployments(ctx, "shop", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Deployment{Name: "web", Replicas: 2, ReadyReplicas: 1, UpdatedReplicas: 2, AvailableReplicas: 1, Selector: "app=web"}
+	if len(deps) != 1 || deps[0] != want {
+		t.Errorf("deployments = %+v, want %+v", deps, want)
+	}
+	if deps, err := c.Deployments(ctx, "shop", ""); err != nil || len(deps) != 1 {
+		t.Errorf("listed %+v, %v", deps, err)
+	}
+	if _, err := c.Deployments(ctx, "shop", "api"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestKubeClusterPods(t *testing.T) {
+	c, _ := newTestKubeCluster()
+	pods, err := c.Pods(context.Background(), "shop", "app=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 {
+		t.Fatalf("pods = %+v", pods)
+	}
+	p := pods[0]
+	if p.Name != "web-1" || p.Phase != "Running" || p.Node != "node-a" || p.Reason != "CrashLoopBackOff" ||
+		p.ReadyContainers != 1 || p.Containers != 2 || p.Restarts != 5 {
+		t.Errorf("pod = %+v", p)
+	}
+	if p.Requests != (Resources{CPUMillicores: 150, MemoryBytes: 64 << 20}) || p.Limits != (Resources{CPUMillicores: 1000, MemoryBytes: 128 << 20}) {
+		t.Errorf("requests %+v, limits %+v", p.Requests, p.Limits)
+	}
+}
+
+func TestKubeClusterPodUsage(t *testing.T) {
+	c, metrics := newTestKubeCluster()
+	ctx := context.Background()
+	usage, err := c.PodUsage(ctx, "shop", "app=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage["web-1"] != (Resources{CPUMillicores: 255, MemoryBytes: 110 << 20}) {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	metrics.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "metrics.k8s.io", Resource: "pods"}, "")
+	})
+	if _, err := c.PodUsage(ctx, "shop", ""); !errors.Is(err, ErrMetricsUnavailable) {
+		t.Errorf("err = %v, want ErrMetricsUnavailable", err)
+	}
+}
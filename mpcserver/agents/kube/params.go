@@ -0,0 +1,136 @@
+package kube
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Parameter names.
+const (
+	paramNamespace  = "namespace"
+	paramDeployment = "deployment"
+	paramSelector   = "label_selector"
+	paramInclude    = "include"
+)
+
+// What a report can include.
+const (
+	includePods        = "pods"
+	includeDeployments = "deployments"
+	includeUsage       = "usage"
+)
+
+// Patterns picking parameters out of prompts such as "Show restarts for
+// deployment 'checkout' in namespace shop".
+var (
+	namespacePattern  = regexp.MustCompile(`(?i)\b(?:namespace|ns)\s+(?:named\s+|called\s+)?['"]?([a-z0-9][a-z0-9-]*)`)
+	deploymentPattern = regexp.MustCompile(`(?i)\b(?:deployment|deploy)\s+(?:named\s+|called\s+)?['"]?([a-z0-9][a-z0-9.-]*)`)
+	includeWords      = map[string][]string{
+		includePods:        {"pod", "pods", "restart", "restarts", "crash", "crashing", "status"},
+		includeDeployments: {"deployment", "deployments", "rollout", "replicas"},
+		includeUsage:       {"usage", "cpu", "memory", "resources", "utilization"},
+	}
+	// notNames are words the name patterns catch in prompts such as
+	// "deployment in namespace shop" that name nothing.
+	notNames = []string{"in", "of", "for", "on", "and", "status", "with"}
+)
+
+// params are the inputs of one request.
+type params struct {
+	namespace  string
+	deployment string
+	selector   string
+	include    map[string]bool
+}
+
+// parseParams reads the request's parameters, falling back to its context
+// and then to the prompt for anything not given explicitly, and checks
+// that the names are valid Kubernetes names.
+func parseParams(req mpcserver.Request) (params, error) {
+	p := params{
+		namespace:  req.StringParam(paramNamespace),
+		deployment: req.StringParam(paramDeployment),
+		selector:   req.StringParam(paramSelector),
+	}
+	if p.namespace == "" {
+		p.namespace = promptName(namespacePattern, req.Prompt)
+	}
+	if p.deployment == "" {
+		p.deployment = promptName(deploymentPattern, req.Prompt)
+	}
+	if p.namespace != "" {
+		if errs := validation.IsDNS1123Label(p.namespace); errs != nil {
+			return p, invalid("invalid namespace %q: %s", p.namespace, strings.Join(errs, "; "))
+		}
+	}
+	if p.deployment != "" {
+		if errs := validation.IsDNS1123Subdomain(p.deployment); errs != nil {
+			return p, invalid("invalid deployment name %q: %s", p.deployment, strings.Join(errs, "; "))
+		}
+	}
+	if p.selector != "" {
+		if _, err := labels.Parse(p.selector); err != nil {
+			return p, invalid("invalid label_selector %q: %v", p.selector, err)
+		}
+	}
+
+	if inc := req.ListParam(paramInclude); inc != nil {
+		p.include = make(map[string]bool)
+		for _, what := range inc {
+			what = strings.ToLower(what)
+			if _, ok := includeWords[what]; !ok {
+				return p, invalid("unknown %s %q; use pods, deployments or usage", paramInclude, what)
+			}
+			p.include[what] = true
+		}
+	} else {
+		p.include = promptInclude(req.Prompt)
+	}
+	return p, nil
+}
+
+func invalid(format string, args ...any) error {
+	return mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, format, args...)
+}
+
+// promptName returns the name re picks out of prompt, lowercased as
+// Kubernetes names are.
+func promptName(re *regexp.Regexp, prompt string) string {
+	m := re.FindStringSubmatch(prompt)
+	if m == nil {
+		return ""
+	}
+	name := strings.ToLower(strings.TrimRight(m[1], ".-"))
+	if slices.Contains(notNames, name) {
+		return ""
+	}
+	return name
+}
+
+// promptInclude returns what a prompt asks about, or everything if it
+// mentions none of it.
+func promptInclude(prompt string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	include := make(map[string]bool)
+	for what, keywords := range includeWords {
+		for _, w := range keywords {
+			if slices.Contains(words, w) {
+				include[what] = true
+				break
+			}
+		}
+	}
+	if len(include) == 0 {
+		return map[string]bool{includePods: true, includeDeployments: true, includeUsage: true}
+	}
+	return include
+}
@@ -0,0 +1,61 @@
+package kube
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		req                   mpcserver.Request
+		namespace, deployment string
+		include               []string
+	}{
+		{
+			req:       mpcserver.Request{Prompt: "Show the status of pods in namespace 'payments'"},
+			namespace: "payments",
+			include:   []string{includePods},
+		},
+		{
+			req:        mpcserver.Request{Prompt: "How much CPU does deployment Checkout use in ns shop?"},
+			namespace:  "shop",
+			deployment: "checkout",
+			include:    []string{includeDeployments, includeUsage},
+		},
+		{
+			req:     mpcserver.Request{Prompt: "is the deployment in namespace ops healthy"},
+			include: []string{includeDeployments},
+			// "in" is not taken for the deployment's name.
+			namespace: "ops",
+		},
+		{
+			req:     mpcserver.Request{Prompt: "what is running?"},
+			include: []string{includeDeployments, includePods, includeUsage},
+		},
+		{
+			req: mpcserver.Request{
+				Prompt:     "pods in namespace other",
+				Parameters: map[string]any{"namespace": "kube-system", "deployment": "coredns", "include": []any{"Usage"}},
+			},
+			namespace:  "kube-system",
+			deployment: "coredns",
+			include:    []string{includeUsage},
+		},
+	}
+	for _, tt := range tests {
+		p, err := parseParams(tt.req)
+		if err != nil {
+			t.Errorf("%q: %v", tt.req.Prompt, err)
+			continue
+		}
+		if p.namespace != tt.namespace || p.deployment != tt.deployment {
+			t.Errorf("%q: namespace %q, deployment %q; want %q, %q", tt.req.Prompt, p.namespace, p.deployment, tt.namespace, tt.deployment)
+		}
+		if got := slices.Sorted(maps.Keys(p.include)); !slices.Equal(got, tt.include) {
+			t.Errorf("%q: include = %q, want %q", tt.req.Prompt, got, tt.include)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package kube
+
+import (
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Config is the agent's configuration section.
+type Config struct {
+	// Kubeconfig is the kubeconfig file to read. When it and Context are
+	// empty, the agent uses its service account inside a cluster, and
+	// $KUBECONFIG or ~/.kube/config outside one.
+	Kubeconfig string `json:"kubeconfig"`
+	// Context is the kubeconfig context to use instead of the current one.
+	Context string `json:"context"`
+	// Namespace is the namespace asked about when a request names none.
+	Namespace string `json:"namespace"`
+}
+
+func init() {
+	mpcserver.RegisterPlugin(mpcserver.Plugin{Name: Name, New: newPlugin})
+}
+
+// newPlugin builds an agent reading the cluster its section points to.
+func newPlugin(section mpcserver.ConfigSection) (mpcserver.Agent, error) {
+	var cfg Config
+	if err := section.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	rc, err := LoadConfig(cfg.Kubeconfig, cfg.Context)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := NewKubeClusterForConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	return New(cluster, cfg.Namespace), nil
+}
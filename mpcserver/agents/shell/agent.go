@@ -0,0 +1,261 @@
+// Package shell implements shellAgent, which runs read-only shell commands
+// from an allowlist and returns their output, for ops assistant demos that
+// must not give a model arbitrary command execution.
+//
+// Commands are run directly, never through a shell, so pipes, redirections
+// and variables in arguments are passed on literally rather than
+// interpreted. Every argument is checked against the command's allowed
+// flags and argument pattern before anything runs, and each run is bounded
+// by a timeout and a cap on the output kept.
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Name is the name the agent is registered under and the key of its
+// configuration section.
+const Name = "shellAgent"
+
+// Defaults used for the zero values of Options.
+const (
+	DefaultTimeout   = 10 * time.Second
+	DefaultMaxOutput = 64 << 10
+	DefaultMaxArgs   = 16
+)
+
+// Parameter names.
+const (
+	paramCommand = "command"
+	paramArgs    = "args"
+)
+
+// Command is a command the agent may run.
+type Command struct {
+	// Path is the program to run, looked up in PATH unless it contains a
+	// slash. It defaults to the command's name.
+	Path string `json:"path,omitempty"`
+	// Args are passed before the caller's arguments, such as fixed flags.
+	Args []string `json:"args,omitempty"`
+	// Flags are the flags callers may pass, such as "-h" or "--lines".
+	// A flag may also be given a value as in "--lines=20", which must
+	// then match ArgPattern.
+	Flags []string `json:"flags,omitempty"`
+	// ArgPattern is a regular expression every other argument must match
+	// in full. Without one, callers may pass flags only.
+	ArgPattern string `json:"arg_pattern,omitempty"`
+	// Description tells models what the command is for.
+	Description string `json:"description,omitempty"`
+}
+
+// DefaultCommands are the commands allowed when Options names none: a few
+// that report on the host without changing it.
+func DefaultCommands() map[string]Command {
+	return map[string]Command{
+		"uptime":   {Description: "How long the host has been up, and its load averages"},
+		"date":     {Flags: []string{"-u"}, Description: "The current date and time"},
+		"hostname": {Description: "The host's name"},
+		"whoami":   {Description: "The user the server runs as"},
+		"uname":    {Flags: []string{"-a", "-s", "-r", "-m"}, Description: "The operating system and kernel"},
+		"df":       {Flags: []string{"-h", "-i", "-T"}, ArgPattern: `/[\w./-]*`, Description: "Free disk space, optionally for the file systems of the given paths"},
+		"free":     {Flags: []string{"-h", "-m", "-g"}, Description: "Free and used memory"},
+		"ps":       {Flags: []string{"-e", "-f"}, Description: "Running processes"},
+	}
+}
+
+// Options configure an Agent.
+type Options struct {
+	// Commands are the commands the agent may run, keyed by the names
+	// callers use. DefaultCommands are used when it is empty.
+	Commands map[string]Command
+	// Timeout bounds each run; a command still running is killed.
+	Timeout time.Duration
+	// MaxOutput caps the bytes of stdout, and separately of stderr, kept
+	// from each run; the rest is discarded.
+	MaxOutput int
+	// MaxArgs caps the number of arguments a caller may pass.
+	MaxArgs int
+	// Dir is the directory commands run in, the server's by default.
+	Dir string
+}
+
+// Report is the structured payload returned in the response's data field.
+type Report struct {
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	ExitCode int      `json:"exit_code"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	// Truncated reports that output beyond MaxOutput was discarded.
+	Truncated bool `json:"truncated,omitempty"`
+	// TimedOut reports that the command was killed at the timeout.
+	TimedOut   bool    `json:"timed_out,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Agent runs allowlisted commands.
+type Agent struct {
+	opts     Options
+	patterns map[string]*regexp.Regexp
+}
+
+// New returns an agent running the commands opts allows. It fails for an
+// argument pattern that does not compile.
+func New(opts Options) (*Agent, error) {
+	if len(opts.Commands) == 0 {
+		opts.Commands = DefaultCommands()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxOutput <= 0 {
+		opts.MaxOutput = DefaultMaxOutput
+	}
+	if opts.MaxArgs <= 0 {
+		opts.MaxArgs = DefaultMaxArgs
+	}
+	a := &Agent{opts: opts, patterns: make(map[string]*regexp.Regexp)}
+	for name, c := range opts.Commands {
+		if c.ArgPattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(`^(?:` + c.ArgPattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("shell: command %q: arg_pattern: %w", name, err)
+		}
+		a.patterns[name] = re
+	}
+	return a, nil
+}
+
+// Describe reports the agent's capabilities.
+func (a *Agent) Describe() mpcserver.AgentInfo {
+	names := slices.Sorted(maps.Keys(a.opts.Commands))
+	prompts := []string{"uptime"}
+	if _, ok := a.opts.Commands["df"]; ok {
+		prompts = append(prompts, "df -h")
+	}
+	return mpcserver.AgentInfo{
+		Description:  "Runs read-only shell commands from an allowlist: " + strings.Join(names, ", "),
+		Version:      "1.0.0",
+		Capabilities: []string{"shell_commands", "system_inspection"},
+		Parameters: []mpcserver.ParameterInfo{
+			{Name: paramCommand, Type: mpcserver.TypeString, Description: "Command to run, one of " + strings.Join(names, ", ") + "; the first word of the prompt when not given"},
+			{Name: paramArgs, Type: mpcserver.TypeList, Description: "Arguments to pass to the command; the rest of the prompt when no command is given"},
+		},
+		ExamplePrompts: prompts,
+	}
+}
+
+// Handle runs the command the request names and returns its output. A
+// command exiting with a failure status is reported in the result, not as
+// an error.
+func (a *Agent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	name, args := commandLine(req)
+	if name == "" {
+		return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "a prompt or the %s parameter is required", paramCommand)
+	}
+	cmd, ok := a.opts.Commands[name]
+	if !ok {
+		return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest,
+			"command %q is not allowed; allowed commands are %s", name, strings.Join(slices.Sorted(maps.Keys(a.opts.Commands)), ", "))
+	}
+	if err := a.checkArgs(name, cmd, args); err != nil {
+		return mpcserver.Response{}, err
+	}
+
+	mpcserver.ReportStatus(ctx, "running "+name)
+	report, err := a.run(ctx, name, cmd, args)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return mpcserver.Response{}, err
+	}
+	return mpcserver.Response{Result: report.text(), Data: data}, nil
+}
+
+// commandLine reads the command and its arguments from the request's
+// parameters or, when it names no command, from the words of its prompt.
+func commandLine(req mpcserver.Request) (string, []string) {
+	if name := req.StringParam(paramCommand); name != "" {
+		v, _ := req.Param(paramArgs)
+		switch v := v.(type) {
+		case string:
+			return name, strings.Fields(v)
+		case []any:
+			args := make([]string, len(v))
+			for i, arg := range v {
+				args[i] = fmt.Sprint(arg)
+			}
+			return name, args
+		}
+		return name, nil
+	}
+	words := strings.Fields(req.Prompt)
+	if len(words) == 0 {
+		return "", nil
+	}
+	return words[0], words[1:]
+}
+
+// checkArgs reports the first of args the command does not allow.
+func (a *Agent) checkArgs(name string, cmd Command, args []string) error {
+	if len(args) > a.opts.MaxArgs {
+		return mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "at most %d arguments are allowed", a.opts.MaxArgs)
+	}
+	re := a.patterns[name]
+	for _, arg := range args {
+		value, isFlag := arg, strings.HasPrefix(arg, "-")
+		if isFlag {
+			flag, v, hasValue := strings.Cut(arg, "=")
+			if !slices.Contains(cmd.Flags, flag) {
+				return mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "%s: flag %q is not allowed", name, flag)
+			}
+			if !hasValue {
+				continue
+			}
+			value = v
+		}
+		if re == nil || !re.MatchString(value) || strings.Contains(value, "..") {
+			return mpcserver.Errorf(http.StatusBadRequest, mpcserver.CodeInvalidRequest, "%s: argument %q is not allowed", name, arg)
+		}
+	}
+	return nil
+}
+
+func (r Report) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n", strings.Join(append([]string{r.Command}, r.Args...), " "))
+	b.WriteString(r.Stdout)
+	if r.Stdout != "" && !strings.HasSuffix(r.Stdout, "\n") {
+		b.WriteString("\n")
+	}
+	if r.Stderr != "" {
+		fmt.Fprintf(&b, "stderr:\n%s", r.Stderr)
+		if !strings.HasSuffix(r.Stderr, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	switch {
+	case r.TimedOut:
+		b.WriteString("(killed: timed out)\n")
+	case r.ExitCode != 0:
+		fmt.Fprintf(&b, "(exit status %d)\n", r.ExitCode)
+	}
+	if r.Truncated {
+		b.WriteString("(output truncated)\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,145 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func newTestAgent(t *testing.T, opts Options) *Agent {
+	t.Helper()
+	if opts.Commands == nil {
+		opts.Commands = map[string]Command{
+			"echo": {Flags: []string{"-n"}, ArgPattern: `\w+`},
+			"fail": {Path: "sh", Args: []string{"-c", "echo oops >&2; exit 3"}},
+			"loud": {Path: "sh", Args: []string{"-c", "yes | head -c 100000"}},
+			"hang": {Path: "sh", Args: []string{"-c", "sleep 10"}},
+			"env":  {},
+		}
+	}
+	a, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func handle(t *testing.T, a *Agent, req mpcserver.Request) (Report, mpcserver.Response) {
+	t.Helper()
+	resp, err := a.Handle(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := json.Unmarshal(resp.Data, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r, resp
+}
+
+func TestHandleRunsCommand(t *testing.T) {
+	a := newTestAgent(t, Options{})
+	for _, req := range []mpcserver.Request{
+		{Prompt: "echo hello world"},
+		{Parameters: map[string]any{paramCommand: "echo", paramArgs: []any{"hello", "world"}}},
+		{Parameters: map[string]any{paramCommand: "echo", paramArgs: "hello world"}},
+	} {
+		r, resp := handle(t, a, req)
+		if r.Command != "echo" || !slices.Equal(r.Args, []string{"hello", "world"}) || r.Stdout != "hello world\n" || r.ExitCode != 0 {
+			t.Errorf("%+v: report = %+v", req, r)
+		}
+		if resp.Result != "$ echo hello world\nhello world" {
+			t.Errorf("result = %q", resp.Result)
+		}
+	}
+}
+
+func TestHandleReportsFailures(t *testing.T) {
+	a := newTestAgent(t, Options{})
+	r, resp := handle(t, a, mpcserver.Request{Prompt: "fail"})
+	if r.ExitCode != 3 || r.Stderr != "oops\n" || !strings.Contains(resp.Result, "(exit status 3)") {
+		t.Errorf("report = %+v, result %q", r, resp.Result)
+	}
+}
+
+func TestHandleRejectsArguments(t *testing.T) {
+	a := newTestAgent(t, Options{MaxArgs: 3})
+	for _, prompt := range []string{
+		"",
+		"rm -rf tmp",
+		"echo -e hi",
+		"echo a;b",
+		"echo $(id)",
+		"echo -n=..",
+		"echo a b c d",
+		"env FOO",
+	} {
+		_, err := a.Handle(context.Background(), mpcserver.Request{Prompt: prompt})
+		var e *mpcserver.Error
+		if !errors.As(err, &e) || e.Status != http.StatusBadRequest || e.Code != mpcserver.CodeInvalidRequest {
+			t.Errorf("%q: err = %v, want a 400 invalid_request error", prompt, err)
+		}
+	}
+}
+
+func TestHandleCapsOutput(t *testing.T) {
+	a := newTestAgent(t, Options{MaxOutput: 1000})
+	r, resp := handle(t, a, mpcserver.Request{Prompt: "loud"})
+	if len(r.Stdout) != 1000 || !r.Truncated || !strings.HasSuffix(resp.Result, "(output truncated)") {
+		t.Errorf("kept %d bytes, truncated %v, result ending %q", len(r.Stdout), r.Truncated, resp.Result[len(resp.Result)-20:])
+	}
+}
+
+func TestHandleTimesOut(t *testing.T) {
+	a := newTestAgent(t, Options{Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	r, _ := handle(t, a, mpcserver.Request{Prompt: "hang"})
+	if !r.TimedOut || time.Since(start) > 5*time.Second {
+		t.Errorf("report = %+v after %v, want a timeout", r, time.Since(start))
+	}
+}
+
+func TestHandleCancelled(t *testing.T) {
+	a := newTestAgent(t, Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := a.Handle(ctx, mpcserver.Request{Prompt: "hang"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's error", err)
+	}
+}
+
+func TestHandleHidesEnvironment(t *testing.T) {
+	t.Setenv("SHELL_AGENT_SECRET", "s3cret")
+	a := newTestAgent(t, Options{})
+	r, _ := handle(t, a, mpcserver.Request{Prompt: "env"})
+	if strings.Contains(r.Stdout, "s3cret") || !strings.Contains(r.Stdout, "PATH=") {
+		t.Errorf("command saw environment %q", r.Stdout)
+	}
+}
+
+func TestNewPlugin(t *testing.T) {
+	agent, err := newPlugin(mpcserver.ConfigSection{
+		"timeout":  "2s",
+		"commands": map[string]any{"echo": map[string]any{"arg_pattern": `\w+`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := agent.(*Agent)
+	if a.opts.Timeout != 2*time.Second || len(a.opts.Commands) != 1 || a.opts.MaxOutput != DefaultMaxOutput {
+		t.Errorf("options = %+v", a.opts)
+	}
+	if _, err := newPlugin(mpcserver.ConfigSection{"commands": map[string]any{"echo": map[string]any{"arg_pattern": "("}}}); err == nil {
+		t.Error("bad arg_pattern accepted")
+	}
+	if _, err := newPlugin(mpcserver.ConfigSection{"timeout": "soon"}); err == nil {
+		t.Error("bad timeout accepted")
+	}
+}
@@ -0,0 +1,53 @@
+package shell
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// Config is the agent's configuration section, read from the server's
+// -agents-config file:
+//
+//	agents:
+//	  shellAgent:
+//	    timeout: 5s
+//	    max_output_bytes: 32768
+//	    commands:
+//	      uptime: {}
+//	      tail:
+//	        flags: [-n]
+//	        arg_pattern: '\d+|/var/log/[\w.-]+'
+//
+// The agent is only loaded when the section is present; without commands
+// it allows DefaultCommands.
+type Config struct {
+	Commands map[string]Command `json:"commands"`
+	// Timeout is a duration such as "5s".
+	Timeout        string `json:"timeout"`
+	MaxOutputBytes int    `json:"max_output_bytes"`
+	MaxArgs        int    `json:"max_args"`
+	Dir            string `json:"dir"`
+}
+
+func init() {
+	mpcserver.RegisterPlugin(mpcserver.Plugin{Name: Name, New: newPlugin})
+}
+
+// newPlugin builds the agent from its configuration section.
+func newPlugin(section mpcserver.ConfigSection) (mpcserver.Agent, error) {
+	var cfg Config
+	if err := section.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	opts := Options{Commands: cfg.Commands, MaxOutput: cfg.MaxOutputBytes, MaxArgs: cfg.MaxArgs, Dir: cfg.Dir}
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("shell: timeout: %w", err)
+		}
+		opts.Timeout = d
+	}
+	return New(opts)
+}
@@ -0,0 +1,81 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// waitDelay is how long a killed command's output is waited for, in case
+// a process it started holds its pipes open.
+const waitDelay = time.Second
+
+// run runs cmd with the caller's args, keeping at most MaxOutput bytes of
+// each output stream. Only the failure to start the command, or the
+// cancellation of ctx, is an error.
+func (a *Agent) run(ctx context.Context, name string, cmd Command, args []string) (Report, error) {
+	path := cmd.Path
+	if path == "" {
+		path = name
+	}
+	runCtx, cancel := context.WithTimeout(ctx, a.opts.Timeout)
+	defer cancel()
+	c := exec.CommandContext(runCtx, path, append(append([]string(nil), cmd.Args...), args...)...)
+	c.Dir = a.opts.Dir
+	// Commands see the server's PATH and nothing else of its environment,
+	// which may hold credentials.
+	c.Env = []string{"PATH=" + os.Getenv("PATH"), "LC_ALL=C"}
+	stdout := &capWriter{max: a.opts.MaxOutput}
+	stderr := &capWriter{max: a.opts.MaxOutput}
+	c.Stdout, c.Stderr = stdout, stderr
+	c.WaitDelay = waitDelay
+
+	start := time.Now()
+	err := c.Run()
+	report := Report{
+		Command:    name,
+		Args:       args,
+		Stdout:     string(stdout.buf),
+		Stderr:     string(stderr.buf),
+		Truncated:  stdout.truncated || stderr.truncated,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if report.Args == nil {
+		report.Args = []string{}
+	}
+	if ctx.Err() != nil {
+		return Report{}, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case runCtx.Err() != nil:
+		report.TimedOut, report.ExitCode = true, -1
+	case errors.As(err, &exitErr):
+		report.ExitCode = exitErr.ExitCode()
+	case errors.Is(err, exec.ErrWaitDelay):
+	case err != nil:
+		return Report{}, fmt.Errorf("run %s: %w", name, err)
+	}
+	return report, nil
+}
+
+// capWriter keeps the first max bytes written to it and discards the
+// rest, so that a command is never blocked or failed by a full pipe.
+type capWriter struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (w *capWriter) Write(p []byte) (int, error) {
+	if room := w.max - len(w.buf); room < len(p) {
+		w.buf = append(w.buf, p[:max(room, 0)]...)
+		w.truncated = true
+		return len(p), nil
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
@@ -0,0 +1,143 @@
+package mpcserver
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// Default attachment limits.
+const (
+	DefaultMaxAttachmentSize  = 10 << 20
+	DefaultMaxAttachmentTotal = 25 << 20
+)
+
+// Multipart form field names used by mpcclient.
+const (
+	formFieldRequest    = "request"
+	formFieldAttachment = "attachment"
+)
+
+// Attachment is a file uploaded alongside a prompt.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Size        int64
+	Data        []byte
+}
+
+// AttachmentLimits bounds the attachments a server accepts. Zero fields
+// take the documented defaults.
+type AttachmentLimits struct {
+	// MaxSize is the largest single attachment in bytes. It defaults to
+	// DefaultMaxAttachmentSize.
+	MaxSize int64
+	// MaxTotal is the largest combined size of a request's attachments. It
+	// defaults to DefaultMaxAttachmentTotal.
+	MaxTotal int64
+	// AllowedTypes lists the accepted media types. A trailing "/*" matches
+	// every subtype, as in "image/*". Empty accepts every type.
+	AllowedTypes []string
+}
+
+// WithAttachmentLimits sets the size and type limits on attachments.
+func WithAttachmentLimits(l AttachmentLimits) Option {
+	if l.MaxSize <= 0 {
+		l.MaxSize = DefaultMaxAttachmentSize
+	}
+	if l.MaxTotal <= 0 {
+		l.MaxTotal = DefaultMaxAttachmentTotal
+	}
+	return func(s *Server) {
+		s.attachments = l
+	}
+}
+
+func (l AttachmentLimits) allows(contentType string) bool {
+	if len(l.AllowedTypes) == 0 {
+		return true
+	}
+	for _, t := range l.AllowedTypes {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(contentType, prefix+"/") {
+				return true
+			}
+		} else if contentType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeMultipart reads an agent call sent as multipart form data: the
+// JSON request in the "request" field and any number of "attachment"
+// files.
+func (s *Server) decodeMultipart(w http.ResponseWriter, r *http.Request) (Request, *Error) {
+	var req Request
+	lim := s.attachments
+	r.Body = http.MaxBytesReader(w, r.Body, lim.MaxTotal+s.limits.MaxBodySize)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return req, Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid multipart body: %v", err)
+	}
+
+	var seenRequest bool
+	var total int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return req, bodyError(err, "invalid multipart body")
+		}
+		switch part.FormName() {
+		case formFieldRequest:
+			dec := json.NewDecoder(io.LimitReader(part, s.limits.MaxBodySize))
+			if err := dec.Decode(&req); err != nil {
+				return req, bodyError(err, "invalid JSON request part")
+			}
+			seenRequest = true
+		case formFieldAttachment:
+			a, apiErr := readAttachment(part, lim)
+			if apiErr != nil {
+				return req, apiErr
+			}
+			if total += a.Size; total > lim.MaxTotal {
+				return req, Errorf(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "attachments exceed %d bytes in total", lim.MaxTotal)
+			}
+			req.Attachments = append(req.Attachments, a)
+		}
+		part.Close()
+	}
+	if !seenRequest {
+		return req, Errorf(http.StatusBadRequest, CodeInvalidRequest, "multipart body has no %q field", formFieldRequest)
+	}
+	return req, nil
+}
+
+func readAttachment(part *multipart.Part, lim AttachmentLimits) (Attachment, *Error) {
+	name := part.FileName()
+	if name == "" {
+		return Attachment{}, Errorf(http.StatusBadRequest, CodeInvalidRequest, "attachment has no file name")
+	}
+	data, err := io.ReadAll(io.LimitReader(part, lim.MaxSize+1))
+	if err != nil {
+		return Attachment{}, bodyError(err, "read attachment "+name)
+	}
+	if int64(len(data)) > lim.MaxSize {
+		return Attachment{}, Errorf(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "attachment %s exceeds %d bytes", name, lim.MaxSize)
+	}
+
+	ct, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if ct == "" || ct == "application/octet-stream" {
+		ct, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !lim.allows(ct) {
+		return Attachment{}, Errorf(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "attachment %s has unsupported type %s", name, ct)
+	}
+	return Attachment{Name: name, ContentType: ct, Size: int64(len(data)), Data: data}, nil
+}
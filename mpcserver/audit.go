@@ -0,0 +1,371 @@
+package mpcserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord is the audit trail entry of one agent invocation, whatever
+// its transport and outcome. Prompts are recorded only as a hash.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	// Key is the name of the API key the call was made with, if the
+	// server requires one.
+	Key   string `json:"key,omitempty"`
+	Agent string `json:"agent"`
+	// Tenant is the ID of the tenant the agent belongs to, if any.
+	Tenant string `json:"tenant,omitempty"`
+	// Operation is "invoke" for agent calls and "embed" for embeddings.
+	Operation string `json:"operation"`
+	// PromptSHA256 is the hex SHA-256 of the prompt, or of the embedding
+	// inputs separated by NUL bytes.
+	PromptSHA256 string  `json:"prompt_sha256"`
+	Status       int     `json:"status"`
+	Code         string  `json:"code,omitempty"`
+	LatencyMS    float64 `json:"latency_ms"`
+	// Usage is the token usage the agent reported, if any.
+	Usage *Usage `json:"usage,omitempty"`
+	// Metadata is the metadata the call was labeled with, for attributing
+	// usage to users and teams.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// AuditSink receives audit records. WriteAudit is called once the
+// invocation has finished and must be safe for concurrent use. Sinks that
+// implement io.Closer are closed by Shutdown.
+type AuditSink interface {
+	WriteAudit(rec AuditRecord) error
+}
+
+// WithAuditLog records every agent invocation to sinks, such as an
+// AuditFile or an AuditWebhook. Sink failures are logged, never returned
+// to callers.
+func WithAuditLog(sinks ...AuditSink) Option {
+	return func(s *Server) {
+		s.audit = append(s.audit, sinks...)
+	}
+}
+
+// auditCall records the outcome of an invocation to the server's sinks.
+func (s *Server) auditCall(ctx context.Context, start time.Time, op, agent, requestID, prompt string, usage *Usage, apiErr *Error) {
+	sinks := s.audit
+	if s.parent != nil {
+		sinks = append(slices.Clone(sinks), s.parent.audit...)
+	}
+	if len(sinks) == 0 {
+		return
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	rec := AuditRecord{
+		Time:         start.UTC(),
+		RequestID:    requestID,
+		Agent:        agent,
+		Tenant:       s.tenantID,
+		Operation:    op,
+		PromptSHA256: hex.EncodeToString(sum[:]),
+		Status:       http.StatusOK,
+		LatencyMS:    float64(time.Since(start).Microseconds()) / 1000,
+		Usage:        usage,
+		Metadata:     metadataFrom(ctx),
+	}
+	if st := apiKeyFrom(ctx); st != nil {
+		rec.Key = st.Name
+	}
+	if apiErr != nil {
+		rec.Status, rec.Code, rec.Usage = apiErr.Status, apiErr.Code, nil
+	}
+	for _, sink := range sinks {
+		if err := sink.WriteAudit(rec); err != nil && s.logger != nil {
+			s.logger.Error("audit", "request_id", requestID, "agent", agent, "error", err)
+		}
+	}
+}
+
+// closeAudit closes the sinks that need it.
+func (s *Server) closeAudit() error {
+	var errs []error
+	for _, sink := range s.audit {
+		if c, ok := sink.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Default audit file rotation.
+const (
+	DefaultAuditMaxSize    = 100 << 20
+	DefaultAuditMaxBackups = 5
+)
+
+// AuditRotation sets when an AuditFile rotates. Zero fields take the
+// documented defaults.
+type AuditRotation struct {
+	// MaxSize is the size in bytes past which the file is rotated;
+	// DefaultAuditMaxSize when zero.
+	MaxSize int64
+	// MaxBackups is how many rotated files are kept, as path.1 (the most
+	// recent) to path.N; DefaultAuditMaxBackups when zero.
+	MaxBackups int
+}
+
+// AuditFile is an AuditSink appending records to a file as JSON lines,
+// rotating it by size.
+type AuditFile struct {
+	path string
+	rot  AuditRotation
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenAuditFile opens the audit file at path for appending, creating it
+// if needed.
+func OpenAuditFile(path string, rot AuditRotation) (*AuditFile, error) {
+	if rot.MaxSize <= 0 {
+		rot.MaxSize = DefaultAuditMaxSize
+	}
+	if rot.MaxBackups <= 0 {
+		rot.MaxBackups = DefaultAuditMaxBackups
+	}
+	a := &AuditFile{path: path, rot: rot}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditFile) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("mpcserver: audit file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("mpcserver: audit file: %w", err)
+	}
+	a.f, a.size = f, fi.Size()
+	return nil
+}
+
+// WriteAudit appends rec, rotating the file first if rec would take it
+// past its maximum size.
+func (a *AuditFile) WriteAudit(rec AuditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return fmt.Errorf("mpcserver: audit file: %w", os.ErrClosed)
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.rot.MaxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("mpcserver: audit file: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts the backups up by one, dropping the oldest, moves the
+// file to path.1 and starts a new one.
+func (a *AuditFile) rotate() error {
+	if err := a.f.Close(); err != nil {
+		return fmt.Errorf("mpcserver: audit file: %w", err)
+	}
+	a.f = nil
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", a.path, i) }
+	_ = os.Remove(backup(a.rot.MaxBackups))
+	for i := a.rot.MaxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(backup(i), backup(i+1))
+	}
+	if err := os.Rename(a.path, backup(1)); err != nil {
+		return fmt.Errorf("mpcserver: rotate audit file: %w", err)
+	}
+	return a.open()
+}
+
+// Close closes the file.
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// Audit webhook defaults.
+const (
+	DefaultAuditBatchSize     = 100
+	DefaultAuditFlushInterval = 5 * time.Second
+)
+
+// AuditWebhookOptions configure an AuditWebhook. Zero fields take the
+// documented defaults.
+type AuditWebhookOptions struct {
+	// Client sends the batches; http.DefaultClient when nil.
+	Client *http.Client
+	// Header is added to every request, to authenticate with the
+	// receiving end.
+	Header http.Header
+	// BatchSize is the most records sent in one request;
+	// DefaultAuditBatchSize when zero. Up to ten batches are buffered,
+	// and records arriving while the buffer is full are dropped.
+	BatchSize int
+	// FlushInterval bounds how long a record waits for its batch to fill;
+	// DefaultAuditFlushInterval when zero.
+	FlushInterval time.Duration
+	// OnError is called with every failed delivery, if set. Failed
+	// batches are not retried.
+	OnError func(error)
+}
+
+// AuditWebhook is an AuditSink posting records in batches, as a JSON
+// array, to a URL. Delivery happens in the background, so that a slow
+// receiver never delays agent calls.
+type AuditWebhook struct {
+	url  string
+	opts AuditWebhookOptions
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan AuditRecord
+	done   chan struct{}
+}
+
+// errAuditQueueFull reports a record dropped by an AuditWebhook.
+var errAuditQueueFull = errors.New("mpcserver: audit webhook queue full; record dropped")
+
+// NewAuditWebhook starts shipping audit records to url. Close flushes
+// and stops it.
+func NewAuditWebhook(url string, opts AuditWebhookOptions) *AuditWebhook {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultAuditBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultAuditFlushInterval
+	}
+	w := &AuditWebhook{url: url, opts: opts, queue: make(chan AuditRecord, 10*opts.BatchSize), done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+// WriteAudit queues rec for delivery.
+func (w *AuditWebhook) WriteAudit(rec AuditRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("mpcserver: audit webhook closed")
+	}
+	select {
+	case w.queue <- rec:
+		return nil
+	default:
+		return errAuditQueueFull
+	}
+}
+
+// Close delivers the records still queued and stops the webhook.
+func (w *AuditWebhook) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return nil
+}
+
+func (w *AuditWebhook) run() {
+	defer close(w.done)
+	tick := time.NewTicker(w.opts.FlushInterval)
+	defer tick.Stop()
+	var batch []AuditRecord
+	flush := func() {
+		if len(batch) > 0 {
+			w.send(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case rec, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if batch = append(batch, rec); len(batch) >= w.opts.BatchSize {
+				flush()
+			}
+		case <-tick.C:
+			flush()
+		}
+	}
+}
+
+func (w *AuditWebhook) send(batch []AuditRecord) {
+	err := func() error {
+		body, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range w.opts.Header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		res, err := w.opts.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(io.Discard, res.Body)
+		if res.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", res.Status)
+		}
+		return nil
+	}()
+	if err != nil && w.opts.OnError != nil {
+		w.opts.OnError(fmt.Errorf("mpcserver: audit webhook: %d records lost: %w", len(batch), err))
+	}
+}
+
+// embedPrompt is what the audit trail hashes for embedding inputs.
+func embedPrompt(inputs []string) string {
+	return strings.Join(inputs, "\x00")
+}
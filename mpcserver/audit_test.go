@@ -0,0 +1,182 @@
+package mpcserver_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// memoryAuditSink keeps the records it receives.
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	records []mpcserver.AuditRecord
+}
+
+func (m *memoryAuditSink) WriteAudit(rec mpcserver.AuditRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+	return nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuditLogRecordsInvocations(t *testing.T) {
+	sink := &memoryAuditSink{}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := mpcserver.OpenAuditFile(path, mpcserver.AuditRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := mpcserver.New(mpcserver.WithAuditLog(sink, file), mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	s.Register("echo", echoAgent{})
+	s.Register("embedder", lengthEmbedder{})
+	s.Register("failing", mpcserver.AgentFunc(func(context.Context, mpcserver.Request) (mpcserver.Response, error) {
+		return mpcserver.Response{}, errors.New("model unavailable")
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := newKeyClient(t, ts.URL, mpcclient.WithAPIKey("s3cret"))
+	ctx := context.Background()
+
+	if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	c.CallAgent(ctx, "failing", "hi")
+	if _, err := c.Embed(ctx, "embedder", []string{"a", "bc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.records) != 3 {
+		t.Fatalf("got %d records, want 3: %+v", len(sink.records), sink.records)
+	}
+	ok, failed, embed := sink.records[0], sink.records[1], sink.records[2]
+	if ok.Key != "ci" || ok.Agent != "echo" || ok.Operation != "invoke" || ok.Status != http.StatusOK ||
+		ok.PromptSHA256 != sha256Hex("hi") || ok.Usage == nil || ok.Usage.TotalTokens != 3 || ok.RequestID == "" || ok.Time.IsZero() {
+		t.Errorf("successful call recorded as %+v", ok)
+	}
+	if failed.Agent != "failing" || failed.Status != http.StatusInternalServerError || failed.Code != "agent_error" || failed.Usage != nil {
+		t.Errorf("failed call recorded as %+v", failed)
+	}
+	if embed.Operation != "embed" || embed.Status != http.StatusOK || embed.PromptSHA256 != sha256Hex("a\x00bc") {
+		t.Errorf("embeddings recorded as %+v", embed)
+	}
+
+	lines := readAuditFile(t, path)
+	if len(lines) != 3 || lines[0] != sink.records[0].RequestID {
+		t.Errorf("audit file holds %v", lines)
+	}
+	if err := file.WriteAudit(ok); err == nil {
+		t.Error("audit file still open after Shutdown")
+	}
+}
+
+// readAuditFile returns the request IDs recorded in the file at path.
+func readAuditFile(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec mpcserver.AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		ids = append(ids, rec.RequestID)
+	}
+	return ids
+}
+
+func TestAuditFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := mpcserver.OpenAuditFile(path, mpcserver.AuditRotation{MaxSize: 400, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for i := range 20 {
+		rec := mpcserver.AuditRecord{Time: time.Now(), RequestID: string(rune('a' + i)), Agent: "echo", Status: http.StatusOK}
+		if err := file.WriteAudit(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > 400 {
+			t.Errorf("%s is %d bytes, over the limit", p, fi.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more backups kept than asked for: %v", err)
+	}
+	if got := readAuditFile(t, path); got[len(got)-1] != "t" {
+		t.Errorf("current file ends with %v, want the latest record", got)
+	}
+}
+
+func TestAuditWebhookBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]mpcserver.AuditRecord
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hook" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var batch []mpcserver.AuditRecord
+		json.NewDecoder(r.Body).Decode(&batch)
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	var errs []error
+	w := mpcserver.NewAuditWebhook(hook.URL, mpcserver.AuditWebhookOptions{
+		Header:    http.Header{"Authorization": {"Bearer hook"}},
+		BatchSize: 2,
+		OnError:   func(err error) { errs = append(errs, err) },
+	})
+	for _, id := range []string{"a", "b", "c"} {
+		if err := w.WriteAudit(mpcserver.AuditRecord{RequestID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 || batches[1][0].RequestID != "c" {
+		t.Errorf("webhook received %+v, want batches of 2 and 1", batches)
+	}
+	if err := w.WriteAudit(mpcserver.AuditRecord{}); err == nil {
+		t.Error("WriteAudit after Close = nil")
+	}
+}
@@ -0,0 +1,287 @@
+package mpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// APIKeyHeader is the header clients send their API key in. A bearer
+// token in the Authorization header is accepted too.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a credential clients call agents with, and the limits that
+// apply to it.
+type APIKey struct {
+	// Key is the secret itself.
+	Key string `json:"key,omitempty"`
+	// Name identifies the key in logs and under /admin/keys. It defaults
+	// to "key-" and the first hex digits of the key's SHA-256.
+	Name string `json:"name"`
+	// Agents restricts the key to the named agents; empty allows every
+	// agent.
+	Agents []string `json:"agents,omitempty"`
+	// RateLimit caps the key's agent calls per second, with bursts of up
+	// to Burst calls, at least 1. Zero leaves it unlimited.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+	// DailyTokens caps the tokens the key's calls may use per UTC day, as
+	// agents report them in Response.Usage. Zero leaves it unlimited.
+	DailyTokens int `json:"daily_tokens,omitempty"`
+}
+
+// WithAPIKeys requires clients to authenticate with one of keys, sent in
+// the APIKeyHeader header or as a bearer token. Health checks and metrics
+// stay open. It panics on a key with an empty Key or a name already in
+// use, as keys are meant to be validated when loaded.
+func WithAPIKeys(keys ...APIKey) Option {
+	return func(s *Server) {
+		kr := s.enableKeys()
+		for _, k := range keys {
+			if err := kr.add(k); err != nil {
+				panic("mpcserver: WithAPIKeys: " + err.Message)
+			}
+		}
+	}
+}
+
+// WithAdminKey serves /admin/keys to clients authenticating with key,
+// for listing, creating and revoking API keys at run time, and requires
+// API keys as WithAPIKeys does. Keys created there last until the server
+// exits.
+func WithAdminKey(key string) Option {
+	return func(s *Server) {
+		kr := s.enableKeys()
+		kr.admin = sha256.Sum256([]byte(key))
+		kr.hasAdmin = key != ""
+	}
+}
+
+func (s *Server) enableKeys() *keyring {
+	if s.keys == nil {
+		s.keys = &keyring{keys: make(map[[32]byte]*keyState), byName: make(map[string]*keyState), now: time.Now}
+	}
+	return s.keys
+}
+
+// keyring holds the API keys of a server, by the SHA-256 of the key so
+// that lookups do not compare secrets.
+type keyring struct {
+	mu       sync.Mutex
+	keys     map[[32]byte]*keyState
+	byName   map[string]*keyState
+	admin    [32]byte
+	hasAdmin bool
+	now      func() time.Time
+}
+
+// keyState is a key with its rate limiter and the tokens used on day.
+type keyState struct {
+	APIKey
+	hash    [32]byte
+	limiter *rate.Limiter
+	day     string
+	used    int
+}
+
+// add stores k, naming it if needed.
+func (kr *keyring) add(k APIKey) *Error {
+	if k.Key == "" {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "API key %q has no key", k.Name)
+	}
+	if k.RateLimit < 0 || k.Burst < 0 || k.DailyTokens < 0 {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "API key %q has negative limits", k.Name)
+	}
+	h := sha256.Sum256([]byte(k.Key))
+	if k.Name == "" {
+		k.Name = "key-" + hex.EncodeToString(h[:4])
+	}
+	st := &keyState{APIKey: k, hash: h}
+	if k.RateLimit > 0 {
+		st.limiter = rate.NewLimiter(rate.Limit(k.RateLimit), max(k.Burst, 1))
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if _, ok := kr.byName[k.Name]; ok {
+		return Errorf(http.StatusConflict, CodeKeyExists, "API key %q already exists", k.Name)
+	}
+	if _, ok := kr.keys[h]; ok {
+		return Errorf(http.StatusConflict, CodeKeyExists, "API key %q duplicates another key", k.Name)
+	}
+	kr.keys[h] = st
+	kr.byName[k.Name] = st
+	return nil
+}
+
+// remove revokes the key named name.
+func (kr *keyring) remove(name string) bool {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	st, ok := kr.byName[name]
+	if ok {
+		delete(kr.byName, name)
+		delete(kr.keys, st.hash)
+	}
+	return ok
+}
+
+// named returns the key called name, or nil.
+func (kr *keyring) named(name string) *keyState {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.byName[name]
+}
+
+func (kr *keyring) lookup(key string) *keyState {
+	return kr.lookupHash(sha256.Sum256([]byte(key)))
+}
+
+func (kr *keyring) lookupHash(h [32]byte) *keyState {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.keys[h]
+}
+
+func (kr *keyring) isAdmin(key string) bool {
+	h := sha256.Sum256([]byte(key))
+	return kr.hasAdmin && subtle.ConstantTimeCompare(h[:], kr.admin[:]) == 1
+}
+
+// credential returns the API key r carries, if any.
+func credential(r *http.Request) string {
+	if k := r.Header.Get(APIKeyHeader); k != "" {
+		return k
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+type apiKeyKey struct{}
+
+func withAPIKey(ctx context.Context, st *keyState) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, st)
+}
+
+func apiKeyFrom(ctx context.Context) *keyState {
+	st, _ := ctx.Value(apiKeyKey{}).(*keyState)
+	return st
+}
+
+// authenticate resolves key to the state carried in ctx by the transports.
+func (kr *keyring) authenticate(key string) (*keyState, *Error) {
+	if key == "" {
+		return nil, Errorf(http.StatusUnauthorized, CodeUnauthorized, "API key required")
+	}
+	st := kr.lookup(key)
+	if st == nil {
+		return nil, Errorf(http.StatusUnauthorized, CodeUnauthorized, "invalid API key")
+	}
+	return st, nil
+}
+
+// requireAPIKey rejects requests without a valid API key, apart from
+// health checks, metrics, the OpenAPI document and the admin API, which
+// checks the admin key itself.
+func (s *Server) requireAPIKey(next http.Handler) http.Handler {
+	if s.keys == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch p := r.URL.Path; {
+		case p == "/health", p == "/healthz", p == "/readyz", p == "/metrics", p == OpenAPIPath, strings.HasPrefix(p, "/admin/"), strings.HasPrefix(p, TenantPathPrefix):
+			next.ServeHTTP(w, r)
+			return
+		}
+		st, apiErr := s.keys.authenticate(credential(r))
+		if apiErr != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, apiErr)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withAPIKey(r.Context(), st)))
+	})
+}
+
+// checkScope checks that the API key in ctx is still valid and may call
+// agent.
+func (kr *keyring) checkScope(ctx context.Context, agent string) *Error {
+	if kr == nil {
+		return nil
+	}
+	st := apiKeyFrom(ctx)
+	if st == nil {
+		return Errorf(http.StatusUnauthorized, CodeUnauthorized, "API key required")
+	}
+	// Connections outlive keys revoked through /admin/keys.
+	if kr.lookupHash(st.hash) != st {
+		return Errorf(http.StatusUnauthorized, CodeUnauthorized, "API key %q has been revoked", st.Name)
+	}
+	if len(st.Agents) > 0 && !slices.Contains(st.Agents, agent) {
+		return Errorf(http.StatusForbidden, CodeForbidden, "API key %q may not call agent %q", st.Name, agent)
+	}
+	return nil
+}
+
+// admit checks that the API key in ctx may call agent now: that the agent
+// is in its scope, its daily token quota is not spent and its rate limit
+// allows another call.
+func (kr *keyring) admit(ctx context.Context, agent string) *Error {
+	if kr == nil {
+		return nil
+	}
+	if apiErr := kr.checkScope(ctx, agent); apiErr != nil {
+		return apiErr
+	}
+	st := apiKeyFrom(ctx)
+	now := kr.now().UTC()
+	kr.mu.Lock()
+	used := st.usedOn(now)
+	kr.mu.Unlock()
+	if st.DailyTokens > 0 && used >= st.DailyTokens {
+		e := Errorf(http.StatusTooManyRequests, CodeQuotaExceeded, "API key %q has used its %d tokens for today", st.Name, st.DailyTokens)
+		e.RetryAfter = now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+		return e
+	}
+	if st.limiter != nil {
+		r := st.limiter.ReserveN(now, 1)
+		if d := r.DelayFrom(now); d > 0 {
+			r.CancelAt(now)
+			e := Errorf(http.StatusTooManyRequests, CodeRateLimited, "API key %q is over its limit of %g calls per second", st.Name, st.RateLimit)
+			e.RetryAfter = d
+			return e
+		}
+	}
+	return nil
+}
+
+// charge counts the tokens of a call made with the API key in ctx.
+func (kr *keyring) charge(ctx context.Context, usage *Usage) {
+	st := apiKeyFrom(ctx)
+	if kr == nil || st == nil || usage == nil {
+		return
+	}
+	now := kr.now().UTC()
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	st.used = st.usedOn(now) + usage.TotalTokens
+}
+
+// usedOn returns the tokens used on now's day, starting a new day when
+// needed. The keyring's lock must be held.
+func (st *keyState) usedOn(now time.Time) int {
+	if day := now.Format(time.DateOnly); st.day != day {
+		st.day, st.used = day, 0
+	}
+	return st.used
+}
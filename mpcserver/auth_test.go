@@ -0,0 +1,248 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func newKeyClient(t *testing.T, url string, opts ...mpcclient.Option) *mpcclient.Client {
+	t.Helper()
+	c, err := mpcclient.NewClient(url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func wantAPIError(t *testing.T, err error, status int, code string) *mpcclient.APIError {
+	t.Helper()
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != status || apiErr.Code != code {
+		t.Fatalf("err = %v, want %d %s", err, status, code)
+	}
+	return apiErr
+}
+
+func TestAPIKeyRequired(t *testing.T) {
+	_, anon := newTestServer(t, nil, mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	ctx := context.Background()
+
+	_, err := newKeyClient(t, anon.BaseURL()).CallAgent(ctx, "echo", "hi")
+	wantAPIError(t, err, http.StatusUnauthorized, "unauthorized")
+	_, err = newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("wrong")).CallAgent(ctx, "echo", "hi")
+	if !errors.Is(err, mpcclient.ErrUnauthorized) {
+		t.Errorf("wrong key: err = %v", err)
+	}
+	for name, opt := range map[string]mpcclient.Option{
+		"header": mpcclient.WithAPIKey("s3cret"),
+		"bearer": mpcclient.WithBearerToken("s3cret"),
+	} {
+		if _, err := newKeyClient(t, anon.BaseURL(), opt).CallAgent(ctx, "echo", "hi"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	res, err := http.Get(anon.BaseURL() + "/agents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("GET /agents without a key = %d, WWW-Authenticate %q", res.StatusCode, res.Header.Get("WWW-Authenticate"))
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		res, err := http.Get(anon.BaseURL() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("GET %s without a key = %d", path, res.StatusCode)
+		}
+	}
+}
+
+func TestAPIKeyScope(t *testing.T) {
+	_, anon := newTestServer(t, map[string]mpcserver.Agent{"other": echoAgent{}}, mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret", Agents: []string{"echo"}}))
+	c := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("s3cret"))
+	ctx := context.Background()
+
+	if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.CallAgent(ctx, "other", "hi")
+	wantAPIError(t, err, http.StatusForbidden, "forbidden")
+	_, err = c.SubmitJob(ctx, "other", mpcclient.AgentRequest{Prompt: "hi"})
+	wantAPIError(t, err, http.StatusForbidden, "forbidden")
+
+	ws := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("s3cret"), mpcclient.WithWebSocketTransport(mpcclient.WebSocketConfig{}))
+	if _, err := ws.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Errorf("websocket call in scope: %v", err)
+	}
+	_, err = ws.CallAgent(ctx, "other", "hi")
+	wantAPIError(t, err, http.StatusForbidden, "forbidden")
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	_, anon := newTestServer(t, nil, mpcserver.WithAPIKeys(
+		mpcserver.APIKey{Name: "slow", Key: "slow", RateLimit: 0.5},
+		mpcserver.APIKey{Name: "fast", Key: "fast"},
+	))
+	slow := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("slow"))
+	ctx := context.Background()
+
+	if _, err := slow.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := slow.CallAgent(ctx, "echo", "hi")
+	apiErr := wantAPIError(t, err, http.StatusTooManyRequests, "rate_limited")
+	if apiErr.RetryAfter != 2*time.Second {
+		t.Errorf("RetryAfter = %v, want 2s", apiErr.RetryAfter)
+	}
+	if _, err := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("fast")).CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Errorf("other key limited too: %v", err)
+	}
+}
+
+func TestAPIKeyDailyTokens(t *testing.T) {
+	// echoAgent reports 3 tokens a call.
+	_, anon := newTestServer(t, nil, mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret", DailyTokens: 5}))
+	c := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("s3cret"))
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := c.CallAgent(ctx, "echo", "hi")
+	if !errors.Is(err, mpcclient.ErrQuotaExceeded) {
+		t.Fatalf("call over the quota: err = %v", err)
+	}
+	apiErr := wantAPIError(t, err, http.StatusTooManyRequests, "quota_exceeded")
+	if apiErr.RetryAfter <= 0 || apiErr.RetryAfter > 24*time.Hour {
+		t.Errorf("RetryAfter = %v, want the time to midnight UTC", apiErr.RetryAfter)
+	}
+}
+
+func TestAdminKeys(t *testing.T) {
+	_, anon := newTestServer(t, nil, mpcserver.WithAdminKey("root"), mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	admin := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, anon.BaseURL()+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer root")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+	ctx := context.Background()
+
+	req, _ := http.NewRequest(http.MethodGet, anon.BaseURL()+"/admin/keys", nil)
+	req.Header.Set(mpcserver.APIKeyHeader, "s3cret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /admin/keys with an API key = %d, want 401", res.StatusCode)
+	}
+
+	res = admin(http.MethodPost, "/admin/keys", `{"name":"dev","agents":["echo"],"daily_tokens":100}`)
+	var created mpcserver.APIKey
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil || res.StatusCode != http.StatusCreated || created.Key == "" {
+		t.Fatalf("create key = %d %+v, %v", res.StatusCode, created, err)
+	}
+	if res := admin(http.MethodPost, "/admin/keys", `{"name":"dev"}`); res.StatusCode != http.StatusConflict {
+		t.Errorf("create duplicate key = %d, want 409", res.StatusCode)
+	}
+	dev := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey(created.Key))
+	if _, err := dev.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatalf("call with created key: %v", err)
+	}
+
+	res = admin(http.MethodGet, "/admin/keys", "")
+	var list struct {
+		Keys []struct {
+			mpcserver.APIKey
+			TokensUsedToday int `json:"tokens_used_today"`
+		} `json:"keys"`
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil || list.Count != 2 {
+		t.Fatalf("list keys = %+v, %v", list, err)
+	}
+	if k := list.Keys[1]; k.Name != "dev" || k.Key != "" || k.TokensUsedToday != 3 || k.DailyTokens != 100 {
+		t.Errorf("listed key = %+v, want dev without its secret and with 3 tokens used", k)
+	}
+
+	if res := admin(http.MethodDelete, "/admin/keys/dev", ""); res.StatusCode != http.StatusNoContent {
+		t.Errorf("revoke key = %d", res.StatusCode)
+	}
+	_, err = dev.CallAgent(ctx, "echo", "hi")
+	wantAPIError(t, err, http.StatusUnauthorized, "unauthorized")
+	if res := admin(http.MethodDelete, "/admin/keys/dev", ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("revoke unknown key = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestAPIKeyRevokedOnOpenWebSocket(t *testing.T) {
+	_, anon := newTestServer(t, nil, mpcserver.WithAdminKey("root"), mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	ws := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("s3cret"), mpcclient.WithWebSocketTransport(mpcclient.WebSocketConfig{}))
+	ctx := context.Background()
+	if _, err := ws.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, anon.BaseURL()+"/admin/keys/ci", nil)
+	req.Header.Set(mpcserver.APIKeyHeader, "root")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	_, err = ws.CallAgent(ctx, "echo", "hi")
+	wantAPIError(t, err, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestAPIKeyOverGRPC(t *testing.T) {
+	s := mpcserver.New(mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	s.Register("echo", echoAgent{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeGRPC(l)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	ctx := context.Background()
+
+	_, err = newKeyClient(t, "http://unused", mpcclient.WithGRPCTransport(cc)).CallAgent(ctx, "echo", "hi")
+	if !errors.Is(err, mpcclient.ErrUnauthorized) {
+		t.Errorf("gRPC call without a key: err = %v", err)
+	}
+	c := newKeyClient(t, "http://unused", mpcclient.WithGRPCTransport(cc), mpcclient.WithAPIKey("s3cret"))
+	if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+		t.Errorf("gRPC call with a key: %v", err)
+	}
+}
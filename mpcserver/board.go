@@ -0,0 +1,346 @@
+package mpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Default board limits.
+const (
+	DefaultBoardTTL          = time.Hour
+	DefaultMaxBoardValueSize = 64 << 10
+	DefaultMaxBoardEntries   = 256
+	DefaultMaxBoards         = 1000
+)
+
+// BoardLimits bounds the shared context boards. Zero fields take the
+// documented defaults.
+type BoardLimits struct {
+	// MaxValueSize is the largest value a board holds, in bytes of JSON;
+	// DefaultMaxBoardValueSize when zero.
+	MaxValueSize int
+	// MaxEntries is how many keys one board holds; DefaultMaxBoardEntries
+	// when zero.
+	MaxEntries int
+	// MaxBoards is how many boards the server holds at once;
+	// DefaultMaxBoards when zero.
+	MaxBoards int
+	// TTL is how long a board is kept after it was last written;
+	// DefaultBoardTTL when zero.
+	TTL time.Duration
+}
+
+func (l BoardLimits) withDefaults() BoardLimits {
+	if l.MaxValueSize <= 0 {
+		l.MaxValueSize = DefaultMaxBoardValueSize
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultMaxBoardEntries
+	}
+	if l.MaxBoards <= 0 {
+		l.MaxBoards = DefaultMaxBoards
+	}
+	if l.TTL <= 0 {
+		l.TTL = DefaultBoardTTL
+	}
+	return l
+}
+
+// WithBoardLimits sets the limits of the shared context boards.
+func WithBoardLimits(l BoardLimits) Option {
+	return func(s *Server) {
+		s.boards.limits = l.withDefaults()
+	}
+}
+
+// boardName matches valid session IDs and keys.
+var boardName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// BoardEntry is a value on a board.
+type BoardEntry struct {
+	Key string `json:"key"`
+	// Value is the JSON value written under Key.
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// boardContents is what GET /context/{session} returns.
+type boardContents struct {
+	Session string       `json:"session"`
+	Entries []BoardEntry `json:"entries"`
+	// ExpiresAt is when the board is dropped unless written again; it is
+	// zero for an empty board.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// boards holds the server's shared context boards, by the API key they
+// belong to and their session ID.
+type boards struct {
+	limits BoardLimits
+
+	mu sync.Mutex
+	m  map[boardKey]*board
+}
+
+// boardKey scopes a session ID to the API key it is used with, so that
+// callers cannot read each other's boards.
+type boardKey struct {
+	caller, session string
+}
+
+type board struct {
+	entries map[string]BoardEntry
+	expires time.Time
+}
+
+// lookup returns the board under k, or nil if it has none or has expired.
+// b.mu must be held.
+func (b *boards) lookup(k boardKey, now time.Time) *board {
+	bd, ok := b.m[k]
+	if !ok {
+		return nil
+	}
+	if !now.Before(bd.expires) {
+		delete(b.m, k)
+		return nil
+	}
+	return bd
+}
+
+func (b *boards) get(k boardKey, key string) (BoardEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bd := b.lookup(k, time.Now())
+	if bd == nil {
+		return BoardEntry{}, false
+	}
+	e, ok := bd.entries[key]
+	return e, ok
+}
+
+func (b *boards) list(k boardKey) ([]BoardEntry, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bd := b.lookup(k, time.Now())
+	if bd == nil {
+		return []BoardEntry{}, time.Time{}
+	}
+	entries := make([]BoardEntry, 0, len(bd.entries))
+	for _, key := range slices.Sorted(maps.Keys(bd.entries)) {
+		entries = append(entries, bd.entries[key])
+	}
+	return entries, bd.expires
+}
+
+// put writes value under key, extending the board's life by its TTL.
+func (b *boards) put(k boardKey, key string, value json.RawMessage) (BoardEntry, *Error) {
+	if !boardName.MatchString(key) {
+		return BoardEntry{}, Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid board key %q: use up to 128 letters, digits, ., :, - and _", key)
+	}
+	if len(value) > b.limits.MaxValueSize {
+		return BoardEntry{}, Errorf(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "board value of %d bytes exceeds the limit of %d", len(value), b.limits.MaxValueSize)
+	}
+	if !json.Valid(value) {
+		return BoardEntry{}, Errorf(http.StatusBadRequest, CodeInvalidRequest, "board value is not valid JSON")
+	}
+	var buf bytes.Buffer
+	json.Compact(&buf, value)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	bd := b.lookup(k, now)
+	if bd == nil {
+		for bk := range b.m {
+			b.lookup(bk, now)
+		}
+		if len(b.m) >= b.limits.MaxBoards {
+			return BoardEntry{}, Errorf(http.StatusConflict, CodeBoardFull, "the server holds %d boards, its limit", b.limits.MaxBoards)
+		}
+		bd = &board{entries: make(map[string]BoardEntry)}
+		if b.m == nil {
+			b.m = make(map[boardKey]*board)
+		}
+		b.m[k] = bd
+	}
+	if _, ok := bd.entries[key]; !ok && len(bd.entries) >= b.limits.MaxEntries {
+		return BoardEntry{}, Errorf(http.StatusConflict, CodeBoardFull, "board %q holds %d keys, its limit", k.session, b.limits.MaxEntries)
+	}
+	e := BoardEntry{Key: key, Value: buf.Bytes(), UpdatedAt: now.UTC()}
+	bd.entries[key] = e
+	bd.expires = now.Add(b.limits.TTL)
+	return e, nil
+}
+
+func (b *boards) delete(k boardKey, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bd := b.lookup(k, time.Now()); bd != nil {
+		delete(bd.entries, key)
+	}
+}
+
+func (b *boards) clear(k boardKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.m, k)
+}
+
+// Board is the shared context board of a session: keyed JSON values that
+// the agents called with the session's ID in Request.Board, and the client
+// through /context/{session}, read and write to hand each other
+// intermediate results. A board belongs to the API key it is used with,
+// and is dropped when it has not been written for the server's board TTL.
+type Board struct {
+	boards *boards
+	key    boardKey
+}
+
+type boardCtxKey struct{}
+
+// BoardFrom returns the board named by Request.Board of the call ctx
+// belongs to, if it names one.
+func BoardFrom(ctx context.Context) (*Board, bool) {
+	b, ok := ctx.Value(boardCtxKey{}).(*Board)
+	return b, ok
+}
+
+// withBoard returns ctx carrying the board req names, if any.
+func (s *Server) withBoard(ctx context.Context, req Request) context.Context {
+	if req.Board == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, boardCtxKey{}, &Board{boards: &s.boards, key: s.boardKey(ctx, req.Board)})
+}
+
+func (s *Server) boardKey(ctx context.Context, session string) boardKey {
+	k := boardKey{session: session}
+	if st := apiKeyFrom(ctx); st != nil {
+		k.caller = st.Name
+	}
+	return k
+}
+
+// Session returns the session ID of the board.
+func (b *Board) Session() string {
+	return b.key.session
+}
+
+// Get returns the value under key.
+func (b *Board) Get(key string) (json.RawMessage, bool) {
+	e, ok := b.boards.get(b.key, key)
+	return e.Value, ok
+}
+
+// Set writes the JSON encoding of value under key. Values over the
+// server's limits are refused with an *Error the agent may return as it
+// is.
+func (b *Board) Set(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if _, apiErr := b.boards.put(b.key, key, raw); apiErr != nil {
+		return apiErr
+	}
+	return nil
+}
+
+// Delete removes the value under key, if any.
+func (b *Board) Delete(key string) {
+	b.boards.delete(b.key, key)
+}
+
+// Entries returns the values on the board, sorted by key.
+func (b *Board) Entries() []BoardEntry {
+	entries, _ := b.boards.list(b.key)
+	return entries
+}
+
+// boardSession returns the session ID of a /context request, or writes
+// an error if it is invalid.
+func boardSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	session := r.PathValue("session")
+	if !boardName.MatchString(session) {
+		writeError(w, Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid board session %q: use up to 128 letters, digits, ., :, - and _", session))
+		return "", false
+	}
+	return session, true
+}
+
+func (s *Server) handleGetBoard(w http.ResponseWriter, r *http.Request) {
+	session, ok := boardSession(w, r)
+	if !ok {
+		return
+	}
+	entries, expires := s.boards.list(s.boardKey(r.Context(), session))
+	writeJSON(w, http.StatusOK, boardContents{Session: session, Entries: entries, ExpiresAt: expires})
+}
+
+func (s *Server) handleClearBoard(w http.ResponseWriter, r *http.Request) {
+	session, ok := boardSession(w, r)
+	if !ok {
+		return
+	}
+	s.boards.clear(s.boardKey(r.Context(), session))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetBoardValue(w http.ResponseWriter, r *http.Request) {
+	session, ok := boardSession(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	e, ok := s.boards.get(s.boardKey(r.Context(), session), key)
+	if !ok {
+		writeError(w, Errorf(http.StatusNotFound, CodeBoardKeyNotFound, "board %q has no key %q", session, key))
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// handlePutBoardValue writes the JSON body of the request under the key.
+func (s *Server) handlePutBoardValue(w http.ResponseWriter, r *http.Request) {
+	session, ok := boardSession(w, r)
+	if !ok {
+		return
+	}
+	limit := s.boards.limits.MaxValueSize
+	body, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if err != nil {
+		writeError(w, Errorf(http.StatusBadRequest, CodeInvalidRequest, "read board value: %v", err))
+		return
+	}
+	e, apiErr := s.boards.put(s.boardKey(r.Context(), session), r.PathValue("key"), body)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func (s *Server) handleDeleteBoardValue(w http.ResponseWriter, r *http.Request) {
+	session, ok := boardSession(w, r)
+	if !ok {
+		return
+	}
+	s.boards.delete(s.boardKey(r.Context(), session), r.PathValue("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkBoard rejects a Request.Board that is not a valid session ID.
+func checkBoard(session string) *Error {
+	if session != "" && !boardName.MatchString(session) {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid board session %q: use up to 128 letters, digits, ., :, - and _", session)
+	}
+	return nil
+}
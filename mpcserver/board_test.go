@@ -0,0 +1,158 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// boardCollector writes its prompt to the board as "metrics"; boardReporter
+// reports what the board holds under "metrics" and the seeded "vm".
+var (
+	boardCollector = mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		b, ok := mpcserver.BoardFrom(ctx)
+		if !ok {
+			return mpcserver.Response{}, errors.New("no board")
+		}
+		if err := b.Set("metrics", map[string]string{"cpu": req.Prompt}); err != nil {
+			return mpcserver.Response{}, err
+		}
+		return mpcserver.Response{Result: "collected"}, nil
+	})
+	boardReporter = mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		b, ok := mpcserver.BoardFrom(ctx)
+		if !ok {
+			return mpcserver.Response{Result: "no board"}, nil
+		}
+		metrics, ok := b.Get("metrics")
+		if !ok {
+			metrics = json.RawMessage("none")
+		}
+		vm, ok := b.Get("vm")
+		if !ok {
+			vm = json.RawMessage("none")
+		}
+		return mpcserver.Response{Result: fmt.Sprintf("%s on %s, %d entries", metrics, vm, len(b.Entries()))}, nil
+	})
+)
+
+func TestBoardChain(t *testing.T) {
+	s := mpcserver.New(
+		mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ana", Key: "ana-key"}, mpcserver.APIKey{Name: "ben", Key: "ben-key"}),
+		mpcserver.WithBoardLimits(mpcserver.BoardLimits{MaxValueSize: 64, MaxEntries: 3}),
+	)
+	s.Register("collect", boardCollector)
+	s.Register("report", boardReporter)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+	ana, _ := mpcclient.NewClient(ts.URL, mpcclient.WithAPIKey("ana-key"))
+	ben, _ := mpcclient.NewClient(ts.URL, mpcclient.WithAPIKey("ben-key"))
+
+	session := mpcclient.NewBoardSession()
+	if err := ana.SeedBoard(ctx, session, map[string]any{"vm": "webserver01"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ana.CallAgent(ctx, "collect", "42%", mpcclient.WithBoard(session)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ana.CallAgent(ctx, "report", "summarize", mpcclient.WithBoard(session))
+	if err != nil || resp.Result != `{"cpu":"42%"} on "webserver01", 2 entries` {
+		t.Errorf("report = %+v, %v", resp, err)
+	}
+	if resp, _ := ana.CallAgent(ctx, "report", "summarize"); resp.Result != "no board" {
+		t.Errorf("call without a board: %q", resp.Result)
+	}
+
+	board, err := ana.Board(ctx, session)
+	if err != nil || len(board.Entries) != 2 || board.Entries[0].Key != "metrics" || board.ExpiresAt.Before(time.Now()) {
+		t.Errorf("board = %+v, %v", board, err)
+	}
+	var metrics map[string]string
+	if err := ana.BoardValue(ctx, session, "metrics", &metrics); err != nil || metrics["cpu"] != "42%" {
+		t.Errorf("metrics = %v, %v", metrics, err)
+	}
+
+	// Boards belong to the key they are used with.
+	if board, err := ben.Board(ctx, session); err != nil || len(board.Entries) != 0 {
+		t.Errorf("other key's view = %+v, %v", board, err)
+	}
+	if resp, _ := ben.CallAgent(ctx, "report", "summarize", mpcclient.WithBoard(session)); resp.Result != "none on none, 0 entries" {
+		t.Errorf("other key's agent saw %q", resp.Result)
+	}
+	var v string
+	if err := ben.BoardValue(ctx, session, "vm", &v); !errors.Is(err, mpcclient.ErrBoardKeyNotFound) {
+		t.Errorf("other key's value: err = %v", err)
+	}
+
+	// Limits.
+	if _, err := ana.SetBoardValue(ctx, session, "log", strings.Repeat("x", 100)); !errors.Is(err, mpcclient.ErrRequestTooLarge) {
+		t.Errorf("oversized value: err = %v", err)
+	}
+	if _, err := ana.SetBoardValue(ctx, session, "third", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ana.SetBoardValue(ctx, session, "fourth", 4); !errors.Is(err, mpcclient.ErrBoardFull) {
+		t.Errorf("over the entry limit: err = %v", err)
+	}
+	// Replacing a value is not a new entry.
+	if _, err := ana.SetBoardValue(ctx, session, "third", "three"); err != nil {
+		t.Errorf("replacing a value: %v", err)
+	}
+	if _, err := ana.SetBoardValue(ctx, "bad/session", "k", 1); !errors.Is(err, mpcclient.ErrInvalidRequest) {
+		t.Errorf("invalid session: err = %v", err)
+	}
+	if _, err := ana.CallAgent(ctx, "report", "x", mpcclient.WithBoard("no spaces")); !errors.Is(err, mpcclient.ErrInvalidRequest) {
+		t.Errorf("call with an invalid board: err = %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/context/"+session+"/raw", strings.NewReader("not json"))
+	req.Header.Set(mpcserver.APIKeyHeader, "ana-key")
+	if res, err := http.DefaultClient.Do(req); err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Errorf("non-JSON value: %v, %v", res, err)
+	}
+
+	if err := ana.DeleteBoardValue(ctx, session, "third"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ana.BoardValue(ctx, session, "third", &v); !errors.Is(err, mpcclient.ErrBoardKeyNotFound) {
+		t.Errorf("deleted value: err = %v", err)
+	}
+	if err := ana.ClearBoard(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	if board, _ := ana.Board(ctx, session); len(board.Entries) != 0 || !board.ExpiresAt.IsZero() {
+		t.Errorf("cleared board = %+v", board)
+	}
+}
+
+func TestBoardExpires(t *testing.T) {
+	s := mpcserver.New(mpcserver.WithBoardLimits(mpcserver.BoardLimits{TTL: 20 * time.Millisecond, MaxBoards: 1}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	c, _ := mpcclient.NewClient(ts.URL)
+	ctx := context.Background()
+
+	if _, err := c.SetBoardValue(ctx, "one", "k", json.RawMessage(`{"a": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetBoardValue(ctx, "two", "k", 1); !errors.Is(err, mpcclient.ErrBoardFull) {
+		t.Errorf("over the board limit: err = %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if board, err := c.Board(ctx, "one"); err != nil || len(board.Entries) != 0 {
+		t.Errorf("expired board = %+v, %v", board, err)
+	}
+	// The expired board no longer counts against the limit.
+	if e, err := c.SetBoardValue(ctx, "two", "k", 1); err != nil || string(e.Value) != "1" {
+		t.Errorf("board after expiry = %+v, %v", e, err)
+	}
+}
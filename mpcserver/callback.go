@@ -0,0 +1,168 @@
+package mpcserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Job callback headers. A client submitting a job may name a URL in
+// CallbackURLHeader; once the job finishes, the server POSTs the job, as
+// GET /jobs/{id} would return it, to that URL. The callback carries the time
+// of sending, in Unix seconds, in CallbackTimestampHeader, and in
+// CallbackSignatureHeader "sha256=" followed by the hex HMAC-SHA256, keyed
+// with the callback secret, of the timestamp, a ".", and the body.
+const (
+	CallbackURLHeader       = "Callback-URL"
+	CallbackTimestampHeader = "Callback-Timestamp"
+	CallbackSignatureHeader = "Callback-Signature"
+)
+
+// Default callback delivery settings.
+const (
+	DefaultCallbackAttempts = 5
+	DefaultCallbackBackoff  = time.Second
+	DefaultCallbackTimeout  = 10 * time.Second
+)
+
+// maxCallbackURLLen bounds the length of a callback URL.
+const maxCallbackURLLen = 2048
+
+// JobCallbacks configures the delivery of job callbacks. Zero fields take
+// the documented defaults.
+type JobCallbacks struct {
+	// Secret keys the signatures of callbacks. It is required.
+	Secret []byte
+	// MaxAttempts is the number of times a callback is sent before it is
+	// given up. It defaults to DefaultCallbackAttempts.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubling after each
+	// further failure. It defaults to DefaultCallbackBackoff.
+	Backoff time.Duration
+	// Timeout bounds each attempt. It defaults to DefaultCallbackTimeout.
+	Timeout time.Duration
+	// Client sends the callbacks. It defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// WithJobCallbacks lets clients submitting jobs register a callback URL.
+// Without it, jobs submitted with one are refused. A callback is retried
+// while it fails with a network error or a 408, 429 or 5xx status; one
+// still being retried when the server shuts down is given up.
+func WithJobCallbacks(cb JobCallbacks) Option {
+	if cb.MaxAttempts <= 0 {
+		cb.MaxAttempts = DefaultCallbackAttempts
+	}
+	if cb.Backoff <= 0 {
+		cb.Backoff = DefaultCallbackBackoff
+	}
+	if cb.Timeout <= 0 {
+		cb.Timeout = DefaultCallbackTimeout
+	}
+	if cb.Client == nil {
+		cb.Client = http.DefaultClient
+	}
+	return func(s *Server) {
+		if len(cb.Secret) > 0 {
+			s.jobs.callbacks = &cb
+		}
+	}
+}
+
+// signCallback returns the CallbackSignatureHeader value of body sent at
+// timestamp.
+func signCallback(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// callbackURL returns the callback URL a job submission names, if any.
+func (jr *jobRunner) callbackURL(r *http.Request) (string, *Error) {
+	raw := r.Header.Get(CallbackURLHeader)
+	if raw == "" {
+		return "", nil
+	}
+	if jr.callbacks == nil {
+		return "", Errorf(http.StatusBadRequest, CodeInvalidRequest, "job callbacks are not enabled on this server")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || len(raw) > maxCallbackURLLen || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid %s %q: want an absolute http or https URL", CallbackURLHeader, raw)
+	}
+	return u.String(), nil
+}
+
+// deliverCallback POSTs the finished job to its callback URL, retrying
+// failed attempts with backoff until they run out or Shutdown.
+func (s *Server) deliverCallback(job Job) {
+	cb := s.jobs.callbacks
+	body, err := json.Marshal(job)
+	if err != nil {
+		s.logCallbackError(job, 0, err)
+		return
+	}
+	backoff := cb.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.sendCallback(job.CallbackURL, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == cb.MaxAttempts {
+			s.logCallbackError(job, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.jobs.ctx.Done():
+			s.logCallbackError(job, attempt, err)
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// sendCallback makes one attempt at a callback, reporting whether a failed
+// attempt is worth retrying.
+func (s *Server) sendCallback(target string, body []byte) (retry bool, err error) {
+	cb := s.jobs.callbacks
+	// Attempts are not cut short by Shutdown, which only stops retries, so
+	// that jobs it cancels still report their failure.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(s.jobs.ctx), cb.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mpcserver/"+s.version)
+	req.Header.Set(CallbackTimestampHeader, ts)
+	req.Header.Set(CallbackSignatureHeader, signCallback(cb.Secret, ts, body))
+	res, err := cb.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry = res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, fmt.Errorf("callback answered %s", res.Status)
+}
+
+func (s *Server) logCallbackError(job Job, attempts int, err error) {
+	if s.logger != nil {
+		s.logger.Error("deliver job callback", "job", job.ID, "agent", job.Agent, "attempts", attempts, "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+var callbackSecret = []byte("s3cret")
+
+// callbackReceiver serves callbacks with mpcclient.CallbackHandler, failing
+// the first failures of them with a 503, and sends the jobs it accepts.
+func callbackReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan *mpcclient.Job, *atomic.Int32) {
+	t.Helper()
+	jobs := make(chan *mpcclient.Job, 10)
+	var attempts atomic.Int32
+	h := mpcclient.CallbackHandler(callbackSecret, func(_ context.Context, job *mpcclient.Job) error {
+		jobs <- job
+		return nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, jobs, &attempts
+}
+
+func receive(t *testing.T, jobs <-chan *mpcclient.Job) *mpcclient.Job {
+	t.Helper()
+	select {
+	case job := <-jobs:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback delivered")
+		return nil
+	}
+}
+
+func TestJobCallback(t *testing.T) {
+	receiver, jobs, attempts := callbackReceiver(t, 2)
+	_, c, release := newJobTestServer(t, mpcserver.WithJobCallbacks(mpcserver.JobCallbacks{Secret: callbackSecret, Backoff: 10 * time.Millisecond}))
+	ctx := context.Background()
+
+	job, err := c.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "logs"}, mpcclient.WithCallback(receiver.URL+"/done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.CallbackURL != receiver.URL+"/done" {
+		t.Errorf("callback URL = %q", job.CallbackURL)
+	}
+	close(release)
+	done := receive(t, jobs)
+	if done.ID != job.ID || done.Status != mpcclient.JobSucceeded || done.Response == nil || done.Response.Result != "report: logs" {
+		t.Errorf("callback job = %+v", done)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("delivered in %d attempts, want 3", n)
+	}
+
+	// Failed jobs are reported too.
+	if _, err := c.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "bad"}, mpcclient.WithCallback(receiver.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if failed := receive(t, jobs); failed.Status != mpcclient.JobFailed || failed.Err() == nil {
+		t.Errorf("callback job = %+v", failed)
+	}
+}
+
+func TestJobCallbackGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+	_, c, _ := newJobTestServer(t, mpcserver.WithJobCallbacks(mpcserver.JobCallbacks{Secret: callbackSecret, Backoff: time.Millisecond}))
+
+	job, err := c.SubmitJob(context.Background(), "echo", mpcclient.AgentRequest{Prompt: "hi"}, mpcclient.WithCallback(receiver.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WaitJob(context.Background(), job.ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("a 400 was retried: %d attempts", n)
+	}
+}
+
+func TestJobCallbackRefused(t *testing.T) {
+	ctx := context.Background()
+	_, plain, _ := newJobTestServer(t)
+	if _, err := plain.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "hi"}, mpcclient.WithCallback("https://example.com/hook")); !errors.Is(err, mpcclient.ErrInvalidRequest) {
+		t.Errorf("callback without callbacks enabled: err = %v", err)
+	}
+
+	_, c, _ := newJobTestServer(t, mpcserver.WithJobCallbacks(mpcserver.JobCallbacks{Secret: callbackSecret}))
+	for _, u := range []string{"/relative", "ftp://example.com/hook", "https://user:pw@example.com/hook"} {
+		if _, err := c.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "hi"}, mpcclient.WithCallback(u)); !errors.Is(err, mpcclient.ErrInvalidRequest) {
+			t.Errorf("callback %q: err = %v", u, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// cancelAgent runs until its call is cancelled, saying so on started when
+// the call arrives and sending the context's error on cancelled.
+type cancelAgent struct {
+	started   chan struct{}
+	cancelled chan error
+}
+
+func (a cancelAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	a.started <- struct{}{}
+	<-ctx.Done()
+	a.cancelled <- ctx.Err()
+	return mpcserver.Response{}, fmt.Errorf("backend call: %w", ctx.Err())
+}
+
+// chanAuditSink sends the records it receives on a channel.
+type chanAuditSink chan mpcserver.AuditRecord
+
+func (c chanAuditSink) WriteAudit(rec mpcserver.AuditRecord) error {
+	c <- rec
+	return nil
+}
+
+func TestCancellationReachesAgent(t *testing.T) {
+	agent := cancelAgent{started: make(chan struct{}, 1), cancelled: make(chan error, 1)}
+	records := make(chanAuditSink, 1)
+	s := mpcserver.New(mpcserver.WithAuditLog(records))
+	s.Register("slow", agent)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeGRPC(l)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	// callWith returns a call through a client made with opts, cancelled
+	// once the agent has started.
+	callWith := func(opts ...mpcclient.Option) func(t *testing.T) {
+		return func(t *testing.T) {
+			c, err := mpcclient.NewClient(ts.URL, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-agent.started
+				cancel()
+			}()
+			if _, err := c.CallAgent(ctx, "slow", "hi"); !errors.Is(err, context.Canceled) {
+				t.Errorf("err = %v, want context canceled", err)
+			}
+		}
+	}
+	for name, call := range map[string]func(t *testing.T){
+		"http": callWith(),
+		"grpc": callWith(mpcclient.WithGRPCTransport(cc)),
+		"disconnect": func(t *testing.T) {
+			conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := `{"prompt":"hi"}`
+			fmt.Fprintf(conn, "POST /agent/slow HTTP/1.1\r\nHost: mpc\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+			<-agent.started
+			conn.Close()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			call(t)
+			select {
+			case err := <-agent.cancelled:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("agent's context ended with %v, want context canceled", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("agent's context was not cancelled")
+			}
+			select {
+			case rec := <-records:
+				if rec.Status != mpcserver.StatusClientClosedRequest || rec.Code != mpcserver.CodeCanceled {
+					t.Errorf("recorded %d %s, want %d %s", rec.Status, rec.Code, mpcserver.StatusClientClosedRequest, mpcserver.CodeCanceled)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("call was not recorded")
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package mpcserver
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressionMinSize is the smallest response body, in bytes, sent
+// compressed unless WithCompressionMinSize says otherwise.
+const DefaultCompressionMinSize = 1024
+
+// WithCompressionMinSize sets the smallest response body, in bytes, that
+// is compressed for clients accepting zstd or gzip, preferring zstd. Event
+// streams are compressed from their first event, whatever their size. Zero
+// or less turns response compression off. Request bodies sent with a
+// Content-Encoding of zstd or gzip are decoded either way, counting their
+// decoded size against the server's limits.
+func WithCompressionMinSize(n int) Option {
+	return func(s *Server) {
+		s.compressMinSize = n
+	}
+}
+
+// Content codings the server decodes and compresses with.
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// maxZstdWindow bounds the memory a zstd request body can make the
+// server allocate to decode it.
+const maxZstdWindow = 8 << 20
+
+// compress decodes compressed request bodies and compresses the responses
+// of clients that accept it.
+func (s *Server) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enc := r.Header.Get("Content-Encoding"); enc != "" && r.Body != nil && r.Body != http.NoBody {
+			body, err := decodeBody(strings.ToLower(strings.TrimSpace(enc)), r.Body)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			defer body.Close()
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		}
+		enc := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if s.compressMinSize <= 0 || enc == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, encoding: enc, minSize: s.compressMinSize}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// decodeBody returns a reader decoding body of the content coding enc.
+func decodeBody(enc string, body io.ReadCloser) (io.ReadCloser, *Error) {
+	switch enc {
+	case "identity":
+		return body, nil
+	case encodingGzip:
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, Errorf(http.StatusBadRequest, CodeInvalidRequest, "request body is not valid gzip: %v", err)
+		}
+		return readCloser{zr, body}, nil
+	case encodingZstd:
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+		if err != nil {
+			return nil, Errorf(http.StatusBadRequest, CodeInvalidRequest, "request body is not valid zstd: %v", err)
+		}
+		return readCloser{zr.IOReadCloser(), body}, nil
+	default:
+		return nil, Errorf(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"content encoding %q is not supported; send gzip, zstd or an uncompressed body", enc)
+	}
+}
+
+// readCloser reads from a decoder and closes both it and the body it
+// decodes.
+type readCloser struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (r readCloser) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.body.Close())
+}
+
+// acceptedEncoding returns the coding of an Accept-Encoding header to
+// compress responses with, zstd before gzip, or "" for none.
+func acceptedEncoding(header string) string {
+	var gz bool
+	for part := range strings.SplitSeq(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case encodingZstd:
+			return encodingZstd
+		case encodingGzip:
+			gz = true
+		}
+	}
+	if gz {
+		return encodingGzip
+	}
+	return ""
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return w
+	}}
+)
+
+// encoder is a pooled gzip or zstd writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter compresses a response once it has grown to minSize bytes
+// or flushes as an event stream, and otherwise sends it as it is. Until
+// then it holds back the status and body written to it.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	switch {
+	case w.decided, code < http.StatusOK:
+		w.ResponseWriter.WriteHeader(code)
+	case w.status == 0:
+		w.status = code
+		if code == http.StatusNoContent || code == http.StatusNotModified {
+			w.decide(false)
+		}
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.Header().Get("Content-Encoding") != "" {
+			w.decide(false)
+		} else {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) < w.minSize {
+				return len(p), nil
+			}
+			return len(p), w.decide(true)
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide sends the status held back and starts compressing, if compress
+// is set, or sending as it is, then writes the body held back.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress && h.Get("Content-Encoding") == "" {
+		// Sniffing the compressed body would find no type.
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == encodingZstd {
+			w.enc = zstdWriters.Get().(encoder)
+		} else {
+			w.enc = gzipWriters.Get().(encoder)
+		}
+		w.enc.Reset(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// FlushError sends what has been written so far, compressing event
+// streams from their first flush.
+func (w *compressWriter) FlushError() error {
+	if !w.decided {
+		if err := w.decide(strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the response: it sends a body still held back as it is, or
+// finishes the compressed one.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+		return
+	}
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	w.enc.Reset(nil)
+	if w.encoding == encodingZstd {
+		zstdWriters.Put(w.enc)
+	} else {
+		gzipWriters.Put(w.enc)
+	}
+	w.enc = nil
+}
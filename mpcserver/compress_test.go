@@ -0,0 +1,220 @@
+package mpcserver_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// wireRecorder records the encodings and sizes of the requests and
+// responses as they cross the wire, before the client decodes them.
+type wireRecorder struct {
+	mu             sync.Mutex
+	reqEnc, resEnc []string
+	sent           int64
+}
+
+func (w *wireRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(r)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reqEnc = append(w.reqEnc, r.Header.Get("Content-Encoding"))
+	w.sent += r.ContentLength
+	if err == nil {
+		w.resEnc = append(w.resEnc, res.Header.Get("Content-Encoding"))
+	}
+	return res, err
+}
+
+func (w *wireRecorder) last() (req, res string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reqEnc[len(w.reqEnc)-1], w.resEnc[len(w.resEnc)-1]
+}
+
+// logLines returns n lines of a plausible VM log.
+func logLines(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "2026-10-14T08:%02d:%02d INFO vm=webserver01 cpu=%d%% mem=%dMiB disk_io=%dKiB/s\n", i/60%60, i%60, i%97, 2048+i%512, i%4096)
+	}
+	return b.String()
+}
+
+func TestCompression(t *testing.T) {
+	s := mpcserver.New()
+	s.Register("echo", echoAgent{})
+	s.Register("files", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		return mpcserver.Response{Result: fmt.Sprintf("%s: %d bytes", req.Attachments[0].Name, len(req.Attachments[0].Data))}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+	logs := logLines(500)
+
+	for _, enc := range []mpcclient.Encoding{mpcclient.EncodingGzip, mpcclient.EncodingZstd} {
+		t.Run(string(enc), func(t *testing.T) {
+			rec := &wireRecorder{}
+			c := newKeyClient(t, ts.URL, mpcclient.WithHTTPClient(&http.Client{Transport: rec}), mpcclient.WithCompression(enc, 0))
+
+			resp, err := c.CallAgent(ctx, "echo", logs)
+			if err != nil || resp.Result != "echo: "+logs {
+				t.Fatalf("call = %.40q, %v", resp.Result, err)
+			}
+			if req, res := rec.last(); req != string(enc) || res != "zstd" {
+				t.Errorf("large call went as %q and came back as %q", req, res)
+			}
+			if rec.sent >= int64(len(logs))/4 {
+				t.Errorf("sent %d bytes for a %d byte prompt", rec.sent, len(logs))
+			}
+
+			if _, err := c.CallAgent(ctx, "echo", "hi"); err != nil {
+				t.Fatal(err)
+			}
+			if req, res := rec.last(); req != "" || res != "" {
+				t.Errorf("small call went as %q and came back as %q", req, res)
+			}
+
+			var streamed strings.Builder
+			err = c.StreamAgent(ctx, "echo", logs, func(ch mpcclient.Chunk) error {
+				streamed.WriteString(ch.Text)
+				return nil
+			})
+			if err != nil || streamed.String() != "echo: "+logs {
+				t.Fatalf("stream = %.40q, %v", streamed.String(), err)
+			}
+			if req, res := rec.last(); req != string(enc) || res != "zstd" {
+				t.Errorf("stream went as %q and came back as %q", req, res)
+			}
+
+			resp, err = c.Invoke(ctx, "files", mpcclient.AgentRequest{Prompt: "summarize",
+				Attachments: []mpcclient.Attachment{mpcclient.AttachBytes("vm.log", "text/plain", []byte(logs))}})
+			if want := fmt.Sprintf("vm.log: %d bytes", len(logs)); err != nil || resp.Result != want {
+				t.Errorf("upload = %+v, %v, want %q", resp, err, want)
+			}
+			if req, _ := rec.last(); req != string(enc) {
+				t.Errorf("upload went as %q", req)
+			}
+		})
+	}
+
+	// Compressed bodies count against the limits once decoded.
+	rec := &wireRecorder{}
+	c := newKeyClient(t, ts.URL, mpcclient.WithHTTPClient(&http.Client{Transport: rec}), mpcclient.WithCompression(mpcclient.EncodingZstd, 0))
+	_, err := c.Invoke(ctx, "echo", mpcclient.AgentRequest{Prompt: "hi", Parameters: map[string]any{"padding": strings.Repeat("x", 2<<20)}})
+	wantAPIError(t, err, http.StatusRequestEntityTooLarge, mpcserver.CodeRequestTooLarge)
+	if rec.sent > 64<<10 {
+		t.Errorf("sent %d bytes for a body of 2 MiB of padding", rec.sent)
+	}
+
+	if _, err := mpcclient.NewClient(ts.URL, mpcclient.WithCompression("br", 0)); err == nil {
+		t.Error("unsupported compression accepted")
+	}
+}
+
+func TestCompressionHTTP(t *testing.T) {
+	s := mpcserver.New()
+	s.Register("echo", echoAgent{})
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	logs := logLines(200)
+
+	post := func(srv *httptest.Server, body io.Reader, header ...string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/agent/echo", body)
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+	prompt := fmt.Sprintf(`{"prompt":%q}`, logs)
+
+	res := post(ts, strings.NewReader(prompt), "Accept-Encoding", "br, gzip;q=0.8")
+	if res.Header.Get("Content-Encoding") != "gzip" || res.Header.Get("Content-Type") != "application/json" ||
+		!strings.Contains(res.Header.Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("header = %v", res.Header)
+	}
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); !bytes.Contains(b, []byte("webserver01")) {
+		t.Errorf("decoded body = %.80q", b)
+	}
+
+	if res := post(ts, strings.NewReader(prompt), "Accept-Encoding", "gzip;q=0, identity"); res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("refused gzip sent as %q", res.Header.Get("Content-Encoding"))
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	io.WriteString(zw, `{"prompt":"zipped"}`)
+	zw.Close()
+	if res := post(ts, &gz, "Content-Encoding", "gzip"); res.StatusCode != http.StatusOK {
+		t.Errorf("gzip request status = %d", res.StatusCode)
+	}
+	if res := post(ts, strings.NewReader(prompt), "Content-Encoding", "br"); res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("br request status = %d", res.StatusCode)
+	}
+	if res := post(ts, strings.NewReader(prompt), "Content-Encoding", "gzip"); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("corrupt gzip request status = %d", res.StatusCode)
+	}
+
+	off := httptest.NewServer(mpcserver.New(mpcserver.WithCompressionMinSize(0)))
+	t.Cleanup(off.Close)
+	if res := post(off, strings.NewReader(prompt), "Accept-Encoding", "gzip"); res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("compression off, yet sent as %q", res.Header.Get("Content-Encoding"))
+	}
+}
+
+// BenchmarkCompression sends a 64 KiB log to an agent that echoes it,
+// with each request encoding, and reports the bytes sent per call.
+func BenchmarkCompression(b *testing.B) {
+	s := mpcserver.New()
+	s.Register("echo", echoAgent{})
+	ts := httptest.NewServer(s)
+	b.Cleanup(ts.Close)
+	logs := logLines(1000)[:64<<10]
+
+	for _, enc := range []mpcclient.Encoding{"", mpcclient.EncodingGzip, mpcclient.EncodingZstd} {
+		name := string(enc)
+		if name == "" {
+			name = "none"
+		}
+		b.Run(name, func(b *testing.B) {
+			rec := &wireRecorder{}
+			opts := []mpcclient.Option{mpcclient.WithHTTPClient(&http.Client{Transport: rec})}
+			if enc != "" {
+				opts = append(opts, mpcclient.WithCompression(enc, 0))
+			}
+			c, err := mpcclient.NewClient(ts.URL, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			b.SetBytes(int64(len(logs)))
+			for b.Loop() {
+				if _, err := c.CallAgent(context.Background(), "echo", logs); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(rec.sent)/float64(b.N), "sent-B/op")
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Package mpcserver implements the workshop MPC server protocol in Go.
+//
+// Agents implement the Agent interface and are registered by name; the
+// Server routes POST /agent/{name} to them and lists them under /agents:
+//
+//	s := mpcserver.New()
+//	s.Register("echo", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+//		return mpcserver.Response{Result: req.Prompt}, nil
+//	}))
+//	log.Fatal(s.ListenAndServe(":8080"))
+//
+// Agents that implement Describer and declare the types of their
+// parameters, such as TypeDuration or TypeList, receive only requests whose
+// parameters fit; the rest are rejected with an invalid_request error
+// listing each ParamProblem. Request.StringParam, DurationParam and the
+// other accessors read the validated values.
+//
+// Requests are checked before any agent sees them: bodies must be JSON or,
+// with attachments, multipart form data, and stay within the
+// RequestLimits set by WithRequestLimits. Rejections carry codes such as
+// request_too_large, prompt_too_long and unsupported_media_type.
+//
+// An agent's ctx is that of the call: it is cancelled when an HTTP client
+// disconnects or a gRPC client cancels, and when a WebSocket client sends a
+// cancel message, so that the backend requests an agent makes with it stop
+// too. Such calls are recorded with status 499 and code canceled rather
+// than as agent errors, and a repeat waiting on one under the same
+// Idempotency-Key runs the agent itself.
+//
+// Agents that implement ConcurrencyLimiter, or are given a limit with
+// WithConcurrencyLimits, run at most ConcurrencyLimit.MaxConcurrent calls
+// at once. Further calls wait in a bounded queue, and those turned away are
+// answered 429 agent_busy with a Retry-After header. The queue admits calls
+// of PriorityInteractive, the default, ahead of PriorityBatch ones such as
+// jobs, and callers with the fewest calls running first;
+// ConcurrencyLimit.MaxPerKey also caps the calls of any one caller.
+//
+// Request.Generation carries the model, temperature, token limit and stop
+// sequences a caller asks for. The server rejects values out of range, and
+// models or token counts beyond those the agent lists in AgentInfo.Models
+// and AgentInfo.MaxTokens, before the agent is called, so agents may pass
+// them on to their model unchecked.
+//
+// AgentInfo.Version and AgentInfo.Capabilities tell callers which agent
+// they are talking to and what it supports; the server adds its
+// ProtocolVersion and CapabilityStreaming. Request.Requires lets a call
+// demand a minimum version, protocol or capabilities such as
+// CapabilityTools, and the server rejects one they do not hold for with
+// status 412 and CodeIncompatibleAgent before the agent is called.
+//
+// WithResponseFilters runs a ResponseFilter over the responses of each
+// agent before they are returned. ContentFilter, the default one, withholds
+// responses matching blocked patterns or keywords, answering 422
+// content_blocked instead, redacts other patterns and personal data, and
+// truncates overlong results; every rule that matches is counted in
+// mpcserver_filter_hits_total.
+//
+// AddTenant gives a team a server of its own within the server: its agents,
+// API keys and quotas, served under /tenant/{id}/, as in
+// /tenant/{id}/agent/{name}. A tenant's agents answer only the tenant's
+// keys; clients reach them with mpcclient.WithTenant.
+//
+// WithAPIKeys makes every agent call, on every transport, authenticate with
+// an APIKey sent in the X-API-Key header or as a bearer token. Keys may be
+// limited to some agents, to a rate of calls and to a daily number of
+// tokens; calls beyond them fail with forbidden, rate_limited or
+// quota_exceeded errors. WithAdminKey adds /admin/keys for listing,
+// creating and revoking keys while the server runs.
+//
+// WithRequestSigning has the server check an HMAC-SHA256 signature,
+// keyed with a secret shared with its clients, over each request's method,
+// path, body, timestamp and nonce, refusing altered, stale or replayed
+// requests with invalid_signature; mpcclient.WithRequestSigning signs
+// them. It guards deployments without TLS client authentication.
+//
+// WithAuditLog keeps an audit trail of every agent invocation: who made it,
+// to which agent, a hash of the prompt, the outcome, latency and tokens,
+// along with the request's metadata, labels such as the user or team that
+// are also logged with each call.
+// OpenAuditFile writes it as rotated JSON lines, and NewAuditWebhook ships
+// it in batches to an HTTP endpoint.
+//
+// Packages can also provide agents as plugins: RegisterPlugin, called from
+// an init function, adds a constructor that LoadPlugins invokes with the
+// agent's ConfigSection. Agents implementing Starter and Stopper are
+// started by Start and stopped by Shutdown, and a panicking agent fails only
+// its own call. ReloadPlugins, or Reload with a ConfigSource, applies a
+// changed configuration while serving: the new agents are built and
+// validated first, then swapped into the registry at once, and the agents
+// they replace are stopped once their calls in progress are done. With an
+// admin key, POST /admin/reload does the same.
+//
+// Agents implementing Embedder also serve POST /agent/{name}/embed, turning
+// a batch of inputs into embedding vectors, and list the "embeddings"
+// capability.
+//
+// The same agents can be served over gRPC, as defined by the mpcpb package,
+// with ServeGRPC on a second listener or RegisterGRPC on an existing gRPC
+// server.
+//
+// POST /agent/{name}/stream answers as server-sent events: the agent's
+// ReportStatus updates while it works, then its result. While the agent is
+// quiet the stream carries a ": keepalive" comment every
+// DefaultStreamKeepAlive, or as WithStreamKeepAlive sets, so proxies keep
+// the connection open through a slow first answer.
+//
+// Agent calls that outlive an HTTP request can be submitted as jobs with
+// POST /jobs/{name} and followed with GET /jobs/{id}, which long-polls when
+// given ?wait=<duration>. Jobs live in a JobStore, in memory by default,
+// and expire after WithJobTTL once finished. With WithJobCallbacks, a
+// client may name a URL in the Callback-URL header of a submission, which
+// the finished job is POSTed to with an HMAC signature, and retried with
+// backoff while delivery fails. GET /jobs lists the jobs of the caller's
+// API key, the most recent first, and GET /jobs/{id} finds only those.
+//
+// WithSchedules and AddSchedule run agent calls at recurring times, given
+// as cron expressions such as "0 * * * *" or as "@every 10m", each run a
+// job marked with its Schedule. A run due while the previous one is still
+// running is skipped, Jitter spreads the start of runs due together, and a
+// WebhookURL receives each finished run as a job callback. With an admin
+// key, /admin/schedules lists, adds and removes schedules at run time.
+//
+// Listings such as GET /agents and GET /jobs are paged: they return
+// DefaultPageSize items, or as many as ?limit= asks for up to MaxPageSize,
+// and a next_cursor that, passed back as ?cursor=, fetches the page after.
+// Cursors name the last item of a page rather than an offset, so pages
+// neither repeat nor skip items added or removed in between.
+//
+// Agent calls sent with an Idempotency-Key header run once per key: the
+// server remembers successful responses for WithIdempotencyTTL and replays
+// them to retries from the same API key to the same agent, marked with
+// Idempotent-Replayed. Reusing a key for a different request is answered
+// 422 idempotency_key_reused.
+//
+// Agents in a chain share intermediate results on context boards: keyed
+// JSON values under /context/{session}, which GET lists, PUT and DELETE
+// /context/{session}/{key} write and remove. An agent called with
+// Request.Board naming a session reads and writes its board through
+// BoardFrom. Boards belong to the API key they are used with and are
+// bounded in value size, entries and number, and dropped when they have
+// not been written for a TTL, as set with WithBoardLimits.
+//
+// The server keeps jobs, replayable responses and WebSocket sessions in
+// memory unless given a Store with WithStore, which also receives the
+// audit trail. The SQLite store in sqlitestore lets a restarted server
+// answer for the jobs and replay the responses of the last one, and lets
+// WebSocket clients resume their sessions; requests that were running when
+// it stopped are answered with a shutting_down error. cmd/mpcserver
+// selects it with -store sqlite:file.
+//
+// Shutdown drains the server for embedding programs, as cmd/mpcserver does
+// on SIGINT or SIGTERM: new agent calls are refused with a shutting_down
+// error while those in flight get until its context is done to finish, and
+// WebSocket clients are sent a "shutdown" event before their connections
+// close.
+//
+// GET /metrics exposes Prometheus metrics: HTTP request counts and
+// latencies by route, agent call counts, latencies and errors by agent
+// across every transport, and open streaming connections.
+//
+// GET /openapi.json serves an OpenAPI 3 document of the HTTP routes, its
+// schemas derived from the server's own types; it needs no API key. The
+// copy committed as api/openapi.json, regenerated with make openapi, is
+// what the client's wire models are generated from.
+package mpcserver
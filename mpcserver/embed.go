@@ -0,0 +1,137 @@
+package mpcserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// maxEmbedInputs bounds the number of texts one embeddings request may
+// carry. Clients split larger inputs into batches.
+const maxEmbedInputs = 256
+
+// CapabilityEmbeddings is listed among the capabilities of every agent
+// that implements Embedder.
+const CapabilityEmbeddings = "embeddings"
+
+// Embedder is implemented by agents that turn text into embedding vectors,
+// served at POST /agent/{name}/embed. Embed returns one vector per input,
+// in order, all of the same length. Agents that do not implement it answer
+// embeddings requests with CodeEmbeddingsUnsupported.
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+// embedRequest is the JSON body of an embeddings request.
+type embedRequest struct {
+	Inputs []string `json:"inputs"`
+}
+
+// embedResponse is the JSON body of a successful embeddings request.
+type embedResponse struct {
+	Agent           string      `json:"agent"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	Dimensions      int         `json:"dimensions"`
+	RequestID       string      `json:"request_id"`
+	ExecutionTimeMS float64     `json:"execution_time_ms"`
+}
+
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	resp, apiErr := s.embed(w, r, r.PathValue("name"))
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// embed validates an embeddings request and runs it on the named agent.
+func (s *Server) embed(w http.ResponseWriter, r *http.Request, name string) (_ *embedResponse, apiErr *Error) {
+	ctx, requestID := r.Context(), w.Header().Get(requestIDHeader)
+	reg, release, ok := s.registry.acquire(name)
+	defer release()
+	agent := reg.agent
+	label := name
+	if !ok {
+		label = s.metricLabel(unknownAgent)
+	}
+	finish := s.metrics.startCall(label)
+	defer func() { finish(apiErr) }()
+	s.calls.add()
+	defer s.calls.done()
+	var inputs []string
+	defer func(begin time.Time) {
+		s.auditCall(ctx, begin, "embed", name, requestID, embedPrompt(inputs), nil, apiErr)
+	}(time.Now())
+	if !ok {
+		return nil, Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", name)
+	}
+	if apiErr := s.keys.admit(ctx, name); apiErr != nil {
+		return nil, apiErr
+	}
+	embedder, ok := agent.(Embedder)
+	if !ok {
+		return nil, Errorf(http.StatusNotImplemented, CodeEmbeddingsUnsupported, "agent %q does not support embeddings", name)
+	}
+
+	if _, apiErr := checkContentType(r, "application/json"); apiErr != nil {
+		return nil, apiErr
+	}
+	var req embedRequest
+	if apiErr := s.decodeJSON(w, r, &req); apiErr != nil {
+		return nil, apiErr
+	}
+	inputs = req.Inputs
+	switch n := len(req.Inputs); {
+	case n == 0:
+		return nil, Errorf(http.StatusBadRequest, CodeInvalidRequest, "inputs are required")
+	case n > maxEmbedInputs:
+		return nil, Errorf(http.StatusBadRequest, CodeInvalidRequest, "%d inputs exceed the limit of %d per request", n, maxEmbedInputs)
+	}
+
+	leave, apiErr := s.admission.gate(name, agent).acquire(ctx, fairKey(ctx, nil), PriorityInteractive)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	defer leave()
+
+	start := time.Now()
+	vectors, err := s.runEmbed(ctx, embedder, name, requestID, req.Inputs)
+	if err == nil {
+		err = checkEmbeddings(vectors, len(req.Inputs))
+	}
+	if err != nil {
+		apiErr = callError(ctx, err)
+		s.logCall(ctx, name, requestID, start, apiErr)
+		return nil, apiErr
+	}
+	s.logCall(ctx, name, requestID, start, nil)
+	return &embedResponse{
+		Agent:           name,
+		Embeddings:      vectors,
+		Dimensions:      len(vectors[0]),
+		RequestID:       requestID,
+		ExecutionTimeMS: float64(time.Since(start).Microseconds()) / 1000,
+	}, nil
+}
+
+// runEmbed calls e, recovering a panic as handle does for agent calls.
+func (s *Server) runEmbed(ctx context.Context, e Embedder, name, requestID string, inputs []string) (vectors [][]float32, err error) {
+	defer s.recoverAgent(ctx, name, requestID, &err)
+	return e.Embed(ctx, inputs)
+}
+
+// checkEmbeddings reports an agent that returned the wrong number of
+// vectors, or vectors of differing or zero length.
+func checkEmbeddings(vectors [][]float32, inputs int) error {
+	if len(vectors) != inputs {
+		return Errorf(http.StatusInternalServerError, CodeInternal, "agent returned %d embeddings for %d inputs", len(vectors), inputs)
+	}
+	dims := len(vectors[0])
+	for _, v := range vectors {
+		if len(v) != dims || dims == 0 {
+			return Errorf(http.StatusInternalServerError, CodeInternal, "agent returned embeddings of inconsistent dimensions")
+		}
+	}
+	return nil
+}
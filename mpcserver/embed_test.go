@@ -0,0 +1,79 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// lengthEmbedder embeds each input as {len(input), 1}, panicking on
+// "panic" and dropping the vector of "drop".
+type lengthEmbedder struct{ echoAgent }
+
+func (lengthEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	var out [][]float32
+	for _, in := range inputs {
+		switch in {
+		case "panic":
+			panic("model not loaded")
+		case "drop":
+			continue
+		}
+		out = append(out, []float32{float32(len(in)), 1})
+	}
+	return out, nil
+}
+
+func TestServerEmbeddings(t *testing.T) {
+	s, c := newTestServer(t, nil)
+	if err := s.Register("embedder", lengthEmbedder{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	texts := make([]string, 300)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i%7)
+	}
+	res, err := c.EmbedDetailed(ctx, "embedder", texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Dimensions != 2 || len(res.Vectors) != len(texts) || len(res.RequestIDs) != 5 || res.RequestIDs[0] == "" {
+		t.Errorf("result: %d vectors of %d dimensions in %d requests", len(res.Vectors), res.Dimensions, len(res.RequestIDs))
+	}
+	if v := res.Vectors[299]; v[0] != float32(299%7) {
+		t.Errorf("vector 299 = %v", v)
+	}
+
+	info, _ := c.DescribeAgent(ctx, "embedder")
+	if !slices.Contains(info.Capabilities, mpcserver.CapabilityEmbeddings) {
+		t.Errorf("capabilities = %v", info.Capabilities)
+	}
+
+	if _, err := c.Embed(ctx, "echo", []string{"hi"}); !errors.Is(err, mpcclient.ErrEmbeddingsUnsupported) {
+		t.Errorf("non-embedder: err = %v", err)
+	}
+	for _, tt := range []struct {
+		name  string
+		texts []string
+		batch int
+		want  int
+	}{
+		{"too many", texts, 300, http.StatusBadRequest},
+		{"panic", []string{"a", "panic"}, 0, http.StatusInternalServerError},
+		{"short", []string{"a", "drop"}, 0, http.StatusInternalServerError},
+	} {
+		_, err := c.Embed(ctx, "embedder", tt.texts, mpcclient.WithEmbedBatchSize(tt.batch))
+		var apiErr *mpcclient.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.want {
+			t.Errorf("%s: err = %v, want status %d", tt.name, err, tt.want)
+		}
+	}
+}
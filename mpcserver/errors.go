@@ -0,0 +1,137 @@
+package mpcserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes sent in the "code" field of error bodies.
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeAgentNotFound  = "agent_not_found"
+	CodeJobNotFound    = "job_not_found"
+	CodeAgentError     = "agent_error"
+	CodeInternal       = "internal_error"
+	// CodeUnsupportedFormat is sent with status 406 when an agent cannot
+	// produce the requested response format.
+	CodeUnsupportedFormat = "unsupported_format"
+	// CodeUnsupportedModel is sent with status 400 when a request names a
+	// model its agent does not list.
+	CodeUnsupportedModel = "unsupported_model"
+	// CodeIncompatibleAgent is sent with status 412 for a call whose
+	// Requirements its agent or the server does not meet.
+	CodeIncompatibleAgent = "incompatible_agent"
+	// CodeEmbeddingsUnsupported is sent with status 501 when embeddings
+	// are requested from an agent that does not implement Embedder.
+	CodeEmbeddingsUnsupported = "embeddings_unsupported"
+	// CodeRequestTooLarge is sent with status 413 for a body, attachment
+	// or conversation over the server's limits, and CodePromptTooLong for
+	// a prompt over them.
+	CodeRequestTooLarge = "request_too_large"
+	CodePromptTooLong   = "prompt_too_long"
+	// CodeUnsupportedMediaType is sent with status 415 for a body or
+	// attachment of a type the server does not accept.
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	// CodeShuttingDown is sent with status 503 for work offered to a
+	// server that is shutting down; retry it on another server.
+	CodeShuttingDown = "shutting_down"
+	// CodeAgentBusy is sent with status 429 and a Retry-After header for
+	// a call over its agent's ConcurrencyLimit.
+	CodeAgentBusy = "agent_busy"
+	// CodeUnauthorized is sent with status 401 for a missing or invalid
+	// API key, and CodeForbidden with status 403 for a key not allowed to
+	// call the agent.
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	// CodeRateLimited is sent with status 429 and a Retry-After header for
+	// a call over its API key's rate limit, and CodeQuotaExceeded for one
+	// whose key has used its daily tokens.
+	CodeRateLimited   = "rate_limited"
+	CodeQuotaExceeded = "quota_exceeded"
+	// CodeKeyNotFound and CodeKeyExists are sent by /admin/keys for an
+	// unknown key and a name or secret already in use.
+	CodeKeyNotFound = "key_not_found"
+	CodeKeyExists   = "key_exists"
+	// CodeScheduleNotFound and CodeScheduleExists are sent by
+	// /admin/schedules for an unknown schedule and a name already in use.
+	CodeScheduleNotFound = "schedule_not_found"
+	CodeScheduleExists   = "schedule_exists"
+	// CodeIdempotencyKeyReused is sent with status 422 for a call whose
+	// Idempotency-Key was already used for a different request.
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	// CodeCanceled is recorded with StatusClientClosedRequest for a call
+	// whose client cancelled it or went away before it completed.
+	CodeCanceled = "canceled"
+	// CodeInvalidConfig is sent with status 422 by /admin/reload for an
+	// agent configuration that cannot be read or applied.
+	CodeInvalidConfig = "invalid_config"
+	// CodeContentBlocked is sent with status 422 for a call whose response
+	// a ResponseFilter withheld.
+	CodeContentBlocked = "content_blocked"
+	// CodeTenantNotFound is sent with status 404 for a path under
+	// /tenant/ naming no tenant.
+	CodeTenantNotFound = "tenant_not_found"
+	// CodeBoardKeyNotFound is sent with status 404 for a key a shared
+	// context board does not hold, and CodeBoardFull with status 409 for a
+	// write over the board's, or the server's, limits on entries.
+	CodeBoardKeyNotFound = "board_key_not_found"
+	CodeBoardFull        = "board_full"
+	// CodeInvalidSignature is sent with status 401 for a request whose
+	// signature is missing, does not match, is out of tolerance or reuses
+	// a nonce, on a server requiring signed requests.
+	CodeInvalidSignature = "invalid_signature"
+)
+
+// StatusClientClosedRequest is the status, borrowed from nginx, of calls
+// given up by their client. No response reaches such a client; the status
+// shows in logs, metrics and audit records, and over gRPC as Canceled.
+const StatusClientClosedRequest = 499
+
+// Error is an agent or server failure with the HTTP status and code to
+// report it under. Agents return it to signal client errors such as
+// invalid parameters; any other error is reported as a 500.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	// Details is sent verbatim in the "details" field when non-nil.
+	Details any
+	// RetryAfter, when positive, is sent as a Retry-After header, rounded
+	// up to whole seconds.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an *Error with the given status and code and a formatted
+// message.
+func Errorf(status int, code, format string, args ...any) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// errorBody is the JSON shape of every error response.
+type errorBody struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError sends e, carrying the request ID set by withRequestID.
+func writeError(w http.ResponseWriter, e *Error) {
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
+	writeJSON(w, e.Status, errorBody{Error: e.Message, Code: e.Code, Details: e.Details, RequestID: w.Header().Get(requestIDHeader)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
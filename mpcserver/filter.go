@@ -0,0 +1,295 @@
+package mpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// FilterAction is what a content filter did with a response.
+type FilterAction string
+
+// Filter actions.
+const (
+	// FilterBlock withholds the response; the client receives a 422
+	// content_blocked error instead.
+	FilterBlock FilterAction = "block"
+	// FilterRedact replaced the matching text.
+	FilterRedact FilterAction = "redact"
+	// FilterTruncate cut the result short.
+	FilterTruncate FilterAction = "truncate"
+)
+
+// FilterHit is a rule of a filter that matched a response.
+type FilterHit struct {
+	Rule   string
+	Action FilterAction
+}
+
+// ResponseFilter inspects agent responses before the server returns them,
+// over every transport and for jobs. FilterResponse may rewrite resp, as
+// when redacting, and returns the rules that matched; a hit with
+// FilterBlock withholds the response. Each hit is logged and counted in
+// mpcserver_filter_hits_total. It must be safe for concurrent use.
+type ResponseFilter interface {
+	FilterResponse(ctx context.Context, agent string, resp *Response) []FilterHit
+}
+
+// AllAgents is the name a filter is set under, in WithResponseFilters, to
+// apply to agents without one of their own.
+const AllAgents = "*"
+
+// WithResponseFilters sets the response filters of agents by name. The
+// filter under AllAgents applies to agents without one of their own.
+func WithResponseFilters(filters map[string]ResponseFilter) Option {
+	return func(s *Server) {
+		if s.filters == nil {
+			s.filters = make(map[string]ResponseFilter)
+		}
+		maps.Copy(s.filters, filters)
+	}
+}
+
+// filterResponse runs the agent's response filter, if any, on resp,
+// returning the error to send instead if it blocked the response.
+func (s *Server) filterResponse(ctx context.Context, agent string, resp *Response) *Error {
+	f, ok := s.filters[agent]
+	if !ok {
+		f, ok = s.filters[AllAgents]
+	}
+	if !ok || f == nil {
+		return nil
+	}
+	var blocked []string
+	for _, hit := range f.FilterResponse(ctx, agent, resp) {
+		s.metrics.filterHits.WithLabelValues(s.metricLabel(agent), hit.Rule, string(hit.Action)).Inc()
+		if s.logger != nil {
+			s.logger.LogAttrs(ctx, slog.LevelWarn, "response filtered",
+				slog.String("agent", agent), slog.String("rule", hit.Rule), slog.String("action", string(hit.Action)))
+		}
+		if hit.Action == FilterBlock {
+			blocked = append(blocked, hit.Rule)
+		}
+	}
+	if len(blocked) > 0 {
+		return Errorf(http.StatusUnprocessableEntity, CodeContentBlocked, "response withheld by content filter: %s", strings.Join(blocked, ", "))
+	}
+	return nil
+}
+
+// DefaultRedaction replaces the text a ContentFilter redacts unless its
+// configuration sets another.
+const DefaultRedaction = "[redacted]"
+
+// ContentFilterConfig configures a ContentFilter. Its fields decode from
+// a ConfigSection.
+type ContentFilterConfig struct {
+	// Block maps rule names onto regular expressions; a response with a
+	// match for any is withheld.
+	Block map[string]string `json:"block,omitempty"`
+	// Keywords withholds responses containing any of the words, in any
+	// case, under the rule "keyword".
+	Keywords []string `json:"keywords,omitempty"`
+	// Redact maps rule names onto regular expressions whose matches are
+	// replaced with Replacement.
+	Redact map[string]string `json:"redact,omitempty"`
+	// PII redacts email addresses, payment card numbers, IBANs, US social
+	// security numbers and phone numbers, under rules named "pii_" and the
+	// kind.
+	PII bool `json:"pii,omitempty"`
+	// MaxLength truncates results longer than this many characters, under
+	// the rule "max_length"; zero leaves them whole.
+	MaxLength int `json:"max_length,omitempty"`
+	// Replacement is the text redactions leave; DefaultRedaction when
+	// empty.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// ContentFilter is the default ResponseFilter: it blocks responses on
+// patterns and keywords, redacts patterns and personal data, and caps the
+// length of results. It checks the result and the string values of the
+// structured data; only the result is truncated.
+type ContentFilter struct {
+	block, redact []filterRule
+	maxLength     int
+	replacement   string
+}
+
+type filterRule struct {
+	name    string
+	pattern *regexp.Regexp
+	// valid, when set, vets each match, keeping those it rejects.
+	valid func(string) bool
+}
+
+// piiRules are the rules ContentFilterConfig.PII turns on.
+var piiRules = []filterRule{
+	{name: "pii_email", pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+	{name: "pii_card", pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+	{name: "pii_iban", pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`)},
+	{name: "pii_ssn", pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{name: "pii_phone", pattern: regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,4}\d{2,4}\b|\(\d{3}\) ?\d{3}-\d{4}\b`)},
+}
+
+// NewContentFilter builds the ContentFilter cfg describes. Its patterns
+// use the syntax of the regexp package.
+func NewContentFilter(cfg ContentFilterConfig) (*ContentFilter, error) {
+	if cfg.MaxLength < 0 {
+		return nil, fmt.Errorf("mpcserver: content filter: max_length must not be negative")
+	}
+	f := &ContentFilter{maxLength: cfg.MaxLength, replacement: cfg.Replacement}
+	if f.replacement == "" {
+		f.replacement = DefaultRedaction
+	}
+	var err error
+	if f.block, err = compileRules(cfg.Block); err != nil {
+		return nil, err
+	}
+	if len(cfg.Keywords) > 0 {
+		words := make([]string, len(cfg.Keywords))
+		for i, w := range cfg.Keywords {
+			words[i] = regexp.QuoteMeta(w)
+		}
+		f.block = append(f.block, filterRule{name: "keyword", pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)})
+	}
+	if f.redact, err = compileRules(cfg.Redact); err != nil {
+		return nil, err
+	}
+	if cfg.PII {
+		f.redact = append(f.redact, piiRules...)
+	}
+	return f, nil
+}
+
+func compileRules(patterns map[string]string) ([]filterRule, error) {
+	var rules []filterRule
+	for _, name := range slices.Sorted(maps.Keys(patterns)) {
+		re, err := regexp.Compile(patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("mpcserver: content filter rule %q: %w", name, err)
+		}
+		rules = append(rules, filterRule{name: name, pattern: re})
+	}
+	return rules, nil
+}
+
+// FilterResponse implements ResponseFilter. A blocked response is left as
+// it was.
+func (f *ContentFilter) FilterResponse(ctx context.Context, agent string, resp *Response) []FilterHit {
+	var hits []FilterHit
+	texts := append([]string{resp.Result}, dataStrings(resp.Data)...)
+	for _, r := range f.block {
+		if slices.ContainsFunc(texts, r.pattern.MatchString) {
+			hits = append(hits, FilterHit{Rule: r.name, Action: FilterBlock})
+		}
+	}
+	if len(hits) > 0 {
+		return hits
+	}
+
+	redacted := make(map[string]bool)
+	redact := func(s string) string {
+		for _, r := range f.redact {
+			s = r.pattern.ReplaceAllStringFunc(s, func(m string) string {
+				if r.valid != nil && !r.valid(m) {
+					return m
+				}
+				redacted[r.name] = true
+				return f.replacement
+			})
+		}
+		return s
+	}
+	if len(f.redact) > 0 {
+		resp.Result = redact(resp.Result)
+		resp.Data = mapDataStrings(resp.Data, redact)
+		for _, r := range f.redact {
+			if redacted[r.name] {
+				hits = append(hits, FilterHit{Rule: r.name, Action: FilterRedact})
+			}
+		}
+	}
+	if f.maxLength > 0 && utf8.RuneCountInString(resp.Result) > f.maxLength {
+		resp.Result = string([]rune(resp.Result)[:f.maxLength])
+		hits = append(hits, FilterHit{Rule: "max_length", Action: FilterTruncate})
+	}
+	return hits
+}
+
+// dataStrings returns the string values in a response's structured data.
+func dataStrings(data json.RawMessage) []string {
+	var out []string
+	mapDataStrings(data, func(s string) string {
+		out = append(out, s)
+		return s
+	})
+	return out
+}
+
+// mapDataStrings returns data with fn applied to every string value in it.
+// Data that is not JSON is returned as it is.
+func mapDataStrings(data json.RawMessage, fn func(string) string) json.RawMessage {
+	if len(data) == 0 {
+		return data
+	}
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return data
+	}
+	changed := false
+	var walk func(any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			s := fn(v)
+			changed = changed || s != v
+			return s
+		case []any:
+			for i := range v {
+				v[i] = walk(v[i])
+			}
+		case map[string]any:
+			for k := range v {
+				v[k] = walk(v[k])
+			}
+		}
+		return v
+	}
+	v = walk(v)
+	if !changed {
+		return data
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return b
+}
+
+// luhn reports whether the digits of s pass the Luhn check of payment
+// card numbers.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
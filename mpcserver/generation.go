@@ -0,0 +1,67 @@
+package mpcserver
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Generation carries the model and sampling parameters a call asks its
+// agent to generate with. Zero fields leave the choice to the agent; the
+// server checks the others before the agent sees them, so agents may pass
+// them on to their model as they are.
+type Generation struct {
+	// Model names the model to use. Agents listing AgentInfo.Models
+	// accept only those.
+	Model string `json:"model,omitempty"`
+	// Temperature is the sampling temperature, from 0 to MaxTemperature.
+	// It is a pointer so that 0 can be asked for.
+	Temperature *float64 `json:"temperature,omitempty"`
+	// MaxTokens bounds the tokens generated. Agents whose
+	// AgentInfo.MaxTokens is set accept no more than that.
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// Stop lists sequences at which generation stops, at most
+	// MaxStopSequences of them.
+	Stop []string `json:"stop,omitempty"`
+}
+
+// Limits on Request.Generation.
+const (
+	MaxTemperature     = 2.0
+	MaxStopSequences   = 4
+	MaxStopSequenceLen = 64
+)
+
+// checkGeneration rejects generation parameters out of range or not
+// supported by the agent described by info.
+func checkGeneration(info AgentInfo, g *Generation) *Error {
+	if g == nil {
+		return nil
+	}
+	if g.Model != "" && len(info.Models) > 0 && !slices.Contains(info.Models, g.Model) {
+		return Errorf(http.StatusBadRequest, CodeUnsupportedModel, "agent %q cannot use model %q; it supports %s",
+			info.Name, g.Model, strings.Join(info.Models, ", "))
+	}
+	if t := g.Temperature; t != nil && (*t < 0 || *t > MaxTemperature) {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "generation.temperature %g is not between 0 and %g", *t, MaxTemperature)
+	}
+	switch {
+	case g.MaxTokens < 0:
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "generation.max_tokens must not be negative")
+	case info.MaxTokens > 0 && g.MaxTokens > info.MaxTokens:
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "generation.max_tokens %d exceeds agent %q's limit of %d", g.MaxTokens, info.Name, info.MaxTokens)
+	}
+	if len(g.Stop) > MaxStopSequences {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "%d stop sequences exceed the limit of %d", len(g.Stop), MaxStopSequences)
+	}
+	for i, s := range g.Stop {
+		switch {
+		case s == "":
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "generation.stop[%d] must not be empty", i)
+		case utf8.RuneCountInString(s) > MaxStopSequenceLen:
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "generation.stop[%d] is longer than %d characters", i, MaxStopSequenceLen)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// modelAgent lists its models and reports the requests it receives.
+type modelAgent struct {
+	got chan mpcserver.Request
+}
+
+func (a modelAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	a.got <- req
+	return mpcserver.Response{Result: "ok"}, nil
+}
+
+func (modelAgent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{Models: []string{"small", "large"}, MaxTokens: 1000}
+}
+
+func TestGenerationReachesAgent(t *testing.T) {
+	got := make(chan mpcserver.Request, 1)
+	s := mpcserver.New()
+	s.Register("writer", modelAgent{got: got})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, _ := mpcclient.NewClient(ts.URL)
+
+	_, err := c.CallAgent(context.Background(), "writer", "a haiku, please",
+		mpcclient.WithModel("small"), mpcclient.WithTemperature(0), mpcclient.WithMaxTokens(200), mpcclient.WithStopSequences("\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := (<-got).Generation
+	if g == nil || g.Model != "small" || g.Temperature == nil || *g.Temperature != 0 || g.MaxTokens != 200 || !slices.Equal(g.Stop, []string{"\n\n"}) {
+		t.Errorf("generation = %+v", g)
+	}
+
+	if _, err := c.CallAgent(context.Background(), "writer", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if g := (<-got).Generation; g != nil {
+		t.Errorf("generation without options = %+v", g)
+	}
+}
+
+func TestGenerationRejected(t *testing.T) {
+	got := make(chan mpcserver.Request, 1)
+	s := mpcserver.New()
+	s.Register("writer", modelAgent{got: got})
+	s.Register("echo", echoAgent{})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, _ := mpcclient.NewClient(ts.URL, mpcclient.WithRetryPolicy(mpcclient.RetryPolicy{MaxAttempts: 1}))
+
+	for _, tt := range []struct {
+		name  string
+		agent string
+		opts  []mpcclient.CallOption
+		want  string
+		model bool
+	}{
+		{"unlisted model", "writer", []mpcclient.CallOption{mpcclient.WithModel("huge")}, `cannot use model "huge"; it supports small, large`, true},
+		{"hot", "writer", []mpcclient.CallOption{mpcclient.WithTemperature(2.5)}, "temperature 2.5 is not between 0 and 2", false},
+		{"cold", "echo", []mpcclient.CallOption{mpcclient.WithTemperature(-1)}, "temperature -1", false},
+		{"negative tokens", "echo", []mpcclient.CallOption{mpcclient.WithMaxTokens(-5)}, "must not be negative", false},
+		{"over agent limit", "writer", []mpcclient.CallOption{mpcclient.WithMaxTokens(1001)}, "exceeds agent \"writer\"'s limit of 1000", false},
+		{"many stops", "echo", []mpcclient.CallOption{mpcclient.WithStopSequences("a", "b", "c", "d", "e")}, "5 stop sequences exceed the limit of 4", false},
+		{"empty stop", "echo", []mpcclient.CallOption{mpcclient.WithStopSequences("END", "")}, "stop[1] must not be empty", false},
+		{"long stop", "echo", []mpcclient.CallOption{mpcclient.WithStopSequences(strings.Repeat("x", 65))}, "stop[0] is longer than 64", false},
+	} {
+		_, err := c.CallAgent(context.Background(), tt.agent, "hi", tt.opts...)
+		if !errors.Is(err, mpcclient.ErrInvalidRequest) || errors.Is(err, mpcclient.ErrUnsupportedModel) != tt.model || err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+	select {
+	case req := <-got:
+		t.Errorf("agent received %+v", req)
+	default:
+	}
+
+	// Agents listing no models accept any.
+	if _, err := c.CallAgent(context.Background(), "echo", "hi", mpcclient.WithModel("anything"), mpcclient.WithMaxTokens(1<<20)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,332 @@
+package mpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcpb"
+)
+
+// grpcRequestIDKey is the metadata key the gRPC service sends the request
+// ID under, the gRPC form of the X-Request-ID header.
+const grpcRequestIDKey = "x-request-id"
+
+// RegisterGRPC adds the MPC gRPC service to gs, serving the same registry
+// as the HTTP endpoints. Use it to mount the service on an existing gRPC
+// server; ServeGRPC runs a dedicated one.
+func (s *Server) RegisterGRPC(gs grpc.ServiceRegistrar) {
+	mpcpb.RegisterMPCServer(gs, grpcService{s: s})
+}
+
+// ServeGRPC serves the MPC gRPC service on l until Shutdown is called. It
+// may run alongside Serve, on a listener of its own.
+func (s *Server) ServeGRPC(l net.Listener, opts ...grpc.ServerOption) error {
+	s.mu.Lock()
+	if s.grpc == nil {
+		s.grpc = grpc.NewServer(opts...)
+		s.RegisterGRPC(s.grpc)
+	}
+	gs := s.grpc
+	s.mu.Unlock()
+	return gs.Serve(l)
+}
+
+// grpcService implements mpcpb.MPCServer on top of Server.invoke.
+type grpcService struct {
+	mpcpb.UnimplementedMPCServer
+	s *Server
+}
+
+func (g grpcService) Invoke(ctx context.Context, in *mpcpb.InvokeRequest) (*mpcpb.AgentResponse, error) {
+	req := requestFromPB(in.GetRequest())
+	req.RequestID = incomingRequestID(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, req.RequestID))
+	if g.s.stopping.Load() {
+		return nil, grpcError(errShuttingDown(), req.RequestID)
+	}
+	ctx, apiErr := g.s.grpcAuthenticate(ctx)
+	if apiErr != nil {
+		return nil, grpcError(apiErr, req.RequestID)
+	}
+	resp, apiErr := g.s.invoke(ctx, in.GetAgent(), req)
+	if apiErr != nil {
+		return nil, grpcError(apiErr, req.RequestID)
+	}
+	return responseToPB(resp), nil
+}
+
+func (g grpcService) Stream(in *mpcpb.InvokeRequest, stream grpc.ServerStreamingServer[mpcpb.Chunk]) error {
+	defer g.s.metrics.openStream("grpc")()
+	req := requestFromPB(in.GetRequest())
+	req.RequestID = incomingRequestID(stream.Context())
+	_ = stream.SetHeader(metadata.Pairs(grpcRequestIDKey, req.RequestID))
+	if g.s.stopping.Load() {
+		return grpcError(errShuttingDown(), req.RequestID)
+	}
+	sctx, apiErr := g.s.grpcAuthenticate(stream.Context())
+	if apiErr != nil {
+		return grpcError(apiErr, req.RequestID)
+	}
+
+	// Status updates may arrive from any goroutine, while a stream allows
+	// one sender at a time; they go through updates to the sending loop.
+	updates := make(chan string, 16)
+	ctx := withStatusFunc(sctx, func(status string) {
+		select {
+		case updates <- status:
+		case <-stream.Context().Done():
+		}
+	})
+	type outcome struct {
+		resp   *responseEnvelope
+		apiErr *Error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		resp, apiErr := g.s.invoke(ctx, in.GetAgent(), req)
+		done <- outcome{resp, apiErr}
+	}()
+
+	for {
+		select {
+		case st := <-updates:
+			if err := stream.Send(&mpcpb.Chunk{Id: req.RequestID, Status: st}); err != nil {
+				return err
+			}
+		case o := <-done:
+			if err := sendUpdates(stream, req.RequestID, updates); err != nil {
+				return err
+			}
+			if o.apiErr != nil {
+				return grpcError(o.apiErr, req.RequestID)
+			}
+			return stream.Send(&mpcpb.Chunk{
+				Id:           req.RequestID,
+				Text:         o.resp.Result,
+				FinishReason: "stop",
+				Response:     responseToPB(o.resp),
+			})
+		}
+	}
+}
+
+// sendUpdates flushes the status updates still queued when the call ends.
+func sendUpdates(stream grpc.ServerStreamingServer[mpcpb.Chunk], id string, updates <-chan string) error {
+	for {
+		select {
+		case st := <-updates:
+			if err := stream.Send(&mpcpb.Chunk{Id: id, Status: st}); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (g grpcService) ListAgents(ctx context.Context, _ *mpcpb.ListAgentsRequest) (*mpcpb.ListAgentsResponse, error) {
+	if _, apiErr := g.s.grpcAuthenticate(ctx); apiErr != nil {
+		return nil, grpcError(apiErr, "")
+	}
+	out := &mpcpb.ListAgentsResponse{}
+	for _, info := range g.s.registry.List() {
+		out.Agents = append(out.Agents, agentInfoToPB(info))
+	}
+	return out, nil
+}
+
+func (g grpcService) DescribeAgent(ctx context.Context, in *mpcpb.DescribeAgentRequest) (*mpcpb.AgentInfo, error) {
+	if _, apiErr := g.s.grpcAuthenticate(ctx); apiErr != nil {
+		return nil, grpcError(apiErr, "")
+	}
+	_, info, ok := g.s.registry.Lookup(in.GetName())
+	if !ok {
+		return nil, grpcError(Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", in.GetName()), "")
+	}
+	return agentInfoToPB(info), nil
+}
+
+// grpcAuthenticate checks the API key sent in ctx's metadata, the gRPC
+// form of the HTTP headers, when the server requires one.
+func (s *Server) grpcAuthenticate(ctx context.Context) (context.Context, *Error) {
+	if s.keys == nil {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &http.Request{Header: make(http.Header)}
+	for _, k := range []string{APIKeyHeader, "Authorization"} {
+		if v := md.Get(k); len(v) > 0 {
+			r.Header.Set(k, v[0])
+		}
+	}
+	st, apiErr := s.keys.authenticate(credential(r))
+	if apiErr != nil {
+		return ctx, apiErr
+	}
+	return withAPIKey(ctx, st), nil
+}
+
+// incomingRequestID returns the request ID the caller sent in ctx's
+// metadata, or a new one.
+func incomingRequestID(ctx context.Context) string {
+	var id string
+	if ids := metadata.ValueFromIncomingContext(ctx, grpcRequestIDKey); len(ids) > 0 {
+		id = ids[0]
+	}
+	return requestID(id)
+}
+
+// grpcError converts e to a gRPC status carrying an ErrorInfo with the
+// HTTP status, code and request ID the HTTP API would have sent.
+func grpcError(e *Error, requestID string) error {
+	info := &mpcpb.ErrorInfo{HttpStatus: int32(e.Status), Code: e.Code, RequestId: requestID}
+	if e.Details != nil {
+		info.Details, _ = json.Marshal(e.Details)
+	}
+	st, err := status.New(grpcCode(e.Status), e.Message).WithDetails(info)
+	if err != nil {
+		return status.Error(grpcCode(e.Status), e.Message)
+	}
+	return st.Err()
+}
+
+// grpcCode maps an HTTP status onto the closest gRPC code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case StatusClientClosedRequest:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	if httpStatus >= 400 && httpStatus < 500 {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+func requestFromPB(in *mpcpb.AgentRequest) Request {
+	req := Request{
+		Prompt:     in.GetPrompt(),
+		Context:    in.GetContext().AsMap(),
+		Parameters: in.GetParameters().AsMap(),
+		Format:     in.GetFormat(),
+		Metadata:   in.GetMetadata(),
+	}
+	if len(req.Context) == 0 {
+		req.Context = nil
+	}
+	if len(req.Parameters) == 0 {
+		req.Parameters = nil
+	}
+	if r := in.GetRequires(); r != nil {
+		req.Requires = &Requirements{ProtocolVersion: int(r.GetProtocolVersion()), MinVersion: r.GetMinVersion(), Capabilities: r.GetCapabilities()}
+	}
+	for _, m := range in.GetMessages() {
+		req.Messages = append(req.Messages, Message{Role: m.GetRole(), Content: m.GetContent()})
+	}
+	for _, t := range in.GetTools() {
+		req.Tools = append(req.Tools, ToolSpec{Name: t.GetName(), Description: t.GetDescription(), Parameters: t.GetParameters()})
+	}
+	for _, r := range in.GetToolResults() {
+		req.ToolResults = append(req.ToolResults, ToolResult{
+			ToolCall: toolCallFromPB(r.GetCall()),
+			Output:   r.GetOutput(),
+			Error:    r.GetError(),
+		})
+	}
+	return req
+}
+
+func toolCallFromPB(tc *mpcpb.ToolCall) ToolCall {
+	return ToolCall{ID: tc.GetId(), Name: tc.GetName(), Arguments: tc.GetArguments()}
+}
+
+func responseToPB(r *responseEnvelope) *mpcpb.AgentResponse {
+	out := &mpcpb.AgentResponse{
+		Agent:           r.Agent,
+		Prompt:          r.Prompt,
+		Result:          r.Result,
+		Status:          r.Status,
+		RequestId:       r.RequestID,
+		ExecutionTimeMs: r.ExecutionTimeMS,
+		Timestamp:       r.Timestamp,
+		Data:            r.Data,
+		Metadata:        toStruct(r.Metadata),
+		Format:          r.Format,
+		AgentVersion:    r.AgentVersion,
+		ProtocolVersion: int32(r.ProtocolVersion),
+	}
+	for _, tc := range r.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, &mpcpb.ToolCall{Id: tc.ID, Name: tc.Name, Arguments: tc.Arguments})
+	}
+	if u := r.Usage; u != nil {
+		out.Usage = &mpcpb.Usage{
+			PromptTokens:     int64(u.PromptTokens),
+			CompletionTokens: int64(u.CompletionTokens),
+			TotalTokens:      int64(u.TotalTokens),
+		}
+	}
+	return out
+}
+
+func agentInfoToPB(info AgentInfo) *mpcpb.AgentInfo {
+	out := &mpcpb.AgentInfo{
+		Name:            info.Name,
+		Description:     info.Description,
+		Capabilities:    info.Capabilities,
+		RequiredContext: info.RequiredContext,
+		ExamplePrompts:  info.ExamplePrompts,
+		Formats:         info.Formats,
+		Version:         info.Version,
+		ProtocolVersion: int32(info.ProtocolVersion),
+	}
+	for _, p := range info.Parameters {
+		out.Parameters = append(out.Parameters, &mpcpb.ParameterInfo{Name: p.Name, Type: p.Type, Description: p.Description, Required: p.Required})
+	}
+	return out
+}
+
+// toStruct converts m to a Struct, going through JSON for values such as
+// typed slices that structpb does not accept directly.
+func toStruct(m map[string]any) *structpb.Struct {
+	if m == nil {
+		return nil
+	}
+	if st, err := structpb.NewStruct(m); err == nil {
+		return st
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var st structpb.Struct
+	if err := protojson.Unmarshal(b, &st); err != nil {
+		return nil
+	}
+	return &st
+}
@@ -0,0 +1,135 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcpb"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// newGRPCTestServer serves agents over both HTTP and gRPC and returns a
+// client for each.
+func newGRPCTestServer(t *testing.T, agents map[string]mpcserver.Agent) (httpClient, grpcClient *mpcclient.Client, cc *grpc.ClientConn) {
+	t.Helper()
+	s := mpcserver.New()
+	for name, a := range agents {
+		if err := s.Register(name, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeGRPC(l)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	cc, err = grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	httpClient, err = mpcclient.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcClient, err = mpcclient.NewClient(ts.URL, mpcclient.WithGRPCTransport(cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httpClient, grpcClient, cc
+}
+
+func TestGRPCMatchesHTTP(t *testing.T) {
+	progress := mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		mpcserver.ReportStatus(ctx, "thinking")
+		return mpcserver.Response{
+			Result:    "done: " + req.Prompt,
+			Data:      []byte(`{"cpu":42}`),
+			ToolCalls: []mpcserver.ToolCall{{ID: "1", Name: "lookup", Arguments: []byte(`{"vm":"web01"}`)}},
+			Metadata:  map[string]any{"vm": req.Context["vm"]},
+			Usage:     &mpcserver.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3},
+		}, nil
+	})
+	_, gc, _ := newGRPCTestServer(t, map[string]mpcserver.Agent{"echo": echoAgent{}, "progress": progress})
+	ctx := context.Background()
+
+	var statuses []string
+	resp, err := gc.Invoke(ctx, "progress", mpcclient.AgentRequest{Prompt: "hi", Context: map[string]any{"vm": "web01"}},
+		mpcclient.WithStatusHandler(func(s string) { statuses = append(statuses, s) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "done: hi" || resp.Status != "success" || resp.RequestID == "" || string(resp.Data) != `{"cpu":42}` ||
+		resp.Usage.TotalTokens != 3 || resp.Metadata["vm"] != "web01" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if tc, ok := resp.ToolCall("lookup"); !ok || string(tc.Arguments) != `{"vm":"web01"}` {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if len(statuses) != 1 || statuses[0] != "thinking" {
+		t.Errorf("statuses = %q", statuses)
+	}
+	resp, err = gc.CallAgent(ctx, "echo", "plain")
+	if err != nil || resp.Result != "echo: plain" {
+		t.Errorf("unary call = %+v, %v", resp, err)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	hc, gc, _ := newGRPCTestServer(t, map[string]mpcserver.Agent{"echo": echoAgent{}})
+	tests := []struct {
+		agent, prompt string
+		status        int
+		code          string
+	}{
+		{"missing", "hi", http.StatusNotFound, mpcserver.CodeAgentNotFound},
+		{"echo", "", http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"echo", "bad", http.StatusBadRequest, "invalid_parameters"},
+		{"echo", "crash", http.StatusInternalServerError, mpcserver.CodeAgentError},
+	}
+	for _, tt := range tests {
+		for name, c := range map[string]*mpcclient.Client{"http": hc, "grpc": gc} {
+			_, err := c.CallAgent(context.Background(), tt.agent, tt.prompt)
+			var apiErr *mpcclient.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status || apiErr.Code != tt.code || apiErr.RequestID == "" {
+				t.Errorf("%s: %s(%q) = %v, want %d %s with request ID", name, tt.agent, tt.prompt, err, tt.status, tt.code)
+			}
+		}
+	}
+	if _, err := gc.CallAgent(context.Background(), "missing", "hi"); !errors.Is(err, mpcclient.ErrAgentNotFound) {
+		t.Errorf("err = %v, want ErrAgentNotFound", err)
+	}
+	if _, err := gc.CallAgent(context.Background(), "echo", "hi", mpcclient.WithRequiredCapabilities(mpcclient.CapabilityTools)); !errors.Is(err, mpcclient.ErrIncompatibleAgent) {
+		t.Errorf("err = %v, want ErrIncompatibleAgent", err)
+	}
+	if resp, err := gc.CallAgent(context.Background(), "echo", "hi", mpcclient.WithRequiredCapabilities(mpcclient.CapabilityStreaming)); err != nil || resp.ProtocolVersion != mpcserver.ProtocolVersion {
+		t.Errorf("met requirements = %+v, %v", resp, err)
+	}
+}
+
+func TestGRPCDiscovery(t *testing.T) {
+	_, _, cc := newGRPCTestServer(t, map[string]mpcserver.Agent{"echo": echoAgent{}})
+	rpc := mpcpb.NewMPCClient(cc)
+	ctx := context.Background()
+
+	list, err := rpc.ListAgents(ctx, &mpcpb.ListAgentsRequest{})
+	if err != nil || len(list.GetAgents()) != 1 || list.GetAgents()[0].GetDescription() != "Echoes prompts" {
+		t.Fatalf("ListAgents = %v, %v", list, err)
+	}
+	info, err := rpc.DescribeAgent(ctx, &mpcpb.DescribeAgentRequest{Name: "echo"})
+	if err != nil || info.GetName() != "echo" || len(info.GetExamplePrompts()) != 1 || info.GetProtocolVersion() != mpcserver.ProtocolVersion {
+		t.Errorf("DescribeAgent = %v, %v", info, err)
+	}
+}
@@ -0,0 +1,105 @@
+package mpcserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readyCheckTimeout bounds how long /readyz waits for agent checks.
+const readyCheckTimeout = 5 * time.Second
+
+// Checker is implemented by agents that depend on a backend which may be
+// unavailable. /readyz reports the server ready only while every Checker
+// returns nil. Agents that do not implement it are always available.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Agent availability reported by /readyz.
+const (
+	AgentAvailable   = "available"
+	AgentUnavailable = "unavailable"
+)
+
+// AgentStatus is one agent's entry in a readiness report.
+type AgentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthReport is the body of a liveness probe's response.
+type healthReport struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	Uptime  string `json:"uptime"`
+	// Agents is the number of registered agents.
+	Agents int `json:"agents"`
+}
+
+// readinessReport is the body of a readiness probe's response.
+type readinessReport struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version"`
+	Uptime  string                 `json:"uptime"`
+	Agents  map[string]AgentStatus `json:"agents"`
+}
+
+// handleHealth answers liveness probes: the process is up and serving.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthReport{Status: "healthy", Version: s.version, Uptime: s.uptime(), Agents: s.registry.Len()})
+}
+
+// handleReady answers readiness probes. It responds 503 while the server
+// is shutting down or any agent's check fails.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	agents := s.checkAgents(ctx)
+	status, code := "ready", http.StatusOK
+	for _, a := range agents {
+		if a.Status != AgentAvailable {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	if s.stopping.Load() {
+		status, code = "shutting_down", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, readinessReport{Status: status, Version: s.version, Uptime: s.uptime(), Agents: agents})
+}
+
+// checkAgents runs the checks of every registered agent concurrently.
+func (s *Server) checkAgents(ctx context.Context) map[string]AgentStatus {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		out = make(map[string]AgentStatus)
+	)
+	for _, info := range s.registry.List() {
+		agent, _, ok := s.registry.Lookup(info.Name)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st := AgentStatus{Status: AgentAvailable}
+			if c, ok := agent.(Checker); ok {
+				if err := c.Check(ctx); err != nil {
+					st = AgentStatus{Status: AgentUnavailable, Error: err.Error()}
+				}
+			}
+			mu.Lock()
+			out[info.Name] = st
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+func (s *Server) uptime() string {
+	return time.Since(s.started).Round(time.Second).String()
+}
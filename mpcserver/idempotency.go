@@ -0,0 +1,240 @@
+package mpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader carries a key the client picks for an agent call
+// and sends again with each retry of it. The first call with a key runs
+// the agent; repeats of it, from the same API key to the same agent, get
+// the first call's response instead of running the agent again, and wait
+// for it while the first call is still in flight.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set to "true" on responses replayed for a
+// repeated idempotency key. Their request_id is that of the first call.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyTTL is how long successful responses are kept for
+// replay by default.
+const DefaultIdempotencyTTL = 10 * time.Minute
+
+// maxIdempotencyKeyLen bounds the length of an idempotency key, and
+// maxIdempotencyEntries the number of responses kept for replay.
+const (
+	maxIdempotencyKeyLen  = 255
+	maxIdempotencyEntries = 10000
+)
+
+// WithIdempotencyTTL sets how long successful agent calls sent with an
+// Idempotency-Key are remembered. Zero or less turns deduplication off, so
+// that every call runs its agent.
+func WithIdempotencyTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.idempotency.ttl = d
+	}
+}
+
+// idempotencyCache deduplicates agent calls by their idempotency key.
+// Failed calls are forgotten, so that their retries run the agent again;
+// calls waiting on them share the failure.
+type idempotencyCache struct {
+	ttl time.Duration
+	// store, if set, keeps successful responses beyond the process.
+	store IdempotencyStore
+
+	mu      sync.Mutex
+	entries map[idempotencyKey]*idempotentCall
+	// expiry lists the completed calls, oldest first.
+	expiry []expiringCall
+}
+
+type expiringCall struct {
+	key  idempotencyKey
+	call *idempotentCall
+}
+
+// idempotencyKey scopes a client's key to the API key it was sent with
+// and to the agent called, so that keys cannot collide across callers.
+type idempotencyKey struct {
+	caller, agent, key string
+}
+
+type idempotentCall struct {
+	fingerprint [32]byte
+	done        chan struct{}
+	expires     time.Time
+	env         *responseEnvelope
+	err         *Error
+}
+
+// idempotent runs call once for the Idempotency-Key of r, replaying its
+// response to repeats of r. Calls without a key, or made while
+// deduplication is off, always run. replayed reports whether the response
+// is that of an earlier call.
+func (s *Server) idempotent(r *http.Request, agent string, req Request, call func() (*responseEnvelope, *Error)) (env *responseEnvelope, replayed bool, apiErr *Error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	c := &s.idempotency
+	if key == "" || c.ttl <= 0 {
+		env, apiErr = call()
+		return env, false, apiErr
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return nil, false, Errorf(http.StatusBadRequest, CodeInvalidRequest, "%s is longer than %d bytes", IdempotencyKeyHeader, maxIdempotencyKeyLen)
+	}
+	k := idempotencyKey{agent: agent, key: key}
+	if st := apiKeyFrom(r.Context()); st != nil {
+		k.caller = st.Name
+	}
+	fp := fingerprint(req)
+
+	c.mu.Lock()
+	c.expire(time.Now())
+	for prev, ok := c.entries[k]; ok; prev, ok = c.entries[k] {
+		c.mu.Unlock()
+		if prev.fingerprint != fp {
+			return nil, false, Errorf(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+				"%s %q was already used for a different request to agent %q", IdempotencyKeyHeader, key, agent)
+		}
+		env, replayed, apiErr = prev.wait(r.Context())
+		// A call given up by the client that made it is run for a repeat
+		// still waiting for it.
+		if !replayed || apiErr == nil || apiErr.Code != CodeCanceled {
+			return env, replayed, apiErr
+		}
+		c.mu.Lock()
+	}
+	cur := &idempotentCall{fingerprint: fp, done: make(chan struct{})}
+	if c.entries == nil {
+		c.entries = make(map[idempotencyKey]*idempotentCall)
+	}
+	c.entries[k] = cur
+	c.mu.Unlock()
+
+	replayed, cur.env, cur.expires, cur.err = s.loadIdempotent(r.Context(), k, cur)
+	if !replayed {
+		cur.env, cur.err = call()
+		if cur.err == nil {
+			cur.expires = time.Now().Add(c.ttl)
+			s.saveIdempotent(r.Context(), k, cur)
+		}
+	}
+	c.mu.Lock()
+	if cur.err != nil {
+		delete(c.entries, k)
+	} else {
+		c.expiry = append(c.expiry, expiringCall{k, cur})
+	}
+	c.mu.Unlock()
+	close(cur.done)
+	return cur.env, replayed, cur.err
+}
+
+// storeKey is the key of k in the server's IdempotencyStore, which may be
+// shared with tenants.
+func (s *Server) storeKey(k idempotencyKey) string {
+	return strings.Join([]string{s.tenantID, k.caller, k.agent, k.key}, "\x00")
+}
+
+// loadIdempotent looks up a response for k kept by an earlier process,
+// reporting whether one was found. A response kept for a different
+// request is an idempotency_key_reused error. Store failures are logged
+// and treated as misses.
+func (s *Server) loadIdempotent(ctx context.Context, k idempotencyKey, cur *idempotentCall) (bool, *responseEnvelope, time.Time, *Error) {
+	store := s.idempotency.store
+	if store == nil {
+		return false, nil, time.Time{}, nil
+	}
+	stored, err := store.GetResponse(ctx, s.storeKey(k))
+	if err != nil {
+		if !errors.Is(err, ErrResponseNotFound) && s.logger != nil {
+			s.logger.Error("load idempotent response", "agent", k.agent, "error", err)
+		}
+		return false, nil, time.Time{}, nil
+	}
+	if stored.Fingerprint != hex.EncodeToString(cur.fingerprint[:]) {
+		return true, nil, time.Time{}, Errorf(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+			"%s %q was already used for a different request to agent %q", IdempotencyKeyHeader, k.key, k.agent)
+	}
+	env := new(responseEnvelope)
+	if err := json.Unmarshal(stored.Envelope, env); err != nil {
+		if s.logger != nil {
+			s.logger.Error("load idempotent response", "agent", k.agent, "error", err)
+		}
+		return false, nil, time.Time{}, nil
+	}
+	return true, env, stored.ExpiresAt, nil
+}
+
+// saveIdempotent keeps the response of cur in the server's store, if any.
+func (s *Server) saveIdempotent(ctx context.Context, k idempotencyKey, cur *idempotentCall) {
+	store := s.idempotency.store
+	if store == nil {
+		return
+	}
+	b, err := json.Marshal(cur.env)
+	if err == nil {
+		err = store.PutResponse(context.WithoutCancel(ctx), s.storeKey(k), StoredResponse{
+			Fingerprint: hex.EncodeToString(cur.fingerprint[:]),
+			Envelope:    b,
+			ExpiresAt:   cur.expires,
+		})
+	}
+	if err != nil && s.logger != nil {
+		s.logger.Error("store idempotent response", "agent", k.agent, "error", err)
+	}
+}
+
+// wait returns the outcome of the call once it completes.
+func (ic *idempotentCall) wait(ctx context.Context) (*responseEnvelope, bool, *Error) {
+	select {
+	case <-ic.done:
+		return ic.env, true, ic.err
+	case <-ctx.Done():
+		return nil, false, callError(ctx, ctx.Err())
+	}
+}
+
+// expire forgets the completed calls whose time is up, and the oldest
+// ones beyond maxIdempotencyEntries. c.mu must be held.
+func (c *idempotencyCache) expire(now time.Time) {
+	n := 0
+	for ; n < len(c.expiry); n++ {
+		e := c.expiry[n]
+		if len(c.expiry)-n <= maxIdempotencyEntries && now.Before(e.call.expires) {
+			break
+		}
+		if c.entries[e.key] == e.call {
+			delete(c.entries, e.key)
+		}
+	}
+	c.expiry = c.expiry[n:]
+}
+
+// fingerprint hashes what makes up an agent request, so that a reused
+// idempotency key is told apart from a retry.
+func fingerprint(req Request) [32]byte {
+	h := sha256.New()
+	b, _ := json.Marshal(req)
+	h.Write(b)
+	for _, a := range req.Attachments {
+		for _, s := range []string{a.Name, a.ContentType} {
+			binary.Write(h, binary.BigEndian, uint64(len(s)))
+			h.Write([]byte(s))
+		}
+		binary.Write(h, binary.BigEndian, uint64(len(a.Data)))
+		h.Write(a.Data)
+	}
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
@@ -0,0 +1,279 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// countingAgent counts its calls, failing those whose prompt is "fail".
+type countingAgent struct{ calls *atomic.Int32 }
+
+func (a countingAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	n := a.calls.Add(1)
+	if req.Prompt == "fail" {
+		return mpcserver.Response{}, errors.New("backend unavailable")
+	}
+	return mpcserver.Response{Result: fmt.Sprintf("%s #%d", req.Prompt, n)}, nil
+}
+
+// countingAgents returns the "count" and "other" agents, which share a
+// count of their calls.
+func countingAgents() (map[string]mpcserver.Agent, *atomic.Int32) {
+	calls := new(atomic.Int32)
+	return map[string]mpcserver.Agent{"count": countingAgent{calls}, "other": countingAgent{calls}}, calls
+}
+
+// postAgent sends body to agent under an idempotency key, returning the
+// response with its body read.
+func postAgent(t *testing.T, url, agent, key, body string) *http.Response {
+	t.Helper()
+	res, err := sendAgent(url, agent, key, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func sendAgent(url, agent, key, body string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url+"/agent/"+agent, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(mpcserver.IdempotencyKeyHeader, key)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(io.Discard, res.Body)
+	return res, err
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	agents, calls := countingAgents()
+	_, c := newTestServer(t, agents)
+	ctx := context.Background()
+	first, err := c.CallAgent(ctx, "count", "hello", mpcclient.WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.CallAgent(ctx, "count", "hello", mpcclient.WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Result != first.Result || again.RequestID != first.RequestID {
+		t.Errorf("repeat = %q (%s), want the first response %q (%s)", again.Result, again.RequestID, first.Result, first.RequestID)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("agent ran %d times, want 1", n)
+	}
+
+	// Other keys, other agents and calls without a key run the agent.
+	for _, call := range []struct{ agent, key string }{{"count", "k2"}, {"other", "k1"}, {"count", ""}} {
+		var opts []mpcclient.CallOption
+		if call.key != "" {
+			opts = append(opts, mpcclient.WithIdempotencyKey(call.key))
+		}
+		if _, err := c.CallAgent(ctx, call.agent, "hello", opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("agent ran %d times, want 4", n)
+	}
+}
+
+func TestIdempotencyReplayedHeader(t *testing.T) {
+	agents, _ := countingAgents()
+	_, c := newTestServer(t, agents)
+	url := c.BaseURL()
+	if res := postAgent(t, url, "count", "k", `{"prompt":"hi"}`); res.Header.Get(mpcserver.IdempotentReplayedHeader) != "" {
+		t.Errorf("first response marked replayed")
+	}
+	if res := postAgent(t, url, "count", "k", `{"prompt":"hi"}`); res.Header.Get(mpcserver.IdempotentReplayedHeader) != "true" {
+		t.Errorf("%s = %q on the repeat, want true", mpcserver.IdempotentReplayedHeader, res.Header.Get(mpcserver.IdempotentReplayedHeader))
+	}
+}
+
+func TestIdempotencyKeyReused(t *testing.T) {
+	agents, calls := countingAgents()
+	_, c := newTestServer(t, agents)
+	ctx := context.Background()
+	if _, err := c.CallAgent(ctx, "count", "one", mpcclient.WithIdempotencyKey("k")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.CallAgent(ctx, "count", "two", mpcclient.WithIdempotencyKey("k"))
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Code != mpcserver.CodeIdempotencyKeyReused {
+		t.Fatalf("err = %v, want a 422 %s error", err, mpcserver.CodeIdempotencyKeyReused)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("agent ran %d times, want 1", n)
+	}
+}
+
+func TestIdempotencyFailuresRunAgain(t *testing.T) {
+	agents, calls := countingAgents()
+	_, c := newTestServer(t, agents)
+	url := c.BaseURL()
+	for range 2 {
+		if res := postAgent(t, url, "count", "k", `{"prompt":"fail"}`); res.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", res.StatusCode)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("agent ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotencyConcurrentRepeats(t *testing.T) {
+	agent := newBlockingAgent(8)
+	s := mpcserver.New()
+	s.Register("blocking", agent)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	var wg sync.WaitGroup
+	results := make([]string, 3)
+	for i := range results {
+		wg.Go(func() {
+			res, err := sendAgent(ts.URL, "blocking", "k", `{"prompt":"x"}`)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = res.Header.Get(mpcserver.IdempotentReplayedHeader)
+		})
+	}
+	<-agent.started
+	// Give the repeats time to arrive while the first call is in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(agent.release)
+	wg.Wait()
+	if n := len(agent.started); n != 0 {
+		t.Errorf("agent ran %d more times", n)
+	}
+	replayed := 0
+	for _, r := range results {
+		if r == "true" {
+			replayed++
+		}
+	}
+	if replayed != 2 {
+		t.Errorf("%d responses replayed, want 2", replayed)
+	}
+}
+
+func TestIdempotencyRetryAfterLostResponse(t *testing.T) {
+	// The first response is lost on its way back, as in a network blip;
+	// the client's retry gets it replayed rather than running the agent
+	// again.
+	calls := new(atomic.Int32)
+	s := mpcserver.New()
+	s.Register("count", countingAgent{calls})
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			s.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	c, err := mpcclient.NewClient(ts.URL, mpcclient.WithIdempotency(), mpcclient.WithRetryPolicy(mpcclient.RetryPolicy{
+		MaxAttempts: 2, RetryableStatus: []int{http.StatusBadGateway},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.CallAgent(context.Background(), "count", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "hello #1" || calls.Load() != 1 || requests.Load() != 2 {
+		t.Errorf("result %q after %d agent runs and %d requests, want hello #1 after 1 and 2", resp.Result, calls.Load(), requests.Load())
+	}
+}
+
+func TestIdempotencyDisabled(t *testing.T) {
+	agents, calls := countingAgents()
+	_, c := newTestServer(t, agents, mpcserver.WithIdempotencyTTL(0))
+	url := c.BaseURL()
+	postAgent(t, url, "count", "k", `{"prompt":"hi"}`)
+	postAgent(t, url, "count", "k", `{"prompt":"hi"}`)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("agent ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotencyRepeatRunsAfterCancel(t *testing.T) {
+	// A repeat waiting on a call whose client went away runs the agent
+	// itself rather than sharing the cancellation.
+	first := cancelAgent{started: make(chan struct{}, 1), cancelled: make(chan error, 1)}
+	calls := new(atomic.Int32)
+	s := mpcserver.New()
+	s.Register("count", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		if calls.Add(1) == 1 {
+			return first.Handle(ctx, req)
+		}
+		return mpcserver.Response{Result: "ran again"}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/agent/count", strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(mpcserver.IdempotencyKeyHeader, "k")
+	go func() {
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-first.started
+
+	repeat := make(chan *http.Response, 1)
+	go func() {
+		res, err := sendAgent(ts.URL, "count", "k", `{"prompt":"hi"}`)
+		if err != nil {
+			t.Error(err)
+		}
+		repeat <- res
+	}()
+	// Give the repeat time to arrive while the first call is in flight.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case res := <-repeat:
+		if res == nil {
+			return
+		}
+		if res.StatusCode != http.StatusOK || res.Header.Get(mpcserver.IdempotentReplayedHeader) != "" {
+			t.Errorf("repeat got %d (replayed %q), want a fresh 200", res.StatusCode, res.Header.Get(mpcserver.IdempotentReplayedHeader))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("repeat did not complete")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("agent ran %d times, want 2", n)
+	}
+}
@@ -0,0 +1,399 @@
+package mpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultJobTTL is how long finished jobs are kept unless overridden with
+// WithJobTTL.
+const DefaultJobTTL = time.Hour
+
+// maxJobWait bounds the long-poll wait a client may ask GET /jobs/{id} for.
+const maxJobWait = time.Minute
+
+// jobPollInterval is how often a long-poll re-reads the store, to see
+// jobs finished by other servers sharing it.
+const jobPollInterval = time.Second
+
+// JobStatus is the state of an asynchronous job.
+type JobStatus string
+
+// Job states. A job moves from pending to running to succeeded or failed.
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Done reports whether the job has finished.
+func (st JobStatus) Done() bool {
+	return st == JobSucceeded || st == JobFailed
+}
+
+// Job is an agent call submitted with POST /jobs/{name} and run in the
+// background. Its JSON form is what GET /jobs/{id} returns.
+type Job struct {
+	ID          string    `json:"id"`
+	Agent       string    `json:"agent"`
+	Status      JobStatus `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CompletedAt time.Time `json:"completed_at,omitzero"`
+	// ExpiresAt is when a finished job may be dropped from the store.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Response is the envelope POST /agent/{name} would have returned, set
+	// once the job succeeded.
+	Response json.RawMessage `json:"response,omitempty"`
+	// Error describes the failure of a failed job.
+	Error *JobError `json:"error,omitempty"`
+	// CallbackURL is where the finished job is POSTed, if the client
+	// submitting it named one.
+	CallbackURL string `json:"callback_url,omitempty"`
+	// Owner names the API key the job was submitted with, on servers
+	// requiring keys. GET /jobs lists, and GET /jobs/{id} returns, only the
+	// caller's own jobs.
+	Owner string `json:"owner,omitempty"`
+	// Schedule names the schedule that ran the job, for jobs not
+	// submitted by a client.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// JobError is the failure of a job, as the HTTP API would have reported it.
+type JobError struct {
+	Status  int    `json:"status_code"`
+	Message string `json:"error"`
+	Code    string `json:"code,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// ErrJobNotFound is returned by a JobStore for unknown or expired jobs.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStore persists jobs. Put creates or replaces a job; Get returns
+// ErrJobNotFound for jobs it does not hold or whose ExpiresAt has passed.
+// Stores shared by several servers let any of them answer for a job.
+// Implementations must be safe for concurrent use.
+type JobStore interface {
+	Put(ctx context.Context, job Job) error
+	Get(ctx context.Context, id string) (Job, error)
+	// List returns every job not yet expired, in any order.
+	List(ctx context.Context) ([]Job, error)
+}
+
+// MemoryJobStore is a JobStore held in memory. Expired jobs are removed
+// whenever a job is written.
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryJobStore returns an empty in-memory store.
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job)}
+}
+
+// Put implements JobStore.
+func (m *MemoryJobStore) Put(_ context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, j := range m.jobs {
+		if expired(j, now) {
+			delete(m.jobs, id)
+		}
+	}
+	m.jobs[job.ID] = job
+	return nil
+}
+
+// Get implements JobStore.
+func (m *MemoryJobStore) Get(_ context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok || expired(j, time.Now()) {
+		return Job{}, ErrJobNotFound
+	}
+	return j, nil
+}
+
+// List implements JobStore.
+func (m *MemoryJobStore) List(_ context.Context) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if !expired(j, now) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+// Len returns the number of jobs held, including expired ones not yet
+// removed.
+func (m *MemoryJobStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.jobs)
+}
+
+func expired(j Job, now time.Time) bool {
+	return !j.ExpiresAt.IsZero() && !now.Before(j.ExpiresAt)
+}
+
+// WithJobStore sets where jobs are kept. It defaults to a MemoryJobStore.
+func WithJobStore(store JobStore) Option {
+	return func(s *Server) {
+		if store != nil {
+			s.jobs.store = store
+		}
+	}
+}
+
+// WithJobTTL sets how long finished jobs are kept before they expire.
+func WithJobTTL(d time.Duration) Option {
+	return func(s *Server) {
+		if d > 0 {
+			s.jobs.ttl = d
+		}
+	}
+}
+
+// jobRunner runs submitted jobs and wakes the long-polls waiting on them.
+type jobRunner struct {
+	store JobStore
+	ttl   time.Duration
+	// callbacks, if set, delivers jobs to the callback URLs they name.
+	callbacks *JobCallbacks
+
+	mu      sync.Mutex
+	waiters map[string]chan struct{}
+	// ctx is cancelled by Shutdown, aborting running jobs.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (jr *jobRunner) init() {
+	if jr.store == nil {
+		jr.store = NewMemoryJobStore()
+	}
+	if jr.ttl == 0 {
+		jr.ttl = DefaultJobTTL
+	}
+	jr.waiters = make(map[string]chan struct{})
+	jr.ctx, jr.cancel = context.WithCancel(context.Background())
+}
+
+// track prepares for waiters on job id, which this server is about to run.
+func (jr *jobRunner) track(id string) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	jr.waiters[id] = make(chan struct{})
+}
+
+// finished returns a channel closed when job id finishes, or nil if this
+// server is not running it.
+func (jr *jobRunner) finished(id string) <-chan struct{} {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return jr.waiters[id]
+}
+
+func (jr *jobRunner) wake(id string) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	if ch, ok := jr.waiters[id]; ok {
+		close(ch)
+		delete(jr.waiters, id)
+	}
+}
+
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	_, info, ok := s.registry.Lookup(name)
+	if !ok {
+		writeError(w, Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", name))
+		return
+	}
+	// Reject what the agent would refuse now, rather than as a failed job.
+	apiErr := s.keys.checkScope(r.Context(), name)
+	var req Request
+	if apiErr == nil {
+		req, apiErr = s.decodeAgentRequest(w, r)
+	}
+	if apiErr == nil {
+		apiErr = s.checkRequest(info, req)
+	}
+	// Jobs are the bulk work interactive calls are scheduled ahead of.
+	if req.Priority == "" {
+		req.Priority = PriorityBatch
+	}
+	var callback string
+	if apiErr == nil {
+		callback, apiErr = s.jobs.callbackURL(r)
+	}
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	now := time.Now().UTC()
+	job := Job{ID: newRequestID(), Agent: name, Status: JobPending, CreatedAt: now, UpdatedAt: now, CallbackURL: callback, Owner: jobOwner(r.Context())}
+	if err := s.jobs.store.Put(r.Context(), job); err != nil {
+		writeError(w, Errorf(http.StatusInternalServerError, CodeInternal, "store job: %v", err))
+		return
+	}
+	req.RequestID = job.ID
+	s.jobs.track(job.ID)
+	// Count the job from now, so that Shutdown waits for it even before
+	// its agent call starts.
+	s.calls.add()
+	go s.runJob(apiKeyFrom(r.Context()), job, req)
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// runJob runs req with the API key it was submitted with, records the
+// outcome on job and sends its callback, if any.
+func (s *Server) runJob(key *keyState, job Job, req Request) {
+	ctx := withAPIKey(s.jobs.ctx, key)
+	defer s.calls.done()
+	defer s.jobs.wake(job.ID)
+
+	job.Status, job.UpdatedAt = JobRunning, time.Now().UTC()
+	if err := s.jobs.store.Put(ctx, job); err != nil {
+		s.logJobError(job, err)
+	}
+	resp, apiErr := s.invoke(ctx, job.Agent, req)
+
+	now := time.Now().UTC()
+	job.UpdatedAt, job.CompletedAt, job.ExpiresAt = now, now, now.Add(s.jobs.ttl)
+	if apiErr != nil {
+		job.Status = JobFailed
+		job.Error = &JobError{Status: apiErr.Status, Message: apiErr.Message, Code: apiErr.Code, Details: apiErr.Details}
+	} else if b, err := json.Marshal(resp); err != nil {
+		job.Status = JobFailed
+		job.Error = &JobError{Status: http.StatusInternalServerError, Message: err.Error(), Code: CodeInternal}
+	} else {
+		job.Status, job.Response = JobSucceeded, b
+	}
+	// The job's outcome must be stored even when Shutdown cancelled its
+	// agent call.
+	if err := s.jobs.store.Put(context.WithoutCancel(ctx), job); err != nil {
+		s.logJobError(job, err)
+	}
+	if job.CallbackURL != "" {
+		go s.deliverCallback(job)
+	}
+}
+
+func (s *Server) logJobError(job Job, err error) {
+	if s.logger != nil {
+		s.logger.Error("store job", "job", job.ID, "agent", job.Agent, "error", err)
+	}
+}
+
+// jobOwner returns the name of the API key ctx carries, which owns the
+// jobs it submits, or "" on servers not requiring keys.
+func jobOwner(ctx context.Context) string {
+	if key := apiKeyFrom(ctx); key != nil {
+		return key.Name
+	}
+	return ""
+}
+
+// handleListJobs returns a page of the caller's jobs, the most recently
+// submitted first.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	all, err := s.jobs.store.List(r.Context())
+	if err != nil {
+		writeError(w, Errorf(http.StatusInternalServerError, CodeInternal, "list jobs: %v", err))
+		return
+	}
+	owner := jobOwner(r.Context())
+	all = slices.DeleteFunc(all, func(j Job) bool { return j.Owner != owner })
+	jobs, next, apiErr := paginate(r, all, func(j Job) string {
+		// Fixed-width, so that the newest sorts first.
+		return fmt.Sprintf("%020d/%s", math.MaxInt64-j.CreatedAt.UnixNano(), j.ID)
+	})
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobList{Jobs: jobs, Count: len(jobs), NextCursor: next})
+}
+
+// jobList is the body of a job listing, paged as agentList is.
+type jobList struct {
+	Jobs       []Job  `json:"jobs"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// handleGetJob returns a job. With ?wait=<duration> it blocks until the
+// job finishes or the wait, capped at a minute, elapses. Another API key's
+// job is not found, so that its ID tells a caller nothing.
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid wait %q", v))
+			return
+		}
+		wait = min(d, maxJobWait)
+	}
+
+	job, err := s.jobs.store.Get(r.Context(), id)
+	if err == nil && job.Owner != "" && job.Owner != jobOwner(r.Context()) {
+		err = ErrJobNotFound
+	}
+	if wait > 0 && err == nil && !job.Status.Done() {
+		job, err = s.waitJob(r.Context(), id, wait)
+	}
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeError(w, Errorf(http.StatusNotFound, CodeJobNotFound, "job %q not found", id))
+	case err != nil:
+		writeError(w, Errorf(http.StatusInternalServerError, CodeInternal, "load job: %v", err))
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// waitJob waits up to d for job id to finish and returns its latest state.
+func (s *Server) waitJob(ctx context.Context, id string, d time.Duration) (Job, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	poll := time.NewTicker(jobPollInterval)
+	defer poll.Stop()
+	done := s.jobs.finished(id)
+	for {
+		select {
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		case <-timer.C:
+			return s.jobs.store.Get(ctx, id)
+		case <-done:
+			return s.jobs.store.Get(ctx, id)
+		case <-poll.C:
+			job, err := s.jobs.store.Get(ctx, id)
+			if err != nil || job.Status.Done() {
+				return job, err
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func newJobTestServer(t *testing.T, opts ...mpcserver.Option) (*mpcserver.Server, *mpcclient.Client, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	s := mpcserver.New(opts...)
+	s.Register("echo", echoAgent{})
+	s.Register("slow", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return mpcserver.Response{}, ctx.Err()
+		}
+		return mpcserver.Response{Result: "report: " + req.Prompt}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	c, err := mpcclient.NewClient(ts.URL, mpcclient.WithStrictDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, c, release
+}
+
+func TestJobLifecycle(t *testing.T) {
+	_, c, release := newJobTestServer(t)
+	ctx := context.Background()
+
+	job, err := c.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Agent != "slow" || job.Done() {
+		t.Fatalf("submitted job = %+v", job)
+	}
+	got, err := c.GetJob(ctx, job.ID)
+	if err != nil || got.Done() {
+		t.Fatalf("GetJob = %+v, %v; want unfinished job", got, err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	start := time.Now()
+	done, err := c.WaitJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("WaitJob took %v; long-poll was not woken", time.Since(start))
+	}
+	if done.Status != mpcclient.JobSucceeded || done.Response == nil || done.Response.Result != "report: logs" ||
+		done.Response.RequestID != job.ID || done.CompletedAt.IsZero() || done.ExpiresAt.IsZero() {
+		t.Errorf("finished job = %+v", done)
+	}
+}
+
+func TestJobFailure(t *testing.T) {
+	_, c, _ := newJobTestServer(t)
+	ctx := context.Background()
+
+	job, err := c.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := c.WaitJob(ctx, job.ID)
+	var apiErr *mpcclient.APIError
+	if done == nil || done.Status != mpcclient.JobFailed || !errors.As(err, &apiErr) ||
+		apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "invalid_parameters" {
+		t.Errorf("WaitJob = %+v, %v", done, err)
+	}
+
+	if _, err := c.SubmitJob(ctx, "missing", mpcclient.AgentRequest{Prompt: "hi"}); !errors.Is(err, mpcclient.ErrAgentNotFound) {
+		t.Errorf("submit to missing agent: err = %v", err)
+	}
+	if _, err := c.GetJob(ctx, "nope"); !errors.Is(err, mpcclient.ErrJobNotFound) {
+		t.Errorf("GetJob(nope): err = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestJobHiddenFromOtherKeys(t *testing.T) {
+	_, c, release := newJobTestServer(t, mpcserver.WithAPIKeys(
+		mpcserver.APIKey{Name: "ana", Key: "ana-secret"},
+		mpcserver.APIKey{Name: "ben", Key: "ben-secret"},
+	))
+	defer close(release)
+	ana := newKeyClient(t, c.BaseURL(), mpcclient.WithAPIKey("ana-secret"))
+	ben := newKeyClient(t, c.BaseURL(), mpcclient.WithAPIKey("ben-secret"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := ana.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ana.GetJob(ctx, job.ID); err != nil || got.Owner != "ana" {
+		t.Fatalf("owner's GetJob = %+v, %v", got, err)
+	}
+	_, err = ben.GetJob(ctx, job.ID)
+	wantAPIError(t, err, http.StatusNotFound, mpcserver.CodeJobNotFound)
+	// Nor may another key long-poll the job for its result.
+	start := time.Now()
+	_, err = ben.WaitJob(ctx, job.ID)
+	wantAPIError(t, err, http.StatusNotFound, mpcserver.CodeJobNotFound)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("another key's wait took %v, want an immediate 404", elapsed)
+	}
+}
+
+func TestJobExpiry(t *testing.T) {
+	store := mpcserver.NewMemoryJobStore()
+	_, c, _ := newJobTestServer(t, mpcserver.WithJobStore(store), mpcserver.WithJobTTL(20*time.Millisecond))
+	ctx := context.Background()
+
+	job, err := c.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, err := c.WaitJob(ctx, job.ID); err != nil || done.Response.Result != "echo: hi" {
+		t.Fatalf("WaitJob = %+v, %v", done, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.GetJob(ctx, job.ID); !errors.Is(err, mpcclient.ErrJobNotFound) {
+		t.Errorf("expired job: err = %v, want ErrJobNotFound", err)
+	}
+	// Writing another job sweeps the expired one out of the store.
+	if _, err := c.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.Len(); n != 1 {
+		t.Errorf("store holds %d jobs, want 1", n)
+	}
+}
+
+func TestJobCancelledOnShutdown(t *testing.T) {
+	s, c, _ := newJobTestServer(t)
+	ctx := context.Background()
+
+	job, err := c.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grace, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(grace); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the grace period exceeded", err)
+	}
+	done, err := c.WaitJob(ctx, job.ID)
+	if done == nil || done.Status != mpcclient.JobFailed || err == nil {
+		t.Errorf("WaitJob after shutdown = %+v, %v; want failed job", done, err)
+	}
+}
+
+func TestJobDrainedOnShutdown(t *testing.T) {
+	s, c, release := newJobTestServer(t)
+	ctx := context.Background()
+
+	job, err := c.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := c.GetJob(ctx, job.ID); err != nil || done.Status != mpcclient.JobSucceeded {
+		t.Errorf("job after shutdown = %+v, %v; want it finished", done, err)
+	}
+	if _, err := c.SubmitJob(ctx, "slow", mpcclient.AgentRequest{Prompt: "y"}); !errors.Is(err, mpcclient.ErrServerOverloaded) {
+		t.Errorf("submit during shutdown: err = %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package mpcserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WithLogger records agent calls on l at info level, failed calls at warn
+// or error, and every HTTP request at debug level. Prompts and request
+// bodies are never logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// logCall records the outcome of one agent invocation, whatever the
+// transport.
+func (s *Server) logCall(ctx context.Context, name, requestID string, start time.Time, apiErr *Error) {
+	if s.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("agent", name),
+		slog.String("request_id", requestID),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if md, ok := metadataAttr(ctx); ok {
+		attrs = append(attrs, md)
+	}
+	level := slog.LevelInfo
+	if apiErr != nil {
+		level = slog.LevelWarn
+		if apiErr.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs = append(attrs, slog.Int("status", apiErr.Status), slog.String("code", apiErr.Code), slog.String("error", apiErr.Message))
+	}
+	s.logger.LogAttrs(ctx, level, "agent call", attrs...)
+}
+
+// logRequests wraps next with a debug-level access log.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.logger == nil || !s.logger.Enabled(r.Context(), slog.LevelDebug) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.logger.LogAttrs(r.Context(), slog.LevelDebug, "http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.String("request_id", rec.Header().Get(requestIDHeader)),
+			slog.Duration("latency", time.Since(start)),
+		)
+	})
+}
+
+// statusRecorder captures the status code written through it. It passes
+// flushes and hijacks through so streaming and WebSocket handlers keep
+// working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("mpcserver: response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
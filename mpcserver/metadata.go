@@ -0,0 +1,69 @@
+package mpcserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"unicode/utf8"
+)
+
+// Limits on Request.Metadata: it labels calls, and is copied into every
+// log line and audit record about them, so it is kept small.
+const (
+	MaxMetadataEntries  = 32
+	MaxMetadataKeyLen   = 64
+	MaxMetadataValueLen = 256
+)
+
+// checkMetadata rejects request metadata over the limits.
+func checkMetadata(md map[string]string) *Error {
+	if len(md) > MaxMetadataEntries {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "%d metadata entries exceed the limit of %d", len(md), MaxMetadataEntries)
+	}
+	for k, v := range md {
+		switch {
+		case k == "":
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "metadata keys must not be empty")
+		case utf8.RuneCountInString(k) > MaxMetadataKeyLen:
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "metadata key %.16q… is longer than %d characters", k, MaxMetadataKeyLen)
+		case utf8.RuneCountInString(v) > MaxMetadataValueLen:
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "metadata %q is longer than %d characters", k, MaxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+type metadataKey struct{}
+
+// withMetadata returns ctx carrying the metadata of the call it serves,
+// for the logs and audit records written about it.
+func withMetadata(ctx context.Context, md map[string]string) context.Context {
+	if len(md) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+func metadataFrom(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// metadataAttr returns the metadata in ctx as a log group, sorted by key.
+func metadataAttr(ctx context.Context) (slog.Attr, bool) {
+	md := metadataFrom(ctx)
+	if len(md) == 0 {
+		return slog.Attr{}, false
+	}
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	attrs := make([]any, len(keys))
+	for i, k := range keys {
+		attrs[i] = slog.String(k, md[k])
+	}
+	return slog.Group("metadata", attrs...), true
+}
@@ -0,0 +1,100 @@
+package mpcserver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestMetadataRecorded(t *testing.T) {
+	sink := &memoryAuditSink{}
+	var logs bytes.Buffer
+	var seen []map[string]string
+	s := mpcserver.New(mpcserver.WithAuditLog(sink), mpcserver.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	s.Register("echo", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		seen = append(seen, req.Metadata)
+		return mpcserver.Response{Result: req.Prompt}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeGRPC(l)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	md := map[string]string{"team": "blue", "user": "ada"}
+	for _, opts := range [][]mpcclient.Option{nil, {mpcclient.WithGRPCTransport(cc)}} {
+		c, err := mpcclient.NewClient(ts.URL, append(opts, mpcclient.WithDefaultMetadata(map[string]string{"team": "blue"}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.CallAgent(context.Background(), "echo", "hi", mpcclient.WithMetadata(map[string]string{"user": "ada"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(seen) != 2 || !maps.Equal(seen[0], md) || !maps.Equal(seen[1], md) {
+		t.Errorf("agent saw metadata %v, want %v over HTTP and gRPC", seen, md)
+	}
+	if len(sink.records) != 2 || !maps.Equal(sink.records[0].Metadata, md) || !maps.Equal(sink.records[1].Metadata, md) {
+		t.Errorf("audit records = %+v, want metadata %v", sink.records, md)
+	}
+	if !strings.Contains(logs.String(), "metadata.team=blue metadata.user=ada") {
+		t.Errorf("log lacks the metadata:\n%s", logs.String())
+	}
+}
+
+func TestMetadataLimits(t *testing.T) {
+	sink := &memoryAuditSink{}
+	s := mpcserver.New(mpcserver.WithAuditLog(sink))
+	s.Register("echo", echoAgent{})
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	c, err := mpcclient.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooMany := make(map[string]string)
+	for i := range mpcserver.MaxMetadataEntries + 1 {
+		tooMany[fmt.Sprint("k", i)] = "v"
+	}
+	for _, md := range []map[string]string{
+		tooMany,
+		{"": "v"},
+		{strings.Repeat("k", mpcserver.MaxMetadataKeyLen+1): "v"},
+		{"k": strings.Repeat("v", mpcserver.MaxMetadataValueLen+1)},
+	} {
+		_, err := c.CallAgent(context.Background(), "echo", "hi", mpcclient.WithMetadata(md))
+		var apiErr *mpcclient.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != mpcserver.CodeInvalidRequest {
+			t.Errorf("metadata of %d entries: err = %v, want an invalid_request error", len(md), err)
+		}
+	}
+	for _, rec := range sink.records {
+		if rec.Metadata != nil {
+			t.Errorf("rejected metadata recorded: %v", rec.Metadata)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package mpcserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unknownAgent labels calls to names no agent is registered under, so
+// that clients probing for agents cannot grow the label set without bound.
+const unknownAgent = "unknown"
+
+// WithMetricsRegistry registers the server's metrics with reg and serves
+// reg at /metrics, so they can be published together with an
+// application's own. By default each server uses a registry of its own that
+// also holds the Go runtime and process collectors.
+func WithMetricsRegistry(reg *prometheus.Registry) Option {
+	return func(s *Server) {
+		if reg != nil {
+			s.metricsRegistry = reg
+		}
+	}
+}
+
+// metrics holds the server's Prometheus collectors.
+type metrics struct {
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+
+	calls        *prometheus.CounterVec
+	callDuration *prometheus.HistogramVec
+	callsActive  *prometheus.GaugeVec
+	callErrors   *prometheus.CounterVec
+	filterHits   *prometheus.CounterVec
+
+	streams *prometheus.GaugeVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mpcserver_http_requests_total",
+			Help: "HTTP requests served, by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mpcserver_http_request_duration_seconds",
+			Help:    "Latency of HTTP requests, by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mpcserver_http_requests_in_flight",
+			Help: "HTTP requests currently being served.",
+		}),
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mpcserver_agent_calls_total",
+			Help: "Agent calls over every transport, by agent and HTTP-equivalent status code.",
+		}, []string{"agent", "code"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mpcserver_agent_call_duration_seconds",
+			Help:    "Latency of agent calls, by agent.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"agent"}),
+		callsActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mpcserver_agent_calls_in_flight",
+			Help: "Agent calls currently running, by agent.",
+		}, []string{"agent"}),
+		callErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mpcserver_agent_errors_total",
+			Help: "Failed agent calls, by agent and error code.",
+		}, []string{"agent", "error_code"}),
+		filterHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mpcserver_filter_hits_total",
+			Help: "Response filter rules matched, by agent, rule and action.",
+		}, []string{"agent", "rule", "action"}),
+		streams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mpcserver_stream_connections",
+			Help: "Open streaming connections, by transport.",
+		}, []string{"transport"}),
+	}
+	reg.MustRegister(m.httpRequests, m.httpDuration, m.httpInFlight,
+		m.calls, m.callDuration, m.callsActive, m.callErrors, m.filterHits, m.streams)
+	return m
+}
+
+// startCall records the start of a call to agent and returns the function
+// recording its outcome.
+func (m *metrics) startCall(agent string) func(*Error) {
+	start := time.Now()
+	m.callsActive.WithLabelValues(agent).Inc()
+	return func(apiErr *Error) {
+		m.callsActive.WithLabelValues(agent).Dec()
+		m.callDuration.WithLabelValues(agent).Observe(time.Since(start).Seconds())
+		code := http.StatusOK
+		if apiErr != nil {
+			code = apiErr.Status
+			m.callErrors.WithLabelValues(agent, apiErr.Code).Inc()
+		}
+		m.calls.WithLabelValues(agent, strconv.Itoa(code)).Inc()
+	}
+}
+
+// openStream counts a streaming connection over transport until the
+// returned function is called.
+func (m *metrics) openStream(transport string) func() {
+	g := m.streams.WithLabelValues(transport)
+	g.Inc()
+	return g.Dec
+}
+
+// instrument wraps next with request counts, latencies and the in-flight
+// gauge. Requests are labelled by the route pattern they matched, not
+// their path, to keep agent names and IDs out of the HTTP labels.
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// defaultMetricsRegistry returns a registry holding the Go runtime and
+// process collectors.
+func defaultMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return reg
+}
+
+func (s *Server) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.metricsRegistry, promhttp.HandlerOpts{Registry: s.metricsRegistry})
+}
@@ -0,0 +1,75 @@
+package mpcserver_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := mpcserver.New()
+	s.Register("echo", echoAgent{})
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	c, _ := mpcclient.NewClient(ts.URL)
+	ctx := context.Background()
+
+	c.CallAgent(ctx, "echo", "hi")
+	c.CallAgent(ctx, "echo", "hi")
+	c.CallAgent(ctx, "echo", "crash")
+	c.CallAgent(ctx, "missing", "hi")
+
+	res, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	body := string(b)
+	for _, want := range []string{
+		`mpcserver_agent_calls_total{agent="echo",code="200"} 2`,
+		`mpcserver_agent_calls_total{agent="echo",code="500"} 1`,
+		`mpcserver_agent_errors_total{agent="echo",error_code="agent_error"} 1`,
+		`mpcserver_agent_call_duration_seconds_count{agent="echo"} 3`,
+		`mpcserver_agent_calls_in_flight{agent="echo"} 0`,
+		`mpcserver_http_requests_total{code="200",method="POST",route="POST /agent/{name}"} 2`,
+		`mpcserver_http_requests_total{code="404",method="POST",route="POST /agent/{name}"} 1`,
+		`mpcserver_http_requests_in_flight 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
+
+func TestMetricsStreamConnections(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, c := newWSTestServer(t, map[string]mpcserver.Agent{"echo": echoAgent{}}, mpcserver.WithMetricsRegistry(reg))
+	if _, err := c.CallAgent(context.Background(), "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "mpcserver_stream_connections" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if m.GetLabel()[0].GetValue() == "websocket" && m.GetGauge().GetValue() == 1 {
+				return
+			}
+		}
+	}
+	t.Error("no open websocket connection counted")
+}
@@ -0,0 +1,474 @@
+package mpcserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIPath is where the server publishes its OpenAPI document.
+const OpenAPIPath = "/openapi.json"
+
+// endpoint is one route of the HTTP API together with its documentation.
+// The table of endpoints both registers the routes and generates the
+// OpenAPI document, so one cannot drift from the other.
+type endpoint struct {
+	method, path string
+	handler      http.Handler
+	op           operation
+}
+
+// operation documents an endpoint as an OpenAPI operation.
+type operation struct {
+	id, summary, tag string
+	// public operations need no API key; admin ones need the admin key.
+	public, admin bool
+	// body is the zero value of the JSON request body, if any; multipart
+	// operations also accept it as multipart/form-data with attachments.
+	body      any
+	multipart bool
+	query     []queryParam
+	headers   []queryParam
+	responses []apiResponse
+}
+
+// queryParam documents a query parameter, or a header.
+type queryParam struct{ name, description string }
+
+// apiResponse documents one response of an operation. body is the zero
+// value of its JSON body, or a string for other content types.
+type apiResponse struct {
+	status      int
+	description string
+	body        any
+	contentType string
+}
+
+// endpoints lists the routes the server serves, in the order they are
+// documented.
+func (s *Server) endpoints() []endpoint {
+	pageParams := []queryParam{
+		{"limit", "Number of items per page, 100 by default and at most 1000"},
+		{"cursor", "The next_cursor of the previous page, to fetch the page after it"},
+	}
+	agentErrors := []apiResponse{
+		{status: http.StatusNotFound, description: "No agent of that name", body: errorBody{}},
+		{status: http.StatusBadRequest, description: "The request is invalid", body: errorBody{}},
+		{status: http.StatusTooManyRequests, description: "The agent or the API key is over its limits", body: errorBody{}},
+	}
+	eps := []endpoint{
+		{"POST", "/agent/{name}", http.HandlerFunc(s.handleAgent), operation{
+			id: "invokeAgent", summary: "Send a prompt to an agent", tag: "agents", body: Request{}, multipart: true,
+			headers: []queryParam{{IdempotencyKeyHeader, "Key of the call, repeated by its retries: a repeat gets the first response, with " + IdempotentReplayedHeader + ": true, instead of running the agent again"}},
+			responses: append([]apiResponse{
+				{status: http.StatusOK, description: "The agent's response", body: responseEnvelope{}},
+				{status: http.StatusUnprocessableEntity, description: "The idempotency key was used for a different request, or a content filter withheld the response", body: errorBody{}},
+			}, agentErrors...),
+		}},
+		{"POST", "/agent/{name}/stream", http.HandlerFunc(s.handleStream), operation{
+			id: "streamAgent", summary: "Send a prompt to an agent and stream the answer", tag: "agents", body: Request{}, multipart: true,
+			responses: append([]apiResponse{
+				{status: http.StatusOK, description: "Server-sent events: status updates while the agent works, \": keepalive\" comments while it is quiet, the result as a chunk event, then a done event, or an error event", body: "", contentType: "text/event-stream"},
+			}, agentErrors...),
+		}},
+		{"POST", "/agent/{name}/embed", http.HandlerFunc(s.handleEmbed), operation{
+			id: "embed", summary: "Compute embeddings with an agent", tag: "agents", body: embedRequest{},
+			responses: append([]apiResponse{
+				{status: http.StatusOK, description: "One vector per input", body: embedResponse{}},
+				{status: http.StatusNotImplemented, description: "The agent does not produce embeddings", body: errorBody{}},
+			}, agentErrors...),
+		}},
+		{"GET", "/agents", http.HandlerFunc(s.handleListAgents), operation{
+			id: "listAgents", summary: "List the registered agents", tag: "agents", query: pageParams,
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "A page of the agents, sorted by name", body: agentList{}},
+				{status: http.StatusBadRequest, description: "The limit or cursor is invalid", body: errorBody{}},
+			},
+		}},
+		{"GET", "/agents/{name}", http.HandlerFunc(s.handleDescribeAgent), operation{
+			id: "describeAgent", summary: "Describe an agent", tag: "agents",
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "The agent's metadata", body: AgentInfo{}},
+				agentErrors[0],
+			},
+		}},
+		{"POST", "/jobs/{name}", http.HandlerFunc(s.handleSubmitJob), operation{
+			id: "submitJob", summary: "Run an agent call in the background", tag: "jobs", body: Request{}, multipart: true,
+			headers:   []queryParam{{CallbackURLHeader, "URL to POST the job to, signed in " + CallbackSignatureHeader + ", once it finishes; the server must enable callbacks"}},
+			responses: append([]apiResponse{{status: http.StatusAccepted, description: "The job, pending", body: Job{}}}, agentErrors...),
+		}},
+		{"GET", "/jobs", http.HandlerFunc(s.handleListJobs), operation{
+			id: "listJobs", summary: "List the caller's jobs", tag: "jobs", query: pageParams,
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "A page of the jobs submitted with the caller's API key, the most recent first", body: jobList{}},
+				{status: http.StatusBadRequest, description: "The limit or cursor is invalid", body: errorBody{}},
+			},
+		}},
+		{"GET", "/jobs/{id}", http.HandlerFunc(s.handleGetJob), operation{
+			id: "getJob", summary: "Get a job", tag: "jobs",
+			query: []queryParam{{"wait", "Duration, such as 30s, to wait for the job to finish, at most a minute"}},
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "The job", body: Job{}},
+				{status: http.StatusNotFound, description: "No such job, it expired, or it belongs to another API key", body: errorBody{}},
+			},
+		}},
+		{"GET", "/context/{session}", http.HandlerFunc(s.handleGetBoard), operation{
+			id: "getBoard", summary: "Get the shared context board of a session", tag: "context",
+			responses: []apiResponse{{status: http.StatusOK, description: "The board's values, sorted by key; none for a board never written or expired", body: boardContents{}}},
+		}},
+		{"DELETE", "/context/{session}", http.HandlerFunc(s.handleClearBoard), operation{
+			id: "clearBoard", summary: "Remove every value from a board", tag: "context",
+			responses: []apiResponse{{status: http.StatusNoContent, description: "The board is empty"}},
+		}},
+		{"GET", "/context/{session}/{key}", http.HandlerFunc(s.handleGetBoardValue), operation{
+			id: "getBoardValue", summary: "Get a value from a board", tag: "context",
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "The value", body: BoardEntry{}},
+				{status: http.StatusNotFound, description: "The board holds no such key", body: errorBody{}},
+			},
+		}},
+		{"PUT", "/context/{session}/{key}", http.HandlerFunc(s.handlePutBoardValue), operation{
+			id: "putBoardValue", summary: "Write the JSON body to a board", tag: "context", body: json.RawMessage{},
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "The value as written", body: BoardEntry{}},
+				{status: http.StatusBadRequest, description: "The body is not JSON", body: errorBody{}},
+				{status: http.StatusConflict, description: "The board, or the server, holds as many entries as it may", body: errorBody{}},
+				{status: http.StatusRequestEntityTooLarge, description: "The value is over the size limit", body: errorBody{}},
+			},
+		}},
+		{"DELETE", "/context/{session}/{key}", http.HandlerFunc(s.handleDeleteBoardValue), operation{
+			id: "deleteBoardValue", summary: "Remove a value from a board", tag: "context",
+			responses: []apiResponse{{status: http.StatusNoContent, description: "The board no longer holds the key"}},
+		}},
+		{"GET", "/health", http.HandlerFunc(s.handleHealth), operation{
+			id: "health", summary: "Liveness probe", tag: "health", public: true,
+			responses: []apiResponse{{status: http.StatusOK, description: "The server is up", body: healthReport{}}},
+		}},
+		{"GET", "/healthz", http.HandlerFunc(s.handleHealth), operation{
+			id: "healthz", summary: "Liveness probe, as Kubernetes names it", tag: "health", public: true,
+			responses: []apiResponse{{status: http.StatusOK, description: "The server is up", body: healthReport{}}},
+		}},
+		{"GET", "/readyz", http.HandlerFunc(s.handleReady), operation{
+			id: "ready", summary: "Readiness probe, checking every agent", tag: "health", public: true,
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "Every agent is available", body: readinessReport{}},
+				{status: http.StatusServiceUnavailable, description: "An agent is unavailable, or the server is shutting down", body: readinessReport{}},
+			},
+		}},
+		{"GET", "/metrics", s.metricsHandler(), operation{
+			id: "metrics", summary: "Prometheus metrics", tag: "health", public: true,
+			responses: []apiResponse{{status: http.StatusOK, description: "Metrics in the Prometheus text format", body: "", contentType: "text/plain"}},
+		}},
+		{"GET", "/ws", http.HandlerFunc(s.handleWebSocket), operation{
+			id: "websocket", summary: "Open a WebSocket session for agent calls", tag: "agents",
+			query: []queryParam{
+				{"resume", "ID of a session to resume"},
+				{"last_seq", "Sequence number of the last message received, when resuming"},
+			},
+			responses: []apiResponse{{status: http.StatusSwitchingProtocols, description: "The WebSocket session"}},
+		}},
+		{"GET", OpenAPIPath, http.HandlerFunc(s.handleOpenAPI), operation{
+			id: "openapi", summary: "This document", tag: "health", public: true,
+			responses: []apiResponse{{status: http.StatusOK, description: "The OpenAPI document", body: map[string]any{}}},
+		}},
+	}
+	if s.keys != nil && s.keys.hasAdmin {
+		eps = append(eps,
+			endpoint{"GET", "/admin/keys", s.admin(s.handleListKeys), operation{
+				id: "listKeys", summary: "List the API keys, without their secrets", tag: "admin", admin: true,
+				responses: []apiResponse{{status: http.StatusOK, description: "The keys, sorted by name", body: keyList{}}},
+			}},
+			endpoint{"POST", "/admin/keys", s.admin(s.handleCreateKey), operation{
+				id: "createKey", summary: "Add an API key, generating its secret unless given", tag: "admin", admin: true, body: APIKey{},
+				responses: []apiResponse{
+					{status: http.StatusCreated, description: "The key, with its secret", body: keyInfo{}},
+					{status: http.StatusConflict, description: "A key of that name or secret exists", body: errorBody{}},
+				},
+			}},
+			endpoint{"DELETE", "/admin/keys/{name}", s.admin(s.handleDeleteKey), operation{
+				id: "deleteKey", summary: "Revoke an API key", tag: "admin", admin: true,
+				responses: []apiResponse{
+					{status: http.StatusNoContent, description: "The key was revoked"},
+					{status: http.StatusNotFound, description: "No key of that name", body: errorBody{}},
+				},
+			}},
+			endpoint{"GET", "/admin/schedules", s.admin(s.handleListSchedules), operation{
+				id: "listSchedules", summary: "List the schedules of recurring agent calls", tag: "admin", admin: true,
+				responses: []apiResponse{{status: http.StatusOK, description: "The schedules with the state of their runs, sorted by name", body: scheduleList{}}},
+			}},
+			endpoint{"POST", "/admin/schedules", s.admin(s.handleCreateSchedule), operation{
+				id: "createSchedule", summary: "Add a schedule running an agent call at recurring times", tag: "admin", admin: true, body: Schedule{},
+				responses: []apiResponse{
+					{status: http.StatusCreated, description: "The schedule, running", body: ScheduleStatus{}},
+					{status: http.StatusBadRequest, description: "The schedule is invalid", body: errorBody{}},
+					{status: http.StatusConflict, description: "A schedule of that name exists", body: errorBody{}},
+				},
+			}},
+			endpoint{"DELETE", "/admin/schedules/{name}", s.admin(s.handleDeleteSchedule), operation{
+				id: "deleteSchedule", summary: "Stop running a schedule", tag: "admin", admin: true,
+				responses: []apiResponse{
+					{status: http.StatusNoContent, description: "The schedule was removed; a run in progress finishes"},
+					{status: http.StatusNotFound, description: "No schedule of that name", body: errorBody{}},
+				},
+			}},
+		)
+		if s.configSource != nil {
+			eps = append(eps, endpoint{"POST", "/admin/reload", s.admin(s.handleReload), operation{
+				id: "reload", summary: "Reload the agent configuration without dropping calls in progress", tag: "admin", admin: true,
+				responses: []apiResponse{
+					{status: http.StatusOK, description: "The agents added, replaced and removed", body: ReloadReport{}},
+					{status: http.StatusUnprocessableEntity, description: "The configuration was rejected; nothing changed", body: errorBody{}},
+				},
+			}})
+		}
+	}
+	if s.parent != nil {
+		// Tenants share the metrics of the server they are mounted on.
+		eps = slices.DeleteFunc(eps, func(e endpoint) bool { return e.path == "/metrics" })
+	}
+	return eps
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.OpenAPI())
+}
+
+// OpenAPI returns the OpenAPI 3 document of the server's HTTP API, as
+// served at OpenAPIPath. Its schemas are derived from the types the server
+// encodes and decodes, and its operations from the routes it serves, so
+// that admin operations appear only with an admin key and security
+// requirements only with API keys.
+func (s *Server) OpenAPI() map[string]any {
+	g := &schemaGen{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	for _, e := range s.endpoints() {
+		if paths[e.path] == nil {
+			paths[e.path] = map[string]any{}
+		}
+		paths[e.path][strings.ToLower(e.method)] = g.operation(e, s.keys != nil)
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "MPC server",
+			"version":     s.version,
+			"description": "Routes prompts to the agents registered with the server.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"apiKey":      map[string]any{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+				"bearer":      map[string]any{"type": "http", "scheme": "bearer"},
+				"adminBearer": map[string]any{"type": "http", "scheme": "bearer", "description": "The admin key"},
+			},
+		},
+	}
+	if s.keys != nil {
+		doc["security"] = []any{map[string]any{"apiKey": []string{}}, map[string]any{"bearer": []string{}}}
+	}
+	return doc
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// operation builds the OpenAPI operation object of e.
+func (g *schemaGen) operation(e endpoint, keyed bool) map[string]any {
+	op := map[string]any{
+		"operationId": e.op.id,
+		"summary":     e.op.summary,
+		"tags":        []string{e.op.tag},
+	}
+	var params []any
+	for _, m := range pathParam.FindAllStringSubmatch(e.path, -1) {
+		params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+	}
+	for _, q := range e.op.query {
+		params = append(params, map[string]any{"name": q.name, "in": "query", "description": q.description, "schema": map[string]any{"type": "string"}})
+	}
+	for _, h := range e.op.headers {
+		params = append(params, map[string]any{"name": h.name, "in": "header", "description": h.description, "schema": map[string]any{"type": "string"}})
+	}
+	params = append(params, map[string]any{
+		"name": requestIDHeader, "in": "header", "description": "ID to follow the call by; one is assigned if absent",
+		"schema": map[string]any{"type": "string"},
+	})
+	op["parameters"] = params
+
+	if e.op.body != nil {
+		content := map[string]any{"application/json": map[string]any{"schema": g.ref(reflect.TypeOf(e.op.body))}}
+		if e.op.multipart {
+			content["multipart/form-data"] = map[string]any{"schema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					formFieldRequest:    map[string]any{"type": "string", "description": "The request as JSON"},
+					formFieldAttachment: map[string]any{"type": "array", "items": map[string]any{"type": "string", "format": "binary"}},
+				},
+				"required": []string{formFieldRequest},
+			}}
+		}
+		op["requestBody"] = map[string]any{"required": true, "content": content}
+	}
+
+	responses := map[string]any{}
+	for _, r := range e.op.responses {
+		resp := map[string]any{"description": r.description}
+		switch {
+		case r.contentType != "":
+			resp["content"] = map[string]any{r.contentType: map[string]any{"schema": map[string]any{"type": "string"}}}
+		case r.body != nil:
+			resp["content"] = map[string]any{"application/json": map[string]any{"schema": g.ref(reflect.TypeOf(r.body))}}
+		}
+		responses[strconv.Itoa(r.status)] = resp
+	}
+	responses["default"] = map[string]any{
+		"description": "An error",
+		"content":     map[string]any{"application/json": map[string]any{"schema": g.ref(reflect.TypeFor[errorBody]())}},
+	}
+	op["responses"] = responses
+
+	switch {
+	case e.op.public:
+		op["security"] = []any{}
+	case e.op.admin:
+		op["security"] = []any{map[string]any{"adminBearer": []string{}}}
+	case keyed:
+		responses[strconv.Itoa(http.StatusUnauthorized)] = map[string]any{
+			"description": "The API key is missing or invalid",
+			"content":     map[string]any{"application/json": map[string]any{"schema": g.ref(reflect.TypeFor[errorBody]())}},
+		}
+	}
+	return op
+}
+
+// schemaNames names the schemas of unexported types, and of exported ones
+// whose Go name would be ambiguous on the wire.
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeFor[Request]():          "AgentRequest",
+	reflect.TypeFor[responseEnvelope](): "AgentResponse",
+	reflect.TypeFor[errorBody]():        "Error",
+	reflect.TypeFor[embedRequest]():     "EmbedRequest",
+	reflect.TypeFor[embedResponse]():    "EmbedResponse",
+	reflect.TypeFor[agentList]():        "AgentList",
+	reflect.TypeFor[jobList]():          "JobList",
+	reflect.TypeFor[healthReport]():     "Health",
+	reflect.TypeFor[readinessReport]():  "Readiness",
+	reflect.TypeFor[keyList]():          "APIKeyList",
+	reflect.TypeFor[keyInfo]():          "APIKeyInfo",
+	reflect.TypeFor[boardContents]():    "Board",
+	reflect.TypeFor[scheduleList]():     "ScheduleList",
+}
+
+// schemaEnums lists the values of string types with a fixed set.
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeFor[JobStatus](): {string(JobPending), string(JobRunning), string(JobSucceeded), string(JobFailed)},
+	reflect.TypeFor[Priority]():  {string(PriorityInteractive), string(PriorityBatch)},
+}
+
+// schemaGen derives JSON schemas from Go types the way encoding/json
+// encodes them, collecting named structs as components.
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+// ref returns the schema of t, a reference for named structs.
+func (g *schemaGen) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType, t.Kind() == reflect.Interface:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if enum, ok := schemaEnums[t]; ok {
+			return map[string]any{"type": "string", "enum": enum}
+		}
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.ref(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // break cycles
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	panic(fmt.Sprintf("mpcserver: no OpenAPI schema for %v", t))
+}
+
+func schemaName(t reflect.Type) string {
+	if name, ok := schemaNames[t]; ok {
+		return name
+	}
+	if !token.IsExported(t.Name()) {
+		panic(fmt.Sprintf("mpcserver: unexported type %v needs an OpenAPI schema name", t))
+	}
+	return t.Name()
+}
+
+// object returns the schema of struct t, with the fields of embedded
+// structs inlined as encoding/json does.
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				add(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = g.ref(f.Type)
+			if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	obj := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
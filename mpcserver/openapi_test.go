@@ -0,0 +1,83 @@
+package mpcserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func getOpenAPI(t *testing.T, opts ...mpcserver.Option) map[string]any {
+	t.Helper()
+	_, anon := newTestServer(t, nil, opts...)
+	res, err := http.Get(anon.BaseURL() + mpcserver.OpenAPIPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", mpcserver.OpenAPIPath, res.StatusCode)
+	}
+	var doc map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPI(t *testing.T) {
+	doc := getOpenAPI(t)
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", doc["openapi"])
+	}
+	paths := doc["paths"].(map[string]any)
+	for path, method := range map[string]string{
+		"/agent/{name}":       "post",
+		"/agent/{name}/embed": "post",
+		"/agents":             "get",
+		"/jobs/{name}":        "post",
+		"/jobs/{id}":          "get",
+		"/healthz":            "get",
+		"/readyz":             "get",
+	} {
+		ops, ok := paths[path].(map[string]any)
+		if !ok || ops[method] == nil {
+			t.Errorf("document has no %s %s operation", method, path)
+		}
+	}
+	if _, ok := paths["/admin/keys"]; ok {
+		t.Error("admin operations documented without an admin key")
+	}
+	if _, ok := doc["security"]; ok {
+		t.Error("security required without API keys")
+	}
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	resp := schemas["AgentResponse"].(map[string]any)["properties"].(map[string]any)
+	for _, field := range []string{"agent", "result", "status", "request_id", "usage"} {
+		if resp[field] == nil {
+			t.Errorf("AgentResponse schema has no %s property", field)
+		}
+	}
+}
+
+func TestOpenAPIWithKeys(t *testing.T) {
+	// The document is served without a key, and describes the keys.
+	doc := getOpenAPI(t, mpcserver.WithAdminKey("root"), mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	if _, ok := doc["security"]; !ok {
+		t.Error("no security requirement with API keys")
+	}
+	paths := doc["paths"].(map[string]any)
+	admin, ok := paths["/admin/keys"].(map[string]any)
+	if !ok {
+		t.Fatal("admin operations not documented with an admin key")
+	}
+	post := admin["post"].(map[string]any)
+	if sec, _ := json.Marshal(post["security"]); string(sec) != `[{"adminBearer":[]}]` {
+		t.Errorf("admin security = %s", sec)
+	}
+	health := paths["/healthz"].(map[string]any)["get"].(map[string]any)
+	if sec, _ := json.Marshal(health["security"]); string(sec) != `[]` {
+		t.Errorf("health security = %s, want none", sec)
+	}
+}
@@ -0,0 +1,55 @@
+package mpcserver
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Page sizes of listings such as GET /agents and GET /jobs, which return
+// DefaultPageSize items unless asked for another number with ?limit=, and
+// never more than MaxPageSize.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// paginate returns the page of items that r asks for with ?limit= and
+// ?cursor=, and the cursor of the page after it, if any. Items are ordered
+// by key, which must be unique; the cursor is the key of a page's last
+// item, encoded so that clients treat it as opaque. Keyset cursors keep
+// pages from repeating or skipping items when others are added or removed
+// between requests.
+func paginate[T any](r *http.Request, items []T, key func(T) string) (page []T, next string, apiErr *Error) {
+	limit := DefaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, "", Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid limit %q", v)
+		}
+		limit = min(n, MaxPageSize)
+	}
+	items = slices.SortedFunc(slices.Values(items), func(a, b T) int {
+		return strings.Compare(key(a), key(b))
+	})
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		after, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return nil, "", Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid cursor %q", v)
+		}
+		i, found := slices.BinarySearchFunc(items, string(after), func(it T, k string) int {
+			return strings.Compare(key(it), k)
+		})
+		if found {
+			i++
+		}
+		items = items[i:]
+	}
+	if len(items) <= limit {
+		return items, "", nil
+	}
+	page = items[:limit]
+	return page, base64.RawURLEncoding.EncodeToString([]byte(key(page[limit-1]))), nil
+}
@@ -0,0 +1,105 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestListAgentsPaged(t *testing.T) {
+	s := mpcserver.New()
+	for _, name := range []string{"g", "c", "a", "f", "b", "e", "d"} {
+		s.Register(name, echoAgent{})
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/agents?limit=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page struct {
+		Agents     []mpcclient.AgentInfo `json:"agents"`
+		Count      int                   `json:"count"`
+		NextCursor string                `json:"next_cursor"`
+	}
+	json.NewDecoder(res.Body).Decode(&page)
+	res.Body.Close()
+	if page.Count != 3 || page.Agents[2].Name != "c" || page.NextCursor == "" {
+		t.Errorf("first page = %+v", page)
+	}
+
+	c, _ := mpcclient.NewClient(ts.URL)
+	var names []string
+	it := c.Agents(mpcclient.WithPageSize(2))
+	for it.Next(context.Background()) {
+		names = append(names, it.Item().Name)
+	}
+	if err := it.Err(); err != nil || strings.Join(names, "") != "abcdefg" {
+		t.Errorf("Agents = %v, %v", names, err)
+	}
+	all, err := c.ListAgents(context.Background(), mpcclient.WithPageSize(4))
+	if err != nil || len(all) != 7 {
+		t.Errorf("ListAgents = %d agents, %v", len(all), err)
+	}
+
+	for _, query := range []string{"limit=0", "limit=many", "cursor=%25%25"} {
+		res, err := http.Get(ts.URL + "/agents?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d", query, res.StatusCode)
+		}
+	}
+}
+
+func TestListJobsByOwner(t *testing.T) {
+	_, anon := newTestServer(t, nil, mpcserver.WithAPIKeys(
+		mpcserver.APIKey{Name: "ana", Key: "ana-secret"},
+		mpcserver.APIKey{Name: "ben", Key: "ben-secret"},
+	))
+	ana := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("ana-secret"))
+	ben := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("ben-secret"))
+	ctx := context.Background()
+
+	var submitted []string
+	for range 5 {
+		job, err := ana.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		submitted = append(submitted, job.ID)
+	}
+	if _, err := ben.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := ana.Jobs(mpcclient.WithPageSize(2)).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i, j := range jobs {
+		ids = append(ids, j.ID)
+		if j.Owner != "ana" || i > 0 && j.CreatedAt.After(jobs[i-1].CreatedAt) {
+			t.Errorf("job %d = %+v", i, j)
+		}
+	}
+	slices.Sort(ids)
+	slices.Sort(submitted)
+	if !slices.Equal(ids, submitted) {
+		t.Errorf("ana's jobs = %v, want %v", ids, submitted)
+	}
+	if jobs, err := ben.Jobs().All(ctx); err != nil || len(jobs) != 1 || jobs[0].Owner != "ben" {
+		t.Errorf("ben's jobs = %+v, %v", jobs, err)
+	}
+}
@@ -0,0 +1,204 @@
+package mpcserver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Parameter types an agent declares in ParameterInfo.Type. The server
+// checks parameters declared with these types before calling the agent and
+// rejects requests whose values do not fit; parameters of other types, or
+// not declared at all, are passed through unchecked.
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	// TypeDuration is a Go duration string such as "30m" or "24h".
+	TypeDuration = "duration"
+	// TypeTime is an RFC 3339 timestamp.
+	TypeTime = "time"
+	// TypeList is an array of strings or a comma-separated string.
+	TypeList = "list"
+)
+
+// ParamProblem describes one invalid parameter. A list of them is sent as
+// the details of the invalid_request error rejecting the request.
+type ParamProblem struct {
+	Parameter string `json:"parameter"`
+	Problem   string `json:"problem"`
+}
+
+// checkParameters validates params against the types declared in specs.
+// Required parameters are not enforced here, since agents may also read
+// them from the context or the prompt.
+func checkParameters(specs []ParameterInfo, params map[string]any) *Error {
+	var problems []ParamProblem
+	for _, spec := range specs {
+		v, ok := params[spec.Name]
+		if !ok || v == nil {
+			continue
+		}
+		if problem := checkType(spec.Type, v); problem != "" {
+			problems = append(problems, ParamProblem{Parameter: spec.Name, Problem: problem})
+		}
+	}
+	if problems == nil {
+		return nil
+	}
+	msgs := make([]string, len(problems))
+	for i, p := range problems {
+		msgs[i] = p.Parameter + ": " + p.Problem
+	}
+	e := Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid parameters: %s", strings.Join(msgs, "; "))
+	e.Details = problems
+	return e
+}
+
+// checkType returns why v is not a valid value of type typ, or "".
+func checkType(typ string, v any) string {
+	switch typ {
+	case TypeString:
+		if _, ok := v.(string); !ok {
+			return "must be a string"
+		}
+	case TypeInteger:
+		if f, ok := v.(float64); !ok || f != math.Trunc(f) {
+			return "must be an integer"
+		}
+	case TypeNumber:
+		if _, ok := v.(float64); !ok {
+			return "must be a number"
+		}
+	case TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			return "must be true or false"
+		}
+	case TypeDuration:
+		s, ok := v.(string)
+		if !ok {
+			return `must be a duration such as "30m"`
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return fmt.Sprintf(`%q is not a duration such as "30m"`, s)
+		}
+	case TypeTime:
+		s, ok := v.(string)
+		if !ok {
+			return "must be an RFC 3339 timestamp"
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return fmt.Sprintf("%q is not an RFC 3339 timestamp", s)
+		}
+	case TypeList:
+		switch v := v.(type) {
+		case string:
+		case []any:
+			for _, e := range v {
+				if _, ok := e.(string); !ok {
+					return "must be a list of strings"
+				}
+			}
+		default:
+			return "must be a list of strings"
+		}
+	}
+	return ""
+}
+
+// Param returns the value of a parameter, falling back to the request
+// context when the parameters lack it.
+func (r Request) Param(name string) (any, bool) {
+	for _, m := range []map[string]any{r.Parameters, r.Context} {
+		if v, ok := m[name]; ok && v != nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// StringParam returns the string form of a parameter, trimmed of spaces,
+// falling back to the request context. Lists are joined with commas. It
+// returns "" when the parameter is absent.
+func (r Request) StringParam(name string) string {
+	for _, m := range []map[string]any{r.Parameters, r.Context} {
+		switch v := m[name].(type) {
+		case string:
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		case []any:
+			return strings.Join(trimmed(anyStrings(v)), ",")
+		case nil:
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// ListParam returns the elements of a TypeList parameter, trimmed of
+// spaces, falling back to the request context.
+func (r Request) ListParam(name string) []string {
+	v, _ := r.Param(name)
+	switch v := v.(type) {
+	case string:
+		return trimmed(strings.Split(v, ","))
+	case []any:
+		return trimmed(anyStrings(v))
+	default:
+		return nil
+	}
+}
+
+func anyStrings(vs []any) []string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = fmt.Sprint(v)
+	}
+	return out
+}
+
+// trimmed returns ss trimmed of spaces, without empty elements.
+func trimmed(ss []string) []string {
+	var out []string
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// DurationParam returns a TypeDuration parameter, falling back to the
+// request context. It returns zero when the parameter is absent, and an
+// invalid_request *Error, which the agent can return as is, when it is not
+// a duration.
+func (r Request) DurationParam(name string) (time.Duration, error) {
+	s := r.StringParam(name)
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid %s %q", name, s)
+	}
+	return d, nil
+}
+
+// TimeParam returns a TypeTime parameter like DurationParam returns a
+// duration. The zero time means the parameter is absent.
+func (r Request) TimeParam(name string) (time.Time, error) {
+	s := r.StringParam(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, Errorf(http.StatusBadRequest, CodeInvalidRequest, "invalid %s %q", name, s)
+	}
+	return t, nil
+}
@@ -0,0 +1,100 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// typedAgent declares typed parameters and reports what it received.
+type typedAgent struct {
+	got chan mpcserver.Request
+}
+
+func (a typedAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	a.got <- req
+	return mpcserver.Response{Result: "ok"}, nil
+}
+
+func (typedAgent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{Parameters: []mpcserver.ParameterInfo{
+		{Name: "vm_name", Type: mpcserver.TypeString},
+		{Name: "metrics", Type: mpcserver.TypeList},
+		{Name: "timespan", Type: mpcserver.TypeDuration},
+		{Name: "start", Type: mpcserver.TypeTime},
+		{Name: "count", Type: mpcserver.TypeInteger},
+		{Name: "verbose", Type: mpcserver.TypeBoolean},
+	}}
+}
+
+func newTypedServer(t *testing.T) (*mpcclient.Client, chan mpcserver.Request) {
+	t.Helper()
+	got := make(chan mpcserver.Request, 1)
+	s := mpcserver.New()
+	if err := s.Register("vm", typedAgent{got: got}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	c, _ := mpcclient.NewClient(ts.URL)
+	return c, got
+}
+
+func TestTypedParametersReachAgent(t *testing.T) {
+	c, got := newTypedServer(t)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	_, err := c.CallAgent(context.Background(), "vm", "how is it doing?",
+		mpcclient.WithVM(" web01 "), mpcclient.WithMetrics("cpu", "disk"), mpcclient.WithLookback(2*time.Hour),
+		mpcclient.WithTimeRange(start, time.Time{}), mpcclient.WithParameter("count", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-got
+	if req.StringParam("vm_name") != "web01" || !slices.Equal(req.ListParam("metrics"), []string{"cpu", "disk"}) {
+		t.Errorf("vm %q, metrics %q", req.StringParam("vm_name"), req.ListParam("metrics"))
+	}
+	if d, err := req.DurationParam("timespan"); err != nil || d != 2*time.Hour {
+		t.Errorf("timespan = %v, %v", d, err)
+	}
+	if ts, err := req.TimeParam("start"); err != nil || !ts.Equal(start) {
+		t.Errorf("start = %v, %v", ts, err)
+	}
+	if d, err := req.DurationParam("missing"); err != nil || d != 0 {
+		t.Errorf("missing duration = %v, %v", d, err)
+	}
+}
+
+func TestInvalidParametersRejected(t *testing.T) {
+	c, got := newTypedServer(t)
+	_, err := c.CallAgent(context.Background(), "vm", "cpu?",
+		mpcclient.WithParameter("timespan", "a while"), mpcclient.WithParameter("count", 1.5),
+		mpcclient.WithParameter("verbose", "yes"), mpcclient.WithParameter("undeclared", 1))
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != mpcserver.CodeInvalidRequest {
+		t.Fatalf("err = %v, want invalid_request", err)
+	}
+	var problems []mpcserver.ParamProblem
+	if err := json.Unmarshal(apiErr.Details, &problems); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range problems {
+		names = append(names, p.Parameter)
+	}
+	if !slices.Equal(names, []string{"timespan", "count", "verbose"}) {
+		t.Errorf("problems = %+v", problems)
+	}
+	select {
+	case <-got:
+		t.Error("agent called with invalid parameters")
+	default:
+	}
+}
@@ -0,0 +1,222 @@
+package mpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"sync"
+)
+
+// Plugin builds an agent from its configuration section. Packages
+// providing agents register a Plugin from an init function, so that linking
+// them into a server binary, whether by import, by build tag or as a Go
+// plugin opened at run time, makes the agent available to LoadPlugins.
+type Plugin struct {
+	// Name is the name the agent is registered under and the key of its
+	// configuration section.
+	Name string
+	// New builds the agent from its section, which is empty when the
+	// configuration only names the plugin.
+	New func(cfg ConfigSection) (Agent, error)
+}
+
+var plugins = struct {
+	sync.Mutex
+	m map[string]Plugin
+}{m: make(map[string]Plugin)}
+
+// RegisterPlugin makes p available to LoadPlugins. It panics if p has no
+// name or constructor, or if a plugin of the same name is already
+// registered, and is meant to be called from init functions.
+func RegisterPlugin(p Plugin) {
+	if p.Name == "" || p.New == nil {
+		panic("mpcserver: RegisterPlugin needs a name and a constructor")
+	}
+	plugins.Lock()
+	defer plugins.Unlock()
+	if _, dup := plugins.m[p.Name]; dup {
+		panic(fmt.Sprintf("mpcserver: plugin %q registered twice", p.Name))
+	}
+	plugins.m[p.Name] = p
+}
+
+// Plugins returns the names of the registered plugins, sorted.
+func Plugins() []string {
+	plugins.Lock()
+	defer plugins.Unlock()
+	return slices.Sorted(maps.Keys(plugins.m))
+}
+
+// ErrUnknownPlugin is returned by LoadPlugins for a configuration section
+// naming no registered plugin.
+var ErrUnknownPlugin = errors.New("unknown plugin")
+
+// ConfigSection is the configuration of one agent, as decoded from a YAML
+// or JSON file. The "enabled" key is reserved: setting it to false keeps
+// the agent from being loaded.
+type ConfigSection map[string]any
+
+// Enabled reports whether the section leaves its agent enabled.
+func (c ConfigSection) Enabled() bool {
+	enabled, ok := c["enabled"].(bool)
+	return !ok || enabled
+}
+
+// Decode stores the section in v, a pointer to a struct with JSON tags.
+// Keys v has no field for are an error, so typos in configuration files
+// are caught at startup.
+func (c ConfigSection) Decode(v any) error {
+	fields := maps.Clone(c)
+	delete(fields, "enabled")
+	if fields == nil {
+		fields = ConfigSection{}
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+	return nil
+}
+
+// LoadPlugins builds and registers an agent for each enabled section of
+// configs, using the plugin of the same name. Plugins without a section
+// are not loaded. ReloadPlugins later applies changes to the sections.
+func (s *Server) LoadPlugins(configs map[string]ConfigSection) error {
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		cfg := configs[name]
+		if !cfg.Enabled() {
+			continue
+		}
+		a, err := s.buildPlugin(name, cfg)
+		if err != nil {
+			return err
+		}
+		if err := s.Register(name, a); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.loaded[name] = cfg
+		s.mu.Unlock()
+		if s.logger != nil {
+			s.logger.Info("agent plugin loaded", "agent", name)
+		}
+	}
+	return nil
+}
+
+// Starter is implemented by agents that acquire resources, such as
+// connections or background workers, before serving.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Stopper is implemented by agents that release resources on shutdown.
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// Start starts every registered agent that implements Starter, in name
+// order. If one fails, the agents already started are stopped again and
+// its error is returned. Agents registered once Start has returned are
+// not started. Shutdown stops the started agents that implement Stopper.
+func (s *Server) Start(ctx context.Context) error {
+	var started []string
+	for _, info := range s.registry.List() {
+		a, _, _ := s.registry.Lookup(info.Name)
+		if st, ok := a.(Starter); ok {
+			if err := guard(info.Name, "start", func() error { return st.Start(ctx) }); err != nil {
+				s.stop(ctx, started)
+				return err
+			}
+		}
+		started = append(started, info.Name)
+	}
+	if err := s.startTenants(ctx); err != nil {
+		s.stop(ctx, started)
+		return err
+	}
+	s.mu.Lock()
+	s.running = append(s.running, started...)
+	s.agentsStarted = true
+	s.mu.Unlock()
+	return nil
+}
+
+// stopAgents stops the agents Start started.
+func (s *Server) stopAgents(ctx context.Context) error {
+	s.mu.Lock()
+	running := s.running
+	s.running = nil
+	s.mu.Unlock()
+	return s.stop(ctx, running)
+}
+
+// stop stops the named agents in the reverse order of starting.
+func (s *Server) stop(ctx context.Context, names []string) error {
+	var errs []error
+	for _, name := range slices.Backward(names) {
+		a, _, _ := s.registry.Lookup(name)
+		if st, ok := a.(Stopper); ok {
+			errs = append(errs, guard(name, "stop", func() error { return st.Stop(ctx) }))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PanicError reports an agent that panicked. The server recovers the
+// panic, so one misbehaving agent cannot take the others down with it.
+type PanicError struct {
+	Agent string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("agent %q panicked: %v", e.Agent, e.Value)
+}
+
+// guard calls fn, turning a panic into a *PanicError.
+func guard(agent, op string, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("mpcserver: %s %q: %w", op, agent, &PanicError{Agent: agent, Value: v, Stack: debug.Stack()})
+		}
+	}()
+	if err := fn(); err != nil {
+		return fmt.Errorf("mpcserver: %s %q: %w", op, agent, err)
+	}
+	return nil
+}
+
+// handle calls a.Handle, recovering a panic into a 500 response. Panics in
+// goroutines the agent starts itself are beyond the server's reach.
+func (s *Server) handle(ctx context.Context, a Agent, req Request) (resp Response, err error) {
+	defer s.recoverAgent(ctx, req.Agent, req.RequestID, &err)
+	return a.Handle(ctx, req)
+}
+
+// recoverAgent, deferred around a call into an agent, recovers a panic and
+// reports it in *err as an internal error.
+func (s *Server) recoverAgent(ctx context.Context, agent, requestID string, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	perr := &PanicError{Agent: agent, Value: v, Stack: debug.Stack()}
+	if s.logger != nil {
+		s.logger.ErrorContext(ctx, "agent panicked", "agent", agent, "request_id", requestID,
+			"panic", fmt.Sprint(v), "stack", string(perr.Stack))
+	}
+	*err = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: perr.Error()}
+}
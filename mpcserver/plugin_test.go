@@ -0,0 +1,176 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// greeterConfig is the configuration section of the test plugin.
+type greeterConfig struct {
+	Greeting string `json:"greeting"`
+}
+
+func init() {
+	mpcserver.RegisterPlugin(mpcserver.Plugin{
+		Name: "test-greeter",
+		New: func(section mpcserver.ConfigSection) (mpcserver.Agent, error) {
+			cfg := greeterConfig{Greeting: "hello"}
+			if err := section.Decode(&cfg); err != nil {
+				return nil, err
+			}
+			return mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+				return mpcserver.Response{Result: cfg.Greeting + " " + req.Prompt}, nil
+			}), nil
+		},
+	})
+}
+
+func TestLoadPlugins(t *testing.T) {
+	if !slices.Contains(mpcserver.Plugins(), "test-greeter") {
+		t.Fatalf("Plugins() = %v, want test-greeter", mpcserver.Plugins())
+	}
+	s := mpcserver.New()
+	err := s.LoadPlugins(map[string]mpcserver.ConfigSection{"test-greeter": {"greeting": "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _, ok := s.Registry().Lookup("test-greeter")
+	if !ok {
+		t.Fatal("plugin agent not registered")
+	}
+	resp, err := a.Handle(context.Background(), mpcserver.Request{Prompt: "there"})
+	if err != nil || resp.Result != "hi there" {
+		t.Errorf("Handle = %q, %v, want %q", resp.Result, err, "hi there")
+	}
+}
+
+func TestLoadPluginsDisabled(t *testing.T) {
+	s := mpcserver.New()
+	err := s.LoadPlugins(map[string]mpcserver.ConfigSection{"test-greeter": {"enabled": false}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Registry().Len() != 0 {
+		t.Errorf("disabled plugin was loaded")
+	}
+}
+
+func TestLoadPluginsErrors(t *testing.T) {
+	s := mpcserver.New()
+	err := s.LoadPlugins(map[string]mpcserver.ConfigSection{"no-such-plugin": nil})
+	if !errors.Is(err, mpcserver.ErrUnknownPlugin) {
+		t.Errorf("unknown plugin: err = %v, want ErrUnknownPlugin", err)
+	}
+	err = s.LoadPlugins(map[string]mpcserver.ConfigSection{"test-greeter": {"greating": "typo"}})
+	if err == nil || !strings.Contains(err.Error(), "greating") {
+		t.Errorf("unknown key: err = %v, want it named", err)
+	}
+}
+
+// lifecycleAgent records its Start and Stop calls in log.
+type lifecycleAgent struct {
+	name     string
+	log      *[]string
+	startErr error
+}
+
+func (a lifecycleAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	return mpcserver.Response{}, nil
+}
+
+func (a lifecycleAgent) Start(ctx context.Context) error {
+	*a.log = append(*a.log, "start "+a.name)
+	return a.startErr
+}
+
+func (a lifecycleAgent) Stop(ctx context.Context) error {
+	*a.log = append(*a.log, "stop "+a.name)
+	return nil
+}
+
+func TestStartStop(t *testing.T) {
+	var log []string
+	s := mpcserver.New()
+	for _, name := range []string{"a", "b"} {
+		if err := s.Register(name, lifecycleAgent{name: name, log: &log}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start a", "start b", "stop b", "stop a"}
+	if !slices.Equal(log, want) {
+		t.Errorf("calls = %q, want %q", log, want)
+	}
+}
+
+func TestStartRollsBack(t *testing.T) {
+	var log []string
+	boom := errors.New("boom")
+	s := mpcserver.New()
+	_ = s.Register("a", lifecycleAgent{name: "a", log: &log})
+	_ = s.Register("b", lifecycleAgent{name: "b", log: &log, startErr: boom})
+	_ = s.Register("c", lifecycleAgent{name: "c", log: &log})
+	if err := s.Start(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("Start = %v, want boom", err)
+	}
+	want := []string{"start a", "start b", "stop a"}
+	if !slices.Equal(log, want) {
+		t.Errorf("calls = %q, want %q", log, want)
+	}
+}
+
+func TestStartRecoversPanic(t *testing.T) {
+	s := mpcserver.New()
+	_ = s.Register("bad", panicStarter{})
+	err := s.Start(context.Background())
+	var perr *mpcserver.PanicError
+	if !errors.As(err, &perr) || perr.Agent != "bad" {
+		t.Fatalf("Start = %v, want a PanicError for bad", err)
+	}
+}
+
+type panicStarter struct{}
+
+func (panicStarter) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	return mpcserver.Response{}, nil
+}
+
+func (panicStarter) Start(ctx context.Context) error { panic("no config") }
+
+func TestAgentPanicIsolated(t *testing.T) {
+	s := mpcserver.New()
+	_ = s.Register("bad", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		panic("nil map")
+	}))
+	_ = s.Register("good", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		return mpcserver.Response{Result: "ok"}, nil
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		agent string
+		want  int
+	}{{"bad", http.StatusInternalServerError}, {"good", http.StatusOK}, {"bad", http.StatusInternalServerError}} {
+		resp, err := http.Post(ts.URL+"/agent/"+tc.agent, "application/json", strings.NewReader(`{"prompt":"hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.agent, resp.StatusCode, tc.want)
+		}
+	}
+}
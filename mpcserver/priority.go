@@ -0,0 +1,39 @@
+package mpcserver
+
+import (
+	"context"
+	"net/http"
+)
+
+// Priority is the scheduling class of a call. Where an agent's
+// ConcurrencyLimit makes calls wait for a slot, interactive calls are
+// admitted ahead of batch ones.
+type Priority string
+
+// Priorities a request may ask for. Calls default to PriorityInteractive
+// and jobs to PriorityBatch.
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityBatch       Priority = "batch"
+)
+
+// checkPriority rejects priorities other than the ones defined.
+func checkPriority(p Priority) *Error {
+	switch p {
+	case "", PriorityInteractive, PriorityBatch:
+		return nil
+	}
+	return Errorf(http.StatusBadRequest, CodeInvalidRequest, "priority %q is not one of %s, %s", p, PriorityInteractive, PriorityBatch)
+}
+
+// fairKey names the caller of a call for sharing an agent's slots fairly:
+// its API key, or else its "user" metadata.
+func fairKey(ctx context.Context, md map[string]string) string {
+	if st := apiKeyFrom(ctx); st != nil {
+		return "key:" + st.Name
+	}
+	if user := md["user"]; user != "" {
+		return "user:" + user
+	}
+	return ""
+}
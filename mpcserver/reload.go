@@ -0,0 +1,192 @@
+package mpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+)
+
+// ErrNoConfigSource is returned by Reload on a server without a
+// ConfigSource.
+var ErrNoConfigSource = errors.New("no config source")
+
+// ConfigSource reads the agent configuration sections, for example from
+// the file they were first loaded from, each time the server reloads.
+type ConfigSource func(ctx context.Context) (map[string]ConfigSection, error)
+
+// WithConfigSource sets where Reload reads the agent configuration from.
+// With an admin key it also enables POST /admin/reload.
+func WithConfigSource(src ConfigSource) Option {
+	return func(s *Server) {
+		s.configSource = src
+	}
+}
+
+// ReloadReport lists the agents a reload changed, each sorted by name.
+type ReloadReport struct {
+	Added    []string `json:"added"`
+	Replaced []string `json:"replaced"`
+	Removed  []string `json:"removed"`
+}
+
+// Reload reads the configuration from the server's ConfigSource and
+// applies it with ReloadPlugins.
+func (s *Server) Reload(ctx context.Context) (ReloadReport, error) {
+	if s.configSource == nil {
+		return ReloadReport{}, fmt.Errorf("mpcserver: reload: %w", ErrNoConfigSource)
+	}
+	configs, err := s.configSource(ctx)
+	if err != nil {
+		return ReloadReport{}, fmt.Errorf("mpcserver: reload: %w", err)
+	}
+	return s.ReloadPlugins(ctx, configs)
+}
+
+// ReloadPlugins makes the agents loaded by LoadPlugins match configs: it
+// builds the agents of new and changed sections, and removes those of
+// sections dropped or disabled. Every agent is built, and started if the
+// server was, before any is swapped in, so a configuration with an
+// unknown plugin, a failing agent or a name taken by an agent registered
+// otherwise is rejected with nothing changed. Calls in progress finish on
+// the agents they started on; agents replaced or removed are stopped once
+// those calls are done, waiting at most until ctx is done before
+// returning. Agents of unchanged sections are kept as they are.
+func (s *Server) ReloadPlugins(ctx context.Context, configs map[string]ConfigSection) (ReloadReport, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.mu.Lock()
+	loaded, started := maps.Clone(s.loaded), s.agentsStarted
+	s.mu.Unlock()
+
+	report := ReloadReport{Added: []string{}, Replaced: []string{}, Removed: []string{}}
+	set := make(map[string]registration)
+	var built []string
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		cfg := configs[name]
+		if !cfg.Enabled() {
+			continue
+		}
+		old, wasLoaded := loaded[name]
+		if wasLoaded && reflect.DeepEqual(old, cfg) {
+			continue
+		}
+		if _, _, ok := s.registry.Lookup(name); ok && !wasLoaded {
+			return ReloadReport{}, fmt.Errorf("mpcserver: reload %q: %w", name, ErrDuplicateAgent)
+		}
+		a, err := s.buildPlugin(name, cfg)
+		if err != nil {
+			return ReloadReport{}, err
+		}
+		reg, err := newRegistration(name, a)
+		if err != nil {
+			return ReloadReport{}, err
+		}
+		set[name] = reg
+		built = append(built, name)
+		if wasLoaded {
+			report.Replaced = append(report.Replaced, name)
+		} else {
+			report.Added = append(report.Added, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(loaded)) {
+		if cfg, ok := configs[name]; !ok || !cfg.Enabled() {
+			report.Removed = append(report.Removed, name)
+		}
+	}
+
+	if started {
+		for i, name := range built {
+			st, ok := set[name].agent.(Starter)
+			if !ok {
+				continue
+			}
+			if err := guard(name, "start", func() error { return st.Start(ctx) }); err != nil {
+				for _, name := range slices.Backward(built[:i]) {
+					if sp, ok := set[name].agent.(Stopper); ok {
+						guard(name, "stop", func() error { return sp.Stop(ctx) })
+					}
+				}
+				return ReloadReport{}, err
+			}
+		}
+	}
+
+	changed := append(slices.Clone(report.Replaced), report.Removed...)
+	retired := s.registry.swap(set, report.Removed)
+	s.admission.forget(changed...)
+	s.mu.Lock()
+	for _, name := range report.Removed {
+		delete(s.loaded, name)
+	}
+	for _, name := range built {
+		s.loaded[name] = configs[name]
+	}
+	if started {
+		s.running = slices.DeleteFunc(s.running, func(name string) bool { return slices.Contains(changed, name) })
+		s.running = append(s.running, built...)
+	}
+	s.mu.Unlock()
+
+	for _, reg := range retired {
+		s.retire(ctx, reg, started)
+	}
+	if s.logger != nil {
+		s.logger.InfoContext(ctx, "agents reloaded", "added", report.Added, "replaced", report.Replaced, "removed", report.Removed)
+	}
+	return report, nil
+}
+
+// buildPlugin builds the agent of the named plugin from cfg.
+func (s *Server) buildPlugin(name string, cfg ConfigSection) (Agent, error) {
+	plugins.Lock()
+	p, ok := plugins.m[name]
+	plugins.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("mpcserver: load %q: %w", name, ErrUnknownPlugin)
+	}
+	var a Agent
+	err := guard(name, "load", func() (err error) {
+		a, err = p.New(cfg)
+		return err
+	})
+	return a, err
+}
+
+// retire stops an agent a reload took out of the registry once the calls
+// in progress on it are done. If ctx is done first, it leaves the agent to
+// be stopped in the background.
+func (s *Server) retire(ctx context.Context, reg registration, started bool) {
+	name := reg.info.Name
+	sp, ok := reg.agent.(Stopper)
+	if !ok || !started {
+		return
+	}
+	stop := func(ctx context.Context) {
+		if err := guard(name, "stop", func() error { return sp.Stop(ctx) }); err != nil && s.logger != nil {
+			s.logger.ErrorContext(ctx, "retired agent failed to stop", "agent", name, "error", err)
+		}
+	}
+	if reg.calls.wait(ctx) == nil {
+		stop(ctx)
+		return
+	}
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		reg.calls.wait(ctx)
+		stop(ctx)
+	}()
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Reload(r.Context())
+	if err != nil {
+		writeError(w, Errorf(http.StatusUnprocessableEntity, CodeInvalidConfig, "%v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
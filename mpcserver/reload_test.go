@@ -0,0 +1,212 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// versionedAgent replies with its version, holding calls prompted "wait"
+// until release is closed, and records when it is stopped.
+type versionedAgent struct {
+	version string
+	hold    *callHold
+}
+
+type callHold struct {
+	entered chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	stopped []string
+}
+
+func (a versionedAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	if req.Prompt == "wait" {
+		a.hold.entered <- struct{}{}
+		<-a.hold.release
+	}
+	return mpcserver.Response{Result: a.version}, nil
+}
+
+func (a versionedAgent) Stop(context.Context) error {
+	a.hold.mu.Lock()
+	defer a.hold.mu.Unlock()
+	a.hold.stopped = append(a.hold.stopped, a.version)
+	return nil
+}
+
+func (h *callHold) stops() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.stopped)
+}
+
+// hold is shared by the test-versioned agents of the running test.
+var hold *callHold
+
+func init() {
+	mpcserver.RegisterPlugin(mpcserver.Plugin{
+		Name: "test-versioned",
+		New: func(section mpcserver.ConfigSection) (mpcserver.Agent, error) {
+			var cfg struct {
+				Version string `json:"version"`
+			}
+			if err := section.Decode(&cfg); err != nil {
+				return nil, err
+			}
+			if cfg.Version == "" {
+				return nil, errors.New("version is required")
+			}
+			return versionedAgent{version: cfg.Version, hold: hold}, nil
+		},
+	})
+}
+
+// startVersioned loads the test-versioned plugin at v1 into s and starts
+// s, resetting hold for the test.
+func startVersioned(t *testing.T, s *mpcserver.Server) {
+	t.Helper()
+	hold = &callHold{entered: make(chan struct{}), release: make(chan struct{})}
+	if err := s.LoadPlugins(map[string]mpcserver.ConfigSection{"test-versioned": {"version": "v1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func callVersioned(t *testing.T, s *mpcserver.Server, prompt string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/agent/test-versioned", strings.NewReader(`{"prompt":"`+prompt+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer s3cret")
+	s.ServeHTTP(rec, req)
+	var body struct {
+		Result string `json:"result"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK {
+		return rec.Result().Status
+	}
+	return body.Result
+}
+
+func TestReloadKeepsCallsInProgress(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	startVersioned(t, s)
+	inFlight := make(chan string, 1)
+	go func() { inFlight <- callVersioned(t, s, "wait") }()
+	<-hold.entered
+
+	reloaded := make(chan mpcserver.ReloadReport, 1)
+	go func() {
+		report, err := s.ReloadPlugins(context.Background(), map[string]mpcserver.ConfigSection{
+			"test-versioned": {"version": "v2"},
+			"test-greeter":   {},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		reloaded <- report
+	}()
+	// The new agent answers while the old one finishes its call.
+	deadline := time.Now().Add(5 * time.Second)
+	for callVersioned(t, s, "hi") != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("reloaded agent never served")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stopped := hold.stops(); len(stopped) != 0 {
+		t.Errorf("agents stopped with a call in progress: %v", stopped)
+	}
+	close(hold.release)
+	if got := <-inFlight; got != "v1" {
+		t.Errorf("call in progress = %q, want it answered by v1", got)
+	}
+	report := <-reloaded
+	if !slices.Equal(report.Added, []string{"test-greeter"}) || !slices.Equal(report.Replaced, []string{"test-versioned"}) || len(report.Removed) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if stopped := hold.stops(); !slices.Equal(stopped, []string{"v1"}) {
+		t.Errorf("stopped %v, want the retired v1", stopped)
+	}
+
+	// Unchanged sections are kept as they are; dropped ones are removed.
+	report, err := s.ReloadPlugins(context.Background(), map[string]mpcserver.ConfigSection{"test-versioned": {"version": "v2"}})
+	if err != nil || len(report.Added)+len(report.Replaced) != 0 || !slices.Equal(report.Removed, []string{"test-greeter"}) {
+		t.Errorf("report = %+v, %v", report, err)
+	}
+	if _, _, ok := s.Registry().Lookup("test-greeter"); ok {
+		t.Error("removed agent still registered")
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stopped := hold.stops(); !slices.Equal(stopped, []string{"v1", "v2"}) {
+		t.Errorf("stopped %v after shutdown", stopped)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	startVersioned(t, s)
+	for name, configs := range map[string]map[string]mpcserver.ConfigSection{
+		"unknown plugin": {"test-versioned": {"version": "v2"}, "no-such-plugin": {}},
+		"build error":    {"test-versioned": {"version": ""}},
+		"unknown key":    {"test-versioned": {"version": "v2", "verison": "typo"}},
+		"taken name":     {"test-versioned": {"version": "v2"}, "echo": {}},
+	} {
+		if _, err := s.ReloadPlugins(context.Background(), configs); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+		if got := callVersioned(t, s, "hi"); got != "v1" {
+			t.Errorf("%s: agent answered %q after a rejected reload", name, got)
+		}
+	}
+	if stopped := hold.stops(); len(stopped) != 0 {
+		t.Errorf("rejected reloads stopped %v", stopped)
+	}
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	version := "v2"
+	s, _ := newTestServer(t, nil, mpcserver.WithAdminKey("root"), mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}), mpcserver.WithConfigSource(func(context.Context) (map[string]mpcserver.ConfigSection, error) {
+		return map[string]mpcserver.ConfigSection{"test-versioned": {"version": version}}, nil
+	}))
+	startVersioned(t, s)
+	reload := func(key string) (int, string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		s.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	if code, _ := reload("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("reload without the admin key: %d", code)
+	}
+	if code, body := reload("root"); code != http.StatusOK || !strings.Contains(body, `"replaced":["test-versioned"]`) {
+		t.Errorf("reload: %d %s", code, body)
+	}
+	if got := callVersioned(t, s, "hi"); got != "v2" {
+		t.Errorf("after reload: %q", got)
+	}
+	version = ""
+	if code, body := reload("root"); code != http.StatusUnprocessableEntity || !strings.Contains(body, mpcserver.CodeInvalidConfig) {
+		t.Errorf("invalid reload: %d %s", code, body)
+	}
+
+	if _, err := mpcserver.New().Reload(context.Background()); !errors.Is(err, mpcserver.ErrNoConfigSource) {
+		t.Errorf("Reload without a source: err = %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package mpcserver
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version of the request and response envelope the
+// server speaks. It is advertised in every AgentInfo and response, and
+// grows when fields are added that change how a call is handled, so that
+// callers relying on them can require it in Requirements.ProtocolVersion.
+const ProtocolVersion = 1
+
+// Capabilities agents declare in AgentInfo.Capabilities for features of
+// the protocol, which calls can require. The server lists
+// CapabilityStreaming for every agent, as it streams any of them.
+const (
+	CapabilityStreaming   = "streaming"
+	CapabilityTools       = "tools"
+	CapabilityAttachments = "attachments"
+)
+
+// Requirements are what a call needs of its agent and server. The server
+// checks them before the agent is called, rejecting a call they do not
+// hold for with CodeIncompatibleAgent, so that an older agent or one
+// lacking a feature fails it instead of quietly ignoring what it does not
+// support.
+type Requirements struct {
+	// ProtocolVersion is the lowest ProtocolVersion the server may speak.
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// MinVersion is the lowest AgentInfo.Version the agent may have,
+	// compared as a semantic version such as "1.2.0" or "v1.2".
+	MinVersion string `json:"min_version,omitempty"`
+	// Capabilities lists what the agent must declare in
+	// AgentInfo.Capabilities, such as CapabilityTools.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// incompatibility is the "details" field of a CodeIncompatibleAgent error,
+// describing the agent the call was refused by.
+type incompatibility struct {
+	AgentVersion        string   `json:"agent_version,omitempty"`
+	ProtocolVersion     int      `json:"protocol_version"`
+	MissingCapabilities []string `json:"missing_capabilities,omitempty"`
+}
+
+// checkRequirements rejects a call requiring more than the server and the
+// agent described by info provide.
+func checkRequirements(info AgentInfo, r *Requirements) *Error {
+	if r == nil {
+		return nil
+	}
+	incompatible := func(missing []string, format string, args ...any) *Error {
+		e := Errorf(http.StatusPreconditionFailed, CodeIncompatibleAgent, format, args...)
+		e.Details = incompatibility{AgentVersion: info.Version, ProtocolVersion: ProtocolVersion, MissingCapabilities: missing}
+		return e
+	}
+	if r.ProtocolVersion < 0 {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "requires.protocol_version must not be negative")
+	}
+	if r.ProtocolVersion > ProtocolVersion {
+		return incompatible(nil, "the call requires protocol version %d; the server speaks %d", r.ProtocolVersion, ProtocolVersion)
+	}
+	if r.MinVersion != "" {
+		want, ok := parseVersion(r.MinVersion)
+		if !ok {
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "requires.min_version %q is not a version such as 1.2.0", r.MinVersion)
+		}
+		have, ok := parseVersion(info.Version)
+		switch {
+		case info.Version == "":
+			return incompatible(nil, "agent %q reports no version; the call requires %s or later", info.Name, r.MinVersion)
+		case !ok:
+			return incompatible(nil, "agent %q has version %q, which cannot be compared with %s", info.Name, info.Version, r.MinVersion)
+		case have.compare(want) < 0:
+			return incompatible(nil, "agent %q is version %s; the call requires %s or later", info.Name, info.Version, r.MinVersion)
+		}
+	}
+	var missing []string
+	for _, c := range r.Capabilities {
+		if !slices.Contains(info.Capabilities, c) && !slices.Contains(missing, c) {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return incompatible(missing, "agent %q lacks %s, which the call requires", info.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// version is a parsed semantic version. Missing minor and patch numbers
+// are zero; build metadata is ignored.
+type version struct {
+	nums [3]int
+	pre  string
+}
+
+// parseVersion parses "1", "1.2", "1.2.3" and "1.2.3-rc.1", each with an
+// optional leading "v".
+func parseVersion(s string) (version, bool) {
+	var v version
+	s, _, _ = strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	s, v.pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > len(v.nums) {
+		return version{}, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p != strconv.Itoa(n) {
+			return version{}, false
+		}
+		v.nums[i] = n
+	}
+	return v, true
+}
+
+// compare returns -1, 0 or +1 as v is older than, the same as or newer
+// than w. A pre-release is older than its release.
+func (v version) compare(w version) int {
+	if c := slices.Compare(v.nums[:], w.nums[:]); c != 0 {
+		return c
+	}
+	switch {
+	case v.pre == w.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case w.pre == "":
+		return -1
+	}
+	return strings.Compare(v.pre, w.pre)
+}
@@ -0,0 +1,105 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// toolAgent reports a version and the tools capability, and counts the
+// calls it gets.
+type toolAgent struct {
+	version string
+	calls   *atomic.Int32
+}
+
+func (a toolAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	a.calls.Add(1)
+	return mpcserver.Response{Result: "ok"}, nil
+}
+
+func (a toolAgent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{Version: a.version, Capabilities: []string{mpcserver.CapabilityTools}}
+}
+
+func TestRequirements(t *testing.T) {
+	var calls atomic.Int32
+	s := mpcserver.New()
+	s.Register("planner", toolAgent{version: "1.4.2", calls: &calls})
+	s.Register("echo", echoAgent{})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := newKeyClient(t, ts.URL, mpcclient.WithRetryPolicy(mpcclient.RetryPolicy{MaxAttempts: 1}))
+	ctx := context.Background()
+
+	info, err := c.DescribeAgent(ctx, "planner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.4.2" || info.ProtocolVersion != mpcserver.ProtocolVersion ||
+		!slices.Equal(info.Capabilities, []string{mpcclient.CapabilityTools, mpcclient.CapabilityStreaming}) {
+		t.Errorf("info = %+v", info)
+	}
+
+	for _, v := range []string{"1", "1.4", "v1.4.2", "1.4.2-rc.1"} {
+		resp, err := c.CallAgent(ctx, "planner", "hi", mpcclient.WithMinAgentVersion(v),
+			mpcclient.WithRequiredCapabilities(mpcclient.CapabilityTools, mpcclient.CapabilityStreaming))
+		if err != nil {
+			t.Fatalf("min version %s: %v", v, err)
+		}
+		if resp.AgentVersion != "1.4.2" || resp.ProtocolVersion != mpcserver.ProtocolVersion {
+			t.Errorf("response versions = %q, %d", resp.AgentVersion, resp.ProtocolVersion)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		agent   string
+		req     mpcclient.Requirements
+		want    string
+		missing []string
+	}{
+		{"newer patch", "planner", mpcclient.Requirements{MinVersion: "1.4.3"}, `agent "planner" is version 1.4.2; the call requires 1.4.3 or later`, nil},
+		{"newer major", "planner", mpcclient.Requirements{MinVersion: "2"}, "requires 2 or later", nil},
+		{"unversioned", "echo", mpcclient.Requirements{MinVersion: "1.0.0"}, `agent "echo" reports no version`, nil},
+		{"capabilities", "echo", mpcclient.Requirements{Capabilities: []string{"tools", "attachments", "tools"}}, `agent "echo" lacks tools, attachments`, []string{"tools", "attachments"}},
+		{"protocol", "echo", mpcclient.Requirements{ProtocolVersion: mpcserver.ProtocolVersion + 1}, "requires protocol version 2; the server speaks 1", nil},
+	} {
+		_, err := c.Invoke(ctx, tt.agent, mpcclient.AgentRequest{Prompt: "hi", Requires: &tt.req})
+		var apiErr *mpcclient.APIError
+		if !errors.Is(err, mpcclient.ErrIncompatibleAgent) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusPreconditionFailed ||
+			!strings.Contains(err.Error(), tt.want) || mpcclient.Retryable(err) || errors.Is(err, mpcclient.ErrInvalidRequest) {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		var details struct {
+			ProtocolVersion     int      `json:"protocol_version"`
+			MissingCapabilities []string `json:"missing_capabilities"`
+		}
+		if err := json.Unmarshal(apiErr.Details, &details); err != nil || details.ProtocolVersion != mpcserver.ProtocolVersion ||
+			!slices.Equal(details.MissingCapabilities, tt.missing) {
+			t.Errorf("%s: details = %s", tt.name, apiErr.Details)
+		}
+	}
+
+	_, err = c.CallAgent(ctx, "planner", "hi", mpcclient.WithMinAgentVersion("latest"))
+	wantAPIError(t, err, http.StatusBadRequest, mpcserver.CodeInvalidRequest)
+
+	// A stream is refused before it starts.
+	err = c.StreamAgent(ctx, "planner", "hi", func(mpcclient.Chunk) error { return nil }, mpcclient.WithMinAgentVersion("1.5"))
+	if !errors.Is(err, mpcclient.ErrIncompatibleAgent) {
+		t.Errorf("stream: err = %v", err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("agent called %d times, want 4", n)
+	}
+}
@@ -0,0 +1,504 @@
+package mpcserver
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule runs an agent call at recurring times, such as a summary of VM
+// metrics every hour. Each run is a job, kept in the server's JobStore
+// with its Schedule field naming the schedule, and, with a WebhookURL,
+// POSTed there once finished as job callbacks are.
+type Schedule struct {
+	// Name identifies the schedule: up to 63 letters, digits, - and _.
+	Name  string `json:"name"`
+	Agent string `json:"agent"`
+	// Spec says when the schedule runs, in UTC: a cron expression of five
+	// fields, minute, hour, day of month, month and day of week, such as
+	// "*/15 8-18 * * mon-fri"; one of @hourly, @daily, @weekly, @monthly
+	// and @yearly; or "@every " and a duration, such as "@every 10m",
+	// counted from when the schedule was added.
+	Spec string `json:"spec"`
+	// Request is the call each run makes. Its priority defaults to batch.
+	Request Request `json:"request"`
+	// Jitter, a duration such as "30s", delays each run by a random time
+	// up to it, so that schedules due at the same time do not all call
+	// their agents at once.
+	Jitter string `json:"jitter,omitempty"`
+	// WebhookURL is where each finished run is POSTed, signed as job
+	// callbacks are. It needs WithJobCallbacks.
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// Owner names the API key the runs are made with, which servers
+	// requiring keys need: the key's agents and quota apply to them, and
+	// GET /jobs lists them to it.
+	Owner string `json:"owner,omitempty"`
+}
+
+// ScheduleStatus is a schedule together with the state of its runs, as
+// GET /admin/schedules lists it.
+type ScheduleStatus struct {
+	Schedule
+	// NextRun is when the schedule is next due, before jitter.
+	NextRun time.Time `json:"next_run,omitzero"`
+	// LastRun is when the last run started, and LastJob its job ID.
+	LastRun time.Time `json:"last_run,omitzero"`
+	LastJob string    `json:"last_job,omitempty"`
+	// Running reports whether the last run is still running.
+	Running bool `json:"running"`
+	// Skipped counts the runs skipped because the one before was still
+	// running.
+	Skipped int `json:"skipped"`
+}
+
+// scheduleList is the body of a schedule listing.
+type scheduleList struct {
+	Schedules []ScheduleStatus `json:"schedules"`
+	Count     int              `json:"count"`
+}
+
+var scheduleName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+// WithSchedules runs schedules from the start. It panics on an invalid
+// schedule, which Schedule.Validate would have reported.
+func WithSchedules(schedules ...Schedule) Option {
+	return func(s *Server) {
+		s.schedules.initial = append(s.schedules.initial, schedules...)
+	}
+}
+
+// Validate reports whether sc is a schedule a server can run, leaving
+// what depends on the server, its job callbacks and API keys, to
+// AddSchedule.
+func (sc Schedule) Validate() error {
+	if _, _, err := sc.parse(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parse returns the times sc runs at and its jitter.
+func (sc Schedule) parse() (cronSpec, time.Duration, *Error) {
+	invalid := func(format string, args ...any) (cronSpec, time.Duration, *Error) {
+		return cronSpec{}, 0, Errorf(http.StatusBadRequest, CodeInvalidRequest, "schedule %q: "+format, append([]any{sc.Name}, args...)...)
+	}
+	if !scheduleName.MatchString(sc.Name) {
+		return invalid("invalid name: use up to 63 letters, digits, - and _")
+	}
+	if sc.Agent == "" {
+		return invalid("agent is required")
+	}
+	spec, err := parseSpec(sc.Spec)
+	if err != nil {
+		return invalid("spec %q: %v", sc.Spec, err)
+	}
+	var jitter time.Duration
+	if sc.Jitter != "" {
+		if jitter, err = time.ParseDuration(sc.Jitter); err != nil || jitter < 0 {
+			return invalid("invalid jitter %q", sc.Jitter)
+		}
+	}
+	if sc.WebhookURL != "" {
+		u, err := url.Parse(sc.WebhookURL)
+		if err != nil || len(sc.WebhookURL) > maxCallbackURLLen || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			return invalid("invalid webhook_url %q: want an absolute http or https URL", sc.WebhookURL)
+		}
+	}
+	return spec, jitter, nil
+}
+
+// scheduler runs the schedules of a server, each in a goroutine of its own
+// until it is removed or the server shuts down.
+type scheduler struct {
+	// initial are the schedules of WithSchedules, added by New.
+	initial []Schedule
+
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+}
+
+// scheduleEntry is a schedule being run. Its state is guarded by the
+// scheduler's mu.
+type scheduleEntry struct {
+	sched  Schedule
+	spec   cronSpec
+	jitter time.Duration
+	stop   context.CancelFunc
+
+	next, lastRun time.Time
+	lastJob       string
+	running       bool
+	skipped       int
+}
+
+func (e *scheduleEntry) status() ScheduleStatus {
+	return ScheduleStatus{Schedule: e.sched, NextRun: e.next, LastRun: e.lastRun, LastJob: e.lastJob, Running: e.running, Skipped: e.skipped}
+}
+
+// AddSchedule starts running sc. It fails if sc is invalid, names a
+// WebhookURL without WithJobCallbacks, or has the name of a schedule the
+// server already runs.
+func (s *Server) AddSchedule(sc Schedule) error {
+	if err := s.addSchedule(sc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) addSchedule(sc Schedule) *Error {
+	spec, jitter, apiErr := sc.parse()
+	if apiErr != nil {
+		return apiErr
+	}
+	if sc.WebhookURL != "" && s.jobs.callbacks == nil {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "schedule %q: webhooks need job callbacks, which are not enabled on this server", sc.Name)
+	}
+	switch {
+	case s.keys == nil && sc.Owner != "":
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "schedule %q: owner needs API keys, which are not enabled on this server", sc.Name)
+	case s.keys != nil && sc.Owner == "":
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "schedule %q: owner is required on servers requiring API keys", sc.Name)
+	case s.keys != nil && s.keys.named(sc.Owner) == nil:
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "schedule %q: API key %q not found", sc.Name, sc.Owner)
+	}
+	sch := &s.schedules
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	if _, ok := sch.entries[sc.Name]; ok {
+		return Errorf(http.StatusConflict, CodeScheduleExists, "schedule %q exists", sc.Name)
+	}
+	if sch.entries == nil {
+		sch.entries = make(map[string]*scheduleEntry)
+	}
+	ctx, stop := context.WithCancel(s.jobs.ctx)
+	e := &scheduleEntry{sched: sc, spec: spec, jitter: jitter, stop: stop}
+	e.next = spec.next(time.Now())
+	sch.entries[sc.Name] = e
+	go s.runSchedule(ctx, e)
+	return nil
+}
+
+// RemoveSchedule stops running the schedule called name, leaving a run in
+// progress to finish, and reports whether there was one.
+func (s *Server) RemoveSchedule(name string) bool {
+	sch := &s.schedules
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	e, ok := sch.entries[name]
+	if ok {
+		e.stop()
+		delete(sch.entries, name)
+	}
+	return ok
+}
+
+// Schedules returns the schedules the server runs, sorted by name.
+func (s *Server) Schedules() []ScheduleStatus {
+	sch := &s.schedules
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	list := make([]ScheduleStatus, 0, len(sch.entries))
+	for _, e := range sch.entries {
+		list = append(list, e.status())
+	}
+	slices.SortFunc(list, func(a, b ScheduleStatus) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// runSchedule runs e each time it is due until ctx is done.
+func (s *Server) runSchedule(ctx context.Context, e *scheduleEntry) {
+	sch := &s.schedules
+	for {
+		sch.mu.Lock()
+		at := e.next
+		sch.mu.Unlock()
+		if at.IsZero() {
+			return
+		}
+		delay := time.Until(at)
+		if e.jitter > 0 {
+			delay += rand.N(e.jitter)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		sch.mu.Lock()
+		// Count from the time due, so that jitter does not accumulate,
+		// but skip the times missed while the host was suspended.
+		e.next = e.spec.next(at)
+		if now := time.Now(); e.next.Before(now) {
+			e.next = e.spec.next(now)
+		}
+		sch.mu.Unlock()
+		s.fireSchedule(ctx, e)
+	}
+}
+
+// fireSchedule starts a run of e as a job, unless the previous run is
+// still running.
+func (s *Server) fireSchedule(ctx context.Context, e *scheduleEntry) {
+	if s.stopping.Load() || ctx.Err() != nil {
+		return
+	}
+	sc := e.sched
+	sch := &s.schedules
+	sch.mu.Lock()
+	if e.running {
+		e.skipped++
+		sch.mu.Unlock()
+		if s.logger != nil {
+			s.logger.Warn("schedule run skipped: the previous run is still running", "schedule", sc.Name, "agent", sc.Agent, "job", e.lastJob)
+		}
+		return
+	}
+	now := time.Now().UTC()
+	job := Job{ID: newRequestID(), Agent: sc.Agent, Status: JobPending, CreatedAt: now, UpdatedAt: now, CallbackURL: sc.WebhookURL, Owner: sc.Owner, Schedule: sc.Name}
+	e.running, e.lastRun, e.lastJob = true, now, job.ID
+	sch.mu.Unlock()
+
+	req := sc.Request
+	req.RequestID = job.ID
+	if req.Priority == "" {
+		req.Priority = PriorityBatch
+	}
+	if err := s.jobs.store.Put(ctx, job); err != nil {
+		s.logJobError(job, err)
+		sch.mu.Lock()
+		e.running = false
+		sch.mu.Unlock()
+		return
+	}
+	// A key revoked since the schedule was added fails the run.
+	var key *keyState
+	if s.keys != nil {
+		key = s.keys.named(sc.Owner)
+	}
+	s.jobs.track(job.ID)
+	s.calls.add()
+	go func() {
+		s.runJob(key, job, req)
+		sch.mu.Lock()
+		e.running = false
+		sch.mu.Unlock()
+	}()
+}
+
+func (s *Server) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	list := s.Schedules()
+	writeJSON(w, http.StatusOK, scheduleList{Schedules: list, Count: len(list)})
+}
+
+func (s *Server) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	if _, apiErr := checkContentType(r, "application/json"); apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	var sc Schedule
+	if apiErr := s.decodeJSON(w, r, &sc); apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if apiErr := s.addSchedule(sc); apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	for _, st := range s.Schedules() {
+		if st.Name == sc.Name {
+			w.Header().Set("Location", "/admin/schedules/"+sc.Name)
+			writeJSON(w, http.StatusCreated, st)
+			return
+		}
+	}
+	// Removed again in the meantime.
+	writeError(w, Errorf(http.StatusNotFound, CodeScheduleNotFound, "schedule %q not found", sc.Name))
+}
+
+func (s *Server) handleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.RemoveSchedule(name) {
+		writeError(w, Errorf(http.StatusNotFound, CodeScheduleNotFound, "schedule %q not found", name))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cronSpec is a parsed Schedule.Spec: either the minutes, hours, days of
+// the month, months and days of the week it is due at, as bit sets, or
+// the interval of an "@every" spec.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day of the month or of the week: a
+	// spec restricting both is due on days matching either.
+	domAny, dowAny bool
+	every          time.Duration
+}
+
+// specAliases are the cron expressions of the spec descriptors.
+var specAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the range and, for months and days of the week, the names
+// of a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// parseSpec parses a Schedule.Spec.
+func parseSpec(spec string) (cronSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every <= 0 {
+			return cronSpec{}, fmt.Errorf("want a positive duration after @every")
+		}
+		return cronSpec{every: every}, nil
+	}
+	if expr, ok := specAliases[strings.ToLower(spec)]; ok {
+		spec = expr
+	} else if strings.HasPrefix(spec, "@") {
+		return cronSpec{}, fmt.Errorf("unknown descriptor")
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return cronSpec{}, fmt.Errorf("want 5 fields: minute, hour, day of month, month and day of week")
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := cronFields[i].parse(f)
+		if err != nil {
+			return cronSpec{}, err
+		}
+		sets[i] = set
+	}
+	c := cronSpec{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4], domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	if c.next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return cronSpec{}, fmt.Errorf("never due")
+	}
+	return c, nil
+}
+
+// parse parses a comma-separated list of "*", values and ranges, each
+// with an optional "/step", into a bit set of the values.
+func (f cronField) parse(s string) (uint64, error) {
+	var set uint64
+	for item := range strings.SplitSeq(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("%s range %q runs backwards", f.name, rng)
+			}
+		}
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepStr)
+			}
+			step = n
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses one value of the field, a number or a name.
+func (f cronField) value(s string) (int, error) {
+	if i := slices.Index(f.names, strings.ToLower(s)); i >= 0 {
+		return i + f.min, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q: want %d to %d", f.name, s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// maxSpecYears bounds the search for the next time a spec is due, which
+// for one such as "0 0 30 2 *" never comes.
+const maxSpecYears = 5
+
+// next returns the first time after t the spec is due, or the zero time
+// if it is never due.
+func (c cronSpec) next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.UTC().Add(c.every)
+	}
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSpecYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(c.hour, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
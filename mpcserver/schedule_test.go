@@ -0,0 +1,197 @@
+package mpcserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	for _, spec := range []string{"*/15 8-18 * * mon-fri", "0 0 1,15 jan-jun/2 *", "5 4 * * 7", "@hourly", "@Daily", "@every 90s"} {
+		if err := (mpcserver.Schedule{Name: "ok", Agent: "echo", Spec: spec}).Validate(); err != nil {
+			t.Errorf("spec %q: %v", spec, err)
+		}
+	}
+	for _, tt := range []struct {
+		sc   mpcserver.Schedule
+		want string
+	}{
+		{mpcserver.Schedule{Name: "a b", Agent: "echo", Spec: "@hourly"}, "invalid name"},
+		{mpcserver.Schedule{Name: "x", Spec: "@hourly"}, "agent is required"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "* * * *"}, "want 5 fields"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "60 * * * *"}, "invalid minute"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "0 18-8 * * *"}, "runs backwards"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "*/0 * * * *"}, "invalid minute step"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "0 0 30 feb *"}, "never due"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "@fortnightly"}, "unknown descriptor"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "@every -1m"}, "positive duration"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "@hourly", Jitter: "soon"}, "invalid jitter"},
+		{mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "@hourly", WebhookURL: "/hook"}, "invalid webhook_url"},
+	} {
+		if err := tt.sc.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%+v: err = %v, want %q", tt.sc, err, tt.want)
+		}
+	}
+
+	s := mpcserver.New()
+	defer s.Shutdown(context.Background())
+	if err := s.AddSchedule(mpcserver.Schedule{Name: "x", Agent: "echo", Spec: "@hourly", WebhookURL: "http://example.com/hook"}); err == nil || !strings.Contains(err.Error(), "job callbacks") {
+		t.Errorf("webhook without callbacks: err = %v", err)
+	}
+
+	// Days of the month and of the week restricted both are due on days
+	// matching either.
+	for spec, due := range map[string]func(time.Time) bool{
+		"30 9 * * mon": func(t time.Time) bool { return t.Weekday() == time.Monday && t.Hour() == 9 && t.Minute() == 30 },
+		"0 0 13 * fri": func(t time.Time) bool { return t.Day() == 13 || t.Weekday() == time.Friday },
+		"0 */6 1 * *":  func(t time.Time) bool { return t.Day() == 1 && t.Hour()%6 == 0 && t.Minute() == 0 },
+	} {
+		if err := s.AddSchedule(mpcserver.Schedule{Name: "next", Agent: "echo", Spec: spec}); err != nil {
+			t.Fatal(err)
+		}
+		next := s.Schedules()[0].NextRun
+		if !due(next) || !next.After(time.Now()) || next.Location() != time.UTC {
+			t.Errorf("spec %q: next run %v", spec, next)
+		}
+		s.RemoveSchedule("next")
+	}
+}
+
+// waitSchedule polls s until the status of its only schedule satisfies ok.
+func waitSchedule(t *testing.T, s *mpcserver.Server, ok func(mpcserver.ScheduleStatus) bool) mpcserver.ScheduleStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list := s.Schedules()
+		if len(list) == 1 && ok(list[0]) {
+			return list[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("schedules = %+v", list)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	jobs := make(chan *mpcclient.Job, 1)
+	receiver := httptest.NewServer(mpcclient.CallbackHandler(callbackSecret, func(_ context.Context, job *mpcclient.Job) error {
+		select {
+		case jobs <- job:
+		default:
+		}
+		return nil
+	}))
+	defer receiver.Close()
+	s, c, release := newJobTestServer(t,
+		mpcserver.WithJobCallbacks(mpcserver.JobCallbacks{Secret: callbackSecret}),
+		mpcserver.WithSchedules(mpcserver.Schedule{
+			Name: "metrics", Agent: "slow", Spec: "@every 20ms", Jitter: "5ms",
+			Request: mpcserver.Request{Prompt: "vm"}, WebhookURL: receiver.URL,
+		}))
+	ctx := context.Background()
+
+	// The slow agent holds up the first run, so those due after it are
+	// skipped rather than piling up.
+	st := waitSchedule(t, s, func(st mpcserver.ScheduleStatus) bool { return st.Skipped >= 2 })
+	if !st.Running || st.LastJob == "" || st.NextRun.IsZero() {
+		t.Errorf("status = %+v", st)
+	}
+	job, err := c.GetJob(ctx, st.LastJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Schedule != "metrics" || job.Agent != "slow" || job.Status != mpcclient.JobRunning {
+		t.Errorf("job = %+v", job)
+	}
+
+	close(release)
+	done := receive(t, jobs)
+	if done.ID != st.LastJob || done.Schedule != "metrics" || done.Status != mpcclient.JobSucceeded || done.Response == nil || done.Response.Result != "report: vm" {
+		t.Errorf("webhook job = %+v", done)
+	}
+	waitSchedule(t, s, func(st mpcserver.ScheduleStatus) bool { return st.LastJob != done.ID })
+
+	if err := s.AddSchedule(mpcserver.Schedule{Name: "metrics", Agent: "echo", Spec: "@hourly"}); err == nil {
+		t.Error("duplicate schedule added")
+	}
+	if !s.RemoveSchedule("metrics") || s.RemoveSchedule("metrics") || len(s.Schedules()) != 0 {
+		t.Errorf("schedules after removal = %+v", s.Schedules())
+	}
+}
+
+func TestScheduleAdmin(t *testing.T) {
+	_, anon := newTestServer(t, nil, mpcserver.WithAdminKey("root"), mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ci", Key: "s3cret"}))
+	admin := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, anon.BaseURL()+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer root")
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{"name":"summary","agent":"echo","spec":"@every 10ms","request":{"prompt":"hi"}}`, http.StatusBadRequest},
+		{`{"name":"summary","agent":"echo","spec":"@every 10ms","owner":"nobody"}`, http.StatusBadRequest},
+		{`{"name":"summary","agent":"echo","spec":"every hour","owner":"ci"}`, http.StatusBadRequest},
+		{`{"name":"summary","agent":"echo","spec":"@every 10ms","request":{"prompt":"hi"},"owner":"ci"}`, http.StatusCreated},
+		{`{"name":"summary","agent":"echo","spec":"@hourly","owner":"ci"}`, http.StatusConflict},
+	} {
+		if res := admin(http.MethodPost, "/admin/schedules", tt.body); res.StatusCode != tt.want {
+			t.Errorf("create %s = %d, want %d", tt.body, res.StatusCode, tt.want)
+		}
+	}
+
+	// Runs are made with, and listed to, the owner's key.
+	ci := newKeyClient(t, anon.BaseURL(), mpcclient.WithAPIKey("s3cret"))
+	deadline := time.Now().Add(5 * time.Second)
+	for found := false; !found; {
+		it := ci.Jobs()
+		for it.Next(ctx) {
+			j := it.Item()
+			found = found || j.Schedule == "summary" && j.Status == mpcclient.JobSucceeded && j.Owner == "ci"
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if !found && time.Now().After(deadline) {
+			t.Fatal("no successful scheduled job listed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	res := admin(http.MethodGet, "/admin/schedules", "")
+	var list struct {
+		Schedules []mpcserver.ScheduleStatus `json:"schedules"`
+		Count     int                        `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil || list.Count != 1 {
+		t.Fatalf("list schedules = %+v, %v", list, err)
+	}
+	if st := list.Schedules[0]; st.Name != "summary" || st.Request.Prompt != "hi" || st.LastJob == "" || st.LastRun.IsZero() {
+		t.Errorf("listed schedule = %+v", st)
+	}
+
+	if res := admin(http.MethodDelete, "/admin/schedules/summary", ""); res.StatusCode != http.StatusNoContent {
+		t.Errorf("delete schedule = %d", res.StatusCode)
+	}
+	if res := admin(http.MethodDelete, "/admin/schedules/summary", ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("delete unknown schedule = %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,445 @@
+package mpcserver
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// Version is reported by the health endpoint unless overridden with
+// WithVersion.
+const Version = "go-1.0.0"
+
+// requestIDHeader carries the ID the server assigns to every request.
+const requestIDHeader = "X-Request-ID"
+
+// Server serves registered agents over HTTP. It implements http.Handler so
+// it can be mounted in an existing mux, or run standalone with
+// ListenAndServe.
+type Server struct {
+	registry *Registry
+	mux      *http.ServeMux
+	version  string
+	started  time.Time
+	ws       wsHub
+	logger   *slog.Logger
+	handler  http.Handler
+
+	attachments     AttachmentLimits
+	limits          RequestLimits
+	stopping        atomic.Bool
+	calls           callTracker
+	admission       *admission
+	keys            *keyring
+	audit           []AuditSink
+	metricsRegistry *prometheus.Registry
+	metrics         *metrics
+	jobs            jobRunner
+	schedules       scheduler
+	idempotency     idempotencyCache
+	boards          boards
+	signing         *signatureVerifier
+	filters         map[string]ResponseFilter
+	streamKeepAlive time.Duration
+	compressMinSize int
+
+	mu   sync.Mutex
+	srv  *http.Server
+	grpc *grpc.Server
+	// running lists the agents Start started, in order.
+	running       []string
+	agentsStarted bool
+	// loaded holds the sections of the agents LoadPlugins and
+	// ReloadPlugins loaded.
+	loaded       map[string]ConfigSection
+	configSource ConfigSource
+	reloadMu     sync.Mutex
+	// tenants are served under TenantPathPrefix. On a tenant, parent is
+	// the server it was added to and tenantID its ID.
+	tenants  map[string]*Server
+	parent   *Server
+	tenantID string
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithRegistry makes the server route to an existing registry, which may be
+// shared with other servers.
+func WithRegistry(r *Registry) Option {
+	return func(s *Server) {
+		if r != nil {
+			s.registry = r
+		}
+	}
+}
+
+// WithVersion sets the version reported by the health endpoint.
+func WithVersion(v string) Option {
+	return func(s *Server) {
+		s.version = v
+	}
+}
+
+// New returns a server with an empty registry.
+func New(opts ...Option) *Server {
+	s := &Server{
+		registry: NewRegistry(),
+		mux:      http.NewServeMux(),
+		version:  Version,
+		started:  time.Now(),
+		attachments: AttachmentLimits{
+			MaxSize:  DefaultMaxAttachmentSize,
+			MaxTotal: DefaultMaxAttachmentTotal,
+		},
+		limits: RequestLimits{
+			MaxBodySize:     DefaultMaxBodySize,
+			MaxPromptLength: DefaultMaxPromptLength,
+			MaxMessages:     DefaultMaxMessages,
+		},
+		admission:       newAdmission(),
+		loaded:          make(map[string]ConfigSection),
+		idempotency:     idempotencyCache{ttl: DefaultIdempotencyTTL},
+		boards:          boards{limits: BoardLimits{}.withDefaults()},
+		streamKeepAlive: DefaultStreamKeepAlive,
+		compressMinSize: DefaultCompressionMinSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.jobs.init()
+	for _, sc := range s.schedules.initial {
+		if err := s.addSchedule(sc); err != nil {
+			panic("mpcserver: WithSchedules: " + err.Message)
+		}
+	}
+	s.ws.logger = s.logger
+	if s.metrics == nil {
+		if s.metricsRegistry == nil {
+			s.metricsRegistry = defaultMetricsRegistry()
+		}
+		s.metrics = newMetrics(s.metricsRegistry)
+	}
+	s.routes()
+	s.handler = s.rejectWhenStopping(s.requireAPIKey(s.mux))
+	// The server a tenant is mounted on logs, counts and identifies its
+	// requests.
+	if s.parent == nil {
+		s.handler = s.logRequests(s.metrics.instrument(withRequestID(s.compress(s.verifySignatures(s.handler)))))
+	}
+	return s
+}
+
+// routes registers the endpoints, which also make up the OpenAPI document.
+func (s *Server) routes() {
+	for _, e := range s.endpoints() {
+		s.mux.Handle(e.method+" "+e.path, e.handler)
+	}
+	if s.parent == nil {
+		s.mux.HandleFunc(TenantPathPrefix+"{tenant}/", s.handleTenant)
+	}
+}
+
+// Register adds an agent under name. See Registry.Register.
+func (s *Server) Register(name string, a Agent) error {
+	return s.registry.Register(name, a)
+}
+
+// Registry returns the registry the server routes to.
+func (s *Server) Registry() *Registry {
+	return s.registry
+}
+
+// ServeHTTP routes r to the server's endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// ListenAndServe listens on addr and serves until Shutdown is called, in
+// which case it returns http.ErrServerClosed.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Shutdown is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.srv == nil {
+		s.srv = &http.Server{
+			Handler:           s,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	srv := s.srv
+	s.mu.Unlock()
+	return srv.Serve(l)
+}
+
+// Shutdown drains the server. It stops accepting new work at once: agent
+// calls, jobs and WebSocket connections are refused with a 503
+// shutting_down error and /readyz reports the server as not ready. It then
+// waits for in-flight agent calls on every transport, running jobs
+// included, to finish or ctx to be done, whichever comes first. WebSocket
+// sessions are sent a shutdown event and closed, schedules stopped, jobs
+// still running cancelled, and the HTTP server and the gRPC server started by ServeGRPC,
+// if any, are shut down. Agents started by Start are then stopped, in the
+// reverse order, and audit sinks closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopping.Store(true)
+	drained := s.calls.wait(ctx)
+	s.ws.closeAll()
+	s.jobs.cancel()
+	s.mu.Lock()
+	srv, gs := s.srv, s.grpc
+	s.mu.Unlock()
+	if gs != nil {
+		stopped := make(chan struct{})
+		go func() {
+			gs.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			gs.Stop()
+		}
+	}
+	err := errors.Join(drained, s.shutdownTenants(ctx))
+	if srv != nil {
+		if serr := srv.Shutdown(ctx); err == nil {
+			err = serr
+		}
+	}
+	return errors.Join(err, s.stopAgents(ctx), s.closeAudit())
+}
+
+// responseEnvelope is the wire form of a successful agent call.
+type responseEnvelope struct {
+	Agent           string  `json:"agent"`
+	Prompt          string  `json:"prompt"`
+	Status          string  `json:"status"`
+	RequestID       string  `json:"request_id"`
+	ExecutionTimeMS float64 `json:"execution_time_ms"`
+	Timestamp       string  `json:"timestamp"`
+	// AgentVersion is the AgentInfo.Version of the agent that answered.
+	AgentVersion    string `json:"agent_version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+	Response
+}
+
+func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, _, ok := s.registry.Lookup(name); !ok {
+		writeError(w, Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", name))
+		return
+	}
+	req, apiErr := s.decodeAgentRequest(w, r)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	req.RequestID = w.Header().Get(requestIDHeader)
+	resp, replayed, apiErr := s.idempotent(r, name, req, func() (*responseEnvelope, *Error) {
+		return s.invoke(r.Context(), name, req)
+	})
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	if replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// invoke validates req, runs it on the named agent and builds the response
+// envelope. It is shared by every transport.
+func (s *Server) invoke(ctx context.Context, name string, req Request) (env *responseEnvelope, apiErr *Error) {
+	reg, release, ok := s.registry.acquire(name)
+	defer release()
+	agent, info := reg.agent, reg.info
+	label := s.metricLabel(name)
+	if !ok {
+		label = s.metricLabel(unknownAgent)
+	}
+	finish := s.metrics.startCall(label)
+	defer func() { finish(apiErr) }()
+	s.calls.add()
+	defer s.calls.done()
+	if req.RequestID == "" {
+		req.RequestID = newRequestID()
+	}
+	// Metadata over the limits is rejected below, and kept out of the
+	// records of the rejection.
+	if checkMetadata(req.Metadata) == nil {
+		ctx = withMetadata(ctx, req.Metadata)
+	}
+	defer func(begin time.Time) {
+		var usage *Usage
+		if env != nil {
+			usage = env.Usage
+		}
+		s.auditCall(ctx, begin, "invoke", name, req.RequestID, req.Prompt, usage, apiErr)
+	}(time.Now())
+	if !ok {
+		return nil, Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", name)
+	}
+	if apiErr := s.keys.admit(ctx, name); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := s.checkRequest(info, req); apiErr != nil {
+		return nil, apiErr
+	}
+	req.Agent = name
+	ctx = s.withBoard(ctx, req)
+
+	leave, apiErr := s.admission.gate(name, agent).acquire(ctx, fairKey(ctx, req.Metadata), req.Priority)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	defer leave()
+
+	start := time.Now()
+	resp, err := s.handle(ctx, agent, req)
+	if err != nil {
+		apiErr = callError(ctx, err)
+		s.logCall(ctx, name, req.RequestID, start, apiErr)
+		return nil, apiErr
+	}
+	s.keys.charge(ctx, resp.Usage)
+	if apiErr := s.filterResponse(ctx, name, &resp); apiErr != nil {
+		s.logCall(ctx, name, req.RequestID, start, apiErr)
+		return nil, apiErr
+	}
+	s.logCall(ctx, name, req.RequestID, start, nil)
+	if resp.Format == "" && len(info.Formats) == 1 {
+		resp.Format = info.Formats[0]
+	}
+	return &responseEnvelope{
+		Agent:           name,
+		Prompt:          req.Prompt,
+		Status:          "success",
+		RequestID:       req.RequestID,
+		ExecutionTimeMS: float64(time.Since(start).Microseconds()) / 1000,
+		Timestamp:       start.UTC().Format(time.RFC3339Nano),
+		AgentVersion:    info.Version,
+		ProtocolVersion: ProtocolVersion,
+		Response:        resp,
+	}, nil
+}
+
+// decodeAgentRequest reads the body of an agent call, sent as JSON or, with
+// attachments, as multipart form data.
+func (s *Server) decodeAgentRequest(w http.ResponseWriter, r *http.Request) (Request, *Error) {
+	mt, apiErr := checkContentType(r, "application/json", "multipart/form-data")
+	if apiErr != nil {
+		return Request{}, apiErr
+	}
+	if mt == "multipart/form-data" {
+		return s.decodeMultipart(w, r)
+	}
+	var req Request
+	return req, s.decodeJSON(w, r, &req)
+}
+
+// agentError maps an error returned by an agent onto the response to send.
+func agentError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Status == 0 {
+			e.Status = http.StatusInternalServerError
+		}
+		return e
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: CodeAgentError, Message: err.Error()}
+}
+
+// callError maps the error an agent call on ctx ended with onto the
+// response to send, reporting a call whose ctx was cancelled, by its client
+// going away or by Shutdown, as canceled rather than as an agent failure.
+func callError(ctx context.Context, err error) *Error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return Errorf(StatusClientClosedRequest, CodeCanceled, "call canceled")
+	}
+	return agentError(err)
+}
+
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	agents, next, apiErr := paginate(r, s.registry.List(), func(a AgentInfo) string { return a.Name })
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, agentList{Agents: agents, Count: len(agents), NextCursor: next})
+}
+
+// agentList is the body of an agent listing. Count is the number of
+// agents on the page.
+type agentList struct {
+	Agents []AgentInfo `json:"agents"`
+	Count  int         `json:"count"`
+	// NextCursor, passed back as ?cursor=, fetches the next page; it is
+	// empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (s *Server) handleDescribeAgent(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	_, info, ok := s.registry.Lookup(name)
+	if !ok {
+		writeError(w, Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// withRequestID assigns each request an ID, sent back in the X-Request-ID
+// header and in the body of any error response. A valid ID sent by the
+// caller in the same header is kept, so calls can be followed across
+// clients, servers and the agents they chain.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, requestID(r.Header.Get(requestIDHeader)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxRequestIDLen bounds the length of a caller's request ID.
+const maxRequestIDLen = 128
+
+// requestID returns id if it is usable as a request ID, and a new one if
+// it is empty, too long, or holds anything but printable ASCII.
+func requestID(id string) string {
+	if id == "" || len(id) > maxRequestIDLen {
+		return newRequestID()
+	}
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return newRequestID()
+		}
+	}
+	return id
+}
+
+// newRequestID returns a random RFC 4122 version 4 UUID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,398 @@
+package mpcserver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+type echoAgent struct{}
+
+func (echoAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	if req.Prompt == "bad" {
+		return mpcserver.Response{}, mpcserver.Errorf(http.StatusBadRequest, "invalid_parameters", "cannot handle %q", req.Prompt)
+	}
+	if req.Prompt == "crash" {
+		return mpcserver.Response{}, errors.New("backend unavailable")
+	}
+	return mpcserver.Response{Result: "echo: " + req.Prompt, Usage: &mpcserver.Usage{TotalTokens: 3}}, nil
+}
+
+func (echoAgent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{Description: "Echoes prompts", ExamplePrompts: []string{"hello"}}
+}
+
+// newTestServer serves the echo agent and agents, by name, with opts, and
+// returns the server and a client for it. The server is shut down when
+// the test ends.
+func newTestServer(t *testing.T, agents map[string]mpcserver.Agent, opts ...mpcserver.Option) (*mpcserver.Server, *mpcclient.Client) {
+	t.Helper()
+	s := mpcserver.New(opts...)
+	if _, ok := agents["echo"]; !ok {
+		if err := s.Register("echo", echoAgent{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, a := range agents {
+		if err := s.Register(name, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	c, err := mpcclient.NewClient(ts.URL, mpcclient.WithStrictDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+func TestServerRoutesToAgent(t *testing.T) {
+	_, c := newTestServer(t, nil)
+	resp, err := c.CallAgent(context.Background(), "echo", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "echo: hi" || resp.Status != "success" || resp.RequestID == "" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	_, c := newTestServer(t, nil)
+	tests := []struct {
+		agent, prompt string
+		status        int
+		code          string
+	}{
+		{"missing", "hi", http.StatusNotFound, mpcserver.CodeAgentNotFound},
+		{"echo", "", http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"echo", "bad", http.StatusBadRequest, "invalid_parameters"},
+		{"echo", "crash", http.StatusInternalServerError, mpcserver.CodeAgentError},
+	}
+	for _, tt := range tests {
+		_, err := c.CallAgent(context.Background(), tt.agent, tt.prompt)
+		var apiErr *mpcclient.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s/%q: err = %v, want APIError", tt.agent, tt.prompt, err)
+			continue
+		}
+		if apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%s/%q: got %d %s, want %d %s", tt.agent, tt.prompt, apiErr.StatusCode, apiErr.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestServerErrorRequestID(t *testing.T) {
+	s, c := newTestServer(t, nil)
+	for _, path := range []string{"/agent/missing", "/agent/echo"} {
+		rec := httptest.NewRecorder()
+		body := `{"prompt":"crash"}`
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		var got struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		id := rec.Header().Get("X-Request-ID")
+		if rec.Code < 400 || id == "" || got.RequestID != id {
+			t.Errorf("%s: got %d, header %q, body request_id %q", path, rec.Code, id, got.RequestID)
+		}
+	}
+
+	_, err := c.DescribeAgent(context.Background(), "missing")
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.RequestID == "" || !errors.Is(err, mpcclient.ErrAgentNotFound) {
+		t.Errorf("describe err = %#v", err)
+	}
+	_, err = c.CallAgent(context.Background(), "echo", "crash")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.RequestID == "" {
+		t.Errorf("call err = %#v", err)
+	}
+}
+
+func TestServerKeepsCallerRequestID(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	for _, tc := range []struct{ sent, want string }{
+		{"chain-42", "chain-42"},
+		{"has spaces", ""},
+		{strings.Repeat("x", 200), ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/agent/echo", strings.NewReader(`{"prompt":"hi"}`))
+		req.Header.Set("X-Request-ID", tc.sent)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		id := rec.Header().Get("X-Request-ID")
+		if tc.want != "" && id != tc.want || tc.want == "" && (id == "" || id == tc.sent) {
+			t.Errorf("sent %q: got ID %q", tc.sent, id)
+		}
+	}
+
+	seen := make(chan string, 3)
+	agents := map[string]mpcserver.Agent{"id": mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		seen <- req.RequestID
+		return mpcserver.Response{Result: "ok"}, nil
+	})}
+	hc, gc, _ := newGRPCTestServer(t, agents)
+	_, wc := newWSTestServer(t, agents)
+	for name, c := range map[string]*mpcclient.Client{"http": hc, "grpc": gc, "websocket": wc} {
+		ctx := mpcclient.WithRequestID(context.Background(), "chain-"+name)
+		resp, err := c.CallAgent(ctx, "id", "hi")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := <-seen; got != "chain-"+name || resp.RequestID != got {
+			t.Errorf("%s: agent saw %q, response carries %q", name, got, resp.RequestID)
+		}
+	}
+}
+
+// reportAgent answers in the format asked for, JSON unless told otherwise.
+type reportAgent struct{ formats []string }
+
+func (a reportAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	if req.Format == mpcserver.FormatMarkdown {
+		return mpcserver.Response{Result: "**cpu**: 42", Format: req.Format}, nil
+	}
+	return mpcserver.Response{Result: `{"cpu":42}`}, nil
+}
+
+func (a reportAgent) Describe() mpcserver.AgentInfo {
+	return mpcserver.AgentInfo{Formats: a.formats}
+}
+
+func TestServerFormatNegotiation(t *testing.T) {
+	agents := map[string]mpcserver.Agent{
+		"both": reportAgent{formats: []string{mpcserver.FormatJSON, mpcserver.FormatMarkdown}},
+		"json": reportAgent{formats: []string{mpcserver.FormatJSON}},
+	}
+	hc, gc, _ := newGRPCTestServer(t, agents)
+	ctx := context.Background()
+	for name, c := range map[string]*mpcclient.Client{"http": hc, "grpc": gc} {
+		resp, err := c.CallAgent(ctx, "both", "report", mpcclient.WithFormat(mpcclient.FormatMarkdown))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if md, err := resp.Markdown(); err != nil || md != "**cpu**: 42" || resp.Format != mpcclient.FormatMarkdown {
+			t.Errorf("%s: Markdown() = %q, %v with format %q", name, md, err, resp.Format)
+		}
+
+		resp, err = c.CallAgent(ctx, "json", "report")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var v struct{ CPU int }
+		if resp.Format != mpcclient.FormatJSON || resp.JSON(&v) != nil || v.CPU != 42 {
+			t.Errorf("%s: single-format agent: format %q, decoded %+v", name, resp.Format, v)
+		}
+		if _, err := resp.Markdown(); err == nil {
+			t.Errorf("%s: Markdown() of a JSON response succeeded", name)
+		}
+
+		_, err = c.CallAgent(ctx, "json", "report", mpcclient.WithFormat(mpcclient.FormatMarkdown))
+		var apiErr *mpcclient.APIError
+		if !errors.Is(err, mpcclient.ErrUnsupportedFormat) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotAcceptable {
+			t.Errorf("%s: unsupported format: err = %v", name, err)
+		}
+	}
+
+	info, err := hc.DescribeAgent(ctx, "both")
+	if err != nil || len(info.Formats) != 2 {
+		t.Errorf("DescribeAgent = %+v, %v", info, err)
+	}
+}
+
+func TestServerRejectsMalformedJSON(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/agent/echo", strings.NewReader("{not json")))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), mpcserver.CodeInvalidRequest) {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestServerListsAgents(t *testing.T) {
+	_, c := newTestServer(t, nil)
+	agents, err := c.ListAgents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Name != "echo" || agents[0].Description != "Echoes prompts" {
+		t.Errorf("agents = %+v", agents)
+	}
+	info, err := c.DescribeAgent(context.Background(), "echo")
+	if err != nil || info.ExamplePrompts[0] != "hello" {
+		t.Errorf("describe = %+v, %v", info, err)
+	}
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	r := mpcserver.NewRegistry()
+	if err := r.Register("echo", echoAgent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("echo", echoAgent{}); !errors.Is(err, mpcserver.ErrDuplicateAgent) {
+		t.Errorf("err = %v, want ErrDuplicateAgent", err)
+	}
+}
+
+func TestServerLogsCalls(t *testing.T) {
+	var buf bytes.Buffer
+	s := mpcserver.New(mpcserver.WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	if err := s.Register("echo", echoAgent{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, prompt := range []string{"secret plans", "crash"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/agent/echo", strings.NewReader(`{"prompt":"`+prompt+`"}`)))
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"level=INFO msg=\"agent call\" agent=echo",
+		"level=ERROR msg=\"agent call\" agent=echo",
+		"code=agent_error",
+		"msg=\"http request\" method=POST path=/agent/echo status=500",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret plans") {
+		t.Errorf("log contains the prompt:\n%s", out)
+	}
+}
+
+func TestServerAttachments(t *testing.T) {
+	s := mpcserver.New(mpcserver.WithAttachmentLimits(mpcserver.AttachmentLimits{
+		MaxSize:      16,
+		AllowedTypes: []string{"image/*", "text/plain"},
+	}))
+	var got []mpcserver.Attachment
+	s.Register("vision", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		got = req.Attachments
+		return mpcserver.Response{Result: req.Prompt}, nil
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, _ := mpcclient.NewClient(ts.URL)
+	ctx := context.Background()
+
+	png := []byte("\x89PNG\r\n\x1a\n")
+	resp, err := c.Invoke(ctx, "vision", mpcclient.AgentRequest{
+		Prompt: "describe",
+		Attachments: []mpcclient.Attachment{
+			mpcclient.AttachBytes("shot", "", png),
+			mpcclient.AttachBytes("notes.txt", "text/plain", []byte("hello")),
+		},
+	})
+	if err != nil || resp.Result != "describe" {
+		t.Fatalf("Invoke = %+v, %v", resp, err)
+	}
+	if len(got) != 2 || got[0].ContentType != "image/png" || got[0].Size != int64(len(png)) ||
+		got[1].Name != "notes.txt" || string(got[1].Data) != "hello" {
+		t.Errorf("agent got attachments %+v", got)
+	}
+
+	tests := []struct {
+		name       string
+		attachment mpcclient.Attachment
+		status     int
+		code       string
+	}{
+		{"too large", mpcclient.AttachBytes("big.txt", "text/plain", bytes.Repeat([]byte("x"), 17)), http.StatusRequestEntityTooLarge, mpcserver.CodeRequestTooLarge},
+		{"disallowed type", mpcclient.AttachBytes("doc.pdf", "application/pdf", []byte("%PDF")), http.StatusUnsupportedMediaType, mpcserver.CodeUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		_, err := c.Invoke(ctx, "vision", mpcclient.AgentRequest{Prompt: "describe", Attachments: []mpcclient.Attachment{tt.attachment}})
+		var apiErr *mpcclient.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%s: err = %v, want %d %s", tt.name, err, tt.status, tt.code)
+		}
+	}
+}
+
+func TestServerToolCalls(t *testing.T) {
+	s := mpcserver.New()
+	s.Register("ops", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		if len(req.ToolResults) == 0 {
+			return mpcserver.Response{ToolCalls: []mpcserver.ToolCall{
+				{ID: "1", Name: req.Tools[0].Name, Arguments: json.RawMessage(`{"vm":"web01"}`)},
+			}}, nil
+		}
+		return mpcserver.Response{Result: "cpu " + string(req.ToolResults[0].Output)}, nil
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	getCPU := mpcclient.Tool{
+		Name: "get_cpu",
+		Handler: mpcclient.ToolFunc(func(ctx context.Context, args struct{ VM string }) (any, error) {
+			return 97, nil
+		}),
+	}
+	c, _ := mpcclient.NewClient(ts.URL, mpcclient.WithStrictDecoding(), mpcclient.WithTools(getCPU))
+	resp, err := c.InvokeWithTools(context.Background(), "ops", mpcclient.AgentRequest{Prompt: "check web01"})
+	if err != nil || resp.Result != "cpu 97" {
+		t.Errorf("InvokeWithTools = %+v, %v", resp, err)
+	}
+}
+
+type backendAgent struct {
+	echoAgent
+	down atomic.Bool
+}
+
+func (a *backendAgent) Check(ctx context.Context) error {
+	if a.down.Load() {
+		return errors.New("backend unreachable")
+	}
+	return nil
+}
+
+func TestServerReadiness(t *testing.T) {
+	s, c := newTestServer(t, nil)
+	backend := &backendAgent{}
+	s.Register("backend", backend)
+	ctx := context.Background()
+
+	h, err := c.Health(ctx)
+	if err != nil || !h.Healthy() || h.Agents != 2 {
+		t.Errorf("Health = %+v, %v", h, err)
+	}
+	st, err := c.Ready(ctx)
+	if err != nil || len(st.Agents) != 2 || st.Agents["backend"].Status != mpcserver.AgentAvailable {
+		t.Errorf("Ready = %+v, %v", st, err)
+	}
+
+	backend.down.Store(true)
+	st, err = c.Ready(ctx)
+	if !errors.Is(err, mpcclient.ErrNotReady) || st.Agents["backend"].Error != "backend unreachable" ||
+		st.Agents["echo"].Status != mpcserver.AgentAvailable {
+		t.Errorf("Ready with agent down = %+v, %v", st, err)
+	}
+
+	backend.down.Store(false)
+	s.Shutdown(ctx)
+	if st, err := c.Ready(ctx); !errors.Is(err, mpcclient.ErrNotReady) || st.Status != "shutting_down" {
+		t.Errorf("Ready during shutdown = %+v, %v", st, err)
+	}
+}
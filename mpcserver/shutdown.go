@@ -0,0 +1,70 @@
+package mpcserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// callTracker counts the agent calls in progress on every transport, so
+// that Shutdown can wait for them.
+type callTracker struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed when n drops to zero, if anyone waits
+}
+
+func (t *callTracker) add() {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+}
+
+func (t *callTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n--; t.n == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// wait returns once no calls are in progress, or with ctx's error when it
+// is done first.
+func (t *callTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.n == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errShuttingDown is the error for work offered once Shutdown has begun.
+func errShuttingDown() *Error {
+	return Errorf(http.StatusServiceUnavailable, CodeShuttingDown, "server shutting down")
+}
+
+// rejectWhenStopping turns away new agent calls, jobs and WebSocket
+// connections once Shutdown has begun, including on servers mounted in
+// another mux, while health checks, metrics and job polling still work.
+func (s *Server) rejectWhenStopping(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.stopping.Load() && (r.Method == http.MethodPost || r.URL.Path == "/ws") {
+			w.Header().Set("Connection", "close")
+			writeError(w, errShuttingDown())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
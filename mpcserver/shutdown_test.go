@@ -0,0 +1,132 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// blockingAgent answers once release is closed, and says so on started
+// when a call arrives.
+type blockingAgent struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingAgent(queue int) blockingAgent {
+	return blockingAgent{started: make(chan struct{}, queue), release: make(chan struct{})}
+}
+
+func (a blockingAgent) Handle(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+	a.started <- struct{}{}
+	select {
+	case <-a.release:
+		return mpcserver.Response{Result: "done: " + req.Prompt}, nil
+	case <-ctx.Done():
+		return mpcserver.Response{}, ctx.Err()
+	}
+}
+
+func TestShutdownDrainsInFlightCalls(t *testing.T) {
+	agent := newBlockingAgent(1)
+	s, c := newTestServer(t, map[string]mpcserver.Agent{"blocking": agent})
+	ctx := context.Background()
+
+	type outcome struct {
+		resp *mpcclient.AgentResponse
+		err  error
+	}
+	calls := make(chan outcome, 1)
+	go func() {
+		resp, err := c.CallAgent(ctx, "blocking", "x")
+		calls <- outcome{resp, err}
+	}()
+	<-agent.started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := c.CallAgent(ctx, "echo", "y")
+		if errors.Is(err, mpcclient.ErrServerOverloaded) {
+			var apiErr *mpcclient.APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != "shutting_down" {
+				t.Errorf("call during shutdown: err = %v, want shutting_down", err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("calls still accepted during shutdown: err = %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := c.Ready(ctx); err == nil {
+		t.Error("Ready during shutdown = nil, want an error")
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the in-flight call finished", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(agent.release)
+	if got := <-calls; got.err != nil || got.resp.Result != "done: x" {
+		t.Errorf("in-flight call = %+v, %v; want it answered", got.resp, got.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	agent := newBlockingAgent(1)
+	s, c := newTestServer(t, map[string]mpcserver.Agent{"blocking": agent})
+	ctx := context.Background()
+
+	calls := make(chan error, 1)
+	go func() {
+		_, err := c.CallAgent(ctx, "blocking", "x")
+		calls <- err
+	}()
+	<-agent.started
+
+	grace, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(grace); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the grace period exceeded", err)
+	}
+	close(agent.release)
+	<-calls
+}
+
+func TestShutdownNotifiesWebSockets(t *testing.T) {
+	agent := newBlockingAgent(1)
+	s, plain := newTestServer(t, map[string]mpcserver.Agent{"blocking": agent})
+	c := newKeyClient(t, plain.BaseURL(), mpcclient.WithStrictDecoding(),
+		mpcclient.WithWebSocketTransport(mpcclient.WebSocketConfig{ReconnectDelay: 10 * time.Millisecond}))
+	ctx := context.Background()
+
+	calls := make(chan error, 1)
+	go func() {
+		_, err := c.CallAgent(ctx, "blocking", "x")
+		calls <- err
+	}()
+	<-agent.started
+
+	grace, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	s.Shutdown(grace)
+	err := <-calls
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Code != "shutting_down" {
+		t.Fatalf("call across shutdown: err = %v, want a shutting_down error", err)
+	}
+	if !mpcclient.Retryable(err) {
+		t.Errorf("Retryable(%v) = false", err)
+	}
+}
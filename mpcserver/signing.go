@@ -0,0 +1,163 @@
+package mpcserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request signing headers. A client sharing the server's signing secret
+// sends the time of signing, in Unix seconds, in SignatureTimestampHeader,
+// a random value unique to the request in SignatureNonceHeader, and in
+// SignatureHeader "sha256=" followed by the hex HMAC-SHA256, keyed with the
+// secret, of the signing string: the method, the path with its query, the
+// timestamp, the nonce and the hex SHA-256 of the body, each followed by a
+// newline.
+const (
+	SignatureTimestampHeader = "Request-Timestamp"
+	SignatureNonceHeader     = "Request-Nonce"
+	SignatureHeader          = "Request-Signature"
+)
+
+// DefaultSignatureTolerance is how far the timestamp of a signed request
+// may be from the server's clock.
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// maxNonceLen bounds the length of a request nonce.
+const maxNonceLen = 128
+
+// RequestSigning configures the verification of signed requests. Zero
+// fields take the documented defaults.
+type RequestSigning struct {
+	// Secret keys the signatures. It is required.
+	Secret []byte
+	// Tolerance is how far a request's timestamp may be from the server's
+	// clock, either way. It defaults to DefaultSignatureTolerance.
+	Tolerance time.Duration
+}
+
+// WithRequestSigning requires every request but health checks, metrics and
+// the OpenAPI document to be signed with cfg.Secret, so that requests
+// altered or replayed on their way to the server are refused with a 401
+// invalid_signature error. Each nonce is accepted once while its timestamp
+// is within tolerance. Signing protects HTTP and the opening of WebSocket
+// connections; gRPC relies on its transport security.
+func WithRequestSigning(cfg RequestSigning) Option {
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = DefaultSignatureTolerance
+	}
+	return func(s *Server) {
+		if len(cfg.Secret) > 0 {
+			s.signing = &signatureVerifier{RequestSigning: cfg, now: time.Now}
+		}
+	}
+}
+
+// SignRequest returns the SignatureHeader value of a request, as signed
+// with secret at timestamp with nonce.
+func SignRequest(secret []byte, method, path, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	for _, field := range []string{method, path, timestamp, nonce, hex.EncodeToString(sum[:])} {
+		mac.Write([]byte(field))
+		mac.Write([]byte("\n"))
+	}
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureVerifier checks signed requests and remembers the nonces seen
+// while they are within tolerance.
+type signatureVerifier struct {
+	RequestSigning
+	now func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	swept  time.Time
+}
+
+// verify checks the signature of r over body.
+func (v *signatureVerifier) verify(r *http.Request, body []byte) *Error {
+	ts := r.Header.Get(SignatureTimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Errorf(http.StatusUnauthorized, CodeInvalidSignature, "request signature needs a Unix timestamp in %s", SignatureTimestampHeader)
+	}
+	now, signed := v.now(), time.Unix(sec, 0)
+	if d := now.Sub(signed); d > v.Tolerance || d < -v.Tolerance {
+		return Errorf(http.StatusUnauthorized, CodeInvalidSignature, "request timestamp %s is more than %s from the server's clock", signed.UTC().Format(time.RFC3339), v.Tolerance)
+	}
+	nonce := r.Header.Get(SignatureNonceHeader)
+	if nonce == "" || len(nonce) > maxNonceLen {
+		return Errorf(http.StatusUnauthorized, CodeInvalidSignature, "request signature needs a nonce of up to %d bytes in %s", maxNonceLen, SignatureNonceHeader)
+	}
+	sig, ok := strings.CutPrefix(r.Header.Get(SignatureHeader), "sha256=")
+	if _, err := hex.DecodeString(sig); !ok || err != nil {
+		return Errorf(http.StatusUnauthorized, CodeInvalidSignature, "request signature missing or malformed in %s", SignatureHeader)
+	}
+	want := SignRequest(v.Secret, r.Method, r.URL.RequestURI(), ts, nonce, body)
+	if !hmac.Equal([]byte("sha256="+sig), []byte(want)) {
+		return Errorf(http.StatusUnauthorized, CodeInvalidSignature, "request signature does not match")
+	}
+
+	// Only requests that verify use up their nonce, and a nonce needs
+	// remembering only until its timestamp falls out of tolerance.
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.swept) > time.Second {
+		for n, expires := range v.nonces {
+			if !now.Before(expires) {
+				delete(v.nonces, n)
+			}
+		}
+		v.swept = now
+	}
+	if _, seen := v.nonces[nonce]; seen {
+		return Errorf(http.StatusUnauthorized, CodeInvalidSignature, "request nonce %q already used", nonce)
+	}
+	if v.nonces == nil {
+		v.nonces = make(map[string]time.Time)
+	}
+	v.nonces[nonce] = signed.Add(v.Tolerance)
+	return nil
+}
+
+// verifySignatures refuses requests that are not signed with the server's
+// signing secret, when it has one. The body is read up front, within the
+// limits of the largest request the server accepts, and handed on as read.
+func (s *Server) verifySignatures(next http.Handler) http.Handler {
+	if s.signing == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health", "/healthz", "/readyz", "/metrics", OpenAPIPath:
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.MaxBodySize+s.attachments.MaxTotal))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, Errorf(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			writeError(w, Errorf(http.StatusBadRequest, CodeInvalidRequest, "read request body: %v", err))
+			return
+		}
+		if apiErr := s.signing.verify(r, body); apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestRequestSigning(t *testing.T) {
+	secret := []byte("shared-secret")
+	s := mpcserver.New(mpcserver.WithRequestSigning(mpcserver.RequestSigning{Secret: secret}))
+	s.Register("echo", echoAgent{})
+	s.Register("files", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		return mpcserver.Response{Result: string(req.Attachments[0].Data)}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	signed := newKeyClient(t, ts.URL, mpcclient.WithRequestSigning(secret))
+	if resp, err := signed.CallAgent(ctx, "echo", "hi"); err != nil || resp.Result != "echo: hi" {
+		t.Errorf("signed call = %+v, %v", resp, err)
+	}
+	resp, err := signed.Invoke(ctx, "files", mpcclient.AgentRequest{Prompt: "read", Attachments: []mpcclient.Attachment{mpcclient.AttachBytes("notes.txt", "text/plain", []byte("hello"))}})
+	if err != nil || resp.Result != "hello" {
+		t.Errorf("signed upload = %+v, %v", resp, err)
+	}
+	ws := newKeyClient(t, ts.URL, mpcclient.WithRequestSigning(secret), mpcclient.WithWebSocketTransport(mpcclient.WebSocketConfig{}))
+	if resp, err := ws.CallAgent(ctx, "echo", "over ws"); err != nil || resp.Result != "echo: over ws" {
+		t.Errorf("signed WebSocket call = %+v, %v", resp, err)
+	}
+
+	for name, c := range map[string]*mpcclient.Client{
+		"unsigned":     newKeyClient(t, ts.URL),
+		"wrong secret": newKeyClient(t, ts.URL, mpcclient.WithRequestSigning([]byte("guess"))),
+	} {
+		_, err := c.CallAgent(ctx, "echo", "hi")
+		wantAPIError(t, err, http.StatusUnauthorized, mpcserver.CodeInvalidSignature)
+		if !errors.Is(err, mpcclient.ErrUnauthorized) {
+			t.Errorf("%s: err = %v, want ErrUnauthorized", name, err)
+		}
+	}
+	if _, err := newKeyClient(t, ts.URL).Health(ctx); err != nil {
+		t.Errorf("unsigned health check: %v", err)
+	}
+
+	send := func(at time.Time, nonce, body, signedBody string) int {
+		t.Helper()
+		stamp := strconv.FormatInt(at.Unix(), 10)
+		req, _ := http.NewRequest(http.MethodPost, "/agent/echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(mpcserver.SignatureTimestampHeader, stamp)
+		req.Header.Set(mpcserver.SignatureNonceHeader, nonce)
+		req.Header.Set(mpcserver.SignatureHeader, mpcserver.SignRequest(secret, req.Method, "/agent/echo", stamp, nonce, []byte(signedBody)))
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		io.Copy(io.Discard, rec.Body)
+		return rec.Code
+	}
+	body := `{"prompt":"hi"}`
+	if code := send(time.Now(), "n1", body, body); code != http.StatusOK {
+		t.Errorf("hand-signed request: %d", code)
+	}
+	if code := send(time.Now(), "n1", body, body); code != http.StatusUnauthorized {
+		t.Errorf("replayed nonce: %d", code)
+	}
+	if code := send(time.Now(), "n2", `{"prompt":"bye"}`, body); code != http.StatusUnauthorized {
+		t.Errorf("altered body: %d", code)
+	}
+	if code := send(time.Now().Add(-10*time.Minute), "n3", body, body); code != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: %d", code)
+	}
+	if code := send(time.Now().Add(time.Minute), "n4", body, body); code != http.StatusOK {
+		t.Errorf("timestamp within tolerance: %d", code)
+	}
+}
@@ -0,0 +1,281 @@
+// Package sqlitestore keeps the state of an mpcserver.Server in a SQLite
+// file, so that jobs, replayable idempotent responses and WebSocket
+// sessions survive a restart and the audit trail is kept alongside them:
+//
+//	store, err := sqlitestore.Open("mpcserver.db")
+//	if err != nil {
+//		return err
+//	}
+//	s := mpcserver.New(mpcserver.WithStore(store))
+//
+// The server closes the store on Shutdown. Several servers may share a
+// file, and then answer for each other's jobs.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// schemaVersion is stored in the file's user_version. Files written by a
+// newer version are refused rather than misread.
+const schemaVersion = 1
+
+// Rows hold their values as JSON, with the expiry, in Unix nanoseconds, in
+// a column of its own; zero never expires.
+const schema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id      TEXT    PRIMARY KEY,
+	expires INTEGER NOT NULL DEFAULT 0,
+	job     TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_expires ON jobs (expires) WHERE expires > 0;
+CREATE TABLE IF NOT EXISTS audit (
+	id     INTEGER PRIMARY KEY,
+	time   INTEGER NOT NULL,
+	record TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_time ON audit (time);
+CREATE TABLE IF NOT EXISTS responses (
+	key      TEXT    PRIMARY KEY,
+	expires  INTEGER NOT NULL,
+	response TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS responses_expires ON responses (expires);
+CREATE TABLE IF NOT EXISTS sessions (
+	token   TEXT    PRIMARY KEY,
+	expires INTEGER NOT NULL,
+	session TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_expires ON sessions (expires);
+`
+
+// Store is an mpcserver.Store in a SQLite file. It is safe for concurrent
+// use, including by several processes sharing the file. Expired entries
+// are removed whenever one of their kind is written.
+type Store struct {
+	db *sql.DB
+}
+
+var _ mpcserver.Store = (*Store)(nil)
+
+// Open opens the store at path, creating it and its directory if they do
+// not exist.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("sqlitestore: path is required")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("sqlitestore: %w", err)
+		}
+	}
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlitestore: open %s: %w", path, err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlitestore: open %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("written by a newer version (schema %d)", version)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	_, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	return err
+}
+
+// Close closes the file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// keyColumns names the key column of the tables put and get use.
+var keyColumns = map[string]string{"jobs": "id", "responses": "key", "sessions": "token"}
+
+// put stores v as JSON under key in table, after removing the table's
+// expired rows.
+func (s *Store) put(ctx context.Context, table, column, key string, expires time.Time, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	exp := int64(0)
+	if !expires.IsZero() {
+		exp = expires.UnixNano()
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires > 0 AND expires <= ?", time.Now().UnixNano()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO "+table+" ("+keyColumns[table]+", expires, "+column+") VALUES (?, ?, ?)", key, exp, string(b)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// get decodes the unexpired value under key in table into v, returning
+// notFound if there is none.
+func (s *Store) get(ctx context.Context, table, column, key string, v any, notFound error) error {
+	var b string
+	err := s.db.QueryRowContext(ctx, "SELECT "+column+" FROM "+table+" WHERE "+keyColumns[table]+" = ? AND (expires = 0 OR expires > ?)",
+		key, time.Now().UnixNano()).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(b), v)
+}
+
+// Put implements mpcserver.JobStore.
+func (s *Store) Put(ctx context.Context, job mpcserver.Job) error {
+	if err := s.put(ctx, "jobs", "job", job.ID, job.ExpiresAt, job); err != nil {
+		return fmt.Errorf("sqlitestore: put job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Get implements mpcserver.JobStore.
+func (s *Store) Get(ctx context.Context, id string) (mpcserver.Job, error) {
+	var job mpcserver.Job
+	err := s.get(ctx, "jobs", "job", id, &job, mpcserver.ErrJobNotFound)
+	if err != nil && !errors.Is(err, mpcserver.ErrJobNotFound) {
+		err = fmt.Errorf("sqlitestore: get job %s: %w", id, err)
+	}
+	return job, err
+}
+
+// List implements mpcserver.JobStore.
+func (s *Store) List(ctx context.Context) ([]mpcserver.Job, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT job FROM jobs WHERE expires = 0 OR expires > ?", time.Now().UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("sqlitestore: list jobs: %w", err)
+	}
+	defer rows.Close()
+	var jobs []mpcserver.Job
+	for rows.Next() {
+		var b string
+		var job mpcserver.Job
+		if err := rows.Scan(&b); err != nil {
+			return nil, fmt.Errorf("sqlitestore: list jobs: %w", err)
+		}
+		if err := json.Unmarshal([]byte(b), &job); err != nil {
+			return nil, fmt.Errorf("sqlitestore: list jobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlitestore: list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// WriteAudit implements mpcserver.AuditSink.
+func (s *Store) WriteAudit(rec mpcserver.AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err == nil {
+		_, err = s.db.Exec("INSERT INTO audit (time, record) VALUES (?, ?)", rec.Time.UnixNano(), string(b))
+	}
+	if err != nil {
+		return fmt.Errorf("sqlitestore: write audit: %w", err)
+	}
+	return nil
+}
+
+// AuditRecords returns the audit records at or after since, oldest first.
+func (s *Store) AuditRecords(ctx context.Context, since time.Time) ([]mpcserver.AuditRecord, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT record FROM audit WHERE time >= ? ORDER BY time, id", since.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("sqlitestore: audit records: %w", err)
+	}
+	defer rows.Close()
+	var recs []mpcserver.AuditRecord
+	for rows.Next() {
+		var b string
+		var rec mpcserver.AuditRecord
+		if err := rows.Scan(&b); err != nil {
+			return nil, fmt.Errorf("sqlitestore: audit records: %w", err)
+		}
+		if err := json.Unmarshal([]byte(b), &rec); err != nil {
+			return nil, fmt.Errorf("sqlitestore: audit records: %w", err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlitestore: audit records: %w", err)
+	}
+	return recs, nil
+}
+
+// PutResponse implements mpcserver.IdempotencyStore.
+func (s *Store) PutResponse(ctx context.Context, key string, resp mpcserver.StoredResponse) error {
+	if err := s.put(ctx, "responses", "response", key, resp.ExpiresAt, resp); err != nil {
+		return fmt.Errorf("sqlitestore: put response: %w", err)
+	}
+	return nil
+}
+
+// GetResponse implements mpcserver.IdempotencyStore.
+func (s *Store) GetResponse(ctx context.Context, key string) (mpcserver.StoredResponse, error) {
+	var resp mpcserver.StoredResponse
+	err := s.get(ctx, "responses", "response", key, &resp, mpcserver.ErrResponseNotFound)
+	if err != nil && !errors.Is(err, mpcserver.ErrResponseNotFound) {
+		err = fmt.Errorf("sqlitestore: get response: %w", err)
+	}
+	return resp, err
+}
+
+// PutSession implements mpcserver.SessionStore.
+func (s *Store) PutSession(ctx context.Context, sess mpcserver.StoredSession) error {
+	if err := s.put(ctx, "sessions", "session", sess.Token, sess.ExpiresAt, sess); err != nil {
+		return fmt.Errorf("sqlitestore: put session: %w", err)
+	}
+	return nil
+}
+
+// GetSession implements mpcserver.SessionStore.
+func (s *Store) GetSession(ctx context.Context, token string) (mpcserver.StoredSession, error) {
+	var sess mpcserver.StoredSession
+	err := s.get(ctx, "sessions", "session", token, &sess, mpcserver.ErrSessionNotFound)
+	if err != nil && !errors.Is(err, mpcserver.ErrSessionNotFound) {
+		err = fmt.Errorf("sqlitestore: get session: %w", err)
+	}
+	return sess, err
+}
+
+// DeleteSession implements mpcserver.SessionStore.
+func (s *Store) DeleteSession(ctx context.Context, token string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE token = ?", token); err != nil {
+		return fmt.Errorf("sqlitestore: delete session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sqlitestore_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver/sqlitestore"
+)
+
+func TestStoreReopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "mpcserver.db")
+	s, err := sqlitestore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, job := range []mpcserver.Job{
+		{ID: "expired", Agent: "echo", Status: mpcserver.JobFailed, ExpiresAt: now.Add(-time.Second)},
+		{ID: "running", Agent: "echo", Status: mpcserver.JobRunning, CreatedAt: now},
+		{ID: "done", Agent: "echo", Status: mpcserver.JobSucceeded, Response: json.RawMessage(`{"result":"ok"}`), ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := s.Put(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.WriteAudit(mpcserver.AuditRecord{Time: now, RequestID: "r1", Agent: "echo", Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+	resp := mpcserver.StoredResponse{Fingerprint: "abc", Envelope: json.RawMessage(`{"result":"ok"}`), ExpiresAt: now.Add(time.Minute)}
+	if err := s.PutResponse(ctx, "k1", resp); err != nil {
+		t.Fatal(err)
+	}
+	sess := mpcserver.StoredSession{Token: "t1", Seq: 2, Backlog: []json.RawMessage{json.RawMessage(`{"type":"status","seq":2}`)}, Pending: []string{"r1"}, ExpiresAt: now.Add(time.Minute)}
+	if err := s.PutSession(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = sqlitestore.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if job, err := s.Get(ctx, "done"); err != nil || job.Status != mpcserver.JobSucceeded || string(job.Response) != `{"result":"ok"}` || !job.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("done job = %+v, %v", job, err)
+	}
+	if job, err := s.Get(ctx, "running"); err != nil || job.Status != mpcserver.JobRunning {
+		t.Errorf("running job = %+v, %v", job, err)
+	}
+	for _, id := range []string{"expired", "unknown"} {
+		if _, err := s.Get(ctx, id); !errors.Is(err, mpcserver.ErrJobNotFound) {
+			t.Errorf("job %s: err = %v", id, err)
+		}
+	}
+	if recs, err := s.AuditRecords(ctx, now.Add(-time.Minute)); err != nil || len(recs) != 1 || recs[0].RequestID != "r1" {
+		t.Errorf("audit records = %+v, %v", recs, err)
+	}
+	if recs, _ := s.AuditRecords(ctx, now.Add(time.Minute)); len(recs) != 0 {
+		t.Errorf("audit records since later = %+v", recs)
+	}
+	if got, err := s.GetResponse(ctx, "k1"); err != nil || got.Fingerprint != "abc" || string(got.Envelope) != `{"result":"ok"}` {
+		t.Errorf("response = %+v, %v", got, err)
+	}
+	if _, err := s.GetResponse(ctx, "k2"); !errors.Is(err, mpcserver.ErrResponseNotFound) {
+		t.Errorf("unknown response: err = %v", err)
+	}
+	if got, err := s.GetSession(ctx, "t1"); err != nil || got.Seq != 2 || len(got.Backlog) != 1 || len(got.Pending) != 1 {
+		t.Errorf("session = %+v, %v", got, err)
+	}
+	if err := s.DeleteSession(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSession(ctx, "t1"); !errors.Is(err, mpcserver.ErrSessionNotFound) {
+		t.Errorf("deleted session: err = %v", err)
+	}
+
+	// Writing a job dropped the expired one written before it.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM jobs").Scan(&n); err != nil || n != 2 {
+		t.Errorf("%d jobs kept, %v; want 2", n, err)
+	}
+}
+
+func TestOpenNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mpcserver.db")
+	s, err := sqlitestore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("PRAGMA user_version = 99"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := sqlitestore.Open(path); err == nil {
+		t.Error("file of a newer schema opened")
+	}
+}
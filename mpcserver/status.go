@@ -0,0 +1,19 @@
+package mpcserver
+
+import "context"
+
+type statusKey struct{}
+
+// ReportStatus publishes a progress update such as "fetching metrics…" for
+// the request ctx belongs to. Clients connected over a transport that
+// carries intermediate updates, such as WebSocket, receive it; otherwise it
+// is discarded. Agents may call it from any goroutine.
+func ReportStatus(ctx context.Context, status string) {
+	if fn, ok := ctx.Value(statusKey{}).(func(string)); ok {
+		fn(status)
+	}
+}
+
+func withStatusFunc(ctx context.Context, fn func(string)) context.Context {
+	return context.WithValue(ctx, statusKey{}, fn)
+}
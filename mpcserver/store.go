@@ -0,0 +1,195 @@
+package mpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Store keeps the server state that should outlive the process: jobs, the
+// audit trail, the responses kept for replay to repeated idempotency keys,
+// and WebSocket sessions, so that a restarted server still answers for
+// them. Implementations must be safe for concurrent use; sqlitestore
+// provides one backed by a file.
+type Store interface {
+	JobStore
+	AuditSink
+	IdempotencyStore
+	SessionStore
+	io.Closer
+}
+
+// WithStore keeps the server's state in store, and records the audit trail
+// to it along with any other audit sinks. Without it jobs are kept in a
+// MemoryJobStore and the rest in the server's own memory. Shutdown closes
+// the store. Tenants keep their state in memory unless given a store of
+// their own.
+func WithStore(store Store) Option {
+	return func(s *Server) {
+		if store == nil {
+			return
+		}
+		s.jobs.store = store
+		s.audit = append(s.audit, store)
+		s.idempotency.store = store
+		s.ws.store = store
+	}
+}
+
+// ErrResponseNotFound is returned by an IdempotencyStore for unknown or
+// expired keys.
+var ErrResponseNotFound = errors.New("response not found")
+
+// StoredResponse is the response of a successful agent call made with an
+// Idempotency-Key.
+type StoredResponse struct {
+	// Fingerprint is the hex SHA-256 of the request, which repeats of the
+	// key must match.
+	Fingerprint string `json:"fingerprint"`
+	// Envelope is the JSON body the call returned.
+	Envelope  json.RawMessage `json:"envelope"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// IdempotencyStore keeps responses for replay. Keys are opaque to the
+// store. GetResponse returns ErrResponseNotFound for keys it does not hold
+// or whose ExpiresAt has passed. Calls still in flight are tracked in
+// memory only.
+type IdempotencyStore interface {
+	PutResponse(ctx context.Context, key string, resp StoredResponse) error
+	GetResponse(ctx context.Context, key string) (StoredResponse, error)
+}
+
+// ErrSessionNotFound is returned by a SessionStore for unknown or expired
+// sessions.
+var ErrSessionNotFound = errors.New("session not found")
+
+// StoredSession is the state of a WebSocket session a client may resume.
+type StoredSession struct {
+	Token string `json:"token"`
+	// Seq is the sequence number of the last message sent.
+	Seq int64 `json:"seq"`
+	// Backlog holds the recent messages kept for replay, in order.
+	Backlog []json.RawMessage `json:"backlog,omitempty"`
+	// Pending lists the IDs of the requests that were running.
+	Pending   []string  `json:"pending,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionStore keeps WebSocket sessions, written as they send messages.
+// GetSession returns ErrSessionNotFound for sessions it does not hold or
+// whose ExpiresAt has passed.
+type SessionStore interface {
+	PutSession(ctx context.Context, sess StoredSession) error
+	GetSession(ctx context.Context, token string) (StoredSession, error)
+	DeleteSession(ctx context.Context, token string) error
+}
+
+// maxMemoryAudit bounds the audit records a MemoryStore keeps.
+const maxMemoryAudit = 10000
+
+// MemoryStore is a Store held in memory, as the server keeps its state
+// without one. It keeps the most recent 10000 audit records. Expired
+// entries are removed whenever one of their kind is written.
+type MemoryStore struct {
+	*MemoryJobStore
+
+	mu        sync.Mutex
+	audit     []AuditRecord
+	responses map[string]StoredResponse
+	sessions  map[string]StoredSession
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryJobStore: NewMemoryJobStore(),
+		responses:      make(map[string]StoredResponse),
+		sessions:       make(map[string]StoredSession),
+	}
+}
+
+// WriteAudit implements AuditSink.
+func (m *MemoryStore) WriteAudit(rec AuditRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.audit) >= maxMemoryAudit {
+		m.audit = slices.Delete(m.audit, 0, len(m.audit)-maxMemoryAudit+1)
+	}
+	m.audit = append(m.audit, rec)
+	return nil
+}
+
+// AuditRecords returns the audit records kept, oldest first.
+func (m *MemoryStore) AuditRecords() []AuditRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.audit)
+}
+
+// PutResponse implements IdempotencyStore.
+func (m *MemoryStore) PutResponse(_ context.Context, key string, resp StoredResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, r := range m.responses {
+		if !now.Before(r.ExpiresAt) {
+			delete(m.responses, k)
+		}
+	}
+	m.responses[key] = resp
+	return nil
+}
+
+// GetResponse implements IdempotencyStore.
+func (m *MemoryStore) GetResponse(_ context.Context, key string) (StoredResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.responses[key]
+	if !ok || !time.Now().Before(r.ExpiresAt) {
+		return StoredResponse{}, ErrResponseNotFound
+	}
+	return r, nil
+}
+
+// PutSession implements SessionStore.
+func (m *MemoryStore) PutSession(_ context.Context, sess StoredSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for t, s := range m.sessions {
+		if !now.Before(s.ExpiresAt) {
+			delete(m.sessions, t)
+		}
+	}
+	m.sessions[sess.Token] = sess
+	return nil
+}
+
+// GetSession implements SessionStore.
+func (m *MemoryStore) GetSession(_ context.Context, token string) (StoredSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[token]
+	if !ok || !time.Now().Before(s.ExpiresAt) {
+		return StoredSession{}, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+// DeleteSession implements SessionStore.
+func (m *MemoryStore) DeleteSession(_ context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, token)
+	return nil
+}
+
+// Close implements io.Closer. The store stays usable.
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// wsFrame is the part of a /ws message the store test reads.
+type wsFrame struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Seq         int64  `json:"seq"`
+	ResumeToken string `json:"resume_token"`
+	Resumed     bool   `json:"resumed"`
+	StatusCode  int    `json:"status_code"`
+	Error       *struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+// storeServer starts a server keeping its state in store, as a process
+// of its own would.
+func storeServer(t *testing.T, store mpcserver.Store) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	calls := new(atomic.Int32)
+	release := make(chan struct{})
+	s := mpcserver.New(mpcserver.WithStore(store))
+	s.Register("count", countingAgent{calls})
+	s.Register("echo", echoAgent{})
+	s.Register("block", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return mpcserver.Response{}, ctx.Err()
+		}
+		return mpcserver.Response{Result: "unblocked"}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		close(release)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+		ts.Close()
+	})
+	return ts, calls
+}
+
+func TestStoreSurvivesRestart(t *testing.T) {
+	store := mpcserver.NewMemoryStore()
+	ctx := context.Background()
+	first, _ := storeServer(t, store)
+	c, _ := mpcclient.NewClient(first.URL)
+
+	job, err := c.SubmitJob(ctx, "echo", mpcclient.AgentRequest{Prompt: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WaitJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := c.CallAgent(ctx, "count", "hello", mpcclient.WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave a WebSocket request running when the first server goes away.
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(first.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hello wsFrame
+	if err := wsjson.Read(ctx, conn, &hello); err != nil {
+		t.Fatal(err)
+	}
+	if err := wsjson.Write(ctx, conn, map[string]any{"type": "request", "id": "r1", "agent": "block", "request": map[string]string{"prompt": "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	conn.CloseNow()
+
+	second, calls := storeServer(t, store)
+	c, _ = mpcclient.NewClient(second.URL)
+	got, err := c.GetJob(ctx, job.ID)
+	if err != nil || got.Status != mpcclient.JobSucceeded || got.Response == nil || got.Response.Result != "echo: logs" {
+		t.Errorf("job after restart = %+v, %v", got, err)
+	}
+	again, err := c.CallAgent(ctx, "count", "hello", mpcclient.WithIdempotencyKey("k1"))
+	if err != nil || again.Result != answer.Result || again.RequestID != answer.RequestID || calls.Load() != 0 {
+		t.Errorf("repeat after restart = %+v, %v, with %d calls", again, err, calls.Load())
+	}
+	var apiErr *mpcclient.APIError
+	if _, err := c.CallAgent(ctx, "count", "other", mpcclient.WithIdempotencyKey("k1")); !errors.As(err, &apiErr) || apiErr.Code != mpcserver.CodeIdempotencyKeyReused {
+		t.Errorf("reused key after restart: err = %v", err)
+	}
+
+	// The session resumes, and the request lost with the first server is
+	// reported as interrupted.
+	var sess wsFrame
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.Type == "" && time.Now().Before(deadline) {
+		conn, _, err = websocket.Dial(ctx, "ws"+strings.TrimPrefix(second.URL, "http")+"/ws?resume="+hello.ResumeToken, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wsjson.Read(ctx, conn, &sess); err != nil {
+			t.Fatal(err)
+		}
+		if !sess.Resumed {
+			// The first server has not written the request yet.
+			conn.CloseNow()
+			sess = wsFrame{}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	defer conn.CloseNow()
+	if !sess.Resumed || sess.ResumeToken != hello.ResumeToken {
+		t.Fatalf("hello after restart = %+v", sess)
+	}
+	var lost wsFrame
+	if err := wsjson.Read(ctx, conn, &lost); err != nil {
+		t.Fatal(err)
+	}
+	if lost.Type != "error" || lost.ID != "r1" || lost.StatusCode != http.StatusServiceUnavailable || lost.Error == nil || lost.Error.Code != mpcserver.CodeShuttingDown {
+		t.Errorf("interrupted request = %+v", lost)
+	}
+
+	// Replays run no agent and are not audited.
+	var agents []string
+	for _, rec := range store.AuditRecords() {
+		agents = append(agents, rec.Agent)
+	}
+	if strings.Join(agents, ",") != "echo,count" {
+		t.Errorf("audited agents %q", agents)
+	}
+}
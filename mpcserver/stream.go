@@ -0,0 +1,132 @@
+package mpcserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultStreamKeepAlive is how often a stream that has nothing to send
+// carries a keepalive comment, unless WithStreamKeepAlive says otherwise.
+const DefaultStreamKeepAlive = 15 * time.Second
+
+// WithStreamKeepAlive sets how often /agent/{name}/stream sends a
+// ": keepalive" comment while it has nothing else to send, such as before
+// a slow agent answers, so that proxies and load balancers do not close
+// the idle connection and clients can tell a quiet stream from a dead one.
+// Zero or less turns keepalives off.
+func WithStreamKeepAlive(d time.Duration) Option {
+	return func(s *Server) {
+		s.streamKeepAlive = d
+	}
+}
+
+// streamDone is the data of the final event of a stream.
+type streamDone struct {
+	FinishReason string `json:"finish_reason"`
+	RequestID    string `json:"request_id,omitempty"`
+}
+
+// handleStream runs an agent call as a text/event-stream: status updates
+// as "status" events while the call runs, keepalive comments when it is
+// quiet, then the result as a chunk followed by a "done" event, or an
+// "error" event. Until the first event is due, the call may still fail
+// with an ordinary error response, as when it is invalid or over a limit.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	defer s.metrics.openStream("sse")()
+	name := r.PathValue("name")
+	if _, _, ok := s.registry.Lookup(name); !ok {
+		writeError(w, Errorf(http.StatusNotFound, CodeAgentNotFound, "agent %q not found", name))
+		return
+	}
+	req, apiErr := s.decodeAgentRequest(w, r)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	req.RequestID = w.Header().Get(requestIDHeader)
+
+	// Status updates may arrive from any goroutine; they go through
+	// updates to the writing loop, as on the gRPC transport.
+	updates := make(chan string, 16)
+	ctx := withStatusFunc(r.Context(), func(status string) {
+		select {
+		case updates <- status:
+		case <-r.Context().Done():
+		}
+	})
+	type outcome struct {
+		resp   *responseEnvelope
+		apiErr *Error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		resp, apiErr := s.invoke(ctx, name, req)
+		done <- outcome{resp, apiErr}
+	}()
+
+	rc := http.NewResponseController(w)
+	started := false
+	send := func(write func(w io.Writer)) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		write(w)
+		return rc.Flush()
+	}
+	var keepAlive <-chan time.Time
+	if s.streamKeepAlive > 0 {
+		t := time.NewTicker(s.streamKeepAlive)
+		defer t.Stop()
+		keepAlive = t.C
+	}
+	for {
+		select {
+		case st := <-updates:
+			if send(func(w io.Writer) { writeEvent(w, "", "status", map[string]string{"status": st}) }) != nil {
+				return
+			}
+		case <-keepAlive:
+			if send(func(w io.Writer) { fmt.Fprint(w, ": keepalive\n\n") }) != nil {
+				return
+			}
+		case o := <-done:
+			for len(updates) > 0 {
+				st := <-updates
+				send(func(w io.Writer) { writeEvent(w, "", "status", map[string]string{"status": st}) })
+			}
+			if o.apiErr != nil {
+				if !started {
+					writeError(w, o.apiErr)
+					return
+				}
+				send(func(w io.Writer) {
+					writeEvent(w, "", "error", errorBody{Error: o.apiErr.Message, Code: o.apiErr.Code, Details: o.apiErr.Details, RequestID: req.RequestID})
+				})
+				return
+			}
+			send(func(w io.Writer) {
+				writeEvent(w, "1", "chunk", map[string]string{"text": o.resp.Result})
+				writeEvent(w, "2", "done", streamDone{FinishReason: "stop", RequestID: req.RequestID})
+			})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one server-sent event with v as its JSON data.
+func writeEvent(w io.Writer, id, typ string, v any) {
+	data, _ := json.Marshal(v)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ, data)
+}
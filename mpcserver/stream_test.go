@@ -0,0 +1,103 @@
+package mpcserver_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestStreamEndpoint(t *testing.T) {
+	s := mpcserver.New(mpcserver.WithStreamKeepAlive(10 * time.Millisecond))
+	s.Register("echo", echoAgent{})
+	s.Register("slow", mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		mpcserver.ReportStatus(ctx, "thinking")
+		time.Sleep(60 * time.Millisecond)
+		if req.Prompt == "fail" {
+			return mpcserver.Response{}, errors.New("backend gone")
+		}
+		return mpcserver.Response{Result: "done thinking"}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	res, err := http.Post(ts.URL+"/agent/slow/stream", "application/json", strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	body := string(b)
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, want := range []string{"event: status\ndata: {\"status\":\"thinking\"}", ": keepalive\n\n", "id: 1\nevent: chunk\ndata: {\"text\":\"done thinking\"}", "event: done\ndata: {\"finish_reason\":\"stop\""} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream lacks %q:\n%s", want, body)
+		}
+	}
+
+	// A client with an idle budget shorter than the agent's silence keeps
+	// the stream alive on the heartbeats alone.
+	var got strings.Builder
+	var first time.Duration
+	c, _ := mpcclient.NewClient(ts.URL,
+		mpcclient.WithTimeBudget(mpcclient.Budget{StreamIdle: 40 * time.Millisecond}),
+		mpcclient.WithCallHook(func(_ context.Context, ex mpcclient.Exchange) { first = ex.TimeToFirstChunk }))
+	err = c.StreamAgent(context.Background(), "slow", "hi", func(ch mpcclient.Chunk) error {
+		got.WriteString(ch.Text)
+		return nil
+	})
+	if err != nil || got.String() != "done thinking" {
+		t.Fatalf("stream = %q, %v", got.String(), err)
+	}
+	if first < 60*time.Millisecond {
+		t.Errorf("time to first chunk = %v, want the agent's 60ms at least", first)
+	}
+
+	// Failures once the stream has started arrive as error events.
+	err = c.StreamAgent(context.Background(), "slow", "fail", func(mpcclient.Chunk) error { return nil })
+	var se *mpcclient.StreamError
+	if !errors.As(err, &se) || se.Code != mpcserver.CodeAgentError {
+		t.Errorf("failed stream: err = %v", err)
+	}
+	// Before, they are ordinary error responses.
+	err = c.StreamAgent(context.Background(), "echo", "bad", func(mpcclient.Chunk) error { return nil })
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("rejected stream: err = %v", err)
+	}
+	err = c.StreamAgent(context.Background(), "missing", "hi", func(mpcclient.Chunk) error { return nil })
+	if !errors.Is(err, mpcclient.ErrAgentNotFound) {
+		t.Errorf("unknown agent: err = %v", err)
+	}
+}
+
+func TestStreamKeepAliveOff(t *testing.T) {
+	s := mpcserver.New(mpcserver.WithStreamKeepAlive(0))
+	s.Register("slow", mpcserver.AgentFunc(func(context.Context, mpcserver.Request) (mpcserver.Response, error) {
+		time.Sleep(30 * time.Millisecond)
+		return mpcserver.Response{Result: "ok"}, nil
+	}))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	res, err := http.Post(ts.URL+"/agent/slow/stream", "application/json", strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		if strings.HasPrefix(sc.Text(), ":") {
+			t.Errorf("keepalive sent: %q", sc.Text())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package mpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+// ErrDuplicateTenant is returned by AddTenant for an ID already in use.
+var ErrDuplicateTenant = errors.New("tenant already exists")
+
+// TenantPathPrefix is the path under which tenants are served, followed by
+// the tenant ID.
+const TenantPathPrefix = "/tenant/"
+
+// tenantID matches valid tenant IDs.
+var tenantID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+// AddTenant adds a tenant to the server: an isolated set of agents, API
+// keys, quotas and limits, served under /tenant/{id}/ with the endpoints
+// the server serves at its root, such as /tenant/{id}/agent/{name}. opts
+// configure the tenant as they would a server, and agents are registered
+// on the returned Server. Only the tenant's own API keys, set with
+// WithAPIKeys and WithAdminKey among opts, reach its agents; those of the
+// server do not.
+//
+// Tenants share the server's listener, logger, audit sinks, stream
+// keepalive interval and metrics, where their agents are labeled
+// "id/name", and are served over HTTP and WebSocket but not gRPC. Start and Shutdown on the server start and stop
+// the agents of its tenants too.
+func (s *Server) AddTenant(id string, opts ...Option) (*Server, error) {
+	if s.parent != nil {
+		return nil, errors.New("mpcserver: tenants cannot have tenants")
+	}
+	if !tenantID.MatchString(id) {
+		return nil, fmt.Errorf("mpcserver: invalid tenant ID %q: use up to 63 letters, digits, - and _", id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[id]; ok {
+		return nil, fmt.Errorf("mpcserver: tenant %q: %w", id, ErrDuplicateTenant)
+	}
+	inherit := func(t *Server) {
+		t.parent, t.tenantID = s, id
+		t.metrics, t.metricsRegistry = s.metrics, s.metricsRegistry
+		t.streamKeepAlive = s.streamKeepAlive
+		if s.logger != nil {
+			t.logger = s.logger.With("tenant", id)
+		}
+	}
+	t := New(append([]Option{inherit}, opts...)...)
+	if s.tenants == nil {
+		s.tenants = make(map[string]*Server)
+	}
+	s.tenants[id] = t
+	return t, nil
+}
+
+// Tenant returns the tenant added under id.
+func (s *Server) Tenant(id string) (*Server, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tenants[id]
+	return t, ok
+}
+
+// Tenants returns the IDs of the server's tenants, sorted.
+func (s *Server) Tenants() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.tenants))
+}
+
+// tenantList returns the server's tenants in ID order.
+func (s *Server) tenantList() []*Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts := make([]*Server, 0, len(s.tenants))
+	for _, id := range slices.Sorted(maps.Keys(s.tenants)) {
+		ts = append(ts, s.tenants[id])
+	}
+	return ts
+}
+
+// handleTenant routes a request under TenantPathPrefix to its tenant,
+// with the prefix removed.
+func (s *Server) handleTenant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("tenant")
+	t, ok := s.Tenant(id)
+	if !ok {
+		writeError(w, Errorf(http.StatusNotFound, CodeTenantNotFound, "tenant %q not found", id))
+		return
+	}
+	http.StripPrefix(TenantPathPrefix+id, t.handler).ServeHTTP(w, r)
+}
+
+// metricLabel returns the agent label of name in the server's metrics,
+// qualified with the tenant ID on tenants.
+func (s *Server) metricLabel(name string) string {
+	if s.tenantID == "" {
+		return name
+	}
+	return s.tenantID + "/" + name
+}
+
+// startTenants starts the agents of the server's tenants, stopping those
+// it started if one fails.
+func (s *Server) startTenants(ctx context.Context) error {
+	var started []*Server
+	for _, t := range s.tenantList() {
+		if err := t.Start(ctx); err != nil {
+			for _, t := range slices.Backward(started) {
+				t.stopAgents(ctx)
+			}
+			return fmt.Errorf("mpcserver: tenant %q: %w", t.tenantID, err)
+		}
+		started = append(started, t)
+	}
+	return nil
+}
+
+// shutdownTenants shuts the server's tenants down.
+func (s *Server) shutdownTenants(ctx context.Context) error {
+	var errs []error
+	for _, t := range s.tenantList() {
+		if err := t.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %q: %w", t.tenantID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
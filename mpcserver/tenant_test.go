@@ -0,0 +1,132 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestTenants(t *testing.T) {
+	sink := &memoryAuditSink{}
+	s := mpcserver.New(mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "ops", Key: "root-key"}), mpcserver.WithAuditLog(sink))
+	s.Register("echo", echoAgent{})
+	blue, err := s.AddTenant("blue", mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "team", Key: "blue-key", DailyTokens: 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold := &callHold{}
+	blue.Register("echo", echoAgent{})
+	blue.Register("versioned", versionedAgent{version: "blue", hold: hold})
+	red, _ := s.AddTenant("red", mpcserver.WithAPIKeys(mpcserver.APIKey{Name: "team", Key: "red-key"}))
+	red.Register("echo", echoAgent{})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	call := func(tenant, key, agent string) (*mpcclient.AgentResponse, error) {
+		opts := []mpcclient.Option{mpcclient.WithAPIKey(key)}
+		if tenant != "" {
+			opts = append(opts, mpcclient.WithTenant(tenant))
+		}
+		c, err := mpcclient.NewClient(ts.URL, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.CallAgent(ctx, agent, "hi")
+	}
+	if resp, err := call("blue", "blue-key", "versioned"); err != nil || resp.Result != "blue" {
+		t.Errorf("blue agent: %+v, %v", resp, err)
+	}
+	if resp, err := call("", "root-key", "echo"); err != nil || resp.Result != "echo: hi" {
+		t.Errorf("server agent: %+v, %v", resp, err)
+	}
+	// Keys work only on their own tenant.
+	for _, tc := range []struct{ tenant, key, agent string }{
+		{"blue", "red-key", "echo"},
+		{"blue", "root-key", "echo"},
+		{"", "blue-key", "echo"},
+	} {
+		if _, err := call(tc.tenant, tc.key, tc.agent); !errors.Is(err, mpcclient.ErrUnauthorized) {
+			t.Errorf("tenant %q with %s: err = %v, want unauthorized", tc.tenant, tc.key, err)
+		}
+	}
+	if _, err := call("red", "red-key", "versioned"); !errors.Is(err, mpcclient.ErrAgentNotFound) {
+		t.Errorf("other tenant's agent: err = %v", err)
+	}
+	// The tenant's quotas apply: echo reports 3 tokens a call.
+	call("blue", "blue-key", "echo")
+	call("blue", "blue-key", "echo")
+	if _, err := call("blue", "blue-key", "echo"); !errors.Is(err, mpcclient.ErrQuotaExceeded) {
+		t.Errorf("over the tenant key's quota: err = %v", err)
+	}
+
+	c, _ := mpcclient.NewClient(ts.URL, mpcclient.WithTenant("blue"), mpcclient.WithAPIKey("blue-key"))
+	agents, err := c.ListAgents(ctx)
+	if err != nil || len(agents) != 2 {
+		t.Errorf("blue agents: %+v, %v", agents, err)
+	}
+	res, err := http.Get(ts.URL + "/tenant/green/agents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound || !strings.Contains(string(b), mpcserver.CodeTenantNotFound) {
+		t.Errorf("unknown tenant: %d %s", res.StatusCode, b)
+	}
+
+	res, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	for _, want := range []string{
+		`mpcserver_agent_calls_total{agent="blue/versioned",code="200"} 1`,
+		`mpcserver_agent_calls_total{agent="echo",code="200"} 1`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if res, _ := http.Get(ts.URL + "/tenant/blue/metrics"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("tenant metrics served: %d", res.StatusCode)
+	}
+
+	sink.mu.Lock()
+	tenants := make([]string, len(sink.records))
+	for i, rec := range sink.records {
+		tenants[i] = rec.Tenant
+	}
+	sink.mu.Unlock()
+	if !slices.Contains(tenants, "blue") || !slices.Contains(tenants, "") {
+		t.Errorf("audited tenants %q", tenants)
+	}
+
+	if _, err := s.AddTenant("blue"); !errors.Is(err, mpcserver.ErrDuplicateTenant) {
+		t.Errorf("duplicate tenant: err = %v", err)
+	}
+	if _, err := s.AddTenant("a/b"); err == nil {
+		t.Error("invalid tenant ID accepted")
+	}
+	if got := s.Tenants(); !slices.Equal(got, []string{"blue", "red"}) {
+		t.Errorf("Tenants() = %v", got)
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stopped := hold.stops(); !slices.Equal(stopped, []string{"blue"}) {
+		t.Errorf("tenant agents stopped: %v", stopped)
+	}
+}
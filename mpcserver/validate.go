@@ -0,0 +1,155 @@
+package mpcserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Default request limits.
+const (
+	DefaultMaxBodySize     = 1 << 20
+	DefaultMaxPromptLength = 100_000
+	DefaultMaxMessages     = 500
+)
+
+// RequestLimits bounds the agent requests a server accepts, whatever the
+// transport. Zero fields take the documented defaults.
+type RequestLimits struct {
+	// MaxBodySize is the largest JSON request body in bytes, not counting
+	// attachments, which AttachmentLimits bound. It also bounds WebSocket
+	// messages. It defaults to DefaultMaxBodySize.
+	MaxBodySize int64
+	// MaxPromptLength is the longest prompt in characters. It defaults to
+	// DefaultMaxPromptLength.
+	MaxPromptLength int
+	// MaxMessages is the longest conversation history a request may carry.
+	// It defaults to DefaultMaxMessages.
+	MaxMessages int
+}
+
+// WithRequestLimits sets the size limits on agent requests.
+func WithRequestLimits(l RequestLimits) Option {
+	if l.MaxBodySize <= 0 {
+		l.MaxBodySize = DefaultMaxBodySize
+	}
+	if l.MaxPromptLength <= 0 {
+		l.MaxPromptLength = DefaultMaxPromptLength
+	}
+	if l.MaxMessages <= 0 {
+		l.MaxMessages = DefaultMaxMessages
+	}
+	return func(s *Server) {
+		s.limits = l
+	}
+}
+
+// messageRoles are the roles a conversation message may have.
+var messageRoles = []string{"system", "user", "assistant"}
+
+// checkRequest rejects a request the agent described by info should not
+// see: one missing its prompt, exceeding the server's limits, carrying
+// malformed messages or tools, with parameters, generation settings or a
+// format the agent does not accept, or with requirements it does not meet.
+func (s *Server) checkRequest(info AgentInfo, req Request) *Error {
+	if strings.TrimSpace(req.Prompt) == "" {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "prompt is required")
+	}
+	if n := utf8.RuneCountInString(req.Prompt); n > s.limits.MaxPromptLength {
+		return Errorf(http.StatusRequestEntityTooLarge, CodePromptTooLong, "prompt of %d characters exceeds the limit of %d", n, s.limits.MaxPromptLength)
+	}
+	if apiErr := checkPriority(req.Priority); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := checkBoard(req.Board); apiErr != nil {
+		return apiErr
+	}
+	if n := len(req.Messages); n > s.limits.MaxMessages {
+		return Errorf(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "%d messages exceed the limit of %d", n, s.limits.MaxMessages)
+	}
+	for i, m := range req.Messages {
+		if !slices.Contains(messageRoles, m.Role) {
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "messages[%d]: role %q is not one of %s", i, m.Role, strings.Join(messageRoles, ", "))
+		}
+	}
+	tools := make(map[string]bool, len(req.Tools))
+	for i, t := range req.Tools {
+		switch {
+		case t.Name == "":
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "tools[%d]: name is required", i)
+		case tools[t.Name]:
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "tools[%d]: tool %q is declared twice", i, t.Name)
+		case len(t.Parameters) > 0 && !json.Valid(t.Parameters):
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "tools[%d]: parameters are not valid JSON", i)
+		}
+		tools[t.Name] = true
+	}
+	for i, r := range req.ToolResults {
+		if r.Name == "" && r.ID == "" {
+			return Errorf(http.StatusBadRequest, CodeInvalidRequest, "tool_results[%d]: id or name is required", i)
+		}
+	}
+	if apiErr := checkParameters(info.Parameters, req.Parameters); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := checkMetadata(req.Metadata); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := checkGeneration(info, req.Generation); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := checkRequirements(info, req.Requires); apiErr != nil {
+		return apiErr
+	}
+	if req.Format != "" && len(info.Formats) > 0 && !slices.Contains(info.Formats, req.Format) {
+		return Errorf(http.StatusNotAcceptable, CodeUnsupportedFormat, "agent %q cannot produce format %q; it supports %s",
+			info.Name, req.Format, strings.Join(info.Formats, ", "))
+	}
+	return nil
+}
+
+// checkContentType rejects a body whose Content-Type is not among types.
+// A body without one is taken to be JSON, as curl and many scripts send
+// it. It returns the media type.
+func checkContentType(r *http.Request, types ...string) (string, *Error) {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return "application/json", nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil || !slices.Contains(types, mt) {
+		return "", Errorf(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "content type %q is not supported; send %s", ct, strings.Join(types, " or "))
+	}
+	return mt, nil
+}
+
+// decodeJSON reads a JSON request body of at most the server's
+// MaxBodySize into v, rejecting anything after the JSON value.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v any) *Error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.limits.MaxBodySize))
+	if err := dec.Decode(v); err != nil {
+		return bodyError(err, "invalid JSON body")
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return bodyError(err, "invalid JSON body: unexpected data after the request")
+	}
+	return nil
+}
+
+// bodyError maps a failure reading the request body onto the response to
+// send.
+func bodyError(err error, msg string) *Error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Errorf(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+	}
+	if err == nil {
+		return Errorf(http.StatusBadRequest, CodeInvalidRequest, "%s", msg)
+	}
+	return Errorf(http.StatusBadRequest, CodeInvalidRequest, "%s: %v", msg, err)
+}
@@ -0,0 +1,72 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+func TestServerRejectsInvalidRequests(t *testing.T) {
+	s := mpcserver.New(mpcserver.WithRequestLimits(mpcserver.RequestLimits{MaxBodySize: 256, MaxPromptLength: 20, MaxMessages: 2}))
+	s.Register("echo", echoAgent{})
+	s.Register("embedder", lengthEmbedder{})
+	tests := []struct {
+		name, path, contentType, body string
+		status                        int
+		code                          string
+	}{
+		{"form body", "/agent/echo", "application/x-www-form-urlencoded", "prompt=hi", http.StatusUnsupportedMediaType, mpcserver.CodeUnsupportedMediaType},
+		{"text embed body", "/agent/embedder/embed", "text/plain", "hi", http.StatusUnsupportedMediaType, mpcserver.CodeUnsupportedMediaType},
+		{"body too large", "/agent/echo", "application/json", `{"prompt":"` + strings.Repeat("x", 300) + `"}`, http.StatusRequestEntityTooLarge, mpcserver.CodeRequestTooLarge},
+		{"trailing data", "/agent/echo", "application/json", `{"prompt":"hi"} {"prompt":"again"}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"blank prompt", "/agent/echo", "application/json; charset=utf-8", `{"prompt":"  "}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"long prompt", "/agent/echo", "application/json", `{"prompt":"` + strings.Repeat("é", 21) + `"}`, http.StatusRequestEntityTooLarge, mpcserver.CodePromptTooLong},
+		{"too many messages", "/agent/echo", "application/json", `{"prompt":"hi","messages":[{"role":"user"},{"role":"user"},{"role":"user"}]}`, http.StatusRequestEntityTooLarge, mpcserver.CodeRequestTooLarge},
+		{"bad role", "/agent/echo", "application/json", `{"prompt":"hi","messages":[{"role":"robot","content":"x"}]}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"bad priority", "/agent/echo", "application/json", `{"prompt":"hi","priority":"urgent"}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"unnamed tool", "/agent/echo", "application/json", `{"prompt":"hi","tools":[{"description":"x"}]}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"duplicate tool", "/agent/echo", "application/json", `{"prompt":"hi","tools":[{"name":"a"},{"name":"a"}]}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"anonymous tool result", "/agent/echo", "application/json", `{"prompt":"hi","tool_results":[{"output":1}]}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+		{"job with blank prompt", "/jobs/echo", "application/json", `{"prompt":""}`, http.StatusBadRequest, mpcserver.CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != tt.status || !strings.Contains(rec.Body.String(), `"code":"`+tt.code+`"`) {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, rec.Code, rec.Body, tt.status, tt.code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/agent/echo", strings.NewReader(`{"prompt":"no content type"}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("body without content type: got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestClientMapsValidationErrors(t *testing.T) {
+	ts := httptest.NewServer(func() http.Handler {
+		s := mpcserver.New(mpcserver.WithRequestLimits(mpcserver.RequestLimits{MaxPromptLength: 10}))
+		s.Register("echo", echoAgent{})
+		return s
+	}())
+	defer ts.Close()
+	c, _ := mpcclient.NewClient(ts.URL)
+
+	_, err := c.CallAgent(context.Background(), "echo", strings.Repeat("x", 11))
+	if !errors.Is(err, mpcclient.ErrRequestTooLarge) || !errors.Is(err, mpcclient.ErrInvalidRequest) || mpcclient.Retryable(err) {
+		t.Errorf("long prompt: err = %v", err)
+	}
+	_, err = c.Invoke(context.Background(), "echo", mpcclient.AgentRequest{Prompt: "hi", Messages: []mpcclient.Message{{Role: "robot"}}})
+	if !errors.Is(err, mpcclient.ErrInvalidRequest) || errors.Is(err, mpcclient.ErrRequestTooLarge) {
+		t.Errorf("bad role: err = %v", err)
+	}
+}
@@ -0,0 +1,450 @@
+package mpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// WebSocket protocol defaults.
+const (
+	wsPingInterval = 20 * time.Second
+	wsWriteTimeout = 10 * time.Second
+	// wsSessionTTL is how long a disconnected session, and the results of
+	// its requests, are kept for the client to resume.
+	wsSessionTTL = 2 * time.Minute
+	// wsBacklog is how many recent messages a session keeps for replay.
+	wsBacklog = 256
+)
+
+// WebSocket message types. Clients send request and cancel; the server
+// sends hello, status, result and error, and shutdown before it closes the
+// connection on Shutdown.
+const (
+	wsTypeHello    = "hello"
+	wsTypeRequest  = "request"
+	wsTypeCancel   = "cancel"
+	wsTypeStatus   = "status"
+	wsTypeResult   = "result"
+	wsTypeError    = "error"
+	wsTypeShutdown = "shutdown"
+)
+
+// wsMessage is the envelope of every message on a /ws connection.
+type wsMessage struct {
+	Type string `json:"type"`
+	// ID correlates a request with its status, result, error and cancel
+	// messages.
+	ID string `json:"id,omitempty"`
+	// Seq numbers server messages so a resuming client can say which it
+	// has already seen.
+	Seq     int64             `json:"seq,omitempty"`
+	Agent   string            `json:"agent,omitempty"`
+	Request *Request          `json:"request,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Result  *responseEnvelope `json:"result,omitempty"`
+	Error   *errorBody        `json:"error,omitempty"`
+	// StatusCode is the HTTP-equivalent status of an error message.
+	StatusCode int `json:"status_code,omitempty"`
+	// RequestID is the caller's ID for a request, which the server keeps,
+	// and the server's ID for the request an error message reports.
+	RequestID string `json:"request_id,omitempty"`
+	// ResumeToken identifies the session in hello messages.
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Resumed reports in hello messages whether an earlier session was
+	// picked up.
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// wsHub tracks WebSocket sessions so clients can resume them after a
+// dropped connection, or after a restart when the server has a
+// SessionStore.
+type wsHub struct {
+	store  SessionStore
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*wsSession
+}
+
+// session returns the session for token, or a new one if token is empty or
+// unknown. The boolean reports whether an existing session was found.
+func (h *wsHub) session(ctx context.Context, token string) (*wsSession, bool) {
+	if token != "" {
+		h.mu.Lock()
+		sess, ok := h.sessions[token]
+		h.mu.Unlock()
+		if ok {
+			return sess, true
+		}
+		if sess := h.restore(ctx, token); sess != nil {
+			return sess, true
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[string]*wsSession)
+	}
+	sess := h.newSession(newRequestID())
+	h.sessions[sess.token] = sess
+	return sess, false
+}
+
+func (h *wsHub) newSession(token string) *wsSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsSession{
+		hub:      h,
+		token:    token,
+		ctx:      ctx,
+		cancel:   cancel,
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// restore picks up the session for token from the store, as written by an
+// earlier process. The requests it was running are lost with that process;
+// each is answered with a shutting_down error the client can retry on.
+func (h *wsHub) restore(ctx context.Context, token string) *wsSession {
+	if h.store == nil {
+		return nil
+	}
+	stored, err := h.store.GetSession(ctx, token)
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			h.logError("load session", err)
+		}
+		return nil
+	}
+	sess := h.newSession(stored.Token)
+	sess.seq = stored.Seq
+	answered := make(map[string]bool)
+	for _, raw := range stored.Backlog {
+		var m wsMessage
+		if json.Unmarshal(raw, &m) != nil {
+			continue
+		}
+		sess.backlog = append(sess.backlog, m)
+		if m.Type == wsTypeResult || m.Type == wsTypeError {
+			answered[m.ID] = true
+		}
+	}
+
+	h.mu.Lock()
+	if cur, ok := h.sessions[token]; ok {
+		// Another connection restored it first.
+		h.mu.Unlock()
+		sess.cancel()
+		return cur
+	}
+	if h.sessions == nil {
+		h.sessions = make(map[string]*wsSession)
+	}
+	h.sessions[token] = sess
+	h.mu.Unlock()
+
+	for _, id := range stored.Pending {
+		if !answered[id] {
+			sess.send(wsMessage{Type: wsTypeError, ID: id, StatusCode: http.StatusServiceUnavailable,
+				Error: &errorBody{Error: "server restarted while the request was running", Code: CodeShuttingDown}})
+		}
+	}
+	return sess
+}
+
+func (h *wsHub) remove(sess *wsSession) {
+	h.mu.Lock()
+	delete(h.sessions, sess.token)
+	h.mu.Unlock()
+	if h.store != nil {
+		if err := h.store.DeleteSession(context.Background(), sess.token); err != nil {
+			h.logError("delete session", err)
+		}
+	}
+}
+
+func (h *wsHub) logError(msg string, err error) {
+	if h.logger != nil {
+		h.logger.Error(msg, "error", err)
+	}
+}
+
+// closeAll ends every session, cancels its requests and tells its client
+// the server is shutting down.
+func (h *wsHub) closeAll() {
+	h.mu.Lock()
+	sessions := h.sessions
+	h.sessions = nil
+	h.mu.Unlock()
+	var conns []*websocket.Conn
+	for _, sess := range sessions {
+		sess.cancel()
+		sess.mu.Lock()
+		if sess.conn != nil {
+			conns = append(conns, sess.conn)
+		}
+		sess.mu.Unlock()
+	}
+	for _, conn := range conns {
+		ctx, cancel := context.WithTimeout(context.Background(), wsWriteTimeout)
+		_ = wsjson.Write(ctx, conn, wsMessage{Type: wsTypeShutdown, Status: "server shutting down"})
+		cancel()
+		conn.Close(websocket.StatusGoingAway, "server shutting down")
+	}
+}
+
+// wsSession outlives individual connections: requests keep running while
+// the client reconnects, and their messages are replayed on resume.
+type wsSession struct {
+	hub    *wsHub
+	token  string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// writeMu serializes writes so messages reach the client in sequence
+	// order, including across a replay.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	seq     int64
+	backlog []wsMessage
+	conn    *websocket.Conn
+	// attachments counts attach calls, so an expiry timer can tell whether
+	// the client came back in the meantime.
+	attachments int
+	inflight    map[string]context.CancelFunc
+}
+
+// attach makes conn the session's connection, greets the client and
+// replays the messages it missed since lastSeq.
+func (sess *wsSession) attach(conn *websocket.Conn, lastSeq int64, resumed bool) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	sess.mu.Lock()
+	if old := sess.conn; old != nil && old != conn {
+		old.CloseNow()
+	}
+	sess.conn = conn
+	sess.attachments++
+	var missed []wsMessage
+	for _, m := range sess.backlog {
+		if m.Seq > lastSeq {
+			missed = append(missed, m)
+		}
+	}
+	sess.mu.Unlock()
+
+	hello := wsMessage{Type: wsTypeHello, ResumeToken: sess.token, Resumed: resumed}
+	if err := writeWS(sess.ctx, conn, hello); err != nil {
+		return err
+	}
+	for _, m := range missed {
+		if err := writeWS(sess.ctx, conn, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detach drops conn if it is still the session's connection and schedules
+// the session's expiry.
+func (sess *wsSession) detach(conn *websocket.Conn) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.conn != conn {
+		return
+	}
+	sess.conn = nil
+	gen := sess.attachments
+	time.AfterFunc(wsSessionTTL, func() {
+		sess.mu.Lock()
+		expired := sess.conn == nil && sess.attachments == gen
+		sess.mu.Unlock()
+		if expired {
+			sess.hub.remove(sess)
+			sess.cancel()
+		}
+	})
+}
+
+// send sequences msg, records it for replay and writes it to the current
+// connection, if any. A failed write closes the connection; the client
+// will pick the message up when it resumes.
+func (sess *wsSession) send(msg wsMessage) {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	sess.mu.Lock()
+	sess.seq++
+	msg.Seq = sess.seq
+	sess.backlog = append(sess.backlog, msg)
+	if n := len(sess.backlog) - wsBacklog; n > 0 {
+		sess.backlog = append(sess.backlog[:0], sess.backlog[n:]...)
+	}
+	conn := sess.conn
+	sess.mu.Unlock()
+	sess.save()
+
+	if conn == nil {
+		return
+	}
+	if err := writeWS(sess.ctx, conn, msg); err != nil {
+		conn.CloseNow()
+	}
+}
+
+func (sess *wsSession) startRequest(id string) context.Context {
+	ctx, cancel := context.WithCancel(sess.ctx)
+	sess.mu.Lock()
+	sess.inflight[id] = cancel
+	sess.mu.Unlock()
+	sess.save()
+	return ctx
+}
+
+// save writes the session to the hub's store, if any. Once the session
+// has ended, as on Shutdown, it is left as last written, so that the
+// requests cancelled with it are reported as interrupted on resume.
+func (sess *wsSession) save() {
+	store := sess.hub.store
+	if store == nil || sess.ctx.Err() != nil {
+		return
+	}
+	sess.mu.Lock()
+	stored := StoredSession{
+		Token:     sess.token,
+		Seq:       sess.seq,
+		Backlog:   make([]json.RawMessage, 0, len(sess.backlog)),
+		Pending:   slices.Sorted(maps.Keys(sess.inflight)),
+		ExpiresAt: time.Now().Add(wsSessionTTL),
+	}
+	for _, m := range sess.backlog {
+		if b, err := json.Marshal(m); err == nil {
+			stored.Backlog = append(stored.Backlog, b)
+		}
+	}
+	sess.mu.Unlock()
+	if err := store.PutSession(context.Background(), stored); err != nil {
+		sess.hub.logError("store session", err)
+	}
+}
+
+func (sess *wsSession) endRequest(id string) {
+	sess.mu.Lock()
+	cancel := sess.inflight[id]
+	delete(sess.inflight, id)
+	sess.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func writeWS(ctx context.Context, conn *websocket.Conn, msg wsMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, conn, msg)
+}
+
+// handleWebSocket upgrades the connection and serves agent requests over
+// it. Clients resume a session by passing its token and the last sequence
+// number they received as the resume and last_seq query parameters.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn.SetReadLimit(s.limits.MaxBodySize)
+	defer conn.CloseNow()
+	defer s.metrics.openStream("websocket")()
+
+	q := r.URL.Query()
+	lastSeq, _ := strconv.ParseInt(q.Get("last_seq"), 10, 64)
+	sess, resumed := s.ws.session(r.Context(), q.Get("resume"))
+	if err := sess.attach(conn, lastSeq, resumed); err != nil {
+		sess.detach(conn)
+		return
+	}
+	defer sess.detach(conn)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go pingWS(ctx, conn, wsPingInterval)
+
+	for {
+		var msg wsMessage
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case wsTypeRequest:
+			if s.stopping.Load() {
+				e := errShuttingDown()
+				sess.send(wsMessage{Type: wsTypeError, ID: msg.ID, StatusCode: e.Status, Error: &errorBody{Error: e.Message, Code: e.Code}})
+				continue
+			}
+			go s.serveWSRequest(apiKeyFrom(r.Context()), sess, msg)
+		case wsTypeCancel:
+			sess.endRequest(msg.ID)
+		}
+	}
+}
+
+// serveWSRequest runs msg with the API key its connection authenticated
+// with.
+func (s *Server) serveWSRequest(key *keyState, sess *wsSession, msg wsMessage) {
+	ctx := withAPIKey(sess.startRequest(msg.ID), key)
+	defer sess.endRequest(msg.ID)
+
+	var req Request
+	if msg.Request != nil {
+		req = *msg.Request
+	}
+	req.RequestID = requestID(msg.RequestID)
+	ctx = withStatusFunc(ctx, func(status string) {
+		sess.send(wsMessage{Type: wsTypeStatus, ID: msg.ID, Status: status})
+	})
+	resp, apiErr := s.invoke(ctx, msg.Agent, req)
+	if apiErr != nil {
+		sess.send(wsMessage{
+			Type:       wsTypeError,
+			ID:         msg.ID,
+			StatusCode: apiErr.Status,
+			RequestID:  req.RequestID,
+			Error:      &errorBody{Error: apiErr.Message, Code: apiErr.Code, Details: apiErr.Details, RequestID: req.RequestID},
+		})
+		return
+	}
+	sess.send(wsMessage{Type: wsTypeResult, ID: msg.ID, Result: resp})
+}
+
+// pingWS pings conn every interval and closes it when a ping goes
+// unanswered, which the read loop then observes.
+func pingWS(ctx context.Context, conn *websocket.Conn, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			pctx, cancel := context.WithTimeout(ctx, interval)
+			err := conn.Ping(pctx)
+			cancel()
+			if err != nil {
+				conn.CloseNow()
+				return
+			}
+		}
+	}
+}
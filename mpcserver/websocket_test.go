@@ -0,0 +1,176 @@
+package mpcserver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcserver"
+)
+
+// connTracker records server-side connections so tests can drop them.
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func (ct *connTracker) state(c net.Conn, s http.ConnState) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	switch s {
+	case http.StateNew:
+		ct.conns[c] = true
+	case http.StateClosed:
+		delete(ct.conns, c)
+	}
+}
+
+func (ct *connTracker) dropAll() {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	for c := range ct.conns {
+		c.Close()
+	}
+}
+
+func newWSTestServer(t *testing.T, agents map[string]mpcserver.Agent, opts ...mpcserver.Option) (*connTracker, *mpcclient.Client) {
+	t.Helper()
+	s := mpcserver.New(opts...)
+	for name, a := range agents {
+		if err := s.Register(name, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ct := &connTracker{conns: make(map[net.Conn]bool)}
+	ts := httptest.NewUnstartedServer(s)
+	ts.Config.ConnState = ct.state
+	ts.Start()
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	c, err := mpcclient.NewClient(ts.URL,
+		mpcclient.WithStrictDecoding(),
+		mpcclient.WithWebSocketTransport(mpcclient.WebSocketConfig{ReconnectDelay: 10 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return ct, c
+}
+
+func TestWebSocketRoundTrip(t *testing.T) {
+	progress := mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		mpcserver.ReportStatus(ctx, "thinking")
+		return mpcserver.Response{Result: "done: " + req.Prompt}, nil
+	})
+	_, c := newWSTestServer(t, map[string]mpcserver.Agent{"echo": echoAgent{}, "progress": progress})
+
+	var statuses []string
+	resp, err := c.CallAgent(context.Background(), "progress", "hi",
+		mpcclient.WithStatusHandler(func(s string) { statuses = append(statuses, s) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "done: hi" || resp.Status != "success" || resp.RequestID == "" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if len(statuses) != 1 || statuses[0] != "thinking" {
+		t.Errorf("statuses = %q", statuses)
+	}
+
+	// Concurrent calls share the connection.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := c.CallAgent(context.Background(), "echo", "x"); err != nil || resp.Result != "echo: x" {
+				t.Errorf("concurrent call = %+v, %v", resp, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err = c.CallAgent(context.Background(), "echo", "bad")
+	var apiErr *mpcclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "invalid_parameters" || apiErr.RequestID == "" {
+		t.Errorf("err = %v, want 400 invalid_parameters", err)
+	}
+}
+
+func TestWebSocketCancel(t *testing.T) {
+	cancelled := make(chan struct{})
+	block := mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return mpcserver.Response{}, ctx.Err()
+	})
+	_, c := newWSTestServer(t, map[string]mpcserver.Agent{"block": block})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallAgent(ctx, "block", "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent was not cancelled")
+	}
+}
+
+func TestWebSocketResumesAfterDrop(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := mpcserver.AgentFunc(func(ctx context.Context, req mpcserver.Request) (mpcserver.Response, error) {
+		close(started)
+		<-release
+		return mpcserver.Response{Result: "finished"}, nil
+	})
+	ct, c := newWSTestServer(t, map[string]mpcserver.Agent{"slow": slow})
+
+	type outcome struct {
+		resp *mpcclient.AgentResponse
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		resp, err := c.CallAgent(context.Background(), "slow", "hi")
+		done <- outcome{resp, err}
+	}()
+
+	<-started
+	ct.dropAll()
+	// Let the result be produced while the client is disconnected, so it
+	// can only arrive through the session replay.
+	close(release)
+
+	select {
+	case o := <-done:
+		if o.err != nil || o.resp.Result != "finished" {
+			t.Fatalf("got %+v, %v", o.resp, o.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not complete after reconnect")
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	_, c := newWSTestServer(t, map[string]mpcserver.Agent{"echo": echoAgent{}})
+	if _, err := c.CallAgent(context.Background(), "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallAgent(context.Background(), "echo", "hi"); !errors.Is(err, mpcclient.ErrTransportClosed) {
+		t.Errorf("err = %v, want ErrTransportClosed", err)
+	}
+}
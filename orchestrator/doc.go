@@ -0,0 +1,53 @@
+// Package orchestrator runs multi-agent workflows: chains where each
+// agent's answer feeds the next prompt, and fan-outs sending one prompt to
+// several agents at once and merging their answers.
+//
+// Workflows are built in code:
+//
+//	wf := orchestrator.New("vm-triage").
+//		Then("metrics", "azureVmMetricsAgent", "Check CPU for VM '{{.Input}}'", orchestrator.WithRetries(2, time.Second)).
+//		Parallel("review",
+//			orchestrator.Call("security", "securityAgent", "Review for risks:\n{{.Previous}}"),
+//			orchestrator.Call("cost", "costAgent", "Suggest savings:\n{{.Previous}}"),
+//		).
+//		Then("summary", "onboardingAgent", "Summarize for the on-call engineer:\n{{.Previous}}")
+//	res, err := wf.Run(ctx, client, "webserver01")
+//
+// or loaded from YAML with Load:
+//
+//	name: vm-triage
+//	steps:
+//	  - name: metrics
+//	    agent: azureVmMetricsAgent
+//	    prompt: "Check CPU for VM '{{.Input}}'"
+//	    retries: 2
+//	    retry_delay: 1s
+//	  - name: review
+//	    parallel:
+//	      - {name: security, agent: securityAgent, prompt: "Review for risks:\n{{.Previous}}"}
+//	      - {name: cost, agent: costAgent, prompt: "Suggest savings:\n{{.Previous}}"}
+//	  - name: summary
+//	    agent: onboardingAgent
+//	    prompt: "Summarize for the on-call engineer:\n{{.Previous}}"
+//
+// Prompts are text/template templates over Data: .Input is the workflow
+// input, .Vars the workflow's variables, .Previous the output of the step
+// before, and .Steps.<name> the StepResult of any earlier step. Templates
+// can also call contains, lower and trim. A parallel step's output is its
+// children's outputs under "## <name>" headings, or its merge template
+// rendered once they have all finished.
+//
+// Variables get their defaults under vars: and are set for a run with
+// WithVars. A step with an if: template runs only when it renders to a
+// true value, so that one workflow can serve several environments:
+//
+//	vars: {env: dev}
+//	steps:
+//	  - name: page
+//	    agent: onboardingAgent
+//	    prompt: "Draft a page for the on-call engineer:\n{{.Previous}}"
+//	    if: '{{and (eq .Vars.env "prod") (contains .Previous "High")}}'
+//
+// WithLogger logs each step as it finishes, and Result.Report records the
+// run, step by step, for printing or storing as JSON.
+package orchestrator
@@ -0,0 +1,271 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// fakeCaller answers each agent with a function of the prompt and records
+// the calls it receives.
+type fakeCaller struct {
+	mu     sync.Mutex
+	calls  map[string][]string
+	answer func(agent, prompt string, n int) (string, error)
+}
+
+func (f *fakeCaller) Invoke(_ context.Context, agent string, req mpcclient.AgentRequest, _ ...mpcclient.CallOption) (*mpcclient.AgentResponse, error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string][]string)
+	}
+	f.calls[agent] = append(f.calls[agent], req.Prompt)
+	n := len(f.calls[agent])
+	f.mu.Unlock()
+	out, err := f.answer(agent, req.Prompt, n)
+	if err != nil {
+		return nil, err
+	}
+	return &mpcclient.AgentResponse{Agent: agent, Result: out}, nil
+}
+
+func upper(agent, prompt string, _ int) (string, error) {
+	return agent + ":" + strings.ToUpper(prompt), nil
+}
+
+func TestRunChain(t *testing.T) {
+	wf := New("chain").
+		Then("first", "a", "hello {{.Input}}").
+		Then("second", "b", "got {{.Previous}} from {{.Steps.first.Agent}}")
+	res, err := wf.Run(context.Background(), &fakeCaller{answer: upper}, "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "b:GOT A:HELLO WORLD FROM A"
+	if res.Output != want {
+		t.Errorf("Output = %q, want %q", res.Output, want)
+	}
+	if len(res.Steps) != 2 || res.Steps[0].Output != "a:HELLO WORLD" || res.Steps[1].Attempts != 1 {
+		t.Errorf("Steps = %+v", res.Steps)
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	wf := New("fan").
+		Parallel("review",
+			Call("x", "a", "{{.Input}}"),
+			Call("y", "b", "{{.Input}}"),
+		).
+		ParallelWith("merged", []StepOption{WithMerge("{{.Steps.p.Output}}+{{.Steps.q.Output}}")},
+			Call("p", "c", "1"),
+			Call("q", "d", "2"),
+		)
+	res, err := wf.Run(context.Background(), &fakeCaller{answer: upper}, "in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, _ := res.Step("review")
+	if want := "## x\n\na:IN\n\n## y\n\nb:IN"; review.Output != want {
+		t.Errorf("review output = %q, want %q", review.Output, want)
+	}
+	if res.Output != "c:1+d:2" {
+		t.Errorf("Output = %q", res.Output)
+	}
+	if y, ok := res.Step("y"); !ok || y.Output != "b:IN" {
+		t.Errorf("Step(y) = %+v, %v", y, ok)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	flaky := func(agent, prompt string, n int) (string, error) {
+		if n < 3 {
+			return "", errors.New("unavailable")
+		}
+		return "ok", nil
+	}
+	wf := New("retry").Then("s", "a", "go", WithRetries(2, time.Millisecond))
+	res, err := wf.Run(context.Background(), &fakeCaller{answer: flaky}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := res.Steps[0]; s.Attempts != 3 || s.Output != "ok" {
+		t.Errorf("step = %+v", s)
+	}
+
+	wf = New("retry").Then("s", "a", "go", WithRetries(1, time.Millisecond)).Then("t", "b", "never")
+	f := &fakeCaller{answer: flaky}
+	res, err = wf.Run(context.Background(), f, "")
+	var se *StepError
+	if !errors.As(err, &se) || se.Step != "s" {
+		t.Fatalf("err = %v, want StepError for s", err)
+	}
+	if len(res.Steps) != 1 || res.Steps[0].Attempts != 2 || len(f.calls["b"]) != 0 {
+		t.Errorf("Steps = %+v, calls = %v", res.Steps, f.calls)
+	}
+}
+
+func TestRunContinueOnError(t *testing.T) {
+	fail := func(agent, prompt string, _ int) (string, error) {
+		if agent == "bad" {
+			return "", errors.New("boom")
+		}
+		return "fine", nil
+	}
+	wf := New("soft").
+		Then("s", "bad", "x", ContinueOnError()).
+		Then("t", "good", "[{{.Previous}}]")
+	f := &fakeCaller{answer: fail}
+	res, err := wf.Run(context.Background(), f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Steps[0].Err == nil || f.calls["good"][0] != "[]" {
+		t.Errorf("Steps = %+v, calls = %v", res.Steps, f.calls)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	src := `
+name: yaml
+steps:
+  - name: first
+    agent: a
+    prompt: "{{.Input}}"
+    retries: 2
+    retry_delay: 1s
+  - name: fan
+    parallel:
+      - {name: x, agent: b, prompt: "{{.Previous}}"}
+      - {name: y, agent: c, prompt: "{{.Previous}}"}
+    merge: "{{.Steps.x.Output}} {{.Steps.y.Output}}"
+`
+	wf, err := Load(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := wf.Steps[0]; s.Retries != 2 || s.RetryDelay != time.Second {
+		t.Errorf("first step = %+v", s)
+	}
+	res, err := wf.Run(context.Background(), &fakeCaller{answer: upper}, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "b:A:HI c:A:HI"; res.Output != want {
+		t.Errorf("Output = %q, want %q", res.Output, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]string{
+		"no steps":     "name: w\n",
+		"unknown key":  "name: w\nsteps:\n  - {name: s, agent: a, prompt: p, retry: 1}\n",
+		"duplicate":    "name: w\nsteps:\n  - {name: s, agent: a, prompt: p}\n  - {name: s, agent: a, prompt: p}\n",
+		"no agent":     "name: w\nsteps:\n  - {name: s, prompt: p}\n",
+		"both":         "name: w\nsteps:\n  - name: s\n    agent: a\n    parallel: [{name: t, agent: a, prompt: p}]\n",
+		"bad template": "name: w\nsteps:\n  - {name: s, agent: a, prompt: '{{.Input'}\n",
+		"bad if":       "name: w\nsteps:\n  - {name: s, agent: a, prompt: p, if: '{{eq .Vars'}\n",
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(strings.NewReader(src)); err == nil {
+				t.Error("Load succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRunVarsAndConditions(t *testing.T) {
+	src := `
+name: deploy-check
+vars: {env: dev, vm: web01}
+steps:
+  - name: metrics
+    agent: a
+    prompt: "Check {{.Vars.vm}} in {{.Vars.env}}"
+  - name: escalate
+    agent: b
+    prompt: "Page for {{.Previous}}"
+    if: '{{eq .Vars.env "prod"}}'
+  - name: review
+    parallel:
+      - {name: cost, agent: c, prompt: "{{.Previous}}", if: '{{contains .Steps.metrics.Output "DEV"}}'}
+      - {name: risk, agent: d, prompt: "{{.Previous}}", if: '{{contains (lower .Steps.metrics.Output) "prod"}}'}
+`
+	wf, err := Load(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller := &fakeCaller{answer: upper}
+	res, err := wf.Run(context.Background(), caller, "", WithVars(map[string]string{"vm": "db01"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "## cost\n\nc:A:CHECK DB01 IN DEV"; res.Output != want {
+		t.Errorf("Output = %q, want %q", res.Output, want)
+	}
+	if s, _ := res.Step("escalate"); !s.Skipped || len(caller.calls["b"]) != 0 {
+		t.Errorf("escalate = %+v, calls = %v", s, caller.calls)
+	}
+	if s, _ := res.Step("risk"); !s.Skipped {
+		t.Errorf("risk = %+v", s)
+	}
+
+	res, err = wf.Run(context.Background(), &fakeCaller{answer: upper}, "", WithVars(map[string]string{"env": "prod"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := res.Step("escalate"); s.Skipped || s.Prompt != "Page for a:CHECK WEB01 IN PROD" {
+		t.Errorf("escalate = %+v", s)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var logs strings.Builder
+	wf := New("report").
+		Then("first", "a", "{{.Input}}").
+		Then("skipped", "a", "{{.Input}}", When("false")).
+		Then("flaky", "flaky", "{{.Previous}}", WithRetries(1, time.Millisecond))
+	caller := &fakeCaller{answer: func(agent, prompt string, n int) (string, error) {
+		if agent == "flaky" {
+			return "", errors.New("agent unavailable")
+		}
+		return upper(agent, prompt, n)
+	}}
+	res, err := wf.Run(context.Background(), caller, "hi", WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if err == nil {
+		t.Fatal("Run succeeded, want the flaky step's error")
+	}
+	rep := res.Report()
+	if rep.OK() || rep.Workflow != "report" || len(rep.Steps) != 3 {
+		t.Fatalf("report = %+v", rep)
+	}
+	for i, want := range []Status{StatusSucceeded, StatusSkipped, StatusFailed} {
+		if got := rep.Steps[i].Status; got != want {
+			t.Errorf("step %d status = %s, want %s", i, got, want)
+		}
+	}
+	if s := rep.Steps[2]; s.Attempts != 2 || s.Error != "agent unavailable" {
+		t.Errorf("flaky step = %+v", s)
+	}
+	for _, want := range []string{"step finished", "step=first", "step skipped", "step attempt failed", "attempt=1", "step failed"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs lack %q:\n%s", want, logs.String())
+		}
+	}
+
+	var text strings.Builder
+	if err := rep.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"SKIPPED", "--- flaky: agent unavailable", "Workflow report failed"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text lacks %q:\n%s", want, text.String())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package orchestrator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a run or of one of its steps.
+type Status string
+
+// Outcomes of runs and steps.
+const (
+	// StatusSucceeded means the run or step finished without error.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed means the step failed or the run stopped on a failed
+	// step. A step marked ContinueOnError fails without failing the run.
+	StatusFailed Status = "failed"
+	// StatusSkipped means the step's If condition was false.
+	StatusSkipped Status = "skipped"
+)
+
+// Report is the machine-readable record of a run, as JSON for storing
+// alongside its output or comparing across runs.
+type Report struct {
+	Workflow string            `json:"workflow"`
+	Status   Status            `json:"status"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	Output   string            `json:"output"`
+	Error    string            `json:"error,omitempty"`
+	Duration time.Duration     `json:"duration"`
+	Steps    []StepReport      `json:"steps"`
+}
+
+// StepReport records how one step ran.
+type StepReport struct {
+	Name      string `json:"name"`
+	Agent     string `json:"agent,omitempty"`
+	Status    Status `json:"status"`
+	Prompt    string `json:"prompt,omitempty"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Attempts is how many times the agent was called.
+	Attempts int           `json:"attempts,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Children []StepReport  `json:"children,omitempty"`
+}
+
+// OK reports whether the run succeeded.
+func (r *Report) OK() bool {
+	return r.Status == StatusSucceeded
+}
+
+// Report returns the record of the run r is the result of.
+func (r *Result) Report() *Report {
+	rep := &Report{
+		Workflow: r.workflow,
+		Status:   StatusSucceeded,
+		Vars:     r.Vars,
+		Output:   r.Output,
+		Duration: r.Duration,
+		Steps:    stepReports(r.Steps),
+	}
+	if r.err != nil {
+		rep.Status, rep.Error = StatusFailed, r.err.Error()
+	}
+	return rep
+}
+
+func stepReports(results []StepResult) []StepReport {
+	reps := make([]StepReport, len(results))
+	for i, sr := range results {
+		rep := StepReport{
+			Name:     sr.Name,
+			Agent:    sr.Agent,
+			Status:   StatusSucceeded,
+			Prompt:   sr.Prompt,
+			Output:   sr.Output,
+			Attempts: sr.Attempts,
+			Duration: sr.Duration,
+			Children: stepReports(sr.Children),
+		}
+		switch {
+		case sr.Skipped:
+			rep.Status = StatusSkipped
+		case sr.Err != nil:
+			rep.Status, rep.Error = StatusFailed, sr.Err.Error()
+		}
+		if sr.Response != nil {
+			rep.RequestID = sr.Response.RequestID
+		}
+		reps[i] = rep
+	}
+	return reps
+}
+
+// WriteText writes the report as a table of its steps, parallel ones
+// indented under their group, followed by the errors of those that failed.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tAGENT\tSTATUS\tATTEMPTS\tDURATION")
+	var failed []StepReport
+	var walk func(steps []StepReport, indent string)
+	walk = func(steps []StepReport, indent string) {
+		for _, s := range steps {
+			fmt.Fprintf(tw, "%s%s\t%s\t%s\t%d\t%s\n", indent, s.Name, s.Agent, strings.ToUpper(string(s.Status)),
+				s.Attempts, s.Duration.Round(time.Millisecond))
+			if s.Status == StatusFailed && len(s.Children) == 0 {
+				failed = append(failed, s)
+			}
+			walk(s.Children, indent+"  ")
+		}
+	}
+	walk(r.Steps, "")
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range failed {
+		fmt.Fprintf(w, "\n--- %s: %s\n", s.Name, s.Error)
+	}
+	_, err := fmt.Fprintf(w, "\nWorkflow %s %s in %s.\n", r.Workflow, r.Status, r.Duration.Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,344 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Caller sends a request to an agent. *mpcclient.Client implements it.
+type Caller interface {
+	Invoke(ctx context.Context, agent string, req mpcclient.AgentRequest, opts ...mpcclient.CallOption) (*mpcclient.AgentResponse, error)
+}
+
+// Data is what prompt and merge templates are rendered against.
+type Data struct {
+	// Input is the input passed to Run.
+	Input string
+	// Vars holds the workflow's variables, as overridden by WithVars.
+	Vars map[string]string
+	// Previous is the output of the step before; for the first step it is
+	// Input.
+	Previous string
+	// Steps holds the result of every step that has finished, by name.
+	Steps map[string]StepResult
+}
+
+// StepResult records how one step ran.
+type StepResult struct {
+	Name  string
+	Agent string
+	// Prompt is the rendered prompt sent to Agent.
+	Prompt string
+	// Output is the agent's answer or, for a parallel step, the merged
+	// answers of its children.
+	Output   string
+	Response *mpcclient.AgentResponse
+	// Attempts is how many times the agent was called.
+	Attempts int
+	Duration time.Duration
+	Err      error
+	// Skipped records that the step's If condition was false, so that it
+	// did not run.
+	Skipped bool
+	// Children holds the results of a parallel step's steps, in the order
+	// they were declared.
+	Children []StepResult
+}
+
+// Result is the outcome of a workflow run.
+type Result struct {
+	// Output is the output of the last step.
+	Output string
+	// Steps holds the result of each top-level step that ran, in order.
+	Steps []StepResult
+	// Vars holds the variables the run used.
+	Vars     map[string]string
+	Duration time.Duration
+
+	workflow string
+	err      error
+}
+
+// Step returns the result of the named step, searching parallel children
+// too.
+func (r *Result) Step(name string) (StepResult, bool) {
+	for _, s := range r.Steps {
+		if s.Name == name {
+			return s, true
+		}
+		for _, c := range s.Children {
+			if c.Name == name {
+				return c, true
+			}
+		}
+	}
+	return StepResult{}, false
+}
+
+// StepError reports the step that stopped a workflow.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("orchestrator: step %q: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error { return e.Err }
+
+// RunOption configures a workflow run.
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	vars   map[string]string
+	logger *slog.Logger
+}
+
+// WithVars sets variables for templates to read under .Vars, overriding
+// the workflow's defaults.
+func WithVars(vars map[string]string) RunOption {
+	return func(c *runConfig) {
+		c.vars = vars
+	}
+}
+
+// WithLogger logs each step to logger as it finishes or is skipped, along
+// with the failed attempts of steps that are retried.
+func WithLogger(l *slog.Logger) RunOption {
+	return func(c *runConfig) {
+		c.logger = l
+	}
+}
+
+// runner carries what the steps of one run share.
+type runner struct {
+	caller   Caller
+	workflow string
+	logger   *slog.Logger
+}
+
+// Run executes the workflow with input, calling agents through caller.
+// Steps run in order, each after the one before has finished, and those
+// whose If condition is false are skipped. A failing step stops the run
+// unless it is marked ContinueOnError; Run then returns the results so far
+// along with a *StepError.
+func (w *Workflow) Run(ctx context.Context, caller Caller, input string, opts ...RunOption) (*Result, error) {
+	plans, err := w.compile()
+	if err != nil {
+		return nil, err
+	}
+	cfg := runConfig{logger: slog.New(slog.DiscardHandler)}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	vars := make(map[string]string, len(w.Vars)+len(cfg.vars))
+	maps.Copy(vars, w.Vars)
+	maps.Copy(vars, cfg.vars)
+
+	start := time.Now()
+	r := &runner{caller: caller, workflow: w.Name, logger: cfg.logger}
+	data := Data{Input: input, Vars: vars, Previous: input, Steps: make(map[string]StepResult)}
+	res := &Result{Output: input, Vars: vars, workflow: w.Name}
+	defer func() { res.Duration = time.Since(start) }()
+	for _, p := range plans {
+		sr := r.run(ctx, p, data)
+		res.Steps = append(res.Steps, sr)
+		data.Steps[sr.Name] = sr
+		for _, c := range sr.Children {
+			data.Steps[c.Name] = c
+		}
+		if sr.Err != nil && !p.ContinueOnError {
+			res.err = &StepError{Step: sr.Name, Err: sr.Err}
+			return res, res.err
+		}
+		if !sr.Skipped {
+			data.Previous = sr.Output
+			res.Output = sr.Output
+		}
+	}
+	return res, nil
+}
+
+// run executes one step against data, logging how it went.
+func (r *runner) run(ctx context.Context, p *plan, data Data) StepResult {
+	sr := StepResult{Name: p.Name, Agent: p.Agent}
+	if p.cond != nil {
+		ok, err := test(p.cond, data)
+		sr.Skipped = err == nil && !ok
+		if sr.Err = err; err != nil || !ok {
+			r.log(ctx, sr)
+			return sr
+		}
+	}
+	if len(p.children) > 0 {
+		sr = r.runParallel(ctx, p, data)
+	} else {
+		sr = r.call(ctx, p, data)
+	}
+	r.log(ctx, sr)
+	return sr
+}
+
+// call renders the prompt of the step p and sends it to its agent,
+// retrying as the step allows.
+func (r *runner) call(ctx context.Context, p *plan, data Data) StepResult {
+	start := time.Now()
+	sr := StepResult{Name: p.Name, Agent: p.Agent}
+	sr.Prompt, sr.Err = render(p.prompt, data)
+	if sr.Err != nil {
+		return sr
+	}
+	delay := p.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	for {
+		sr.Attempts++
+		sr.Response, sr.Err = call(ctx, r.caller, p.Agent, sr.Prompt)
+		if sr.Err == nil || sr.Attempts > p.Retries || ctx.Err() != nil {
+			break
+		}
+		r.logger.WarnContext(ctx, "orchestrator: step attempt failed", "workflow", r.workflow, "step", p.Name,
+			"agent", p.Agent, "attempt", sr.Attempts, "error", sr.Err)
+		if err := sleep(ctx, delay); err != nil {
+			break
+		}
+	}
+	if sr.Err == nil {
+		sr.Output = sr.Response.Text()
+	}
+	sr.Duration = time.Since(start)
+	return sr
+}
+
+// log records sr, at slog.LevelWarn if the step failed.
+func (r *runner) log(ctx context.Context, sr StepResult) {
+	attrs := []any{"workflow", r.workflow, "step", sr.Name}
+	if sr.Agent != "" {
+		attrs = append(attrs, "agent", sr.Agent)
+	}
+	if sr.Skipped {
+		r.logger.InfoContext(ctx, "orchestrator: step skipped", attrs...)
+		return
+	}
+	if sr.Attempts > 0 {
+		attrs = append(attrs, "attempts", sr.Attempts)
+	}
+	attrs = append(attrs, "duration", sr.Duration)
+	if sr.Err != nil {
+		r.logger.WarnContext(ctx, "orchestrator: step failed", append(attrs, "error", sr.Err)...)
+		return
+	}
+	r.logger.InfoContext(ctx, "orchestrator: step finished", attrs...)
+}
+
+// runParallel runs the children concurrently on the same data and merges
+// their outputs.
+func (r *runner) runParallel(ctx context.Context, p *plan, data Data) StepResult {
+	start := time.Now()
+	sr := StepResult{Name: p.Name, Children: make([]StepResult, len(p.children))}
+	var wg sync.WaitGroup
+	for i, c := range p.children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sr.Children[i] = r.run(ctx, c, data)
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	merged := Data{Input: data.Input, Vars: data.Vars, Previous: data.Previous, Steps: make(map[string]StepResult, len(data.Steps)+len(p.children))}
+	for name, s := range data.Steps {
+		merged.Steps[name] = s
+	}
+	for i, c := range sr.Children {
+		merged.Steps[c.Name] = c
+		if c.Err != nil && !p.children[i].ContinueOnError {
+			errs = append(errs, fmt.Errorf("step %q: %w", c.Name, c.Err))
+		}
+	}
+	if sr.Err = errors.Join(errs...); sr.Err == nil {
+		if p.merge != nil {
+			sr.Output, sr.Err = render(p.merge, merged)
+		} else {
+			sr.Output = mergeOutputs(sr.Children)
+		}
+	}
+	sr.Duration = time.Since(start)
+	return sr
+}
+
+// call sends prompt to agent, treating an agent-reported failure as an
+// error.
+func call(ctx context.Context, caller Caller, agent, prompt string) (*mpcclient.AgentResponse, error) {
+	resp, err := caller.Invoke(ctx, agent, mpcclient.AgentRequest{Prompt: prompt})
+	if err != nil {
+		return resp, err
+	}
+	if err := resp.Err(); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// mergeOutputs places each output under a heading naming its step,
+// leaving out the steps that were skipped.
+func mergeOutputs(results []StepResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		if r.Skipped {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s", r.Name, r.Output)
+	}
+	return b.String()
+}
+
+func render(t *template.Template, data Data) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// test renders the condition t and reports whether it holds: whether it
+// rendered to anything but blanks or a value strconv.ParseBool reads as
+// false.
+func test(t *template.Template, data Data) (bool, error) {
+	v, err := render(t, data)
+	if err != nil {
+		return false, fmt.Errorf("if: %w", err)
+	}
+	v = strings.TrimSpace(v)
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b, nil
+	}
+	return v != "", nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
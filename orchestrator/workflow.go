@@ -0,0 +1,243 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRetryDelay is the wait between attempts of a step with retries but
+// no retry delay.
+const DefaultRetryDelay = 500 * time.Millisecond
+
+// Workflow is a named sequence of steps.
+type Workflow struct {
+	Name string `yaml:"name"`
+	// Vars holds the default values of the variables templates read
+	// under .Vars; WithVars overrides them for a run.
+	Vars  map[string]string `yaml:"vars"`
+	Steps []*Step           `yaml:"steps"`
+}
+
+// Step is one call to an agent or, when Parallel is set, a group of steps
+// run concurrently on the same input.
+type Step struct {
+	Name   string `yaml:"name"`
+	Agent  string `yaml:"agent"`
+	Prompt string `yaml:"prompt"`
+	// If is a template deciding whether the step runs: it is skipped when
+	// If renders to nothing or to a false value such as "false" or "0".
+	If string `yaml:"if"`
+	// Parallel lists steps run concurrently instead of calling Agent.
+	Parallel []*Step `yaml:"parallel"`
+	// Merge is a template combining the outputs of the parallel steps,
+	// which are available under .Steps. It defaults to each output under a
+	// heading naming its step.
+	Merge string `yaml:"merge"`
+	// Retries is how many times a failed call is repeated.
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+	// ContinueOnError lets the workflow go on when the step fails. Its
+	// output is then empty.
+	ContinueOnError bool `yaml:"continue_on_error"`
+}
+
+// StepOption configures a step built with Call or Workflow.Then.
+type StepOption func(*Step)
+
+// WithRetries repeats a failed call up to n times, waiting delay between
+// attempts.
+func WithRetries(n int, delay time.Duration) StepOption {
+	return func(s *Step) {
+		s.Retries, s.RetryDelay = n, delay
+	}
+}
+
+// ContinueOnError lets the workflow go on when the step fails.
+func ContinueOnError() StepOption {
+	return func(s *Step) {
+		s.ContinueOnError = true
+	}
+}
+
+// When runs the step only if the template cond renders to a true value,
+// as Step.If.
+func When(cond string) StepOption {
+	return func(s *Step) {
+		s.If = cond
+	}
+}
+
+// WithMerge sets the template combining the outputs of a parallel step.
+func WithMerge(tmpl string) StepOption {
+	return func(s *Step) {
+		s.Merge = tmpl
+	}
+}
+
+// New returns an empty workflow.
+func New(name string) *Workflow {
+	return &Workflow{Name: name}
+}
+
+// Call returns a step sending prompt to agent, for use with Parallel.
+func Call(name, agent, prompt string, opts ...StepOption) *Step {
+	s := &Step{Name: name, Agent: agent, Prompt: prompt}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Then appends a step sending prompt to agent.
+func (w *Workflow) Then(name, agent, prompt string, opts ...StepOption) *Workflow {
+	w.Steps = append(w.Steps, Call(name, agent, prompt, opts...))
+	return w
+}
+
+// Parallel appends a step running steps concurrently. Options such as
+// WithMerge apply to the group; WithRetries only to its child steps.
+func (w *Workflow) Parallel(name string, steps ...*Step) *Workflow {
+	return w.ParallelWith(name, nil, steps...)
+}
+
+// ParallelWith is Parallel with options for the group.
+func (w *Workflow) ParallelWith(name string, opts []StepOption, steps ...*Step) *Workflow {
+	s := &Step{Name: name, Parallel: steps}
+	for _, opt := range opts {
+		opt(s)
+	}
+	w.Steps = append(w.Steps, s)
+	return w
+}
+
+// Load parses a workflow from YAML and validates it.
+func Load(r io.Reader) (*Workflow, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var w Workflow
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("orchestrator: parse workflow: %w", err)
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// LoadFile parses the YAML workflow in the file at path.
+func LoadFile(path string) (*Workflow, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("orchestrator: %w", err)
+	}
+	return Load(bytes.NewReader(b))
+}
+
+// Validate checks that every step is well formed and uniquely named, and
+// that its templates parse. Run calls it before starting.
+func (w *Workflow) Validate() error {
+	_, err := w.compile()
+	return err
+}
+
+// plan is a validated step with its templates parsed.
+type plan struct {
+	*Step
+	prompt   *template.Template
+	merge    *template.Template
+	cond     *template.Template
+	children []*plan
+}
+
+// funcs are the functions templates can call besides text/template's
+// own, such as in an If of {{contains .Previous "error"}}.
+var funcs = template.FuncMap{
+	"contains": strings.Contains,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+}
+
+// compile validates w and parses its templates.
+func (w *Workflow) compile() ([]*plan, error) {
+	if len(w.Steps) == 0 {
+		return nil, fmt.Errorf("orchestrator: workflow %q has no steps", w.Name)
+	}
+	seen := make(map[string]bool)
+	var errs []error
+	var walk func(s *Step, inParallel bool) *plan
+	walk = func(s *Step, inParallel bool) *plan {
+		if s == nil {
+			errs = append(errs, errors.New("nil step"))
+			return nil
+		}
+		if s.Name != "" {
+			if seen[s.Name] {
+				errs = append(errs, fmt.Errorf("step %q: name is used more than once", s.Name))
+			}
+			seen[s.Name] = true
+		}
+		p, err := compileStep(s, inParallel)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, child := range s.Parallel {
+			p.children = append(p.children, walk(child, true))
+		}
+		return p
+	}
+	plans := make([]*plan, 0, len(w.Steps))
+	for _, s := range w.Steps {
+		plans = append(plans, walk(s, false))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("orchestrator: workflow %q: %w", w.Name, err)
+	}
+	return plans, nil
+}
+
+func compileStep(s *Step, inParallel bool) (*plan, error) {
+	p := &plan{Step: s}
+	switch {
+	case s.Name == "":
+		return p, errors.New("every step needs a name")
+	case len(s.Parallel) > 0 && inParallel:
+		return p, fmt.Errorf("step %q: parallel steps cannot be nested", s.Name)
+	case len(s.Parallel) > 0 && (s.Agent != "" || s.Prompt != ""):
+		return p, fmt.Errorf("step %q: set either agent and prompt or parallel, not both", s.Name)
+	case len(s.Parallel) == 0 && (s.Agent == "" || s.Prompt == ""):
+		return p, fmt.Errorf("step %q: agent and prompt are required", s.Name)
+	case s.Merge != "" && len(s.Parallel) == 0:
+		return p, fmt.Errorf("step %q: merge applies only to parallel steps", s.Name)
+	case s.Retries < 0:
+		return p, fmt.Errorf("step %q: retries must not be negative", s.Name)
+	}
+	var err error
+	if s.Prompt != "" {
+		if p.prompt, err = parse(s.Name, s.Prompt); err != nil {
+			return p, fmt.Errorf("step %q: prompt: %w", s.Name, err)
+		}
+	}
+	if s.Merge != "" {
+		if p.merge, err = parse(s.Name, s.Merge); err != nil {
+			return p, fmt.Errorf("step %q: merge: %w", s.Name, err)
+		}
+	}
+	if s.If != "" {
+		if p.cond, err = parse(s.Name, s.If); err != nil {
+			return p, fmt.Errorf("step %q: if: %w", s.Name, err)
+		}
+	}
+	return p, nil
+}
+
+func parse(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(funcs).Parse(text)
+}
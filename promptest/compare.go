@@ -0,0 +1,151 @@
+package promptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Embedder computes embedding vectors for MatchEmbedding, for example by
+// calling an embedding model. Vectors of the same text must be comparable
+// across runs.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// EmbedderFunc adapts a function to Embedder.
+type EmbedderFunc func(ctx context.Context, text string) ([]float64, error)
+
+// Embed implements Embedder.
+func (f EmbedderFunc) Embed(ctx context.Context, text string) ([]float64, error) {
+	return f(ctx, text)
+}
+
+// ErrNoEmbedder is returned for cases using MatchEmbedding when the Runner
+// has no Embedder.
+var ErrNoEmbedder = errors.New("promptest: embedding match needs an Embedder")
+
+// score rates how similar got is to baseline under match, from 0 to 1.
+func (r *Runner) score(ctx context.Context, match, baseline, got string) (float64, error) {
+	switch match {
+	case MatchExact:
+		if got == baseline {
+			return 1, nil
+		}
+		return 0, nil
+	case MatchNormalized:
+		return Similarity(Normalize(baseline), Normalize(got)), nil
+	case MatchEmbedding:
+		if r.Embedder == nil {
+			return 0, ErrNoEmbedder
+		}
+		a, err := r.Embedder.Embed(ctx, baseline)
+		if err != nil {
+			return 0, fmt.Errorf("promptest: embed baseline: %w", err)
+		}
+		b, err := r.Embedder.Embed(ctx, got)
+		if err != nil {
+			return 0, fmt.Errorf("promptest: embed response: %w", err)
+		}
+		return cosine(a, b)
+	default:
+		return 0, fmt.Errorf("promptest: unknown match %q", match)
+	}
+}
+
+var number = regexp.MustCompile(`\d+(?:[.,:]\d+)*`)
+
+// Normalize folds case, masks numbers as "#" and collapses runs of
+// whitespace, so that responses differing only in formatting, timestamps
+// or measured values compare equal.
+func Normalize(s string) string {
+	s = number.ReplaceAllString(strings.ToLower(s), "#")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Similarity returns the share of words a and b have in common, in order:
+// twice the length of their longest common subsequence of words divided by
+// their total word count. Equal texts score 1, texts without a word in
+// common 0.
+func Similarity(a, b string) float64 {
+	x, y := strings.Fields(a), strings.Fields(b)
+	if len(x)+len(y) == 0 {
+		return 1
+	}
+	return 2 * float64(lcs(x, y)) / float64(len(x)+len(y))
+}
+
+// lcs returns the length of the longest common subsequence of x and y.
+func lcs(x, y []string) int {
+	prev, cur := make([]int, len(y)+1), make([]int, len(y)+1)
+	for i := range x {
+		for j := range y {
+			if x[i] == y[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(y)]
+}
+
+func cosine(a, b []float64) (float64, error) {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0, fmt.Errorf("promptest: embeddings have %d and %d dimensions", len(a), len(b))
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0, nil
+	}
+	return max(0, min(1, dot/math.Sqrt(na*nb))), nil
+}
+
+// Diff returns a line diff turning baseline into got: unchanged lines are
+// indented by two spaces, removed ones prefixed with "- " and added ones
+// with "+ ". It is empty when the texts are equal.
+func Diff(baseline, got string) string {
+	if baseline == got {
+		return ""
+	}
+	x, y := strings.Split(baseline, "\n"), strings.Split(got, "\n")
+	// table[i][j] is the LCS length of x[i:] and y[j:].
+	table := make([][]int, len(x)+1)
+	for i := range table {
+		table[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			b.WriteString("  " + x[i] + "\n")
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || table[i+1][j] >= table[i][j+1]):
+			b.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			b.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,36 @@
+// Package promptest checks agents for prompt regressions. A suite lists
+// golden prompt cases in YAML; running it sends each prompt to its agent
+// and compares the response with the baseline stored by an earlier run:
+//
+//	name: vm-metrics
+//	agent: azureVmMetricsAgent
+//	match: normalized
+//	threshold: 0.8
+//	cases:
+//	  - name: cpu
+//	    prompt: "Check CPU for VM 'webserver01'"
+//	  - name: disk-json
+//	    prompt: "Report disk usage for VM 'webserver01'"
+//	    parameters: {vm_name: webserver01}
+//	    match: exact
+//
+// Baselines are plain text files, one per case, under baselines/<suite>
+// beside the suite file. A case without a baseline records one; setting
+// Runner.Update re-records them all, after reviewing the changes.
+//
+// Cases pass when the response scores at least their threshold, from 0 to
+// 1, under their match mode: MatchExact requires identical text,
+// MatchNormalized scores the words two texts share once case, spacing
+// and numbers are ignored, and MatchEmbedding the cosine similarity of
+// embeddings computed by an Embedder supplied by the caller:
+//
+//	suite, err := promptest.LoadFile("prompts/vm-metrics.yaml")
+//	runner := &promptest.Runner{Client: client, Embedder: embedder}
+//	report, err := runner.Run(ctx, suite)
+//	report.WriteText(os.Stdout)
+//	if !report.OK() {
+//		os.Exit(1)
+//	}
+//
+// Failing cases carry a line diff from the baseline to the response.
+package promptest
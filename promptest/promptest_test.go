@@ -0,0 +1,174 @@
+package promptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// fakeCaller answers each prompt from a table.
+type fakeCaller map[string]string
+
+func (f fakeCaller) Invoke(_ context.Context, agent string, req mpcclient.AgentRequest, _ ...mpcclient.CallOption) (*mpcclient.AgentResponse, error) {
+	out, ok := f[req.Prompt]
+	if !ok {
+		return nil, errors.New("agent down")
+	}
+	return &mpcclient.AgentResponse{Agent: agent, Result: out}, nil
+}
+
+const suiteYAML = `
+name: vm
+agent: vm-agent
+threshold: 0.8
+cases:
+  - name: cpu
+    prompt: cpu
+  - name: disk
+    prompt: disk
+    match: exact
+  - name: memory
+    prompt: memory
+  - name: down
+    prompt: down
+`
+
+func writeSuite(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vm.yaml")
+	if err := os.WriteFile(path, []byte(suiteYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	path := writeSuite(t)
+	s, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	first := fakeCaller{
+		"cpu":    "CPU at 40% on webserver01\nNo action needed.",
+		"disk":   "Disk at 70%",
+		"memory": "Memory at 2 GB of 8 GB, healthy",
+	}
+	rep, err := (&Runner{Client: first}).Run(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(rep); got != "cpu=new disk=new memory=new down=error" {
+		t.Errorf("first run: %s", got)
+	}
+	b, err := os.ReadFile(filepath.Join(filepath.Dir(path), "baselines", "vm", "cpu.txt"))
+	if err != nil || string(b) != first["cpu"] {
+		t.Fatalf("baseline = %q, %v", b, err)
+	}
+
+	second := fakeCaller{
+		"cpu":    "cpu at 55% on  webserver01\nNo action needed.",
+		"disk":   "Disk at 71%",
+		"memory": "Memory is critically low, scale up now",
+		"down":   "back",
+	}
+	rep, err = (&Runner{Client: second}).Run(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(rep); got != "cpu=pass disk=fail memory=fail down=new" {
+		t.Errorf("second run: %s", got)
+	}
+	if rep.OK() || rep.Passed != 2 || rep.Failed != 2 {
+		t.Errorf("report = %+v", rep)
+	}
+	if d := rep.Cases[1].Diff; d != "- Disk at 70%\n+ Disk at 71%\n" {
+		t.Errorf("disk diff = %q", d)
+	}
+	var text bytes.Buffer
+	rep.WriteText(&text)
+	for _, want := range []string{"disk    FAIL", "--- memory: baseline → response", "FAIL vm: 2 passed, 2 failed"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, text.String())
+		}
+	}
+
+	rep, err = (&Runner{Client: second, Update: true}).Run(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || rep.Cases[1].Status != StatusUpdated {
+		t.Errorf("update run: %s", statuses(rep))
+	}
+	rep, _ = (&Runner{Client: second}).Run(ctx, s)
+	if !rep.OK() {
+		t.Errorf("run after update: %s", statuses(rep))
+	}
+}
+
+func statuses(rep *Report) string {
+	var out []string
+	for _, c := range rep.Cases {
+		out = append(out, c.Name+"="+string(c.Status))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestEmbeddingMatch(t *testing.T) {
+	dir := t.TempDir()
+	s := &Suite{Name: "emb", Agent: "a", Baselines: dir, Match: MatchEmbedding, Cases: []Case{{Name: "c", Prompt: "p"}}}
+	os.WriteFile(filepath.Join(dir, "c.txt"), []byte("healthy"), 0o644)
+	caller := fakeCaller{"p": "fine"}
+
+	rep, _ := (&Runner{Client: caller}).Run(context.Background(), s)
+	if c := rep.Cases[0]; c.Status != StatusError || !strings.Contains(c.Error, "needs an Embedder") {
+		t.Errorf("without embedder: %+v", c)
+	}
+
+	vectors := map[string][]float64{"healthy": {1, 0}, "fine": {0.95, 0.31}}
+	embed := EmbedderFunc(func(_ context.Context, text string) ([]float64, error) { return vectors[text], nil })
+	rep, _ = (&Runner{Client: caller, Embedder: embed}).Run(context.Background(), s)
+	if c := rep.Cases[0]; c.Status != StatusPass || c.Threshold != 0.9 || c.Score < 0.9 {
+		t.Errorf("with embedder: %+v", c)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"a b c", "a b c", 1},
+		{"a b c d", "a x c d", 0.75},
+		{"a b", "c d", 0},
+		{Normalize("CPU  at 40%\nok"), Normalize("cpu at 97% ok"), 1},
+	} {
+		if got := Similarity(tc.a, tc.b); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidSuites(t *testing.T) {
+	for name, doc := range map[string]string{
+		"no cases":      "name: s\nagent: a\n",
+		"bad name":      "name: s\nagent: a\ncases: [{name: ../x, prompt: p}]\n",
+		"duplicate":     "name: s\nagent: a\ncases: [{name: x, prompt: p}, {name: x, prompt: q}]\n",
+		"no agent":      "name: s\ncases: [{name: x, prompt: p}]\n",
+		"bad match":     "name: s\nagent: a\nmatch: fuzzy\ncases: [{name: x, prompt: p}]\n",
+		"bad threshold": "name: s\nagent: a\ncases: [{name: x, prompt: p, threshold: 2}]\n",
+		"unknown field": "name: s\nagent: a\ncases: [{name: x, promt: p}]\n",
+	} {
+		if _, err := Load(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+	}
+}
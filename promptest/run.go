@@ -0,0 +1,187 @@
+package promptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Caller sends a request to an agent. *mpcclient.Client implements it.
+type Caller interface {
+	Invoke(ctx context.Context, agent string, req mpcclient.AgentRequest, opts ...mpcclient.CallOption) (*mpcclient.AgentResponse, error)
+}
+
+// Runner runs suites against a server.
+type Runner struct {
+	Client Caller
+	// Embedder scores cases using MatchEmbedding.
+	Embedder Embedder
+	// Update stores every response as the case's new baseline instead of
+	// comparing it.
+	Update bool
+}
+
+// Status is the outcome of one case.
+type Status string
+
+// Case outcomes.
+const (
+	// StatusPass means the response matched the baseline.
+	StatusPass Status = "pass"
+	// StatusFail means the response scored below the case's threshold.
+	StatusFail Status = "fail"
+	// StatusError means the agent call or the comparison failed.
+	StatusError Status = "error"
+	// StatusNew means the case had no baseline, so the response was stored
+	// as one. It does not fail the report.
+	StatusNew Status = "new"
+	// StatusUpdated means the baseline was replaced because Runner.Update
+	// is set.
+	StatusUpdated Status = "updated"
+)
+
+// CaseResult is how one case ran.
+type CaseResult struct {
+	Name      string  `json:"name"`
+	Agent     string  `json:"agent"`
+	Match     string  `json:"match"`
+	Status    Status  `json:"status"`
+	Score     float64 `json:"score"`
+	Threshold float64 `json:"threshold"`
+	// Diff is a line diff from the baseline to the response of a failed
+	// case.
+	Diff     string        `json:"diff,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Response string        `json:"response,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the outcome of a suite run.
+type Report struct {
+	Suite    string        `json:"suite"`
+	Cases    []CaseResult  `json:"cases"`
+	Passed   int           `json:"passed"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration"`
+}
+
+// OK reports whether no case failed or errored.
+func (r *Report) OK() bool {
+	return r.Failed == 0
+}
+
+// Run sends every case of s to its agent, in order, and compares the
+// responses with their baselines. It returns an error only when s is
+// invalid or a baseline cannot be read or written; failing cases are
+// reported in the Report.
+func (r *Runner) Run(ctx context.Context, s *Suite) (*Report, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rep := &Report{Suite: s.Name}
+	for _, c := range s.Cases {
+		res, err := r.runCase(ctx, s, c)
+		if err != nil {
+			return nil, err
+		}
+		switch res.Status {
+		case StatusFail, StatusError:
+			rep.Failed++
+		default:
+			rep.Passed++
+		}
+		rep.Cases = append(rep.Cases, res)
+	}
+	rep.Duration = time.Since(start)
+	return rep, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, s *Suite, c Case) (CaseResult, error) {
+	agent, match, threshold := s.resolve(c)
+	res := CaseResult{Name: c.Name, Agent: agent, Match: match, Threshold: threshold}
+	start := time.Now()
+	resp, err := r.Client.Invoke(ctx, agent, mpcclient.AgentRequest{Prompt: c.Prompt, Context: c.Context, Parameters: c.Parameters})
+	res.Duration = time.Since(start)
+	if err != nil {
+		res.Status, res.Error = StatusError, err.Error()
+		return res, nil
+	}
+	got := resp.Text()
+	res.Response = got
+
+	path := filepath.Join(s.BaselineDir(), c.Name+".txt")
+	baseline, err := os.ReadFile(path)
+	switch {
+	case r.Update || errors.Is(err, fs.ErrNotExist):
+		res.Status, res.Score = StatusUpdated, 1
+		if err != nil {
+			res.Status = StatusNew
+		}
+		if err := writeBaseline(path, got); err != nil {
+			return res, err
+		}
+		return res, nil
+	case err != nil:
+		return res, fmt.Errorf("promptest: %w", err)
+	}
+
+	res.Score, err = r.score(ctx, match, string(baseline), got)
+	switch {
+	case err != nil:
+		res.Status, res.Error = StatusError, err.Error()
+	case res.Score >= threshold:
+		res.Status = StatusPass
+	default:
+		res.Status = StatusFail
+		res.Diff = Diff(string(baseline), got)
+	}
+	return res, nil
+}
+
+func writeBaseline(path, text string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("promptest: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		return fmt.Errorf("promptest: %w", err)
+	}
+	return nil
+}
+
+// WriteText writes a human-readable report: a line per case, the diffs and
+// errors of failing cases, and a summary.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tSTATUS\tMATCH\tSCORE\tDURATION")
+	for _, c := range r.Cases {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f/%.2f\t%s\n", c.Name, strings.ToUpper(string(c.Status)), c.Match,
+			c.Score, c.Threshold, c.Duration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, c := range r.Cases {
+		switch {
+		case c.Error != "":
+			fmt.Fprintf(w, "\n--- %s: %s\n", c.Name, c.Error)
+		case c.Diff != "":
+			fmt.Fprintf(w, "\n--- %s: baseline → response\n%s", c.Name, c.Diff)
+		}
+	}
+	result := "PASS"
+	if !r.OK() {
+		result = "FAIL"
+	}
+	_, err := fmt.Fprintf(w, "\n%s %s: %d passed, %d failed in %s\n", result, r.Suite, r.Passed, r.Failed, r.Duration.Round(time.Millisecond))
+	return err
+}
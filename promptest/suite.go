@@ -0,0 +1,177 @@
+package promptest
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Match modes, selecting how a response is compared with its baseline.
+const (
+	// MatchExact passes only responses identical to the baseline.
+	MatchExact = "exact"
+	// MatchNormalized compares responses after folding case, collapsing
+	// whitespace and masking numbers, scoring the share of words they have
+	// in common. With the default threshold of 1 the normalized texts must
+	// be equal.
+	MatchNormalized = "normalized"
+	// MatchEmbedding scores the cosine similarity of the embeddings of the
+	// response and the baseline, computed by the Runner's Embedder.
+	MatchEmbedding = "embedding"
+)
+
+// Suite is a set of golden prompt cases.
+type Suite struct {
+	// Name identifies the suite, with the same characters as a case name.
+	Name string `yaml:"name"`
+	// Agent is the agent cases without their own are sent to.
+	Agent string `yaml:"agent"`
+	// Baselines is the directory holding the stored responses, one file
+	// per case. A relative path is taken from the suite file's directory.
+	// It defaults to baselines/<name>.
+	Baselines string `yaml:"baselines"`
+	// Match is the mode of cases that set none; it defaults to
+	// MatchNormalized. Threshold, the lowest passing similarity score,
+	// applies to cases using that mode without a threshold of their own.
+	// Thresholds default to 1 for normalized matching and 0.9 for
+	// embedding matching.
+	Match     string  `yaml:"match"`
+	Threshold float64 `yaml:"threshold"`
+	Cases     []Case  `yaml:"cases"`
+
+	// dir is the directory of the suite file, if it was loaded from one.
+	dir string
+}
+
+// Case is one prompt and the expectation on its response.
+type Case struct {
+	// Name identifies the case and names its baseline file. It may contain
+	// letters, digits, dots, dashes and underscores.
+	Name       string         `yaml:"name"`
+	Agent      string         `yaml:"agent"`
+	Prompt     string         `yaml:"prompt"`
+	Context    map[string]any `yaml:"context"`
+	Parameters map[string]any `yaml:"parameters"`
+	Match      string         `yaml:"match"`
+	Threshold  float64        `yaml:"threshold"`
+}
+
+var caseName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Load parses a suite from YAML and validates it. Baselines are resolved
+// against the working directory.
+func Load(r io.Reader) (*Suite, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var s Suite
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("promptest: parse suite: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadFile parses the YAML suite in the file at path.
+func LoadFile(path string) (*Suite, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("promptest: %w", err)
+	}
+	s, err := Load(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, path)
+	}
+	s.dir = filepath.Dir(path)
+	return s, nil
+}
+
+// Validate checks that every case is well formed and uniquely named. Run
+// calls it before starting.
+func (s *Suite) Validate() error {
+	if !caseName.MatchString(s.Name) {
+		return fmt.Errorf("promptest: suite name %q must be letters, digits, dots, dashes and underscores", s.Name)
+	}
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("promptest: suite %q has no cases", s.Name)
+	}
+	var errs []error
+	if err := checkMatch(s.Match, s.Threshold); err != nil {
+		errs = append(errs, err)
+	}
+	seen := make(map[string]bool)
+	for _, c := range s.Cases {
+		switch {
+		case !caseName.MatchString(c.Name):
+			errs = append(errs, fmt.Errorf("case %q: name must be letters, digits, dots, dashes and underscores", c.Name))
+			continue
+		case seen[c.Name]:
+			errs = append(errs, fmt.Errorf("case %q: name is used more than once", c.Name))
+		case c.Prompt == "":
+			errs = append(errs, fmt.Errorf("case %q: prompt is required", c.Name))
+		case c.Agent == "" && s.Agent == "":
+			errs = append(errs, fmt.Errorf("case %q: agent is required when the suite sets none", c.Name))
+		}
+		seen[c.Name] = true
+		if err := checkMatch(c.Match, c.Threshold); err != nil {
+			errs = append(errs, fmt.Errorf("case %q: %w", c.Name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("promptest: suite %q: %w", s.Name, err)
+	}
+	return nil
+}
+
+func checkMatch(match string, threshold float64) error {
+	switch match {
+	case "", MatchExact, MatchNormalized, MatchEmbedding:
+	default:
+		return fmt.Errorf("match must be exact, normalized or embedding, not %q", match)
+	}
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("threshold %v is outside 0 to 1", threshold)
+	}
+	return nil
+}
+
+// BaselineDir returns the directory holding the suite's baselines.
+func (s *Suite) BaselineDir() string {
+	dir := s.Baselines
+	if dir == "" {
+		dir = filepath.Join("baselines", s.Name)
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(s.dir, dir)
+}
+
+// resolve returns the agent, match mode and threshold that apply to c. The
+// suite's threshold applies to cases using the suite's match mode.
+func (s *Suite) resolve(c Case) (agent, match string, threshold float64) {
+	agent = cmp.Or(c.Agent, s.Agent)
+	suiteMatch := cmp.Or(s.Match, MatchNormalized)
+	match = cmp.Or(c.Match, suiteMatch)
+	threshold = c.Threshold
+	if threshold == 0 && match == suiteMatch {
+		threshold = s.Threshold
+	}
+	switch {
+	case match == MatchExact:
+		threshold = 1
+	case threshold == 0 && match == MatchEmbedding:
+		threshold = 0.9
+	case threshold == 0:
+		threshold = 1
+	}
+	return agent, match, threshold
+}
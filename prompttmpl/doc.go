@@ -0,0 +1,28 @@
+// Package prompttmpl turns prompts into versioned assets. A template is a
+// text file with a YAML header declaring the target agent and typed
+// parameters, followed by a text/template body:
+//
+//	---
+//	name: vm-metrics
+//	agent: azureVmMetricsAgent
+//	version: 2
+//	parameters:
+//	  - name: vm_name
+//	    type: string
+//	    required: true
+//	  - name: hours
+//	    type: int
+//	    default: 24
+//	---
+//	{{template "concise"}}
+//	Check CPU and network metrics for VM '{{.vm_name}}' over the last {{.hours}} hours.
+//
+// Files whose names start with an underscore, such as _concise.prompt, are
+// partials: shared instructions other templates include by name, without
+// the underscore and extension. Load templates from a directory or an
+// embed.FS and render them into requests:
+//
+//	set, err := prompttmpl.Load(promptsFS, "*.prompt")
+//	req, err := set.Render("vm-metrics", map[string]any{"vm_name": "webserver01"})
+//	resp, err := client.Invoke(ctx, req.Agent, req.Request)
+package prompttmpl
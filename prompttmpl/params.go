@@ -0,0 +1,122 @@
+package prompttmpl
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameter types a template can declare.
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypeDuration = "duration"
+)
+
+// Param declares one template variable.
+type Param struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+	// Default is used when the variable is not supplied.
+	Default any `yaml:"default"`
+	// Enum restricts a string parameter to the listed values.
+	Enum []string `yaml:"enum"`
+}
+
+// ValidationError lists every problem found with a template's variables.
+type ValidationError struct {
+	Template string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("prompttmpl: template %q: %s", e.Template, strings.Join(e.Problems, "; "))
+}
+
+func (p Param) check() error {
+	switch p.Type {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeDuration:
+	default:
+		return fmt.Errorf("parameter %q has unknown type %q", p.Name, p.Type)
+	}
+	if len(p.Enum) > 0 && p.Type != TypeString {
+		return fmt.Errorf("parameter %q: enum requires type string", p.Name)
+	}
+	if p.Default != nil {
+		if _, err := p.coerce(p.Default); err != nil {
+			return fmt.Errorf("parameter %q: default: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// coerce converts v to the parameter's type. Strings are parsed, so values
+// from flags or environment variables are accepted for every type.
+func (p Param) coerce(v any) (any, error) {
+	switch p.Type {
+	case TypeString:
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+			return nil, fmt.Errorf("%q is not one of %s", s, strings.Join(p.Enum, ", "))
+		}
+		return s, nil
+	case TypeInt:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case int64:
+			return int(n), nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+		case string:
+			if i, err := strconv.Atoi(strings.TrimSpace(n)); err == nil {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an integer", v)
+	case TypeFloat:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a number", v)
+	case TypeBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(b)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a boolean", v)
+	case TypeDuration:
+		switch d := v.(type) {
+		case time.Duration:
+			return d, nil
+		case string:
+			if parsed, err := time.ParseDuration(strings.TrimSpace(d)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a duration", v)
+	}
+	return nil, fmt.Errorf("unknown type %q", p.Type)
+}
@@ -0,0 +1,251 @@
+package prompttmpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// Request is a rendered template: the agent to call and what to send it.
+type Request struct {
+	Agent   string
+	Request mpcclient.AgentRequest
+}
+
+// Template is one parsed prompt template.
+type Template struct {
+	Name        string  `yaml:"name"`
+	Agent       string  `yaml:"agent"`
+	Version     string  `yaml:"version"`
+	Description string  `yaml:"description"`
+	Params      []Param `yaml:"parameters"`
+
+	body *template.Template
+}
+
+// Set is a collection of templates sharing partials.
+type Set struct {
+	templates map[string]*Template
+}
+
+// Load parses the files in fsys matching any of the glob patterns, such as
+// "*.prompt" or "prompts/*.prompt". It works with embed.FS and os.DirFS.
+func Load(fsys fs.FS, patterns ...string) (*Set, error) {
+	var files []string
+	for _, p := range patterns {
+		matches, err := fs.Glob(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("prompttmpl: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("prompttmpl: no files match %q", patterns)
+	}
+
+	// Partials are parsed first into a shared root that every template is
+	// cloned from, so a template may use any partial.
+	root := template.New("").Option("missingkey=error")
+	sources := make(map[string][]byte)
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, fmt.Errorf("prompttmpl: %w", err)
+		}
+		base := path.Base(f)
+		if strings.HasPrefix(base, "_") {
+			name := strings.TrimSuffix(strings.TrimPrefix(base, "_"), path.Ext(base))
+			if _, err := root.New(name).Parse(string(b)); err != nil {
+				return nil, fmt.Errorf("prompttmpl: partial %s: %w", f, err)
+			}
+			continue
+		}
+		sources[f] = b
+	}
+
+	s := &Set{templates: make(map[string]*Template)}
+	for _, f := range files {
+		b, ok := sources[f]
+		if !ok {
+			continue
+		}
+		t, err := parse(root, f, b)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := s.templates[t.Name]; dup {
+			return nil, fmt.Errorf("prompttmpl: %s: duplicate template name %q", f, t.Name)
+		}
+		s.templates[t.Name] = t
+	}
+	return s, nil
+}
+
+// LoadDir parses every *.prompt file in dir.
+func LoadDir(dir string) (*Set, error) {
+	return Load(os.DirFS(dir), "*.prompt")
+}
+
+// parse reads one template file: a YAML header between "---" lines, then
+// the body.
+func parse(root *template.Template, file string, b []byte) (*Template, error) {
+	header, body, err := splitFrontMatter(b)
+	if err != nil {
+		return nil, fmt.Errorf("prompttmpl: %s: %w", file, err)
+	}
+	t := &Template{}
+	if err := yaml.Unmarshal(header, t); err != nil {
+		return nil, fmt.Errorf("prompttmpl: %s: header: %w", file, err)
+	}
+	if t.Name == "" {
+		base := path.Base(file)
+		t.Name = strings.TrimSuffix(base, path.Ext(base))
+	}
+	if t.Agent == "" {
+		return nil, fmt.Errorf("prompttmpl: %s: header must name an agent", file)
+	}
+	seen := make(map[string]bool)
+	for i := range t.Params {
+		p := &t.Params[i]
+		if p.Type == "" {
+			p.Type = TypeString
+		}
+		if p.Name == "" || seen[p.Name] {
+			return nil, fmt.Errorf("prompttmpl: %s: parameter names must be unique and non-empty", file)
+		}
+		seen[p.Name] = true
+		if err := p.check(); err != nil {
+			return nil, fmt.Errorf("prompttmpl: %s: %w", file, err)
+		}
+	}
+
+	clone, err := root.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("prompttmpl: %s: %w", file, err)
+	}
+	if t.body, err = clone.New(t.Name).Parse(string(body)); err != nil {
+		return nil, fmt.Errorf("prompttmpl: %s: %w", file, err)
+	}
+	return t, nil
+}
+
+func splitFrontMatter(b []byte) (header, body []byte, err error) {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	rest, ok := bytes.CutPrefix(b, []byte("---\n"))
+	if !ok {
+		return nil, nil, errors.New("missing \"---\" header")
+	}
+	header, body, ok = bytes.Cut(rest, []byte("\n---\n"))
+	if !ok {
+		return nil, nil, errors.New("unterminated header")
+	}
+	return header, body, nil
+}
+
+// Lookup returns the named template.
+func (s *Set) Lookup(name string) (*Template, bool) {
+	t, ok := s.templates[name]
+	return t, ok
+}
+
+// Names returns the names of the templates in the set, sorted.
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.templates))
+	for n := range s.templates {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Render renders the named template. See Template.Render.
+func (s *Set) Render(name string, vars map[string]any) (Request, error) {
+	t, ok := s.templates[name]
+	if !ok {
+		return Request{}, fmt.Errorf("prompttmpl: no template named %q", name)
+	}
+	return t.Render(vars)
+}
+
+// Validate checks vars against the template's parameters and returns them
+// converted to their declared types, with defaults filled in. All problems
+// are reported together in a *ValidationError.
+func (t *Template) Validate(vars map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(t.Params))
+	var problems []string
+	for _, p := range t.Params {
+		v, ok := vars[p.Name]
+		if !ok || v == nil {
+			switch {
+			case p.Default != nil:
+				v = p.Default
+			case p.Required:
+				problems = append(problems, fmt.Sprintf("%s is required", p.Name))
+				continue
+			default:
+				continue
+			}
+		}
+		cv, err := p.coerce(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", p.Name, err))
+			continue
+		}
+		out[p.Name] = cv
+	}
+	for k := range vars {
+		if !slices.ContainsFunc(t.Params, func(p Param) bool { return p.Name == k }) {
+			problems = append(problems, fmt.Sprintf("%s is not a parameter of this template", k))
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return nil, &ValidationError{Template: t.Name, Problems: problems}
+	}
+	return out, nil
+}
+
+// Render validates vars and executes the template into a request for its
+// agent. The validated variables are also sent as the request's
+// parameters, so agents need not parse them back out of the prompt.
+func (t *Template) Render(vars map[string]any) (Request, error) {
+	values, err := t.Validate(vars)
+	if err != nil {
+		return Request{}, err
+	}
+	// Optional parameters without a value are present as nil, so the body
+	// can test them with if while misspelled names still fail.
+	data := make(map[string]any, len(t.Params))
+	for _, p := range t.Params {
+		data[p.Name] = values[p.Name]
+	}
+	var b strings.Builder
+	if err := t.body.Execute(&b, data); err != nil {
+		return Request{}, fmt.Errorf("prompttmpl: render %q: %w", t.Name, err)
+	}
+
+	params := make(map[string]any, len(values))
+	for k, v := range values {
+		if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		}
+		params[k] = v
+	}
+	return Request{
+		Agent:   t.Agent,
+		Request: mpcclient.AgentRequest{Prompt: strings.TrimSpace(b.String()), Parameters: params},
+	}, nil
+}
@@ -0,0 +1,107 @@
+package prompttmpl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"prompts/_concise.prompt": {Data: []byte("Answer concisely.")},
+	"prompts/vm-metrics.prompt": {Data: []byte(`---
+agent: azureVmMetricsAgent
+version: 2
+description: Summarize VM metrics
+parameters:
+  - name: vm_name
+    required: true
+  - name: resource_group
+    required: true
+  - name: hours
+    type: int
+    default: 24
+  - name: detail
+    type: string
+    enum: [summary, full]
+  - name: window
+    type: duration
+---
+{{template "concise"}}
+Check CPU and network metrics for VM '{{.vm_name}}' in resource group '{{.resource_group}}' over the last {{.hours}} hours.
+{{- if .detail}} Detail: {{.detail}}.{{end}}
+`)},
+	"prompts/onboarding.prompt": {Data: []byte("---\nname: welcome\nagent: onboardingAgent\nparameters:\n  - name: remote\n    type: bool\n---\nWelcome{{if .remote}}, remote teammate{{end}}!\n")},
+}
+
+func TestLoadAndRender(t *testing.T) {
+	set, err := Load(testFS, "prompts/*.prompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(set.Names(), ","); got != "vm-metrics,welcome" {
+		t.Errorf("names = %s", got)
+	}
+	tmpl, _ := set.Lookup("vm-metrics")
+	if tmpl.Version != "2" || tmpl.Agent != "azureVmMetricsAgent" {
+		t.Errorf("header = %+v", tmpl)
+	}
+
+	req, err := set.Render("vm-metrics", map[string]any{"vm_name": "webserver01", "resource_group": "prod-rg", "hours": "6", "window": "90m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Answer concisely.\nCheck CPU and network metrics for VM 'webserver01' in resource group 'prod-rg' over the last 6 hours."
+	if req.Agent != "azureVmMetricsAgent" || req.Request.Prompt != want {
+		t.Errorf("rendered %q for %s", req.Request.Prompt, req.Agent)
+	}
+	if p := req.Request.Parameters; p["hours"] != 6 || p["vm_name"] != "webserver01" || p["window"] != "1h30m0s" {
+		t.Errorf("parameters = %v", p)
+	}
+
+	req, err = set.Render("welcome", map[string]any{"remote": "true"})
+	if err != nil || req.Request.Prompt != "Welcome, remote teammate!" {
+		t.Errorf("welcome = %q, %v", req.Request.Prompt, err)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	set, err := Load(testFS, "prompts/*.prompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = set.Render("vm-metrics", map[string]any{"hours": "many", "detail": "verbose", "colour": "red"})
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("err = %v, want ValidationError", err)
+	}
+	for _, want := range []string{"vm_name is required", "resource_group is required", "hours: many is not an integer", `detail: "verbose" is not one of summary, full`, "colour is not a parameter"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+	if _, err := set.Render("missing", nil); err == nil {
+		t.Error("expected error for unknown template")
+	}
+}
+
+func TestLoadRejectsBadTemplates(t *testing.T) {
+	for name, src := range map[string]string{
+		"no header":    "just a prompt",
+		"no agent":     "---\nname: x\n---\nhi",
+		"bad type":     "---\nagent: a\nparameters:\n  - name: n\n    type: decimal\n---\nhi",
+		"bad default":  "---\nagent: a\nparameters:\n  - name: n\n    type: int\n    default: lots\n---\nhi",
+		"bad template": "---\nagent: a\n---\n{{.x",
+		"bad partial":  "---\nagent: a\n---\n{{template \"nope\"}}",
+	} {
+		fsys := fstest.MapFS{"t.prompt": {Data: []byte(src)}}
+		set, err := Load(fsys, "*.prompt")
+		if err == nil {
+			// Missing partials surface only at render time.
+			_, err = set.Render("t", nil)
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -1,24 +1,70 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"embed"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"log/slog"
+	"os"
+
+	"github.com/olafkfreund/ai_team_workshop/config"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+	"github.com/olafkfreund/ai_team_workshop/mpcclient/vmmetrics"
+	"github.com/olafkfreund/ai_team_workshop/prompttmpl"
 )
 
+//go:embed prompts/*.prompt
+var prompts embed.FS
+
 func main() {
-	agent := "azureVmMetricsAgent"
-	mpcServer := "http://localhost:8080"
-	prompt := "Check the CPU and network metrics for VM 'webserver01' in resource group 'prod-rg'."
+	// The server, credentials and timeouts come from -config, $MPC_* or
+	// flags; see the config package for the full list.
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// LOG_LEVEL=debug also logs each HTTP exchange, with credentials redacted.
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL")))
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	cfg, err := config.Load(flag.CommandLine)
+	if err != nil {
+		logger.Error("load config", "error", err)
+		os.Exit(1)
+	}
 
-	body, _ := json.Marshal(map[string]string{"prompt": prompt})
-	resp, err := http.Post(fmt.Sprintf("%s/agent/%s", mpcServer, agent), "application/json", bytes.NewBuffer(body))
+	set, err := prompttmpl.Load(prompts, "prompts/*.prompt")
+	if err != nil {
+		logger.Error("load prompts", "error", err)
+		os.Exit(1)
+	}
+	req, err := set.Render("vm-metrics", map[string]any{"vm_name": "webserver01", "resource_group": "prod-rg"})
 	if err != nil {
-		panic(err)
+		logger.Error("render prompt", "error", err)
+		os.Exit(1)
+	}
+
+	client, err := mpcclient.NewClientFromConfig(cfg, mpcclient.WithLogger(logger))
+	if err != nil {
+		logger.Error("create client", "error", err)
+		os.Exit(1)
+	}
+	resp, err := client.Invoke(context.Background(), req.Agent, req.Request)
+	var dryRun *mpcclient.DryRunError
+	if errors.As(err, &dryRun) {
+		dryRun.WriteTo(os.Stdout)
+		return
+	}
+	if err != nil {
+		logger.Error("call agent", "agent", req.Agent, "error", err)
+		os.Exit(1)
+	}
+	fmt.Println(resp.Result)
+	// The live agent also returns the series behind its summary; the demo
+	// one only text.
+	if report, err := vmmetrics.Decode(resp); err == nil {
+		fmt.Print("\n", report.Render(40))
 	}
-	defer resp.Body.Close()
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-	fmt.Println(result)
 }
@@ -0,0 +1,79 @@
+package vectorstore
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Default chunk sizes, in characters.
+const (
+	DefaultChunkSize    = 1000
+	DefaultChunkOverlap = 200
+)
+
+// Splitter splits text into overlapping chunks for embedding. Chunks end
+// at a paragraph, line, sentence or word boundary where one falls in their
+// second half, so that they rarely cut a word in two.
+type Splitter struct {
+	// Size is the maximum length of a chunk in characters;
+	// DefaultChunkSize when zero.
+	Size int
+	// Overlap is how many characters each chunk repeats from the end of
+	// the one before, so that text near a boundary keeps its context.
+	// DefaultChunkOverlap when zero, and at most half of Size.
+	Overlap int
+}
+
+// Split returns the chunks of text, trimmed of surrounding whitespace.
+// Text of at most Size characters is a single chunk; blank text has none.
+func (sp Splitter) Split(text string) []string {
+	size, overlap := sp.Size, sp.Overlap
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap <= 0 {
+		overlap = DefaultChunkOverlap
+	}
+	overlap = min(overlap, size/2)
+
+	r := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(r); {
+		end := len(r)
+		if end-start > size {
+			end = breakPoint(r, start+size/2, start+size)
+		}
+		if c := strings.TrimSpace(string(r[start:end])); c != "" {
+			chunks = append(chunks, c)
+		}
+		if end == len(r) {
+			break
+		}
+		next := max(end-overlap, start+1)
+		// Start the overlap at a word rather than inside one, if there is
+		// one to start at.
+		for i := next; i < end; i++ {
+			if unicode.IsSpace(r[i-1]) {
+				next = i
+				break
+			}
+		}
+		start = next
+	}
+	return chunks
+}
+
+// breakPoint returns the end of a chunk ending at or before limit and after
+// from: just after the last paragraph break, line break, sentence end or
+// space there, in that order of preference, or limit itself.
+func breakPoint(r []rune, from, limit int) int {
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		s := []rune(sep)
+		for i := limit - len(s); i >= from; i-- {
+			if string(r[i:i+len(s)]) == sep {
+				return i + len(s)
+			}
+		}
+	}
+	return limit
+}
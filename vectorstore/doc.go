@@ -0,0 +1,37 @@
+// Package vectorstore is a small local vector store for retrieval-augmented
+// prompts. It keeps documents and their embeddings in memory, optionally
+// persisted to a JSON file, and finds the ones closest to a query by
+// cosine similarity:
+//
+//	store, err := vectorstore.Open("runbooks.json", vectorstore.AgentEmbedder(client, "embeddingAgent"))
+//	if err != nil {
+//		return err
+//	}
+//	err = store.AddTexts(ctx,
+//		vectorstore.Document{ID: "disk", Text: "Expand the data disk before it reaches 90%.", Metadata: map[string]string{"source": "runbooks/disk.md"}},
+//		vectorstore.Document{ID: "cpu", Text: "Scale out the web tier when CPU stays above 80%."},
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	if err := store.Save(); err != nil {
+//		return err
+//	}
+//	prompt, err := store.AugmentPrompt(ctx, "The disk on webserver01 is almost full, what now?", 3)
+//	resp, err := client.CallAgent(ctx, "azureVmMetricsAgent", prompt)
+//
+// An Ingester fills a store from documents: Load reads text, Markdown and
+// PDF-extracted text files into sources, which the ingester splits into
+// overlapping chunks and embeds concurrently, under a rate limit:
+//
+//	sources, err := vectorstore.Load(os.DirFS("runbooks"), "*.md", "*.txt")
+//	if err != nil {
+//		return err
+//	}
+//	in := &vectorstore.Ingester{Store: store, Splitter: vectorstore.Splitter{Size: 800, Overlap: 100}, RateLimit: 5}
+//	n, err := in.Ingest(ctx, sources...)
+//
+// AugmentPrompt renders the retrieved snippets and the question through
+// DefaultTemplate, or the store's own Template. The search is a linear
+// scan, which suits the few thousand documents of a workshop exercise.
+package vectorstore
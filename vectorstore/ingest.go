@@ -0,0 +1,176 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// Ingester defaults.
+const (
+	DefaultIngestBatchSize   = 32
+	DefaultIngestConcurrency = 4
+)
+
+// Ingester splits sources into chunks, embeds them and writes them into a
+// store: the ingestion half of a retrieval-augmented workflow.
+type Ingester struct {
+	// Store receives the chunks and embeds them with its Embedder.
+	Store *Store
+	// Splitter sets the size and overlap of chunks.
+	Splitter Splitter
+	// BatchSize is the number of chunks embedded per call;
+	// DefaultIngestBatchSize when zero.
+	BatchSize int
+	// Concurrency bounds the embedding calls in flight;
+	// DefaultIngestConcurrency when zero.
+	Concurrency int
+	// RateLimit caps embedding calls per second, to stay within the
+	// server's limits; zero leaves them unlimited.
+	RateLimit float64
+	// OnProgress is called after each batch of chunks is embedded or
+	// fails, one call at a time.
+	OnProgress func(IngestProgress)
+}
+
+// IngestProgress reports how far the embedding of an Ingest call has got.
+type IngestProgress struct {
+	// Embedded is the number of chunks embedded so far, of Total.
+	Embedded int
+	Total    int
+	// Batch is the number of chunks in the batch that just finished, and
+	// Err its error if it failed.
+	Batch int
+	Err   error
+}
+
+// Ingest chunks and embeds sources and stores the chunks, replacing those
+// stored for the same sources before. It returns the number of chunks
+// stored. Nothing is stored unless every chunk was embedded.
+func (in *Ingester) Ingest(ctx context.Context, sources ...Source) (int, error) {
+	if in.Store == nil {
+		return 0, errors.New("vectorstore: ingester has no store")
+	}
+	ids := make(map[string]bool)
+	var docs []Document
+	for _, src := range sources {
+		if src.ID == "" {
+			return 0, errors.New("vectorstore: source ID is required")
+		}
+		if ids[src.ID] {
+			return 0, fmt.Errorf("vectorstore: source %q given twice", src.ID)
+		}
+		ids[src.ID] = true
+		chunks, err := in.chunk(src)
+		if err != nil {
+			return 0, err
+		}
+		docs = append(docs, chunks...)
+	}
+	if err := in.embed(ctx, docs); err != nil {
+		return 0, err
+	}
+
+	drop := func(id string) bool {
+		i := strings.LastIndex(id, "#")
+		return i >= 0 && ids[id[:i]]
+	}
+	if err := in.Store.replace(drop, docs); err != nil {
+		return 0, err
+	}
+	return len(docs), nil
+}
+
+// chunk splits src into documents without vectors.
+func (in *Ingester) chunk(src Source) ([]Document, error) {
+	segs, err := src.segments()
+	if err != nil {
+		return nil, err
+	}
+	var docs []Document
+	for _, seg := range segs {
+		for _, text := range in.Splitter.Split(seg.text) {
+			n := strconv.Itoa(len(docs))
+			meta := maps.Clone(src.Metadata)
+			if meta == nil {
+				meta = make(map[string]string)
+			}
+			maps.Copy(meta, seg.meta)
+			meta["chunk"] = n
+			docs = append(docs, Document{ID: src.ID + "#" + n, Text: text, Metadata: meta})
+		}
+	}
+	return docs, nil
+}
+
+// embed fills in the vectors of docs, in batches embedded concurrently
+// under the ingester's rate limit.
+func (in *Ingester) embed(ctx context.Context, docs []Document) error {
+	batch := in.BatchSize
+	if batch <= 0 {
+		batch = DefaultIngestBatchSize
+	}
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if in.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(in.RateLimit), 1)
+	}
+	concurrency := in.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultIngestConcurrency
+	}
+
+	var (
+		mu       sync.Mutex
+		progress = IngestProgress{Total: len(docs)}
+	)
+	report := func(n int, err error) {
+		if in.OnProgress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			progress.Embedded += n
+		}
+		progress.Batch, progress.Err = n, err
+		in.OnProgress(progress)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for start := 0; start < len(docs); start += batch {
+		part := docs[start:min(start+batch, len(docs))]
+		g.Go(func() error {
+			err := in.embedBatch(ctx, limiter, part)
+			report(len(part), err)
+			return err
+		})
+	}
+	return g.Wait()
+}
+
+// embedBatch fills in the vectors of part with a single embedding call.
+func (in *Ingester) embedBatch(ctx context.Context, limiter *rate.Limiter, part []Document) error {
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+	texts := make([]string, len(part))
+	for i, d := range part {
+		texts[i] = d.Text
+	}
+	vectors, err := in.Store.embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	for i := range part {
+		part[i].Vector = vectors[i]
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package vectorstore_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/olafkfreund/ai_team_workshop/vectorstore"
+)
+
+func TestSplitter(t *testing.T) {
+	sp := vectorstore.Splitter{Size: 40, Overlap: 10}
+	text := "The first paragraph is short.\n\nThe second paragraph runs on for quite a bit longer than the first one does."
+	chunks := sp.Split(text)
+	if len(chunks) < 3 || chunks[0] != "The first paragraph is short." {
+		t.Fatalf("chunks = %q", chunks)
+	}
+	for i, c := range chunks {
+		if len([]rune(c)) > 40 {
+			t.Errorf("chunk %d is %d long", i, len(c))
+		}
+		for _, w := range strings.Fields(c) {
+			if !strings.Contains(text, " "+w) && !strings.HasPrefix(text, w) && !strings.Contains(text, "\n"+w) {
+				t.Errorf("chunk %d cuts a word: %q", i, w)
+			}
+		}
+	}
+	if !strings.HasSuffix(chunks[1], strings.Fields(chunks[2])[0]+" on") {
+		t.Errorf("chunks %q and %q do not overlap", chunks[1], chunks[2])
+	}
+	if got := sp.Split("  \n "); got != nil {
+		t.Errorf("blank text: %q", got)
+	}
+	if long := strings.Repeat("x", 100); len(sp.Split(long)) != 3 || sp.Split(long)[1] != long[30:70] {
+		t.Errorf("text without breaks: %q", sp.Split(long))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/disk.md":   {Data: []byte("---\ntitle: Disks\n---\nIntro.\n\n## Expanding\nGrow the disk.\n```\n# not a heading\n```\n")},
+		"docs/guide.txt": {Data: []byte("Page one.\fPage two.")},
+		"docs/plain.txt": {Data: []byte("Plain text.")},
+		"docs/scan.pdf":  {Data: []byte("%PDF-1.7")},
+	}
+	sources, err := vectorstore.Load(fsys, "docs/*.md", "docs/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formats := map[string]string{}
+	for _, s := range sources {
+		formats[s.ID] = s.Format
+	}
+	if formats["docs/disk.md"] != vectorstore.FormatMarkdown || formats["docs/guide.txt"] != vectorstore.FormatPDFText || formats["docs/plain.txt"] != vectorstore.FormatText {
+		t.Errorf("formats = %v", formats)
+	}
+	if _, err := vectorstore.Load(fsys, "docs/*.pdf"); err == nil {
+		t.Error("loading a PDF succeeded")
+	}
+	if _, err := vectorstore.Load(fsys, "none/*"); err == nil {
+		t.Error("loading no files succeeded")
+	}
+}
+
+func TestIngest(t *testing.T) {
+	var calls, inFlight, maxInFlight atomic.Int32
+	var mu sync.Mutex
+	embedded := map[string]bool{}
+	embedder := vectorstore.EmbedderFunc(func(ctx context.Context, texts []string) ([][]float32, error) {
+		calls.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, text := range texts {
+			if strings.Contains(text, "fail") {
+				return nil, errors.New("embedding backend down")
+			}
+			embedded[text] = true
+		}
+		return keywordEmbedder(ctx, texts)
+	})
+	store := vectorstore.New(embedder)
+	in := &vectorstore.Ingester{Store: store, Splitter: vectorstore.Splitter{Size: 30, Overlap: 5}, BatchSize: 2, Concurrency: 2}
+
+	md := vectorstore.Source{ID: "disk.md", Format: vectorstore.FormatMarkdown, Metadata: map[string]string{"source": "disk.md"},
+		Text: "Intro about disks.\n\n## Expanding\nGrow the disk before it fills up completely.\n\n## Cleaning\nRemove old logs and caches.\n"}
+	pdf := vectorstore.Source{ID: "cpu.txt", Format: vectorstore.FormatPDFText, Text: "CPU page one.\fCPU page two."}
+	n, err := in.Ingest(context.Background(), md, pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != store.Len() || n < 5 {
+		t.Fatalf("ingested %d chunks, store holds %d", n, store.Len())
+	}
+	if got := maxInFlight.Load(); got != 2 {
+		t.Errorf("max concurrent embeddings = %d, want 2", got)
+	}
+	first, _ := store.Get("disk.md#0")
+	if first.Metadata["source"] != "disk.md" || first.Metadata["section"] != "" || first.Metadata["chunk"] != "0" {
+		t.Errorf("first chunk = %+v", first)
+	}
+	res, _ := store.SearchText(context.Background(), "cpu", 1)
+	if len(res) != 1 || res[0].Metadata["page"] == "" {
+		t.Errorf("cpu search = %+v", res)
+	}
+	sections := map[string]bool{}
+	for i := range n {
+		if d, ok := store.Get("disk.md#" + strconv.Itoa(i)); ok {
+			sections[d.Metadata["section"]] = true
+		}
+	}
+	if !sections["Expanding"] || !sections["Cleaning"] {
+		t.Errorf("sections = %v", sections)
+	}
+
+	md.Text = "Short now."
+	if n, err := in.Ingest(context.Background(), md); err != nil || n != 1 {
+		t.Fatalf("re-ingest: %d, %v", n, err)
+	}
+	if _, ok := store.Get("disk.md#1"); ok {
+		t.Error("re-ingest kept stale chunks")
+	}
+	before := store.Len()
+	if _, err := in.Ingest(context.Background(), vectorstore.Source{ID: "bad", Text: "this will fail"}, pdf); err == nil {
+		t.Fatal("ingest with a failing batch succeeded")
+	}
+	if store.Len() != before {
+		t.Errorf("failed ingest changed the store: %d documents, had %d", store.Len(), before)
+	}
+}
+
+func TestIngestRateLimit(t *testing.T) {
+	store := vectorstore.New(keywordEmbedder)
+	in := &vectorstore.Ingester{Store: store, Splitter: vectorstore.Splitter{Size: 10, Overlap: 1}, BatchSize: 1, RateLimit: 50}
+	start := time.Now()
+	n, err := in.Ingest(context.Background(), vectorstore.Source{ID: "s", Text: "aaaa bbbb cccc dddd eeee ffff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// After the first, single-chunk calls at 50 per second are 20ms apart.
+	if want := time.Duration(n-1) * 20 * time.Millisecond; n < 3 || time.Since(start) < want*9/10 {
+		t.Errorf("%d chunks took %v, want at least %v", n, time.Since(start), want)
+	}
+}
+
+func TestIngestProgress(t *testing.T) {
+	var reports []vectorstore.IngestProgress
+	in := &vectorstore.Ingester{
+		Store:      vectorstore.New(keywordEmbedder),
+		Splitter:   vectorstore.Splitter{Size: 10, Overlap: 1},
+		BatchSize:  2,
+		OnProgress: func(p vectorstore.IngestProgress) { reports = append(reports, p) },
+	}
+	n, err := in.Ingest(context.Background(), vectorstore.Source{ID: "s", Text: "aaaa bbbb cccc dddd eeee ffff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != (n+1)/2 {
+		t.Fatalf("%d reports for %d chunks in batches of 2", len(reports), n)
+	}
+	if last := reports[len(reports)-1]; last.Embedded != n || last.Total != n || last.Err != nil {
+		t.Errorf("last report = %+v", last)
+	}
+
+	reports = nil
+	in.Store = vectorstore.New(vectorstore.EmbedderFunc(func(context.Context, []string) ([][]float32, error) {
+		return nil, errors.New("embedding backend down")
+	}))
+	in.Concurrency = 1
+	if _, err := in.Ingest(context.Background(), vectorstore.Source{ID: "s", Text: "aaaa bbbb"}); err == nil {
+		t.Fatal("ingest with a failing embedder succeeded")
+	}
+	if len(reports) != 1 || reports[0].Err == nil || reports[0].Embedded != 0 || reports[0].Batch != 1 {
+		t.Errorf("reports = %+v", reports)
+	}
+}
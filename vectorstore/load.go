@@ -0,0 +1,179 @@
+package vectorstore
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Source formats, which decide how a source is divided before chunking.
+const (
+	// FormatText is plain text, chunked as a whole.
+	FormatText = "text"
+	// FormatMarkdown is Markdown, chunked section by section. Its chunks
+	// carry the heading they fall under as "section" metadata, and YAML
+	// front matter is dropped.
+	FormatMarkdown = "markdown"
+	// FormatPDFText is text extracted from a PDF by a tool such as
+	// pdftotext, with pages separated by form feeds. Its chunks never span
+	// pages and carry their page number as "page" metadata.
+	FormatPDFText = "pdf-text"
+)
+
+// Source is a document to ingest.
+type Source struct {
+	// ID identifies the source, such as its path. Its chunks are stored
+	// under IDs of the form ID#n, and ingesting a source again replaces
+	// them.
+	ID   string
+	Text string
+	// Format is FormatText, FormatMarkdown or FormatPDFText; empty means
+	// FormatText.
+	Format string
+	// Metadata is copied to every chunk of the source.
+	Metadata map[string]string
+}
+
+// LoadFile reads the text or Markdown file at path into a source, whose
+// format follows from the file's extension and content: .md and .markdown
+// files are Markdown, and text files holding form feeds are PDF-extracted
+// text. The path is the source's ID and its "source" metadata.
+func LoadFile(path string) (Source, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Source{}, fmt.Errorf("vectorstore: %w", err)
+	}
+	return newSource(filepath.ToSlash(path), b)
+}
+
+// Load reads the files in fsys matching any of the glob patterns, such as
+// "docs/*.md", into sources. See LoadFile.
+func Load(fsys fs.FS, patterns ...string) ([]Source, error) {
+	var sources []Source
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("vectorstore: %w", err)
+		}
+		for _, name := range matches {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			b, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, fmt.Errorf("vectorstore: %w", err)
+			}
+			src, err := newSource(name, b)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, src)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("vectorstore: no files match %s", strings.Join(patterns, ", "))
+	}
+	return sources, nil
+}
+
+func newSource(name string, b []byte) (Source, error) {
+	text := strings.ToValidUTF8(string(b), "�")
+	format := FormatText
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		format = FormatMarkdown
+	case ".txt", ".text", "":
+		if strings.ContainsRune(text, '\f') {
+			format = FormatPDFText
+		}
+	default:
+		return Source{}, fmt.Errorf("vectorstore: %s: unsupported file type; extract PDFs to text first", name)
+	}
+	return Source{ID: name, Text: text, Format: format, Metadata: map[string]string{"source": name}}, nil
+}
+
+// segment is a part of a source chunked on its own, with the metadata its
+// chunks add.
+type segment struct {
+	text string
+	meta map[string]string
+}
+
+func (src Source) segments() ([]segment, error) {
+	switch src.Format {
+	case FormatText, "":
+		return []segment{{text: src.Text}}, nil
+	case FormatPDFText:
+		var segs []segment
+		for i, page := range strings.Split(src.Text, "\f") {
+			segs = append(segs, segment{text: page, meta: map[string]string{"page": strconv.Itoa(i + 1)}})
+		}
+		return segs, nil
+	case FormatMarkdown:
+		return markdownSections(src.Text), nil
+	}
+	return nil, fmt.Errorf("vectorstore: source %q has unknown format %q", src.ID, src.Format)
+}
+
+// markdownSections splits Markdown at its ATX headings, skipping front
+// matter and fenced code when looking for them. Each heading stays at the
+// top of its section's text.
+func markdownSections(text string) []segment {
+	var segs []segment
+	var b strings.Builder
+	section, fenced := "", false
+	flush := func() {
+		if strings.TrimSpace(b.String()) != "" {
+			seg := segment{text: b.String()}
+			if section != "" {
+				seg.meta = map[string]string{"section": section}
+			}
+			segs = append(segs, seg)
+		}
+		b.Reset()
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(stripFrontMatter(text)))
+	sc.Buffer(nil, len(text)+1)
+	for sc.Scan() {
+		line := sc.Text()
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		} else if h, ok := heading(line); ok && !fenced {
+			flush()
+			section = h
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	flush()
+	return segs
+}
+
+// heading returns the text of an ATX heading line such as "## Disks".
+func heading(line string) (string, bool) {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 || (len(line) > level && line[level] != ' ' && line[level] != '\t') {
+		return "", false
+	}
+	h := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	return h, h != ""
+}
+
+func stripFrontMatter(text string) string {
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return text
+	}
+	if i := strings.Index(rest, "\n---\n"); i >= 0 {
+		return rest[i+len("\n---\n"):]
+	}
+	return text
+}
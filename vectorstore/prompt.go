@@ -0,0 +1,44 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate renders augmented prompts when a store has no Template
+// of its own. It lists the retrieved snippets, numbered and with their
+// "source" metadata, ahead of the question.
+var DefaultTemplate = template.Must(template.New("augment").Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).Parse(
+	`Answer the question using the context below. If the context does not contain the answer, say so.
+
+Context:
+{{range $i, $r := .Results}}[{{$i | inc}}] {{.Text}}{{with .Metadata.source}} (source: {{.}}){{end}}
+{{else}}(no relevant context found)
+{{end}}
+Question: {{.Query}}`))
+
+// PromptData is the data an augmented prompt template is executed with.
+type PromptData struct {
+	Query   string
+	Results []Result
+}
+
+// AugmentPrompt retrieves the k documents most similar to query and
+// renders them with it into a prompt through the store's Template.
+func (s *Store) AugmentPrompt(ctx context.Context, query string, k int) (string, error) {
+	results, err := s.SearchText(ctx, query, k)
+	if err != nil {
+		return "", err
+	}
+	tmpl := s.Template
+	if tmpl == nil {
+		tmpl = DefaultTemplate
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, PromptData{Query: query, Results: results}); err != nil {
+		return "", fmt.Errorf("vectorstore: render prompt: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,374 @@
+package vectorstore
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/template"
+
+	"github.com/olafkfreund/ai_team_workshop/mpcclient"
+)
+
+// fileVersion is written to saved stores. Files written by a newer version
+// are refused rather than misread.
+const fileVersion = 1
+
+// Document is one stored text with its embedding.
+type Document struct {
+	// ID identifies the document; adding a document with an ID already in
+	// the store replaces it.
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	// Metadata holds free-form attributes such as the source file, shown
+	// in augmented prompts by templates that use them.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Vector is the embedding of Text. AddTexts fills it in when it is
+	// empty.
+	Vector []float32 `json:"vector"`
+}
+
+// Result is a document found by a search, with its cosine similarity to
+// the query.
+type Result struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+// Embedder turns texts into embedding vectors, one per text and in order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFunc adapts a function to the Embedder interface.
+type EmbedderFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// Embed calls f(ctx, texts).
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return f(ctx, texts)
+}
+
+// AgentEmbedder returns an Embedder that embeds texts with the named agent
+// through c.
+func AgentEmbedder(c *mpcclient.Client, agent string, opts ...mpcclient.CallOption) Embedder {
+	return EmbedderFunc(func(ctx context.Context, texts []string) ([][]float32, error) {
+		return c.Embed(ctx, agent, texts, opts...)
+	})
+}
+
+// ErrNoEmbedder is returned by the methods that embed text when the store
+// has no Embedder.
+var ErrNoEmbedder = errors.New("vectorstore: no embedder configured")
+
+// Store holds documents in memory and finds those closest to a query. It
+// is safe for concurrent use once its fields are set. Documents returned
+// by Get and Search share their vectors and metadata with the store and
+// must not be modified.
+type Store struct {
+	// Embedder embeds the texts of AddTexts, SearchText and AugmentPrompt.
+	// Stores used only with precomputed vectors need none.
+	Embedder Embedder
+	// Template renders AugmentPrompt's prompts; nil uses DefaultTemplate.
+	Template *template.Template
+
+	path string
+
+	mu   sync.RWMutex
+	docs []Document
+	ids  map[string]int
+	dims int
+}
+
+// New returns an empty in-memory store embedding text with e, which may be
+// nil.
+func New(e Embedder) *Store {
+	return &Store{Embedder: e, ids: make(map[string]int)}
+}
+
+// Open returns a store persisted to the file at path, loading the
+// documents already saved there. The file is written only by Save.
+func Open(path string, e Embedder) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("vectorstore: path is required")
+	}
+	s := New(e)
+	s.path = path
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: open: %w", err)
+	}
+	defer f.Close()
+	if err := s.load(f); err != nil {
+		return nil, fmt.Errorf("vectorstore: load %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Len returns the number of stored documents.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.docs)
+}
+
+// Dimensions returns the length of the stored vectors, or 0 for an empty
+// store.
+func (s *Store) Dimensions() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dims
+}
+
+// Add stores docs, which must carry IDs and vectors of the same length as
+// those already stored. Either every document is added or, on error, none.
+func (s *Store) Add(docs ...Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(docs)
+}
+
+// add is Add with s.mu held.
+func (s *Store) add(docs []Document) error {
+	dims, err := check(docs, s.dims)
+	if err != nil {
+		return err
+	}
+	s.insert(docs, dims)
+	return nil
+}
+
+// check validates docs for adding to a store of vectors with dims
+// dimensions, 0 when empty, and returns the dimensions once they are added.
+func check(docs []Document, dims int) (int, error) {
+	for _, d := range docs {
+		switch {
+		case d.ID == "":
+			return 0, errors.New("vectorstore: document ID is required")
+		case len(d.Vector) == 0:
+			return 0, fmt.Errorf("vectorstore: document %q has no vector", d.ID)
+		case dims == 0:
+			dims = len(d.Vector)
+		case len(d.Vector) != dims:
+			return 0, fmt.Errorf("vectorstore: document %q has %d dimensions, want %d", d.ID, len(d.Vector), dims)
+		}
+	}
+	return dims, nil
+}
+
+// insert stores checked documents, with s.mu held.
+func (s *Store) insert(docs []Document, dims int) {
+	s.dims = dims
+	for _, d := range docs {
+		d.Vector = slices.Clone(d.Vector)
+		d.Metadata = maps.Clone(d.Metadata)
+		if i, ok := s.ids[d.ID]; ok {
+			s.docs[i] = d
+			continue
+		}
+		s.ids[d.ID] = len(s.docs)
+		s.docs = append(s.docs, d)
+	}
+}
+
+// AddTexts embeds the texts of docs that have no vector, in one call to
+// the store's Embedder, and adds them all.
+func (s *Store) AddTexts(ctx context.Context, docs ...Document) error {
+	var texts []string
+	var missing []int
+	for i, d := range docs {
+		if len(d.Vector) == 0 {
+			texts = append(texts, d.Text)
+			missing = append(missing, i)
+		}
+	}
+	if len(texts) > 0 {
+		vectors, err := s.embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		docs = slices.Clone(docs)
+		for j, i := range missing {
+			docs[i].Vector = vectors[j]
+		}
+	}
+	return s.Add(docs...)
+}
+
+// Get returns the document stored under id.
+func (s *Store) Get(id string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.ids[id]
+	if !ok {
+		return Document{}, false
+	}
+	return s.docs[i], true
+}
+
+// Delete removes the documents with the given IDs and returns how many
+// were stored.
+func (s *Store) Delete(ids ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, id := range ids {
+		if s.remove(id) {
+			n++
+		}
+	}
+	return n
+}
+
+// remove deletes the document stored under id, with s.mu held.
+func (s *Store) remove(id string) bool {
+	i, ok := s.ids[id]
+	if !ok {
+		return false
+	}
+	last := len(s.docs) - 1
+	s.docs[i] = s.docs[last]
+	s.ids[s.docs[i].ID] = i
+	s.docs = s.docs[:last]
+	delete(s.ids, id)
+	if len(s.docs) == 0 {
+		s.dims = 0
+	}
+	return true
+}
+
+// replace removes the documents whose IDs match drop and adds docs, as one
+// change seen whole by concurrent readers. On error the store is left as
+// it was.
+func (s *Store) replace(drop func(id string) bool, docs []Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var dropped []string
+	for _, d := range s.docs {
+		if drop(d.ID) {
+			dropped = append(dropped, d.ID)
+		}
+	}
+	dims := s.dims
+	if len(dropped) == len(s.docs) {
+		dims = 0
+	}
+	dims, err := check(docs, dims)
+	if err != nil {
+		return err
+	}
+	for _, id := range dropped {
+		s.remove(id)
+	}
+	s.insert(docs, dims)
+	return nil
+}
+
+// Search returns the k documents most similar to vector, the closest
+// first. It returns fewer when the store holds fewer than k.
+func (s *Store) Search(vector []float32, k int) []Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k <= 0 || len(vector) != s.dims {
+		return nil
+	}
+	results := make([]Result, len(s.docs))
+	for i, d := range s.docs {
+		results[i] = Result{Document: d, Score: mpcclient.CosineSimilarity(vector, d.Vector)}
+	}
+	slices.SortFunc(results, func(a, b Result) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.ID, b.ID))
+	})
+	return results[:min(k, len(results))]
+}
+
+// SearchText embeds query and returns the k documents most similar to it.
+func (s *Store) SearchText(ctx context.Context, query string, k int) ([]Result, error) {
+	vectors, err := s.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return s.Search(vectors[0], k), nil
+}
+
+func (s *Store) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if s.Embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	vectors, err := s.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: embed: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("vectorstore: embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// storeFile is the JSON layout of a saved store.
+type storeFile struct {
+	Version    int        `json:"version"`
+	Dimensions int        `json:"dimensions"`
+	Documents  []Document `json:"documents"`
+}
+
+// Save writes the store to the file it was opened from, replacing it
+// atomically.
+func (s *Store) Save() error {
+	if s.path == "" {
+		return errors.New("vectorstore: store was not opened from a file")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("vectorstore: save: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("vectorstore: save: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := s.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("vectorstore: save: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("vectorstore: save: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("vectorstore: save: %w", err)
+	}
+	return nil
+}
+
+// WriteTo writes the store's documents to w as JSON, in the format Open
+// reads.
+func (s *Store) WriteTo(w io.Writer) (int64, error) {
+	s.mu.RLock()
+	f := storeFile{Version: fileVersion, Dimensions: s.dims, Documents: s.docs}
+	b, err := json.Marshal(f)
+	s.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+func (s *Store) load(r io.Reader) error {
+	var f storeFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	}
+	if f.Version > fileVersion {
+		return fmt.Errorf("file version %d is newer than supported version %d", f.Version, fileVersion)
+	}
+	return s.Add(f.Documents...)
+}
@@ -0,0 +1,133 @@
+package vectorstore_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/olafkfreund/ai_team_workshop/vectorstore"
+)
+
+// keywordEmbedder embeds a text by which of a few keywords it mentions.
+var keywordEmbedder = vectorstore.EmbedderFunc(func(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		text = strings.ToLower(text)
+		for _, kw := range []string{"disk", "cpu", "memory"} {
+			var v float32
+			if strings.Contains(text, kw) {
+				v = 1
+			}
+			out[i] = append(out[i], v)
+		}
+	}
+	return out, nil
+})
+
+var runbooks = []vectorstore.Document{
+	{ID: "disk", Text: "Expand the data disk before it reaches 90%.", Metadata: map[string]string{"source": "disk.md"}},
+	{ID: "cpu", Text: "Scale out the web tier when CPU stays high."},
+	{ID: "both", Text: "Check CPU and memory together during load tests."},
+}
+
+func newStore(t *testing.T, path string) *vectorstore.Store {
+	t.Helper()
+	s, err := vectorstore.Open(path, keywordEmbedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTexts(context.Background(), runbooks...); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSearch(t *testing.T) {
+	s := newStore(t, filepath.Join(t.TempDir(), "store.json"))
+	if s.Len() != 3 || s.Dimensions() != 3 {
+		t.Fatalf("len %d, dimensions %d", s.Len(), s.Dimensions())
+	}
+	res, err := s.SearchText(context.Background(), "high cpu usage", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].ID != "cpu" || res[0].Score != 1 || res[1].ID != "both" {
+		t.Errorf("results = %+v", res)
+	}
+	if got := s.Search([]float32{1, 0}, 1); got != nil {
+		t.Errorf("search with wrong dimensions = %+v", got)
+	}
+
+	if err := s.Add(vectorstore.Document{ID: "cpu", Text: "Replaced.", Vector: []float32{0, 1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := s.Get("cpu"); d.Text != "Replaced." || s.Len() != 3 {
+		t.Errorf("replace: %+v, len %d", d, s.Len())
+	}
+	if n := s.Delete("cpu", "missing"); n != 1 || s.Len() != 2 {
+		t.Errorf("delete = %d, len %d", n, s.Len())
+	}
+	if _, ok := s.Get("both"); !ok {
+		t.Error("delete lost another document")
+	}
+}
+
+func TestAddRejectsInvalidDocuments(t *testing.T) {
+	s := vectorstore.New(nil)
+	s.Add(vectorstore.Document{ID: "a", Vector: []float32{1, 0}})
+	for name, d := range map[string]vectorstore.Document{
+		"no ID":         {Vector: []float32{1, 0}},
+		"no vector":     {ID: "b"},
+		"wrong length":  {ID: "b", Vector: []float32{1, 0, 0}},
+		"one dimension": {ID: "c", Vector: []float32{1}},
+	} {
+		if err := s.Add(vectorstore.Document{ID: "ok", Vector: []float32{0, 1}}, d); err == nil {
+			t.Errorf("%s: Add succeeded", name)
+		}
+	}
+	if s.Len() != 1 {
+		t.Errorf("len = %d after failed adds", s.Len())
+	}
+	if err := s.AddTexts(context.Background(), vectorstore.Document{ID: "t", Text: "x"}); !errors.Is(err, vectorstore.ErrNoEmbedder) {
+		t.Errorf("AddTexts without embedder: %v", err)
+	}
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "store.json")
+	if err := newStore(t, path).Save(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := vectorstore.Open(path, keywordEmbedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := s.Get("disk"); !ok || s.Len() != 3 || d.Metadata["source"] != "disk.md" || len(d.Vector) != 3 {
+		t.Errorf("reopened: %+v, len %d", d, s.Len())
+	}
+	if err := vectorstore.New(nil).Save(); err == nil {
+		t.Error("Save of an in-memory store succeeded")
+	}
+}
+
+func TestAugmentPrompt(t *testing.T) {
+	s := newStore(t, filepath.Join(t.TempDir(), "store.json"))
+	ctx := context.Background()
+	prompt, err := s.AugmentPrompt(ctx, "The disk is full", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[1] Expand the data disk before it reaches 90%. (source: disk.md)", "Question: The disk is full"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+
+	s.Template = template.Must(template.New("t").Parse(`{{range .Results}}{{.ID}} {{end}}| {{.Query}}`))
+	if prompt, _ := s.AugmentPrompt(ctx, "cpu", 2); prompt != "cpu both | cpu" {
+		t.Errorf("custom template: %q", prompt)
+	}
+}